@@ -0,0 +1,254 @@
+// Package adapters bridges chat platforms to a companion. Platform specific packages (slack, discord,
+// telegram) translate incoming messages into IncomingMessages and implement Platform for replies.
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+const (
+	// DefaultUpdateInterval limits how often a streamed answer is edited, to respect platform rate limits.
+	DefaultUpdateInterval = time.Second
+	// Placeholder is posted before the first chunk of a streamed answer arrives.
+	Placeholder = "…"
+	// maxImageBytes limits the size of downloaded attachments.
+	maxImageBytes = 20 * 1024 * 1024
+)
+
+// IncomingMessage is a platform independent message received from a chat platform.
+type IncomingMessage struct {
+	Channel string // conversation key, e.g. a channel, chat or thread id
+	User    string
+	Text    string
+	Images  []models.Base64Image
+}
+
+// Platform sends and edits messages on a chat platform.
+type Platform interface {
+	// Send posts a new message and returns its id.
+	Send(ctx context.Context, channel, text string) (string, error)
+	// Edit replaces the text of a previously sent message.
+	Edit(ctx context.Context, channel, messageID, text string) error
+}
+
+// ConversationStore keeps the conversation history of each channel.
+type ConversationStore = conversationstore.Store
+
+// MemoryStore is an in-memory ConversationStore.
+type MemoryStore = conversationstore.MemoryStore
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return conversationstore.NewMemoryStore()
+}
+
+// Bridge answers incoming platform messages with a companion. Each channel has its own conversation,
+// and streamed answers are delivered by editing the reply as chunks arrive. The messages of a channel
+// are answered in order.
+type Bridge struct {
+	Companion aicompanion.AICompanion
+	// NewCompanion creates the companion answering a message, if set, so that the messages of different
+	// channels are answered concurrently. Companion is not used then; since it holds a single
+	// conversation, it answers one message at a time.
+	NewCompanion   func() (aicompanion.AICompanion, error)
+	Platform       Platform
+	Store          ConversationStore
+	Streaming      bool
+	UpdateInterval time.Duration
+	MaxHistory     int // maximum number of messages kept per channel, zero keeps all
+
+	// companionMutex serializes the requests to Companion
+	companionMutex sync.Mutex
+	// mutex guards channels, which holds a lock per channel
+	mutex    sync.Mutex
+	channels map[string]*sync.Mutex
+}
+
+// NewBridge creates a new Bridge with an in-memory conversation store and streaming enabled.
+func NewBridge(companion aicompanion.AICompanion, platform Platform) *Bridge {
+	return &Bridge{
+		Companion:      companion,
+		Platform:       platform,
+		Store:          NewMemoryStore(),
+		Streaming:      true,
+		UpdateInterval: DefaultUpdateInterval,
+	}
+}
+
+// Handle answers an incoming message in its channel.
+func (bridge *Bridge) Handle(ctx context.Context, incoming IncomingMessage) error {
+	if strings.TrimSpace(incoming.Text) == "" && len(incoming.Images) == 0 {
+		return nil
+	}
+
+	unlock := bridge.lockChannel(incoming.Channel)
+	defer unlock()
+
+	companion := bridge.Companion
+	if bridge.NewCompanion != nil {
+		var err error
+		if companion, err = bridge.NewCompanion(); err != nil {
+			return err
+		}
+	} else {
+		bridge.companionMutex.Lock()
+		defer bridge.companionMutex.Unlock()
+	}
+
+	history, err := bridge.Store.Load(incoming.Channel)
+	if err != nil {
+		return err
+	}
+
+	previous := companion.GetConversation()
+	companion.SetConversation(history)
+	defer func() {
+		conversation := companion.GetConversation()
+		if bridge.MaxHistory > 0 && len(conversation) > bridge.MaxHistory {
+			conversation = conversation[len(conversation)-bridge.MaxHistory:]
+		}
+		if err := bridge.Store.Save(incoming.Channel, conversation); err != nil {
+			sideKick.Error(err)
+		}
+		companion.SetConversation(previous)
+	}()
+
+	var images *[]models.Base64Image
+	if len(incoming.Images) > 0 {
+		images = &incoming.Images
+	}
+
+	request := models.MessageRequest{Message: sideKick.CreateUserMessage(incoming.Text, images)}
+	if !bridge.Streaming {
+		response, err := companion.SendChatRequest(ctx, request, false, nil)
+		if err != nil {
+			return err
+		}
+		_, err = bridge.Platform.Send(ctx, incoming.Channel, response.Content)
+		return err
+	}
+
+	messageID, err := bridge.Platform.Send(ctx, incoming.Channel, Placeholder)
+	if err != nil {
+		return err
+	}
+
+	interval := bridge.UpdateInterval
+	if interval <= 0 {
+		interval = DefaultUpdateInterval
+	}
+
+	var answer strings.Builder
+	var published string // the text shown while streaming
+	lastUpdate := time.Now()
+	response, err := companion.SendChatRequest(ctx, request, true, func(m models.Message) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		answer.WriteString(m.Content)
+		if time.Since(lastUpdate) < interval || strings.TrimSpace(answer.String()) == "" {
+			return nil
+		}
+
+		lastUpdate = time.Now()
+		published = answer.String() + " " + Placeholder
+		return bridge.Platform.Edit(ctx, incoming.Channel, messageID, published)
+	})
+	if err != nil {
+		if editErr := bridge.Platform.Edit(ctx, incoming.Channel, messageID, fmt.Sprintf("error: %v", err)); editErr != nil {
+			sideKick.Error(editErr)
+		}
+		return err
+	}
+
+	final := response.Content
+	if final == "" {
+		final = answer.String()
+	}
+	if final == published {
+		return nil
+	}
+	return bridge.Platform.Edit(ctx, incoming.Channel, messageID, final)
+}
+
+// Reset clears the conversation of a channel.
+func (bridge *Bridge) Reset(channel string) error {
+	unlock := bridge.lockChannel(channel)
+	defer unlock()
+	return bridge.Store.Delete(channel)
+}
+
+// lockChannel locks a channel until its message is answered and returns the function unlocking it.
+func (bridge *Bridge) lockChannel(channel string) func() {
+	bridge.mutex.Lock()
+	if bridge.channels == nil {
+		bridge.channels = make(map[string]*sync.Mutex)
+	}
+	lock, exists := bridge.channels[channel]
+	if !exists {
+		lock = &sync.Mutex{}
+		bridge.channels[channel] = lock
+	}
+	bridge.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// DownloadImage downloads an image attachment and returns it as Base64Image.
+// The optional header is added to the request, e.g. for platform authentication.
+func DownloadImage(ctx context.Context, client *http.Client, url string, header http.Header) (models.Base64Image, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return models.Base64Image{}, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.Base64Image{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		return models.Base64Image{}, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return models.Base64Image{}, err
+	}
+	if len(data) > maxImageBytes {
+		return models.Base64Image{}, fmt.Errorf("image exceeds %d bytes", maxImageBytes)
+	}
+
+	var image models.Base64Image
+	image.SetData(data)
+	return image, nil
+}
+
+// IsImage reports whether a MIME type denotes an image.
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
@@ -0,0 +1,189 @@
+package adapters_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/adapters"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// fakePlatform records the messages sent and edited, keyed by channel and message id.
+type fakePlatform struct {
+	mutex    sync.Mutex
+	messages map[string]string
+	edits    int
+	sent     chan string
+}
+
+func newFakePlatform() *fakePlatform {
+	return &fakePlatform{messages: make(map[string]string), sent: make(chan string, 10)}
+}
+
+func (platform *fakePlatform) Send(ctx context.Context, channel, text string) (string, error) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	id := fmt.Sprintf("%d", len(platform.messages)+1)
+	platform.messages[channel+"/"+id] = text
+	platform.sent <- channel
+	return id, nil
+}
+
+func (platform *fakePlatform) Edit(ctx context.Context, channel, messageID, text string) error {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	if _, exists := platform.messages[channel+"/"+messageID]; !exists {
+		return errors.New("unknown message")
+	}
+	platform.messages[channel+"/"+messageID] = text
+	platform.edits++
+	return nil
+}
+
+func (platform *fakePlatform) message(channel, id string) string {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	return platform.messages[channel+"/"+id]
+}
+
+func TestBridge(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("Hello there", "Still here")
+	platform := newFakePlatform()
+	bridge := adapters.NewBridge(companion, platform)
+	bridge.Streaming = false
+	bridge.MaxHistory = 3
+
+	if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "general", Text: "  "}); err != nil || len(platform.messages) != 0 {
+		t.Fatalf("expected empty messages to be ignored, got %d messages (%v)", len(platform.messages), err)
+	}
+
+	if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "general", Text: "Hi"}); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if platform.message("general", "1") != "Hello there" {
+		t.Errorf("expected the answer to be sent, got %q", platform.message("general", "1"))
+	}
+	if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "general", Text: "Still there?"}); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+
+	history, _ := bridge.Store.Load("general")
+	if len(history) != 3 || history[0].Content != "Hello there" || history[2].Content != "Still here" {
+		t.Errorf("expected the last 3 messages to be kept, got %+v", history)
+	}
+	if len(companion.Conversation) != 0 {
+		t.Errorf("expected the conversation of the companion to be restored, got %d messages", len(companion.Conversation))
+	}
+
+	if err := bridge.Reset("general"); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if history, _ := bridge.Store.Load("general"); len(history) != 0 {
+		t.Errorf("expected the conversation to be cleared, got %d messages", len(history))
+	}
+}
+
+func TestBridgeStreaming(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("one two three four")
+	platform := newFakePlatform()
+	bridge := adapters.NewBridge(companion, platform)
+	bridge.UpdateInterval = time.Nanosecond
+
+	if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "general", Text: "Count"}); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if platform.message("general", "1") != "one two three four" {
+		t.Errorf("expected the placeholder to be replaced by the answer, got %q", platform.message("general", "1"))
+	}
+	if platform.edits < 2 {
+		t.Errorf("expected the answer to be edited while streaming, got %d edits", platform.edits)
+	}
+
+	companion.Err = errors.New("unavailable")
+	if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "general", Text: "Again"}); err == nil {
+		t.Fatal("expected the error of the companion")
+	}
+	if platform.message("general", "2") != "error: unavailable" {
+		t.Errorf("expected the error to replace the placeholder, got %q", platform.message("general", "2"))
+	}
+}
+
+// blockingCompanion answers the message "wait" once release is closed.
+type blockingCompanion struct {
+	*aicompaniontest.FakeCompanion
+	release chan struct{}
+}
+
+func (companion blockingCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	if message.Message.Content == "wait" {
+		<-companion.release
+	}
+	return companion.FakeCompanion.SendChatRequest(ctx, message, streaming, callback)
+}
+
+func TestBridgeChannels(t *testing.T) {
+	release := make(chan struct{})
+	platform := newFakePlatform()
+	bridge := adapters.NewBridge(nil, platform)
+	bridge.Streaming = false
+	bridge.NewCompanion = func() (aicompanion.AICompanion, error) {
+		return blockingCompanion{aicompaniontest.NewFakeCompanion("answer"), release}, nil
+	}
+
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "slow", Text: "wait"}); err != nil {
+			t.Errorf("handle failed: %v", err)
+		}
+	}()
+
+	// another channel is answered while the first one waits for its answer
+	if err := bridge.Handle(context.Background(), adapters.IncomingMessage{Channel: "fast", Text: "Hi"}); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if channel := <-platform.sent; channel != "fast" {
+		t.Errorf("expected the fast channel to be answered first, got %s", channel)
+	}
+
+	close(release)
+	wait.Wait()
+	if history, _ := bridge.Store.Load("slow"); len(history) != 2 {
+		t.Errorf("expected the exchange of the slow channel to be saved, got %d messages", len(history))
+	}
+}
+
+func TestDownloadImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("\x89PNG\r\n\x1a\nimage data"))
+	}))
+	defer server.Close()
+
+	image, err := adapters.DownloadImage(context.Background(), nil, server.URL, http.Header{"Authorization": {"Bearer token"}})
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if data, _ := image.GetData(); string(data) != "\x89PNG\r\n\x1a\nimage data" {
+		t.Errorf("unexpected image data %q", data)
+	}
+
+	if _, err := adapters.DownloadImage(context.Background(), nil, server.URL, nil); err == nil {
+		t.Error("expected an error for an unauthorized download")
+	}
+	if !adapters.IsImage("image/png") || adapters.IsImage("application/pdf") {
+		t.Error("unexpected IsImage result")
+	}
+}
@@ -0,0 +1,348 @@
+// Package discord connects a companion to Discord through the gateway and the REST api.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/adapters"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+var (
+	// APIURL is the base url of the REST api.
+	APIURL = "https://discord.com/api/v10"
+	// GatewayURL is the url of the gateway websocket.
+	GatewayURL = "wss://gateway.discord.gg/?v=10&encoding=json"
+)
+
+const (
+	// gateway intents: GUILD_MESSAGES, DIRECT_MESSAGES and MESSAGE_CONTENT
+	intents = 1<<9 | 1<<12 | 1<<15
+	// maxMessageLength is the maximum length of a message's content.
+	maxMessageLength = 2000
+	// reconnectDelay is the pause before reconnecting to the gateway.
+	reconnectDelay = 5 * time.Second
+)
+
+// gateway opcodes
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+)
+
+// Adapter receives Discord messages over the gateway and answers them with a companion.
+// It implements adapters.Platform.
+type Adapter struct {
+	Token      string // bot token
+	Bridge     *adapters.Bridge
+	HttpClient *http.Client
+	// MentionsOnly restricts answers in guild channels to messages mentioning the bot.
+	// Direct messages are always answered.
+	MentionsOnly bool
+
+	mutex  sync.Mutex
+	userID string
+}
+
+// New creates a new Discord adapter for the given companion.
+func New(companion aicompanion.AICompanion, token string) *Adapter {
+	adapter := &Adapter{Token: token, HttpClient: &http.Client{Timeout: 30 * time.Second}, MentionsOnly: true}
+	adapter.Bridge = adapters.NewBridge(companion, adapter)
+	return adapter
+}
+
+type payload struct {
+	Op       int             `json:"op"`
+	Data     json.RawMessage `json:"d,omitempty"`
+	Sequence *int64          `json:"s,omitempty"`
+	Type     string          `json:"t,omitempty"`
+}
+
+type message struct {
+	ID          string       `json:"id"`
+	ChannelID   string       `json:"channel_id"`
+	GuildID     string       `json:"guild_id"`
+	Content     string       `json:"content"`
+	Author      author       `json:"author"`
+	Mentions    []author     `json:"mentions"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type author struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+type attachment struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+// Run connects to the gateway and handles messages until ctx is cancelled.
+// Lost connections are re-established after a short delay.
+func (adapter *Adapter) Run(ctx context.Context) error {
+	for {
+		err := adapter.connect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sideKick.Error(fmt.Errorf("discord gateway disconnected: %w", err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// connect runs a single gateway session.
+func (adapter *Adapter) connect(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, GatewayURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.CloseNow()
+	// the READY event exceeds the default read limit
+	conn.SetReadLimit(1 << 22)
+
+	var sequence sequenceNumber
+	for {
+		var received payload
+		if err := readPayload(ctx, conn, &received); err != nil {
+			return err
+		}
+		if received.Sequence != nil {
+			sequence.set(*received.Sequence)
+		}
+
+		switch received.Op {
+		case opHello:
+			var hello struct {
+				HeartbeatInterval int64 `json:"heartbeat_interval"`
+			}
+			if err := json.Unmarshal(received.Data, &hello); err != nil {
+				return err
+			}
+			go adapter.heartbeat(ctx, conn, time.Duration(hello.HeartbeatInterval)*time.Millisecond, &sequence)
+
+			identify := map[string]any{
+				"token":      adapter.Token,
+				"intents":    intents,
+				"properties": map[string]string{"os": "linux", "browser": "aicompanion", "device": "aicompanion"},
+			}
+			if err := writePayload(ctx, conn, opIdentify, identify); err != nil {
+				return err
+			}
+		case opHeartbeat:
+			if err := writePayload(ctx, conn, opHeartbeat, sequence.get()); err != nil {
+				return err
+			}
+		case opReconnect:
+			return errors.New("reconnect requested")
+		case opInvalidSession:
+			return errors.New("invalid session")
+		case opDispatch:
+			adapter.dispatch(ctx, received)
+		}
+	}
+}
+
+// dispatch handles gateway events.
+func (adapter *Adapter) dispatch(ctx context.Context, received payload) {
+	switch received.Type {
+	case "READY":
+		var ready struct {
+			User author `json:"user"`
+		}
+		if err := json.Unmarshal(received.Data, &ready); err != nil {
+			sideKick.Error(err)
+			return
+		}
+		adapter.mutex.Lock()
+		adapter.userID = ready.User.ID
+		adapter.mutex.Unlock()
+	case "MESSAGE_CREATE":
+		var m message
+		if err := json.Unmarshal(received.Data, &m); err != nil {
+			sideKick.Error(err)
+			return
+		}
+		go adapter.handle(context.WithoutCancel(ctx), m)
+	}
+}
+
+// handle converts a Discord message into an IncomingMessage and passes it to the bridge.
+func (adapter *Adapter) handle(ctx context.Context, m message) {
+	adapter.mutex.Lock()
+	userID := adapter.userID
+	adapter.mutex.Unlock()
+
+	if m.Author.Bot || m.Author.ID == userID {
+		return
+	}
+
+	mentioned := false
+	for _, mention := range m.Mentions {
+		if mention.ID == userID {
+			mentioned = true
+		}
+	}
+	if m.GuildID != "" && adapter.MentionsOnly && !mentioned {
+		return
+	}
+
+	text := strings.NewReplacer("<@"+userID+">", "", "<@!"+userID+">", "").Replace(m.Content)
+	incoming := adapters.IncomingMessage{Channel: m.ChannelID, User: m.Author.Username, Text: strings.TrimSpace(text)}
+	for _, file := range m.Attachments {
+		if !adapters.IsImage(file.ContentType) {
+			continue
+		}
+		image, err := adapters.DownloadImage(ctx, adapter.HttpClient, file.URL, nil)
+		if err != nil {
+			sideKick.Error(err)
+			continue
+		}
+		incoming.Images = append(incoming.Images, image)
+	}
+
+	if err := adapter.Bridge.Handle(ctx, incoming); err != nil {
+		sideKick.Error(err)
+	}
+}
+
+// heartbeat keeps the gateway session alive.
+func (adapter *Adapter) heartbeat(ctx context.Context, conn *websocket.Conn, interval time.Duration, sequence *sequenceNumber) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := writePayload(ctx, conn, opHeartbeat, sequence.get()); err != nil {
+				sideKick.Error(err)
+				conn.CloseNow()
+				return
+			}
+		}
+	}
+}
+
+// Send implements adapters.Platform.
+func (adapter *Adapter) Send(ctx context.Context, channel, text string) (string, error) {
+	var sent message
+	url := fmt.Sprintf("%s/channels/%s/messages", APIURL, channel)
+	if err := adapter.call(ctx, "POST", url, map[string]string{"content": truncate(text)}, &sent); err != nil {
+		return "", err
+	}
+	return sent.ID, nil
+}
+
+// Edit implements adapters.Platform.
+func (adapter *Adapter) Edit(ctx context.Context, channel, messageID, text string) error {
+	url := fmt.Sprintf("%s/channels/%s/messages/%s", APIURL, channel, messageID)
+	return adapter.call(ctx, "PATCH", url, map[string]string{"content": truncate(text)}, nil)
+}
+
+// call sends a request to the REST api and decodes the response into result.
+func (adapter *Adapter) call(ctx context.Context, method, url string, body any, result any) error {
+	payloadBytes, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+adapter.Token)
+
+	resp, err := adapter.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		return err
+	}
+
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// sequenceNumber holds the last sequence number received from the gateway.
+type sequenceNumber struct {
+	mutex sync.Mutex
+	value *int64
+}
+
+func (sequence *sequenceNumber) set(value int64) {
+	sequence.mutex.Lock()
+	defer sequence.mutex.Unlock()
+	sequence.value = &value
+}
+
+func (sequence *sequenceNumber) get() *int64 {
+	sequence.mutex.Lock()
+	defer sequence.mutex.Unlock()
+	return sequence.value
+}
+
+// readPayload reads a single gateway payload.
+func readPayload(ctx context.Context, conn *websocket.Conn, received *payload) error {
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, received)
+}
+
+// writePayload sends a single gateway payload.
+func writePayload(ctx context.Context, conn *websocket.Conn, op int, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(payload{Op: op, Data: raw})
+	if err != nil {
+		return err
+	}
+	return conn.Write(ctx, websocket.MessageText, encoded)
+}
+
+// truncate shortens text to the maximum message length.
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxMessageLength {
+		return text
+	}
+	return string(runes[:maxMessageLength-1]) + "…"
+}
+
+var _ adapters.Platform = (*Adapter)(nil)
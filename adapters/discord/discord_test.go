@@ -0,0 +1,145 @@
+package discord_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coder/websocket"
+
+	"github.com/ghmer/aicompanion/adapters/discord"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+)
+
+// newAPI serves the REST api, passing the contents of created messages to posted.
+func newAPI(t *testing.T, posted chan<- string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/channels/C1/messages":
+			posted <- payload.Content
+			json.NewEncoder(w).Encode(map[string]string{"id": "M1", "channel_id": "C1"})
+		case r.Method == http.MethodPatch && r.URL.Path == "/channels/C1/messages/M1":
+			json.NewEncoder(w).Encode(map[string]string{"id": "M1", "channel_id": "C1"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	discord.APIURL = server.URL
+}
+
+// newGateway serves a gateway session: it greets the client, passes the identify payload to
+// identified and dispatches the given events.
+func newGateway(t *testing.T, identified chan<- map[string]any, events ...string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+
+		ctx := r.Context()
+		conn.Write(ctx, websocket.MessageText, []byte(`{"op": 10, "d": {"heartbeat_interval": 45000}}`))
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		var identify struct {
+			Op   int            `json:"op"`
+			Data map[string]any `json:"d"`
+		}
+		json.Unmarshal(data, &identify)
+		if identify.Op == 2 {
+			identified <- identify.Data
+		}
+
+		for _, event := range events {
+			conn.Write(ctx, websocket.MessageText, []byte(event))
+		}
+		// keep the session open until the client disconnects
+		conn.Read(ctx)
+	}))
+	t.Cleanup(server.Close)
+	discord.GatewayURL = "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestGateway(t *testing.T) {
+	posted := make(chan string, 1)
+	identified := make(chan map[string]any, 1)
+	newAPI(t, posted)
+	newGateway(t, identified,
+		`{"op": 0, "s": 1, "t": "READY", "d": {"user": {"id": "B1", "username": "bot"}}}`,
+		`{"op": 0, "s": 2, "t": "MESSAGE_CREATE", "d": {"id": "1", "channel_id": "C1", "guild_id": "G1", "content": "not for the bot", "author": {"id": "U1"}}}`,
+		`{"op": 0, "s": 3, "t": "MESSAGE_CREATE", "d": {"id": "2", "channel_id": "C1", "guild_id": "G1", "content": "own message", "author": {"id": "B1"}, "mentions": [{"id": "B1"}]}}`,
+		`{"op": 0, "s": 4, "t": "MESSAGE_CREATE", "d": {"id": "3", "channel_id": "C1", "guild_id": "G1", "content": "<@B1> hello", "author": {"id": "U1", "username": "ada"}, "mentions": [{"id": "B1"}]}}`,
+	)
+	companion := aicompaniontest.NewFakeCompanion("Hello Ada")
+	adapter := discord.New(companion, "token")
+	adapter.Bridge.Streaming = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- adapter.Run(ctx) }()
+
+	select {
+	case identify := <-identified:
+		if identify["token"] != "token" || identify["intents"] != float64(1<<9|1<<12|1<<15) {
+			t.Errorf("unexpected identify payload %v", identify)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the adapter to identify")
+	}
+
+	select {
+	case content := <-posted:
+		if content != "Hello Ada" {
+			t.Errorf("unexpected answer %q", content)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the mention to be answered")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Run to end with the context, got %v", err)
+	}
+	if requests := companion.Requests(); len(requests) != 1 || requests[0].Message.Content != "hello" {
+		t.Errorf("expected only the mention to be answered without the mention itself, got %+v", requests)
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	posted := make(chan string, 1)
+	newAPI(t, posted)
+	adapter := discord.New(aicompaniontest.NewFakeCompanion(), "token")
+
+	id, err := adapter.Send(context.Background(), "C1", strings.Repeat("ä", 2500))
+	if err != nil || id != "M1" {
+		t.Fatalf("send failed: %q (%v)", id, err)
+	}
+	if content := <-posted; utf8.RuneCountInString(content) != 2000 || !strings.HasSuffix(content, "…") {
+		t.Errorf("expected the message to be truncated to 2000 characters, got %d", utf8.RuneCountInString(content))
+	}
+
+	if err := adapter.Edit(context.Background(), "C1", "M1", "edited"); err != nil {
+		t.Errorf("edit failed: %v", err)
+	}
+	if err := adapter.Edit(context.Background(), "C1", "M2", "edited"); err == nil {
+		t.Error("expected an error for an unknown message")
+	}
+}
@@ -0,0 +1,239 @@
+// Package slack connects a companion to Slack through the Events API.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/adapters"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// APIURL is the base url of the Slack Web API.
+var APIURL = "https://slack.com/api/"
+
+// maxRequestAge is the maximum age of a signed request before it is rejected as replay.
+const maxRequestAge = 5 * time.Minute
+
+// Adapter receives Slack events and answers them with a companion. It implements adapters.Platform
+// and http.Handler; mount it at the request url configured for the Slack app.
+type Adapter struct {
+	Token         string // bot token (xoxb-...)
+	SigningSecret string
+	Bridge        *adapters.Bridge
+	HttpClient    *http.Client
+	// Threaded answers in the thread of the incoming message and keeps one conversation per thread.
+	Threaded bool
+}
+
+// New creates a new Slack adapter for the given companion.
+func New(companion aicompanion.AICompanion, token, signingSecret string) *Adapter {
+	adapter := &Adapter{Token: token, SigningSecret: signingSecret, HttpClient: &http.Client{Timeout: 30 * time.Second}}
+	adapter.Bridge = adapters.NewBridge(companion, adapter)
+	return adapter
+}
+
+type envelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     event  `json:"event"`
+}
+
+type event struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	BotID    string `json:"bot_id"`
+	User     string `json:"user"`
+	Text     string `json:"text"`
+	Channel  string `json:"channel"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+	Files    []file `json:"files"`
+}
+
+type file struct {
+	MimeType   string `json:"mimetype"`
+	URLPrivate string `json:"url_private"`
+}
+
+// ServeHTTP verifies and acknowledges Slack events. Messages are answered in the background,
+// since Slack expects a response within three seconds.
+func (adapter *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !adapter.verify(r.Header, body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload envelope
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch payload.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, payload.Challenge)
+		return
+	case "event_callback":
+		if r.Header.Get("X-Slack-Retry-Num") == "" && adapter.isUserMessage(payload.Event) {
+			go adapter.handle(context.WithoutCancel(r.Context()), payload.Event)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// isUserMessage filters out bot messages, edits and other message subtypes.
+func (adapter *Adapter) isUserMessage(e event) bool {
+	if e.BotID != "" {
+		return false
+	}
+	switch e.Type {
+	case "app_mention":
+		return true
+	case "message":
+		return e.Subtype == "" || e.Subtype == "file_share"
+	}
+	return false
+}
+
+// handle converts a Slack event into an IncomingMessage and passes it to the bridge.
+func (adapter *Adapter) handle(ctx context.Context, e event) {
+	channel := e.Channel
+	if adapter.Threaded {
+		thread := e.ThreadTS
+		if thread == "" {
+			thread = e.TS
+		}
+		channel = e.Channel + ":" + thread
+	}
+
+	incoming := adapters.IncomingMessage{Channel: channel, User: e.User, Text: e.Text}
+	header := http.Header{"Authorization": {"Bearer " + adapter.Token}}
+	for _, attachment := range e.Files {
+		if !adapters.IsImage(attachment.MimeType) {
+			continue
+		}
+		image, err := adapters.DownloadImage(ctx, adapter.HttpClient, attachment.URLPrivate, header)
+		if err != nil {
+			sideKick.Error(err)
+			continue
+		}
+		incoming.Images = append(incoming.Images, image)
+	}
+
+	if err := adapter.Bridge.Handle(ctx, incoming); err != nil {
+		sideKick.Error(err)
+	}
+}
+
+// verify checks the request signature computed with the signing secret.
+func (adapter *Adapter) verify(header http.Header, body []byte) bool {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > maxRequestAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(adapter.SigningSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
+
+// Send implements adapters.Platform.
+func (adapter *Adapter) Send(ctx context.Context, channel, text string) (string, error) {
+	channelID, thread := splitChannel(channel)
+	payload := map[string]any{"channel": channelID, "text": text}
+	if thread != "" {
+		payload["thread_ts"] = thread
+	}
+
+	var response struct {
+		TS string `json:"ts"`
+	}
+	if err := adapter.call(ctx, "chat.postMessage", payload, &response); err != nil {
+		return "", err
+	}
+	return response.TS, nil
+}
+
+// Edit implements adapters.Platform.
+func (adapter *Adapter) Edit(ctx context.Context, channel, messageID, text string) error {
+	channelID, _ := splitChannel(channel)
+	return adapter.call(ctx, "chat.update", map[string]any{"channel": channelID, "ts": messageID, "text": text}, nil)
+}
+
+// call invokes a Web API method and decodes the response into result.
+func (adapter *Adapter) call(ctx context.Context, method string, payload any, result any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", APIURL+method, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+adapter.Token)
+
+	resp, err := adapter.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return errors.New("slack " + method + " failed: " + status.Error)
+	}
+
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// splitChannel separates a channel key into channel id and thread timestamp.
+func splitChannel(channel string) (string, string) {
+	channelID, thread, _ := strings.Cut(channel, ":")
+	return channelID, thread
+}
@@ -0,0 +1,128 @@
+package slack_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/adapters/slack"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+)
+
+const signingSecret = "secret"
+
+// newAPI serves the Slack Web API, passing the payloads of chat.postMessage to posted.
+func newAPI(t *testing.T, posted chan<- map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			var payload map[string]any
+			json.NewDecoder(r.Body).Decode(&payload)
+			posted <- payload
+			fmt.Fprint(w, `{"ok": true, "ts": "1700000000.000200"}`)
+		case "/chat.update":
+			fmt.Fprint(w, `{"ok": false, "error": "message_not_found"}`)
+		case "/files/cat.png":
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	slack.APIURL = server.URL + "/"
+	return server
+}
+
+// event sends a signed event to the adapter and returns the response.
+func event(adapter *slack.Adapter, body string, timestamp time.Time, secret string) *httptest.ResponseRecorder {
+	seconds := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", seconds, body)
+
+	request := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	request.Header.Set("X-Slack-Request-Timestamp", seconds)
+	request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	recorder := httptest.NewRecorder()
+	adapter.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestVerification(t *testing.T) {
+	adapter := slack.New(aicompaniontest.NewFakeCompanion(), "xoxb-token", signingSecret)
+	body := `{"type": "url_verification", "challenge": "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`
+
+	recorder := event(adapter, body, time.Now(), signingSecret)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("expected the challenge, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder := event(adapter, body, time.Now(), "wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for an invalid signature, got %d", recorder.Code)
+	}
+	if recorder := event(adapter, body, time.Now().Add(-10*time.Minute), signingSecret); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for a replayed request, got %d", recorder.Code)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	posted := make(chan map[string]any, 1)
+	newAPI(t, posted)
+	companion := aicompaniontest.NewFakeCompanion("Hi from the bot")
+	adapter := slack.New(companion, "xoxb-token", signingSecret)
+	adapter.Bridge.Streaming = false
+	adapter.Threaded = true
+
+	// bot messages and edits are not answered
+	for _, body := range []string{
+		`{"type": "event_callback", "event": {"type": "message", "bot_id": "B1", "text": "echo", "channel": "C1", "ts": "1.0"}}`,
+		`{"type": "event_callback", "event": {"type": "message", "subtype": "message_changed", "text": "edit", "channel": "C1", "ts": "1.0"}}`,
+	} {
+		if recorder := event(adapter, body, time.Now(), signingSecret); recorder.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", recorder.Code)
+		}
+	}
+
+	body := fmt.Sprintf(`{"type": "event_callback", "event": {"type": "message", "subtype": "file_share", "user": "U1", "text": "What is this?", "channel": "C1", "ts": "1.5", "files": [{"mimetype": "image/png", "url_private": %q}, {"mimetype": "application/pdf", "url_private": "ignored"}]}}`, strings.TrimSuffix(slack.APIURL, "/")+"/files/cat.png")
+	if recorder := event(adapter, body, time.Now(), signingSecret); recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+
+	select {
+	case payload := <-posted:
+		if payload["channel"] != "C1" || payload["thread_ts"] != "1.5" || payload["text"] != "Hi from the bot" {
+			t.Errorf("unexpected message %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be answered")
+	}
+
+	requests := companion.Requests()
+	if len(requests) != 1 || requests[0].Message.Content != "What is this?" || requests[0].Message.Images == nil || len(*requests[0].Message.Images) != 1 {
+		t.Errorf("expected a single request with the image, got %+v", requests)
+	}
+}
+
+func TestPlatformErrors(t *testing.T) {
+	newAPI(t, make(chan map[string]any, 1))
+	adapter := slack.New(aicompaniontest.NewFakeCompanion(), "xoxb-token", signingSecret)
+
+	if err := adapter.Edit(context.Background(), "C1:1.5", "1.6", "text"); err == nil || !strings.Contains(err.Error(), "message_not_found") {
+		t.Errorf("expected the error of the api, got %v", err)
+	}
+	adapter.Token = "invalid"
+	if _, err := adapter.Send(context.Background(), "C1", "text"); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+}
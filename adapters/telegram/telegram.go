@@ -0,0 +1,226 @@
+// Package telegram connects a companion to the Telegram Bot API.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/adapters"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// APIURL is the base url of the Bot API.
+var APIURL = "https://api.telegram.org"
+
+// pollTimeout is the long polling timeout passed to getUpdates.
+const pollTimeout = 30 * time.Second
+
+// Adapter receives Telegram updates and answers them with a companion. Updates are received
+// either by long polling (Run) or through a webhook (ServeHTTP). It implements adapters.Platform.
+type Adapter struct {
+	Token      string
+	Bridge     *adapters.Bridge
+	HttpClient *http.Client
+	// WebhookSecret is compared against the X-Telegram-Bot-Api-Secret-Token header, if set.
+	WebhookSecret string
+}
+
+// New creates a new Telegram adapter for the given companion.
+func New(companion aicompanion.AICompanion, token string) *Adapter {
+	adapter := &Adapter{Token: token, HttpClient: &http.Client{Timeout: pollTimeout + 10*time.Second}}
+	adapter.Bridge = adapters.NewBridge(companion, adapter)
+	return adapter
+}
+
+type update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *message `json:"message"`
+}
+
+type message struct {
+	MessageID int64       `json:"message_id"`
+	From      *user       `json:"from"`
+	Chat      chat        `json:"chat"`
+	Text      string      `json:"text"`
+	Caption   string      `json:"caption"`
+	Photo     []photoSize `json:"photo"`
+}
+
+type user struct {
+	ID       int64  `json:"id"`
+	IsBot    bool   `json:"is_bot"`
+	Username string `json:"username"`
+}
+
+type chat struct {
+	ID int64 `json:"id"`
+}
+
+type photoSize struct {
+	FileID   string `json:"file_id"`
+	FileSize int    `json:"file_size"`
+}
+
+// Run polls for updates until ctx is cancelled. Each chat is answered in order of arrival.
+func (adapter *Adapter) Run(ctx context.Context) error {
+	var offset int64
+	for {
+		var updates []update
+		err := adapter.call(ctx, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         int(pollTimeout.Seconds()),
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			sideKick.Error(err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = max(offset, u.UpdateID+1)
+			adapter.handle(ctx, u)
+		}
+	}
+}
+
+// ServeHTTP receives updates delivered to a webhook registered with setWebhook.
+func (adapter *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if adapter.WebhookSecret != "" {
+		token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adapter.WebhookSecret)) != 1 {
+			http.Error(w, "invalid secret token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var u update
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	go adapter.handle(context.WithoutCancel(r.Context()), u)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handle converts an update into an IncomingMessage and passes it to the bridge.
+func (adapter *Adapter) handle(ctx context.Context, u update) {
+	if u.Message == nil || (u.Message.From != nil && u.Message.From.IsBot) {
+		return
+	}
+
+	incoming := adapters.IncomingMessage{
+		Channel: strconv.FormatInt(u.Message.Chat.ID, 10),
+		Text:    u.Message.Text,
+	}
+	if u.Message.From != nil {
+		incoming.User = u.Message.From.Username
+	}
+
+	// photos are delivered in several sizes, the last one is the largest
+	if len(u.Message.Photo) > 0 {
+		incoming.Text = u.Message.Caption
+		photo := u.Message.Photo[len(u.Message.Photo)-1]
+
+		var file struct {
+			FilePath string `json:"file_path"`
+		}
+		if err := adapter.call(ctx, "getFile", map[string]any{"file_id": photo.FileID}, &file); err != nil {
+			sideKick.Error(err)
+		} else {
+			url := fmt.Sprintf("%s/file/bot%s/%s", APIURL, adapter.Token, file.FilePath)
+			image, err := adapters.DownloadImage(ctx, adapter.HttpClient, url, nil)
+			if err != nil {
+				sideKick.Error(err)
+			} else {
+				incoming.Images = append(incoming.Images, image)
+			}
+		}
+	}
+
+	if err := adapter.Bridge.Handle(ctx, incoming); err != nil {
+		sideKick.Error(err)
+	}
+}
+
+// Send implements adapters.Platform.
+func (adapter *Adapter) Send(ctx context.Context, channel, text string) (string, error) {
+	var sent message
+	if err := adapter.call(ctx, "sendMessage", map[string]any{"chat_id": channel, "text": text}, &sent); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(sent.MessageID, 10), nil
+}
+
+// Edit implements adapters.Platform.
+func (adapter *Adapter) Edit(ctx context.Context, channel, messageID, text string) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return adapter.call(ctx, "editMessageText", map[string]any{"chat_id": channel, "message_id": id, "text": text}, nil)
+}
+
+// call invokes a Bot API method and decodes its result into result.
+func (adapter *Adapter) call(ctx context.Context, method string, payload any, result any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/bot%s/%s", APIURL, adapter.Token, method)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := adapter.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("telegram %s failed with status %d: %w", method, resp.StatusCode, err)
+	}
+	if !response.OK {
+		return errors.New("telegram " + method + " failed: " + response.Description)
+	}
+
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+var _ adapters.Platform = (*Adapter)(nil)
@@ -0,0 +1,144 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/adapters/telegram"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+)
+
+const token = "123:abc"
+
+// newAPI serves the Bot API. The payloads of sendMessage are passed to sent, getUpdates answers with
+// updates once and with no updates afterwards, after passing the requested offset to offsets.
+func newAPI(t *testing.T, sent chan<- map[string]any, updates string, offsets chan<- float64) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		switch r.URL.Path {
+		case "/bot" + token + "/sendMessage":
+			sent <- payload
+			fmt.Fprint(w, `{"ok": true, "result": {"message_id": 42, "chat": {"id": 7}}}`)
+		case "/bot" + token + "/getUpdates":
+			if payload["offset"].(float64) > 0 {
+				select {
+				case offsets <- payload["offset"].(float64):
+				default:
+				}
+				fmt.Fprint(w, `{"ok": true, "result": []}`)
+				return
+			}
+			fmt.Fprintf(w, `{"ok": true, "result": %s}`, updates)
+		case "/bot" + token + "/getFile":
+			fmt.Fprint(w, `{"ok": true, "result": {"file_path": "photos/cat.png"}}`)
+		case "/file/bot" + token + "/photos/cat.png":
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		default:
+			fmt.Fprint(w, `{"ok": false, "description": "Bad Request: method not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	telegram.APIURL = server.URL
+}
+
+// receive waits for a sent message.
+func receive(t *testing.T, sent <-chan map[string]any) map[string]any {
+	t.Helper()
+	select {
+	case payload := <-sent:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a message to be sent")
+		return nil
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	sent := make(chan map[string]any, 1)
+	newAPI(t, sent, "[]", nil)
+	companion := aicompaniontest.NewFakeCompanion("Nice cat")
+	adapter := telegram.New(companion, token)
+	adapter.Bridge.Streaming = false
+	adapter.WebhookSecret = "s3cret"
+
+	update := `{"update_id": 1, "message": {"message_id": 5, "from": {"id": 1, "username": "ada"}, "chat": {"id": 7}, "caption": "Look", "photo": [{"file_id": "small"}, {"file_id": "large"}]}}`
+	request := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(update))
+	recorder := httptest.NewRecorder()
+	adapter.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without secret token, got %d", recorder.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(update))
+	request.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret")
+	recorder = httptest.NewRecorder()
+	adapter.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+
+	if payload := receive(t, sent); payload["chat_id"] != "7" || payload["text"] != "Nice cat" {
+		t.Errorf("unexpected message %v", payload)
+	}
+	answered, _ := companion.LastRequest()
+	if answered.Message.Content != "Look" || answered.Message.Images == nil || len(*answered.Message.Images) != 1 {
+		t.Errorf("expected the caption and the largest photo, got %+v", answered.Message)
+	}
+}
+
+func TestRun(t *testing.T) {
+	sent := make(chan map[string]any, 1)
+	offsets := make(chan float64, 10)
+	newAPI(t, sent, `[
+		{"update_id": 10, "message": {"message_id": 1, "from": {"id": 2, "is_bot": true}, "chat": {"id": 7}, "text": "beep"}},
+		{"update_id": 11, "message": {"message_id": 2, "from": {"id": 1, "username": "ada"}, "chat": {"id": 7}, "text": "Hello"}}
+	]`, offsets)
+	companion := aicompaniontest.NewFakeCompanion("Hi Ada")
+	adapter := telegram.New(companion, token)
+	adapter.Bridge.Streaming = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- adapter.Run(ctx) }()
+
+	if payload := receive(t, sent); payload["text"] != "Hi Ada" {
+		t.Errorf("unexpected message %v", payload)
+	}
+	select {
+	case offset := <-offsets:
+		if offset != 12 {
+			t.Errorf("expected the updates to be confirmed with offset 12, got %v", offset)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the updates to be polled again")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Run to end with the context, got %v", err)
+	}
+	if requests := companion.Requests(); len(requests) != 1 || requests[0].Message.Content != "Hello" {
+		t.Errorf("expected only the message of the user to be answered, got %+v", requests)
+	}
+}
+
+func TestPlatformErrors(t *testing.T) {
+	newAPI(t, nil, "[]", nil)
+	adapter := telegram.New(aicompaniontest.NewFakeCompanion(), token)
+
+	if err := adapter.Edit(context.Background(), "7", "not a number", "text"); err == nil {
+		t.Error("expected an error for an invalid message id")
+	}
+	if err := adapter.Edit(context.Background(), "7", "42", "text"); err == nil || !strings.Contains(err.Error(), "method not found") {
+		t.Errorf("expected the description of the error, got %v", err)
+	}
+}
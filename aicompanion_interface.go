@@ -1,15 +1,24 @@
 package aicompanion
 
 import (
-	"encoding/base64"
+	"context"
+	"io"
 	"net/http"
-	"time"
 
+	"github.com/ghmer/aicompanion/impl/cohere"
+	"github.com/ghmer/aicompanion/impl/groq"
+	"github.com/ghmer/aicompanion/impl/llamacpp"
 	"github.com/ghmer/aicompanion/impl/ollama"
 	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/impl/openrouter"
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/impl/tgi"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
 	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
 	"github.com/ghmer/aicompanion/models"
 	"github.com/ghmer/aicompanion/terminal"
+	"github.com/ghmer/aicompanion/tools"
 )
 
 const (
@@ -17,8 +26,13 @@ const (
 	EnrichmentPrompt    = "Answer the following query with the provided context"
 	SummarizationPrompt = "Summarize the given conversation in 3 to 6 words without using punctuation marks, emojis or formatting. Only return the summary and nothing else."
 
-	DefaultHTTPTimeout = 300
-	DefaultMaxMessages = 20
+	DefaultHTTPTimeout        = 300
+	DefaultMaxMessages        = 20
+	DefaultTranscriptionModel = "whisper-1"
+	DefaultModerationModel    = "llama-guard3"
+
+	DefaultGroqTranscriptionModel = "whisper-large-v3-turbo"
+	DefaultCohereRerankModel      = "rerank-v3.5"
 )
 
 var OllamaEndpoints = models.ApiEndpointUrls{
@@ -30,11 +44,60 @@ var OllamaEndpoints = models.ApiEndpointUrls{
 }
 
 var OpenAIEndpoints = models.ApiEndpointUrls{
-	ApiChatURL:       "https://api.openai.com/v1/chat/completions",
-	ApiGenerateURL:   "https://api.openai.com/v1/completions",
-	ApiEmbedURL:      "https://api.openai.com/v1/embeddings",
-	ApiModerationURL: "https://api.openai.com/v1/moderations",
-	ApiModelsURL:     "https://api.openai.com/v1/models",
+	ApiChatURL:          "https://api.openai.com/v1/chat/completions",
+	ApiGenerateURL:      "https://api.openai.com/v1/completions",
+	ApiEmbedURL:         "https://api.openai.com/v1/embeddings",
+	ApiModerationURL:    "https://api.openai.com/v1/moderations",
+	ApiModelsURL:        "https://api.openai.com/v1/models",
+	ApiTranscriptionURL: "https://api.openai.com/v1/audio/transcriptions",
+}
+
+// GroqEndpoints point at the OpenAI compatible api of Groq, which offers no embedding and moderation endpoints.
+var GroqEndpoints = models.ApiEndpointUrls{
+	ApiChatURL:          "https://api.groq.com/openai/v1/chat/completions",
+	ApiGenerateURL:      "https://api.groq.com/openai/v1/chat/completions",
+	ApiModelsURL:        "https://api.groq.com/openai/v1/models",
+	ApiTranscriptionURL: "https://api.groq.com/openai/v1/audio/transcriptions",
+}
+
+// CohereEndpoints point at the v2 api of Cohere. Generate requests are sent to the chat endpoint.
+var CohereEndpoints = models.ApiEndpointUrls{
+	ApiChatURL:     "https://api.cohere.com/v2/chat",
+	ApiGenerateURL: "https://api.cohere.com/v2/chat",
+	ApiEmbedURL:    "https://api.cohere.com/v2/embed",
+	ApiModelsURL:   "https://api.cohere.com/v1/models",
+	ApiRerankURL:   "https://api.cohere.com/v2/rerank",
+}
+
+// OpenRouterEndpoints point at the OpenAI compatible api of OpenRouter.
+var OpenRouterEndpoints = models.ApiEndpointUrls{
+	ApiChatURL:     "https://openrouter.ai/api/v1/chat/completions",
+	ApiGenerateURL: "https://openrouter.ai/api/v1/chat/completions",
+	ApiModelsURL:   "https://openrouter.ai/api/v1/models",
+}
+
+// TGIEndpoints point at a local HuggingFace Text Generation Inference server. Streaming requests are sent
+// to the matching /generate_stream endpoint.
+var TGIEndpoints = models.ApiEndpointUrls{
+	ApiChatURL:     "http://localhost:8080/generate",
+	ApiGenerateURL: "http://localhost:8080/generate",
+	ApiModelsURL:   "http://localhost:8080/info",
+}
+
+// LlamaCppEndpoints point at a local llama.cpp server. Chat uses the OpenAI compatible endpoint,
+// generate and embedding requests the native ones.
+var LlamaCppEndpoints = models.ApiEndpointUrls{
+	ApiChatURL:     "http://localhost:8080/v1/chat/completions",
+	ApiGenerateURL: "http://localhost:8080/completion",
+	ApiEmbedURL:    "http://localhost:8080/embedding",
+	ApiModelsURL:   "http://localhost:8080/v1/models",
+}
+
+// DeepSeekEndpoints point at the OpenAI compatible api of DeepSeek, which offers no embedding and moderation endpoints.
+var DeepSeekEndpoints = models.ApiEndpointUrls{
+	ApiChatURL:     "https://api.deepseek.com/chat/completions",
+	ApiGenerateURL: "https://api.deepseek.com/chat/completions",
+	ApiModelsURL:   "https://api.deepseek.com/models",
 }
 
 // AICompanion defines the interface for interacting with AI models.
@@ -75,43 +138,93 @@ type AICompanion interface {
 	// SetConversation sets the current conversation
 	SetConversation(conversation []models.Message)
 
+	// PinMessage pins or unpins the message at index, so it survives trimming of the conversation
+	PinMessage(index int, pinned bool) error
+
+	// PinMessageByID pins or unpins the message with the given ID
+	PinMessageByID(id string, pinned bool) error
+
+	// RemoveLastExchange removes the last user message and the messages following it, and returns them
+	RemoveLastExchange() []models.Message
+
+	// TruncateAfter removes the messages following index from the conversation
+	TruncateAfter(index int) error
+
+	// ExportConversation writes the conversation as JSON or Markdown transcript
+	ExportConversation(w io.Writer, format models.ConversationFormat) error
+
+	// ImportConversation replaces the conversation with a JSON or Markdown transcript
+	ImportConversation(r io.Reader) error
+
+	// SetConversationStore sets the store keeping the conversations of the sessions
+	SetConversationStore(store conversationstore.Store)
+
+	// CurrentSession returns the name of the current session
+	CurrentSession() string
+
+	// SwitchSession saves the current conversation and continues the named session
+	SwitchSession(name string) error
+
+	// ListSessions returns the names of all sessions
+	ListSessions() ([]string, error)
+
+	// SearchSessions searches the messages of all sessions, if the conversation store supports search
+	SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error)
+
+	// DeleteSession deletes the named session, clearing the conversation if it is the current one
+	DeleteSession(name string) error
+
+	// GetUsage returns the tokens of all responses reporting their usage, in total, per session and per model,
+	// including streamed responses
+	GetUsage() models.UsageReport
+
 	// GetClient returns the current HTTP client used for requests
 	GetHttpClient() *http.Client
 
 	// SetClient sets a new HTTP client for requests
 	SetHttpClient(client *http.Client)
 
-	/*
-		// SetVectorDB sets the vector database instance.
-		SetVectorDB(vectorDb *vectordb.VectorDb)
+	// SetVectorDB sets the vector database used by SendRAGRequest.
+	SetVectorDB(vectorDb vectordb.VectorDb)
 
-		// GetVectorDb returns the current vector database instance.
-		GetVectorDB() *vectordb.VectorDb
-	*/
+	// GetVectorDB returns the vector database used by SendRAGRequest.
+	GetVectorDB() vectordb.VectorDb
 
-	// interactions
+	// interactions; requests are cancelled with ctx, which also bounds streamed responses
 	// GetModels returns all models that the endpoint supports
-	GetModels() ([]models.Model, error)
+	GetModels(ctx context.Context) ([]models.Model, error)
 
 	// SendChatRequest sends a chat request to an AI model and returns a response message
-	SendChatRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error)
+	SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error)
+
+	// SendRAGRequest retrieves documents matching the message from the vector database, adds them as context
+	// using the enrichment prompt and sends the result as chat request. The conversation keeps the original message.
+	SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error)
 
 	// SendCompletionRequest sends a completion request to an AI model and returns a response message
-	SendGenerateRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error)
+	SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error)
 
 	// SendEmbeddingRequest sends an embedding request to an AI model and returns a response
-	SendEmbeddingRequest(embedding models.EmbeddingRequest) (models.EmbeddingResponse, error)
+	SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error)
 
 	// SendModerationRequest sends a moderation request to an AI model and returns a response
-	SendModerationRequest(moderationRequest models.ModerationRequest) (models.ModerationResponse, error)
+	SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error)
 
 	// HandleStreamResponse handles streaming responses from an HTTP request.
-	HandleStreamResponse(resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error)
+	HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error)
+
+	// SendToolRequest sends a message offering tools to the model and, where supported, runs the tool calls
+	// of the model and sends back their results until the model answers
+	SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error)
+
+	// SetToolRegistry sets the registry of tools implemented by Go functions, which are run before tool endpoints
+	SetToolRegistry(registry *tools.Registry)
 
-	SendToolRequest(message models.MessageRequest) (models.Message, error)
+	// SetOnToolCall sets the hook asked before a tool is run, which may approve the call, modify its arguments or deny it
+	SetOnToolCall(hook models.ToolCallHook)
 
 	// RunFunction runs a function and returns the response
-	RunFunction(tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error)
+	RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error)
 }
 
 // NewCompanion creates a new Companion instance with the provided configuration.
@@ -126,7 +239,7 @@ func NewCompanion(config models.Configuration) AICompanion {
 				Content: config.ActivePersona.Prompt.SystemPrompt,
 			},
 			Conversation: make([]models.Message, 0),
-			HttpClient:   &http.Client{Timeout: time.Second * time.Duration(config.HttpConfig.HTTPClientTimeout)},
+			HttpClient:   sidekick.NewHttpClient(config),
 		}
 	case models.OpenAI:
 		client = &openai.Companion{
@@ -136,7 +249,69 @@ func NewCompanion(config models.Configuration) AICompanion {
 				Content: config.ActivePersona.Prompt.SystemPrompt,
 			},
 			Conversation: make([]models.Message, 0),
-			HttpClient:   &http.Client{Timeout: time.Second * time.Duration(config.HttpConfig.HTTPClientTimeout)},
+			HttpClient:   sidekick.NewHttpClient(config),
+		}
+	case models.Groq:
+		client = &openai.Companion{
+			Config: config,
+			SystemRole: models.Message{
+				Role:    models.System,
+				Content: config.ActivePersona.Prompt.SystemPrompt,
+			},
+			Conversation: make([]models.Message, 0),
+			HttpClient:   sidekick.NewHttpClient(config),
+			Extension:    groq.Extension{},
+		}
+	case models.Cohere:
+		client = &cohere.Companion{
+			Config: config,
+			SystemRole: models.Message{
+				Role:    models.System,
+				Content: config.ActivePersona.Prompt.SystemPrompt,
+			},
+			Conversation: make([]models.Message, 0),
+			HttpClient:   sidekick.NewHttpClient(config),
+		}
+	case models.DeepSeek:
+		client = &openai.Companion{
+			Config: config,
+			SystemRole: models.Message{
+				Role:    models.System,
+				Content: config.ActivePersona.Prompt.SystemPrompt,
+			},
+			Conversation: make([]models.Message, 0),
+			HttpClient:   sidekick.NewHttpClient(config),
+		}
+	case models.OpenRouter:
+		client = &openai.Companion{
+			Config: config,
+			SystemRole: models.Message{
+				Role:    models.System,
+				Content: config.ActivePersona.Prompt.SystemPrompt,
+			},
+			Conversation: make([]models.Message, 0),
+			HttpClient:   sidekick.NewHttpClient(config),
+			Extension:    openrouter.Extension{},
+		}
+	case models.LlamaCpp:
+		client = llamacpp.New(&openai.Companion{
+			Config: config,
+			SystemRole: models.Message{
+				Role:    models.System,
+				Content: config.ActivePersona.Prompt.SystemPrompt,
+			},
+			Conversation: make([]models.Message, 0),
+			HttpClient:   sidekick.NewHttpClient(config),
+		})
+	case models.TGI:
+		client = &tgi.Companion{
+			Config: config,
+			SystemRole: models.Message{
+				Role:    models.System,
+				Content: config.ActivePersona.Prompt.SystemPrompt,
+			},
+			Conversation: make([]models.Message, 0),
+			HttpClient:   sidekick.NewHttpClient(config),
 		}
 	}
 
@@ -179,16 +354,21 @@ func NewDefaultConfig(apiProvider models.ApiProvider, apiToken, chatModel, gener
 	config.ActivePersona = persona
 	config.Personas = []models.Persona{persona}
 
-	var apiEndpoints models.ApiEndpointUrls
 	switch apiProvider {
 	case models.Ollama:
-		apiEndpoints = OllamaEndpoints
+		config.AiModels.ModerationModel = models.Model{Model: DefaultModerationModel, Name: DefaultModerationModel}
 
 	case models.OpenAI:
-		apiEndpoints = OpenAIEndpoints
+		config.AiModels.TranscriptionModel = models.Model{Model: DefaultTranscriptionModel, Name: DefaultTranscriptionModel}
+
+	case models.Groq:
+		config.AiModels.TranscriptionModel = models.Model{Model: DefaultGroqTranscriptionModel, Name: DefaultGroqTranscriptionModel}
+
+	case models.Cohere:
+		config.AiModels.RerankModel = models.Model{Model: DefaultCohereRerankModel, Name: DefaultCohereRerankModel}
 	}
 
-	config.ApiEndpoints = apiEndpoints
+	config.ApiEndpoints = DefaultEndpoints(apiProvider)
 
 	config.RAGQueryOptions = models.VectorDBQueryOptions{
 		Limit:               0,
@@ -198,6 +378,29 @@ func NewDefaultConfig(apiProvider models.ApiProvider, apiToken, chatModel, gener
 	return &config
 }
 
+// DefaultEndpoints returns the endpoints of the api of a provider.
+func DefaultEndpoints(apiProvider models.ApiProvider) models.ApiEndpointUrls {
+	switch apiProvider {
+	case models.Ollama:
+		return OllamaEndpoints
+	case models.OpenAI:
+		return OpenAIEndpoints
+	case models.Groq:
+		return GroqEndpoints
+	case models.Cohere:
+		return CohereEndpoints
+	case models.TGI:
+		return TGIEndpoints
+	case models.OpenRouter:
+		return OpenRouterEndpoints
+	case models.LlamaCpp:
+		return LlamaCppEndpoints
+	case models.DeepSeek:
+		return DeepSeekEndpoints
+	}
+	return models.ApiEndpointUrls{}
+}
+
 // ReadImageFromFile reads an image from the specified filepath and returns a Base64 encoded image.
 func ReadImageFromFile(filepath string) (models.Base64Image, error) {
 	sidekick := sidekick_interface.NewSideKick()
@@ -206,7 +409,8 @@ func ReadImageFromFile(filepath string) (models.Base64Image, error) {
 		return models.Base64Image{}, err
 	}
 
-	return models.Base64Image{
-		Data: base64.StdEncoding.EncodeToString(content),
-	}, nil
+	var image models.Base64Image
+	image.SetData(content)
+
+	return image, nil
 }
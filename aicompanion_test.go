@@ -12,10 +12,12 @@ import (
 	"testing"
 
 	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
 	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
 	"github.com/ghmer/aicompanion/interfaces/vectordb"
 	"github.com/ghmer/aicompanion/models"
 	"github.com/ghmer/aicompanion/terminal"
+	"github.com/ghmer/aicompanion/tools"
 )
 
 const (
@@ -30,7 +32,8 @@ type MockAICompanion struct {
 	SystemRole   models.Message
 	Conversation []models.Message
 	HttpClient   *http.Client
-	VectorDb     *vectordb.VectorDb
+	VectorDb     vectordb.VectorDb
+	Sessions     conversationstore.Sessions // Named conversations, see SwitchSession
 }
 
 // GetConfig returns the current configuration of the companion.
@@ -78,12 +81,12 @@ func (companion *MockAICompanion) CreateAssistantMessage(input string) models.Me
 }
 
 // SetVectorDBClient sets a new vector database client for the companion.
-func (companion *MockAICompanion) SetVectorDB(vectorDb *vectordb.VectorDb) {
+func (companion *MockAICompanion) SetVectorDB(vectorDb vectordb.VectorDb) {
 	companion.VectorDb = vectorDb
 }
 
 // GetVectorDBClient returns the current vector database client of the companion.
-func (companion *MockAICompanion) GetVectorDB() *vectordb.VectorDb {
+func (companion *MockAICompanion) GetVectorDB() vectordb.VectorDb {
 	return companion.VectorDb
 }
 
@@ -113,6 +116,102 @@ func (companion *MockAICompanion) SetConversation(conversation []models.Message)
 	companion.Conversation = conversation
 }
 
+// PinMessage pins or unpins the message of the conversation at index. Pinned messages are always sent
+// along with requests, regardless of Config.MaxMessages and Config.MaxContextTokens.
+func (companion *MockAICompanion) PinMessage(index int, pinned bool) error {
+	return sidekick_interface.NewSideKick().PinMessage(companion.Conversation, index, pinned)
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (companion *MockAICompanion) PinMessageByID(id string, pinned bool) error {
+	return sidekick_interface.NewSideKick().PinMessageByID(companion.Conversation, id, pinned)
+}
+
+// RemoveLastExchange removes the last user message and all messages following it, such as the reply and
+// tool results, and returns them. It rolls back a turn that was aborted or failed, e.g. by a stream that
+// errored mid-way. A conversation without user messages is left unchanged.
+func (companion *MockAICompanion) RemoveLastExchange() []models.Message {
+	var removed []models.Message
+	companion.Conversation, removed = sidekick_interface.NewSideKick().RemoveLastExchange(companion.Conversation)
+	return removed
+}
+
+// TruncateAfter removes the messages following index from the conversation. An index of -1 removes all
+// messages.
+func (companion *MockAICompanion) TruncateAfter(index int) error {
+	conversation, err := sidekick_interface.NewSideKick().TruncateAfter(companion.Conversation, index)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ExportConversation writes the conversation as transcript in the given format. Images of Markdown
+// transcripts are written to Config.ImageDir. The transcript is encrypted if Config.EncryptionKey is set.
+func (companion *MockAICompanion) ExportConversation(w io.Writer, format models.ConversationFormat) error {
+	return sidekick_interface.NewSideKick().ExportConversation(w, companion.Conversation, format, companion.Config.ImageDir, companion.Config.EncryptionKey)
+}
+
+// ImportConversation replaces the conversation with a JSON or Markdown transcript, which is decrypted
+// with Config.EncryptionKey if it is encrypted.
+func (companion *MockAICompanion) ImportConversation(r io.Reader) error {
+	conversation, err := sidekick_interface.NewSideKick().ImportConversation(r, companion.Config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// SetConversationStore sets the store keeping the conversations of the sessions that are not current.
+func (companion *MockAICompanion) SetConversationStore(store conversationstore.Store) {
+	companion.Sessions.Store = store
+}
+
+// CurrentSession returns the name of the current session.
+func (companion *MockAICompanion) CurrentSession() string {
+	return companion.Sessions.Current()
+}
+
+// SwitchSession saves the conversation under the current session and continues the named session.
+func (companion *MockAICompanion) SwitchSession(name string) error {
+	conversation, err := companion.Sessions.Switch(name, companion.Conversation)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ListSessions returns the names of all sessions.
+func (companion *MockAICompanion) ListSessions() ([]string, error) {
+	return companion.Sessions.List()
+}
+
+// SearchSessions saves the conversation under the current session and searches the messages of all
+// sessions. The conversation store has to implement conversationstore.Searcher.
+func (companion *MockAICompanion) SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error) {
+	return companion.Sessions.Search(companion.Conversation, query, limit)
+}
+
+// DeleteSession deletes the named session. Deleting the current session clears the conversation.
+func (companion *MockAICompanion) DeleteSession(name string) error {
+	current, err := companion.Sessions.Delete(name)
+	if err != nil {
+		return err
+	}
+	if current {
+		companion.Conversation = make([]models.Message, 0)
+	}
+	return nil
+}
+
+// GetUsage returns no usage, the mock sends no requests.
+func (companion *MockAICompanion) GetUsage() models.UsageReport {
+	return models.UsageReport{}
+}
+
 // GetClient returns the current HTTP client of the companion.
 func (companion *MockAICompanion) GetHttpClient() *http.Client {
 	return companion.HttpClient
@@ -220,12 +319,12 @@ func (companion *MockAICompanion) PrintError(err error) {
 }
 
 // SendModerationRequest sends a request to the OpenAI API to moderate a given text input.
-func (companion *MockAICompanion) SendModerationRequest(moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+func (companion *MockAICompanion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
 	return models.ModerationResponse{}, errors.New("unsupported")
 }
 
 // SendEmbeddingRequest sends an embedding request to the server using the provided embedding request object.
-func (companion *MockAICompanion) SendEmbeddingRequest(embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+func (companion *MockAICompanion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
 	embeddingResponse := models.EmbeddingResponse{
 		Model:            EmbeddingModel,
 		Embeddings:       [][]float32{},
@@ -235,7 +334,7 @@ func (companion *MockAICompanion) SendEmbeddingRequest(embedding models.Embeddin
 	return embeddingResponse, nil
 }
 
-func (mac *MockAICompanion) SendChatRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+func (mac *MockAICompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
 	var response models.Message = models.Message{
 		Role: models.Assistant, Content: "Hello! I am pleased to meet you",
 	}
@@ -249,7 +348,7 @@ func (mac *MockAICompanion) SendChatRequest(message models.MessageRequest, strea
 }
 
 // ProcessUserInput processes the user input by sending it to the API and handling the response.
-func (companion *MockAICompanion) SendGenerateRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+func (companion *MockAICompanion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
 	var response models.Message = models.Message{
 		Role: models.Assistant, Content: "Hello! This is a generated message",
 	}
@@ -263,7 +362,7 @@ func (companion *MockAICompanion) SendGenerateRequest(message models.MessageRequ
 }
 
 // HandleStreamResponse handles the streaming response from the Ollama API.
-func (companion *MockAICompanion) HandleStreamResponse(resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+func (companion *MockAICompanion) HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
 	var result models.Message = models.Message{
 		Role:    models.Assistant,
 		Content: "Hello! I'm an AI assistant. How can I help you today?",
@@ -272,7 +371,11 @@ func (companion *MockAICompanion) HandleStreamResponse(resp *http.Response, stre
 	return result, nil
 }
 
-func (companion *MockAICompanion) SendToolRequest(message models.MessageRequest) (models.Message, error) {
+func (companion *MockAICompanion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	return companion.SendChatRequest(context.Background(), models.MessageRequest{Message: message}, streaming, callback)
+}
+
+func (companion *MockAICompanion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
 	return models.Message{}, errors.ErrUnsupported
 }
 
@@ -285,7 +388,7 @@ func (companion *MockAICompanion) CreateModerationRequest(input string) *models.
 }
 
 // GetModels returns a list of available models from the API.
-func (companion *MockAICompanion) GetModels() ([]models.Model, error) {
+func (companion *MockAICompanion) GetModels(ctx context.Context) ([]models.Model, error) {
 	var result []models.Model = []models.Model{
 		{Model: ChatModel, Name: ChatModel},
 		{Model: GenerateModel, Name: GenerateModel},
@@ -296,8 +399,16 @@ func (companion *MockAICompanion) GetModels() ([]models.Model, error) {
 	return result, nil
 }
 
+// SetOnToolCall is not supported by the mock.
+func (companion *MockAICompanion) SetOnToolCall(hook models.ToolCallHook) {
+}
+
+// SetToolRegistry is not supported by the mock.
+func (companion *MockAICompanion) SetToolRegistry(registry *tools.Registry) {
+}
+
 // RunFunction executes a function with the provided payload.
-func (companion *MockAICompanion) RunFunction(tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+func (companion *MockAICompanion) RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
 	result := models.FunctionResponse{}
 
 	payloadBytes, err := json.Marshal(payload.Arguments)
@@ -425,7 +536,7 @@ func TestAICompanion(t *testing.T) {
 			Endpoint: mockServer.URL,
 			ApiKey:   "12345",
 		}
-		response, err := companion.RunFunction(function, payloadObj)
+		response, err := companion.RunFunction(context.Background(), function, payloadObj)
 		if err != nil {
 			t.Errorf("UnMarshalFunctionPayload failed, got %v", err)
 		}
@@ -517,7 +628,7 @@ func TestAICompanion(t *testing.T) {
 	})
 
 	t.Run("Test RunFunctions", func(t *testing.T) {
-		_, err := companion.RunFunction(models.Tool{}, models.FunctionPayload{})
+		_, err := companion.RunFunction(context.Background(), models.Tool{}, models.FunctionPayload{})
 		if err.Error() != "not implemented" {
 			t.Errorf("RunFunction failed, expected error %v, got %v", "not implemented", err)
 		}
@@ -525,7 +636,7 @@ func TestAICompanion(t *testing.T) {
 
 	t.Run("Test SendChatRequest Standard", func(t *testing.T) {
 		request := models.MessageRequest{}
-		response, err := companion.SendChatRequest(request, false, nil)
+		response, err := companion.SendChatRequest(context.Background(), request, false, nil)
 		if err != nil || response.Content != "Hello! I am pleased to meet you" {
 			t.Errorf("SendChatRequest failed, expected content 'Hello! I am pleased to meet you', got content %v, error: %v", response.Content, err)
 		}
@@ -533,7 +644,7 @@ func TestAICompanion(t *testing.T) {
 
 	t.Run("Test SendGenerateRequest Standard", func(t *testing.T) {
 		request := models.MessageRequest{}
-		response, err := companion.SendGenerateRequest(request, false, nil)
+		response, err := companion.SendGenerateRequest(context.Background(), request, false, nil)
 		if err != nil || response.Content != "Hello! This is a generated message" {
 			t.Errorf("SendChatRequest failed, expected content 'Hello! This is a generated message', got content %v, error: %v", response.Content, err)
 		}
@@ -0,0 +1,163 @@
+package aicompaniontest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestFakeCompanion(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("Hello there, general.", "Second answer")
+
+	var chunks []string
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "hi"}}
+	result, err := companion.SendChatRequest(context.Background(), request, true, func(m models.Message) error {
+		chunks = append(chunks, m.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+
+	if strings.Join(chunks, "") != result.Content || len(chunks) != 3 {
+		t.Errorf("unexpected chunks %q for %q", chunks, result.Content)
+	}
+	if len(companion.GetConversation()) != 2 {
+		t.Errorf("expected 2 conversation messages, got %d", len(companion.GetConversation()))
+	}
+
+	for _, expected := range []string{"Second answer", "Second answer"} {
+		result, err := companion.SendGenerateRequest(context.Background(), request, false, nil)
+		if err != nil || result.Content != expected {
+			t.Errorf("expected %q, got %q (%v)", expected, result.Content, err)
+		}
+	}
+
+	if len(companion.Requests()) != 3 {
+		t.Errorf("expected 3 recorded requests, got %d", len(companion.Requests()))
+	}
+}
+
+func TestEmulator(t *testing.T) {
+	emulators := map[string]func(responses ...string) *aicompaniontest.Emulator{
+		"openai": aicompaniontest.NewOpenAIEmulator,
+		"ollama": aicompaniontest.NewOllamaEmulator,
+	}
+
+	for name, newEmulator := range emulators {
+		t.Run(name, func(t *testing.T) {
+			emulator := newEmulator("streamed answer text")
+			defer emulator.Close()
+
+			companion := emulator.Companion()
+			var streamed strings.Builder
+			request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "hi"}}
+			result, err := companion.SendChatRequest(context.Background(), request, true, func(m models.Message) error {
+				streamed.WriteString(m.Content)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("chat request failed: %v", err)
+			}
+			if result.Content != "streamed answer text" || streamed.String() != result.Content {
+				t.Errorf("unexpected answer %q, streamed %q", result.Content, streamed.String())
+			}
+
+			embeddings, err := companion.SendEmbeddingRequest(context.Background(), models.EmbeddingRequest{Model: "fake-embed", Input: []string{"a", "b"}})
+			if err != nil {
+				t.Fatalf("embedding request failed: %v", err)
+			}
+			if len(embeddings.Embeddings) != 2 || len(embeddings.Embeddings[0]) != aicompaniontest.DefaultDimensions {
+				t.Errorf("unexpected embeddings %v", embeddings.Embeddings)
+			}
+
+			if len(emulator.Requests()) != 2 {
+				t.Errorf("expected 2 recorded requests, got %d", len(emulator.Requests()))
+			}
+		})
+	}
+}
+
+func TestFakeVectorDb(t *testing.T) {
+	ctx := context.Background()
+	db := aicompaniontest.NewFakeVectorDb()
+
+	texts := map[string]string{"1": "the cat sat on the mat", "2": "stock markets fell today", "3": "a cat chased a mouse"}
+	for id, text := range texts {
+		document := models.Document{Embeddings: aicompaniontest.Embed(text, 64), Metadata: map[string]any{"text": text}}
+		if err := db.AddDocument(ctx, "docs", id, document); err != nil {
+			t.Fatalf("failed to add document: %v", err)
+		}
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", aicompaniontest.Embed("cat", 64), models.VectorDBQueryOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if !strings.Contains(result.Metadata["text"].(string), "cat") {
+			t.Errorf("unexpected result %v", result.Metadata["text"])
+		}
+	}
+}
+
+func TestSendRAGRequest(t *testing.T) {
+	ctx := context.Background()
+	db := aicompaniontest.NewFakeVectorDb()
+	for id, text := range map[string]string{"1": "the cat sat on the mat", "2": "stock markets fell today"} {
+		document := models.Document{Embeddings: aicompaniontest.Embed(text, aicompaniontest.DefaultDimensions), Content: text}
+		if err := db.AddDocument(ctx, "docs", id, document); err != nil {
+			t.Fatalf("failed to add document: %v", err)
+		}
+	}
+
+	companion := aicompaniontest.NewFakeCompanion("The cat sat on the mat.")
+	question := models.Message{Role: models.User, Content: "where did the cat sit"}
+	if _, err := companion.SendRAGRequest(context.Background(), question, models.RAGOptions{ClassName: "docs"}, false, nil); err == nil {
+		t.Fatal("expected an error without vector database")
+	}
+
+	companion.SetVectorDB(db)
+	limit := models.VectorDBQueryOptions{Limit: 1}
+	if _, err := companion.SendRAGRequest(context.Background(), question, models.RAGOptions{ClassName: "docs", QueryOptions: &limit}, false, nil); err != nil {
+		t.Fatalf("rag request failed: %v", err)
+	}
+
+	request, _ := companion.LastRequest()
+	content := request.Message.Content
+	if !strings.HasPrefix(content, companion.GetEnrichmentPrompt()) || !strings.Contains(content, "the cat sat on the mat") ||
+		strings.Contains(content, "stock markets") || !strings.HasSuffix(content, question.Content) {
+		t.Errorf("unexpected enriched message %q", content)
+	}
+	if conversation := companion.GetConversation(); len(conversation) != 2 || conversation[0].Content != question.Content {
+		t.Errorf("expected the original message in the conversation, got %+v", conversation)
+	}
+}
+
+func TestSendRAGRequestKeywordFallback(t *testing.T) {
+	ctx := context.Background()
+	db := aicompaniontest.NewFakeVectorDb()
+	for id, text := range map[string]string{"1": "a cat sat on a mat", "2": "stock markets fell today"} {
+		if err := db.AddDocument(ctx, "docs", id, models.Document{Content: text}); err != nil {
+			t.Fatalf("failed to add document: %v", err)
+		}
+	}
+
+	companion := aicompaniontest.NewFakeCompanion()
+	companion.SetVectorDB(db)
+	question := models.Message{Role: models.User, Content: "how did the stock markets do"}
+	if _, err := companion.SendRAGRequest(context.Background(), question, models.RAGOptions{ClassName: "docs"}, false, nil); err != nil {
+		t.Fatalf("rag request failed: %v", err)
+	}
+
+	request, _ := companion.LastRequest()
+	if !strings.Contains(request.Message.Content, "stock markets fell today") || strings.Contains(request.Message.Content, "cat") {
+		t.Errorf("expected the keyword match as context, got %q", request.Message.Content)
+	}
+}
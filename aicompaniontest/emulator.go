@@ -0,0 +1,318 @@
+package aicompaniontest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// RecordedRequest is a request received by an Emulator.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Emulator is an httptest server speaking the OpenAI or Ollama wire format. It lets tests exercise the
+// real companion implementations, including streaming, without network access.
+type Emulator struct {
+	Script
+
+	Provider   models.ApiProvider
+	Server     *httptest.Server
+	Models     []string
+	Chunk      func(text string) []string
+	Dimensions int
+	// Status, if set, is returned instead of an answer, e.g. to test error handling.
+	Status int
+	// Verdict is answered to requests for guard models, defaults to "safe".
+	Verdict string
+
+	requestMutex sync.Mutex
+	requests     []RecordedRequest
+}
+
+// NewOpenAIEmulator starts an emulator for the OpenAI api. Close it when done.
+func NewOpenAIEmulator(responses ...string) *Emulator {
+	return newEmulator(models.OpenAI, responses)
+}
+
+// NewOllamaEmulator starts an emulator for the Ollama api. Close it when done.
+func NewOllamaEmulator(responses ...string) *Emulator {
+	return newEmulator(models.Ollama, responses)
+}
+
+// newEmulator starts an emulator for the given provider.
+func newEmulator(provider models.ApiProvider, responses []string) *Emulator {
+	emulator := &Emulator{
+		Script:   Script{Responses: responses},
+		Provider: provider,
+		Models:   []string{"fake-chat", "fake-embed"},
+	}
+
+	mux := http.NewServeMux()
+	if provider == models.OpenAI {
+		mux.HandleFunc("POST /v1/chat/completions", emulator.openAIChat)
+		mux.HandleFunc("POST /v1/embeddings", emulator.openAIEmbeddings)
+		mux.HandleFunc("POST /v1/moderations", emulator.openAIModerations)
+		mux.HandleFunc("GET /v1/models", emulator.openAIModels)
+	} else {
+		mux.HandleFunc("POST /api/chat", emulator.ollamaCompletion(models.Chat))
+		mux.HandleFunc("POST /api/generate", emulator.ollamaCompletion(models.Generate))
+		mux.HandleFunc("POST /api/embed", emulator.ollamaEmbed)
+		mux.HandleFunc("GET /api/tags", emulator.ollamaTags)
+	}
+
+	emulator.Server = httptest.NewServer(emulator.record(mux))
+	return emulator
+}
+
+// Close shuts the server down.
+func (emulator *Emulator) Close() {
+	emulator.Server.Close()
+}
+
+// Endpoints returns the endpoint urls of the emulator.
+func (emulator *Emulator) Endpoints() models.ApiEndpointUrls {
+	url := emulator.Server.URL
+	if emulator.Provider == models.OpenAI {
+		return models.ApiEndpointUrls{
+			ApiChatURL:       url + "/v1/chat/completions",
+			ApiGenerateURL:   url + "/v1/chat/completions",
+			ApiEmbedURL:      url + "/v1/embeddings",
+			ApiModerationURL: url + "/v1/moderations",
+			ApiModelsURL:     url + "/v1/models",
+		}
+	}
+	return models.ApiEndpointUrls{
+		ApiChatURL:       url + "/api/chat",
+		ApiGenerateURL:   url + "/api/generate",
+		ApiEmbedURL:      url + "/api/embed",
+		ApiModerationURL: url + "/api/generate",
+		ApiModelsURL:     url + "/api/tags",
+	}
+}
+
+// Config returns a default configuration pointing at the emulator.
+func (emulator *Emulator) Config() models.Configuration {
+	config := aicompanion.NewDefaultConfig(emulator.Provider, "test-key", "fake-chat", "fake-chat", "fake-embed")
+	config.ApiEndpoints = emulator.Endpoints()
+	return *config
+}
+
+// Companion returns a real companion implementation configured for the emulator.
+func (emulator *Emulator) Companion() aicompanion.AICompanion {
+	companion := aicompanion.NewCompanion(emulator.Config())
+	companion.SetHttpClient(emulator.Server.Client())
+	return companion
+}
+
+// Requests returns the requests received so far.
+func (emulator *Emulator) Requests() []RecordedRequest {
+	emulator.requestMutex.Lock()
+	defer emulator.requestMutex.Unlock()
+	return append([]RecordedRequest(nil), emulator.requests...)
+}
+
+// record stores every request before passing it on.
+func (emulator *Emulator) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+
+		emulator.requestMutex.Lock()
+		emulator.requests = append(emulator.requests, RecordedRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		emulator.requestMutex.Unlock()
+
+		if emulator.Status != 0 {
+			http.Error(w, http.StatusText(emulator.Status), emulator.Status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chatPayload is the subset of the chat and generate payloads the emulator reads.
+type chatPayload struct {
+	Model    string           `json:"model"`
+	Messages []models.Message `json:"messages"`
+	Prompt   string           `json:"prompt"`
+	Stream   bool             `json:"stream"`
+}
+
+// lastMessage returns the message the emulator answers.
+func (payload chatPayload) lastMessage() models.Message {
+	if len(payload.Messages) > 0 {
+		return payload.Messages[len(payload.Messages)-1]
+	}
+	return models.Message{Role: models.User, Content: payload.Prompt}
+}
+
+// chunks splits an answer for streaming.
+func (emulator *Emulator) chunks(text string) []string {
+	if emulator.Chunk != nil {
+		return emulator.Chunk(text)
+	}
+	return SplitWords(text)
+}
+
+// embeddings computes the embeddings for the given inputs.
+func (emulator *Emulator) embeddings(inputs []string) [][]float32 {
+	dimensions := emulator.Dimensions
+	if dimensions <= 0 {
+		dimensions = DefaultDimensions
+	}
+
+	embeddings := make([][]float32, 0, len(inputs))
+	for _, input := range inputs {
+		embeddings = append(embeddings, Embed(input, dimensions))
+	}
+	return embeddings
+}
+
+// openAIChat answers chat completions.
+func (emulator *Emulator) openAIChat(w http.ResponseWriter, r *http.Request) {
+	var payload chatPayload
+	if !decode(w, r, &payload) {
+		return
+	}
+
+	text, err := emulator.Next(payload.lastMessage())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if payload.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, OpenAIStream(payload.Model, emulator.chunks(text)))
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   payload.Model,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]string{"role": string(models.Assistant), "content": text},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+// openAIEmbeddings answers embedding requests.
+func (emulator *Emulator) openAIEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var payload models.EmbeddingRequest
+	if !decode(w, r, &payload) {
+		return
+	}
+
+	data := make([]any, 0, len(payload.Input))
+	for i, embedding := range emulator.embeddings(payload.Input) {
+		data = append(data, map[string]any{"object": "embedding", "embedding": embedding, "index": i})
+	}
+	writeJSON(w, map[string]any{"object": "list", "data": data, "model": payload.Model})
+}
+
+// openAIModerations answers moderation requests without flagging anything.
+func (emulator *Emulator) openAIModerations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"id":      "modr-fake",
+		"model":   "fake-moderation",
+		"results": []any{map[string]any{"flagged": false, "categories": map[string]bool{}, "category_scores": map[string]float64{}}},
+	})
+}
+
+// openAIModels lists the configured models.
+func (emulator *Emulator) openAIModels(w http.ResponseWriter, r *http.Request) {
+	data := make([]any, 0, len(emulator.Models))
+	for _, model := range emulator.Models {
+		data = append(data, map[string]any{"id": model, "object": "model", "owned_by": "aicompaniontest"})
+	}
+	writeJSON(w, map[string]any{"object": "list", "data": data})
+}
+
+// ollamaCompletion answers chat and generate requests.
+func (emulator *Emulator) ollamaCompletion(streamType models.StreamType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload chatPayload
+		if !decode(w, r, &payload) {
+			return
+		}
+
+		var text string
+		var err error
+		if strings.Contains(payload.Model, "guard") {
+			text = emulator.Verdict
+			if text == "" {
+				text = "safe"
+			}
+		} else if text, err = emulator.Next(payload.lastMessage()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		chunks := []string{text}
+		if payload.Stream {
+			chunks = emulator.chunks(text)
+		}
+
+		stream := ollamaStream(payload.Model, chunks, streamType)
+		if payload.Stream {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			io.WriteString(w, stream)
+			return
+		}
+
+		// non streaming answers consist of a single, completed object
+		lines := strings.Split(strings.TrimSpace(stream), "\n")
+		var object map[string]any
+		json.Unmarshal([]byte(lines[0]), &object)
+		object["done"] = true
+		object["done_reason"] = "stop"
+		writeJSON(w, object)
+	}
+}
+
+// ollamaEmbed answers embedding requests.
+func (emulator *Emulator) ollamaEmbed(w http.ResponseWriter, r *http.Request) {
+	var payload models.EmbeddingRequest
+	if !decode(w, r, &payload) {
+		return
+	}
+	writeJSON(w, map[string]any{"model": payload.Model, "embeddings": emulator.embeddings(payload.Input)})
+}
+
+// ollamaTags lists the configured models.
+func (emulator *Emulator) ollamaTags(w http.ResponseWriter, r *http.Request) {
+	list := make([]models.Model, 0, len(emulator.Models))
+	for _, model := range emulator.Models {
+		list = append(list, models.Model{Model: model, Name: model})
+	}
+	writeJSON(w, map[string]any{"models": list})
+}
+
+// decode reads a JSON request body and answers with 400 if it is invalid.
+func decode(w http.ResponseWriter, r *http.Request, target any) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,560 @@
+// Package aicompaniontest provides test doubles for code built on aicompanion: a configurable fake
+// companion, canned streaming fixtures, an httptest based OpenAI/Ollama emulator and a fake VectorDb.
+package aicompaniontest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// DefaultDimensions is the size of the vectors produced by Embed.
+const DefaultDimensions = 64
+
+// DefaultResponse is answered when no responses are configured.
+const DefaultResponse = "ok"
+
+// Script yields canned answers. Respond takes precedence over Responses; Responses are answered
+// in order, and the last one is repeated once the list is exhausted.
+type Script struct {
+	Responses []string
+	Respond   func(message models.Message) (string, error)
+
+	mutex sync.Mutex
+	index int
+}
+
+// Next returns the answer to the given message.
+func (script *Script) Next(message models.Message) (string, error) {
+	if script.Respond != nil {
+		return script.Respond(message)
+	}
+
+	script.mutex.Lock()
+	defer script.mutex.Unlock()
+
+	if len(script.Responses) == 0 {
+		return DefaultResponse, nil
+	}
+
+	response := script.Responses[min(script.index, len(script.Responses)-1)]
+	script.index++
+	return response, nil
+}
+
+// FakeCompanion is an in-memory implementation of aicompanion.AICompanion. Answers come from
+// the embedded Script and are streamed in chunks produced by Chunk, which defaults to SplitWords.
+// All requests are recorded.
+type FakeCompanion struct {
+	Script
+
+	Config       models.Configuration
+	SystemRole   models.Message
+	Conversation []models.Message
+	HttpClient   *http.Client
+	VectorDb     vectordb.VectorDb
+	Sessions     conversationstore.Sessions // Named conversations, see SwitchSession
+	ToolRegistry *tools.Registry            // Tools run by RunFunction before Functions
+	OnToolCall   models.ToolCallHook        // Asked by RunFunction before a tool is run, if set
+	Usage        sidekick.UsageCounter      // Estimated tokens of the answers, see GetUsage
+
+	Models     []models.Model
+	Chunk      func(text string) []string
+	Dimensions int // size of the embeddings, defaults to DefaultDimensions
+	// Flagged marks moderation inputs as flagged in the harassment category; nil flags nothing.
+	Flagged func(input string) bool
+	// Functions handles RunFunction calls; nil returns an error response.
+	Functions func(tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error)
+	// Err is returned by every request while set.
+	Err error
+
+	requestMutex sync.Mutex
+	requests     []models.MessageRequest
+}
+
+// NewFakeCompanion creates a new FakeCompanion answering with the given responses.
+func NewFakeCompanion(responses ...string) *FakeCompanion {
+	config := aicompanion.NewDefaultConfig(models.Ollama, "", "fake-chat", "fake-chat", "fake-embed")
+	return &FakeCompanion{
+		Script:     Script{Responses: responses},
+		Config:     *config,
+		SystemRole: sideKick.CreateMessage(models.System, config.ActivePersona.Prompt.SystemPrompt),
+		HttpClient: http.DefaultClient,
+	}
+}
+
+// Requests returns the chat, generate and tool requests received so far.
+func (companion *FakeCompanion) Requests() []models.MessageRequest {
+	companion.requestMutex.Lock()
+	defer companion.requestMutex.Unlock()
+	return append([]models.MessageRequest(nil), companion.requests...)
+}
+
+// LastRequest returns the most recent request, or false if none was received.
+func (companion *FakeCompanion) LastRequest() (models.MessageRequest, bool) {
+	companion.requestMutex.Lock()
+	defer companion.requestMutex.Unlock()
+	if len(companion.requests) == 0 {
+		return models.MessageRequest{}, false
+	}
+	return companion.requests[len(companion.requests)-1], true
+}
+
+// record stores a request.
+func (companion *FakeCompanion) record(message models.MessageRequest) {
+	companion.requestMutex.Lock()
+	defer companion.requestMutex.Unlock()
+	companion.requests = append(companion.requests, message)
+}
+
+// PrepareConversation returns the system role, the conversation and the message.
+func (companion *FakeCompanion) PrepareConversation(message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	history := sideKick.SelectContext(companion.Config.ContextStrategy, sidekick.ContextRequest{
+		Conversation:    companion.Conversation,
+		IncludeStrategy: includeStrategy,
+		MaxMessages:     companion.Config.MaxMessages,
+		MaxTokens:       companion.Config.MaxContextTokens,
+		Reserved:        []models.Message{companion.SystemRole, message},
+		Summarize:       sideKick.NewSummarizer(companion.SendGenerateRequest),
+	})
+
+	messages := append([]models.Message{companion.SystemRole}, history...)
+	return append(messages, message)
+}
+
+// AddMessage adds a new message to the conversation.
+func (companion *FakeCompanion) AddMessage(message models.Message) {
+	companion.Conversation = append(companion.Conversation, sideKick.StampMessage(message))
+}
+
+// GetConfig returns the current configuration.
+func (companion *FakeCompanion) GetConfig() models.Configuration {
+	return companion.Config
+}
+
+// SetConfig sets a new configuration.
+func (companion *FakeCompanion) SetConfig(config models.Configuration) {
+	companion.Config = config
+	companion.SetSystemRole(config.ActivePersona.Prompt.SystemPrompt)
+}
+
+// GetSystemRole returns the current system role message.
+func (companion *FakeCompanion) GetSystemRole() models.Message {
+	return companion.SystemRole
+}
+
+// SetSystemRole sets a new system role message.
+func (companion *FakeCompanion) SetSystemRole(prompt string) {
+	companion.SystemRole = sideKick.CreateMessage(models.System, prompt)
+}
+
+// GetEnrichmentPrompt returns the current enrichment prompt.
+func (companion *FakeCompanion) GetEnrichmentPrompt() string {
+	return companion.Config.ActivePersona.Prompt.EnrichmentPrompt
+}
+
+// SetEnrichmentPrompt sets a new enrichment prompt.
+func (companion *FakeCompanion) SetEnrichmentPrompt(prompt string) {
+	companion.Config.ActivePersona.Prompt.EnrichmentPrompt = prompt
+}
+
+// GetSummarizationPrompt returns the current summarization prompt.
+func (companion *FakeCompanion) GetSummarizationPrompt() string {
+	return companion.Config.ActivePersona.Prompt.SummarizationPrompt
+}
+
+// SetSummarizationPrompt sets a new summarization prompt.
+func (companion *FakeCompanion) SetSummarizationPrompt(prompt string) {
+	companion.Config.ActivePersona.Prompt.SummarizationPrompt = prompt
+}
+
+// GetConversation returns the current conversation.
+func (companion *FakeCompanion) GetConversation() []models.Message {
+	return companion.Conversation
+}
+
+// SetConversation sets the current conversation.
+func (companion *FakeCompanion) SetConversation(conversation []models.Message) {
+	companion.Conversation = conversation
+}
+
+// PinMessage pins or unpins the message of the conversation at index. Pinned messages are always sent
+// along with requests, regardless of Config.MaxMessages and Config.MaxContextTokens.
+func (companion *FakeCompanion) PinMessage(index int, pinned bool) error {
+	return sideKick.PinMessage(companion.Conversation, index, pinned)
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (companion *FakeCompanion) PinMessageByID(id string, pinned bool) error {
+	return sideKick.PinMessageByID(companion.Conversation, id, pinned)
+}
+
+// RemoveLastExchange removes the last user message and all messages following it, such as the reply and
+// tool results, and returns them. It rolls back a turn that was aborted or failed, e.g. by a stream that
+// errored mid-way. A conversation without user messages is left unchanged.
+func (companion *FakeCompanion) RemoveLastExchange() []models.Message {
+	var removed []models.Message
+	companion.Conversation, removed = sideKick.RemoveLastExchange(companion.Conversation)
+	return removed
+}
+
+// TruncateAfter removes the messages following index from the conversation. An index of -1 removes all
+// messages.
+func (companion *FakeCompanion) TruncateAfter(index int) error {
+	conversation, err := sideKick.TruncateAfter(companion.Conversation, index)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ExportConversation writes the conversation as transcript in the given format. Images of Markdown
+// transcripts are written to Config.ImageDir. The transcript is encrypted if Config.EncryptionKey is set.
+func (companion *FakeCompanion) ExportConversation(w io.Writer, format models.ConversationFormat) error {
+	return sideKick.ExportConversation(w, companion.Conversation, format, companion.Config.ImageDir, companion.Config.EncryptionKey)
+}
+
+// ImportConversation replaces the conversation with a JSON or Markdown transcript, which is decrypted
+// with Config.EncryptionKey if it is encrypted.
+func (companion *FakeCompanion) ImportConversation(r io.Reader) error {
+	conversation, err := sideKick.ImportConversation(r, companion.Config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// SetConversationStore sets the store keeping the conversations of the sessions that are not current.
+func (companion *FakeCompanion) SetConversationStore(store conversationstore.Store) {
+	companion.Sessions.Store = store
+}
+
+// CurrentSession returns the name of the current session.
+func (companion *FakeCompanion) CurrentSession() string {
+	return companion.Sessions.Current()
+}
+
+// SwitchSession saves the conversation under the current session and continues the named session.
+func (companion *FakeCompanion) SwitchSession(name string) error {
+	conversation, err := companion.Sessions.Switch(name, companion.Conversation)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ListSessions returns the names of all sessions.
+func (companion *FakeCompanion) ListSessions() ([]string, error) {
+	return companion.Sessions.List()
+}
+
+// SearchSessions saves the conversation under the current session and searches the messages of all
+// sessions. The conversation store has to implement conversationstore.Searcher.
+func (companion *FakeCompanion) SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error) {
+	return companion.Sessions.Search(companion.Conversation, query, limit)
+}
+
+// DeleteSession deletes the named session. Deleting the current session clears the conversation.
+func (companion *FakeCompanion) DeleteSession(name string) error {
+	current, err := companion.Sessions.Delete(name)
+	if err != nil {
+		return err
+	}
+	if current {
+		companion.Conversation = make([]models.Message, 0)
+	}
+	return nil
+}
+
+// GetUsage returns the estimated tokens of the answers, in total, per session and per model.
+func (companion *FakeCompanion) GetUsage() models.UsageReport {
+	return companion.Usage.Report()
+}
+
+// GetHttpClient returns the HTTP client. The fake does not use it.
+func (companion *FakeCompanion) GetHttpClient() *http.Client {
+	return companion.HttpClient
+}
+
+// SetHttpClient sets the HTTP client. The fake does not use it.
+func (companion *FakeCompanion) SetHttpClient(client *http.Client) {
+	companion.HttpClient = client
+}
+
+// SetVectorDB sets the vector database used by SendRAGRequest.
+func (companion *FakeCompanion) SetVectorDB(vectorDb vectordb.VectorDb) {
+	companion.VectorDb = vectorDb
+}
+
+// GetVectorDB returns the vector database used by SendRAGRequest.
+func (companion *FakeCompanion) GetVectorDB() vectordb.VectorDb {
+	return companion.VectorDb
+}
+
+// GetModels returns the configured models.
+func (companion *FakeCompanion) GetModels(ctx context.Context) ([]models.Model, error) {
+	if companion.Err != nil {
+		return nil, companion.Err
+	}
+	return companion.Models, nil
+}
+
+// SendChatRequest answers from the script and adds the exchange to the conversation. Personas using
+// knowledge get it added to the message like with the real companions.
+func (companion *FakeCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	message, err := sideKick.PrepareKnowledgeRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	result, err := companion.answer(ctx, message, streaming, callback)
+	if err != nil {
+		return result, err
+	}
+
+	if message.RetainOriginalMessage {
+		companion.AddMessage(message.OriginalMessage)
+	} else {
+		companion.AddMessage(message.Message)
+	}
+	companion.AddMessage(result)
+
+	return result, nil
+}
+
+// SendRAGRequest enriches the message with documents of the vector database and answers it like SendChatRequest.
+func (companion *FakeCompanion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request, err := sideKick.PrepareRAGRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message, options)
+	if err != nil {
+		return models.Message{}, err
+	}
+	return companion.SendChatRequest(ctx, request, streaming, callback)
+}
+
+// SendGenerateRequest answers from the script without modifying the conversation.
+func (companion *FakeCompanion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	return companion.answer(ctx, message, streaming, callback)
+}
+
+// answer records the request and produces the scripted answer, streaming it if requested. Like the
+// real companions, it fails with the error of ctx once ctx is done.
+func (companion *FakeCompanion) answer(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	companion.record(message)
+	if companion.Err != nil {
+		return models.Message{}, companion.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return models.Message{}, err
+	}
+
+	text, err := companion.Next(message.Message)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	// usage is estimated from the request and the answer
+	result := sideKick.CreateAssistantMessage(text)
+	result.Model = companion.Config.AiModels.ChatModel.Model
+	prompt, completion := sideKick.CountTokens(message.Message), sideKick.CountTokens(result)
+	result.Usage = &models.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	result.FinishReason = models.FinishStop
+	result.Cost = sidekick.CostEstimator{Pricing: companion.Config.Pricing}.Estimate(result.Model, result.Usage)
+
+	if streaming && callback != nil {
+		chunk := companion.Chunk
+		if chunk == nil {
+			chunk = SplitWords
+		}
+		// like the real companions, a cancelled stream returns the answer received until then
+		var received strings.Builder
+		partial := func() models.Message {
+			cancelled := sideKick.CreateAssistantMessage(received.String())
+			cancelled.Cancelled = true
+			return cancelled
+		}
+		parts := chunk(text)
+		if len(parts) == 0 {
+			parts = []string{""}
+		}
+		for i, part := range parts {
+			if err := ctx.Err(); err != nil {
+				return partial(), err
+			}
+			received.WriteString(part)
+			message := sideKick.CreateAssistantMessage(part)
+			// the last chunk carries the model, usage and finish reason of the answer
+			if i == len(parts)-1 {
+				message.Model = result.Model
+				message.Usage = result.Usage
+				message.FinishReason = result.FinishReason
+			}
+			if err := callback(message); err != nil {
+				return partial(), err
+			}
+		}
+	}
+
+	companion.Usage.Record(companion.Sessions.Current(), result.Model, result.Usage, result.Cost)
+	return result, nil
+}
+
+// SendEmbeddingRequest returns deterministic embeddings computed by Embed.
+func (companion *FakeCompanion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+	if companion.Err != nil {
+		return models.EmbeddingResponse{}, companion.Err
+	}
+
+	dimensions := companion.Dimensions
+	if dimensions <= 0 {
+		dimensions = DefaultDimensions
+	}
+
+	response := models.EmbeddingResponse{Model: embedding.Model}
+	for _, input := range embedding.Input {
+		response.Embeddings = append(response.Embeddings, Embed(input, dimensions))
+	}
+	return response, nil
+}
+
+// SendModerationRequest flags inputs according to Flagged.
+func (companion *FakeCompanion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+	if companion.Err != nil {
+		return models.ModerationResponse{}, companion.Err
+	}
+
+	flagged := companion.Flagged != nil && companion.Flagged(moderationRequest.Input)
+	score := 0.0
+	if flagged {
+		score = 1
+	}
+
+	return models.ModerationResponse{
+		ID:               "fake-moderation",
+		Model:            models.Model{Model: "fake-moderation", Name: "fake-moderation"},
+		Flagged:          flagged,
+		Categories:       map[string]bool{models.ModerationHarassment: flagged},
+		CategoryScores:   map[string]float64{models.ModerationHarassment: score},
+		OriginalResponse: map[string]any{"flagged": flagged},
+	}, nil
+}
+
+// HandleStreamResponse reads an Ollama style stream, as produced by OllamaChatStream.
+func (companion *FakeCompanion) HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+	defer resp.Body.Close()
+	chunks, err := ReadOllamaStream(resp.Body, streamType)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	for _, chunk := range chunks {
+		if callback != nil {
+			if err := callback(sideKick.CreateAssistantMessage(chunk)); err != nil {
+				return models.Message{}, err
+			}
+		}
+	}
+	return sideKick.CreateAssistantMessage(strings.Join(chunks, "")), nil
+}
+
+// SendToolRequest answers from the script like a generate request.
+func (companion *FakeCompanion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	return companion.answer(ctx, message, false, nil)
+}
+
+// SetToolRegistry sets the registry of tools implemented by Go functions.
+func (companion *FakeCompanion) SetToolRegistry(registry *tools.Registry) {
+	companion.ToolRegistry = registry
+}
+
+// SetOnToolCall sets the hook asked before a tool is run.
+func (companion *FakeCompanion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.OnToolCall = hook
+}
+
+// RunFunction runs the handler registered in the tool registry or delegates to Functions, once OnToolCall
+// approved the call.
+func (companion *FakeCompanion) RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	if companion.OnToolCall != nil {
+		approval := companion.OnToolCall(models.ToolCall{Payload: payload})
+		if !approval.Approved {
+			err := fmt.Errorf("tool call denied: %s", approval.Reason)
+			return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}, err
+		}
+		if approval.Arguments != nil {
+			payload.Arguments = approval.Arguments
+		}
+	}
+	if companion.ToolRegistry.Has(payload.FunctionName) {
+		return companion.ToolRegistry.Call(ctx, payload)
+	}
+	if companion.Functions == nil {
+		return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: "no functions configured"}, errors.New("no functions configured")
+	}
+	return companion.Functions(tool, payload)
+}
+
+// SplitWords splits text into chunks of one word each, keeping the whitespace, so that
+// concatenating the chunks yields the original text.
+func SplitWords(text string) []string {
+	var chunks []string
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if text[i] == ' ' && text[i-1] != ' ' {
+			chunks = append(chunks, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+// Embed returns a normalized bag-of-words vector of the given size. Texts sharing words
+// have a higher cosine similarity, which makes retrieval tests meaningful without a model.
+func Embed(text string, dimensions int) []float32 {
+	vector := make([]float32, dimensions)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?\"'()[]")
+		if word == "" {
+			continue
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		vector[hash.Sum32()%uint32(dimensions)]++
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value * value)
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+var _ aicompanion.AICompanion = (*FakeCompanion)(nil)
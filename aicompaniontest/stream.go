@@ -0,0 +1,124 @@
+package aicompaniontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// OpenAIStream returns a chat completion stream in server-sent event format for the given chunks.
+func OpenAIStream(model string, chunks []string) string {
+	var stream strings.Builder
+	for i, chunk := range chunks {
+		choice := map[string]any{"index": 0, "delta": map[string]string{"content": chunk}}
+		if i == len(chunks)-1 {
+			choice["finish_reason"] = "stop"
+		}
+		writeEvent(&stream, map[string]any{
+			"id":      "chatcmpl-fake",
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []any{choice},
+		})
+	}
+	stream.WriteString("data: [DONE]\n\n")
+	return stream.String()
+}
+
+// OllamaChatStream returns a newline delimited /api/chat stream for the given chunks.
+func OllamaChatStream(model string, chunks []string) string {
+	return ollamaStream(model, chunks, models.Chat)
+}
+
+// OllamaGenerateStream returns a newline delimited /api/generate stream for the given chunks.
+func OllamaGenerateStream(model string, chunks []string) string {
+	return ollamaStream(model, chunks, models.Generate)
+}
+
+// ollamaStream returns a newline delimited stream for the given stream type.
+func ollamaStream(model string, chunks []string, streamType models.StreamType) string {
+	var stream strings.Builder
+	for i := 0; i <= len(chunks); i++ {
+		object := map[string]any{"model": model, "created_at": time.Now().UTC(), "done": i == len(chunks)}
+		content := ""
+		if i < len(chunks) {
+			content = chunks[i]
+		} else {
+			object["done_reason"] = "stop"
+		}
+
+		if streamType == models.Chat {
+			object["message"] = map[string]string{"role": string(models.Assistant), "content": content}
+		} else {
+			object["response"] = content
+		}
+
+		line, _ := json.Marshal(object)
+		stream.Write(line)
+		stream.WriteByte('\n')
+	}
+	return stream.String()
+}
+
+// StreamResponse wraps a stream fixture in an *http.Response, e.g. to test HandleStreamResponse.
+func StreamResponse(body string) *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/x-ndjson"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// ReadOllamaStream parses a newline delimited Ollama stream into its content chunks.
+func ReadOllamaStream(r io.Reader, streamType models.StreamType) ([]string, error) {
+	var chunks []string
+	lines := sidekick.NewLineReader(r, 0)
+	for {
+		raw, err := lines.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSpace(string(raw))
+		if line == "" {
+			continue
+		}
+
+		var object struct {
+			Done     bool           `json:"done"`
+			Response string         `json:"response"`
+			Message  models.Message `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			return nil, fmt.Errorf("invalid stream line %q: %w", line, err)
+		}
+
+		content := object.Message.Content
+		if streamType == models.Generate {
+			content = object.Response
+		}
+		if content != "" {
+			chunks = append(chunks, content)
+		}
+		if object.Done {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// writeEvent writes a single server-sent event.
+func writeEvent(w io.Writer, data any) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+}
@@ -0,0 +1,234 @@
+package aicompaniontest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// FakeVectorDb is an in-memory vectordb.VectorDb with brute force cosine similarity search.
+// Schemas are created implicitly when documents are added.
+type FakeVectorDb struct {
+	mutex   sync.RWMutex
+	classes map[string]map[string]models.Document
+	// Err is returned by every operation while set.
+	Err error
+}
+
+// NewFakeVectorDb creates a new, empty FakeVectorDb.
+func NewFakeVectorDb() *FakeVectorDb {
+	return &FakeVectorDb{classes: make(map[string]map[string]models.Document)}
+}
+
+// Documents returns all documents of a class.
+func (db *FakeVectorDb) Documents(classname string) []models.Document {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	documents := make([]models.Document, 0, len(db.classes[classname]))
+	for _, document := range db.classes[classname] {
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].ID < documents[j].ID })
+	return documents
+}
+
+// AddDocument implements vectordb.VectorDb.
+func (db *FakeVectorDb) AddDocument(ctx context.Context, classname, id string, document models.Document) error {
+	if db.Err != nil {
+		return db.Err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	class, exists := db.classes[classname]
+	if !exists {
+		class = make(map[string]models.Document)
+		db.classes[classname] = class
+	}
+	document.ID = id
+	document.ClassName = classname
+	class[id] = document
+	return nil
+}
+
+// AddDocuments implements vectordb.VectorDb.
+func (db *FakeVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	for _, document := range documents {
+		if err := db.AddDocument(ctx, classname, document.ID, document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateDocument implements vectordb.VectorDb.
+func (db *FakeVectorDb) UpdateDocument(ctx context.Context, classname, id string, document models.Document) error {
+	db.mutex.RLock()
+	_, exists := db.classes[classname][id]
+	db.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("document %s not found in %s", id, classname)
+	}
+	return db.AddDocument(ctx, classname, id, document)
+}
+
+// UpdateDocuments implements vectordb.VectorDb.
+func (db *FakeVectorDb) UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	for _, document := range documents {
+		if err := db.UpdateDocument(ctx, classname, document.ID, document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryDocuments implements vectordb.VectorDb. Filters match metadata values exactly.
+func (db *FakeVectorDb) QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	if db.Err != nil {
+		return nil, db.Err
+	}
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var results []models.Document
+	for _, document := range db.classes[classname] {
+		if !vdbutil.MatchesFilter(document.Metadata, queryOptions.Filter) {
+			continue
+		}
+		document.Score = vdbutil.CosineSimilarity(vector, document.Embeddings)
+		results = append(results, document)
+	}
+
+	return vdbutil.Rank(results, queryOptions), nil
+}
+
+// GetDocument implements vectordb.VectorDb.
+func (db *FakeVectorDb) GetDocument(ctx context.Context, classname, id string) (models.Document, error) {
+	if db.Err != nil {
+		return models.Document{}, db.Err
+	}
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	document, exists := db.classes[classname][id]
+	if !exists {
+		return models.Document{}, vectordb.ErrDocumentNotExists
+	}
+	return document, nil
+}
+
+// ListDocuments implements vectordb.VectorDb.
+func (db *FakeVectorDb) ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	return vdbutil.List(ctx, db, classname, listOptions)
+}
+
+// ScanDocuments implements vectordb.Scanner.
+func (db *FakeVectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	if db.Err != nil {
+		return db.Err
+	}
+
+	for _, document := range db.Documents(classname) {
+		if document.ID <= after {
+			continue
+		}
+		if err := fn(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteDocument implements vectordb.VectorDb.
+func (db *FakeVectorDb) DeleteDocument(ctx context.Context, classname, id string) error {
+	if db.Err != nil {
+		return db.Err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.classes[classname], id)
+	return nil
+}
+
+// DeleteDocuments implements vectordb.VectorDb.
+func (db *FakeVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
+	for _, id := range ids {
+		if err := db.DeleteDocument(ctx, classname, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSchema implements vectordb.VectorDb.
+func (db *FakeVectorDb) CreateSchema(ctx context.Context, schema models.Schema) error {
+	if db.Err != nil {
+		return db.Err
+	}
+
+	name := schema.ClassName
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, exists := db.classes[name]; !exists {
+		db.classes[name] = make(map[string]models.Document)
+	}
+	return nil
+}
+
+// GetSchema implements vectordb.VectorDb.
+func (db *FakeVectorDb) GetSchema(ctx context.Context, classname string) (models.Schema, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	if _, exists := db.classes[classname]; !exists {
+		return models.Schema{}, fmt.Errorf("%w: %s", vectordb.ErrSchemaNotExists, classname)
+	}
+	return models.Schema{ClassName: classname}, nil
+}
+
+// GetSchemas implements vectordb.VectorDb.
+func (db *FakeVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	names := make([]string, 0, len(db.classes))
+	for name := range db.classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DeleteSchema implements vectordb.VectorDb.
+func (db *FakeVectorDb) DeleteSchema(ctx context.Context, classname string) error {
+	if db.Err != nil {
+		return db.Err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.classes, classname)
+	return nil
+}
+
+// DeleteSchemas implements vectordb.VectorDb.
+func (db *FakeVectorDb) DeleteSchemas(ctx context.Context, classnames []string) error {
+	for _, classname := range classnames {
+		if err := db.DeleteSchema(ctx, classname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ vectordb.VectorDb = (*FakeVectorDb)(nil)
+var _ vectordb.Scanner = (*FakeVectorDb)(nil)
@@ -0,0 +1,62 @@
+package aicompanion
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// JudgePrompt is the system prompt of the judge of JudgeChoice.
+const JudgePrompt = "You are given a request and numbered candidate answers to it. Decide which answer is the most correct, complete and helpful. Reply with only the number of the best answer."
+
+// judgeNumber finds the number of the answer in the reply of a judge.
+var judgeNumber = regexp.MustCompile(`\d+`)
+
+// FirstChoice selects the first candidate answer, like requests without selector.
+func FirstChoice(ctx context.Context, message models.Message, choices []models.Message) (int, error) {
+	return 0, nil
+}
+
+// LongestChoice selects the candidate answer with the most characters, the first of them on a tie.
+func LongestChoice(ctx context.Context, message models.Message, choices []models.Message) (int, error) {
+	longest := 0
+	for i, choice := range choices {
+		if utf8.RuneCountInString(choice.Content) > utf8.RuneCountInString(choices[longest].Content) {
+			longest = i
+		}
+	}
+	return longest, nil
+}
+
+// JudgeChoice returns a selector that asks judge to pick the best candidate answer. The judge receives the
+// request and the numbered answers as generate request with JudgePrompt as system prompt, so its
+// conversation is not changed. Judge may be the companion whose answers it judges.
+func JudgeChoice(judge AICompanion) models.ChoiceSelector {
+	return func(ctx context.Context, message models.Message, choices []models.Message) (int, error) {
+		var prompt strings.Builder
+		fmt.Fprintf(&prompt, "Request:\n%s\n", message.Content)
+		for i, choice := range choices {
+			fmt.Fprintf(&prompt, "\nAnswer %d:\n%s\n", i+1, choice.Content)
+		}
+
+		request := models.MessageRequest{
+			Message:      models.Message{Role: models.User, Content: prompt.String()},
+			SystemPrompt: JudgePrompt,
+		}
+		verdict, err := judge.SendGenerateRequest(ctx, request, false, nil)
+		if err != nil {
+			return 0, fmt.Errorf("judge failed: %w", err)
+		}
+
+		number, err := strconv.Atoi(judgeNumber.FindString(verdict.Content))
+		if err != nil || number < 1 || number > len(choices) {
+			return 0, fmt.Errorf("judge answered no valid answer number: %q", verdict.Content)
+		}
+		return number - 1, nil
+	}
+}
@@ -0,0 +1,97 @@
+package aicompanion_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// newChoiceServer answers chat requests with n numbered candidates, or with verdict if it is set.
+func newChoiceServer(t *testing.T, verdict string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload openai.ChatRequest
+		json.NewDecoder(r.Body).Decode(&payload)
+		candidates := []string{verdict}
+		if verdict == "" {
+			candidates = []string{"Red", "Ultramarine", "Teal"}[:max(payload.N, 1)]
+		}
+
+		var response openai.ChatResponse
+		for i, candidate := range candidates {
+			response.Choices = append(response.Choices, openai.Choice{Index: i, FinishReason: "stop", Message: openai.Message{Role: models.Assistant, Content: candidate}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newChoiceCompanion(server *httptest.Server) aicompanion.AICompanion {
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	return aicompanion.NewCompanion(*config)
+}
+
+func TestChoices(t *testing.T) {
+	judge := newChoiceCompanion(newChoiceServer(t, "Answer 3 is the best."))
+
+	tests := []struct {
+		name     string
+		selector models.ChoiceSelector
+		expected string
+	}{
+		{"default", nil, "Red"},
+		{"first", aicompanion.FirstChoice, "Red"},
+		{"longest", aicompanion.LongestChoice, "Ultramarine"},
+		{"judge", aicompanion.JudgeChoice(judge), "Teal"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			companion := newChoiceCompanion(newChoiceServer(t, ""))
+			request := models.MessageRequest{
+				Message:      models.Message{Role: models.User, Content: "Name a color"},
+				Options:      &models.GenerationOptions{N: 3},
+				SelectChoice: test.selector,
+			}
+			result, err := companion.SendChatRequest(context.Background(), request, false, nil)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if result.Content != test.expected || len(result.Choices) != 3 || result.Choices[1].Content != "Ultramarine" {
+				t.Errorf("expected %q among 3 choices, got %q among %d", test.expected, result.Content, len(result.Choices))
+			}
+			if conversation := companion.GetConversation(); conversation[len(conversation)-1].Content != test.expected {
+				t.Errorf("expected the selected answer in the conversation, got %q", conversation[len(conversation)-1].Content)
+			}
+		})
+	}
+
+	t.Run("invalid verdict", func(t *testing.T) {
+		companion := newChoiceCompanion(newChoiceServer(t, ""))
+		request := models.MessageRequest{
+			Message:      models.Message{Role: models.User, Content: "Name a color"},
+			Options:      &models.GenerationOptions{N: 2},
+			SelectChoice: aicompanion.JudgeChoice(newChoiceCompanion(newChoiceServer(t, "Answer 7"))),
+		}
+		if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err == nil {
+			t.Error("expected an error for an answer number out of range")
+		}
+		if len(companion.GetConversation()) != 0 {
+			t.Error("expected no message to be added to the conversation")
+		}
+	})
+
+	t.Run("single choice", func(t *testing.T) {
+		result, err := newChoiceCompanion(newChoiceServer(t, "")).SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Name a color"}}, false, nil)
+		if err != nil || result.Content != "Red" || result.Choices != nil {
+			t.Errorf("expected a single answer without choices, got %q with %d choices (%v)", result.Content, len(result.Choices), err)
+		}
+	})
+}
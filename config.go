@@ -0,0 +1,163 @@
+package aicompanion
+
+import "github.com/ghmer/aicompanion/models"
+
+// ConfigOption sets a value of a configuration built by NewConfig.
+type ConfigOption func(config *models.Configuration)
+
+// NewConfig builds the default configuration of provider with options applied, resolves its secrets and
+// validates it. Without WithGenerateModel, generate requests use the chat model.
+//
+//	config, err := aicompanion.NewConfig(models.OpenAI,
+//		aicompanion.WithAPIKey(key),
+//		aicompanion.WithChatModel("gpt-4o"),
+//		aicompanion.WithEmbeddingModel("text-embedding-3-small"),
+//		aicompanion.WithMaxMessages(50))
+func NewConfig(provider models.ApiProvider, options ...ConfigOption) (*models.Configuration, error) {
+	config := NewDefaultConfig(provider, "", "", "", "")
+	for _, option := range options {
+		option(config)
+	}
+	if config.AiModels.GenerateModel.Model == "" {
+		config.AiModels.GenerateModel = config.AiModels.ChatModel
+	}
+	if err := config.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// WithAPIKey sets the API key, which may be an indirect secret, see models.ResolveSecret.
+func WithAPIKey(key string) ConfigOption {
+	return func(config *models.Configuration) {
+		config.ApiKey = key
+	}
+}
+
+// WithEndpoints replaces the default endpoints of the provider.
+func WithEndpoints(endpoints models.ApiEndpointUrls) ConfigOption {
+	return func(config *models.Configuration) {
+		config.ApiEndpoints = endpoints
+	}
+}
+
+// WithChatModel sets the model of chat requests.
+func WithChatModel(model string) ConfigOption {
+	return func(config *models.Configuration) {
+		config.AiModels.ChatModel = models.Model{Model: model, Name: model}
+	}
+}
+
+// WithGenerateModel sets the model of generate requests.
+func WithGenerateModel(model string) ConfigOption {
+	return func(config *models.Configuration) {
+		config.AiModels.GenerateModel = models.Model{Model: model, Name: model}
+	}
+}
+
+// WithEmbeddingModel sets the model of embedding requests.
+func WithEmbeddingModel(model string) ConfigOption {
+	return func(config *models.Configuration) {
+		config.AiModels.EmbeddingModel = models.Model{Model: model, Name: model}
+	}
+}
+
+// WithMaxMessages sets the number of messages of the conversation sent along with a request.
+func WithMaxMessages(count int) ConfigOption {
+	return func(config *models.Configuration) {
+		config.MaxMessages = count
+	}
+}
+
+// WithMaxContextTokens sets the token budget of the messages of a chat request.
+func WithMaxContextTokens(tokens int) ConfigOption {
+	return func(config *models.Configuration) {
+		config.MaxContextTokens = tokens
+	}
+}
+
+// WithHTTPTimeout sets the timeout of the HTTP client in seconds.
+func WithHTTPTimeout(seconds int) ConfigOption {
+	return func(config *models.Configuration) {
+		config.HttpConfig.HTTPClientTimeout = seconds
+	}
+}
+
+// WithRetry sets the retries of requests failing transiently.
+func WithRetry(retry models.RetryConfiguration) ConfigOption {
+	return func(config *models.Configuration) {
+		config.HttpConfig.Retry = retry
+	}
+}
+
+// WithRAG sets the options of the vector database queries of RAG requests.
+func WithRAG(options models.VectorDBQueryOptions) ConfigOption {
+	return func(config *models.Configuration) {
+		config.RAGQueryOptions = options
+	}
+}
+
+// WithSystemPrompt sets the system prompt of the active persona.
+func WithSystemPrompt(prompt string) ConfigOption {
+	return func(config *models.Configuration) {
+		config.ActivePersona.Prompt.SystemPrompt = prompt
+		for i := range config.Personas {
+			if config.Personas[i].Name == config.ActivePersona.Name {
+				config.Personas[i].Prompt.SystemPrompt = prompt
+			}
+		}
+	}
+}
+
+// WithPersona adds persona, replacing a persona of the same name, and makes it the active one.
+func WithPersona(persona models.Persona) ConfigOption {
+	return func(config *models.Configuration) {
+		config.ActivePersona = persona
+		for i := range config.Personas {
+			if config.Personas[i].Name == persona.Name {
+				config.Personas[i] = persona
+				return
+			}
+		}
+		config.Personas = append(config.Personas, persona)
+	}
+}
+
+// WithTools adds tools the model may call with SendToolRequest.
+func WithTools(tools ...models.Tool) ConfigOption {
+	return func(config *models.Configuration) {
+		config.Tools = append(config.Tools, tools...)
+	}
+}
+
+// WithModeration enables the moderation of chat requests.
+func WithModeration(moderation models.ModerationConfig) ConfigOption {
+	return func(config *models.Configuration) {
+		moderation.Enabled = true
+		config.Moderation = moderation
+	}
+}
+
+// WithPricing sets the prices used to estimate the costs of responses.
+func WithPricing(pricing models.Pricing) ConfigOption {
+	return func(config *models.Configuration) {
+		config.Pricing = pricing
+	}
+}
+
+// WithGeneration sets the sampling options of all requests, see models.GenerationOptions.
+func WithGeneration(options models.GenerationOptions) ConfigOption {
+	return func(config *models.Configuration) {
+		config.Generation = options
+	}
+}
+
+// WithProfiles adds provider profiles, see NewProfileCompanion.
+func WithProfiles(profiles ...models.Profile) ConfigOption {
+	return func(config *models.Configuration) {
+		config.Profiles = append(config.Profiles, profiles...)
+	}
+}
@@ -0,0 +1,38 @@
+package aicompanion_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestNewConfig(t *testing.T) {
+	t.Setenv("TEST_GROQ_KEY", "gsk-test")
+	config, err := aicompanion.NewConfig(models.Groq,
+		aicompanion.WithAPIKey("env:TEST_GROQ_KEY"),
+		aicompanion.WithChatModel("llama-3.3-70b-versatile"),
+		aicompanion.WithMaxMessages(50),
+		aicompanion.WithRAG(models.VectorDBQueryOptions{Limit: 5, SimilarityThreshold: 0.7}),
+		aicompanion.WithSystemPrompt("You are terse"),
+	)
+	if err != nil {
+		t.Fatalf("failed to build config: %v", err)
+	}
+	if config.ApiKey != "gsk-test" || config.MaxMessages != 50 || config.RAGQueryOptions.Limit != 5 {
+		t.Errorf("expected the options to be applied, got %+v", config)
+	}
+	if config.AiModels.GenerateModel.Model != "llama-3.3-70b-versatile" || config.ApiEndpoints != aicompanion.GroqEndpoints {
+		t.Errorf("expected the defaults of the provider, got %+v", config)
+	}
+	if config.ActivePersona.Prompt.SystemPrompt != "You are terse" || config.GetPersona("default").Prompt.SystemPrompt != "You are terse" {
+		t.Errorf("expected the system prompt of the persona to be set, got %+v", config.ActivePersona)
+	}
+
+	_, err = aicompanion.NewConfig(models.OpenAI, aicompanion.WithMaxMessages(-1))
+	var configErr *models.ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 4 {
+		t.Errorf("expected the missing key and models and the invalid limit, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package aicompanion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+// PrimaryBackend is the name of the configured backend of a FailoverCompanion.
+const PrimaryBackend = "primary"
+
+// backend is a companion requests can be routed to.
+type backend struct {
+	name      string
+	companion AICompanion
+}
+
+// FailoverCompanion routes chat, generate, RAG and tool requests to the fallback profiles of
+// Config.Failover, in order, while the backends before them fail. Failures are network errors and
+// provider errors with status 401, 403, 408, 429 or 5xx; a backend failing repeatedly is skipped for a
+// cooldown. Streamed requests fail over only until the first chunk arrived. The conversation is held by
+// the primary backend and handed to the fallback that answers; Info.Backend of a response and
+// LastBackend tell which backend answered. Embedding requests are not failed over, as the embeddings of
+// different models cannot be compared.
+type FailoverCompanion struct {
+	AICompanion
+
+	fallbacks []backend
+	config    models.FailoverConfiguration
+	breakers  sidekick.CircuitBreakers
+
+	mutex sync.Mutex
+	last  string
+}
+
+// NewFailoverCompanion creates a companion for config and for each of its failover profiles.
+func NewFailoverCompanion(config models.Configuration) (*FailoverCompanion, error) {
+	primary := NewCompanion(config)
+	if primary == nil {
+		return nil, fmt.Errorf("unsupported provider: %s", config.ApiProvider)
+	}
+	companion := &FailoverCompanion{AICompanion: primary, config: config.Failover}
+	for _, name := range config.Failover.Profiles {
+		profile, err := ApplyProfile(config, name)
+		if err != nil {
+			return nil, err
+		}
+		fallback := NewCompanion(profile)
+		if fallback == nil {
+			return nil, fmt.Errorf("unsupported provider of profile %s: %s", name, profile.ApiProvider)
+		}
+		companion.fallbacks = append(companion.fallbacks, backend{name: name, companion: fallback})
+	}
+	return companion, nil
+}
+
+// LastBackend returns the backend that answered the last request: PrimaryBackend or the name of a
+// fallback profile.
+func (companion *FailoverCompanion) LastBackend() string {
+	companion.mutex.Lock()
+	defer companion.mutex.Unlock()
+	return companion.last
+}
+
+// SendChatRequest implements AICompanion.
+func (companion *FailoverCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	return companion.send(ctx, callback, func(backend AICompanion, callback func(m models.Message) error) (models.Message, error) {
+		return backend.SendChatRequest(ctx, message, streaming, callback)
+	})
+}
+
+// SendGenerateRequest implements AICompanion.
+func (companion *FailoverCompanion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	return companion.send(ctx, callback, func(backend AICompanion, callback func(m models.Message) error) (models.Message, error) {
+		return backend.SendGenerateRequest(ctx, message, streaming, callback)
+	})
+}
+
+// SendRAGRequest implements AICompanion.
+func (companion *FailoverCompanion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	return companion.send(ctx, callback, func(backend AICompanion, callback func(m models.Message) error) (models.Message, error) {
+		return backend.SendRAGRequest(ctx, message, options, streaming, callback)
+	})
+}
+
+// SendToolRequest implements AICompanion.
+func (companion *FailoverCompanion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	return companion.send(ctx, nil, func(backend AICompanion, _ func(m models.Message) error) (models.Message, error) {
+		return backend.SendToolRequest(ctx, message)
+	})
+}
+
+// SetToolRegistry implements AICompanion.
+func (companion *FailoverCompanion) SetToolRegistry(registry *tools.Registry) {
+	companion.AICompanion.SetToolRegistry(registry)
+	for _, fallback := range companion.fallbacks {
+		fallback.companion.SetToolRegistry(registry)
+	}
+}
+
+// SetOnToolCall implements AICompanion.
+func (companion *FailoverCompanion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.AICompanion.SetOnToolCall(hook)
+	for _, fallback := range companion.fallbacks {
+		fallback.companion.SetOnToolCall(hook)
+	}
+}
+
+// send sends a request to the first backend that is not skipped and fails over to the next one while
+// backends fail. If all fail, the errors of all backends are returned.
+func (companion *FailoverCompanion) send(ctx context.Context, callback func(m models.Message) error, request func(backend AICompanion, callback func(m models.Message) error) (models.Message, error)) (models.Message, error) {
+	primary := companion.AICompanion
+	backends := append([]backend{{name: PrimaryBackend, companion: primary}}, companion.fallbacks...)
+	breaker := companion.config.Breaker()
+
+	var errs []error
+	for _, backend := range backends {
+		if err := companion.breakers.Allow(backend.name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if backend.companion != primary {
+			copyPrompts(primary, backend.companion)
+			backend.companion.SetConversation(primary.GetConversation())
+		}
+
+		var streamed bool
+		observed := callback
+		if callback != nil {
+			observed = func(m models.Message) error {
+				streamed = true
+				return callback(m)
+			}
+		}
+		result, err := request(backend.companion, observed)
+		failed := err != nil && failsOver(ctx, err)
+		companion.breakers.Record(backend.name, failed, breaker)
+		if err != nil && failed && !streamed {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.name, err))
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if backend.companion != primary {
+			primary.SetConversation(backend.companion.GetConversation())
+		}
+		if result.Info == nil {
+			result.Info = &models.ResponseInfo{}
+		}
+		result.Info.Backend = backend.name
+		companion.mutex.Lock()
+		companion.last = backend.name
+		companion.mutex.Unlock()
+		return result, nil
+	}
+	return models.Message{}, errors.Join(errs...)
+}
+
+// failsOver reports whether err is a failure of the backend rather than of the request.
+func failsOver(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var providerErr *models.ProviderError
+	if errors.As(err, &providerErr) {
+		switch code := providerErr.StatusCode; {
+		case code == 0, code >= 500:
+			return true
+		case code == http.StatusUnauthorized, code == http.StatusForbidden, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,61 @@
+package aicompanion_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestFailoverCompanion(t *testing.T) {
+	var primaryCalls int
+	status := http.StatusServiceUnavailable
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"error":{"message":"unavailable","type":"server_error"}}`)
+	}))
+	defer primary.Close()
+	var fallbackMessages int
+	fallback := newProfileServer(t, "fallback", &fallbackMessages)
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = primary.URL
+	config.Profiles = []models.Profile{{Name: "local", ApiEndpoints: models.ApiEndpointUrls{ApiChatURL: fallback.URL}}}
+	config.Failover = models.FailoverConfiguration{Profiles: []string{"local"}, Threshold: 2, Cooldown: 60}
+
+	companion, err := aicompanion.NewFailoverCompanion(*config)
+	if err != nil {
+		t.Fatalf("failed to create companion: %v", err)
+	}
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}
+	for i := range 3 {
+		result, err := companion.SendChatRequest(context.Background(), request, false, nil)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		if result.Content != "fallback" || result.Info == nil || result.Info.Backend != "local" || companion.LastBackend() != "local" {
+			t.Errorf("request %d: expected the fallback to answer, got %q", i, result.Content)
+		}
+	}
+	if primaryCalls != 2 {
+		t.Errorf("expected the primary to be skipped after 2 failures, got %d calls", primaryCalls)
+	}
+	if len(companion.GetConversation()) != 6 || fallbackMessages != 6 {
+		t.Errorf("expected the conversation to be kept, got %d messages, the fallback received %d", len(companion.GetConversation()), fallbackMessages)
+	}
+
+	// errors of the request are not failed over
+	companion, _ = aicompanion.NewFailoverCompanion(*config)
+	status = http.StatusBadRequest
+	if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err == nil {
+		t.Error("expected the error of the primary")
+	}
+	if fallbackMessages != 6 {
+		t.Errorf("expected the fallback not to be asked, it received %d messages", fallbackMessages)
+	}
+}
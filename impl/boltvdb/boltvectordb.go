@@ -0,0 +1,337 @@
+// Package boltvdb implements a file based vector database on bbolt. It needs no external services and
+// no CGO. Every schema is stored in its own bucket.
+package boltvdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var _ vectordb.VectorDb = (*BoltVectorDb)(nil)
+var _ vectordb.Scanner = (*BoltVectorDb)(nil)
+
+// record is the stored form of a document.
+type record struct {
+	Metadata   map[string]any `json:"metadata"`
+	Embeddings []float32      `json:"embeddings"`
+	Content    string         `json:"content,omitempty"`
+}
+
+// BoltVectorDb represents a vector database using bbolt.
+type BoltVectorDb struct {
+	db              *bolt.DB
+	dbPath          string
+	normalizeVector bool
+}
+
+// NewBoltVectorDb opens or creates the bbolt database at dbPath.
+func NewBoltVectorDb(dbPath string, normalize bool) (*BoltVectorDb, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltVectorDb{
+		db:              db,
+		dbPath:          dbPath,
+		normalizeVector: normalize,
+	}, nil
+}
+
+// Close closes the database file.
+func (b *BoltVectorDb) Close() error {
+	return b.db.Close()
+}
+
+// GetSchema retrieves the schema for storing documents with the given class name.
+func (b *BoltVectorDb) GetSchema(ctx context.Context, classname string) (models.Schema, error) {
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(classname)) == nil {
+			return vectordb.ErrSchemaNotExists
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Schema{}, err
+	}
+	return models.Schema{ClassName: classname}, nil
+}
+
+// GetSchemas retrieves the class names of all schemas in the database.
+func (b *BoltVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
+	var result []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			result = append(result, string(name))
+			return nil
+		})
+	})
+	return result, err
+}
+
+// CreateSchema creates a new schema for storing documents with the given class name. The dimensions of
+// the embeddings are defined by the first stored document.
+func (b *BoltVectorDb) CreateSchema(ctx context.Context, schema models.Schema) error {
+	if err := vdbutil.ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket([]byte(schema.ClassName)); err != nil {
+			if errors.Is(err, bolt.ErrBucketExists) {
+				return vectordb.ErrSchemaExists
+			}
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteSchema deletes a schema from the database.
+func (b *BoltVectorDb) DeleteSchema(ctx context.Context, classname string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(classname)); err != nil {
+			if errors.Is(err, bolt.ErrBucketNotFound) {
+				return vectordb.ErrSchemaNotExists
+			}
+			return fmt.Errorf("failed to delete schema: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteSchemas deletes multiple schemas from the database.
+func (b *BoltVectorDb) DeleteSchemas(ctx context.Context, classnames []string) error {
+	for _, classname := range classnames {
+		b.DeleteSchema(ctx, classname)
+	}
+	return nil
+}
+
+// AddDocument adds a document with the given class name and ID to the database.
+func (b *BoltVectorDb) AddDocument(ctx context.Context, classname, id string, document models.Document) error {
+	document.ID = id
+	return b.AddDocuments(ctx, classname, []models.Document{document})
+}
+
+// AddDocuments adds multiple documents to the database in a single transaction.
+func (b *BoltVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(classname))
+		if bucket == nil {
+			return vectordb.ErrSchemaNotExists
+		}
+
+		dimensions, err := bucketDimensions(bucket)
+		if err != nil {
+			return err
+		}
+		if _, err := vdbutil.CheckDimensions(dimensions, documents); err != nil {
+			return err
+		}
+
+		for _, document := range documents {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			value, err := json.Marshal(record{
+				Metadata:   document.Metadata,
+				Embeddings: b.NormalizeVector(document.Embeddings),
+				Content:    document.Content,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to serialize document: %w", err)
+			}
+			if err := bucket.Put([]byte(document.ID), value); err != nil {
+				return fmt.Errorf("failed to add document: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateDocument updates a document with the given class name and ID in the database.
+func (b *BoltVectorDb) UpdateDocument(ctx context.Context, classname, id string, document models.Document) error {
+	return b.AddDocument(ctx, classname, id, document)
+}
+
+// UpdateDocuments updates multiple documents in the database.
+func (b *BoltVectorDb) UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	return b.AddDocuments(ctx, classname, documents)
+}
+
+// QueryDocuments queries documents based on a vector and QueryOptions
+func (b *BoltVectorDb) QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	queryVector := b.NormalizeVector(append([]float32(nil), vector...))
+
+	output := []models.Document{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(classname))
+		if bucket == nil {
+			return vectordb.ErrSchemaNotExists
+		}
+
+		dimensions, err := bucketDimensions(bucket)
+		if err != nil {
+			return err
+		}
+		if err := vdbutil.CheckVector(dimensions, vector); err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(key, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var stored record
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return fmt.Errorf("failed to deserialize document %s: %w", key, err)
+			}
+			if queryOptions.Filter != nil && !vdbutil.MatchesFilter(stored.Metadata, queryOptions.Filter) {
+				return nil
+			}
+
+			output = append(output, models.Document{
+				ID:         string(key),
+				ClassName:  classname,
+				Score:      vdbutil.CosineSimilarity(queryVector, stored.Embeddings),
+				Embeddings: stored.Embeddings,
+				Metadata:   stored.Metadata,
+				Content:    stored.Content,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vdbutil.Rank(output, queryOptions), nil
+}
+
+// GetDocument retrieves a document by its ID.
+func (b *BoltVectorDb) GetDocument(ctx context.Context, classname, id string) (models.Document, error) {
+	var document models.Document
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(classname))
+		if bucket == nil {
+			return vectordb.ErrSchemaNotExists
+		}
+
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return vectordb.ErrDocumentNotExists
+		}
+
+		var stored record
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return fmt.Errorf("failed to deserialize document %s: %w", id, err)
+		}
+		document = models.Document{
+			ID:         id,
+			ClassName:  classname,
+			Embeddings: stored.Embeddings,
+			Metadata:   stored.Metadata,
+			Content:    stored.Content,
+		}
+		return nil
+	})
+	return document, err
+}
+
+// ListDocuments lists the documents of a schema in ascending ID order.
+func (b *BoltVectorDb) ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	return vdbutil.List(ctx, b, classname, listOptions)
+}
+
+// ScanDocuments implements vectordb.Scanner.
+func (b *BoltVectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(classname))
+		if bucket == nil {
+			return vectordb.ErrSchemaNotExists
+		}
+
+		cursor := bucket.Cursor()
+		key, value := cursor.Seek([]byte(after))
+		if key != nil && string(key) == after {
+			key, value = cursor.Next()
+		}
+		for ; key != nil; key, value = cursor.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var stored record
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return fmt.Errorf("failed to deserialize document %s: %w", key, err)
+			}
+			if err := fn(models.Document{
+				ID:         string(key),
+				ClassName:  classname,
+				Embeddings: stored.Embeddings,
+				Metadata:   stored.Metadata,
+				Content:    stored.Content,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteDocument deletes a document from the database.
+func (b *BoltVectorDb) DeleteDocument(ctx context.Context, classname, id string) error {
+	return b.DeleteDocuments(ctx, classname, []string{id})
+}
+
+// DeleteDocuments deletes multiple documents from the database.
+func (b *BoltVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(classname))
+		if bucket == nil {
+			return vectordb.ErrSchemaNotExists
+		}
+
+		for _, id := range ids {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return fmt.Errorf("failed to delete document %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// bucketDimensions returns the number of dimensions of the first document of a bucket, or 0 for an
+// empty bucket.
+func bucketDimensions(bucket *bolt.Bucket) (int, error) {
+	key, value := bucket.Cursor().First()
+	if key == nil {
+		return 0, nil
+	}
+
+	var stored record
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return 0, fmt.Errorf("failed to deserialize document %s: %w", key, err)
+	}
+	return len(stored.Embeddings), nil
+}
+
+// NormalizeVector normalizes a vector if required.
+func (b *BoltVectorDb) NormalizeVector(vector []float32) []float32 {
+	if !b.normalizeVector {
+		return vector
+	}
+	return vdbutil.Normalize(vector)
+}
@@ -0,0 +1,70 @@
+package boltvdb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/boltvdb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestBoltVectorDb(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vectors.db")
+
+	db, err := boltvdb.NewBoltVectorDb(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "docs"}); err == nil {
+		t.Error("expected error for existing schema")
+	}
+
+	err = db.AddDocuments(ctx, "docs", []models.Document{
+		{ID: "a", Embeddings: []float32{1, 0}, Metadata: map[string]any{"lang": "en"}},
+		{ID: "b", Embeddings: []float32{0.8, 0.6}, Metadata: map[string]any{"lang": "de"}},
+		{ID: "c", Embeddings: []float32{0, 1}, Metadata: map[string]any{"lang": "en"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	results, _ = db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Filter: map[string]any{"lang": "en"}, SimilarityThreshold: 0.5})
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("unexpected filtered results %+v", results)
+	}
+
+	if err := db.DeleteDocument(ctx, "docs", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = boltvdb.NewBoltVectorDb(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schemas, _ := db.GetSchemas(ctx)
+	if len(schemas) != 1 || schemas[0] != "docs" {
+		t.Errorf("unexpected schemas %v", schemas)
+	}
+	results, _ = db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{})
+	if len(results) != 2 || results[0].ID != "b" {
+		t.Errorf("unexpected results after reopen %+v", results)
+	}
+}
@@ -0,0 +1,190 @@
+// Request and response structs for the Cohere v2 API
+
+package cohere
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ChatRequest represents the request payload for the /v2/chat endpoint.
+type ChatRequest struct {
+	Model    string            `json:"model"`
+	Messages []ChatMessage     `json:"messages"`
+	Stream   bool              `json:"stream"`
+	Tools    []models.Function `json:"tools,omitempty"`
+}
+
+// ChatMessage represents a message in the chat. Content is either a string or a list of ContentItems.
+type ChatMessage struct {
+	Role       string     `json:"role"`
+	Content    any        `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ContentItem represents a single text or image part of a message.
+type ContentItem struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image, usually as data uri.
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// ToolCall represents a tool call requested by the model.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the name and JSON encoded arguments of a tool call.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// TransformToModel converts the tool call into the generic representation.
+func (toolCall ToolCall) TransformToModel() (models.ToolCall, error) {
+	var arguments map[string]any
+	if toolCall.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); err != nil {
+			return models.ToolCall{}, err
+		}
+	}
+	return models.ToolCall{ID: toolCall.ID, Payload: models.FunctionPayload{FunctionName: toolCall.Function.Name, Arguments: arguments}}, nil
+}
+
+// newToolCall converts a tool call into the format of the API, which expects the arguments as JSON string.
+func newToolCall(toolCall models.ToolCall) (ToolCall, error) {
+	arguments := []byte("{}")
+	if toolCall.Payload.Arguments != nil {
+		var err error
+		if arguments, err = json.Marshal(toolCall.Payload.Arguments); err != nil {
+			return ToolCall{}, err
+		}
+	}
+	return ToolCall{
+		ID:       toolCall.ID,
+		Type:     string(models.TypeFunction),
+		Function: FunctionCall{Name: toolCall.Payload.FunctionName, Arguments: string(arguments)},
+	}, nil
+}
+
+// ChatResponse represents the response of the /v2/chat endpoint.
+type ChatResponse struct {
+	ID           string          `json:"id"`
+	FinishReason string          `json:"finish_reason"`
+	Message      ResponseMessage `json:"message"`
+	Usage        Usage           `json:"usage"`
+}
+
+// ResponseMessage represents the message generated by the model.
+type ResponseMessage struct {
+	Role      string        `json:"role"`
+	Content   []ContentItem `json:"content"`
+	ToolCalls []ToolCall    `json:"tool_calls"`
+}
+
+// Text concatenates the text parts of the message.
+func (message ResponseMessage) Text() string {
+	var text string
+	for _, item := range message.Content {
+		if item.Type == "text" {
+			text += item.Text
+		}
+	}
+	return text
+}
+
+// Usage reports the billed tokens of a request.
+type Usage struct {
+	BilledUnits struct {
+		InputTokens  float64 `json:"input_tokens"`
+		OutputTokens float64 `json:"output_tokens"`
+	} `json:"billed_units"`
+}
+
+// toModel converts the billed tokens into the usage of a message.
+func (usage Usage) toModel() *models.Usage {
+	input, output := int(usage.BilledUnits.InputTokens), int(usage.BilledUnits.OutputTokens)
+	if input == 0 && output == 0 {
+		return nil
+	}
+	return &models.Usage{PromptTokens: input, CompletionTokens: output, TotalTokens: input + output}
+}
+
+// finishReason maps a finish reason of the api, e.g. COMPLETE or MAX_TOKENS, to models.FinishReason.
+func finishReason(reason string) models.FinishReason {
+	switch reason {
+	case "":
+		return ""
+	case "COMPLETE", "STOP_SEQUENCE":
+		return models.FinishStop
+	case "MAX_TOKENS":
+		return models.FinishLength
+	case "TOOL_CALL":
+		return models.FinishToolCalls
+	}
+	return models.FinishReason(strings.ToLower(reason))
+}
+
+// StreamEvent represents a single event of a streamed chat response.
+type StreamEvent struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"` // Set on message-start
+	Index int    `json:"index"`
+	Delta struct {
+		FinishReason string `json:"finish_reason"`
+		Usage        *Usage `json:"usage,omitempty"` // Set on message-end
+		Message      struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			ToolCalls ToolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"delta"`
+}
+
+// EmbedRequest represents the request payload for the /v2/embed endpoint.
+type EmbedRequest struct {
+	Model          string   `json:"model"`
+	Texts          []string `json:"texts"`
+	InputType      string   `json:"input_type"`
+	EmbeddingTypes []string `json:"embedding_types"`
+}
+
+// EmbedResponse represents the response of the /v2/embed endpoint.
+type EmbedResponse struct {
+	ID         string `json:"id"`
+	Embeddings struct {
+		Float [][]float32 `json:"float"`
+	} `json:"embeddings"`
+}
+
+// RerankRequest represents the request payload for the /v2/rerank endpoint.
+type RerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+// RerankResponse represents the response of the /v2/rerank endpoint.
+type RerankResponse struct {
+	ID      string                `json:"id"`
+	Results []models.RerankResult `json:"results"`
+}
+
+// ModelsResponse represents the response of the /v1/models endpoint.
+type ModelsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
@@ -0,0 +1,115 @@
+package cohere_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/cohere"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/rag/rerank"
+)
+
+func TestCohereChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request cohere.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !request.Stream {
+			t.Errorf("unexpected request %+v, error %v", request, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message-start\ndata: {\"type\":\"message-start\"}\n\n")
+		fmt.Fprint(w, "event: content-delta\ndata: {\"type\":\"content-delta\",\"delta\":{\"message\":{\"content\":{\"text\":\"Hello\"}}}}\n\n")
+		fmt.Fprint(w, "event: content-delta\ndata: {\"type\":\"content-delta\",\"delta\":{\"message\":{\"content\":{\"text\":\" there\"}}}}\n\n")
+		fmt.Fprint(w, "event: message-end\ndata: {\"type\":\"message-end\",\"delta\":{\"finish_reason\":\"COMPLETE\"}}\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.Cohere, "key", "command-r-plus", "command-r-plus", "embed-v4.0")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	var chunks int
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, true, func(m models.Message) error {
+		chunks++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if result.Content != "Hello there" || chunks != 2 {
+		t.Errorf("unexpected result %q after %d chunks", result.Content, chunks)
+	}
+	if len(companion.GetConversation()) != 2 {
+		t.Errorf("expected 2 messages in conversation, got %d", len(companion.GetConversation()))
+	}
+}
+
+func TestCohereRerank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request cohere.RerankRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatal(err)
+		}
+		if request.Model != aicompanion.DefaultCohereRerankModel || len(request.Documents) != 3 || request.TopN != 2 {
+			t.Errorf("unexpected request %+v", request)
+		}
+		fmt.Fprint(w, `{"results":[{"index":2,"relevance_score":0.9},{"index":0,"relevance_score":0.4}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.Cohere, "key", "command-r-plus", "command-r-plus", "embed-v4.0")
+	config.ApiEndpoints.ApiRerankURL = server.URL
+	companion := aicompanion.NewCompanion(*config).(*cohere.Companion)
+
+	documents := []models.Document{
+		{ID: "a", Metadata: map[string]any{"text": "apples"}},
+		{ID: "b", Metadata: map[string]any{"text": "bananas"}},
+		{ID: "c", Metadata: map[string]any{"text": "cherries"}},
+	}
+
+	reranked, err := rerank.Documents(context.Background(), companion, "red fruit", documents, "", 2)
+	if err != nil {
+		t.Fatalf("rerank failed: %v", err)
+	}
+	if len(reranked) != 2 || reranked[0].ID != "c" || reranked[0].Score != 0.9 || reranked[1].ID != "a" {
+		t.Errorf("unexpected reranked documents %+v", reranked)
+	}
+}
+
+func TestCohereToolMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request cohere.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if len(request.Messages) != 5 {
+			t.Fatalf("unexpected messages %+v", request.Messages)
+		}
+		call, result := request.Messages[2], request.Messages[3]
+		if len(call.ToolCalls) != 1 || call.ToolCalls[0].ID != "call_1" || call.ToolCalls[0].Function.Arguments != `{"city":"Berlin"}` {
+			t.Errorf("unexpected tool call message %+v", call)
+		}
+		if result.Role != "tool" || result.ToolCallID != "call_1" || result.Content != "sunny" {
+			t.Errorf("unexpected tool result message %+v", result)
+		}
+		fmt.Fprint(w, `{"id":"1","finish_reason":"COMPLETE","message":{"role":"assistant","content":[{"type":"text","text":"It is sunny."}]}}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.Cohere, "key", "command-r-plus", "command-r-plus", "embed-v4.0")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+	companion.SetConversation([]models.Message{
+		{Role: models.User, Content: "Weather in Berlin?"},
+		{Role: models.Assistant, ToolCalls: []models.ToolCall{{ID: "call_1", Payload: models.FunctionPayload{FunctionName: "weather", Arguments: map[string]any{"city": "Berlin"}}}}},
+		{Role: models.ToolRole, Content: "sunny", ToolCallID: "call_1", Name: "weather"},
+	})
+
+	if _, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "And now?"}}, false, nil); err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+}
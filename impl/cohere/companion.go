@@ -0,0 +1,715 @@
+package cohere
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/terminal"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// embedding input types
+const (
+	InputTypeDocument = "search_document"
+	InputTypeQuery    = "search_query"
+)
+
+// Companion represents the AI companion with its configuration, conversation history, and HTTP client.
+type Companion struct {
+	Config       models.Configuration
+	SystemRole   models.Message
+	Conversation []models.Message
+	HttpClient   *http.Client
+	VectorDb     vectordb.VectorDb          // Source of the context of RAG requests
+	Sessions     conversationstore.Sessions // Named conversations, see SwitchSession
+	ToolRegistry *tools.Registry            // Tools implemented by Go functions, run before Tool endpoints
+	ToolBreakers sidekick.CircuitBreakers   // Circuit breakers of the tools, see models.ToolConfiguration
+	Usage        sidekick.UsageCounter      // Tokens of the responses, see GetUsage
+	OnToolCall   models.ToolCallHook        // Asked before a tool is run, if set
+	// EmbedInputType is sent with embedding requests, defaults to InputTypeDocument.
+	EmbedInputType string
+}
+
+// SetEnrichmentPrompt sets a new enrichment prompt for the companion.
+func (companion *Companion) SetEnrichmentPrompt(enrichmentprompt string) {
+	companion.Config.ActivePersona.Prompt.EnrichmentPrompt = enrichmentprompt
+}
+
+// GetEnrichmentPrompt returns the current enrichment prompt of the companion.
+func (companion *Companion) GetEnrichmentPrompt() string {
+	return companion.Config.ActivePersona.Prompt.EnrichmentPrompt
+}
+
+// SetSummarizationPrompt sets a new summarization prompt for the companion.
+func (companion *Companion) SetSummarizationPrompt(summarizationprompt string) {
+	companion.Config.ActivePersona.Prompt.SummarizationPrompt = summarizationprompt
+}
+
+// GetSummarizationPrompt returns the current summarization prompt of the companion.
+func (companion *Companion) GetSummarizationPrompt() string {
+	return companion.Config.ActivePersona.Prompt.SummarizationPrompt
+}
+
+// GetConfig returns the current configuration of the companion.
+func (companion *Companion) GetConfig() models.Configuration {
+	return companion.Config
+}
+
+// SetConfig sets a new configuration for the companion.
+func (companion *Companion) SetConfig(config models.Configuration) {
+	companion.Config = config
+	companion.SetSystemRole(config.ActivePersona.Prompt.SystemPrompt)
+}
+
+// GetSystemRole returns the current system role of the companion.
+func (companion *Companion) GetSystemRole() models.Message {
+	return companion.SystemRole
+}
+
+// SetSystemRole sets a new system role for the companion.
+func (companion *Companion) SetSystemRole(prompt string) {
+	companion.SystemRole = models.Message{
+		Role:    models.System,
+		Content: prompt,
+	}
+}
+
+// GetConversation returns the current conversation history of the companion.
+func (companion *Companion) GetConversation() []models.Message {
+	return companion.Conversation
+}
+
+// SetConversation sets a new conversation history for the companion.
+func (companion *Companion) SetConversation(conversation []models.Message) {
+	companion.Conversation = conversation
+}
+
+// PinMessage pins or unpins the message of the conversation at index. Pinned messages are always sent
+// along with requests, regardless of Config.MaxMessages and Config.MaxContextTokens.
+func (companion *Companion) PinMessage(index int, pinned bool) error {
+	return sideKick.PinMessage(companion.Conversation, index, pinned)
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (companion *Companion) PinMessageByID(id string, pinned bool) error {
+	return sideKick.PinMessageByID(companion.Conversation, id, pinned)
+}
+
+// RemoveLastExchange removes the last user message and all messages following it, such as the reply and
+// tool results, and returns them. It rolls back a turn that was aborted or failed, e.g. by a stream that
+// errored mid-way. A conversation without user messages is left unchanged.
+func (companion *Companion) RemoveLastExchange() []models.Message {
+	var removed []models.Message
+	companion.Conversation, removed = sideKick.RemoveLastExchange(companion.Conversation)
+	return removed
+}
+
+// TruncateAfter removes the messages following index from the conversation. An index of -1 removes all
+// messages.
+func (companion *Companion) TruncateAfter(index int) error {
+	conversation, err := sideKick.TruncateAfter(companion.Conversation, index)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ExportConversation writes the conversation as transcript in the given format. Images of Markdown
+// transcripts are written to Config.ImageDir. The transcript is encrypted if Config.EncryptionKey is set.
+func (companion *Companion) ExportConversation(w io.Writer, format models.ConversationFormat) error {
+	return sideKick.ExportConversation(w, companion.Conversation, format, companion.Config.ImageDir, companion.Config.EncryptionKey)
+}
+
+// ImportConversation replaces the conversation with a JSON or Markdown transcript, which is decrypted
+// with Config.EncryptionKey if it is encrypted.
+func (companion *Companion) ImportConversation(r io.Reader) error {
+	conversation, err := sideKick.ImportConversation(r, companion.Config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// SetConversationStore sets the store keeping the conversations of the sessions that are not current.
+func (companion *Companion) SetConversationStore(store conversationstore.Store) {
+	companion.Sessions.Store = store
+}
+
+// CurrentSession returns the name of the current session.
+func (companion *Companion) CurrentSession() string {
+	return companion.Sessions.Current()
+}
+
+// SwitchSession saves the conversation under the current session and continues the named session.
+func (companion *Companion) SwitchSession(name string) error {
+	conversation, err := companion.Sessions.Switch(name, companion.Conversation)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ListSessions returns the names of all sessions.
+func (companion *Companion) ListSessions() ([]string, error) {
+	return companion.Sessions.List()
+}
+
+// SearchSessions saves the conversation under the current session and searches the messages of all
+// sessions. The conversation store has to implement conversationstore.Searcher.
+func (companion *Companion) SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error) {
+	return companion.Sessions.Search(companion.Conversation, query, limit)
+}
+
+// DeleteSession deletes the named session. Deleting the current session clears the conversation.
+func (companion *Companion) DeleteSession(name string) error {
+	current, err := companion.Sessions.Delete(name)
+	if err != nil {
+		return err
+	}
+	if current {
+		companion.Conversation = make([]models.Message, 0)
+	}
+	return nil
+}
+
+// GetUsage returns the tokens of the responses of the companion, in total, per session and per model.
+func (companion *Companion) GetUsage() models.UsageReport {
+	return companion.Usage.Report()
+}
+
+// recordUsage adds the usage of a response to the current session and sets its estimated cost.
+func (companion *Companion) recordUsage(response *models.Message) {
+	model := response.Model
+	if model == "" {
+		model = companion.Config.AiModels.ChatModel.Model
+	}
+	response.Cost = sidekick.CostEstimator{Pricing: companion.Config.Pricing}.Estimate(model, response.Usage)
+	companion.Usage.Record(companion.Sessions.Current(), model, response.Usage, response.Cost)
+}
+
+// GetHttpClient returns the HTTP client used by the companion.
+func (companion *Companion) GetHttpClient() *http.Client {
+	return companion.HttpClient
+}
+
+// SetHttpClient sets a new HTTP client for the companion.
+func (companion *Companion) SetHttpClient(client *http.Client) {
+	companion.HttpClient = client
+}
+
+// SetVectorDB sets the vector database used by SendRAGRequest.
+func (companion *Companion) SetVectorDB(vectorDb vectordb.VectorDb) {
+	companion.VectorDb = vectorDb
+}
+
+// GetVectorDB returns the vector database used by SendRAGRequest.
+func (companion *Companion) GetVectorDB() vectordb.VectorDb {
+	return companion.VectorDb
+}
+
+// PrepareConversation prepares the conversation by appending system role and current conversation messages.
+func (companion *Companion) PrepareConversation(message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	return companion.prepareConversation(context.Background(), message, includeStrategy)
+}
+
+// prepareConversation is PrepareConversation for a request, which cancels summarizing the history with ctx.
+func (companion *Companion) prepareConversation(ctx context.Context, message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	systemRole := companion.SystemRole
+	history := sideKick.SelectContext(companion.Config.ContextStrategy, sidekick.ContextRequest{
+		Context:         ctx,
+		Conversation:    companion.Conversation,
+		IncludeStrategy: includeStrategy,
+		MaxMessages:     companion.Config.MaxMessages,
+		MaxTokens:       companion.Config.MaxContextTokens,
+		Reserved:        []models.Message{systemRole, message},
+		Summarize:       sideKick.NewSummarizer(companion.SendGenerateRequest),
+	})
+
+	messages := append([]models.Message{systemRole}, history...)
+	messages = append(messages, message)
+
+	return messages
+}
+
+// AddMessage adds the given message to the conversation history.
+func (companion *Companion) AddMessage(message models.Message) {
+	companion.Conversation = append(companion.Conversation, sideKick.StampMessage(message))
+}
+
+// SendModerationRequest is not supported by Cohere.
+func (companion *Companion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+	return models.ModerationResponse{}, errors.New("unsupported")
+}
+
+// SendEmbeddingRequest sends an embedding request to the Cohere embed API.
+func (companion *Companion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+	inputType := companion.EmbedInputType
+	if inputType == "" {
+		inputType = InputTypeDocument
+	}
+
+	payload := EmbedRequest{
+		Model:          embedding.Model,
+		Texts:          embedding.Input,
+		InputType:      inputType,
+		EmbeddingTypes: []string{"float"},
+	}
+
+	var originalResponse EmbedResponse
+	if err := companion.post(ctx, "SendEmbeddingRequest", companion.Config.ApiEndpoints.ApiEmbedURL, payload, &originalResponse); err != nil {
+		return models.EmbeddingResponse{}, err
+	}
+
+	return models.EmbeddingResponse{
+		Model:            embedding.Model,
+		Embeddings:       originalResponse.Embeddings.Float,
+		OriginalResponse: originalResponse,
+	}, nil
+}
+
+// Rerank orders documents by their relevance to a query using the configured rerank model.
+// It implements the reranker.Reranker interface.
+func (companion *Companion) Rerank(ctx context.Context, query string, documents []string, topN int) ([]models.RerankResult, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	payload := RerankRequest{
+		Model:     companion.Config.AiModels.RerankModel.Model,
+		Query:     query,
+		Documents: documents,
+		TopN:      topN,
+	}
+
+	var originalResponse RerankResponse
+	if err := companion.post(ctx, "Rerank", companion.Config.ApiEndpoints.ApiRerankURL, payload, &originalResponse); err != nil {
+		return nil, err
+	}
+
+	return originalResponse.Results, nil
+}
+
+// SendGenerateRequest sends a single message without conversation history, using the alternate prompt
+// as system prompt if set, and else the system prompt or persona of the request.
+func (companion *Companion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	system, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	if len(message.Message.AlternatePrompt) > 0 {
+		system = sideKick.CreateMessage(models.System, message.Message.AlternatePrompt)
+	}
+
+	return companion.sendChat(ctx, []models.Message{system, message.Message}, message.Tools, streaming, callback)
+}
+
+// SendRAGRequest retrieves documents matching the message from the vector database, adds them as context
+// using the enrichment prompt and sends the result as chat request. The conversation keeps the original message.
+func (companion *Companion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request, err := sideKick.PrepareRAGRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message, options)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	return companion.SendChatRequest(ctx, request, streaming, callback)
+}
+
+// SendChatRequest sends the message along with the conversation history and adds the exchange to the conversation.
+func (companion *Companion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	if companion.Config.Moderation.Enabled {
+		err := errors.New("moderation is not supported by cohere")
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	if companion.Config.ActivePersona.UseKnowledge {
+		enriched, err := sideKick.PrepareKnowledgeRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message)
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		message = enriched
+	}
+
+	// the system prompt or persona of the request replaces the system role for this request only
+	systemRole, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	messages := companion.prepareConversation(ctx, message.Message, companion.Config.IncludeStrategy)
+	messages[0] = systemRole
+	result, err := companion.sendChat(ctx, messages, message.Tools, streaming, callback)
+	if err != nil {
+		return result, err
+	}
+
+	switch message.RetainOriginalMessage {
+	case true:
+		companion.AddMessage(message.OriginalMessage)
+	case false:
+		companion.AddMessage(message.Message)
+	}
+	companion.AddMessage(result)
+
+	return result, nil
+}
+
+// SendToolRequest sends a single message with tools and returns the response including tool calls.
+func (companion *Companion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	return companion.sendChat(ctx, []models.Message{message.Message}, message.Tools, false, nil)
+}
+
+// sendChat sends messages to the chat API.
+func (companion *Companion) sendChat(ctx context.Context, messages []models.Message, tools []models.Function, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	converted, err := convertMessages(messages)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	payload := ChatRequest{
+		Model:    companion.Config.AiModels.ChatModel.Model,
+		Messages: converted,
+		Stream:   streaming,
+		Tools:    tools,
+	}
+
+	if !streaming {
+		var originalResponse ChatResponse
+		if err := companion.post(ctx, "sendChat", companion.Config.ApiEndpoints.ApiChatURL, payload, &originalResponse); err != nil {
+			return models.Message{}, err
+		}
+
+		var toolCalls []models.ToolCall
+		for _, toolCall := range originalResponse.Message.ToolCalls {
+			genericToolCall, err := toolCall.TransformToModel()
+			if err != nil {
+				sideKick.Error(err)
+				return models.Message{}, err
+			}
+			toolCalls = append(toolCalls, genericToolCall)
+		}
+
+		result := sideKick.CreateAssistantMessage(originalResponse.Message.Text())
+		result.ToolCalls = toolCalls
+		result.Info = &models.ResponseInfo{Provider: models.Cohere, Model: payload.Model}
+		result.ID = originalResponse.ID
+		result.Model = payload.Model
+		result.Usage = originalResponse.Usage.toModel()
+		result.FinishReason = finishReason(originalResponse.FinishReason)
+		companion.recordUsage(&result)
+		return result, nil
+	}
+
+	resp, err := companion.send(ctx, "sendChat", companion.Config.ApiEndpoints.ApiChatURL, payload)
+	if err != nil {
+		return models.Message{}, err
+	}
+	result, err := companion.HandleStreamResponse(ctx, resp, models.Chat, callback)
+	if err == nil {
+		companion.recordUsage(&result)
+	}
+	return result, err
+}
+
+// HandleStreamResponse handles the server-sent events of a streamed chat response. Each content delta is
+// passed on with the next event, so the last one carries the model, usage and finish reason. If the stream
+// is cancelled, by ctx or an error of callback, the message received until then is returned with Cancelled set.
+func (companion *Companion) HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	var message strings.Builder
+	var toolCalls []ToolCall
+	var id string
+	var usage *models.Usage
+	var finish models.FinishReason
+	var pending *models.Message // last content chunk, passed on with the metadata of the response
+
+	// partial returns the message received until the stream was cancelled
+	partial := func() models.Message {
+		cancelled := sideKick.CreateAssistantMessage(message.String())
+		cancelled.ID = id
+		cancelled.Model = companion.Config.AiModels.ChatModel.Model
+		cancelled.Cancelled = true
+		return cancelled
+	}
+
+	sideKick.Print("> ", companion.Config.Terminal)
+
+	decoder := sidekick.NewSSEDecoderSize(resp.Body, companion.Config.HttpConfig.MaxLineSize)
+	for {
+		// stop reading once the request is cancelled
+		if err := ctx.Err(); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+		frame, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && ctx.Err() != nil {
+			sideKick.Error(ctx.Err())
+			return partial(), ctx.Err()
+		}
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		sideKick.Trace(fmt.Sprintf("HandleStreamResponse: event %s: %s", frame.Event, frame.Data), companion.Config.Terminal)
+
+		var event StreamEvent
+		if err := json.Unmarshal([]byte(frame.Data), &event); err != nil {
+			err = fmt.Errorf("failed to unmarshal event: %s, error: %w", frame.Data, err)
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+
+		switch event.Type {
+		case "message-start":
+			id = event.ID
+		case "content-delta":
+			text := event.Delta.Message.Content.Text
+			message.WriteString(text)
+			sideKick.Print(text, companion.Config.Terminal)
+			if callback != nil && pending != nil {
+				if err := callback(*pending); err != nil {
+					sideKick.Error(err)
+					return partial(), err
+				}
+			}
+			chunk := sideKick.CreateAssistantMessage(text)
+			pending = &chunk
+		case "tool-call-start":
+			toolCalls = append(toolCalls, event.Delta.Message.ToolCalls)
+		case "tool-call-delta":
+			if len(toolCalls) > 0 {
+				toolCalls[len(toolCalls)-1].Function.Arguments += event.Delta.Message.ToolCalls.Function.Arguments
+			}
+		}
+
+		if event.Type == "message-end" {
+			if event.Delta.Usage != nil {
+				usage = event.Delta.Usage.toModel()
+			}
+			finish = finishReason(event.Delta.FinishReason)
+			break
+		}
+	}
+
+	sideKick.Println("", companion.Config.Terminal)
+
+	result := sideKick.CreateAssistantMessage(message.String())
+	for _, toolCall := range toolCalls {
+		genericToolCall, err := toolCall.TransformToModel()
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		result.ToolCalls = append(result.ToolCalls, genericToolCall)
+	}
+	result.Info = &models.ResponseInfo{Provider: models.Cohere, Model: companion.Config.AiModels.ChatModel.Model}
+	result.ID = id
+	result.Model = companion.Config.AiModels.ChatModel.Model
+	result.Usage = usage
+	result.FinishReason = finish
+
+	// the last chunk carries the model, usage and finish reason of the response
+	if callback != nil {
+		if pending == nil {
+			final := sideKick.CreateAssistantMessage("")
+			pending = &final
+		}
+		pending.ID = result.ID
+		pending.Model = result.Model
+		pending.Usage = result.Usage
+		pending.Info = result.Info
+		pending.FinishReason = result.FinishReason
+		if err := callback(*pending); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+	}
+
+	return result, nil
+}
+
+// GetModels retrieves a list of available models from the API.
+func (companion *Companion) GetModels(ctx context.Context) ([]models.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, companion.Config.ApiEndpoints.ApiModelsURL, nil)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+
+	var originalResponse ModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&originalResponse); err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+
+	var transformedModels []models.Model
+	for _, model := range originalResponse.Models {
+		transformedModels = append(transformedModels, models.Model{Model: model.Name, Name: model.Name})
+	}
+
+	return transformedModels, nil
+}
+
+// SetOnToolCall sets the hook asked before a tool is run, nil to run tools without asking.
+func (companion *Companion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.OnToolCall = hook
+}
+
+// SetToolRegistry sets the registry of tools implemented by Go functions.
+func (companion *Companion) SetToolRegistry(registry *tools.Registry) {
+	companion.ToolRegistry = registry
+}
+
+// RunFunction runs a function with the handler registered in the tool registry or, if there is none, by
+// sending the payload to the endpoint of the tool, with the timeout, retries and circuit breaker of
+// Config.ToolConfig.
+func (companion *Companion) RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	return sideKick.RunTool(ctx, sidekick.ToolRuntime{
+		HttpClient: companion.HttpClient,
+		Registry:   companion.ToolRegistry,
+		Config:     companion.Config.ToolConfig,
+		Breakers:   &companion.ToolBreakers,
+		OnToolCall: companion.OnToolCall,
+		Terminal:   companion.Config.Terminal,
+	}, tool, models.ToolCall{Payload: payload})
+}
+
+// post sends a JSON request with the given context and decodes the JSON response into target.
+func (companion *Companion) post(ctx context.Context, caller, url string, payload any, target any) error {
+	var cancel context.CancelFunc
+	if companion.Config.Terminal.Output {
+		var spinnerCtx context.Context
+		spinnerCtx, cancel = context.WithCancel(ctx)
+		cs := terminal.NewSpinningCharacter('?', 100, 10)
+		cs.StartSpinning(spinnerCtx)
+		defer cancel()
+	}
+
+	resp, err := companion.send(ctx, caller, url, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if companion.Config.Terminal.Output {
+		cancel()
+		sideKick.ClearLine(companion.Config.Terminal)
+	}
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return err
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sideKick.Error(err)
+		return err
+	}
+	sideKick.Trace(fmt.Sprintf("%s: responseBytes %s", caller, string(responseBytes)), companion.Config.Terminal)
+
+	if err := json.Unmarshal(responseBytes, target); err != nil {
+		sideKick.Error(err)
+		return err
+	}
+	return nil
+}
+
+// send marshals the payload and executes the request. The caller must close the response body.
+func (companion *Companion) send(ctx context.Context, caller, url string, payload any) (*http.Response, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	sideKick.Trace(fmt.Sprintf("%s: payload %s", caller, string(payloadBytes)), companion.Config.Terminal)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	sideKick.Debug(fmt.Sprintf("%s: StatusCode %d, Status %s", caller, resp.StatusCode, resp.Status), companion.Config.Terminal)
+
+	return resp, nil
+}
+
+// convertMessages converts messages into the Cohere format. Images are sent as data uris, and tool results
+// reference the call they answer.
+func convertMessages(messages []models.Message) ([]ChatMessage, error) {
+	converted := make([]ChatMessage, 0, len(messages))
+	for i, message := range messages {
+		if message.Role == models.System && message.Content == "" {
+			continue
+		}
+
+		chatMessage := ChatMessage{Role: string(message.Role), Content: message.Content, ToolCallID: message.ToolCallID}
+		for _, toolCall := range message.ToolCalls {
+			call, err := newToolCall(toolCall)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize tool call of message %d: %w", i, err)
+			}
+			chatMessage.ToolCalls = append(chatMessage.ToolCalls, call)
+		}
+		if message.Images != nil && len(*message.Images) > 0 {
+			items := []ContentItem{{Type: "text", Text: message.Content}}
+			for _, image := range *message.Images {
+				items = append(items, ContentItem{Type: "image_url", ImageURL: &ImageURL{URL: image.DataURI()}})
+			}
+			chatMessage.Content = items
+		}
+
+		converted = append(converted, chatMessage)
+	}
+	return converted, nil
+}
@@ -0,0 +1,9 @@
+//go:build duckdb
+
+package duckvdb_test
+
+// The duckdb build tag registers a DuckDB driver, so that the tests run against a real database:
+//
+//	go get github.com/marcboeker/go-duckdb
+//	go test -tags duckdb ./impl/duckvdb
+import _ "github.com/marcboeker/go-duckdb"
@@ -0,0 +1,513 @@
+// Package duckvdb implements a vector database on DuckDB. Embeddings are stored as fixed size arrays and
+// scored with array_cosine_similarity, which DuckDB evaluates vectorized, so full scans over large document
+// sets are considerably faster than with the SQLite backend. Optionally, an HNSW index of the vss extension
+// speeds up queries further.
+//
+// DuckDB drivers require CGO, so this package doesn't import one. Register a driver under the name "duckdb"
+// in the main package, e.g.
+//
+//	import _ "github.com/marcboeker/go-duckdb"
+package duckvdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var _ vectordb.VectorDb = (*DuckDBVectorDb)(nil)
+var _ vectordb.Scanner = (*DuckDBVectorDb)(nil)
+
+// DriverName is the database/sql driver used by NewDuckDBVectorDb.
+const DriverName = "duckdb"
+
+// DuckDBVectorDb represents a vector database using DuckDB.
+type DuckDBVectorDb struct {
+	db              *sql.DB
+	mutex           sync.RWMutex
+	dimensions      int
+	normalizeVector bool
+	// UseHNSW creates an HNSW index on the embeddings of new schemas. It requires the vss extension.
+	UseHNSW bool
+}
+
+// NewDuckDBVectorDb opens the DuckDB database at dbPath for embeddings with the given number of dimensions.
+// An empty dbPath opens an in-memory database.
+func NewDuckDBVectorDb(dbPath string, dimensions int, normalize bool) (*DuckDBVectorDb, error) {
+	db, err := sql.Open(DriverName, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewDuckDBVectorDbFromDB(db, dimensions, normalize)
+}
+
+// NewDuckDBVectorDbFromDB creates a DuckDB vector database on an open connection.
+func NewDuckDBVectorDbFromDB(db *sql.DB, dimensions int, normalize bool) (*DuckDBVectorDb, error) {
+	if dimensions <= 0 {
+		return nil, errors.New("dimensions must be positive")
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return &DuckDBVectorDb{
+		db:              db,
+		dimensions:      dimensions,
+		normalizeVector: normalize,
+	}, nil
+}
+
+// Close closes the database.
+func (d *DuckDBVectorDb) Close() error {
+	return d.db.Close()
+}
+
+// arrayType returns the column type of the embeddings.
+func (d *DuckDBVectorDb) arrayType() string {
+	return fmt.Sprintf("FLOAT[%d]", d.dimensions)
+}
+
+// schemaExists checks if a schema with the given class name exists in the database.
+func (d *DuckDBVectorDb) schemaExists(ctx context.Context, classname string) (bool, error) {
+	var count int
+	query := `SELECT count(*) FROM information_schema.tables WHERE table_schema = 'main' AND table_name = ?`
+	if err := d.db.QueryRowContext(ctx, query, classname).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// requireSchema returns an error if the schema doesn't exist.
+func (d *DuckDBVectorDb) requireSchema(ctx context.Context, classname string) error {
+	exists, err := d.schemaExists(ctx, classname)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return vectordb.ErrSchemaNotExists
+	}
+	return nil
+}
+
+// GetSchema retrieves the schema for storing documents with the given class name.
+func (d *DuckDBVectorDb) GetSchema(ctx context.Context, classname string) (models.Schema, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return models.Schema{}, err
+	}
+	return models.Schema{
+		ClassName: classname,
+		Vector:    models.VectorConfig{Dimensions: d.dimensions, Distance: models.DistanceCosine},
+	}, nil
+}
+
+// GetSchemas retrieves the class names of all schemas in the database.
+func (d *DuckDBVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	rows, err := d.db.QueryContext(ctx, `SELECT table_name FROM information_schema.tables WHERE table_schema = 'main' ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+	}
+	return result, rows.Err()
+}
+
+// CreateSchema creates a new schema for storing documents with the given class name.
+func (d *DuckDBVectorDb) CreateSchema(ctx context.Context, schema models.Schema) error {
+	if err := vdbutil.ValidateSchema(schema); err != nil {
+		return err
+	}
+	if schema.Vector.Dimensions != 0 && schema.Vector.Dimensions != d.dimensions {
+		return fmt.Errorf("schema has %d dimensions, the database stores %d", schema.Vector.Dimensions, d.dimensions)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	classnameStr := schema.ClassName
+	if exists, err := d.schemaExists(ctx, classnameStr); err != nil {
+		return err
+	} else if exists {
+		return vectordb.ErrSchemaExists
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE %s (
+		id VARCHAR PRIMARY KEY,
+		metadata JSON,
+		embeddings %s,
+		content VARCHAR
+	)`, quote(classnameStr), d.arrayType())
+	if _, err := d.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	if d.UseHNSW {
+		statements := []string{
+			`INSTALL vss`,
+			`LOAD vss`,
+			`SET hnsw_enable_experimental_persistence = true`,
+			fmt.Sprintf(`CREATE INDEX %s ON %s USING HNSW (embeddings) WITH (metric = 'cosine')`, quote(classnameStr+"_hnsw"), quote(classnameStr)),
+		}
+		for _, statement := range statements {
+			if _, err := d.db.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("failed to create hnsw index: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteSchema deletes a schema from the database.
+func (d *DuckDBVectorDb) DeleteSchema(ctx context.Context, classname string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return err
+	}
+	if _, err := d.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s`, quote(classname))); err != nil {
+		return fmt.Errorf("failed to delete schema: %w", err)
+	}
+	return nil
+}
+
+// DeleteSchemas deletes multiple schemas from the database. Every schema is attempted; the errors of
+// those that could not be deleted are joined.
+func (d *DuckDBVectorDb) DeleteSchemas(ctx context.Context, classnames []string) error {
+	var errs []error
+	for _, classname := range classnames {
+		if err := d.DeleteSchema(ctx, classname); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", classname, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddDocument adds a document with the given class name and ID to the database.
+func (d *DuckDBVectorDb) AddDocument(ctx context.Context, classname, id string, document models.Document) error {
+	document.ID = id
+	return d.AddDocuments(ctx, classname, []models.Document{document})
+}
+
+// AddDocuments adds multiple documents to the database in a single transaction.
+func (d *DuckDBVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return err
+	}
+
+	if _, err := vdbutil.CheckDimensions(d.dimensions, documents); err != nil {
+		return err
+	}
+
+	if err := d.deleteReplaced(ctx, classname, documents); err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`INSERT INTO %s (id, metadata, embeddings, content) VALUES (?, ?, CAST(? AS %s), ?)`, quote(classname), d.arrayType())
+	statement, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer statement.Close()
+
+	for _, document := range documents {
+		metadataBytes, err := json.Marshal(document.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metadata: %w", err)
+		}
+
+		if _, err := statement.ExecContext(ctx, document.ID, string(metadataBytes), vectorLiteral(d.NormalizeVector(document.Embeddings)), document.Content); err != nil {
+			return fmt.Errorf("failed to add document: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteReplaced deletes the stored versions of documents. DuckDB can neither update array columns nor
+// insert a key deleted in the same transaction, so documents are replaced by deleting them in a
+// transaction of its own before inserting them again. The caller holds the write lock.
+func (d *DuckDBVectorDb) deleteReplaced(ctx context.Context, classname string, documents []models.Document) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, quote(classname)))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer statement.Close()
+
+	for _, document := range documents {
+		if _, err := statement.ExecContext(ctx, document.ID); err != nil {
+			return fmt.Errorf("failed to replace document: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateDocument updates a document with the given class name and ID in the database.
+func (d *DuckDBVectorDb) UpdateDocument(ctx context.Context, classname, id string, document models.Document) error {
+	return d.AddDocument(ctx, classname, id, document)
+}
+
+// UpdateDocuments updates multiple documents in the database.
+func (d *DuckDBVectorDb) UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	return d.AddDocuments(ctx, classname, documents)
+}
+
+// QueryDocuments queries documents based on a vector and QueryOptions. Scoring, filtering and sorting run
+// inside DuckDB.
+func (d *DuckDBVectorDb) QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return nil, err
+	}
+	if err := vdbutil.CheckVector(d.dimensions, vector); err != nil {
+		return nil, err
+	}
+
+	queryVector := d.NormalizeVector(append([]float32(nil), vector...))
+
+	var conditions []string
+	arguments := []any{vectorLiteral(queryVector)}
+	for key, value := range queryOptions.Filter {
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize filter: %w", err)
+		}
+		conditions = append(conditions, `json_extract(metadata, ?) = CAST(? AS JSON)`)
+		arguments = append(arguments, "$."+strconv.Quote(key), string(valueBytes))
+	}
+	if queryOptions.SimilarityThreshold > 0 {
+		conditions = append(conditions, `score >= ?`)
+		arguments = append(arguments, queryOptions.SimilarityThreshold)
+	}
+
+	query := fmt.Sprintf(`SELECT id, CAST(metadata AS VARCHAR), CAST(embeddings AS VARCHAR), coalesce(content, ''), score FROM (
+		SELECT id, metadata, embeddings, content, array_cosine_similarity(embeddings, CAST(? AS %s)) AS score FROM %s
+	)`, d.arrayType(), quote(classname))
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY score DESC`
+	// hybrid queries rank every matching document, so paging happens after the fusion
+	if queryOptions.Limit > 0 && queryOptions.Hybrid == nil {
+		query += ` LIMIT ` + strconv.Itoa(queryOptions.Limit)
+	}
+	if queryOptions.Offset > 0 && queryOptions.Hybrid == nil {
+		query += ` OFFSET ` + strconv.Itoa(queryOptions.Offset)
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+
+	output := []models.Document{}
+	for rows.Next() {
+		var id, metadataJSON, embeddingsJSON, content string
+		var score sql.NullFloat64
+		if err := rows.Scan(&id, &metadataJSON, &embeddingsJSON, &content, &score); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		var metadata map[string]any
+		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+			return nil, fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+		var embeddings []float32
+		if err := json.Unmarshal([]byte(embeddingsJSON), &embeddings); err != nil {
+			return nil, fmt.Errorf("failed to deserialize embeddings: %w", err)
+		}
+
+		output = append(output, models.Document{
+			ID:         id,
+			ClassName:  classname,
+			Score:      score.Float64,
+			Embeddings: embeddings,
+			Metadata:   metadata,
+			Content:    content,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if queryOptions.Hybrid != nil {
+		return vdbutil.Rank(output, queryOptions), nil
+	}
+	return output, nil
+}
+
+// GetDocument retrieves a document by its ID.
+func (d *DuckDBVectorDb) GetDocument(ctx context.Context, classname, id string) (models.Document, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return models.Document{}, err
+	}
+
+	var metadataJSON, embeddingsJSON, content string
+	query := fmt.Sprintf(`SELECT CAST(metadata AS VARCHAR), CAST(embeddings AS VARCHAR), coalesce(content, '') FROM %s WHERE id = ?`, quote(classname))
+	err := d.db.QueryRowContext(ctx, query, id).Scan(&metadataJSON, &embeddingsJSON, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Document{}, vectordb.ErrDocumentNotExists
+	}
+	if err != nil {
+		return models.Document{}, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+		return models.Document{}, fmt.Errorf("failed to deserialize metadata: %w", err)
+	}
+	var embeddings []float32
+	if err := json.Unmarshal([]byte(embeddingsJSON), &embeddings); err != nil {
+		return models.Document{}, fmt.Errorf("failed to deserialize embeddings: %w", err)
+	}
+
+	return models.Document{
+		ID:         id,
+		ClassName:  classname,
+		Embeddings: embeddings,
+		Metadata:   metadata,
+		Content:    content,
+	}, nil
+}
+
+// ListDocuments lists the documents of a schema in ascending ID order.
+func (d *DuckDBVectorDb) ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	return vdbutil.List(ctx, d, classname, listOptions)
+}
+
+// ScanDocuments implements vectordb.Scanner.
+func (d *DuckDBVectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`SELECT id, CAST(metadata AS VARCHAR), CAST(embeddings AS VARCHAR), coalesce(content, '') FROM %s WHERE id > ? ORDER BY id`, quote(classname))
+	rows, err := d.db.QueryContext(ctx, query, after)
+	if err != nil {
+		return fmt.Errorf("failed to scan documents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, metadataJSON, embeddingsJSON, content string
+		if err := rows.Scan(&id, &metadataJSON, &embeddingsJSON, &content); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		var metadata map[string]any
+		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+			return fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+		var embeddings []float32
+		if err := json.Unmarshal([]byte(embeddingsJSON), &embeddings); err != nil {
+			return fmt.Errorf("failed to deserialize embeddings: %w", err)
+		}
+
+		if err := fn(models.Document{
+			ID:         id,
+			ClassName:  classname,
+			Embeddings: embeddings,
+			Metadata:   metadata,
+			Content:    content,
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteDocument deletes a document from the database.
+func (d *DuckDBVectorDb) DeleteDocument(ctx context.Context, classname, id string) error {
+	return d.DeleteDocuments(ctx, classname, []string{id})
+}
+
+// DeleteDocuments deletes multiple documents from the database.
+func (d *DuckDBVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.requireSchema(ctx, classname); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, quote(classname))
+	for _, id := range ids {
+		if _, err := d.db.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("failed to delete document %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// NormalizeVector normalizes a vector if required.
+func (d *DuckDBVectorDb) NormalizeVector(vector []float32) []float32 {
+	if !d.normalizeVector {
+		return vector
+	}
+	return vdbutil.Normalize(vector)
+}
+
+// quote quotes an identifier.
+func quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+// vectorLiteral formats a vector as array literal, which is cast to the array type in the query.
+func vectorLiteral(vector []float32) string {
+	var builder strings.Builder
+	builder.WriteByte('[')
+	for i, v := range vector {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	builder.WriteByte(']')
+	return builder.String()
+}
@@ -0,0 +1,168 @@
+package duckvdb_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/duckvdb"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// newDb opens an in-memory database for two dimensional embeddings with the schema docs. The test is
+// skipped unless a DuckDB driver is registered, as this package doesn't import one; the duckdb build tag
+// registers one, see driver_test.go.
+func newDb(t *testing.T) *duckvdb.DuckDBVectorDb {
+	t.Helper()
+	if !slices.Contains(sql.Drivers(), duckvdb.DriverName) {
+		t.Skipf("no %s driver registered, run with -tags duckdb", duckvdb.DriverName)
+	}
+
+	db, err := duckvdb.NewDuckDBVectorDb("", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateSchema(context.Background(), models.Schema{ClassName: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNewDuckDBVectorDb(t *testing.T) {
+	if _, err := duckvdb.NewDuckDBVectorDbFromDB(nil, 0, false); err == nil {
+		t.Error("expected an error for zero dimensions")
+	}
+}
+
+func TestDuckDBVectorDb(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+
+	if err := db.AddDocument(ctx, "missing", "a", models.Document{Embeddings: []float32{1, 0}}); !errors.Is(err, vectordb.ErrSchemaNotExists) {
+		t.Errorf("expected ErrSchemaNotExists, got %v", err)
+	}
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "docs"}); !errors.Is(err, vectordb.ErrSchemaExists) {
+		t.Errorf("expected ErrSchemaExists, got %v", err)
+	}
+
+	err := db.AddDocuments(ctx, "docs", []models.Document{
+		{ID: "a", Embeddings: []float32{1, 0}, Metadata: map[string]any{"lang": "en"}, Content: "first"},
+		{ID: "b", Embeddings: []float32{0.8, 0.6}, Metadata: map[string]any{"lang": "de"}},
+		{ID: "c", Embeddings: []float32{0, 1}, Metadata: map[string]any{"lang": "en"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if results[0].Content != "first" || results[0].Metadata["lang"] != "en" || results[0].Score <= results[1].Score {
+		t.Errorf("unexpected document %+v", results[0])
+	}
+
+	results, _ = db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Filter: map[string]any{"lang": "en"}, SimilarityThreshold: 0.5})
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("unexpected filtered results %+v", results)
+	}
+
+	if err := db.UpdateDocument(ctx, "docs", "c", models.Document{Embeddings: []float32{1, 0.1}, Content: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if document, err := db.GetDocument(ctx, "docs", "c"); err != nil || document.Content != "updated" {
+		t.Errorf("expected the document to be replaced, got %+v (%v)", document, err)
+	}
+
+	if err := db.DeleteDocument(ctx, "docs", "a"); err != nil {
+		t.Fatal(err)
+	}
+	results, _ = db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{})
+	if len(results) != 2 || results[0].ID != "c" || results[1].ID != "b" {
+		t.Errorf("unexpected results after delete %+v", results)
+	}
+
+	if schemas, _ := db.GetSchemas(ctx); !slices.Equal(schemas, []string{"docs"}) {
+		t.Errorf("unexpected schemas %v", schemas)
+	}
+	if err := db.DeleteSchema(ctx, "docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetSchema(ctx, "docs"); !errors.Is(err, vectordb.ErrSchemaNotExists) {
+		t.Errorf("expected the schema to be deleted, got %v", err)
+	}
+}
+
+func TestDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "wide", Vector: models.VectorConfig{Dimensions: 3}}); err == nil {
+		t.Error("expected an error for a schema with other dimensions")
+	}
+	err := db.AddDocument(ctx, "docs", "a", models.Document{Embeddings: []float32{1, 0, 0}})
+	if !errors.Is(err, vectordb.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+	if err := db.AddDocument(ctx, "docs", "a", models.Document{Embeddings: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.QueryDocuments(ctx, "docs", []float32{1}, models.VectorDBQueryOptions{})
+	if !errors.Is(err, vectordb.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+}
+
+func TestGetAndListDocuments(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+	for _, id := range []string{"c", "a", "d", "b"} {
+		db.AddDocument(ctx, "docs", id, models.Document{Embeddings: []float32{1, 0}, Metadata: map[string]any{"even": id == "b" || id == "d"}})
+	}
+
+	document, err := db.GetDocument(ctx, "docs", "c")
+	if err != nil || document.ID != "c" {
+		t.Errorf("unexpected document %+v, %v", document, err)
+	}
+	if _, err := db.GetDocument(ctx, "docs", "x"); !errors.Is(err, vectordb.ErrDocumentNotExists) {
+		t.Errorf("expected ErrDocumentNotExists, got %v", err)
+	}
+
+	documents, err := db.ListDocuments(ctx, "docs", models.DocumentListOptions{After: "a", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 || documents[0].ID != "b" || documents[1].ID != "c" {
+		t.Errorf("unexpected page %+v", documents)
+	}
+
+	documents, _ = db.ListDocuments(ctx, "docs", models.DocumentListOptions{Filter: map[string]any{"even": true}})
+	if len(documents) != 2 || documents[0].ID != "b" || documents[1].ID != "d" {
+		t.Errorf("unexpected filtered documents %+v", documents)
+	}
+}
+
+func TestDeleteSchemas(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "notes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.DeleteSchemas(ctx, []string{"docs", "missing", "notes"})
+	if !errors.Is(err, vectordb.ErrSchemaNotExists) || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected the error of the missing schema, got %v", err)
+	}
+	if schemas, err := db.GetSchemas(ctx); err != nil || len(schemas) != 0 {
+		t.Errorf("expected the other schemas to be deleted, got %v (%v)", schemas, err)
+	}
+}
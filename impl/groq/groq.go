@@ -0,0 +1,83 @@
+// Package groq adapts the OpenAI companion to Groq. Groq speaks the OpenAI wire format, but reports
+// queue and generation timings in the response body and region information in its headers.
+package groq
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ProviderName is reported in models.ResponseInfo.Provider.
+const ProviderName = "groq"
+
+// headers copied into models.ResponseInfo.Headers
+var infoHeaders = []string{"x-groq-region", "x-request-id"}
+
+// usage holds the timing fields Groq adds to the usage object.
+type usage struct {
+	QueueTime      *float64 `json:"queue_time"`
+	PromptTime     *float64 `json:"prompt_time"`
+	CompletionTime *float64 `json:"completion_time"`
+	TotalTime      *float64 `json:"total_time"`
+}
+
+// response holds the parts of a response object carrying timings. Non streamed responses
+// report them in usage, streamed responses in x_groq.usage of the final chunk.
+type response struct {
+	Usage *usage `json:"usage"`
+	XGroq *struct {
+		Usage *usage `json:"usage"`
+	} `json:"x_groq"`
+}
+
+// Extension implements openai.Extension for Groq.
+type Extension struct{}
+
+var _ openai.Extension = Extension{}
+
+// PrepareRequest implements openai.Extension. Groq needs no additional request data.
+func (Extension) PrepareRequest(header http.Header, payload *openai.ChatRequest) {}
+
+// HandleResponse implements openai.Extension and records timings and region headers.
+func (Extension) HandleResponse(header http.Header, object []byte, info *models.ResponseInfo) {
+	info.Provider = ProviderName
+
+	for _, name := range infoHeaders {
+		if value := header.Get(name); value != "" {
+			if info.Headers == nil {
+				info.Headers = make(map[string]string)
+			}
+			info.Headers[name] = value
+		}
+	}
+
+	var parsed response
+	if err := json.Unmarshal(object, &parsed); err != nil {
+		return
+	}
+
+	timings := parsed.Usage
+	if parsed.XGroq != nil && parsed.XGroq.Usage != nil {
+		timings = parsed.XGroq.Usage
+	}
+	if timings == nil {
+		return
+	}
+
+	if info.Timing == nil {
+		info.Timing = make(map[string]float64)
+	}
+	for name, value := range map[string]*float64{
+		"queue_time":      timings.QueueTime,
+		"prompt_time":     timings.PromptTime,
+		"completion_time": timings.CompletionTime,
+		"total_time":      timings.TotalTime,
+	} {
+		if value != nil {
+			info.Timing[name] = *value
+		}
+	}
+}
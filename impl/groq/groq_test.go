@@ -0,0 +1,49 @@
+package groq_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestGroqResponseInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-remaining-requests", "14399")
+		w.Header().Set("x-ratelimit-reset-tokens", "7.66s")
+		w.Header().Set("x-groq-region", "us-east-1")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"model":"llama-3.3-70b-versatile","choices":[{"index":0,"delta":{"content":"Hi"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"model":"llama-3.3-70b-versatile","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"x_groq":{"usage":{"queue_time":0.02,"total_time":0.5}}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.Groq, "key", "llama-3.3-70b-versatile", "llama-3.3-70b-versatile", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hello"}}, true, nil)
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+
+	info := result.Info
+	if info == nil {
+		t.Fatal("expected response info, got nil")
+	}
+	if info.Provider != "groq" || info.Model != "llama-3.3-70b-versatile" || info.Headers["x-groq-region"] != "us-east-1" {
+		t.Errorf("unexpected response info %+v", info)
+	}
+	if info.RateLimit == nil || info.RateLimit.RemainingRequests != 14399 || info.RateLimit.ResetTokens != 7660*time.Millisecond {
+		t.Errorf("unexpected rate limit %+v", info.RateLimit)
+	}
+	if info.Timing["queue_time"] != 0.02 || info.Timing["total_time"] != 0.5 {
+		t.Errorf("unexpected timing %v", info.Timing)
+	}
+}
@@ -0,0 +1,334 @@
+// Package hnsw implements a hierarchical navigable small world graph for approximate nearest neighbor
+// search by cosine similarity. Vector database backends use it to answer queries without scoring every
+// stored document.
+package hnsw
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+)
+
+// default parameters of an index
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 64
+)
+
+// Config holds the parameters of an index. Zero values are replaced by the defaults.
+type Config struct {
+	M              int   // Maximum number of neighbors per node and layer, twice as many on the bottom layer
+	EfConstruction int   // Size of the candidate list while inserting; higher values build a better graph
+	EfSearch       int   // Minimum size of the candidate list while searching; higher values improve recall
+	Seed           int64 // Seed of the level generator, for reproducible graphs
+}
+
+// Result is a single search result.
+type Result struct {
+	ID    string
+	Score float64 // Cosine similarity to the query vector
+}
+
+// node is a vector in the graph. neighbors holds the neighbor list of every layer the node is part of.
+type node struct {
+	id        string
+	vector    []float32
+	neighbors [][]int
+	deleted   bool
+}
+
+// Index is an HNSW graph. It is safe for concurrent use. Deleted vectors are only marked as deleted, so they
+// keep the graph connected; Rebuild compacts an index with many deletions.
+type Index struct {
+	mutex      sync.RWMutex
+	config     Config
+	levelScale float64
+	random     *rand.Rand
+	nodes      []*node
+	ids        map[string]int
+	entry      int
+	maxLevel   int
+	deleted    int
+}
+
+// New creates an empty index.
+func New(config Config) *Index {
+	if config.M <= 1 {
+		config.M = DefaultM
+	}
+	if config.EfConstruction <= 0 {
+		config.EfConstruction = DefaultEfConstruction
+	}
+	if config.EfSearch <= 0 {
+		config.EfSearch = DefaultEfSearch
+	}
+
+	return &Index{
+		config:     config,
+		levelScale: 1 / math.Log(float64(config.M)),
+		random:     rand.New(rand.NewSource(config.Seed)),
+		ids:        make(map[string]int),
+		entry:      -1,
+	}
+}
+
+// Len returns the number of vectors in the index, not counting deleted ones.
+func (index *Index) Len() int {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return len(index.ids)
+}
+
+// Deleted returns the number of deleted vectors still held by the graph.
+func (index *Index) Deleted() int {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return index.deleted
+}
+
+// Add inserts a vector, replacing an existing vector with the same id.
+func (index *Index) Add(id string, vector []float32) {
+	normalized := vdbutil.Normalize(append([]float32(nil), vector...))
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.remove(id)
+	index.insert(id, normalized)
+}
+
+// Delete removes a vector from the results.
+func (index *Index) Delete(id string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.remove(id)
+}
+
+// Rebuild creates a new graph from the vectors that are not deleted.
+func (index *Index) Rebuild() {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	nodes := index.nodes
+	index.nodes = nil
+	index.ids = make(map[string]int, len(nodes)-index.deleted)
+	index.entry = -1
+	index.maxLevel = 0
+	index.deleted = 0
+
+	for _, n := range nodes {
+		if !n.deleted {
+			index.insert(n.id, n.vector)
+		}
+	}
+}
+
+// Search returns up to k vectors most similar to the query vector, most similar first.
+func (index *Index) Search(vector []float32, k int) []Result {
+	if k <= 0 {
+		return nil
+	}
+	query := vdbutil.Normalize(append([]float32(nil), vector...))
+
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	if index.entry < 0 {
+		return nil
+	}
+
+	entry := index.entry
+	for level := index.maxLevel; level > 0; level-- {
+		entry = index.greedy(query, entry, level)
+	}
+
+	// deleted nodes take up room in the candidate list, so widen it accordingly
+	ef := max(index.config.EfSearch, k) + min(index.deleted, k)
+	candidates := index.searchLayer(query, entry, ef, 0)
+
+	results := make([]Result, 0, k)
+	for _, candidate := range candidates {
+		n := index.nodes[candidate.node]
+		if n.deleted {
+			continue
+		}
+		results = append(results, Result{ID: n.id, Score: 1 - candidate.distance})
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// remove marks the vector with the given id as deleted.
+func (index *Index) remove(id string) {
+	if i, exists := index.ids[id]; exists {
+		index.nodes[i].deleted = true
+		delete(index.ids, id)
+		index.deleted++
+	}
+}
+
+// insert adds a normalized vector to the graph.
+func (index *Index) insert(id string, vector []float32) {
+	level := int(math.Floor(-math.Log(1-index.random.Float64()) * index.levelScale))
+	n := &node{id: id, vector: vector, neighbors: make([][]int, level+1)}
+	position := len(index.nodes)
+	index.nodes = append(index.nodes, n)
+	index.ids[id] = position
+
+	if index.entry < 0 {
+		index.entry = position
+		index.maxLevel = level
+		return
+	}
+
+	entry := index.entry
+	for l := index.maxLevel; l > level; l-- {
+		entry = index.greedy(vector, entry, l)
+	}
+
+	for l := min(level, index.maxLevel); l >= 0; l-- {
+		candidates := index.searchLayer(vector, entry, index.config.EfConstruction, l)
+		neighbors := make([]int, 0, index.config.M)
+		for _, candidate := range candidates {
+			if len(neighbors) == index.config.M {
+				break
+			}
+			neighbors = append(neighbors, candidate.node)
+		}
+		n.neighbors[l] = neighbors
+
+		for _, neighbor := range neighbors {
+			index.connect(neighbor, position, l)
+		}
+		entry = candidates[0].node
+	}
+
+	if level > index.maxLevel {
+		index.maxLevel = level
+		index.entry = position
+	}
+}
+
+// connect adds an edge from a node to a new neighbor, dropping the most distant neighbor if the list is full.
+func (index *Index) connect(from, to, level int) {
+	n := index.nodes[from]
+	n.neighbors[level] = append(n.neighbors[level], to)
+
+	limit := index.config.M
+	if level == 0 {
+		limit *= 2
+	}
+	if len(n.neighbors[level]) <= limit {
+		return
+	}
+
+	farthest, farthestDistance := 0, -1.0
+	for i, neighbor := range n.neighbors[level] {
+		if d := distance(n.vector, index.nodes[neighbor].vector); d > farthestDistance {
+			farthest, farthestDistance = i, d
+		}
+	}
+	n.neighbors[level] = append(n.neighbors[level][:farthest], n.neighbors[level][farthest+1:]...)
+}
+
+// greedy walks a layer towards the query vector and returns the closest node found.
+func (index *Index) greedy(query []float32, entry, level int) int {
+	current := entry
+	currentDistance := distance(query, index.nodes[current].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, neighbor := range index.nodes[current].neighbors[level] {
+			if d := distance(query, index.nodes[neighbor].vector); d < currentDistance {
+				current, currentDistance, changed = neighbor, d, true
+			}
+		}
+	}
+	return current
+}
+
+// searchLayer returns the ef nodes of a layer closest to the query vector, closest first.
+func (index *Index) searchLayer(query []float32, entry, ef, level int) []candidate {
+	visited := map[int]bool{entry: true}
+	start := candidate{node: entry, distance: distance(query, index.nodes[entry].vector)}
+
+	candidates := &minHeap{start}
+	results := &maxHeap{start}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(candidate)
+		if current.distance > (*results)[0].distance && results.Len() >= ef {
+			break
+		}
+
+		for _, neighbor := range index.nodes[current.node].neighbors[level] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+
+			d := distance(query, index.nodes[neighbor].vector)
+			if results.Len() < ef || d < (*results)[0].distance {
+				heap.Push(candidates, candidate{node: neighbor, distance: d})
+				heap.Push(results, candidate{node: neighbor, distance: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := make([]candidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(candidate)
+	}
+	return sorted
+}
+
+// distance returns the cosine distance of two normalized vectors.
+func distance(a, b []float32) float64 {
+	var dot float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return 1 - dot
+}
+
+// candidate is a node and its distance to the query vector.
+type candidate struct {
+	node     int
+	distance float64
+}
+
+// minHeap orders candidates by ascending distance.
+type minHeap []candidate
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].distance < h[j].distance }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// maxHeap orders candidates by descending distance, so the farthest result is dropped first.
+type maxHeap []candidate
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].distance > h[j].distance }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,96 @@
+package hnsw_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/hnsw"
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+)
+
+func randomVectors(random *rand.Rand, count, dimensions int) [][]float32 {
+	vectors := make([][]float32, count)
+	for i := range vectors {
+		vectors[i] = make([]float32, dimensions)
+		for j := range vectors[i] {
+			vectors[i][j] = random.Float32()*2 - 1
+		}
+	}
+	return vectors
+}
+
+func TestSearchRecall(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	vectors := randomVectors(random, 2000, 32)
+
+	index := hnsw.New(hnsw.Config{Seed: 1})
+	for i, vector := range vectors {
+		index.Add(fmt.Sprint(i), vector)
+	}
+
+	const k = 10
+	var found, total int
+	for _, query := range randomVectors(random, 50, 32) {
+		type scored struct {
+			id    string
+			score float64
+		}
+		exact := make([]scored, len(vectors))
+		for i, vector := range vectors {
+			exact[i] = scored{fmt.Sprint(i), vdbutil.CosineSimilarity(query, vector)}
+		}
+		sort.Slice(exact, func(i, j int) bool { return exact[i].score > exact[j].score })
+
+		expected := make(map[string]bool, k)
+		for _, result := range exact[:k] {
+			expected[result.id] = true
+		}
+
+		results := index.Search(query, k)
+		if len(results) != k {
+			t.Fatalf("expected %d results, got %d", k, len(results))
+		}
+		for i, result := range results {
+			if i > 0 && result.Score > results[i-1].Score {
+				t.Fatalf("results not sorted: %+v", results)
+			}
+			if expected[result.ID] {
+				found++
+			}
+		}
+		total += k
+	}
+
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("recall %.2f below 0.9", recall)
+	}
+}
+
+func TestDeleteAndReplace(t *testing.T) {
+	index := hnsw.New(hnsw.Config{})
+	index.Add("a", []float32{1, 0})
+	index.Add("b", []float32{0, 1})
+	index.Add("c", []float32{0.7, 0.7})
+
+	index.Delete("a")
+	results := index.Search([]float32{1, 0}, 1)
+	if len(results) != 1 || results[0].ID != "c" {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	index.Add("b", []float32{1, 0.01})
+	results = index.Search([]float32{1, 0}, 1)
+	if len(results) != 1 || results[0].ID != "b" {
+		t.Errorf("unexpected results after replace %+v", results)
+	}
+	if index.Len() != 2 || index.Deleted() != 2 {
+		t.Errorf("unexpected len %d, deleted %d", index.Len(), index.Deleted())
+	}
+
+	index.Rebuild()
+	if index.Len() != 2 || index.Deleted() != 0 {
+		t.Errorf("unexpected len %d, deleted %d after rebuild", index.Len(), index.Deleted())
+	}
+}
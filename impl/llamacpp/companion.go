@@ -0,0 +1,419 @@
+// Package llamacpp implements a companion for the llama.cpp HTTP server. Chat requests use its OpenAI
+// compatible /v1/chat/completions endpoint, while generate and embedding requests use the native
+// /completion and /embedding endpoints.
+package llamacpp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/terminal"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// ProviderName is reported in models.ResponseInfo.Provider.
+const ProviderName = "llama.cpp"
+
+// Extension implements openai.Extension and adds the llama.cpp options to chat requests.
+type Extension struct {
+	Options *Options
+}
+
+var _ openai.Extension = Extension{}
+
+// PrepareRequest implements openai.Extension.
+func (extension Extension) PrepareRequest(header http.Header, payload *openai.ChatRequest) {
+	if extension.Options == nil {
+		return
+	}
+	if payload.Extra == nil {
+		payload.Extra = make(map[string]any)
+	}
+	for key, value := range extension.Options.fields() {
+		payload.Extra[key] = value
+	}
+}
+
+// HandleResponse implements openai.Extension.
+func (extension Extension) HandleResponse(header http.Header, object []byte, info *models.ResponseInfo) {
+	info.Provider = ProviderName
+}
+
+// Companion wraps the OpenAI companion and replaces generate and embedding requests with the native endpoints.
+type Companion struct {
+	*openai.Companion
+	Options Options
+}
+
+// New creates a llama.cpp companion around an OpenAI companion, whose extension is replaced to send the options
+// and whose retrieval embeds with the native endpoint.
+func New(companion *openai.Companion) *Companion {
+	llamaCompanion := &Companion{Companion: companion}
+	companion.Extension = Extension{Options: &llamaCompanion.Options}
+	companion.Embed = llamaCompanion.SendEmbeddingRequest
+	return llamaCompanion
+}
+
+// SendModerationRequest is not supported by llama.cpp.
+func (companion *Companion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+	return models.ModerationResponse{}, errors.New("unsupported")
+}
+
+// SendGenerateRequest sends the message as raw prompt to the /completion endpoint. The alternate prompt
+// or else the system prompt or persona of the request, if set, is prepended to the message.
+func (companion *Companion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	system, err := sidekick.SystemRole(companion.Config, message, models.Message{})
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	if len(message.Message.AlternatePrompt) > 0 {
+		system.Content = message.Message.AlternatePrompt
+	}
+	prompt := message.Message.Content
+	if len(system.Content) > 0 {
+		prompt = system.Content + "\n\n" + prompt
+	}
+
+	payload := CompletionRequest{
+		Prompt:  prompt,
+		Stream:  streaming,
+		Options: companion.Options,
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	sideKick.Trace(fmt.Sprintf("SendGenerateRequest: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
+
+	var spinnerCtx context.Context
+	var cancel context.CancelFunc
+	if companion.Config.Terminal.Output && !streaming {
+		spinnerCtx, cancel = context.WithCancel(ctx)
+		cs := terminal.NewSpinningCharacter('?', 100, 10)
+		cs.StartSpinning(spinnerCtx)
+		defer cancel()
+	}
+
+	resp, err := companion.post(ctx, companion.Config.ApiEndpoints.ApiGenerateURL, payloadBytes)
+	if err != nil {
+		return models.Message{}, err
+	}
+	sideKick.Debug(fmt.Sprintf("SendGenerateRequest: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
+
+	if streaming {
+		result, err := companion.handleCompletionStream(ctx, resp, callback)
+		if err == nil {
+			companion.recordUsage(&result)
+		}
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if companion.Config.Terminal.Output {
+		cancel()
+		sideKick.ClearLine(companion.Config.Terminal)
+	}
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	sideKick.Trace(fmt.Sprintf("SendGenerateRequest: responseBytes: %s", string(responseBytes)), companion.Config.Terminal)
+
+	var response CompletionResponse
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	result := sideKick.CreateAssistantMessage(response.Content)
+	result.Info = newResponseInfo(response)
+	result.Model = response.Model
+	result.Usage = newUsage(response)
+	result.FinishReason = finishReason(response)
+	companion.recordUsage(&result)
+	sideKick.Println(result.Content, companion.Config.Terminal)
+	return result, nil
+}
+
+// recordUsage adds the usage of a completion to the counters of the wrapped companion, see GetUsage, and
+// sets its estimated cost.
+func (companion *Companion) recordUsage(response *models.Message) {
+	model := response.Model
+	if model == "" {
+		model = companion.Config.AiModels.GenerateModel.Model
+	}
+	response.Cost = sidekick.CostEstimator{Pricing: companion.Config.Pricing}.Estimate(model, response.Usage)
+	companion.Usage.Record(companion.Sessions.Current(), model, response.Usage, response.Cost)
+}
+
+// handleCompletionStream handles the server-sent events of a streamed /completion response. The last chunk
+// carries the model, usage and finish reason of the completion. If the stream is cancelled, the message received until then is returned with Cancelled set.
+func (companion *Companion) handleCompletionStream(ctx context.Context, resp *http.Response, callback func(m models.Message) error) (models.Message, error) {
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	var message strings.Builder
+	var last CompletionResponse
+	var pending *models.Message // last content chunk, passed on with the metadata of the completion
+
+	// partial returns the message received until the stream was cancelled
+	partial := func() models.Message {
+		cancelled := sideKick.CreateAssistantMessage(message.String())
+		cancelled.Model = last.Model
+		cancelled.Cancelled = true
+		return cancelled
+	}
+
+	sideKick.Print("> ", companion.Config.Terminal)
+
+	decoder := sidekick.NewSSEDecoderSize(resp.Body, companion.Config.HttpConfig.MaxLineSize)
+	for {
+		// stop reading once the request is cancelled
+		if err := ctx.Err(); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+		frame, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && ctx.Err() != nil {
+			sideKick.Error(ctx.Err())
+			return partial(), ctx.Err()
+		}
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		sideKick.Trace(fmt.Sprintf("handleCompletionStream: event %s: %s", frame.Event, frame.Data), companion.Config.Terminal)
+
+		if err := json.Unmarshal([]byte(frame.Data), &last); err != nil {
+			err = fmt.Errorf("failed to unmarshal event: %s, error: %w", frame.Data, err)
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+
+		if last.Content != "" {
+			message.WriteString(last.Content)
+			sideKick.Print(last.Content, companion.Config.Terminal)
+			if callback != nil && pending != nil {
+				if err := callback(*pending); err != nil {
+					sideKick.Error(err)
+					return partial(), err
+				}
+			}
+			chunk := sideKick.CreateAssistantMessage(last.Content)
+			pending = &chunk
+		}
+
+		if last.Stop {
+			break
+		}
+	}
+
+	sideKick.Println("", companion.Config.Terminal)
+
+	result := sideKick.CreateAssistantMessage(message.String())
+	result.Info = newResponseInfo(last)
+	result.Model = last.Model
+	result.Usage = newUsage(last)
+	result.FinishReason = finishReason(last)
+
+	// the last chunk carries the model, usage and finish reason of the completion
+	if callback != nil {
+		if pending == nil {
+			final := sideKick.CreateAssistantMessage("")
+			pending = &final
+		}
+		pending.Info = result.Info
+		pending.Model = result.Model
+		pending.Usage = result.Usage
+		pending.FinishReason = result.FinishReason
+		if err := callback(*pending); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+	}
+	return result, nil
+}
+
+// SendEmbeddingRequest sends the input to the /embedding endpoint. If the server returns one vector per
+// token, because pooling is disabled, the token vectors are averaged.
+func (companion *Companion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+	payload := EmbeddingRequest{
+		Content: embedding.Input,
+		Options: companion.Options,
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		sideKick.Error(err)
+		return models.EmbeddingResponse{}, err
+	}
+	sideKick.Trace(fmt.Sprintf("SendEmbeddingRequest: payload: %s", string(payloadBytes)), companion.Config.Terminal)
+
+	resp, err := companion.post(ctx, companion.Config.ApiEndpoints.ApiEmbedURL, payloadBytes)
+	if err != nil {
+		return models.EmbeddingResponse{}, err
+	}
+	defer resp.Body.Close()
+	sideKick.Debug(fmt.Sprintf("SendEmbeddingRequest: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return models.EmbeddingResponse{}, err
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sideKick.Error(err)
+		return models.EmbeddingResponse{}, err
+	}
+	sideKick.Trace(fmt.Sprintf("SendEmbeddingRequest: responseBytes: %s", string(responseBytes)), companion.Config.Terminal)
+
+	var results []EmbeddingResult
+	if err := json.Unmarshal(responseBytes, &results); err != nil {
+		// older servers answer a single input with a single object
+		var single EmbeddingResult
+		if err := json.Unmarshal(responseBytes, &single); err != nil {
+			sideKick.Error(err)
+			return models.EmbeddingResponse{}, err
+		}
+		results = []EmbeddingResult{single}
+	}
+
+	embeddings := make([][]float32, len(results))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(embeddings) {
+			err := fmt.Errorf("invalid embedding index %d", result.Index)
+			sideKick.Error(err)
+			return models.EmbeddingResponse{}, err
+		}
+		vector, err := decodeEmbedding(result.Embedding)
+		if err != nil {
+			sideKick.Error(err)
+			return models.EmbeddingResponse{}, err
+		}
+		embeddings[result.Index] = vector
+	}
+
+	return models.EmbeddingResponse{
+		Model:            embedding.Model,
+		Embeddings:       embeddings,
+		OriginalResponse: results,
+	}, nil
+}
+
+// post sends a JSON payload to the given url. The request is cancelled with ctx.
+func (companion *Companion) post(ctx context.Context, url string, payloadBytes []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if companion.Config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	}
+
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decodeEmbedding decodes a single vector, or averages a list of token vectors.
+func decodeEmbedding(raw json.RawMessage) ([]float32, error) {
+	var vector []float32
+	if err := json.Unmarshal(raw, &vector); err == nil {
+		return vector, nil
+	}
+
+	var tokens [][]float32
+	if err := json.Unmarshal(raw, &tokens); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty embedding")
+	}
+	if len(tokens) == 1 {
+		return tokens[0], nil
+	}
+
+	vector = make([]float32, len(tokens[0]))
+	for _, token := range tokens {
+		for i := range vector {
+			if i < len(token) {
+				vector[i] += token[i]
+			}
+		}
+	}
+	for i := range vector {
+		vector[i] /= float32(len(tokens))
+	}
+	return vector, nil
+}
+
+// newUsage returns the evaluated and predicted tokens of a completion.
+func newUsage(response CompletionResponse) *models.Usage {
+	if response.TokensEvaluated == 0 && response.TokensPredicted == 0 {
+		return nil
+	}
+	return &models.Usage{
+		PromptTokens:     response.TokensEvaluated,
+		CompletionTokens: response.TokensPredicted,
+		TotalTokens:      response.TokensEvaluated + response.TokensPredicted,
+	}
+}
+
+// finishReason maps the stop type of a completion to the finish reason of models.Message.
+func finishReason(response CompletionResponse) models.FinishReason {
+	switch response.StopType {
+	case "eos", "word":
+		return models.FinishStop
+	case "limit":
+		return models.FinishLength
+	case "", "none":
+		return ""
+	}
+	return models.FinishReason(response.StopType)
+}
+
+// newResponseInfo creates the response info of a completion.
+func newResponseInfo(response CompletionResponse) *models.ResponseInfo {
+	return &models.ResponseInfo{
+		Provider: ProviderName,
+		Model:    response.Model,
+		Timing: map[string]float64{
+			"prompt_time":     response.Timings.PromptMS / 1000,
+			"completion_time": response.Timings.PredictedMS / 1000,
+		},
+	}
+}
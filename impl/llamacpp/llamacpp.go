@@ -0,0 +1,67 @@
+// Request and response structs for the native llama.cpp server endpoints
+
+package llamacpp
+
+import "encoding/json"
+
+// Options are llama.cpp specific request options for slot and prompt cache handling. They are sent with
+// chat, completion and embedding requests.
+type Options struct {
+	CachePrompt *bool `json:"cache_prompt,omitempty"` // Reuse the KV cache of a previous request with the same prefix
+	IDSlot      *int  `json:"id_slot,omitempty"`      // Slot to process the request in, -1 picks an idle slot
+	NKeep       int   `json:"n_keep,omitempty"`       // Tokens of the prompt to keep when the context is exceeded, -1 keeps all
+	NPredict    int   `json:"n_predict,omitempty"`    // Maximum number of tokens to predict, -1 is unlimited
+}
+
+// fields returns the options as payload fields.
+func (options Options) fields() map[string]any {
+	fields := make(map[string]any)
+	if data, err := json.Marshal(options); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+// CompletionRequest represents the request payload for the /completion endpoint.
+type CompletionRequest struct {
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+	Options
+	Stop []string `json:"stop,omitempty"`
+}
+
+// CompletionResponse represents the response of the /completion endpoint, and a single event of a streamed response.
+type CompletionResponse struct {
+	Content         string  `json:"content"`
+	Stop            bool    `json:"stop"`
+	IDSlot          int     `json:"id_slot"`
+	Model           string  `json:"model"`
+	TokensPredicted int     `json:"tokens_predicted"`
+	TokensEvaluated int     `json:"tokens_evaluated"`
+	TokensCached    int     `json:"tokens_cached"`
+	StopType        string  `json:"stop_type"`
+	Timings         Timings `json:"timings"`
+}
+
+// Timings holds the timings of a completion in milliseconds.
+type Timings struct {
+	PromptN            int     `json:"prompt_n"`
+	PromptMS           float64 `json:"prompt_ms"`
+	PredictedN         int     `json:"predicted_n"`
+	PredictedMS        float64 `json:"predicted_ms"`
+	PredictedPerSecond float64 `json:"predicted_per_second"`
+	PromptPerSecond    float64 `json:"prompt_per_second"`
+}
+
+// EmbeddingRequest represents the request payload for the /embedding endpoint.
+type EmbeddingRequest struct {
+	Content []string `json:"content"`
+	Options
+}
+
+// EmbeddingResult represents a single embedding of the /embedding response. Embedding holds one vector
+// if the server pools embeddings, and one vector per token otherwise.
+type EmbeddingResult struct {
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"`
+}
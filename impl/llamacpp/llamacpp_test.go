@@ -0,0 +1,93 @@
+package llamacpp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/llamacpp"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func newCompanion(t *testing.T, handler http.HandlerFunc) *llamacpp.Companion {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := aicompanion.NewDefaultConfig(models.LlamaCpp, "", "", "", "")
+	config.ApiEndpoints.ApiChatURL = server.URL + "/v1/chat/completions"
+	config.ApiEndpoints.ApiGenerateURL = server.URL + "/completion"
+	config.ApiEndpoints.ApiEmbedURL = server.URL + "/embedding"
+
+	companion := aicompanion.NewCompanion(*config).(*llamacpp.Companion)
+	cache, slot := true, 1
+	companion.Options = llamacpp.Options{CachePrompt: &cache, IDSlot: &slot}
+	return companion
+}
+
+func TestLlamaCppChatOptions(t *testing.T) {
+	companion := newCompanion(t, func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["cache_prompt"] != true || payload["id_slot"] != float64(1) {
+			t.Errorf("missing options in payload %v", payload)
+		}
+		fmt.Fprint(w, `{"model":"qwen","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	})
+
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hello"}}, false, nil)
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if result.Content != "Hi" || result.Info == nil || result.Info.Provider != llamacpp.ProviderName {
+		t.Errorf("unexpected result %+v, info %+v", result, result.Info)
+	}
+}
+
+func TestLlamaCppCompletionStream(t *testing.T) {
+	companion := newCompanion(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/completion" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var payload llamacpp.CompletionRequest
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Prompt != "Once upon" || !payload.Stream || payload.IDSlot == nil {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+		fmt.Fprint(w, "data: {\"content\":\" a\",\"stop\":false}\n\n")
+		fmt.Fprint(w, "data: {\"content\":\" time\",\"stop\":false}\n\n")
+		fmt.Fprint(w, "data: {\"content\":\"\",\"stop\":true,\"model\":\"qwen\",\"timings\":{\"prompt_ms\":20,\"predicted_ms\":500}}\n\n")
+	})
+
+	var chunks int
+	result, err := companion.SendGenerateRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Once upon"}}, true, func(m models.Message) error {
+		chunks++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("generate request failed: %v", err)
+	}
+	if result.Content != " a time" || chunks != 2 {
+		t.Errorf("unexpected result %q after %d chunks", result.Content, chunks)
+	}
+	if result.Info.Model != "qwen" || result.Info.Timing["completion_time"] != 0.5 {
+		t.Errorf("unexpected response info %+v", result.Info)
+	}
+}
+
+func TestLlamaCppEmbedding(t *testing.T) {
+	companion := newCompanion(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"index":1,"embedding":[[1,2],[3,4]]},{"index":0,"embedding":[[0.5,0.5]]}]`)
+	})
+
+	response, err := companion.SendEmbeddingRequest(context.Background(), models.EmbeddingRequest{Input: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("embedding request failed: %v", err)
+	}
+	if len(response.Embeddings) != 2 || response.Embeddings[0][0] != 0.5 || response.Embeddings[1][0] != 2 || response.Embeddings[1][1] != 3 {
+		t.Errorf("unexpected embeddings %v", response.Embeddings)
+	}
+}
@@ -0,0 +1,410 @@
+// Package memvdb implements a vector database that keeps all documents in memory. It suits tests, demos
+// and small knowledge bases, and can persist its contents to a JSON snapshot.
+package memvdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var _ vectordb.VectorDb = (*MemoryVectorDb)(nil)
+var _ vectordb.Scanner = (*MemoryVectorDb)(nil)
+
+// collection holds the documents of a schema. Documents are scanned through the slice and looked up by
+// id through the index.
+type collection struct {
+	documents  []models.Document
+	index      map[string]int
+	dimensions int // Dimensions of the embeddings, 0 while unknown
+}
+
+// MemoryVectorDb represents a vector database held in memory.
+type MemoryVectorDb struct {
+	mutex           sync.RWMutex
+	schemas         map[string]*collection
+	snapshotPath    string
+	normalizeVector bool
+}
+
+// snapshot is the serialized form of the database.
+type snapshot struct {
+	Schemas    map[string][]models.Document `json:"schemas"`
+	Dimensions map[string]int               `json:"dimensions,omitempty"`
+}
+
+// NewMemoryVectorDb creates a new in-memory vector database. If snapshotPath is set and the file
+// exists, its contents are loaded; Save writes the database back to it.
+func NewMemoryVectorDb(snapshotPath string, normalize bool) (*MemoryVectorDb, error) {
+	m := &MemoryVectorDb{
+		schemas:         make(map[string]*collection),
+		snapshotPath:    snapshotPath,
+		normalizeVector: normalize,
+	}
+
+	if snapshotPath == "" {
+		return m, nil
+	}
+
+	file, err := os.Open(snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := m.Restore(file); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Save writes the database to its snapshot path. The snapshot is replaced atomically.
+func (m *MemoryVectorDb) Save() error {
+	if m.snapshotPath == "" {
+		return errors.New("no snapshot path configured")
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(m.snapshotPath), filepath.Base(m.snapshotPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := m.Snapshot(temp); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), m.snapshotPath)
+}
+
+// Snapshot writes all schemas and documents as JSON to w.
+func (m *MemoryVectorDb) Snapshot(w io.Writer) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	data := snapshot{
+		Schemas:    make(map[string][]models.Document, len(m.schemas)),
+		Dimensions: make(map[string]int, len(m.schemas)),
+	}
+	for classname, class := range m.schemas {
+		data.Schemas[classname] = class.documents
+		if class.dimensions > 0 {
+			data.Dimensions[classname] = class.dimensions
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the contents of the database with a snapshot read from r.
+func (m *MemoryVectorDb) Restore(r io.Reader) error {
+	var data snapshot
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	schemas := make(map[string]*collection, len(data.Schemas))
+	for classname, documents := range data.Schemas {
+		dimensions, err := vdbutil.CheckDimensions(data.Dimensions[classname], documents)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", classname, err)
+		}
+
+		class := &collection{index: make(map[string]int, len(documents)), dimensions: dimensions}
+		for _, document := range documents {
+			class.put(document)
+		}
+		schemas[classname] = class
+	}
+
+	m.mutex.Lock()
+	m.schemas = schemas
+	m.mutex.Unlock()
+	return nil
+}
+
+// put adds or replaces a document.
+func (c *collection) put(document models.Document) {
+	if i, exists := c.index[document.ID]; exists {
+		c.documents[i] = document
+		return
+	}
+	c.index[document.ID] = len(c.documents)
+	c.documents = append(c.documents, document)
+}
+
+// remove deletes a document by moving the last document into its place.
+func (c *collection) remove(id string) {
+	i, exists := c.index[id]
+	if !exists {
+		return
+	}
+	last := len(c.documents) - 1
+	if i != last {
+		c.documents[i] = c.documents[last]
+		c.index[c.documents[i].ID] = i
+	}
+	c.documents = c.documents[:last]
+	delete(c.index, id)
+}
+
+// GetSchema retrieves the schema for storing documents with the given class name.
+func (m *MemoryVectorDb) GetSchema(ctx context.Context, classname string) (models.Schema, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	class, exists := m.schemas[classname]
+	if !exists {
+		return models.Schema{}, vectordb.ErrSchemaNotExists
+	}
+	return models.Schema{ClassName: classname, Vector: models.VectorConfig{Dimensions: class.dimensions}}, nil
+}
+
+// GetSchemas retrieves the class names of all schemas in the database.
+func (m *MemoryVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]string, 0, len(m.schemas))
+	for classname := range m.schemas {
+		result = append(result, classname)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// CreateSchema creates a new schema for storing documents with the given class name.
+func (m *MemoryVectorDb) CreateSchema(ctx context.Context, schema models.Schema) error {
+	if err := vdbutil.ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	classnameStr := schema.ClassName
+	if _, exists := m.schemas[classnameStr]; exists {
+		return vectordb.ErrSchemaExists
+	}
+
+	m.schemas[classnameStr] = &collection{index: make(map[string]int), dimensions: schema.Vector.Dimensions}
+	return nil
+}
+
+// DeleteSchema deletes a schema from the database.
+func (m *MemoryVectorDb) DeleteSchema(ctx context.Context, classname string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.schemas[classname]; !exists {
+		return vectordb.ErrSchemaNotExists
+	}
+	delete(m.schemas, classname)
+	return nil
+}
+
+// DeleteSchemas deletes multiple schemas from the database.
+func (m *MemoryVectorDb) DeleteSchemas(ctx context.Context, classnames []string) error {
+	for _, classname := range classnames {
+		m.DeleteSchema(ctx, classname)
+	}
+	return nil
+}
+
+// AddDocument adds a document with the given class name and ID to the database.
+func (m *MemoryVectorDb) AddDocument(ctx context.Context, classname, id string, document models.Document) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	class, exists := m.schemas[classname]
+	if !exists {
+		return vectordb.ErrSchemaNotExists
+	}
+
+	dimensions, err := vdbutil.CheckDimensions(class.dimensions, []models.Document{document})
+	if err != nil {
+		return err
+	}
+
+	class.put(m.prepare(classname, id, document))
+	class.dimensions = dimensions
+	return nil
+}
+
+// AddDocuments adds multiple documents to the database.
+func (m *MemoryVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	class, exists := m.schemas[classname]
+	if !exists {
+		return vectordb.ErrSchemaNotExists
+	}
+
+	dimensions, err := vdbutil.CheckDimensions(class.dimensions, documents)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		class.put(m.prepare(classname, document.ID, document))
+	}
+	class.dimensions = dimensions
+	return nil
+}
+
+// UpdateDocument updates a document with the given class name and ID in the database.
+func (m *MemoryVectorDb) UpdateDocument(ctx context.Context, classname, id string, document models.Document) error {
+	return m.AddDocument(ctx, classname, id, document)
+}
+
+// UpdateDocuments updates multiple documents in the database.
+func (m *MemoryVectorDb) UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	return m.AddDocuments(ctx, classname, documents)
+}
+
+// prepare copies a document for storage, so later changes by the caller don't affect the database.
+func (m *MemoryVectorDb) prepare(classname, id string, document models.Document) models.Document {
+	embeddings := make([]float32, len(document.Embeddings))
+	copy(embeddings, document.Embeddings)
+
+	metadata := make(map[string]any, len(document.Metadata))
+	for key, value := range document.Metadata {
+		metadata[key] = value
+	}
+
+	return models.Document{
+		ID:         id,
+		ClassName:  classname,
+		Embeddings: m.NormalizeVector(embeddings),
+		Metadata:   metadata,
+		Content:    document.Content,
+	}
+}
+
+// QueryDocuments queries documents based on a vector and QueryOptions
+func (m *MemoryVectorDb) QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	class, exists := m.schemas[classname]
+	if !exists {
+		return nil, vectordb.ErrSchemaNotExists
+	}
+
+	if err := vdbutil.CheckVector(class.dimensions, vector); err != nil {
+		return nil, err
+	}
+
+	queryVector := m.NormalizeVector(append([]float32(nil), vector...))
+
+	output := []models.Document{}
+	for _, document := range class.documents {
+		if queryOptions.Filter != nil && !vdbutil.MatchesFilter(document.Metadata, queryOptions.Filter) {
+			continue
+		}
+
+		document.Score = vdbutil.CosineSimilarity(queryVector, document.Embeddings)
+		output = append(output, document)
+	}
+
+	return vdbutil.Rank(output, queryOptions), nil
+}
+
+// GetDocument retrieves a document by its ID.
+func (m *MemoryVectorDb) GetDocument(ctx context.Context, classname, id string) (models.Document, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	class, exists := m.schemas[classname]
+	if !exists {
+		return models.Document{}, vectordb.ErrSchemaNotExists
+	}
+	i, exists := class.index[id]
+	if !exists {
+		return models.Document{}, vectordb.ErrDocumentNotExists
+	}
+	return class.documents[i], nil
+}
+
+// ListDocuments lists the documents of a schema in ascending ID order.
+func (m *MemoryVectorDb) ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	return vdbutil.List(ctx, m, classname, listOptions)
+}
+
+// ScanDocuments implements vectordb.Scanner. fn is called on a copy of the schema, so it may modify
+// the database.
+func (m *MemoryVectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	m.mutex.RLock()
+	class, exists := m.schemas[classname]
+	if !exists {
+		m.mutex.RUnlock()
+		return vectordb.ErrSchemaNotExists
+	}
+	documents := make([]models.Document, 0, len(class.documents))
+	for _, document := range class.documents {
+		if document.ID > after {
+			documents = append(documents, document)
+		}
+	}
+	m.mutex.RUnlock()
+
+	sort.Slice(documents, func(i, j int) bool { return documents[i].ID < documents[j].ID })
+	for _, document := range documents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteDocument deletes a document from the database.
+func (m *MemoryVectorDb) DeleteDocument(ctx context.Context, classname, id string) error {
+	return m.DeleteDocuments(ctx, classname, []string{id})
+}
+
+// DeleteDocuments deletes multiple documents from the database.
+func (m *MemoryVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	class, exists := m.schemas[classname]
+	if !exists {
+		return vectordb.ErrSchemaNotExists
+	}
+
+	for _, id := range ids {
+		class.remove(id)
+	}
+	return nil
+}
+
+// NormalizeVector normalizes a vector if required.
+func (m *MemoryVectorDb) NormalizeVector(vector []float32) []float32 {
+	if !m.normalizeVector {
+		return vector
+	}
+	return vdbutil.Normalize(vector)
+}
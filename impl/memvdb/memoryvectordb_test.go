@@ -0,0 +1,115 @@
+package memvdb_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestMemoryVectorDb(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	db, err := memvdb.NewMemoryVectorDb(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddDocument(ctx, "missing", "a", models.Document{}); err == nil {
+		t.Error("expected error for missing schema")
+	}
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AddDocuments(ctx, "docs", []models.Document{
+		{ID: "a", Embeddings: []float32{1, 0}, Metadata: map[string]any{"lang": "en"}},
+		{ID: "b", Embeddings: []float32{0.8, 0.6}, Metadata: map[string]any{"lang": "de"}},
+		{ID: "c", Embeddings: []float32{0, 1}, Metadata: map[string]any{"lang": "en"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	results, _ = db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Filter: map[string]any{"lang": "en"}, SimilarityThreshold: 0.5})
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("unexpected filtered results %+v", results)
+	}
+
+	if err := db.DeleteDocument(ctx, "docs", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := memvdb.NewMemoryVectorDb(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ = restored.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{})
+	if len(results) != 2 || results[0].ID != "b" || results[1].ID != "c" {
+		t.Errorf("unexpected results after restore %+v", results)
+	}
+}
+
+func TestDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	db, _ := memvdb.NewMemoryVectorDb("", false)
+	db.CreateSchema(ctx, models.Schema{ClassName: "docs", Vector: models.VectorConfig{Dimensions: 2}})
+
+	err := db.AddDocument(ctx, "docs", "a", models.Document{Embeddings: []float32{1, 0, 0}})
+	if !errors.Is(err, vectordb.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+	if err := db.AddDocument(ctx, "docs", "a", models.Document{Embeddings: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.QueryDocuments(ctx, "docs", []float32{1}, models.VectorDBQueryOptions{})
+	if !errors.Is(err, vectordb.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+}
+
+func TestGetAndListDocuments(t *testing.T) {
+	ctx := context.Background()
+	db, _ := memvdb.NewMemoryVectorDb("", false)
+	db.CreateSchema(ctx, models.Schema{ClassName: "docs"})
+	for _, id := range []string{"c", "a", "d", "b"} {
+		db.AddDocument(ctx, "docs", id, models.Document{Embeddings: []float32{1}, Metadata: map[string]any{"even": id == "b" || id == "d"}})
+	}
+
+	document, err := db.GetDocument(ctx, "docs", "c")
+	if err != nil || document.ID != "c" {
+		t.Errorf("unexpected document %+v, %v", document, err)
+	}
+	if _, err := db.GetDocument(ctx, "docs", "x"); !errors.Is(err, vectordb.ErrDocumentNotExists) {
+		t.Errorf("expected ErrDocumentNotExists, got %v", err)
+	}
+
+	documents, err := db.ListDocuments(ctx, "docs", models.DocumentListOptions{After: "a", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 || documents[0].ID != "b" || documents[1].ID != "c" {
+		t.Errorf("unexpected page %+v", documents)
+	}
+
+	documents, _ = db.ListDocuments(ctx, "docs", models.DocumentListOptions{Filter: map[string]any{"even": true}})
+	if len(documents) != 2 || documents[0].ID != "b" || documents[1].ID != "d" {
+		t.Errorf("unexpected filtered documents %+v", documents)
+	}
+}
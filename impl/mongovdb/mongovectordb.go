@@ -0,0 +1,443 @@
+// Package mongovdb implements a vector database on MongoDB Atlas Vector Search. Every schema is a
+// collection with a vector search index on the embeddings of its documents.
+package mongovdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var _ vectordb.VectorDb = (*MongoVectorDb)(nil)
+var _ vectordb.Scanner = (*MongoVectorDb)(nil)
+
+const (
+	// DefaultIndexName is the name of the vector search index created for every schema.
+	DefaultIndexName = "vector_index"
+	// DefaultQueryLimit is used if a query sets no limit, as $vectorSearch requires one.
+	DefaultQueryLimit = 1000
+	// candidatesPerResult is the number of nearest neighbor candidates considered per requested result.
+	candidatesPerResult = 10
+	// maxCandidates is the upper limit of numCandidates accepted by Atlas.
+	maxCandidates = 10000
+)
+
+// field names of stored documents
+const (
+	fieldMetadata   = "metadata"
+	fieldEmbeddings = "embeddings"
+	fieldContent    = "content"
+	fieldScore      = "score"
+)
+
+// similarities maps distances to the similarity functions of a vector search index.
+var similarities = map[models.Distance]string{
+	models.DistanceCosine:     "cosine",
+	models.DistanceEuclidean:  "euclidean",
+	models.DistanceDotProduct: "dotProduct",
+}
+
+// record is the stored form of a document.
+type record struct {
+	ID         string         `bson:"_id"`
+	Metadata   map[string]any `bson:"metadata"`
+	Embeddings []float32      `bson:"embeddings"`
+	Content    string         `bson:"content,omitempty"`
+	Score      float64        `bson:"score,omitempty"`
+}
+
+// MongoVectorDb represents a vector database using MongoDB Atlas Vector Search.
+type MongoVectorDb struct {
+	client          *mongo.Client
+	database        *mongo.Database
+	normalizeVector bool
+	// Dimensions is the number of dimensions used for schemas created from a plain class name.
+	Dimensions int
+	// IndexName is the name of the vector search index, defaults to DefaultIndexName.
+	IndexName string
+}
+
+// NewMongoVectorDb connects to the MongoDB deployment at uri and uses the given database.
+func NewMongoVectorDb(ctx context.Context, uri, database string, dimensions int, normalize bool) (*MongoVectorDb, error) {
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to connect to mongodb: %w", err)
+	}
+
+	return &MongoVectorDb{
+		client:          client,
+		database:        client.Database(database),
+		normalizeVector: normalize,
+		Dimensions:      dimensions,
+		IndexName:       DefaultIndexName,
+	}, nil
+}
+
+// Close disconnects from the deployment.
+func (m *MongoVectorDb) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+// indexName returns the name of the vector search index.
+func (m *MongoVectorDb) indexName() string {
+	if m.IndexName == "" {
+		return DefaultIndexName
+	}
+	return m.IndexName
+}
+
+// collection returns the collection of a schema, or an error if it doesn't exist.
+func (m *MongoVectorDb) collection(ctx context.Context, classname string) (*mongo.Collection, error) {
+	names, err := m.database.ListCollectionNames(ctx, bson.D{{Key: "name", Value: classname}})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, vectordb.ErrSchemaNotExists
+	}
+	return m.database.Collection(classname), nil
+}
+
+// GetSchema retrieves the schema for storing documents with the given class name.
+func (m *MongoVectorDb) GetSchema(ctx context.Context, classname string) (models.Schema, error) {
+	if _, err := m.collection(ctx, classname); err != nil {
+		return models.Schema{}, err
+	}
+	return models.Schema{ClassName: classname}, nil
+}
+
+// GetSchemas retrieves the class names of all schemas in the database.
+func (m *MongoVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
+	names, err := m.database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateSchema creates a collection and its vector search index. Schemas without dimensions use the
+// default dimensions of the database; filterable properties become filter fields of the index.
+func (m *MongoVectorDb) CreateSchema(ctx context.Context, schema models.Schema) error {
+	if schema.ClassName == "" {
+		return errors.New("schema requires a class name")
+	}
+	dimensions := schema.Vector.Dimensions
+	if dimensions <= 0 {
+		dimensions = m.Dimensions
+	}
+	if dimensions <= 0 {
+		return errors.New("schema requires the number of dimensions")
+	}
+	distance := schema.Vector.Distance
+	if distance == "" {
+		distance = models.DistanceCosine
+	}
+	similarity, supported := similarities[distance]
+	if !supported {
+		return fmt.Errorf("unsupported distance %q", distance)
+	}
+
+	if _, err := m.collection(ctx, schema.ClassName); err == nil {
+		return vectordb.ErrSchemaExists
+	}
+	if err := m.database.CreateCollection(ctx, schema.ClassName); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	fields := bson.A{bson.D{
+		{Key: "type", Value: "vector"},
+		{Key: "path", Value: fieldEmbeddings},
+		{Key: "numDimensions", Value: dimensions},
+		{Key: "similarity", Value: similarity},
+	}}
+	for _, property := range schema.Properties {
+		if !property.Filterable {
+			continue
+		}
+		fields = append(fields, bson.D{
+			{Key: "type", Value: "filter"},
+			{Key: "path", Value: fieldMetadata + "." + property.Name},
+		})
+	}
+
+	model := mongo.SearchIndexModel{
+		Definition: bson.D{{Key: "fields", Value: fields}},
+		Options:    options.SearchIndexes().SetName(m.indexName()).SetType("vectorSearch"),
+	}
+	if _, err := m.database.Collection(schema.ClassName).SearchIndexes().CreateOne(ctx, model); err != nil {
+		return fmt.Errorf("failed to create vector search index: %w", err)
+	}
+	return nil
+}
+
+// DeleteSchema deletes a schema, including its index, from the database.
+func (m *MongoVectorDb) DeleteSchema(ctx context.Context, classname string) error {
+	collection, err := m.collection(ctx, classname)
+	if err != nil {
+		return err
+	}
+	if err := collection.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to delete schema: %w", err)
+	}
+	return nil
+}
+
+// DeleteSchemas deletes multiple schemas from the database.
+func (m *MongoVectorDb) DeleteSchemas(ctx context.Context, classnames []string) error {
+	for _, classname := range classnames {
+		m.DeleteSchema(ctx, classname)
+	}
+	return nil
+}
+
+// AddDocument adds a document with the given class name and ID to the database.
+func (m *MongoVectorDb) AddDocument(ctx context.Context, classname, id string, document models.Document) error {
+	document.ID = id
+	return m.AddDocuments(ctx, classname, []models.Document{document})
+}
+
+// AddDocuments adds or replaces multiple documents in a single bulk write.
+func (m *MongoVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	collection, err := m.collection(ctx, classname)
+	if err != nil {
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(documents))
+	for _, document := range documents {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: document.ID}}).
+			SetReplacement(record{
+				ID:         document.ID,
+				Metadata:   document.Metadata,
+				Embeddings: m.NormalizeVector(document.Embeddings),
+				Content:    document.Content,
+			}).
+			SetUpsert(true))
+	}
+
+	if _, err := collection.BulkWrite(ctx, writes); err != nil {
+		return fmt.Errorf("failed to add documents: %w", err)
+	}
+	return nil
+}
+
+// UpdateDocument updates a document with the given class name and ID in the database.
+func (m *MongoVectorDb) UpdateDocument(ctx context.Context, classname, id string, document models.Document) error {
+	return m.AddDocument(ctx, classname, id, document)
+}
+
+// UpdateDocuments updates multiple documents in the database.
+func (m *MongoVectorDb) UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error {
+	return m.AddDocuments(ctx, classname, documents)
+}
+
+// QueryDocuments runs a $vectorSearch aggregation. Filters match metadata values exactly; their keys must
+// be declared as FilterFields of the schema. Atlas reports cosine and dot product scores normalized to
+// [0, 1], which are converted back to the similarity, so thresholds behave like in the other backends.
+// Hybrid queries fuse the keyword and vector ranks of the documents found by the vector search.
+func (m *MongoVectorDb) QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	collection, err := m.collection(ctx, classname)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := queryOptions.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+	// $vectorSearch has no offset, so fetch the skipped documents as well
+	limit += max(queryOptions.Offset, 0)
+	candidates := min(limit*candidatesPerResult, maxCandidates)
+	candidates = max(candidates, limit)
+
+	search := bson.D{
+		{Key: "index", Value: m.indexName()},
+		{Key: "path", Value: fieldEmbeddings},
+		{Key: "queryVector", Value: m.NormalizeVector(append([]float32(nil), vector...))},
+		{Key: "numCandidates", Value: candidates},
+		{Key: "limit", Value: limit},
+	}
+	if filter := TranslateFilter(queryOptions.Filter); filter != nil {
+		search = append(search, bson.E{Key: "filter", Value: filter})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: search}},
+		{{Key: "$project", Value: bson.D{
+			{Key: fieldMetadata, Value: 1},
+			{Key: fieldEmbeddings, Value: 1},
+			{Key: fieldContent, Value: 1},
+			{Key: fieldScore, Value: bson.D{{Key: "$meta", Value: "vectorSearchScore"}}},
+		}}},
+	}
+	if queryOptions.Offset > 0 && queryOptions.Hybrid == nil {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: queryOptions.Offset}})
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	output := []models.Document{}
+	for cursor.Next(ctx) {
+		var stored record
+		if err := cursor.Decode(&stored); err != nil {
+			return nil, fmt.Errorf("failed to decode document: %w", err)
+		}
+
+		// Atlas reports (1 + similarity) / 2
+		score := stored.Score*2 - 1
+		if queryOptions.SimilarityThreshold > 0 && score < queryOptions.SimilarityThreshold {
+			continue
+		}
+
+		output = append(output, models.Document{
+			ID:         stored.ID,
+			ClassName:  classname,
+			Score:      score,
+			Embeddings: stored.Embeddings,
+			Metadata:   stored.Metadata,
+			Content:    stored.Content,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+
+	if queryOptions.Hybrid != nil {
+		return vdbutil.Rank(output, queryOptions), nil
+	}
+	return output, nil
+}
+
+// TranslateFilter translates a metadata filter into a $vectorSearch filter. Each key must match its value exactly.
+func TranslateFilter(filter map[string]any) bson.D {
+	if len(filter) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	conditions := make(bson.A, 0, len(keys))
+	for _, key := range keys {
+		conditions = append(conditions, bson.D{{Key: fieldMetadata + "." + key, Value: bson.D{{Key: "$eq", Value: filter[key]}}}})
+	}
+	if len(conditions) == 1 {
+		return conditions[0].(bson.D)
+	}
+	return bson.D{{Key: "$and", Value: conditions}}
+}
+
+// GetDocument retrieves a document by its ID.
+func (m *MongoVectorDb) GetDocument(ctx context.Context, classname, id string) (models.Document, error) {
+	collection, err := m.collection(ctx, classname)
+	if err != nil {
+		return models.Document{}, err
+	}
+
+	var stored record
+	err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Document{}, vectordb.ErrDocumentNotExists
+	}
+	if err != nil {
+		return models.Document{}, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	return models.Document{
+		ID:         stored.ID,
+		ClassName:  classname,
+		Embeddings: stored.Embeddings,
+		Metadata:   stored.Metadata,
+		Content:    stored.Content,
+	}, nil
+}
+
+// ListDocuments lists the documents of a schema in ascending ID order. Filters are applied to the
+// scanned documents, so they need no index.
+func (m *MongoVectorDb) ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	return vdbutil.List(ctx, m, classname, listOptions)
+}
+
+// ScanDocuments implements vectordb.Scanner.
+func (m *MongoVectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	collection, err := m.collection(ctx, classname)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := collection.Find(ctx,
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to scan documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var stored record
+		if err := cursor.Decode(&stored); err != nil {
+			return fmt.Errorf("failed to decode document: %w", err)
+		}
+		if err := fn(models.Document{
+			ID:         stored.ID,
+			ClassName:  classname,
+			Embeddings: stored.Embeddings,
+			Metadata:   stored.Metadata,
+			Content:    stored.Content,
+		}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// DeleteDocument deletes a document from the database.
+func (m *MongoVectorDb) DeleteDocument(ctx context.Context, classname, id string) error {
+	return m.DeleteDocuments(ctx, classname, []string{id})
+}
+
+// DeleteDocuments deletes multiple documents from the database.
+func (m *MongoVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
+	collection, err := m.collection(ctx, classname)
+	if err != nil {
+		return err
+	}
+
+	if _, err := collection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}); err != nil {
+		return fmt.Errorf("failed to delete documents: %w", err)
+	}
+	return nil
+}
+
+// NormalizeVector normalizes a vector if required.
+func (m *MongoVectorDb) NormalizeVector(vector []float32) []float32 {
+	if !m.normalizeVector {
+		return vector
+	}
+	return vdbutil.Normalize(vector)
+}
@@ -0,0 +1,43 @@
+package mongovdb_test
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/ghmer/aicompanion/impl/mongovdb"
+)
+
+func TestTranslateFilter(t *testing.T) {
+	if filter := mongovdb.TranslateFilter(nil); filter != nil {
+		t.Errorf("expected nil filter, got %v", filter)
+	}
+
+	single := mongovdb.TranslateFilter(map[string]any{"lang": "en"})
+	expected := bson.D{{Key: "metadata.lang", Value: bson.D{{Key: "$eq", Value: "en"}}}}
+	if !equal(t, single, expected) {
+		t.Errorf("unexpected filter %v", single)
+	}
+
+	multiple := mongovdb.TranslateFilter(map[string]any{"lang": "en", "year": 2024})
+	expected = bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "metadata.lang", Value: bson.D{{Key: "$eq", Value: "en"}}}},
+		bson.D{{Key: "metadata.year", Value: bson.D{{Key: "$eq", Value: 2024}}}},
+	}}}
+	if !equal(t, multiple, expected) {
+		t.Errorf("unexpected filter %v", multiple)
+	}
+}
+
+func equal(t *testing.T, a, b bson.D) bool {
+	t.Helper()
+	first, err := bson.MarshalExtJSON(a, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := bson.MarshalExtJSON(b, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(first) == string(second)
+}
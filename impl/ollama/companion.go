@@ -1,7 +1,6 @@
 package ollama
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -11,9 +10,13 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
 	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
 	"github.com/ghmer/aicompanion/models"
 	"github.com/ghmer/aicompanion/terminal"
+	"github.com/ghmer/aicompanion/tools"
 )
 
 var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
@@ -24,6 +27,12 @@ type Companion struct {
 	SystemRole   models.Message
 	Conversation []models.Message
 	HttpClient   *http.Client
+	VectorDb     vectordb.VectorDb          // Source of the context of RAG requests
+	Sessions     conversationstore.Sessions // Named conversations, see SwitchSession
+	ToolRegistry *tools.Registry            // Tools implemented by Go functions, run before Tool endpoints
+	ToolBreakers sidekick.CircuitBreakers   // Circuit breakers of the tools, see models.ToolConfiguration
+	Usage        sidekick.UsageCounter      // Tokens of the responses, see GetUsage
+	OnToolCall   models.ToolCallHook        // Asked before a tool is run, if set
 }
 
 // GetConfig returns the current configuration of the companion.
@@ -83,6 +92,112 @@ func (companion *Companion) SetConversation(conversation []models.Message) {
 	companion.Conversation = conversation
 }
 
+// PinMessage pins or unpins the message of the conversation at index. Pinned messages are always sent
+// along with requests, regardless of Config.MaxMessages and Config.MaxContextTokens.
+func (companion *Companion) PinMessage(index int, pinned bool) error {
+	return sideKick.PinMessage(companion.Conversation, index, pinned)
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (companion *Companion) PinMessageByID(id string, pinned bool) error {
+	return sideKick.PinMessageByID(companion.Conversation, id, pinned)
+}
+
+// RemoveLastExchange removes the last user message and all messages following it, such as the reply and
+// tool results, and returns them. It rolls back a turn that was aborted or failed, e.g. by a stream that
+// errored mid-way. A conversation without user messages is left unchanged.
+func (companion *Companion) RemoveLastExchange() []models.Message {
+	var removed []models.Message
+	companion.Conversation, removed = sideKick.RemoveLastExchange(companion.Conversation)
+	return removed
+}
+
+// TruncateAfter removes the messages following index from the conversation. An index of -1 removes all
+// messages.
+func (companion *Companion) TruncateAfter(index int) error {
+	conversation, err := sideKick.TruncateAfter(companion.Conversation, index)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ExportConversation writes the conversation as transcript in the given format. Images of Markdown
+// transcripts are written to Config.ImageDir. The transcript is encrypted if Config.EncryptionKey is set.
+func (companion *Companion) ExportConversation(w io.Writer, format models.ConversationFormat) error {
+	return sideKick.ExportConversation(w, companion.Conversation, format, companion.Config.ImageDir, companion.Config.EncryptionKey)
+}
+
+// ImportConversation replaces the conversation with a JSON or Markdown transcript, which is decrypted
+// with Config.EncryptionKey if it is encrypted.
+func (companion *Companion) ImportConversation(r io.Reader) error {
+	conversation, err := sideKick.ImportConversation(r, companion.Config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// SetConversationStore sets the store keeping the conversations of the sessions that are not current.
+func (companion *Companion) SetConversationStore(store conversationstore.Store) {
+	companion.Sessions.Store = store
+}
+
+// CurrentSession returns the name of the current session.
+func (companion *Companion) CurrentSession() string {
+	return companion.Sessions.Current()
+}
+
+// SwitchSession saves the conversation under the current session and continues the named session.
+func (companion *Companion) SwitchSession(name string) error {
+	conversation, err := companion.Sessions.Switch(name, companion.Conversation)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ListSessions returns the names of all sessions.
+func (companion *Companion) ListSessions() ([]string, error) {
+	return companion.Sessions.List()
+}
+
+// SearchSessions saves the conversation under the current session and searches the messages of all
+// sessions. The conversation store has to implement conversationstore.Searcher.
+func (companion *Companion) SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error) {
+	return companion.Sessions.Search(companion.Conversation, query, limit)
+}
+
+// DeleteSession deletes the named session. Deleting the current session clears the conversation.
+func (companion *Companion) DeleteSession(name string) error {
+	current, err := companion.Sessions.Delete(name)
+	if err != nil {
+		return err
+	}
+	if current {
+		companion.Conversation = make([]models.Message, 0)
+	}
+	return nil
+}
+
+// GetUsage returns the tokens of the responses of the companion, in total, per session and per model.
+func (companion *Companion) GetUsage() models.UsageReport {
+	return companion.Usage.Report()
+}
+
+// recordUsage adds the usage of a response to the current session and sets its estimated cost.
+func (companion *Companion) recordUsage(response *models.Message) {
+	model := response.Model
+	if model == "" {
+		model = companion.Config.AiModels.ChatModel.Model
+	}
+	response.Cost = sidekick.CostEstimator{Pricing: companion.Config.Pricing}.Estimate(model, response.Usage)
+	companion.Usage.Record(companion.Sessions.Current(), model, response.Usage, response.Cost)
+}
+
 // GetClient returns the current HTTP client of the companion.
 func (companion *Companion) GetHttpClient() *http.Client {
 	return companion.HttpClient
@@ -93,9 +208,35 @@ func (companion *Companion) SetHttpClient(client *http.Client) {
 	companion.HttpClient = client
 }
 
-// prepareConversation prepares the conversation by appending system role and current conversation messages.
+// SetVectorDB sets the vector database used by SendRAGRequest.
+func (companion *Companion) SetVectorDB(vectorDb vectordb.VectorDb) {
+	companion.VectorDb = vectorDb
+}
+
+// GetVectorDB returns the vector database used by SendRAGRequest.
+func (companion *Companion) GetVectorDB() vectordb.VectorDb {
+	return companion.VectorDb
+}
+
+// PrepareConversation prepares the conversation by appending system role and current conversation messages.
 func (companion *Companion) PrepareConversation(message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
-	messages := append([]models.Message{companion.SystemRole}, sideKick.PrepareArray(companion.Conversation, includeStrategy, companion.Config.MaxMessages)...)
+	return companion.prepareConversation(context.Background(), message, includeStrategy)
+}
+
+// prepareConversation is PrepareConversation for a request, which cancels summarizing the history with ctx.
+func (companion *Companion) prepareConversation(ctx context.Context, message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	systemRole := companion.SystemRole
+	history := sideKick.SelectContext(companion.Config.ContextStrategy, sidekick.ContextRequest{
+		Context:         ctx,
+		Conversation:    companion.Conversation,
+		IncludeStrategy: includeStrategy,
+		MaxMessages:     companion.Config.MaxMessages,
+		MaxTokens:       companion.Config.MaxContextTokens,
+		Reserved:        []models.Message{systemRole, message},
+		Summarize:       sideKick.NewSummarizer(companion.SendGenerateRequest),
+	})
+
+	messages := append([]models.Message{systemRole}, history...)
 	messages = append(messages, message)
 
 	return messages
@@ -103,16 +244,107 @@ func (companion *Companion) PrepareConversation(message models.Message, includeS
 
 // addMessage adds the given message to the conversation history.
 func (companion *Companion) AddMessage(message models.Message) {
-	companion.Conversation = append(companion.Conversation, message)
+	companion.Conversation = append(companion.Conversation, sideKick.StampMessage(message))
 }
 
-// SendModerationRequest sends a request to the OpenAI API to moderate a given text input.
-func (companion *Companion) SendModerationRequest(moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
-	return models.ModerationResponse{}, errors.New("unsupported")
+// SendModerationRequest moderates a given text input by asking the configured moderation model
+// for a verdict and mapping the violated hazard categories onto moderation categories.
+func (companion *Companion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+	var moderationResponse models.ModerationResponse
+
+	model := companion.Config.AiModels.ModerationModel.Model
+	if model == "" {
+		err := errors.New("no moderation model configured")
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+
+	prompt := moderationRequest.Input
+	if !isGuardModel(model) {
+		prompt = fmt.Sprintf(ModerationPrompt, moderationRequest.Input)
+	}
+
+	payloadBytes, err := json.Marshal(CompletionRequest{Model: model, Prompt: prompt, Stream: false})
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+
+	sideKick.Trace(fmt.Sprintf("SendModerationRequest: payload %s", string(payloadBytes)), companion.Config.Terminal)
+
+	var spinnerCtx context.Context
+	var cancel context.CancelFunc
+	if companion.Config.Terminal.Output {
+		spinnerCtx, cancel = context.WithCancel(ctx)
+		cs := terminal.NewSpinningCharacter('?', 100, 10)
+		cs.StartSpinning(spinnerCtx)
+		defer cancel()
+	}
+
+	// Create and configure the HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiModerationURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute the HTTP request
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+	defer resp.Body.Close()
+
+	sideKick.Debug(fmt.Sprintf("SendModerationRequest: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
+	err = sideKick.VerifyStatus(resp)
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+
+	if companion.Config.Terminal.Output {
+		cancel()
+		sideKick.ClearLine(companion.Config.Terminal)
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+
+	sideKick.Trace(fmt.Sprintf("SendModerationRequest: responseBytes %s", string(responseBytes)), companion.Config.Terminal)
+
+	var originalResponse CompletionResponse
+	err = json.Unmarshal(responseBytes, &originalResponse)
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+
+	flagged, categories, scores, err := parseModerationVerdict(originalResponse.Response)
+	if err != nil {
+		sideKick.Error(err)
+		return moderationResponse, err
+	}
+
+	moderationResponse = models.ModerationResponse{
+		ID:               fmt.Sprintf("modr-%d", originalResponse.CreatedAt.UnixNano()),
+		Model:            models.Model{Model: originalResponse.Model, Name: originalResponse.Model},
+		Flagged:          flagged,
+		Categories:       categories,
+		CategoryScores:   scores,
+		OriginalResponse: originalResponse,
+	}
+
+	return moderationResponse, nil
 }
 
 // SendEmbeddingRequest sends an embedding request to the server using the provided embedding request object.
-func (companion *Companion) SendEmbeddingRequest(embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+func (companion *Companion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
 	var embeddingResponse models.EmbeddingResponse
 
 	// Marshal the payload into JSON
@@ -124,17 +356,17 @@ func (companion *Companion) SendEmbeddingRequest(embedding models.EmbeddingReque
 
 	sideKick.Trace(fmt.Sprintf("SendEmbeddingRequest: payload %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiEmbedURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiEmbedURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return embeddingResponse, err
@@ -186,13 +418,16 @@ func (companion *Companion) SendEmbeddingRequest(embedding models.EmbeddingReque
 	return embeddingResponse, nil
 }
 
-func (companion *Companion) SendToolRequest(message models.MessageRequest) (models.Message, error) {
+func (companion *Companion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
 	var result models.Message
+	options := companion.Config.Generation.Merge(message.Options)
 	var payload CompletionRequest = CompletionRequest{
-		Model:    string(companion.Config.AiModels.ChatModel.Model),
-		Messages: []models.Message{message.Message},
-		Stream:   false,
-		Tools:    message.Tools,
+		Model:     string(companion.Config.AiModels.ChatModel.Model),
+		Messages:  []models.Message{message.Message},
+		Stream:    false,
+		Tools:     message.Tools,
+		Options:   newOptions(options),
+		KeepAlive: newKeepAlive(options),
 	}
 
 	// Marshal the payload into JSON
@@ -203,17 +438,17 @@ func (companion *Companion) SendToolRequest(message models.MessageRequest) (mode
 	}
 	sideKick.Trace(fmt.Sprintf("SendToolRequest: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return result, err
@@ -259,21 +494,64 @@ func (companion *Companion) SendToolRequest(message models.MessageRequest) (mode
 	}
 
 	result = completionResponse.Message
+	completionResponse.annotate(&result)
+	companion.recordUsage(&result)
 
 	return result, nil
 }
 
+// SendRAGRequest retrieves documents matching the message from the vector database, adds them as context
+// using the enrichment prompt and sends the result as chat request. The conversation keeps the original message.
+func (companion *Companion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request, err := sideKick.PrepareRAGRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message, options)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	return companion.SendChatRequest(ctx, request, streaming, callback)
+}
+
 // ProcessUserInput processes the user input by sending it to the API and handling the response.
-func (companion *Companion) SendChatRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+func (companion *Companion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
 	sideKick.Trace(fmt.Sprintf("parameters:\nmessage: %v\nstreaming: %v\n", message, streaming), companion.Config.Terminal)
 	sideKick.Trace(fmt.Sprintf("message.message.content: %s\n", message.Message.Content), companion.Config.Terminal)
+	if companion.Config.Moderation.Enabled {
+		moderated, err := companion.moderate(ctx, message.Message)
+		if err != nil {
+			return models.Message{}, err
+		}
+		message.Message = moderated
+	}
+
+	if companion.Config.ActivePersona.UseKnowledge {
+		enriched, err := sideKick.PrepareKnowledgeRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message)
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		message = enriched
+	}
+
 	var result models.Message
+	options := companion.Config.Generation.Merge(message.Options)
 	var payload CompletionRequest = CompletionRequest{
-		Model:    string(companion.Config.AiModels.ChatModel.Model),
-		Messages: companion.PrepareConversation(message.Message, companion.Config.IncludeStrategy),
-		Stream:   streaming,
-		Tools:    message.Tools,
+		Model:     string(companion.Config.AiModels.ChatModel.Model),
+		Messages:  companion.prepareConversation(ctx, message.Message, companion.Config.IncludeStrategy),
+		Stream:    streaming,
+		Tools:     message.Tools,
+		Format:    newFormat(message.ResponseFormat),
+		Options:   newOptions(options),
+		KeepAlive: newKeepAlive(options),
+	}
+
+	// the system prompt or persona of the request replaces the system role for this request only
+	systemRole, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return result, err
 	}
+	payload.Messages[0] = systemRole
 
 	// Marshal the payload into JSON
 	payloadBytes, err := json.Marshal(payload)
@@ -283,17 +561,17 @@ func (companion *Companion) SendChatRequest(message models.MessageRequest, strea
 	}
 	sideKick.Trace(fmt.Sprintf("SendChatRequest: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return result, err
@@ -323,9 +601,10 @@ func (companion *Companion) SendChatRequest(message models.MessageRequest, strea
 
 	// Process the streaming response
 	if streaming {
-		result, err = companion.HandleStreamResponse(resp, models.Chat, callback)
+		result, err = companion.HandleStreamResponse(ctx, resp, models.Chat, callback)
 		if err != nil {
 			sideKick.Error(err)
+			return result, err
 		}
 	} else {
 		var bodyBytes []byte
@@ -345,7 +624,10 @@ func (companion *Companion) SendChatRequest(message models.MessageRequest, strea
 		}
 
 		result = completionResponse.Message
+		completionResponse.annotate(&result)
 	}
+	companion.recordUsage(&result)
+
 	switch message.RetainOriginalMessage {
 	case true:
 		companion.AddMessage(message.OriginalMessage)
@@ -359,14 +641,26 @@ func (companion *Companion) SendChatRequest(message models.MessageRequest, strea
 }
 
 // ProcessUserInput processes the user input by sending it to the API and handling the response.
-func (companion *Companion) SendGenerateRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+func (companion *Companion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
 	var result models.Message
+	options := companion.Config.Generation.Merge(message.Options)
 	var payload CompletionRequest = CompletionRequest{
-		Model:  string(companion.Config.AiModels.GenerateModel.Model),
-		Images: message.Message.Images,
-		Prompt: message.Message.Content,
-		Stream: streaming,
+		Model:     string(companion.Config.AiModels.GenerateModel.Model),
+		Images:    message.Message.Images,
+		Prompt:    message.Message.Content,
+		Stream:    streaming,
+		Format:    newFormat(message.ResponseFormat),
+		Options:   newOptions(options),
+		KeepAlive: newKeepAlive(options),
+	}
+
+	// without a system prompt or persona, the request keeps the system prompt of the model
+	systemRole, err := sidekick.SystemRole(companion.Config, message, models.Message{})
+	if err != nil {
+		sideKick.Error(err)
+		return result, err
 	}
+	payload.System = systemRole.Content
 
 	// Marshal the payload into JSON
 	payloadBytes, err := json.Marshal(payload)
@@ -377,17 +671,17 @@ func (companion *Companion) SendGenerateRequest(message models.MessageRequest, s
 
 	sideKick.Trace(fmt.Sprintf("SendGenerateRequest: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiGenerateURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiGenerateURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return result, err
@@ -417,7 +711,7 @@ func (companion *Companion) SendGenerateRequest(message models.MessageRequest, s
 
 	// Process the streaming response
 	if streaming {
-		result, err = companion.HandleStreamResponse(resp, models.Generate, callback)
+		result, err = companion.HandleStreamResponse(ctx, resp, models.Generate, callback)
 		if err != nil {
 			sideKick.Error(err)
 			return result, err
@@ -440,39 +734,62 @@ func (companion *Companion) SendGenerateRequest(message models.MessageRequest, s
 		}
 
 		result = sideKick.CreateAssistantMessage(completionResponse.Response)
+		completionResponse.annotate(&result)
 	}
+	companion.recordUsage(&result)
 
 	return result, nil
 }
 
-// HandleStreamResponse handles the streaming response from the Ollama API.
-func (companion *Companion) HandleStreamResponse(resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+// HandleStreamResponse handles the streaming response from the Ollama API. The last chunk carries the
+// model, usage and finish reason of the response. If the stream is cancelled, by
+// ctx or an error of callback, the message received until then is returned with Cancelled set, along with
+// the error.
+func (companion *Companion) HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
 	var message strings.Builder
+	var toolCalls []models.ToolCall
 	var result models.Message
 
 	sideKick.Debug(fmt.Sprintf("HandleStreamResponse: resp.StatusCode: %d, status: %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			err := fmt.Errorf("unexpected HTTP status: %s, and failed to read body: %v", resp.Status, readErr)
-			sideKick.Error(err)
-			resp.Body.Close()
-			return models.Message{}, err
-		}
-		err := fmt.Errorf("unexpected HTTP status: %s, body: %s", resp.Status, string(bodyBytes))
+	defer resp.Body.Close()
+	if err := sideKick.VerifyStatus(resp); err != nil {
 		sideKick.Error(err)
-		resp.Body.Close()
 		return models.Message{}, err
 	}
-	defer resp.Body.Close()
+
+	// partial returns the message received until the stream was cancelled
+	partial := func() models.Message {
+		cancelled := sideKick.CreateAssistantMessage(message.String())
+		cancelled.ToolCalls = toolCalls
+		cancelled.Cancelled = true
+		return cancelled
+	}
 
 	sideKick.Print("> ", companion.Config.Terminal)
 
-	scanner := bufio.NewScanner(resp.Body)
+	lines := sidekick.NewLineReader(resp.Body, companion.Config.HttpConfig.MaxLineSize)
 
 OuterLoop:
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	for {
+		// stop reading once the request is cancelled
+		if err := ctx.Err(); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+		raw, err := lines.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				sideKick.Error(err)
+				return partial(), err
+			}
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		line := strings.TrimSpace(string(raw))
 		sideKick.Trace(fmt.Sprintf("HandleStreamResponse: line: %s", line), companion.Config.Terminal)
 		if len(line) == 0 {
 			continue
@@ -486,12 +803,19 @@ OuterLoop:
 
 		switch streamType {
 		case models.Chat:
-			// Print the content from each choice in the chunk
+			// Print the content from each choice in the chunk; tool calls arrive complete
 			message.WriteString(responseObject.Message.Content)
+			toolCalls = append(toolCalls, responseObject.Message.ToolCalls...)
+			chunk := responseObject.Message
+			if responseObject.Done {
+				// the last chunk carries the model, usage and finish reason of the response
+				responseObject.annotate(&chunk)
+				chunk.FinishReason = responseObject.finishReason(len(toolCalls) > 0)
+			}
 			if callback != nil {
-				if err := callback(responseObject.Message); err != nil {
+				if err := callback(chunk); err != nil {
 					sideKick.Error(err)
-					return models.Message{}, err
+					return partial(), err
 				}
 			}
 			sideKick.Print(responseObject.Message.Content, companion.Config.Terminal)
@@ -500,9 +824,12 @@ OuterLoop:
 			message.WriteString(responseObject.Response)
 			if callback != nil {
 				msg := sideKick.CreateAssistantMessage(responseObject.Response)
+				if responseObject.Done {
+					responseObject.annotate(&msg)
+				}
 				if err := callback(msg); err != nil {
 					sideKick.Error(err)
-					return models.Message{}, err
+					return partial(), err
 				}
 			}
 			sideKick.Print(responseObject.Response, companion.Config.Terminal)
@@ -514,23 +841,20 @@ OuterLoop:
 
 		if responseObject.Done {
 			result = sideKick.CreateAssistantMessage(message.String())
+			result.ToolCalls = toolCalls
+			responseObject.annotate(&result)
 			sideKick.Println("", companion.Config.Terminal)
 			break OuterLoop
 		}
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		sideKick.Error(err)
-		return models.Message{}, err
-	}
-
 	return result, nil
 }
 
 // GetModels returns a list of available models from the API.
-func (companion *Companion) GetModels() ([]models.Model, error) {
+func (companion *Companion) GetModels(ctx context.Context) ([]models.Model, error) {
 	// Create and configure the HTTP request
-	req, err := http.NewRequest(http.MethodGet, companion.Config.ApiEndpoints.ApiModelsURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, companion.Config.ApiEndpoints.ApiModelsURL, nil)
 	if err != nil {
 		sideKick.Error(err)
 		return []models.Model{}, err
@@ -576,7 +900,81 @@ func (companion *Companion) GetModels() ([]models.Model, error) {
 	return originalResponse.Models, nil
 }
 
-// RunFunction executes a function with the provided payload.
-func (companion *Companion) RunFunction(tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
-	return sideKick.RunFunction(companion.HttpClient, tool, payload, companion.Config.Terminal.Debug, companion.Config.Terminal.Trace)
+// Unload unloads the model from the memory of the server, by sending an empty generate request with a
+// keep alive of 0. An empty model unloads the chat model.
+func (companion *Companion) Unload(ctx context.Context, model string) error {
+	if model == "" {
+		model = companion.Config.AiModels.ChatModel.Model
+	}
+	unload := float64(0)
+	payloadBytes, err := json.Marshal(CompletionRequest{Model: model, KeepAlive: &unload})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, companion.Config.ApiEndpoints.ApiGenerateURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		sideKick.Error(err)
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	sideKick.Debug(fmt.Sprintf("Unload: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return err
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// SetOnToolCall sets the hook asked before a tool is run, nil to run tools without asking.
+func (companion *Companion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.OnToolCall = hook
+}
+
+// SetToolRegistry sets the registry of tools implemented by Go functions.
+func (companion *Companion) SetToolRegistry(registry *tools.Registry) {
+	companion.ToolRegistry = registry
+}
+
+// RunFunction runs a function with the handler registered in the tool registry or, if there is none, by
+// sending the payload to the endpoint of the tool, with the timeout, retries and circuit breaker of
+// Config.ToolConfig.
+func (companion *Companion) RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	return sideKick.RunTool(ctx, sidekick.ToolRuntime{
+		HttpClient: companion.HttpClient,
+		Registry:   companion.ToolRegistry,
+		Config:     companion.Config.ToolConfig,
+		Breakers:   &companion.ToolBreakers,
+		OnToolCall: companion.OnToolCall,
+		Terminal:   companion.Config.Terminal,
+	}, tool, models.ToolCall{Payload: payload})
+}
+
+// moderate runs a message through the moderation endpoint and applies the configured action.
+func (companion *Companion) moderate(ctx context.Context, message models.Message) (models.Message, error) {
+	if strings.TrimSpace(message.Content) == "" {
+		return message, nil
+	}
+
+	response, err := companion.SendModerationRequest(ctx, models.ModerationRequest{Input: message.Content})
+	if err != nil {
+		sideKick.Error(err)
+		return message, err
+	}
+
+	moderated, err := sideKick.ApplyModeration(message, response, companion.Config.Moderation)
+	if err != nil {
+		sideKick.Error(err)
+	}
+	return moderated, err
 }
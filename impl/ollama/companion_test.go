@@ -0,0 +1,152 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/ollama"
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestSendModerationRequest(t *testing.T) {
+	tests := []struct {
+		verdict    string
+		flagged    bool
+		categories []string
+	}{
+		{"safe", false, nil},
+		{"unsafe\nS1,S10", true, []string{models.ModerationViolence, models.ModerationHate}},
+		{"unsafe\nS11", true, []string{models.ModerationSelfHarm}},
+	}
+
+	emulator := aicompaniontest.NewOllamaEmulator()
+	defer emulator.Close()
+	companion := emulator.Companion()
+
+	for _, test := range tests {
+		t.Run(test.verdict, func(t *testing.T) {
+			emulator.Verdict = test.verdict
+			response, err := companion.SendModerationRequest(context.Background(), models.ModerationRequest{Input: "some input"})
+			if err != nil {
+				t.Fatalf("moderation request failed: %v", err)
+			}
+
+			if response.Flagged != test.flagged {
+				t.Errorf("expected flagged %v, got %v", test.flagged, response.Flagged)
+			}
+			for _, category := range test.categories {
+				if !response.Categories[category] || response.CategoryScores[category] != 1 {
+					t.Errorf("expected category %s to be flagged", category)
+				}
+			}
+		})
+	}
+
+	t.Run("Test invalid verdict", func(t *testing.T) {
+		emulator.Verdict = "I cannot help with that"
+		if _, err := companion.SendModerationRequest(context.Background(), models.ModerationRequest{Input: "some input"}); err == nil {
+			t.Error("expected error for invalid verdict, got nil")
+		}
+	})
+}
+
+func TestStreamLargeLines(t *testing.T) {
+	emulator := aicompaniontest.NewOllamaEmulator()
+	defer emulator.Close()
+	companion := emulator.Companion()
+
+	// a single chunk beyond the 64 KB limit of bufio.Scanner
+	content := strings.Repeat("a", 200*1024)
+	line, _ := json.Marshal(map[string]any{"model": "llama", "message": models.Message{Role: models.Assistant, Content: content}, "done": true})
+
+	result, err := companion.HandleStreamResponse(context.Background(), aicompaniontest.StreamResponse(string(line)+"\n"), models.Chat, nil)
+	if err != nil || result.Content != content {
+		t.Errorf("expected the large chunk, got %d bytes: %v", len(result.Content), err)
+	}
+
+	config := companion.GetConfig()
+	config.HttpConfig.MaxLineSize = 1024
+	companion.SetConfig(config)
+	if _, err := companion.HandleStreamResponse(context.Background(), aicompaniontest.StreamResponse(string(line)+"\n"), models.Chat, nil); !errors.Is(err, sidekick.ErrLineTooLong) {
+		t.Errorf("expected sidekick.ErrLineTooLong, got %v", err)
+	}
+}
+
+func TestGenerationOptions(t *testing.T) {
+	emulator := aicompaniontest.NewOllamaEmulator("Hello")
+	defer emulator.Close()
+
+	temperature, topK := float32(0), 20
+	config := emulator.Config()
+	config.Generation = models.GenerationOptions{Temperature: &temperature, TopK: &topK, ContextSize: 8192}
+	companion := aicompanion.NewCompanion(config)
+	companion.SetHttpClient(emulator.Server.Client())
+
+	request := models.MessageRequest{
+		Message: models.Message{Role: models.User, Content: "Hi"},
+		Options: &models.GenerationOptions{TopK: new(int), MaxTokens: 64, Stop: []string{"\n\n"}},
+	}
+	if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+
+	requests := emulator.Requests()
+	var payload struct {
+		Options map[string]any `json:"options"`
+	}
+	if err := json.Unmarshal(requests[len(requests)-1].Body, &payload); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	expected := `{"num_ctx":8192,"num_predict":64,"stop":["\n\n"],"temperature":0,"top_k":0}`
+	if options, _ := json.Marshal(payload.Options); string(options) != expected {
+		t.Errorf("expected options %s, got %s", expected, options)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	emulator := aicompaniontest.NewOllamaEmulator()
+	defer emulator.Close()
+
+	config := emulator.Config()
+	config.Generation.KeepAlive = "10m"
+	companion := aicompanion.NewCompanion(config).(*ollama.Companion)
+	companion.SetHttpClient(emulator.Server.Client())
+
+	keepAlive := func() any {
+		requests := emulator.Requests()
+		var payload map[string]any
+		if err := json.Unmarshal(requests[len(requests)-1].Body, &payload); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		return payload["keep_alive"]
+	}
+
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}
+	if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if value := keepAlive(); value != float64(600) {
+		t.Errorf("expected the keep alive of the configuration, got %v", value)
+	}
+
+	request.Options = &models.GenerationOptions{KeepAlive: "-1"}
+	if _, err := companion.SendGenerateRequest(context.Background(), request, false, nil); err != nil {
+		t.Fatalf("generate request failed: %v", err)
+	}
+	if value := keepAlive(); value != float64(-1) {
+		t.Errorf("expected the keep alive of the request, got %v", value)
+	}
+
+	if err := companion.Unload(context.Background(), ""); err != nil {
+		t.Fatalf("unload failed: %v", err)
+	}
+	if value := keepAlive(); value != float64(0) {
+		t.Errorf("expected unload to send a keep alive of 0, got %v", value)
+	}
+}
@@ -0,0 +1,83 @@
+package ollama
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ModerationPrompt instructs general purpose models to judge an input like a guard model.
+// Guard models (llama-guard, shieldgemma, ...) receive the input as is, since their template holds the policy.
+const ModerationPrompt = `Check if there is unsafe content in the following user message according to the safety policy with the categories below.
+
+S1: Violent Crimes. S2: Non-Violent Crimes. S3: Sex-Related Crimes. S4: Child Sexual Exploitation.
+S5: Defamation. S6: Specialized Advice. S7: Privacy. S8: Intellectual Property. S9: Indiscriminate Weapons.
+S10: Hate. S11: Suicide & Self-Harm. S12: Sexual Content. S13: Elections. S14: Code Interpreter Abuse.
+
+User message:
+%s
+
+Provide your safety assessment: the first line must read 'safe' or 'unsafe'. If unsafe, the second line
+must contain a comma-separated list of the violated categories, e.g. S1,S10. Do not add anything else.`
+
+// guardCategories maps the hazard categories of guard models to moderation categories.
+var guardCategories = map[string]string{
+	"S1":  models.ModerationViolence,
+	"S2":  models.ModerationIllicit,
+	"S3":  models.ModerationSexual,
+	"S4":  models.ModerationSexualMinors,
+	"S5":  "defamation",
+	"S6":  "specialized-advice",
+	"S7":  "privacy",
+	"S8":  "intellectual-property",
+	"S9":  models.ModerationIllicitViolent,
+	"S10": models.ModerationHate,
+	"S11": models.ModerationSelfHarm,
+	"S12": models.ModerationSexual,
+	"S13": "elections",
+	"S14": "code-interpreter-abuse",
+}
+
+// isGuardModel reports whether a model judges inputs with a built-in safety policy.
+func isGuardModel(model string) bool {
+	model = strings.ToLower(model)
+	return strings.Contains(model, "guard") || strings.Contains(model, "shieldgemma")
+}
+
+// parseModerationVerdict parses a guard model verdict ("safe" or "unsafe" followed by category codes)
+// into flagged state, categories and scores. Scores are 1 for violated categories and 0 otherwise.
+func parseModerationVerdict(verdict string) (bool, map[string]bool, map[string]float64, error) {
+	categories := make(map[string]bool)
+	scores := make(map[string]float64)
+	for _, category := range guardCategories {
+		categories[category] = false
+		scores[category] = 0
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(verdict), func(r rune) bool {
+		return r == '\n' || r == ',' || r == ' ' || r == '\t' || r == '\r'
+	})
+	if len(fields) == 0 {
+		return false, nil, nil, fmt.Errorf("empty moderation verdict")
+	}
+
+	switch strings.Trim(fields[0], ".:") {
+	case "safe":
+		return false, categories, scores, nil
+	case "unsafe":
+	default:
+		return false, nil, nil, fmt.Errorf("unexpected moderation verdict: %q", verdict)
+	}
+
+	for _, field := range fields[1:] {
+		category, exists := guardCategories[strings.ToUpper(strings.Trim(field, ".:"))]
+		if !exists {
+			continue
+		}
+		categories[category] = true
+		scores[category] = 1
+	}
+
+	return true, categories, scores, nil
+}
@@ -3,6 +3,8 @@
 package ollama
 
 import (
+	"encoding/json"
+	"reflect"
 	"time"
 
 	"github.com/ghmer/aicompanion/models"
@@ -15,17 +17,97 @@ type CompletionRequest struct {
 	Prompt    string                `json:"prompt,omitempty"`
 	Suffix    string                `json:"suffix,omitempty"`
 	Images    *[]models.Base64Image `json:"images,omitempty"`
-	Format    string                `json:"format,omitempty"`
-	Options   string                `json:"options,omitempty"`
+	Format    any                   `json:"format,omitempty"` // "json" or the schema of the response
+	Options   *Options              `json:"options,omitempty"`
 	System    string                `json:"system,omitempty"`
 	Template  string                `json:"template,omitempty"`
 	Stream    bool                  `json:"stream"`
 	Raw       bool                  `json:"raw,omitempty"`
-	KeepAlive int64                 `json:"keep_alive,omitempty"`
+	KeepAlive *float64              `json:"keep_alive,omitempty"` // Seconds the model stays loaded, negative keeps it loaded
 	Context   string                `json:"context,omitempty"`
 	Tools     []models.Function     `json:"tools,omitempty"`
 }
 
+// Options are the runtime options of the model.
+type Options struct {
+	NumCtx        int      `json:"num_ctx,omitempty"` // Size of the context window
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	TopP          *float32 `json:"top_p,omitempty"`
+	RepeatPenalty *float32 `json:"repeat_penalty,omitempty"`
+	NumPredict    int      `json:"num_predict,omitempty"` // Maximum number of tokens to generate, -1 is unlimited
+	Stop          []string `json:"stop,omitempty"`
+}
+
+// newOptions converts generation options into the runtime options of the API, or nil if none is set.
+func newOptions(options models.GenerationOptions) *Options {
+	converted := Options{
+		NumCtx:        options.ContextSize,
+		Temperature:   options.Temperature,
+		TopK:          options.TopK,
+		TopP:          options.TopP,
+		RepeatPenalty: options.RepeatPenalty,
+		NumPredict:    options.MaxTokens,
+		Stop:          options.Stop,
+	}
+	if reflect.ValueOf(converted).IsZero() {
+		return nil
+	}
+	return &converted
+}
+
+// newKeepAlive converts the keep alive of generation options into seconds, or nil if it is not set or
+// invalid.
+func newKeepAlive(options models.GenerationOptions) *float64 {
+	if options.KeepAlive == "" {
+		return nil
+	}
+	duration, err := models.ParseKeepAlive(options.KeepAlive)
+	if err != nil {
+		return nil
+	}
+	seconds := duration.Seconds()
+	return &seconds
+}
+
+// jsonFormat demands any valid JSON as response.
+const jsonFormat = "json"
+
+// newFormat converts a response format into the format of the API: the schema of JSONSchema responses,
+// and "json" otherwise.
+func newFormat(format *models.ResponseFormat) any {
+	if format == nil {
+		return nil
+	}
+	if format.Type == models.JSONSchema && format.Schema != nil {
+		return format.Schema
+	}
+	return jsonFormat
+}
+
+// chatMessage is a message as sent to the API, which names the function a tool result answers by
+// tool_name.
+type chatMessage struct {
+	models.Message
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// MarshalJSON serializes the request with its messages in the format of the API.
+func (request CompletionRequest) MarshalJSON() ([]byte, error) {
+	type plain CompletionRequest
+	messages := make([]chatMessage, len(request.Messages))
+	for i, message := range request.Messages {
+		messages[i].Message = message
+		if message.Role == models.ToolRole {
+			messages[i].ToolName = message.Name
+		}
+	}
+	return json.Marshal(struct {
+		plain
+		Messages []chatMessage `json:"messages,omitempty"`
+	}{plain(request), messages})
+}
+
 // ModelResponse represents the response structure for the models endpoint.
 type ModelResponse struct {
 	Models []models.Model `json:"models"`
@@ -56,6 +138,34 @@ type CompletionResponse struct {
 	Context []int `json:"context,omitempty"`
 }
 
+// annotate sets the creation time, model, token counts and finish reason of a finished response on a message.
+func (response CompletionResponse) annotate(message *models.Message) {
+	message.Model = response.Model
+	message.CreatedAt = response.CreatedAt
+	if response.PromptEvalCount > 0 || response.EvalCount > 0 {
+		message.Usage = &models.Usage{
+			PromptTokens:     response.PromptEvalCount,
+			CompletionTokens: response.EvalCount,
+			TotalTokens:      response.PromptEvalCount + response.EvalCount,
+		}
+	}
+	message.FinishReason = response.finishReason(len(message.ToolCalls) > 0)
+}
+
+// finishReason returns the finish reason of a finished response. Ollama reports "stop" for responses
+// with tool calls, so those are told apart by toolCalls.
+func (response CompletionResponse) finishReason(toolCalls bool) models.FinishReason {
+	switch {
+	case !response.Done:
+		return ""
+	case toolCalls:
+		return models.FinishToolCalls
+	case response.DoneReason == "":
+		return models.FinishStop
+	}
+	return models.FinishReason(response.DoneReason)
+}
+
 // CreateModelRequest represents the request structure for the /api/models/create endpoint.
 type CreateModelRequest struct {
 	Model     string `json:"model"`
@@ -0,0 +1,25 @@
+package ollama_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/ollama"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestToolMessageSerialization(t *testing.T) {
+	data, err := json.Marshal(ollama.CompletionRequest{Model: "llama3.2", Messages: []models.Message{
+		{Role: models.Assistant, ToolCalls: []models.ToolCall{{Payload: models.FunctionPayload{FunctionName: "weather", Arguments: map[string]any{"city": "Berlin"}}}}},
+		{Role: models.ToolRole, Content: "sunny", ToolCallID: "call_1", Name: "weather"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"model":"llama3.2"`, `"tool_calls":[{"function":{"name":"weather","arguments":{"city":"Berlin"}}}]`, `"role":"tool","content":"sunny","tool_call_id":"call_1","name":"weather","tool_name":"weather"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected %s in %s", expected, data)
+		}
+	}
+}
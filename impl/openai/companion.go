@@ -1,18 +1,23 @@
 package openai
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
 	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
 	"github.com/ghmer/aicompanion/models"
 	"github.com/ghmer/aicompanion/terminal"
+	"github.com/ghmer/aicompanion/tools"
 )
 
 var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
@@ -23,6 +28,23 @@ type Companion struct {
 	SystemRole   models.Message
 	Conversation []models.Message
 	HttpClient   *http.Client
+	VectorDb     vectordb.VectorDb          // Source of the context of RAG requests
+	Sessions     conversationstore.Sessions // Named conversations, see SwitchSession
+	ToolRegistry *tools.Registry            // Tools implemented by Go functions, run before Tool endpoints
+	ToolBreakers sidekick.CircuitBreakers   // Circuit breakers of the tools, see models.ToolConfiguration
+	Usage        sidekick.UsageCounter      // Tokens of the responses, see GetUsage
+	OnToolCall   models.ToolCallHook        // Asked before a tool is run, if set
+	Extension    Extension                  // Optional adaptations for OpenAI compatible providers
+	// Embed replaces SendEmbeddingRequest for retrieval, e.g. for wrappers using a native embedding endpoint.
+	Embed func(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error)
+}
+
+// embed returns the function that embeds queries for retrieval.
+func (companion *Companion) embed() func(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+	if companion.Embed != nil {
+		return companion.Embed
+	}
+	return companion.SendEmbeddingRequest
 }
 
 // SetEnrichmentPrompt sets a new enrichment prompt for the companion.
@@ -80,6 +102,112 @@ func (companion *Companion) SetConversation(conversation []models.Message) {
 	companion.Conversation = conversation
 }
 
+// PinMessage pins or unpins the message of the conversation at index. Pinned messages are always sent
+// along with requests, regardless of Config.MaxMessages and Config.MaxContextTokens.
+func (companion *Companion) PinMessage(index int, pinned bool) error {
+	return sideKick.PinMessage(companion.Conversation, index, pinned)
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (companion *Companion) PinMessageByID(id string, pinned bool) error {
+	return sideKick.PinMessageByID(companion.Conversation, id, pinned)
+}
+
+// RemoveLastExchange removes the last user message and all messages following it, such as the reply and
+// tool results, and returns them. It rolls back a turn that was aborted or failed, e.g. by a stream that
+// errored mid-way. A conversation without user messages is left unchanged.
+func (companion *Companion) RemoveLastExchange() []models.Message {
+	var removed []models.Message
+	companion.Conversation, removed = sideKick.RemoveLastExchange(companion.Conversation)
+	return removed
+}
+
+// TruncateAfter removes the messages following index from the conversation. An index of -1 removes all
+// messages.
+func (companion *Companion) TruncateAfter(index int) error {
+	conversation, err := sideKick.TruncateAfter(companion.Conversation, index)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ExportConversation writes the conversation as transcript in the given format. Images of Markdown
+// transcripts are written to Config.ImageDir. The transcript is encrypted if Config.EncryptionKey is set.
+func (companion *Companion) ExportConversation(w io.Writer, format models.ConversationFormat) error {
+	return sideKick.ExportConversation(w, companion.Conversation, format, companion.Config.ImageDir, companion.Config.EncryptionKey)
+}
+
+// ImportConversation replaces the conversation with a JSON or Markdown transcript, which is decrypted
+// with Config.EncryptionKey if it is encrypted.
+func (companion *Companion) ImportConversation(r io.Reader) error {
+	conversation, err := sideKick.ImportConversation(r, companion.Config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// SetConversationStore sets the store keeping the conversations of the sessions that are not current.
+func (companion *Companion) SetConversationStore(store conversationstore.Store) {
+	companion.Sessions.Store = store
+}
+
+// CurrentSession returns the name of the current session.
+func (companion *Companion) CurrentSession() string {
+	return companion.Sessions.Current()
+}
+
+// SwitchSession saves the conversation under the current session and continues the named session.
+func (companion *Companion) SwitchSession(name string) error {
+	conversation, err := companion.Sessions.Switch(name, companion.Conversation)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ListSessions returns the names of all sessions.
+func (companion *Companion) ListSessions() ([]string, error) {
+	return companion.Sessions.List()
+}
+
+// SearchSessions saves the conversation under the current session and searches the messages of all
+// sessions. The conversation store has to implement conversationstore.Searcher.
+func (companion *Companion) SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error) {
+	return companion.Sessions.Search(companion.Conversation, query, limit)
+}
+
+// DeleteSession deletes the named session. Deleting the current session clears the conversation.
+func (companion *Companion) DeleteSession(name string) error {
+	current, err := companion.Sessions.Delete(name)
+	if err != nil {
+		return err
+	}
+	if current {
+		companion.Conversation = make([]models.Message, 0)
+	}
+	return nil
+}
+
+// GetUsage returns the tokens of the responses of the companion, in total, per session and per model.
+func (companion *Companion) GetUsage() models.UsageReport {
+	return companion.Usage.Report()
+}
+
+// recordUsage adds the usage of a response to the current session and sets its estimated cost.
+func (companion *Companion) recordUsage(response *models.Message) {
+	model := response.Model
+	if model == "" {
+		model = companion.Config.AiModels.ChatModel.Model
+	}
+	response.Cost = sidekick.CostEstimator{Pricing: companion.Config.Pricing}.Estimate(model, response.Usage)
+	companion.Usage.Record(companion.Sessions.Current(), model, response.Usage, response.Cost)
+}
+
 // GetClient returns the current HTTP client of the companion.
 func (companion *Companion) GetHttpClient() *http.Client {
 	return companion.HttpClient
@@ -90,9 +218,35 @@ func (companion *Companion) SetHttpClient(client *http.Client) {
 	companion.HttpClient = client
 }
 
-// prepareConversation prepares the conversation by appending system role and current conversation messages.
+// SetVectorDB sets the vector database used by SendRAGRequest.
+func (companion *Companion) SetVectorDB(vectorDb vectordb.VectorDb) {
+	companion.VectorDb = vectorDb
+}
+
+// GetVectorDB returns the vector database used by SendRAGRequest.
+func (companion *Companion) GetVectorDB() vectordb.VectorDb {
+	return companion.VectorDb
+}
+
+// PrepareConversation prepares the conversation by appending system role and current conversation messages.
 func (companion *Companion) PrepareConversation(message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
-	messages := append([]models.Message{companion.GetSystemRole()}, sideKick.PrepareArray(companion.Conversation, includeStrategy, companion.Config.MaxMessages)...)
+	return companion.prepareConversation(context.Background(), message, includeStrategy)
+}
+
+// prepareConversation is PrepareConversation for a request, which cancels summarizing the history with ctx.
+func (companion *Companion) prepareConversation(ctx context.Context, message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	systemRole := companion.GetSystemRole()
+	history := sideKick.SelectContext(companion.Config.ContextStrategy, sidekick.ContextRequest{
+		Context:         ctx,
+		Conversation:    companion.Conversation,
+		IncludeStrategy: includeStrategy,
+		MaxMessages:     companion.Config.MaxMessages,
+		MaxTokens:       companion.Config.MaxContextTokens,
+		Reserved:        []models.Message{systemRole, message},
+		Summarize:       sideKick.NewSummarizer(companion.SendGenerateRequest),
+	})
+
+	messages := append([]models.Message{systemRole}, history...)
 	messages = append(messages, message)
 
 	return messages
@@ -100,11 +254,11 @@ func (companion *Companion) PrepareConversation(message models.Message, includeS
 
 // addmodels.Message adds the given models.Message to the conversation history.
 func (companion *Companion) AddMessage(message models.Message) {
-	companion.Conversation = append(companion.Conversation, message)
+	companion.Conversation = append(companion.Conversation, sideKick.StampMessage(message))
 }
 
 // SendEmbeddingRequest sends a request to the OpenAI API to generate embeddings for a given text input.
-func (companion *Companion) SendEmbeddingRequest(embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+func (companion *Companion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
 	var embeddingResponse models.EmbeddingResponse
 
 	// Marshal the payload into JSON
@@ -115,17 +269,17 @@ func (companion *Companion) SendEmbeddingRequest(embedding models.EmbeddingReque
 	}
 	sideKick.Trace(fmt.Sprintf("SendEmbeddingRequest: payload: %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiEmbedURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiEmbedURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return embeddingResponse, err
@@ -188,7 +342,7 @@ func (companion *Companion) convertToModelEmbeddingResponse(response EmbeddingRe
 }
 
 // SendModerationRequest sends a request to the OpenAI API to moderate a given text input.
-func (companion *Companion) SendModerationRequest(moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+func (companion *Companion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
 	var moderationResponse models.ModerationResponse
 
 	// Marshal the payload into JSON
@@ -198,19 +352,19 @@ func (companion *Companion) SendModerationRequest(moderationRequest models.Moder
 		return moderationResponse, err
 	}
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	sideKick.Trace(fmt.Sprintf("SendModerationRequest: payload %s", string(payloadBytes)), companion.Config.Terminal)
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiModerationURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiModerationURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return moderationResponse, err
@@ -259,68 +413,179 @@ func (companion *Companion) SendModerationRequest(moderationRequest models.Moder
 		OriginalResponse: originalResponse,
 	}
 
+	if len(originalResponse.Results) > 0 {
+		moderationResponse.Flagged = originalResponse.Results[0].Flagged
+		moderationResponse.Categories, moderationResponse.CategoryScores = originalResponse.Results[0].categoryMaps()
+	}
+
 	return moderationResponse, nil
 }
 
 // SendGenerateRequest sends a request to the OpenAI API to generate a completion for a given prompt.
-func (companion *Companion) SendGenerateRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
-	return companion.sendCompletionRequest(message, streaming, true, callback)
+func (companion *Companion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	return companion.sendCompletionRequest(ctx, message, streaming, true, callback)
+}
+
+// SendRAGRequest retrieves documents matching the message from the vector database, adds them as context
+// using the enrichment prompt and sends the result as chat request. The conversation keeps the original message.
+func (companion *Companion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request, err := sideKick.PrepareRAGRequest(ctx, companion.VectorDb, companion.embed(), companion.Config, message, options)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	return companion.SendChatRequest(ctx, request, streaming, callback)
 }
 
 // ProcessUserInput processes the user input by sending it to the API and handling the response.
-func (companion *Companion) SendChatRequest(message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
-	return companion.sendCompletionRequest(message, streaming, false, callback)
+func (companion *Companion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	if companion.Config.Moderation.Enabled {
+		moderated, err := companion.moderate(ctx, message.Message)
+		if err != nil {
+			return models.Message{}, err
+		}
+		message.Message = moderated
+	}
+
+	if companion.Config.ActivePersona.UseKnowledge {
+		enriched, err := sideKick.PrepareKnowledgeRequest(ctx, companion.VectorDb, companion.embed(), companion.Config, message)
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		message = enriched
+	}
+
+	return companion.sendCompletionRequest(ctx, message, streaming, false, callback)
+}
+
+// moderate runs a message through the moderation endpoint and applies the configured action.
+func (companion *Companion) moderate(ctx context.Context, message models.Message) (models.Message, error) {
+	if strings.TrimSpace(message.Content) == "" {
+		return message, nil
+	}
+
+	response, err := companion.SendModerationRequest(ctx, models.ModerationRequest{Input: message.Content})
+	if err != nil {
+		sideKick.Error(err)
+		return message, err
+	}
+
+	moderated, err := sideKick.ApplyModeration(message, response, companion.Config.Moderation)
+	if err != nil {
+		sideKick.Error(err)
+	}
+	return moderated, err
 }
 
-func (companion *Companion) SendToolRequest(message models.MessageRequest) (models.Message, error) {
+// SendToolRequest sends the message with the conversation, offering the tools of the request, of the
+// tool registry and of Config.Tools. Tool calls of the model are run with RunFunction and their results
+// sent back as tool messages, until the model answers without calling tools. If the model calls a
+// function that is neither registered nor implemented by Config.Tools, the response carrying the tool
+// calls is returned instead. The message, the
+// tool calls and results and the response are added to the conversation.
+func (companion *Companion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	tools := sideKick.ToolDefinitions(append(message.Tools, companion.ToolRegistry.Definitions()...), companion.Config.Tools)
+	messages := companion.prepareConversation(ctx, message.Message, companion.Config.IncludeStrategy)
+
+	// the system prompt or persona of the request replaces the system role for this request only
+	systemRole, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	messages[0] = systemRole
+
+	exchange, err := sideKick.RunToolLoop(messages, func(messages []models.Message) (models.Message, error) {
+		return companion.sendToolRound(ctx, message, messages, tools)
+	}, func(calls []models.ToolCall) ([]models.Message, bool) {
+		return sideKick.RunToolCalls(ctx, companion.toolRuntime(), calls)
+	})
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	switch message.RetainOriginalMessage {
+	case true:
+		companion.AddMessage(message.OriginalMessage)
+	case false:
+		companion.AddMessage(message.Message)
+	}
+	for _, response := range exchange {
+		companion.AddMessage(response)
+	}
+
+	return exchange[len(exchange)-1], nil
+}
+
+// toolRuntime returns what tool calls are run with.
+func (companion *Companion) toolRuntime() sidekick.ToolRuntime {
+	return sidekick.ToolRuntime{
+		HttpClient: companion.HttpClient,
+		Registry:   companion.ToolRegistry,
+		Tools:      companion.Config.Tools,
+		Config:     companion.Config.ToolConfig,
+		Breakers:   &companion.ToolBreakers,
+		OnToolCall: companion.OnToolCall,
+		Terminal:   companion.Config.Terminal,
+	}
+}
+
+// sendToolRound sends messages and the tools in a chat request and returns the response. The response
+// format and the generation options are taken from the message request.
+func (companion *Companion) sendToolRound(ctx context.Context, message models.MessageRequest, messages []models.Message, tools []models.Function) (models.Message, error) {
 	var result models.Message
 	var payload ChatRequest = ChatRequest{
-		Model:    companion.Config.AiModels.ChatModel.Model,
-		Messages: []models.Message{message.Message},
-		Stream:   false,
-		Tools:    message.Tools,
+		Model:          companion.Config.AiModels.ChatModel.Model,
+		Messages:       messages,
+		Stream:         false,
+		Tools:          tools,
+		ResponseFormat: newResponseFormat(message.ResponseFormat),
 	}
+	payload.applyOptions(companion.Config.Generation.Merge(message.Options))
+	header := companion.prepareRequest(&payload)
 
 	// Marshal the payload into JSON
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		sideKick.Error(err)
 		return result, err
 	}
 
 	sideKick.Trace(fmt.Sprintf("SendToolRequest: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
-		sideKick.Error(err)
 		return result, err
 	}
 	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
 	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
 
 	// Execute the HTTP request
 	resp, err := companion.HttpClient.Do(req)
 	if err != nil {
-		sideKick.Error(err)
-		return models.Message{}, err
+		return result, err
 	}
 	defer resp.Body.Close()
 
 	sideKick.Debug(fmt.Sprintf("SendToolRequest: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
 	err = sideKick.VerifyStatus(resp)
 	if err != nil {
-		sideKick.Error(err)
-		return models.Message{}, err
+		return result, err
 	}
 
 	if companion.Config.Terminal.Output {
@@ -328,11 +593,9 @@ func (companion *Companion) SendToolRequest(message models.MessageRequest) (mode
 		sideKick.ClearLine(companion.Config.Terminal)
 	}
 
-	// Process the streaming response
 	var bodyBytes []byte
 	bodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
-		sideKick.Error(err)
 		return result, err
 	}
 
@@ -341,13 +604,16 @@ func (companion *Companion) SendToolRequest(message models.MessageRequest) (mode
 	var completionResponse ChatResponse
 	err = json.Unmarshal(bodyBytes, &completionResponse)
 	if err != nil {
-		sideKick.Error(err)
 		return result, err
 	}
+	if len(completionResponse.Choices) == 0 {
+		return result, fmt.Errorf("response contains no choices")
+	}
 
-	choice := completionResponse.Choices[0].Message
+	choice := completionResponse.Choices[0]
+	sideKick.Debug(fmt.Sprintf("SendToolRequest: finish reason %s, %d tool calls", choice.FinishReason, len(choice.Message.ToolCalls)), companion.Config.Terminal)
 	var genericToolCalls []models.ToolCall
-	for _, toolCall := range choice.ToolCalls {
+	for _, toolCall := range choice.Message.ToolCalls {
 		genericToolCall, err := toolCall.TransformToModel()
 		if err != nil {
 			return result, err
@@ -355,36 +621,62 @@ func (companion *Companion) SendToolRequest(message models.MessageRequest) (mode
 
 		genericToolCalls = append(genericToolCalls, genericToolCall)
 	}
+	if choice.FinishReason == FinishToolCalls && len(genericToolCalls) == 0 {
+		return result, fmt.Errorf("response finished with tool calls, but contains none")
+	}
 
 	result = models.Message{
-		Role:            choice.Role,
-		Content:         choice.Content,
-		Images:          choice.Images,
-		AlternatePrompt: choice.AlternatePrompt,
+		Role:            models.Assistant,
+		Content:         choice.Message.Content,
+		Images:          choice.Message.Images,
+		AlternatePrompt: choice.Message.AlternatePrompt,
 		ToolCalls:       genericToolCalls,
+		Reasoning:       choice.Message.ReasoningContent,
+		Info:            companion.newResponseInfo(resp.Header),
 	}
+	result.Info.Model = completionResponse.Model
+	completionResponse.annotate(&result)
+	companion.handleResponse(resp.Header, bodyBytes, result.Info)
+	companion.recordUsage(&result)
 	return result, nil
-
 }
 
-func (companion *Companion) sendCompletionRequest(message models.MessageRequest, streaming bool, useGeneratePrompt bool, callback func(m models.Message) error) (models.Message, error) {
+func (companion *Companion) sendCompletionRequest(ctx context.Context, message models.MessageRequest, streaming bool, useGeneratePrompt bool, callback func(m models.Message) error) (models.Message, error) {
 	var result models.Message
 	var payload ChatRequest = ChatRequest{
-		Model:    companion.Config.AiModels.ChatModel.Model,
-		Messages: companion.PrepareConversation(message.Message, companion.Config.IncludeStrategy),
-		Stream:   streaming,
-		Tools:    message.Tools,
+		Model:          companion.Config.AiModels.ChatModel.Model,
+		Stream:         streaming,
+		Tools:          message.Tools,
+		ResponseFormat: newResponseFormat(message.ResponseFormat),
+	}
+	payload.applyOptions(companion.Config.Generation.Merge(message.Options))
+	if streaming {
+		// without it, streamed responses report no usage
+		payload.StreamOptions = &StreamOptions{IncludeUsage: true}
 	}
 
+	// the system prompt or persona of the request replaces the system role for this request only
+	systemRole, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return result, err
+	}
+
+	// generate requests are sent without the conversation, so they do not select its context; this also
+	// keeps the summary requests of the summarize strategy from recursing
 	sideKick.Debug(fmt.Sprintf("sendCompletionRequest: useGeneratePrompt: %v", useGeneratePrompt), companion.Config.Terminal)
 	if useGeneratePrompt {
-		sysmsg := companion.GetSystemRole()
+		sysmsg := systemRole
 		sideKick.Debug(fmt.Sprintf("sendCompletionRequest: sysmsg: %v", sysmsg), companion.Config.Terminal)
 		if len(message.Message.AlternatePrompt) > 0 {
 			sysmsg = sideKick.CreateMessage(models.System, message.Message.AlternatePrompt)
 		}
 		payload.Messages = []models.Message{sysmsg, message.Message}
+	} else {
+		payload.Messages = companion.prepareConversation(ctx, message.Message, companion.Config.IncludeStrategy)
+		payload.Messages[0] = systemRole
 	}
+	header := companion.prepareRequest(&payload)
 
 	// Marshal the payload into JSON
 	payloadBytes, err := json.Marshal(payload)
@@ -395,23 +687,26 @@ func (companion *Companion) sendCompletionRequest(message models.MessageRequest,
 
 	sideKick.Trace(fmt.Sprintf("sendCompletionRequest: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
 
-	var ctx context.Context
+	var spinnerCtx context.Context
 	var cancel context.CancelFunc
 	if companion.Config.Terminal.Output {
-		ctx, cancel = context.WithCancel(context.Background())
+		spinnerCtx, cancel = context.WithCancel(ctx)
 		cs := terminal.NewSpinningCharacter('?', 100, 10)
-		cs.StartSpinning(ctx)
+		cs.StartSpinning(spinnerCtx)
 		defer cancel()
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiChatURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		sideKick.Error(err)
 		return result, err
 	}
 	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
 	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
 
 	// Execute the HTTP request
 	resp, err := companion.HttpClient.Do(req)
@@ -435,7 +730,7 @@ func (companion *Companion) sendCompletionRequest(message models.MessageRequest,
 
 	// Process the streaming response
 	if streaming {
-		result, err = companion.HandleStreamResponse(resp, models.Chat, callback)
+		result, err = companion.HandleStreamResponse(ctx, resp, models.Chat, callback)
 		if err != nil {
 			sideKick.Error(err)
 			return result, err
@@ -457,25 +752,27 @@ func (companion *Companion) sendCompletionRequest(message models.MessageRequest,
 			return result, err
 		}
 
-		choice := completionResponse.Choices[0].Message
-		var genericToolCalls []models.ToolCall
-		for _, toolCall := range choice.ToolCalls {
-			genericToolCall, err := toolCall.TransformToModel()
+		info := companion.newResponseInfo(resp.Header)
+		info.Model = completionResponse.Model
+		candidates := make([]models.Message, 0, len(completionResponse.Choices))
+		for i, choice := range completionResponse.Choices {
+			candidate, err := choice.Message.TransformToModel()
 			if err != nil {
 				return result, err
 			}
-
-			genericToolCalls = append(genericToolCalls, genericToolCall)
+			candidate.Info = info
+			completionResponse.annotateChoice(&candidate, i)
+			candidates = append(candidates, candidate)
 		}
+		companion.handleResponse(resp.Header, bodyBytes, info)
 
-		result = models.Message{
-			Role:            choice.Role,
-			Content:         choice.Content,
-			Images:          choice.Images,
-			AlternatePrompt: choice.AlternatePrompt,
-			ToolCalls:       genericToolCalls,
+		result, err = sidekick.SelectChoice(ctx, message, candidates)
+		if err != nil {
+			sideKick.Error(err)
+			return result, err
 		}
 	}
+	companion.recordUsage(&result)
 
 	if !useGeneratePrompt {
 		switch message.RetainOriginalMessage {
@@ -491,90 +788,169 @@ func (companion *Companion) sendCompletionRequest(message models.MessageRequest,
 	return result, nil
 }
 
-func (companion *Companion) HandleStreamResponse(resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			err = fmt.Errorf("unexpected HTTP status: %s, and failed to read body: %v", resp.Status, err)
-			sideKick.Error(err)
-			return models.Message{}, err
-		}
-		err = fmt.Errorf("unexpected HTTP status: %s, body: %s", resp.Status, string(bodyBytes))
+// HandleStreamResponse reads a streamed chat response and passes each delta to callback. The last delta is
+// held back until the usage chunk that follows it, and carries the model, usage and finish reason. If the
+// stream is cancelled, by ctx or an error of callback, the message received until then is returned with
+// Cancelled set, along with the error.
+func (companion *Companion) HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
 		sideKick.Error(err)
 		return models.Message{}, err
 	}
 
 	var message strings.Builder
-	var result models.Message
+	var reasoning strings.Builder
 	var finalErr error
+	var last ChatResponse
+	var usage *Usage
+	var finish string
+	var final *models.Message // last chunk, passed on at the end of the stream
+	var assembler toolCallAssembler
+	var logProbs []models.TokenLogProb
+	info := companion.newResponseInfo(resp.Header)
+
+	// partial returns the message received until the stream was cancelled
+	partial := func() models.Message {
+		cancelled := sideKick.CreateAssistantMessage(message.String())
+		cancelled.Reasoning = reasoning.String()
+		cancelled.Info = info
+		last.annotate(&cancelled)
+		cancelled.LogProbs = logProbs
+		cancelled.Cancelled = true
+		return cancelled
+	}
 
 	sideKick.Print("> ", companion.Config.Terminal)
 
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		sideKick.Trace(fmt.Sprintf("HandleStreamResponse: line: %s", line), companion.Config.Terminal)
-		if len(line) == 0 {
-			continue
+	decoder := sidekick.NewSSEDecoderSize(resp.Body, companion.Config.HttpConfig.MaxLineSize)
+	for {
+		// stop reading once the request is cancelled
+		if err := ctx.Err(); err != nil {
+			sideKick.Error(err)
+			return partial(), err
 		}
-
-		if line == "[DONE]" {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && ctx.Err() != nil {
+			sideKick.Error(ctx.Err())
+			return partial(), ctx.Err()
+		}
+		if err != nil {
+			finalErr = fmt.Errorf("failed to read stream: %w", err)
+			sideKick.Error(finalErr)
 			break
 		}
+		data := []byte(event.Data)
+		sideKick.Trace(fmt.Sprintf("HandleStreamResponse: event %s: %s", event.Event, event.Data), companion.Config.Terminal)
 
-		line = strings.TrimPrefix(line, "data:")
 		var responseObject ChatResponse
-		if err := json.Unmarshal([]byte(line), &responseObject); err != nil {
-			finalErr = fmt.Errorf("failed to unmarshal line: %v, error: %w", line, err)
+		if err := json.Unmarshal(data, &responseObject); err != nil {
+			finalErr = fmt.Errorf("failed to unmarshal event: %s, error: %w", event.Data, err)
 			sideKick.Error(finalErr)
 			break
 		}
 
+		if responseObject.Error != nil || event.Event == "error" {
+			finalErr = responseObject.Error.err(event.Data)
+			sideKick.Error(finalErr)
+			break
+		}
+
+		if responseObject.Model != "" {
+			info.Model = responseObject.Model
+		}
+		companion.handleResponse(resp.Header, data, info)
+		if responseObject.Usage != nil {
+			usage = responseObject.Usage
+		}
+
+		// with stream_options.include_usage, the usage follows in a last chunk without choices
 		if len(responseObject.Choices) == 0 {
+			if responseObject.Usage != nil {
+				continue
+			}
 			finalErr = fmt.Errorf("no choices in response")
 			sideKick.Error(finalErr)
 			break
 		}
+		last = responseObject
 
 		choice := responseObject.Choices[0]
 
 		switch streamType {
 		case models.Chat:
+			message.WriteString(choice.Delta.Content)
+			reasoning.WriteString(choice.Delta.ReasoningContent)
+			assembler.add(choice.Delta.ToolCalls)
+			sideKick.Print(choice.Delta.Content, companion.Config.Terminal)
 			msg := sideKick.CreateAssistantMessage(choice.Delta.Content)
+			msg.Reasoning = choice.Delta.ReasoningContent
+			if choice.LogProbs != nil {
+				msg.LogProbs = choice.LogProbs.Content
+				logProbs = append(logProbs, choice.LogProbs.Content...)
+			}
+			if choice.FinishReason != "" {
+				// the last chunk is passed on at the end of the stream, once the usage is known
+				finish = choice.FinishReason
+				final = &msg
+				continue
+			}
 			if callback != nil {
 				if err := callback(msg); err != nil {
 					finalErr = fmt.Errorf("callback error: %w", err)
 					sideKick.Error(finalErr)
-					return models.Message{}, finalErr
+					return partial(), finalErr
 				}
 			}
-			message.WriteString(choice.Delta.Content)
-			sideKick.Print(choice.Delta.Content, companion.Config.Terminal)
 		default:
 			finalErr = fmt.Errorf("unsupported stream type: %v", streamType)
 			sideKick.Error(finalErr)
 			return models.Message{}, finalErr
 		}
-
-		if choice.FinishReason == "stop" {
-			result = sideKick.CreateAssistantMessage(message.String())
-			sideKick.Println("", companion.Config.Terminal)
-			break
-		}
+	}
+	if finalErr != nil {
+		return models.Message{}, finalErr
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		finalErr = fmt.Errorf("scanner error: %w", err)
-		sideKick.Error(finalErr)
+	toolCalls, err := assembler.toolCalls()
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	last.Usage = usage
+	result := sideKick.CreateAssistantMessage(message.String())
+	result.ToolCalls = toolCalls
+	result.Reasoning = reasoning.String()
+	result.Info = info
+	last.annotate(&result)
+	result.FinishReason = finishReason(finish)
+	result.LogProbs = logProbs
+	sideKick.Println("", companion.Config.Terminal)
+
+	if final != nil && callback != nil {
+		final.ID = result.ID
+		final.Model = result.Model
+		final.Usage = result.Usage
+		final.Info = result.Info
+		final.FinishReason = result.FinishReason
+		if err := callback(*final); err != nil {
+			err = fmt.Errorf("callback error: %w", err)
+			sideKick.Error(err)
+			return partial(), err
+		}
 	}
 
-	return result, finalErr
+	return result, nil
 }
 
 // GetModels retrieves a list of available models from the API.
-func (companion *Companion) GetModels() ([]models.Model, error) {
+func (companion *Companion) GetModels(ctx context.Context) ([]models.Model, error) {
 	// Create and configure the HTTP request
-	req, err := http.NewRequest(http.MethodGet, companion.Config.ApiEndpoints.ApiModelsURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, companion.Config.ApiEndpoints.ApiModelsURL, nil)
 	if err != nil {
 		sideKick.Error(err)
 		return []models.Model{}, err
@@ -635,7 +1011,99 @@ func (companion *Companion) GetModels() ([]models.Model, error) {
 	return transformedModels, nil
 }
 
-// RunFunction executes a function with the provided payload.
-func (companion *Companion) RunFunction(tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
-	return sideKick.RunFunction(companion.HttpClient, tool, payload, companion.Config.Terminal.Debug, companion.Config.Terminal.Trace)
+// SetOnToolCall sets the hook asked before a tool is run, nil to run tools without asking.
+func (companion *Companion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.OnToolCall = hook
+}
+
+// SetToolRegistry sets the registry of tools implemented by Go functions.
+func (companion *Companion) SetToolRegistry(registry *tools.Registry) {
+	companion.ToolRegistry = registry
+}
+
+// RunFunction runs a function with the handler registered in the tool registry or, if there is none, by
+// sending the payload to the endpoint of the tool, with the timeout, retries and circuit breaker of
+// Config.ToolConfig.
+func (companion *Companion) RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	return sideKick.RunTool(ctx, companion.toolRuntime(), tool, models.ToolCall{Payload: payload})
+}
+
+// Transcribe sends an audio chunk to the OpenAI transcription API and returns the transcribed text
+// with its segments, shifted by the start of the chunk. It can be passed as a sidekick.Transcriber
+// to TranscribeAudio.
+func (companion *Companion) Transcribe(ctx context.Context, chunk models.AudioChunk) (models.Transcript, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	fileWriter, err := writer.CreateFormFile("file", fmt.Sprintf("chunk-%d.%s", chunk.Index, chunk.Format))
+	if err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+	if _, err := fileWriter.Write(chunk.Data); err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+	if err := writer.WriteField("model", companion.Config.AiModels.TranscriptionModel.Model); err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+	if err := writer.WriteField("response_format", "verbose_json"); err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+	if err := writer.Close(); err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+
+	// Create and configure the HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", companion.Config.ApiEndpoints.ApiTranscriptionURL, &body)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// Execute the HTTP request
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+	defer resp.Body.Close()
+
+	sideKick.Debug(fmt.Sprintf("Transcribe: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
+	err = sideKick.VerifyStatus(resp)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+
+	sideKick.Trace(fmt.Sprintf("Transcribe: responseBytes: %s", string(responseBytes)), companion.Config.Terminal)
+
+	var transcriptionResponse TranscriptionResponse
+	err = json.Unmarshal(responseBytes, &transcriptionResponse)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Transcript{}, err
+	}
+
+	transcript := models.Transcript{Text: transcriptionResponse.Text}
+	for _, segment := range transcriptionResponse.Segments {
+		transcript.Segments = append(transcript.Segments, models.TranscriptSegment{
+			Start: chunk.Start + time.Duration(segment.Start*float64(time.Second)),
+			End:   chunk.Start + time.Duration(segment.End*float64(time.Second)),
+			Text:  segment.Text,
+		})
+	}
+
+	return transcript, nil
 }
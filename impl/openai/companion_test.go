@@ -0,0 +1,581 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+func TestReasoningContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"model":"deepseek-reasoner","choices":[{"index":0,"delta":{"content":null,"reasoning_content":"The user greets. "}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"model":"deepseek-reasoner","choices":[{"index":0,"delta":{"content":null,"reasoning_content":"Greet back."}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"model":"deepseek-reasoner","choices":[{"index":0,"delta":{"content":"Hello!"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"model":"deepseek-reasoner","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.DeepSeek, "key", "deepseek-reasoner", "deepseek-reasoner", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	var reasoning, content strings.Builder
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, true, func(m models.Message) error {
+		reasoning.WriteString(m.Reasoning)
+		content.WriteString(m.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+
+	if result.Content != "Hello!" || result.Reasoning != "The user greets. Greet back." {
+		t.Errorf("unexpected result content %q, reasoning %q", result.Content, result.Reasoning)
+	}
+	if content.String() != result.Content || reasoning.String() != result.Reasoning {
+		t.Errorf("callback received content %q, reasoning %q", content.String(), reasoning.String())
+	}
+}
+
+func TestMessageMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","created":1760000000,"model":"gpt-4o-2024-08-06","choices":[{"index":0,"message":{"role":"assistant","content":"Hello!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12}}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, false, nil)
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if result.ID != "chatcmpl-1" || result.Model != "gpt-4o-2024-08-06" || result.CreatedAt.Unix() != 1760000000 {
+		t.Errorf("unexpected metadata id %q, model %q, created %v", result.ID, result.Model, result.CreatedAt)
+	}
+	if result.Usage == nil || *result.Usage != (models.Usage{PromptTokens: 9, CompletionTokens: 3, TotalTokens: 12}) {
+		t.Errorf("unexpected usage %+v", result.Usage)
+	}
+
+	// messages added to the conversation get an ID and creation time
+	conversation := companion.GetConversation()
+	if len(conversation) != 2 || conversation[0].ID == "" || conversation[0].CreatedAt.IsZero() || conversation[1].ID != "chatcmpl-1" {
+		t.Errorf("unexpected conversation %+v", conversation)
+	}
+}
+
+func TestToolRoundTrip(t *testing.T) {
+	toolServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var arguments map[string]any
+		json.NewDecoder(r.Body).Decode(&arguments)
+		fmt.Fprintf(w, `{"status":"success","message":"sunny in %s"}`, arguments["city"])
+	}))
+	defer toolServer.Close()
+
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+		json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"chatcmpl-2","choices":[{"index":0,"message":{"role":"assistant","content":"It is sunny in Paris."},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	config.Tools = []models.Tool{{Endpoint: toolServer.URL, Function: models.Function{Function: models.FunctionDefinition{FunctionName: "weather"}}}}
+	companion := aicompanion.NewCompanion(*config)
+
+	result, err := companion.SendToolRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Weather in Paris?"}})
+	if err != nil {
+		t.Fatalf("tool request failed: %v", err)
+	}
+	if result.Content != "It is sunny in Paris." || len(requests) != 2 {
+		t.Fatalf("unexpected result %+v after %d requests", result, len(requests))
+	}
+
+	tools := requests[0]["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["type"] != "function" {
+		t.Errorf("unexpected tools %v", tools)
+	}
+
+	// the second request carries the tool call with its arguments as JSON string, and the tool result
+	messages := requests[1]["messages"].([]any)
+	call := messages[len(messages)-2].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	if call["id"] != "call_1" || call["function"].(map[string]any)["arguments"] != `{"city":"Paris"}` {
+		t.Errorf("unexpected tool call %v", call)
+	}
+	toolResult := messages[len(messages)-1].(map[string]any)
+	if toolResult["role"] != "tool" || toolResult["tool_call_id"] != "call_1" || !strings.Contains(toolResult["content"].(string), "sunny in Paris") {
+		t.Errorf("unexpected tool result %v", toolResult)
+	}
+
+	conversation := companion.GetConversation()
+	if len(conversation) != 4 || conversation[2].Role != models.ToolRole || conversation[3].ID != "chatcmpl-2" {
+		t.Errorf("unexpected conversation %+v", conversation)
+	}
+}
+
+func TestToolRequestOverrides(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"{}"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	message := models.MessageRequest{
+		Message:        models.Message{Role: models.User, Content: "Weather in Paris?"},
+		ResponseFormat: &models.ResponseFormat{Type: models.JSONObject},
+		Options:        &models.GenerationOptions{MaxTokens: 42},
+		SystemPrompt:   "Answer in JSON",
+	}
+	if _, err := companion.SendToolRequest(context.Background(), message); err != nil {
+		t.Fatalf("tool request failed: %v", err)
+	}
+	if format, _ := request["response_format"].(map[string]any); format["type"] != "json_object" {
+		t.Errorf("expected the response format of the request, got %v", request["response_format"])
+	}
+	if request["max_tokens"] != float64(42) {
+		t.Errorf("expected the options of the request, got max_tokens %v", request["max_tokens"])
+	}
+	if system := request["messages"].([]any)[0].(map[string]any); system["content"] != "Answer in JSON" {
+		t.Errorf("expected the system prompt of the request, got %v", system)
+	}
+
+	message.SystemPrompt, message.Persona = "", "ninja"
+	if _, err := companion.SendToolRequest(context.Background(), message); !errors.Is(err, sidekick.ErrUnknownPersona) {
+		t.Errorf("expected unknown persona error, got %v", err)
+	}
+}
+
+func TestToolRequestUnknownTool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	lookup := models.Function{Type: models.TypeFunction, Function: models.FunctionDefinition{FunctionName: "lookup"}}
+	result, err := companion.SendToolRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Look it up"}, Tools: []models.Function{lookup}})
+	if err != nil {
+		t.Fatalf("tool request failed: %v", err)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].ID != "call_1" || result.ToolCalls[0].Payload.FunctionName != "lookup" {
+		t.Errorf("expected the tool call to be returned, got %+v", result)
+	}
+}
+
+func TestToolRegistry(t *testing.T) {
+	var rounds int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rounds++
+		w.Header().Set("Content-Type", "application/json")
+		if rounds == 1 {
+			fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"clock","arguments":""}}]},"finish_reason":"tool_calls"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"It is noon."},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	var called bool
+	registry := tools.NewRegistry()
+	registry.Register("clock", models.FunctionDefinition{Description: "Returns the time"}, func(ctx context.Context, args map[string]any) (any, error) {
+		called = true
+		return "12:00", nil
+	})
+	companion.SetToolRegistry(registry)
+
+	result, err := companion.SendToolRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "What time is it?"}})
+	if err != nil || result.Content != "It is noon." || !called {
+		t.Errorf("unexpected result %+v, called %v: %v", result, called, err)
+	}
+}
+
+func TestStreamedToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"time","arguments":"{}"}}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Berlin\"}"}}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`+"\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Weather in Berlin?"}}, true, nil)
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if len(result.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", result.ToolCalls)
+	}
+	weather, now := result.ToolCalls[0], result.ToolCalls[1]
+	if weather.ID != "call_1" || weather.Payload.FunctionName != "weather" || weather.Payload.Arguments["city"] != "Berlin" {
+		t.Errorf("unexpected tool call %+v", weather)
+	}
+	if now.ID != "call_2" || now.Payload.FunctionName != "time" || len(now.Payload.Arguments) != 0 {
+		t.Errorf("unexpected tool call %+v", now)
+	}
+}
+
+func TestStreamCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, `data: {"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"%d "}}]}`+"\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks := 0
+	result, err := companion.SendChatRequest(ctx, models.MessageRequest{Message: models.Message{Role: models.User, Content: "Count"}}, true, func(m models.Message) error {
+		if chunks++; chunks == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled request to fail with context.Canceled, got %v", err)
+	}
+	if chunks != 3 {
+		t.Errorf("expected the stream to stop after 3 chunks, got %d", chunks)
+	}
+	if !result.Cancelled || result.Content != "0 1 2 " || result.Model != "gpt-4o" {
+		t.Errorf("expected the partial answer, got %+v", result)
+	}
+	if len(companion.GetConversation()) != 0 {
+		t.Errorf("expected the cancelled exchange not to be added to the conversation")
+	}
+
+	// an error of the callback cancels the stream as well
+	stop := errors.New("stop")
+	result, err = companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Count"}}, true, func(m models.Message) error {
+		return stop
+	})
+	if !errors.Is(err, stop) || !result.Cancelled || result.Content != "0 " {
+		t.Errorf("expected the partial answer and the error of the callback, got %+v: %v", result, err)
+	}
+
+	// a request whose deadline passed is not sent
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if _, err := companion.SendChatRequest(expired, models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, false, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestStreamErrorEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": OPENROUTER PROCESSING\n\n")
+		fmt.Fprint(w, "event: message\nid: 1\ndata: {\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"error\":{\"message\":\"provider overloaded\",\"type\":\"server_error\"}}\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	_, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, true, nil)
+	if err == nil || !strings.Contains(err.Error(), "server_error: provider overloaded") {
+		t.Errorf("expected the error of the stream, got %v", err)
+	}
+	if !errors.Is(err, models.ErrServerOverloaded) {
+		t.Errorf("expected models.ErrServerOverloaded, got %v", err)
+	}
+}
+
+func TestStreamFinishReasonAndUsage(t *testing.T) {
+	var payload openai.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o-2024\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Once upon\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o-2024\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\" a\"},\"finish_reason\":\"length\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o-2024\",\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":3,\"total_tokens\":8}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	var chunks []models.Message
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, true, func(m models.Message) error {
+		chunks = append(chunks, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if payload.StreamOptions == nil || !payload.StreamOptions.IncludeUsage {
+		t.Errorf("expected the usage to be requested, got %+v", payload.StreamOptions)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+
+	final := chunks[1]
+	if final.Content != " a" || final.FinishReason != models.FinishLength || final.Model != "gpt-4o-2024" {
+		t.Errorf("unexpected last chunk %+v", final)
+	}
+	if final.Usage == nil || final.Usage.TotalTokens != 8 {
+		t.Errorf("expected the usage on the last chunk, got %+v", final.Usage)
+	}
+	if chunks[0].FinishReason != "" || chunks[0].Usage != nil {
+		t.Errorf("expected no metadata on the first chunk, got %+v", chunks[0])
+	}
+	if result.Content != "Once upon a" || result.FinishReason != models.FinishLength || result.Usage == nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestUsageAccounting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload openai.ChatRequest
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"model\":\"gpt-4o-2024\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: {\"model\":\"gpt-4o-2024\",\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":3,\"total_tokens\":8}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	config.Pricing = models.Pricing{Currency: "USD", Models: map[string]models.Price{"gpt-4o-mini": {Input: 1, Output: 2}}}
+	companion := aicompanion.NewCompanion(*config)
+
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}
+	if _, err := companion.SendChatRequest(context.Background(), request, true, func(models.Message) error { return nil }); err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	if err := companion.SwitchSession("other"); err != nil {
+		t.Fatalf("switching session failed: %v", err)
+	}
+	result, err := companion.SendChatRequest(context.Background(), request, false, nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if result.Cost == nil || result.Cost.Total != 0.014 || result.Cost.Currency != "USD" {
+		t.Errorf("unexpected cost %+v", result.Cost)
+	}
+
+	report := companion.GetUsage()
+	if report.Responses != 2 || report.Total != (models.Usage{PromptTokens: 15, CompletionTokens: 5, TotalTokens: 20}) {
+		t.Errorf("unexpected total %+v", report)
+	}
+	if report.Sessions["default"].TotalTokens != 8 || report.Sessions["other"].TotalTokens != 12 {
+		t.Errorf("unexpected sessions %+v", report.Sessions)
+	}
+	if report.Models["gpt-4o-2024"].TotalTokens != 8 || report.Models["gpt-4o-mini"].TotalTokens != 12 {
+		t.Errorf("unexpected models %+v", report.Models)
+	}
+	if report.Costs == nil || report.Costs.Responses != 1 || report.Costs.Sessions["other"].Total != 0.014 {
+		t.Errorf("unexpected costs %+v", report.Costs)
+	}
+}
+
+func TestLogProbs(t *testing.T) {
+	var received openai.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if received.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Yes\"},\"logprobs\":{\"content\":[{\"token\":\"Yes\",\"logprob\":-0.1}]}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\".\"},\"logprobs\":{\"content\":[{\"token\":\".\",\"logprob\":0}]},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"No"},"logprobs":{"content":[{"token":"No","logprob":-0.5,"bytes":[78,111],"top_logprobs":[{"token":"No","logprob":-0.5},{"token":"Yes","logprob":-1}]}]},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	request := models.MessageRequest{
+		Message: models.Message{Role: models.User, Content: "Is it?"},
+		Options: &models.GenerationOptions{TopLogProbs: 2},
+	}
+	result, err := companion.SendChatRequest(context.Background(), request, false, nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if !received.LogProbs || received.TopLogProbs != 2 {
+		t.Errorf("expected logprobs to be requested, got %v and %d", received.LogProbs, received.TopLogProbs)
+	}
+	if len(result.LogProbs) != 1 || result.LogProbs[0].Token != "No" || len(result.LogProbs[0].TopLogProbs) != 2 || result.LogProbs[0].TopLogProbs[1].Token != "Yes" {
+		t.Fatalf("unexpected log probabilities %+v", result.LogProbs)
+	}
+	if probability := result.LogProbs[0].TopLogProbs[1].Probability(); probability < 0.367 || probability > 0.368 {
+		t.Errorf("unexpected probability %f", probability)
+	}
+
+	var chunks int
+	result, err = companion.SendChatRequest(context.Background(), request, true, func(m models.Message) error {
+		chunks += len(m.LogProbs)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	if chunks != 2 || len(result.LogProbs) != 2 || result.LogProbs[0].Token != "Yes" || result.LogProbs[1].Token != "." {
+		t.Errorf("unexpected streamed log probabilities %+v in %d chunks", result.LogProbs, chunks)
+	}
+}
+
+func TestSystemPromptOverride(t *testing.T) {
+	var system string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Messages []models.Message `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		system = payload.Messages[0].Content
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	config.Personas = []models.Persona{{Name: "pirate", Prompt: models.Prompt{SystemPrompt: "Talk like a pirate"}}}
+	companion := aicompanion.NewCompanion(*config)
+	companion.SetSystemRole("You are terse")
+
+	tests := []struct {
+		request  models.MessageRequest
+		expected string
+	}{
+		{models.MessageRequest{}, "You are terse"},
+		{models.MessageRequest{Persona: "pirate"}, "Talk like a pirate"},
+		{models.MessageRequest{SystemPrompt: "Answer in French", Persona: "pirate"}, "Answer in French"},
+	}
+	for _, test := range tests {
+		test.request.Message = models.Message{Role: models.User, Content: "Hi"}
+		for _, send := range []func(context.Context, models.MessageRequest, bool, func(models.Message) error) (models.Message, error){companion.SendChatRequest, companion.SendGenerateRequest} {
+			if _, err := send(context.Background(), test.request, false, nil); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if system != test.expected {
+				t.Errorf("expected system prompt %q, got %q", test.expected, system)
+			}
+		}
+	}
+	if companion.GetSystemRole().Content != "You are terse" {
+		t.Errorf("expected the system role of the companion to be unchanged, got %q", companion.GetSystemRole().Content)
+	}
+
+	_, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}, Persona: "ninja"}, false, nil)
+	if !errors.Is(err, sidekick.ErrUnknownPersona) {
+		t.Errorf("expected unknown persona error, got %v", err)
+	}
+}
+
+func TestSummarizeStrategy(t *testing.T) {
+	var summaries int
+	var last []models.Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Messages []models.Message `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		answer := "Ok"
+		if strings.HasPrefix(payload.Messages[len(payload.Messages)-1].Content, sidekick.ContextSummaryPrompt) {
+			if len(payload.Messages) != 2 {
+				t.Errorf("expected the summary request to be sent without the conversation, got %d messages", len(payload.Messages))
+			}
+			summaries++
+			answer = "The user said hello"
+		} else {
+			last = payload.Messages
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, answer)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	config.ContextStrategy = sidekick.SummarizeStrategy
+	config.MaxMessages = 2
+	companion := aicompanion.NewCompanion(*config)
+
+	for i := range 4 {
+		request := models.MessageRequest{Message: models.Message{Role: models.User, Content: fmt.Sprintf("Hello %d", i)}}
+		if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err != nil {
+			t.Fatalf("turn %d failed: %v", i, err)
+		}
+	}
+
+	if summaries == 0 {
+		t.Fatal("expected the earlier conversation to be summarized")
+	}
+	if len(last) != 5 || !strings.Contains(last[1].Content, "The user said hello") || last[4].Content != "Hello 3" {
+		t.Errorf("expected the system role, the summary, 2 recent messages and the new message, got %+v", last)
+	}
+}
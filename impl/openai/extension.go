@@ -0,0 +1,67 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Extension adapts the companion to OpenAI compatible providers that need additional
+// request headers, payload fields or read provider specific response data.
+type Extension interface {
+	// PrepareRequest is called before a chat request is sent. Headers added to header are set on
+	// the request; additional payload fields can be added to payload.Extra.
+	PrepareRequest(header http.Header, payload *ChatRequest)
+
+	// HandleResponse is called with the response headers and every raw response object,
+	// i.e. the response body or each chunk of a streamed response.
+	HandleResponse(header http.Header, object []byte, info *models.ResponseInfo)
+}
+
+// MarshalJSON converts the messages into the format of the API and merges the Extra fields into the
+// payload.
+func (request ChatRequest) MarshalJSON() ([]byte, error) {
+	type plain ChatRequest
+	messages, err := newChatMessages(request.Messages)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(struct {
+		plain
+		Messages []chatMessage `json:"messages"`
+	}{plain(request), messages})
+	if err != nil || len(request.Extra) == 0 {
+		return data, err
+	}
+
+	var merged map[string]any
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range request.Extra {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// newResponseInfo creates the response info of a response from its headers.
+func (companion *Companion) newResponseInfo(header http.Header) *models.ResponseInfo {
+	return &models.ResponseInfo{RateLimit: sideKick.ParseRateLimit(header)}
+}
+
+// prepareRequest lets the extension, if any, modify a chat request.
+func (companion *Companion) prepareRequest(payload *ChatRequest) http.Header {
+	header := make(http.Header)
+	if companion.Extension != nil {
+		companion.Extension.PrepareRequest(header, payload)
+	}
+	return header
+}
+
+// handleResponse lets the extension, if any, read a raw response object.
+func (companion *Companion) handleResponse(header http.Header, object []byte, info *models.ResponseInfo) {
+	if companion.Extension != nil {
+		companion.Extension.HandleResponse(header, object, info)
+	}
+}
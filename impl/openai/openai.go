@@ -2,7 +2,10 @@ package openai
 
 import (
 	"encoding/json"
+	"fmt"
+	"time"
 
+	"github.com/ghmer/aicompanion/impl/sidekick"
 	"github.com/ghmer/aicompanion/models"
 )
 
@@ -37,17 +40,81 @@ type CompletionsRequest struct {
 	Stop        []string `json:"stop,omitempty"`
 }
 
+// FinishToolCalls is the finish reason of responses that end with tool calls.
+const FinishToolCalls = "tool_calls"
+
 // Choice represents a single completion choice.
 type Choice struct {
-	Delta        Delta   `json:"delta"`
-	Index        int     `json:"index"`
-	LogProbs     float32 `json:"logprobs,omitempty"`
-	FinishReason string  `json:"finish_reason,omitempty"`
-	Message      Message `json:"message,omitempty"`
+	Delta        Delta     `json:"delta"`
+	Index        int       `json:"index"`
+	LogProbs     *LogProbs `json:"logprobs,omitempty"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Message      Message   `json:"message,omitempty"`
+}
+
+// LogProbs holds the log probabilities of the tokens of a choice.
+type LogProbs struct {
+	Content []models.TokenLogProb `json:"content"`
 }
 
 type Delta struct {
-	Content string `json:"content"`
+	Content          string          `json:"content"`
+	ReasoningContent string          `json:"reasoning_content,omitempty"` // Reasoning of reasoning models, e.g. DeepSeek R1
+	ToolCalls        []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a streamed tool call. The first fragment of a call carries its ID and
+// function name; the arguments are streamed as pieces of their JSON encoding. Fragments of the same call
+// share its index.
+type ToolCallDelta struct {
+	Index   int             `json:"index"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Payload FunctionPayload `json:"function"`
+}
+
+// toolCallAssembler reassembles the tool calls of a stream from their fragments.
+type toolCallAssembler struct {
+	calls []ToolCall
+	index map[int]int // position in calls by index of the stream
+}
+
+// add adds the fragments of a chunk.
+func (assembler *toolCallAssembler) add(deltas []ToolCallDelta) {
+	if assembler.index == nil {
+		assembler.index = make(map[int]int)
+	}
+	for _, delta := range deltas {
+		position, exists := assembler.index[delta.Index]
+		if !exists {
+			position = len(assembler.calls)
+			assembler.index[delta.Index] = position
+			assembler.calls = append(assembler.calls, ToolCall{})
+		}
+
+		call := &assembler.calls[position]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Payload.FunctionName += delta.Payload.FunctionName
+		call.Payload.Arguments += delta.Payload.Arguments
+	}
+}
+
+// toolCalls returns the reassembled tool calls, in the order they were started.
+func (assembler *toolCallAssembler) toolCalls() ([]models.ToolCall, error) {
+	var toolCalls []models.ToolCall
+	for _, call := range assembler.calls {
+		toolCall, err := call.TransformToModel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse arguments of streamed tool call %s: %w", call.Payload.FunctionName, err)
+		}
+		toolCalls = append(toolCalls, toolCall)
+	}
+	return toolCalls, nil
 }
 
 // CompletionsResponse represents the output of a text completion request.
@@ -81,21 +148,131 @@ type CompletionTokensDetails struct {
 
 // ChatRequest represents the input payload for chat completions.
 type ChatRequest struct {
-	Model       string            `json:"model"`
-	Messages    []models.Message  `json:"messages"`
-	MaxTokens   int               `json:"max_tokens,omitempty"`
-	Temperature float32           `json:"temperature,omitempty"`
-	Stream      bool              `json:"stream,omitempty"`
-	Tools       []models.Function `json:"tools,omitempty"`
+	Model          string            `json:"model"`
+	Messages       []models.Message  `json:"messages"`
+	MaxTokens      int               `json:"max_tokens,omitempty"`
+	Temperature    *float32          `json:"temperature,omitempty"`
+	TopP           *float32          `json:"top_p,omitempty"`
+	Stop           []string          `json:"stop,omitempty"`
+	LogProbs       bool              `json:"logprobs,omitempty"`
+	N              int               `json:"n,omitempty"`
+	TopLogProbs    int               `json:"top_logprobs,omitempty"`
+	Stream         bool              `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions    `json:"stream_options,omitempty"`
+	Tools          []models.Function `json:"tools,omitempty"`
+	ResponseFormat *ResponseFormat   `json:"response_format,omitempty"`
+	Extra          map[string]any    `json:"-"` // Provider specific fields merged into the payload
+}
+
+// applyOptions sets the generation options the api supports on the request.
+func (request *ChatRequest) applyOptions(options models.GenerationOptions) {
+	request.Temperature = options.Temperature
+	request.TopP = options.TopP
+	request.MaxTokens = options.MaxTokens
+	request.Stop = options.Stop
+	request.LogProbs = options.LogProbs || options.TopLogProbs > 0
+	request.TopLogProbs = options.TopLogProbs
+	// candidates cannot be told apart in streams, which pass on their chunks as they arrive
+	if !request.Stream {
+		request.N = options.N
+	}
+}
+
+// ResponseFormat demands JSON output, matching JSONSchema if set.
+type ResponseFormat struct {
+	Type       models.ResponseFormatType `json:"type"`
+	JSONSchema *JSONSchema               `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is the named schema of a json_schema response format.
+type JSONSchema struct {
+	Name   string `json:"name"`
+	Schema any    `json:"schema"`
+	Strict bool   `json:"strict,omitempty"`
+}
+
+// defaultSchemaName names schemas of response formats without name, which the api requires.
+const defaultSchemaName = "response"
+
+// newResponseFormat converts a response format into the format of the API. Strict schemas forbid
+// additional properties on all objects, as the api demands.
+func newResponseFormat(format *models.ResponseFormat) *ResponseFormat {
+	if format == nil {
+		return nil
+	}
+	if format.Type != models.JSONSchema || format.Schema == nil {
+		return &ResponseFormat{Type: models.JSONObject}
+	}
+
+	schema := &JSONSchema{Name: format.Name, Schema: format.Schema, Strict: format.Strict}
+	if schema.Name == "" {
+		schema.Name = defaultSchemaName
+	}
+	if format.Strict {
+		schema.Schema = closedSchema(*format.Schema)
+	}
+	return &ResponseFormat{Type: models.JSONSchema, JSONSchema: schema}
+}
+
+// closedSchema returns the schema as map, with additionalProperties false on all objects.
+func closedSchema(parameter models.Parameter) map[string]any {
+	schema := map[string]any{"type": parameter.Type}
+	if parameter.Description != "" {
+		schema["description"] = parameter.Description
+	}
+	if len(parameter.Enum) > 0 {
+		schema["enum"] = parameter.Enum
+	}
+	if parameter.Items != nil {
+		schema["items"] = closedSchema(*parameter.Items)
+	}
+	if parameter.Type == "object" {
+		properties := make(map[string]any, len(parameter.Properties))
+		for name, property := range parameter.Properties {
+			properties[name] = closedSchema(property)
+		}
+		schema["properties"] = properties
+		schema["required"] = append([]string{}, parameter.Required...)
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
+
+// StreamOptions configures streamed responses. With IncludeUsage, the usage of the request is sent in a
+// last chunk without choices.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // Message represents an individual message in the chat.
 type Message struct {
-	Role            models.Role           `json:"role"`             // Role of the message (user, assistant, system)
-	Content         string                `json:"content"`          // Content of the message
-	Images          *[]models.Base64Image `json:"images,omitempty"` // Images associated with the message
-	AlternatePrompt string                `json:"alternate_prompt,omitempty"`
-	ToolCalls       []ToolCall            `json:"tool_calls,omitempty"`
+	Role             models.Role           `json:"role"`             // Role of the message (user, assistant, system)
+	Content          string                `json:"content"`          // Content of the message
+	Images           *[]models.Base64Image `json:"images,omitempty"` // Images associated with the message
+	AlternatePrompt  string                `json:"alternate_prompt,omitempty"`
+	ToolCalls        []ToolCall            `json:"tool_calls,omitempty"`
+	ReasoningContent string                `json:"reasoning_content,omitempty"` // Reasoning of reasoning models, e.g. DeepSeek R1
+}
+
+// TransformToModel converts a message of a response into a models.Message.
+func (message Message) TransformToModel() (models.Message, error) {
+	var toolCalls []models.ToolCall
+	for _, toolCall := range message.ToolCalls {
+		genericToolCall, err := toolCall.TransformToModel()
+		if err != nil {
+			return models.Message{}, err
+		}
+		toolCalls = append(toolCalls, genericToolCall)
+	}
+
+	return models.Message{
+		Role:            message.Role,
+		Content:         message.Content,
+		Images:          message.Images,
+		AlternatePrompt: message.AlternatePrompt,
+		ToolCalls:       toolCalls,
+		Reasoning:       message.ReasoningContent,
+	}, nil
 }
 
 // ChatResponse represents the response for a chat completion.
@@ -105,6 +282,64 @@ type ChatResponse struct {
 	Created int64    `json:"created"`
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+	Error   *Error   `json:"error,omitempty"` // Sent instead of choices if the stream fails
+}
+
+// Error is the error object of an OpenAI compatible api.
+type Error struct {
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+	Code    any    `json:"code,omitempty"`
+}
+
+// err returns the error as *models.ProviderError, with the raw data of an error event as message if it
+// carries no error object.
+func (e *Error) err(data string) error {
+	if e == nil || e.Message == "" {
+		return sidekick.ClassifyProviderError(&models.ProviderError{Message: data})
+	}
+	return sidekick.ClassifyProviderError(&models.ProviderError{Code: sidekick.ProviderErrorCode(e.Code, e.Type), Message: e.Message})
+}
+
+// annotate sets the ID, creation time, model and usage of the response, and the finish reason and log
+// probabilities of its first choice on a message.
+func (response ChatResponse) annotate(message *models.Message) {
+	response.annotateChoice(message, 0)
+}
+
+// annotateChoice sets the ID, creation time, model and usage of the response, and the finish reason and log
+// probabilities of the choice at index on a message.
+func (response ChatResponse) annotateChoice(message *models.Message, index int) {
+	message.ID = response.ID
+	message.Model = response.Model
+	if response.Created > 0 {
+		message.CreatedAt = time.Unix(response.Created, 0)
+	}
+	if response.Usage != nil {
+		message.Usage = &models.Usage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		}
+	}
+	if index >= len(response.Choices) {
+		return
+	}
+	if choice := response.Choices[index]; choice.FinishReason != "" {
+		message.FinishReason = finishReason(choice.FinishReason)
+	}
+	if choice := response.Choices[index]; choice.LogProbs != nil {
+		message.LogProbs = choice.LogProbs.Content
+	}
+}
+
+// finishReason maps a finish reason of the api to models.FinishReason.
+func finishReason(reason string) models.FinishReason {
+	if reason == "function_call" {
+		return models.FinishToolCalls
+	}
+	return models.FinishReason(reason)
 }
 
 // EmbeddingsRequest represents the input payload for generating embeddings.
@@ -173,6 +408,22 @@ type ModerationResult struct {
 	CategoryScores ModerationCategoryScores `json:"category_scores"`
 }
 
+// categoryMaps converts the categories and scores of a result into maps keyed by category name.
+func (result ModerationResult) categoryMaps() (map[string]bool, map[string]float64) {
+	categories := make(map[string]bool)
+	scores := make(map[string]float64)
+
+	// the json tags carry the category names
+	if data, err := json.Marshal(result.Categories); err == nil {
+		json.Unmarshal(data, &categories)
+	}
+	if data, err := json.Marshal(result.CategoryScores); err == nil {
+		json.Unmarshal(data, &scores)
+	}
+
+	return categories, scores
+}
+
 // ModerationCategories represents the categories for moderation.
 type ModerationCategories struct {
 	Sexual                bool `json:"sexual"`
@@ -204,16 +455,21 @@ type ModerationCategoryScores struct {
 }
 
 type ToolCall struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type,omitempty"`
 	Payload FunctionPayload `json:"function"`
 }
 
 func (toolCall *ToolCall) TransformToModel() (models.ToolCall, error) {
 	var model models.ToolCall
-	var arguments map[string]any
-	err := json.Unmarshal([]byte(toolCall.Payload.Arguments), &arguments)
-	if err != nil {
-		return model, err
+	arguments := make(map[string]any)
+	if toolCall.Payload.Arguments != "" {
+		err := json.Unmarshal([]byte(toolCall.Payload.Arguments), &arguments)
+		if err != nil {
+			return model, err
+		}
 	}
+	model.ID = toolCall.ID
 	model.Payload = models.FunctionPayload{
 		FunctionName: toolCall.Payload.FunctionName,
 		Arguments:    arguments,
@@ -221,7 +477,58 @@ func (toolCall *ToolCall) TransformToModel() (models.ToolCall, error) {
 	return model, nil
 }
 
+// newToolCall converts a tool call into the format of the API, which expects the arguments as JSON string.
+func newToolCall(toolCall models.ToolCall) (ToolCall, error) {
+	arguments, err := json.Marshal(toolCall.Payload.Arguments)
+	if err != nil {
+		return ToolCall{}, err
+	}
+	if toolCall.Payload.Arguments == nil {
+		arguments = []byte("{}")
+	}
+	return ToolCall{
+		ID:      toolCall.ID,
+		Type:    string(models.TypeFunction),
+		Payload: FunctionPayload{FunctionName: toolCall.Payload.FunctionName, Arguments: string(arguments)},
+	}, nil
+}
+
+// chatMessage is a message as sent to the API. Its tool calls replace those of the message.
+type chatMessage struct {
+	models.Message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// newChatMessages converts messages into the format of the API.
+func newChatMessages(messages []models.Message) ([]chatMessage, error) {
+	converted := make([]chatMessage, len(messages))
+	for i, message := range messages {
+		converted[i].Message = message
+		for _, toolCall := range message.ToolCalls {
+			call, err := newToolCall(toolCall)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize tool call of message %d: %w", i, err)
+			}
+			converted[i].ToolCalls = append(converted[i].ToolCalls, call)
+		}
+	}
+	return converted, nil
+}
+
 type FunctionPayload struct {
 	FunctionName string `json:"name"`      // The name of the function.
 	Arguments    string `json:"arguments"` // List of parameters the function takes.
 }
+
+// TranscriptionResponse represents the verbose_json response of the audio transcription endpoint.
+type TranscriptionResponse struct {
+	Text     string                 `json:"text"`
+	Segments []TranscriptionSegment `json:"segments"`
+}
+
+// TranscriptionSegment represents a segment of a transcription, with timestamps in seconds.
+type TranscriptionSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
@@ -0,0 +1,51 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestTranscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("response_format") != "verbose_json" || r.FormValue("model") != "whisper-1" {
+			t.Errorf("unexpected form %v", r.MultipartForm.Value)
+		}
+		if _, header, err := r.FormFile("file"); err != nil || header.Filename != "chunk-1.mp3" {
+			t.Errorf("unexpected file %v (%v)", header, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"text":"Hello there. General Kenobi.","segments":[{"id":0,"start":0.0,"end":1.5,"text":" Hello there."},{"id":1,"start":1.5,"end":3.25,"text":" General Kenobi."}]}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "key", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiTranscriptionURL = server.URL
+	companion := aicompanion.NewCompanion(*config).(*openai.Companion)
+
+	chunk := models.AudioChunk{Index: 1, Start: time.Minute, Duration: time.Minute, Data: []byte("audio"), Format: "mp3"}
+	transcript, err := companion.Transcribe(context.Background(), chunk)
+	if err != nil {
+		t.Fatalf("transcription failed: %v", err)
+	}
+	if transcript.Text != "Hello there. General Kenobi." || len(transcript.Segments) != 2 {
+		t.Fatalf("unexpected transcript %+v", transcript)
+	}
+	if segment := transcript.Segments[1]; segment.Start != time.Minute+1500*time.Millisecond || segment.End != time.Minute+3250*time.Millisecond {
+		t.Errorf("expected the segment to be shifted by the start of the chunk, got %s-%s", segment.Start, segment.End)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := companion.Transcribe(ctx, chunk); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the request to be cancelled, got %v", err)
+	}
+}
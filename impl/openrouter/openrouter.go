@@ -0,0 +1,91 @@
+// Package openrouter adapts the OpenAI companion to OpenRouter. OpenRouter speaks the OpenAI wire format,
+// identifies the calling application by headers, accepts routing preferences in the request payload and
+// reports which upstream provider served a request.
+package openrouter
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// headers identifying the calling application
+const (
+	HeaderReferer = "HTTP-Referer"
+	HeaderTitle   = "X-Title"
+)
+
+// sort orders for ProviderPreferences.Sort
+const (
+	SortPrice      = "price"
+	SortThroughput = "throughput"
+	SortLatency    = "latency"
+)
+
+// ProviderPreferences control which upstream providers OpenRouter routes a request to.
+type ProviderPreferences struct {
+	Order             []string `json:"order,omitempty"`              // Providers to try, in order
+	AllowFallbacks    *bool    `json:"allow_fallbacks,omitempty"`    // Whether providers outside Order may be used
+	RequireParameters bool     `json:"require_parameters,omitempty"` // Only use providers supporting all request parameters
+	DataCollection    string   `json:"data_collection,omitempty"`    // "allow" or "deny"
+	Only              []string `json:"only,omitempty"`               // Providers allowed for the request
+	Ignore            []string `json:"ignore,omitempty"`             // Providers never used for the request
+	Quantizations     []string `json:"quantizations,omitempty"`      // Accepted quantization levels, e.g. fp8
+	Sort              string   `json:"sort,omitempty"`               // Sort providers by price, throughput or latency
+}
+
+// response holds the fields OpenRouter adds to response objects.
+type response struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// Extension implements openai.Extension for OpenRouter.
+type Extension struct {
+	Referer  string               // Url of the application, sent as HTTP-Referer
+	Title    string               // Name of the application, sent as X-Title
+	Provider *ProviderPreferences // Provider routing preferences
+	Models   []string             // Fallback models, tried in order if the requested model is unavailable
+}
+
+var _ openai.Extension = Extension{}
+
+// PrepareRequest implements openai.Extension and adds the application headers and routing preferences.
+func (extension Extension) PrepareRequest(header http.Header, payload *openai.ChatRequest) {
+	if extension.Referer != "" {
+		header.Set(HeaderReferer, extension.Referer)
+	}
+	if extension.Title != "" {
+		header.Set(HeaderTitle, extension.Title)
+	}
+
+	if extension.Provider == nil && len(extension.Models) == 0 {
+		return
+	}
+	if payload.Extra == nil {
+		payload.Extra = make(map[string]any)
+	}
+	if extension.Provider != nil {
+		payload.Extra["provider"] = extension.Provider
+	}
+	if len(extension.Models) > 0 {
+		payload.Extra["models"] = extension.Models
+	}
+}
+
+// HandleResponse implements openai.Extension and records the upstream provider and model that served the request.
+func (extension Extension) HandleResponse(header http.Header, object []byte, info *models.ResponseInfo) {
+	var parsed response
+	if err := json.Unmarshal(object, &parsed); err != nil {
+		return
+	}
+
+	if parsed.Provider != "" {
+		info.Provider = parsed.Provider
+	}
+	if parsed.Model != "" {
+		info.Model = parsed.Model
+	}
+}
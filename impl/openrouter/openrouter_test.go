@@ -0,0 +1,58 @@
+package openrouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/impl/openrouter"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestOpenRouterRouting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(openrouter.HeaderReferer) != "https://example.com" || r.Header.Get(openrouter.HeaderTitle) != "example" {
+			t.Errorf("missing application headers: %v", r.Header)
+		}
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		provider, _ := payload["provider"].(map[string]any)
+		if provider["sort"] != openrouter.SortLatency {
+			t.Errorf("missing provider preferences in payload %v", payload)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": OPENROUTER PROCESSING\n\n")
+		fmt.Fprint(w, `data: {"provider":"Together","model":"meta-llama/llama-3.3-70b-instruct","choices":[{"index":0,"delta":{"content":"Hi"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"provider":"Together","model":"meta-llama/llama-3.3-70b-instruct","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenRouter, "key", "openrouter/auto", "openrouter/auto", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+	companion.(*openai.Companion).Extension = openrouter.Extension{
+		Referer:  "https://example.com",
+		Title:    "example",
+		Provider: &openrouter.ProviderPreferences{Sort: openrouter.SortLatency},
+	}
+
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hello"}}, true, nil)
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if result.Content != "Hi" {
+		t.Errorf("expected Hi, got %q", result.Content)
+	}
+	if result.Info == nil || result.Info.Provider != "Together" || result.Info.Model != "meta-llama/llama-3.3-70b-instruct" {
+		t.Errorf("unexpected response info %+v", result.Info)
+	}
+}
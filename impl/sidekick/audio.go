@@ -0,0 +1,229 @@
+package sidekick
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// AudioChunkOptions configures how an audio file is split for transcription.
+type AudioChunkOptions struct {
+	ChunkDuration time.Duration // Length of each chunk, defaults to DefaultAudioChunkDuration
+	Overlap       time.Duration // Overlap between consecutive chunks, defaults to DefaultAudioChunkOverlap
+	MaxChunkBytes int           // Maximum size of an encoded chunk, defaults to DefaultAudioMaxChunkBytes
+	Concurrency   int           // Number of chunks transcribed in parallel, defaults to DefaultAudioConcurrency
+}
+
+const (
+	DefaultAudioChunkDuration = 10 * time.Minute
+	DefaultAudioChunkOverlap  = 5 * time.Second
+	DefaultAudioMaxChunkBytes = 25 * 1024 * 1024 // upload limit of the OpenAI transcription api
+	DefaultAudioConcurrency   = 4
+
+	// maxOverlapWords limits the number of words compared when stitching overlapping chunks.
+	maxOverlapWords = 64
+)
+
+// Transcriber transcribes a single audio chunk. Segments are optional; if returned, their
+// timestamps are relative to the start of the audio file, not to the start of the chunk.
+type Transcriber func(ctx context.Context, chunk models.AudioChunk) (models.Transcript, error)
+
+// withDefaults returns a copy of the options with defaults applied to unset values.
+func (options AudioChunkOptions) withDefaults() AudioChunkOptions {
+	if options.ChunkDuration <= 0 {
+		options.ChunkDuration = DefaultAudioChunkDuration
+	}
+	if options.Overlap < 0 || options.Overlap >= options.ChunkDuration {
+		options.Overlap = DefaultAudioChunkOverlap
+	}
+	if options.MaxChunkBytes <= 0 {
+		options.MaxChunkBytes = DefaultAudioMaxChunkBytes
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultAudioConcurrency
+	}
+	return options
+}
+
+// ChunkAudio splits an audio file into overlapping mono mp3 chunks that stay below options.MaxChunkBytes.
+// The chunking relies on ffmpeg and ffprobe being installed.
+func (utility *SideKick) ChunkAudio(filepath string, options AudioChunkOptions) ([]models.AudioChunk, error) {
+	options = options.withDefaults()
+
+	seconds, err := utility.probeMediaDuration(filepath)
+	if err != nil {
+		return nil, err
+	}
+	duration := time.Duration(seconds * float64(time.Second))
+
+	var chunks []models.AudioChunk
+	step := options.ChunkDuration - options.Overlap
+	for start := time.Duration(0); start < duration; start += step {
+		length := min(options.ChunkDuration, duration-start)
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(FFmpegBinary, "-v", "error",
+			"-ss", strconv.FormatFloat(start.Seconds(), 'f', 3, 64),
+			"-t", strconv.FormatFloat(length.Seconds(), 'f', 3, 64),
+			"-i", filepath, "-vn", "-ac", "1", "-ar", "16000", "-b:a", "64k", "-f", "mp3", "-")
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("failed to extract audio chunk at %s: %w: %s", start, err, strings.TrimSpace(stderr.String()))
+		}
+
+		if stdout.Len() > options.MaxChunkBytes {
+			return nil, fmt.Errorf("audio chunk at %s exceeds %d bytes, use a shorter chunk duration", start, options.MaxChunkBytes)
+		}
+
+		chunks = append(chunks, models.AudioChunk{
+			Index:    len(chunks),
+			Start:    start,
+			Duration: length,
+			Data:     stdout.Bytes(),
+			Format:   "mp3",
+		})
+
+		if start+length >= duration {
+			break
+		}
+	}
+
+	return chunks, nil
+}
+
+// TranscribeAudio chunks an audio file, transcribes the chunks concurrently and stitches the results.
+func (utility *SideKick) TranscribeAudio(ctx context.Context, filepath string, options AudioChunkOptions, transcriber Transcriber) (models.Transcript, error) {
+	chunks, err := utility.ChunkAudio(filepath, options)
+	if err != nil {
+		return models.Transcript{}, err
+	}
+
+	return utility.TranscribeChunks(ctx, chunks, options, transcriber)
+}
+
+// TranscribeChunks transcribes the given chunks concurrently and stitches the text, removing
+// words that were transcribed twice because of overlapping chunks. Chunks transcribed without
+// segments are represented by a single segment spanning the chunk.
+func (utility *SideKick) TranscribeChunks(ctx context.Context, chunks []models.AudioChunk, options AudioChunkOptions, transcriber Transcriber) (models.Transcript, error) {
+	if transcriber == nil {
+		return models.Transcript{}, errors.New("transcriber must not be nil")
+	}
+	options = options.withDefaults()
+
+	results := make([]models.Transcript, len(chunks))
+	errs := make([]error, len(chunks))
+	semaphore := make(chan struct{}, options.Concurrency)
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk models.AudioChunk) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], errs[i] = transcriber(ctx, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return models.Transcript{}, fmt.Errorf("failed to transcribe audio: %w", err)
+	}
+
+	var transcript models.Transcript
+	var end time.Duration
+	for i, chunk := range chunks {
+		if len(results[i].Segments) == 0 {
+			transcript.Segments = append(transcript.Segments, models.TranscriptSegment{
+				Start: chunk.Start,
+				End:   chunk.Start + chunk.Duration,
+				Text:  trimOverlap(lastSegmentsText(transcript.Segments), strings.TrimSpace(results[i].Text)),
+			})
+			end = chunk.Start + chunk.Duration
+			continue
+		}
+
+		// skip segments already covered by the previous chunk and trim the words
+		// repeated by the first segment reaching past it
+		first := true
+		for _, segment := range results[i].Segments {
+			if segment.End <= end {
+				continue
+			}
+			segment.Text = strings.TrimSpace(segment.Text)
+			if first {
+				segment.Text = trimOverlap(lastSegmentsText(transcript.Segments), segment.Text)
+				segment.Start = max(segment.Start, end)
+				first = false
+			}
+			if segment.Text == "" {
+				continue
+			}
+			transcript.Segments = append(transcript.Segments, segment)
+			end = segment.End
+		}
+	}
+
+	parts := make([]string, 0, len(transcript.Segments))
+	for _, segment := range transcript.Segments {
+		if segment.Text != "" {
+			parts = append(parts, segment.Text)
+		}
+	}
+	transcript.Text = strings.Join(parts, " ")
+
+	return transcript, nil
+}
+
+// lastSegmentsText returns the text of the trailing segments, up to maxOverlapWords words.
+func lastSegmentsText(segments []models.TranscriptSegment) string {
+	var words []string
+	for i := len(segments) - 1; i >= 0 && len(words) < maxOverlapWords; i-- {
+		words = append(strings.Fields(segments[i].Text), words...)
+	}
+	return strings.Join(words, " ")
+}
+
+// trimOverlap removes the longest run of leading words in next that repeats the trailing words of previous.
+func trimOverlap(previous, next string) string {
+	previousWords := strings.Fields(previous)
+	nextWords := strings.Fields(next)
+
+	limit := min(len(previousWords), len(nextWords), maxOverlapWords)
+	for size := limit; size > 0; size-- {
+		if equalWords(previousWords[len(previousWords)-size:], nextWords[:size]) {
+			return strings.Join(nextWords[size:], " ")
+		}
+	}
+
+	return next
+}
+
+// equalWords compares two word slices, ignoring case and surrounding punctuation.
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeWord lowercases a word and strips surrounding punctuation.
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.Trim(word, ".,;:!?\"'()[]"))
+}
@@ -0,0 +1,192 @@
+package sidekick
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// AuditLog writes the records of an audit trail as JSON lines. It is safe for concurrent use.
+type AuditLog struct {
+	MaxBodySize int      // Bytes of a body that are written, see models.AuditConfiguration
+	Secrets     []string // Values replaced in URLs and bodies, e.g. the API key
+
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewAuditLog returns an audit log writing to w. Secrets are redacted wherever they appear.
+func NewAuditLog(w io.Writer, maxBodySize int, secrets ...string) *AuditLog {
+	return &AuditLog{MaxBodySize: maxBodySize, Secrets: secrets, writer: w}
+}
+
+// OpenAuditLog returns an audit log appending to the file at path, which is created if needed.
+func OpenAuditLog(path string, maxBodySize int, secrets ...string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(file, maxBodySize, secrets...), nil
+}
+
+// Write appends a record to the audit trail.
+func (log *AuditLog) Write(record models.AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	_, err = log.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file of the audit log, if it writes to one.
+func (log *AuditLog) Close() error {
+	if closer, ok := log.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// limit returns the number of bytes of a body that are written, or -1 for none.
+func (log *AuditLog) limit() int {
+	switch {
+	case log.MaxBodySize < 0:
+		return -1
+	case log.MaxBodySize == 0:
+		return models.DefaultAuditMaxBodySize
+	}
+	return log.MaxBodySize
+}
+
+// slack returns the length of the longest secret, read beyond the size limit so that secrets are
+// redacted before bodies are truncated.
+func (log *AuditLog) slack() int {
+	var slack int
+	for _, secret := range log.Secrets {
+		slack = max(slack, len(secret))
+	}
+	return slack
+}
+
+// body returns the redacted body, truncated to the size limit.
+func (log *AuditLog) body(data []byte, truncated bool) (string, bool) {
+	text := log.redact(string(data))
+	if limit := log.limit(); len(text) > limit {
+		text, truncated = text[:limit], true
+	}
+	return text, truncated
+}
+
+// redact replaces the secrets in text.
+func (log *AuditLog) redact(text string) string {
+	return secrets(log.Secrets).redact(text)
+}
+
+// headers returns the headers with the credentials replaced.
+func (log *AuditLog) headers(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(header))
+	for name, values := range secrets(log.Secrets).header(header) {
+		result[name] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// AuditTransport writes each request and its response to an audit log. The record of a response is
+// written once its body is closed, so streamed responses are recorded as received. Errors writing the
+// audit trail do not fail requests.
+type AuditTransport struct {
+	Base http.RoundTripper // Transport sending the requests, defaults to http.DefaultTransport
+	Log  *AuditLog
+}
+
+// RoundTrip implements http.RoundTripper.
+func (transport *AuditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	log := transport.Log
+	record := models.AuditRecord{
+		Time:           time.Now(),
+		Method:         req.Method,
+		URL:            secrets(log.Secrets).url(req.URL),
+		RequestHeaders: log.headers(req.Header),
+	}
+
+	if log.limit() >= 0 {
+		body, sent, err := readBody(req)
+		if err != nil {
+			return nil, err
+		}
+		req = sent
+		record.RequestBody, record.RequestTruncated = log.body(body, false)
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		record.Duration = time.Since(record.Time).Seconds()
+		record.Error = log.redact(err.Error())
+		log.Write(record)
+		return resp, err
+	}
+	record.Status = resp.StatusCode
+	record.ResponseHeaders = log.headers(resp.Header)
+	body := &auditBody{ReadCloser: resp.Body, log: log, record: record, limit: -1}
+	if limit := log.limit(); limit >= 0 {
+		body.limit = limit + log.slack()
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// auditBody records a response body as it is read and writes the record when it is closed.
+type auditBody struct {
+	io.ReadCloser
+	log       *AuditLog
+	record    models.AuditRecord
+	limit     int
+	body      bytes.Buffer
+	truncated bool
+	once      sync.Once
+}
+
+// Read implements io.Reader.
+func (body *auditBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if body.limit >= 0 && n > 0 {
+		keep := min(n, body.limit-body.body.Len())
+		body.body.Write(p[:keep])
+		if keep < n {
+			body.truncated = true
+		}
+	}
+	if err != nil && err != io.EOF && body.record.Error == "" {
+		body.record.Error = body.log.redact(err.Error())
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (body *auditBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(func() {
+		body.record.Duration = time.Since(body.record.Time).Seconds()
+		if body.limit >= 0 {
+			body.record.ResponseBody, body.record.ResponseTruncated = body.log.body(body.body.Bytes(), body.truncated)
+		}
+		body.log.Write(body.record)
+	})
+	return err
+}
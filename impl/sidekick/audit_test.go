@@ -0,0 +1,64 @@
+package sidekick_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestAuditTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"prompt":"hello","key":"sk-secret"}` {
+			t.Errorf("unexpected body sent: %s", body)
+		}
+		w.Header().Set("X-Request-Id", "req-1")
+		fmt.Fprint(w, strings.Repeat("x", 20))
+	}))
+	defer server.Close()
+
+	var trail bytes.Buffer
+	client := &http.Client{Transport: &sidekick.AuditTransport{Log: sidekick.NewAuditLog(&trail, 16, "sk-secret")}}
+	// a reader without GetBody, which the transport must not consume
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat?api_key=sk-secret&stream=true", io.MultiReader(strings.NewReader(`{"prompt":"hello","key":"sk-secret"}`)))
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if trail.Len() != 0 {
+		t.Errorf("expected the record to be written once the body is closed")
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(trail.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 record, got %d: %s", len(lines), trail.String())
+	}
+	if strings.Contains(lines[0], "sk-secret") {
+		t.Errorf("expected the API key to be redacted: %s", lines[0])
+	}
+	var record models.AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid record: %v", err)
+	}
+	if record.Method != http.MethodPost || record.Status != http.StatusOK || record.RequestHeaders["Authorization"] != "[redacted]" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.RequestBody != `{"prompt":"hello` || !record.RequestTruncated {
+		t.Errorf("expected the truncated request body, got %q", record.RequestBody)
+	}
+	if record.ResponseBody != strings.Repeat("x", 16) || !record.ResponseTruncated || record.ResponseHeaders["X-Request-Id"] != "req-1" {
+		t.Errorf("expected the truncated response, got %+v", record)
+	}
+}
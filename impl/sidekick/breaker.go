@@ -0,0 +1,94 @@
+package sidekick
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrCircuitOpen is returned for calls of a function whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreakers keep the circuit breaker of each function. After ToolConfiguration.BreakerThreshold
+// consecutive calls failed because the tool was unavailable, the breaker of the function opens and calls
+// fail with ErrCircuitOpen until the cooldown has passed. The breaker is then half-open: a single trial
+// call is let through while concurrent calls keep failing with ErrCircuitOpen. If the trial fails, the
+// breaker opens again, otherwise it closes. Every call allowed by Allow must be ended with Record, or with
+// Release if it never reached the tool. The zero value is ready to use and a nil CircuitBreakers never
+// opens. It is safe for concurrent use.
+type CircuitBreakers struct {
+	mutex    sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	trial     bool // a trial call of the half-open breaker is running
+}
+
+// Allow returns ErrCircuitOpen if the breaker of the function is open, or half-open with its trial call
+// still running. Otherwise the call may go ahead; the first call after the cooldown becomes the trial.
+func (breakers *CircuitBreakers) Allow(function string) error {
+	if breakers == nil {
+		return nil
+	}
+	breakers.mutex.Lock()
+	defer breakers.mutex.Unlock()
+	state, exists := breakers.circuits[function]
+	if !exists || state.openUntil.IsZero() {
+		return nil
+	}
+	if time.Now().Before(state.openUntil) {
+		return fmt.Errorf("%w: %s failed %d times in a row, not calling it before %s", ErrCircuitOpen, function, state.failures, state.openUntil.Format(time.RFC3339))
+	}
+	if state.trial {
+		return fmt.Errorf("%w: %s failed %d times in a row, waiting for a trial call", ErrCircuitOpen, function, state.failures)
+	}
+	state.trial = true
+	return nil
+}
+
+// Release ends a call allowed by Allow that never reached the tool, letting another call become the trial
+// of a half-open breaker.
+func (breakers *CircuitBreakers) Release(function string) {
+	if breakers == nil {
+		return
+	}
+	breakers.mutex.Lock()
+	defer breakers.mutex.Unlock()
+	if state, exists := breakers.circuits[function]; exists {
+		state.trial = false
+	}
+}
+
+// Record records the outcome of a call of the function, opening its breaker once the failures reach the
+// threshold of config.
+func (breakers *CircuitBreakers) Record(function string, failed bool, config models.ToolConfiguration) {
+	if breakers == nil || config.BreakerThreshold <= 0 {
+		return
+	}
+	breakers.mutex.Lock()
+	defer breakers.mutex.Unlock()
+	if !failed {
+		delete(breakers.circuits, function)
+		return
+	}
+
+	if breakers.circuits == nil {
+		breakers.circuits = make(map[string]*circuit)
+	}
+	state, exists := breakers.circuits[function]
+	if !exists {
+		state = new(circuit)
+		breakers.circuits[function] = state
+	}
+	state.trial = false
+	state.failures++
+	if state.failures >= config.BreakerThreshold {
+		state.openUntil = time.Now().Add(config.Cooldown())
+	}
+}
@@ -0,0 +1,35 @@
+package sidekick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// SelectChoice returns the candidate answer the selector of the request picks, the first one without
+// selector. If there are several candidates, the returned message holds all of them in Choices.
+func SelectChoice(ctx context.Context, request models.MessageRequest, choices []models.Message) (models.Message, error) {
+	if len(choices) == 0 {
+		return models.Message{}, errors.New("no choices in response")
+	}
+	if len(choices) == 1 {
+		return choices[0], nil
+	}
+
+	index := 0
+	if request.SelectChoice != nil {
+		var err error
+		if index, err = request.SelectChoice(ctx, request.Message, choices); err != nil {
+			return models.Message{}, fmt.Errorf("failed to select choice: %w", err)
+		}
+		if index < 0 || index >= len(choices) {
+			return models.Message{}, fmt.Errorf("selected choice %d out of range [0, %d)", index, len(choices))
+		}
+	}
+
+	selected := choices[index]
+	selected.Choices = choices
+	return selected, nil
+}
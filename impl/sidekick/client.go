@@ -0,0 +1,48 @@
+package sidekick
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// NewHttpClient returns the client of a companion: with the timeout, proxy, TLS and connection settings
+// of config, retrying requests, writing the audit trail and dumping the requests as configured. If the
+// audit file cannot be opened, the error is printed and the client is returned without audit trail. If the
+// proxy or certificates cannot be set up, the error is printed and all requests fail with it.
+func NewHttpClient(config models.Configuration) *http.Client {
+	var transport http.RoundTripper
+	base, err := NewTransport(config.HttpConfig)
+	switch {
+	case err != nil:
+		(&SideKick{}).Error(err)
+		transport = failedTransport{err: err}
+	case base != nil:
+		transport = base
+	}
+
+	// every attempt of a retried request is recorded
+	if config.HttpConfig.DumpDir != "" {
+		transport = &DumpTransport{Base: transport, Dir: config.HttpConfig.DumpDir, Secrets: []string{config.ApiKey}}
+	}
+	if audit := config.HttpConfig.Audit; audit.File != "" {
+		log, err := OpenAuditLog(audit.File, audit.MaxBodySize, config.ApiKey)
+		if err != nil {
+			(&SideKick{}).Error(fmt.Errorf("audit trail disabled: %w", err))
+		} else {
+			transport = &AuditTransport{Base: transport, Log: log}
+		}
+	}
+
+	client := NewRetryClient(config.HttpConfig, config.Terminal)
+	if transport == nil {
+		return client
+	}
+	if retry, ok := client.Transport.(*RetryTransport); ok {
+		retry.Base = transport
+	} else {
+		client.Transport = transport
+	}
+	return client
+}
@@ -0,0 +1,298 @@
+package sidekick
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghmer/aicompanion/metrics"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Names of the built-in context strategies, selectable with Configuration.ContextStrategy.
+const (
+	SlidingWindowStrategy = "sliding_window"
+	SummarizeStrategy     = "summarize"
+	ImportanceStrategy    = "importance"
+)
+
+// ContextSummaryPrompt asks for a summary of the earlier conversation. It is followed by the transcript.
+const ContextSummaryPrompt = "Summarize the following conversation so it can replace it as memory. Keep names, facts, " +
+	"decisions and open questions; leave out greetings and small talk. Only return the summary."
+
+// DefaultRetainedMessages is the number of recent messages SummarizeAndRetain keeps if neither Retain nor
+// the maximum number of messages is set.
+const DefaultRetainedMessages = 10
+
+// maxCachedSummaries bounds the summaries cached by a SummarizeAndRetain strategy.
+const maxCachedSummaries = 64
+
+// Summarizer condenses messages into a summary, usually by asking the model of a companion.
+type Summarizer func(ctx context.Context, messages []models.Message) (string, error)
+
+// ContextRequest is what a ContextStrategy selects the history of a request from.
+type ContextRequest struct {
+	Context         context.Context // Context of the request, passed to Summarize; defaults to context.Background()
+	Conversation    []models.Message
+	IncludeStrategy models.IncludeStrategy
+	MaxMessages     int
+	MaxTokens       int              // Token budget of the request, 0 for no budget
+	Reserved        []models.Message // Messages sent along the history, e.g. the system role and the new message
+	Summarize       Summarizer       // Summarizes messages for strategies that condense the history, may be nil
+}
+
+// ContextStrategy selects the messages of the conversation that are sent along with a request.
+type ContextStrategy interface {
+	SelectContext(request ContextRequest) []models.Message
+}
+
+var (
+	contextStrategiesMutex sync.RWMutex
+	contextStrategies      = map[string]ContextStrategy{
+		SlidingWindowStrategy: SlidingWindow{},
+		SummarizeStrategy:     &SummarizeAndRetain{},
+		ImportanceStrategy:    ImportanceWeighted{},
+	}
+)
+
+// RegisterContextStrategy makes a strategy selectable by name with Configuration.ContextStrategy.
+func RegisterContextStrategy(name string, strategy ContextStrategy) {
+	contextStrategiesMutex.Lock()
+	defer contextStrategiesMutex.Unlock()
+	contextStrategies[name] = strategy
+}
+
+// LookupContextStrategy returns the strategy registered under name, or SlidingWindow if there is none.
+func LookupContextStrategy(name string) ContextStrategy {
+	contextStrategiesMutex.RLock()
+	defer contextStrategiesMutex.RUnlock()
+	if strategy, exists := contextStrategies[name]; exists {
+		return strategy
+	}
+	return SlidingWindow{}
+}
+
+// SelectContext selects the history of a request with the strategy registered under name.
+func (utility *SideKick) SelectContext(name string, request ContextRequest) []models.Message {
+	return LookupContextStrategy(name).SelectContext(request)
+}
+
+// summarizingKey marks the context of summary requests, see NewSummarizer.
+type summarizingKey struct{}
+
+// NewSummarizer returns a Summarizer that asks the model with ContextSummaryPrompt through generate,
+// usually the SendGenerateRequest method of a companion. The context of the summary request is marked,
+// so that SummarizeAndRetain does not summarize again while preparing it.
+func (utility *SideKick) NewSummarizer(generate func(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error)) Summarizer {
+	return func(ctx context.Context, messages []models.Message) (string, error) {
+		var builder strings.Builder
+		builder.WriteString(ContextSummaryPrompt)
+		builder.WriteString("\n\n")
+		for _, message := range messages {
+			fmt.Fprintf(&builder, "%s: %s\n", message.Role, message.Content)
+		}
+
+		ctx = context.WithValue(ctx, summarizingKey{}, true)
+		response, err := generate(ctx, models.MessageRequest{Message: utility.CreateUserMessage(builder.String(), nil)}, false, nil)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(response.Content), nil
+	}
+}
+
+// SlidingWindow keeps the most recent messages: at most MaxMessages of the included roles, and of those
+// as many as fit into the token budget.
+type SlidingWindow struct{}
+
+// SelectContext implements ContextStrategy.
+func (SlidingWindow) SelectContext(request ContextRequest) []models.Message {
+	utility := &SideKick{}
+	history := utility.PrepareArray(request.Conversation, request.IncludeStrategy, request.MaxMessages)
+	return utility.TrimTokens(history, request.MaxTokens, request.Reserved...)
+}
+
+// SummarizeAndRetain keeps the most recent messages and replaces the older ones by a summary, which is
+// sent as system message before them. Pinned messages are kept and not summarized. Summaries are cached and extended incrementally as messages age
+// out of the window. Without a Summarizer, if summarizing fails, or while a summary is requested, it
+// behaves like SlidingWindow.
+type SummarizeAndRetain struct {
+	Retain    int               // Recent messages kept verbatim, defaults to MaxMessages or DefaultRetainedMessages
+	Collector metrics.Collector // Records the lookups of the summary cache as "context_summary", may be nil
+
+	mutex     sync.Mutex
+	summaries map[string]summary // by the ID of the last summarized message
+}
+
+type summary struct {
+	text  string
+	count int // number of summarized messages
+}
+
+// SelectContext implements ContextStrategy.
+func (strategy *SummarizeAndRetain) SelectContext(request ContextRequest) []models.Message {
+	utility := &SideKick{}
+	retain := strategy.Retain
+	if retain <= 0 {
+		retain = request.MaxMessages
+	}
+	if retain <= 0 {
+		retain = DefaultRetainedMessages
+	}
+
+	// pinned messages are kept verbatim and not summarized
+	included := utility.PrepareArray(request.Conversation, request.IncludeStrategy, len(request.Conversation))
+	var older, kept []models.Message
+	var unpinned int
+	for _, message := range included {
+		if !message.Pinned {
+			unpinned++
+		}
+	}
+	for _, message := range included {
+		if !message.Pinned && len(older) < unpinned-retain {
+			older = append(older, message)
+			continue
+		}
+		kept = append(kept, message)
+	}
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// a companion preparing the summary request must not summarize again, which would recurse forever
+	if len(older) == 0 || request.Summarize == nil || ctx.Value(summarizingKey{}) != nil {
+		return SlidingWindow{}.SelectContext(request)
+	}
+
+	text, err := strategy.summarize(ctx, older, request.Summarize)
+	if err != nil {
+		utility.Error(fmt.Errorf("failed to summarize conversation: %w", err))
+		return SlidingWindow{}.SelectContext(request)
+	}
+
+	memory := models.Message{Role: models.System, Content: "Summary of the earlier conversation:\n" + text}
+	reserved := append([]models.Message{memory}, request.Reserved...)
+	return append([]models.Message{memory}, utility.TrimTokens(kept, request.MaxTokens, reserved...)...)
+}
+
+// summarize returns the summary of messages, extending a cached summary of their beginning if possible.
+func (strategy *SummarizeAndRetain) summarize(ctx context.Context, messages []models.Message, summarizer Summarizer) (string, error) {
+	last := messages[len(messages)-1].ID
+
+	strategy.mutex.Lock()
+	if strategy.summaries == nil {
+		strategy.summaries = make(map[string]summary)
+	}
+	if cached, exists := strategy.summaries[last]; exists && last != "" {
+		strategy.mutex.Unlock()
+		strategy.observeCache(true)
+		return cached.text, nil
+	}
+
+	// extend the longest cached summary of a prefix of the messages
+	var previous summary
+	for i := len(messages) - 2; i >= 0 && previous.count == 0; i-- {
+		if cached, exists := strategy.summaries[messages[i].ID]; exists && messages[i].ID != "" && cached.count == i+1 {
+			previous = cached
+		}
+	}
+	strategy.mutex.Unlock()
+	strategy.observeCache(false)
+
+	input := messages[previous.count:]
+	if previous.count > 0 {
+		input = append([]models.Message{{Role: models.System, Content: "Summary so far: " + previous.text}}, input...)
+	}
+	text, err := summarizer(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	if last != "" {
+		strategy.mutex.Lock()
+		if len(strategy.summaries) >= maxCachedSummaries {
+			strategy.summaries = make(map[string]summary)
+		}
+		strategy.summaries[last] = summary{text: text, count: len(messages)}
+		strategy.mutex.Unlock()
+	}
+	return text, nil
+}
+
+// observeCache records a lookup of the summary cache.
+func (strategy *SummarizeAndRetain) observeCache(hit bool) {
+	if strategy.Collector != nil {
+		strategy.Collector.ObserveCache("context_summary", hit)
+	}
+}
+
+// ImportanceWeighted keeps the pinned messages and the most important other messages that fit into
+// MaxMessages and the token budget, in their original order. Like SlidingWindow, it keeps no other
+// messages if MaxMessages is 0. Importance defaults to DefaultImportance.
+type ImportanceWeighted struct {
+	Importance func(message models.Message, position, total int) float64
+}
+
+// DefaultImportance weights messages by recency from 0 to 1, adding 0.3 for user messages, which carry
+// the intent of the conversation, and 0.2 for messages with tool calls.
+func DefaultImportance(message models.Message, position, total int) float64 {
+	score := float64(position+1) / float64(total)
+	if message.Role == models.User {
+		score += 0.3
+	}
+	if len(message.ToolCalls) > 0 {
+		score += 0.2
+	}
+	return score
+}
+
+// SelectContext implements ContextStrategy.
+func (strategy ImportanceWeighted) SelectContext(request ContextRequest) []models.Message {
+	utility := &SideKick{}
+	importance := strategy.Importance
+	if importance == nil {
+		importance = DefaultImportance
+	}
+
+	included := utility.PrepareArray(request.Conversation, request.IncludeStrategy, len(request.Conversation))
+	order := make([]int, len(included))
+	scores := make([]float64, len(included))
+	for i, message := range included {
+		order[i] = i
+		scores[i] = importance(message, i, len(included))
+	}
+	// pinned messages come first and are selected regardless of the limits
+	sort.SliceStable(order, func(a, b int) bool {
+		if included[order[a]].Pinned != included[order[b]].Pinned {
+			return included[order[a]].Pinned
+		}
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	budget := request.MaxTokens - utility.CountTokens(request.Reserved...)
+	var selected []int
+	for _, i := range order {
+		pinned := included[i].Pinned
+		if !pinned && len(selected) >= request.MaxMessages {
+			break
+		}
+		if request.MaxTokens > 0 {
+			tokens := utility.CountTokens(included[i])
+			if !pinned && tokens > budget {
+				continue
+			}
+			budget -= tokens
+		}
+		selected = append(selected, i)
+	}
+	sort.Ints(selected)
+
+	history := make([]models.Message, len(selected))
+	for i, position := range selected {
+		history[i] = included[position]
+	}
+	return history
+}
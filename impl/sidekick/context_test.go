@@ -0,0 +1,89 @@
+package sidekick_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func testHistory(n int) []models.Message {
+	history := make([]models.Message, n)
+	for i := range history {
+		role := models.User
+		if i%2 == 1 {
+			role = models.Assistant
+		}
+		history[i] = models.Message{ID: fmt.Sprint(i), Role: role, Content: fmt.Sprintf("message %d", i)}
+	}
+	return history
+}
+
+func TestSlidingWindow(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	history := utility.SelectContext("unknown", sidekick.ContextRequest{Conversation: testHistory(6), IncludeStrategy: models.IncludeBoth, MaxMessages: 4})
+	if len(history) != 4 || history[0].ID != "2" {
+		t.Errorf("expected the last 4 messages, got %+v", history)
+	}
+}
+
+func TestSummarizeAndRetain(t *testing.T) {
+	var calls [][]models.Message
+	summarize := func(ctx context.Context, messages []models.Message) (string, error) {
+		calls = append(calls, messages)
+		return fmt.Sprintf("summary of %d", len(messages)), nil
+	}
+	strategy := &sidekick.SummarizeAndRetain{Retain: 2}
+	request := sidekick.ContextRequest{Conversation: testHistory(5), IncludeStrategy: models.IncludeBoth, MaxMessages: 10, Summarize: summarize}
+
+	history := strategy.SelectContext(request)
+	if len(history) != 3 || history[0].Role != models.System || !strings.Contains(history[0].Content, "summary of 3") || history[1].ID != "3" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// the cached summary is reused and extended by the messages aging out of the window
+	strategy.SelectContext(request)
+	request.Conversation = testHistory(6)
+	strategy.SelectContext(request)
+	if len(calls) != 2 || len(calls[1]) != 2 || !strings.Contains(calls[1][0].Content, "summary of 3") || calls[1][1].ID != "3" {
+		t.Errorf("unexpected summarizer calls %+v", calls)
+	}
+
+	// failing summaries fall back to the sliding window
+	request.Conversation = testHistory(8)
+	request.MaxMessages = 4
+	request.Summarize = func(context.Context, []models.Message) (string, error) { return "", errors.New("unavailable") }
+	if history := strategy.SelectContext(request); len(history) != 4 || history[0].Role == models.System {
+		t.Errorf("expected the sliding window, got %+v", history)
+	}
+}
+
+func TestImportanceWeighted(t *testing.T) {
+	history := testHistory(6)
+	history[0].ToolCalls = []models.ToolCall{{Payload: models.FunctionPayload{FunctionName: "lookup"}}}
+
+	selected := sidekick.ImportanceWeighted{}.SelectContext(sidekick.ContextRequest{Conversation: history, IncludeStrategy: models.IncludeBoth, MaxMessages: 3})
+	var ids []string
+	for _, message := range selected {
+		ids = append(ids, message.ID)
+	}
+	// user messages outweigh assistant messages of similar age, the original order is kept
+	if strings.Join(ids, ",") != "2,4,5" {
+		t.Errorf("unexpected selection %v", ids)
+	}
+
+	weighted := sidekick.ImportanceWeighted{Importance: func(message models.Message, position, total int) float64 {
+		if len(message.ToolCalls) > 0 {
+			return 10
+		}
+		return sidekick.DefaultImportance(message, position, total)
+	}}
+	selected = weighted.SelectContext(sidekick.ContextRequest{Conversation: history, IncludeStrategy: models.IncludeBoth, MaxMessages: 2})
+	if len(selected) != 2 || selected[0].ID != "0" || selected[1].ID != "4" {
+		t.Errorf("unexpected weighted selection %+v", selected)
+	}
+}
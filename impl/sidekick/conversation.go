@@ -0,0 +1,303 @@
+package sidekick
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// EncryptedTranscriptHeader starts the first line of encrypted transcripts, which is followed by the base64
+// encoded ciphertext.
+const EncryptedTranscriptHeader = "aicompanion-encrypted-transcript v1"
+
+var (
+	// transcriptHeading matches the heading starting a message of a Markdown transcript.
+	transcriptHeading = regexp.MustCompile(`^## (system|developer|user|assistant|tool)(?: \(([^)]+)\))?$`)
+	// transcriptImage matches an image reference of a Markdown transcript.
+	transcriptImage = regexp.MustCompile(`^!\[image\]\(([^)]+)\)$`)
+)
+
+// StampMessage assigns an ID and the creation time to a message that the provider has not set.
+func (utility *SideKick) StampMessage(message models.Message) models.Message {
+	if message.ID == "" {
+		id := make([]byte, 12)
+		if _, err := rand.Read(id); err == nil {
+			message.ID = hex.EncodeToString(id)
+		}
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	return message
+}
+
+// RemoveLastExchange splits a conversation before its last user message. It returns the messages before
+// it and the removed exchange: the user message and everything following it, such as the reply and tool
+// results. A conversation without user messages is returned unchanged.
+func (utility *SideKick) RemoveLastExchange(conversation []models.Message) ([]models.Message, []models.Message) {
+	for i := len(conversation) - 1; i >= 0; i-- {
+		if conversation[i].Role == models.User {
+			removed := append([]models.Message(nil), conversation[i:]...)
+			return conversation[:i], removed
+		}
+	}
+	return conversation, nil
+}
+
+// TruncateAfter returns the messages of a conversation up to and including index. An index of -1
+// removes all messages.
+func (utility *SideKick) TruncateAfter(conversation []models.Message, index int) ([]models.Message, error) {
+	if index < -1 || index >= len(conversation) {
+		return nil, fmt.Errorf("message index %d out of range [-1, %d)", index, len(conversation))
+	}
+	return conversation[:index+1], nil
+}
+
+// ExportConversation writes a conversation as transcript in the given format. The JSON format embeds
+// images and can be imported without loss. The Markdown format writes images to files in imageDir, which
+// defaults to the working directory, and references them by path. If key is set, the transcript is
+// encrypted with AES-GCM using the base64 encoded key, and Markdown transcripts embed their images as
+// data URIs instead of writing them to unencrypted files.
+func (utility *SideKick) ExportConversation(w io.Writer, conversation []models.Message, format models.ConversationFormat, imageDir string, key string) error {
+	if key == "" {
+		return exportTranscript(w, conversation, format, imageDir, false)
+	}
+
+	var buffer bytes.Buffer
+	if err := exportTranscript(&buffer, conversation, format, imageDir, true); err != nil {
+		return err
+	}
+	ciphertext, err := conversationstore.Encrypt(key, buffer.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt transcript: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n%s\n", EncryptedTranscriptHeader, base64.StdEncoding.EncodeToString(ciphertext)); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+func exportTranscript(w io.Writer, conversation []models.Message, format models.ConversationFormat, imageDir string, embedImages bool) error {
+	switch format {
+	case models.ConversationJSON:
+		return exportJSON(w, conversation)
+	case models.ConversationMarkdown:
+		return exportMarkdown(w, conversation, imageDir, embedImages)
+	default:
+		return fmt.Errorf("unsupported transcript format %q", format)
+	}
+}
+
+func exportJSON(w io.Writer, conversation []models.Message) error {
+	transcript := models.ConversationExport{
+		Version:  models.ConversationExportVersion,
+		Exported: time.Now().UTC(),
+		Messages: make([]models.ExportedMessage, len(conversation)),
+	}
+	for i, message := range conversation {
+		transcript.Messages[i] = models.NewExportedMessage(message)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(transcript); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+func exportMarkdown(w io.Writer, conversation []models.Message, imageDir string, embedImages bool) error {
+	var builder strings.Builder
+	builder.WriteString("# Conversation\n")
+	for _, message := range conversation {
+		builder.WriteString("\n## ")
+		builder.WriteString(string(message.Role))
+		if !message.CreatedAt.IsZero() {
+			builder.WriteString(" (" + message.CreatedAt.Format(time.RFC3339) + ")")
+		}
+		builder.WriteString("\n\n")
+		if content := strings.TrimSpace(message.Content); content != "" {
+			builder.WriteString(content)
+			builder.WriteString("\n")
+		}
+
+		if message.Images == nil {
+			continue
+		}
+		for _, image := range *message.Images {
+			if embedImages {
+				builder.WriteString("\n![image](" + image.DataURI() + ")\n")
+				continue
+			}
+			path, err := writeImage(image, imageDir)
+			if err != nil {
+				return err
+			}
+			builder.WriteString("\n![image](" + filepath.ToSlash(path) + ")\n")
+		}
+	}
+
+	if _, err := io.WriteString(w, builder.String()); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// writeImage writes an image to a file in dir named after its content and returns the path of the file.
+func writeImage(image models.Base64Image, dir string) (string, error) {
+	data, err := image.GetData()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	extension := "bin"
+	if _, subtype, found := strings.Cut(image.GetMimeType(), "/"); found {
+		extension = subtype
+	}
+	path := filepath.Join(dir, hex.EncodeToString(sum[:8])+"."+extension)
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create image directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	return path, nil
+}
+
+// ImportConversation reads a transcript written by ExportConversation. The format is detected from the
+// content: transcripts starting with "{" are read as JSON, all others as Markdown. Images of Markdown
+// transcripts are read from the referenced files or data URIs. Encrypted transcripts are decrypted with
+// key, the base64 encoded key they were exported with.
+func (utility *SideKick) ImportConversation(r io.Reader, key string) ([]models.Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+
+	if encoded, found := bytes.CutPrefix(bytes.TrimSpace(data), []byte(EncryptedTranscriptHeader)); found {
+		if key == "" {
+			return nil, errors.New("transcript is encrypted, but no encryption key is configured")
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode transcript: %w", err)
+		}
+		if data, err = conversationstore.Decrypt(key, ciphertext); err != nil {
+			return nil, err
+		}
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return importJSON(data)
+	}
+	return importMarkdown(data)
+}
+
+func importJSON(data []byte) ([]models.Message, error) {
+	var transcript models.ConversationExport
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return nil, fmt.Errorf("failed to parse transcript: %w", err)
+	}
+	if transcript.Version > models.ConversationExportVersion {
+		return nil, fmt.Errorf("unsupported transcript version %d", transcript.Version)
+	}
+
+	conversation := make([]models.Message, len(transcript.Messages))
+	for i, entry := range transcript.Messages {
+		conversation[i] = entry.Message()
+	}
+	return conversation, nil
+}
+
+func importMarkdown(data []byte) ([]models.Message, error) {
+	var conversation []models.Message
+	var current *models.Message
+	var lines []string
+	flush := func() {
+		if current != nil {
+			current.Content = strings.TrimSpace(strings.Join(lines, "\n"))
+			conversation = append(conversation, *current)
+		}
+		lines = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if match := transcriptHeading.FindStringSubmatch(line); match != nil {
+			flush()
+			current = &models.Message{Role: models.Role(match[1])}
+			if match[2] != "" {
+				timestamp, err := time.Parse(time.RFC3339, match[2])
+				if err != nil {
+					return nil, fmt.Errorf("invalid time of message %d: %w", len(conversation)+1, err)
+				}
+				current.CreatedAt = timestamp
+			}
+			continue
+		}
+		if current == nil {
+			// title and preamble
+			continue
+		}
+
+		if match := transcriptImage.FindStringSubmatch(line); match != nil {
+			image, err := readImage(match[1])
+			if err != nil {
+				return nil, err
+			}
+			if current.Images == nil {
+				current.Images = &[]models.Base64Image{}
+			}
+			*current.Images = append(*current.Images, image)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	flush()
+
+	return conversation, nil
+}
+
+// readImage reads an image referenced by a Markdown transcript, either a file path or a data URI.
+func readImage(reference string) (models.Base64Image, error) {
+	var image models.Base64Image
+	if strings.HasPrefix(reference, "data:") {
+		quoted, _ := json.Marshal(reference)
+		if err := image.UnmarshalJSON(quoted); err != nil {
+			return image, err
+		}
+		return image, nil
+	}
+
+	data, err := os.ReadFile(filepath.FromSlash(reference))
+	if err != nil {
+		return image, fmt.Errorf("failed to read image: %w", err)
+	}
+	image.SetData(data)
+	return image, nil
+}
@@ -0,0 +1,148 @@
+package sidekick_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image/color"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func testConversation(t *testing.T) []models.Message {
+	data, err := createTestImage(4, 4, color.RGBA{0, 0, 255, 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var image models.Base64Image
+	image.SetData(data)
+
+	start := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	return []models.Message{
+		{Role: models.User, Content: "What colour is this?\n\nIt is small.", Images: &[]models.Base64Image{image}, CreatedAt: start},
+		{Role: models.Assistant, Content: "It is blue.", CreatedAt: start.Add(time.Minute)},
+	}
+}
+
+func TestExportConversationJSON(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	conversation := testConversation(t)
+	conversation[1].ToolCalls = []models.ToolCall{{Payload: models.FunctionPayload{FunctionName: "paint", Arguments: map[string]any{"colour": "blue"}}}}
+
+	var buffer bytes.Buffer
+	if err := utility.ExportConversation(&buffer, conversation, models.ConversationJSON, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := utility.ImportConversation(&buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(imported, conversation) {
+		t.Errorf("expected %+v, got %+v", conversation, imported)
+	}
+}
+
+func TestExportConversationMarkdown(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	conversation := testConversation(t)
+	imageDir := t.TempDir()
+
+	var buffer bytes.Buffer
+	if err := utility.ExportConversation(&buffer, conversation, models.ConversationMarkdown, imageDir, ""); err != nil {
+		t.Fatal(err)
+	}
+	transcript := buffer.String()
+	if !strings.Contains(transcript, "## user (2026-10-18T09:30:00Z)") || !strings.Contains(transcript, "![image]("+imageDir) {
+		t.Errorf("unexpected transcript:\n%s", transcript)
+	}
+
+	imported, err := utility.ImportConversation(&buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("expected 2 messages, got %+v", imported)
+	}
+	for i, message := range imported {
+		if message.Role != conversation[i].Role || message.Content != conversation[i].Content || !message.CreatedAt.Equal(conversation[i].CreatedAt) {
+			t.Errorf("message %d: expected %+v, got %+v", i, conversation[i], message)
+		}
+	}
+	if imported[0].Images == nil || (*imported[0].Images)[0].Data != (*conversation[0].Images)[0].Data {
+		t.Errorf("image was not restored")
+	}
+}
+
+func TestExportConversationUnsupportedFormat(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	if err := utility.ExportConversation(&bytes.Buffer{}, nil, "html", "", ""); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestExportConversationEncrypted(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	conversation := testConversation(t)
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	imageDir := t.TempDir()
+
+	var buffer bytes.Buffer
+	if err := utility.ExportConversation(&buffer, conversation, models.ConversationMarkdown, imageDir, key); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buffer.String(), sidekick.EncryptedTranscriptHeader) || strings.Contains(buffer.String(), "It is blue.") {
+		t.Errorf("transcript is not encrypted:\n%s", buffer.String())
+	}
+	if entries, _ := os.ReadDir(imageDir); len(entries) != 0 {
+		t.Errorf("expected images to be embedded, found %d files", len(entries))
+	}
+
+	if _, err := utility.ImportConversation(bytes.NewReader(buffer.Bytes()), ""); err == nil {
+		t.Error("expected an error without key")
+	}
+	wrongKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32))
+	if _, err := utility.ImportConversation(bytes.NewReader(buffer.Bytes()), wrongKey); !errors.Is(err, conversationstore.ErrDecryption) {
+		t.Errorf("expected a decryption error, got %v", err)
+	}
+
+	imported, err := utility.ImportConversation(&buffer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 || imported[1].Content != "It is blue." || imported[0].Images == nil || (*imported[0].Images)[0].Data != (*conversation[0].Images)[0].Data {
+		t.Errorf("unexpected conversation %+v", imported)
+	}
+}
+
+func TestRemoveLastExchange(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	conversation := testHistory(4)
+	conversation = append(conversation, models.Message{Role: models.Assistant, Content: "result of the tool call"})
+
+	kept, removed := utility.RemoveLastExchange(conversation)
+	if len(kept) != 2 || len(removed) != 3 || removed[0].ID != "2" || removed[2].Content != "result of the tool call" {
+		t.Errorf("unexpected split %+v / %+v", kept, removed)
+	}
+
+	assistant := []models.Message{{Role: models.Assistant, Content: "hello"}}
+	if kept, removed := utility.RemoveLastExchange(assistant); len(kept) != 1 || removed != nil {
+		t.Errorf("expected a conversation without user messages to be unchanged, got %+v / %+v", kept, removed)
+	}
+
+	if truncated, err := utility.TruncateAfter(conversation, 1); err != nil || len(truncated) != 2 || truncated[1].ID != "1" {
+		t.Errorf("unexpected truncation %+v: %v", truncated, err)
+	}
+	if truncated, err := utility.TruncateAfter(conversation, -1); err != nil || len(truncated) != 0 {
+		t.Errorf("expected an empty conversation, got %+v: %v", truncated, err)
+	}
+	if _, err := utility.TruncateAfter(conversation, 5); err == nil {
+		t.Error("expected an error for an index out of range")
+	}
+}
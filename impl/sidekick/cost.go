@@ -0,0 +1,45 @@
+package sidekick
+
+import "github.com/ghmer/aicompanion/models"
+
+// CostEstimator turns the usage of responses into currency figures, based on the prices per 1K tokens.
+type CostEstimator struct {
+	Pricing models.Pricing
+}
+
+// Estimate returns the cost of a response of model. It returns nil if the response has no usage or the
+// model has no price.
+func (estimator CostEstimator) Estimate(model string, usage *models.Usage) *models.Cost {
+	if usage == nil {
+		return nil
+	}
+	price, ok := estimator.Pricing.Price(model)
+	if !ok {
+		return nil
+	}
+	cost := models.Cost{
+		Input:    float64(usage.PromptTokens) * price.Input / 1000,
+		Output:   float64(usage.CompletionTokens) * price.Output / 1000,
+		Currency: estimator.Pricing.Currency,
+	}
+	cost.Total = cost.Input + cost.Output
+	return &cost
+}
+
+// Report estimates the costs of the models of a usage report. Costs per session cannot be derived from
+// the sums and are left empty; see UsageCounter for running totals per session.
+func (estimator CostEstimator) Report(usage models.UsageReport) models.CostReport {
+	var report models.CostReport
+	for model, sum := range usage.Models {
+		cost := estimator.Estimate(model, &sum)
+		if cost == nil {
+			continue
+		}
+		if report.Models == nil {
+			report.Models = make(map[string]models.Cost)
+		}
+		report.Models[model] = *cost
+		report.Total = report.Total.Add(*cost)
+	}
+	return report
+}
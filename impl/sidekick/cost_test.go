@@ -0,0 +1,58 @@
+package sidekick_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestCostEstimator(t *testing.T) {
+	estimator := sidekick.CostEstimator{Pricing: models.Pricing{
+		Currency: "USD",
+		Models: map[string]models.Price{
+			"gpt-4o":      {Input: 0.0025, Output: 0.01},
+			"gpt-4o-mini": {Input: 0.00015, Output: 0.0006},
+		},
+	}}
+	usage := &models.Usage{PromptTokens: 2000, CompletionTokens: 500, TotalTokens: 2500}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	tests := []struct {
+		model string
+		total float64
+	}{
+		{"gpt-4o", 0.01},
+		{"gpt-4o-2024-08-06", 0.01},
+		{"gpt-4o-mini-2024-07-18", 0.0006},
+	}
+	for _, test := range tests {
+		cost := estimator.Estimate(test.model, usage)
+		if cost == nil || !near(cost.Total, test.total) || !near(cost.Input+cost.Output, cost.Total) || cost.Currency != "USD" {
+			t.Errorf("%s: expected a total of %v, got %+v", test.model, test.total, cost)
+		}
+	}
+	if cost := estimator.Estimate("llama3", usage); cost != nil {
+		t.Errorf("expected no cost for an unpriced model, got %+v", cost)
+	}
+	if cost := estimator.Estimate("gpt-4o", nil); cost != nil {
+		t.Errorf("expected no cost without usage, got %+v", cost)
+	}
+
+	var counter sidekick.UsageCounter
+	counter.Record("default", "gpt-4o", usage, estimator.Estimate("gpt-4o", usage))
+	counter.Record("other", "gpt-4o", usage, estimator.Estimate("gpt-4o", usage))
+	counter.Record("other", "llama3", usage, estimator.Estimate("llama3", usage))
+
+	report := counter.Report()
+	if report.Responses != 3 || report.Costs == nil || report.Costs.Responses != 2 || !near(report.Costs.Total.Total, 0.02) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if !near(report.Costs.Sessions["other"].Total, 0.01) || len(report.Costs.Models) != 1 {
+		t.Errorf("unexpected costs %+v", report.Costs)
+	}
+	if derived := estimator.Report(report); !near(derived.Total.Total, 0.02) || !near(derived.Models["gpt-4o"].Total, 0.02) {
+		t.Errorf("unexpected derived costs %+v", derived)
+	}
+}
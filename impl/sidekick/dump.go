@@ -0,0 +1,106 @@
+package sidekick
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DumpTransport writes each request and its response in HTTP wire format to a file of its own in Dir,
+// for debugging provider incompatibilities. Credentials in headers and the secrets in the request are
+// redacted. The response body is written as it is read, so streams appear as received; the file is
+// closed with the body. Errors writing a dump do not fail requests.
+type DumpTransport struct {
+	Base    http.RoundTripper // Transport sending the requests, defaults to http.DefaultTransport
+	Dir     string            // Directory of the dumps, created if needed
+	Secrets []string          // Values replaced in URL and request body, e.g. the API key
+
+	sequence atomic.Int64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (transport *DumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	body, req, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := transport.create(req)
+	if err != nil {
+		return base.RoundTrip(req)
+	}
+	redact := secrets(transport.Secrets)
+	fmt.Fprintf(file, "%s %s %s\r\n", req.Method, redact.url(req.URL), req.Proto)
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(file, "Host: %s\r\n", host)
+	redact.header(req.Header).Write(file)
+	fmt.Fprintf(file, "\r\n%s\r\n\r\n", redact.redact(string(body)))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(file, "error: %s\n", redact.redact(err.Error()))
+		file.Close()
+		return resp, err
+	}
+	clean := *resp
+	clean.Header = redact.header(resp.Header)
+	if head, err := httputil.DumpResponse(&clean, false); err == nil {
+		file.Write(head)
+	}
+	resp.Body = &dumpBody{ReadCloser: resp.Body, file: file}
+	return resp, nil
+}
+
+// create creates the file of a dump, named after the time, a sequence number and the path of the request.
+func (transport *DumpTransport) create(req *http.Request) (*os.File, error) {
+	if err := os.MkdirAll(transport.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := strings.Trim(req.URL.Path, "/")
+	path = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, path)
+	name := fmt.Sprintf("%s-%04d-%s-%s.http", time.Now().Format("20060102T150405.000"), transport.sequence.Add(1), req.Method, path)
+	return os.OpenFile(filepath.Join(transport.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+}
+
+// dumpBody writes a response body to the dump as it is read.
+type dumpBody struct {
+	io.ReadCloser
+	file *os.File
+	once sync.Once
+}
+
+// Read implements io.Reader.
+func (body *dumpBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.file.Write(p[:n])
+	if err != nil && err != io.EOF {
+		fmt.Fprintf(body.file, "\nerror: %s\n", err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (body *dumpBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(func() { body.file.Close() })
+	return err
+}
@@ -0,0 +1,57 @@
+package sidekick_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+)
+
+func TestDumpTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"content\":\"Hello\"}\n\n")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "dumps")
+	client := &http.Client{Transport: &sidekick.DumpTransport{Dir: dir, Secrets: []string{"sk-secret"}}}
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","user":"sk-secret"}`))
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*-POST-v1_chat_completions.http"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 dump, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	dump := string(data)
+	if strings.Contains(dump, "sk-secret") {
+		t.Errorf("expected the API key to be redacted:\n%s", dump)
+	}
+	for _, part := range []string{
+		"POST " + server.URL + "/v1/chat/completions",
+		"Authorization: [redacted]",
+		`{"model":"gpt-4o","user":"[redacted]"}`,
+		"HTTP/1.1 200 OK",
+		"Content-Type: text/event-stream",
+		"data: {\"content\":\"Hello\"}\n\ndata: [DONE]\n\n",
+	} {
+		if !strings.Contains(dump, part) {
+			t.Errorf("expected %q in the dump:\n%s", part, dump)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package sidekick
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// maxErrorBody bounds the body of a failed response that is read into its error.
+const maxErrorBody = 64 * 1024
+
+// requestIDHeaders are the headers providers report the ID of a request in.
+var requestIDHeaders = []string{"x-request-id", "request-id", "x-trace-id"}
+
+// NewProviderError creates the error of a failed response. Message and code are read from the error
+// objects the supported providers answer with; a body that is not JSON is used as message.
+func NewProviderError(statusCode int, status string, header http.Header, body []byte) *models.ProviderError {
+	err := &models.ProviderError{StatusCode: statusCode, Status: status}
+	for _, name := range requestIDHeaders {
+		if id := header.Get(name); id != "" {
+			err.RequestID = id
+			break
+		}
+	}
+
+	var object struct {
+		Error     json.RawMessage `json:"error"`
+		ErrorType string          `json:"error_type"` // TGI
+		Message   string          `json:"message"`    // Cohere
+	}
+	if json.Unmarshal(body, &object) != nil {
+		err.Message = string(bytes.TrimSpace(body))
+		return ClassifyProviderError(err)
+	}
+
+	var nested struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	}
+	var text string
+	switch {
+	case json.Unmarshal(object.Error, &text) == nil:
+		err.Message, err.Code = text, object.ErrorType
+	case json.Unmarshal(object.Error, &nested) == nil && nested.Message != "":
+		err.Message, err.Code = nested.Message, ProviderErrorCode(nested.Code, nested.Type)
+	case object.Message != "":
+		err.Message = object.Message
+	default:
+		err.Message = string(bytes.TrimSpace(body))
+	}
+	return ClassifyProviderError(err)
+}
+
+// ProviderErrorCode returns code if it is a string, as OpenAI compatible providers report it, and
+// errorType otherwise, e.g. for the numeric codes of llama.cpp.
+func ProviderErrorCode(code any, errorType string) string {
+	if code, ok := code.(string); ok && code != "" {
+		return code
+	}
+	return errorType
+}
+
+// ClassifyProviderError sets the kind of err from its status code, code and message, and returns err.
+func ClassifyProviderError(err *models.ProviderError) *models.ProviderError {
+	text := strings.ToLower(err.Code + " " + err.Message)
+	contains := func(patterns ...string) bool {
+		for _, pattern := range patterns {
+			if strings.Contains(text, pattern) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case err.StatusCode == http.StatusUnauthorized || err.StatusCode == http.StatusForbidden || contains("invalid_api_key", "authentication_error"):
+		err.Kind = models.ErrUnauthorized
+	case err.StatusCode == http.StatusTooManyRequests || contains("rate_limit", "rate limit"):
+		err.Kind = models.ErrRateLimited
+	case contains("context_length_exceeded", "exceed_context_size", "context length", "context window", "maximum context", "prompt is too long"):
+		err.Kind = models.ErrContextLengthExceeded
+	case contains("content_filter", "content_policy", "content management policy"):
+		err.Kind = models.ErrContentFiltered
+	case err.StatusCode == http.StatusServiceUnavailable || err.StatusCode == 529 || contains("overloaded"):
+		err.Kind = models.ErrServerOverloaded
+	}
+	return err
+}
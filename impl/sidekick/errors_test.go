@@ -0,0 +1,49 @@
+package sidekick_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestNewProviderError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		kind       error
+		code       string
+		message    string
+	}{
+		{"openai rate limit", 429, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, models.ErrRateLimited, "rate_limit_exceeded", "Rate limit reached"},
+		{"openai invalid key", 401, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`, models.ErrUnauthorized, "invalid_api_key", "Incorrect API key provided"},
+		{"openai context length", 400, `{"error":{"message":"This model's maximum context length is 8192 tokens","type":"invalid_request_error","code":"context_length_exceeded"}}`, models.ErrContextLengthExceeded, "context_length_exceeded", "This model's maximum context length is 8192 tokens"},
+		{"azure content filter", 400, `{"error":{"message":"The response was filtered","code":"content_filter"}}`, models.ErrContentFiltered, "content_filter", "The response was filtered"},
+		{"llama.cpp context size", 400, `{"error":{"code":400,"message":"the request exceeds the available context size","type":"exceed_context_size_error"}}`, models.ErrContextLengthExceeded, "exceed_context_size_error", "the request exceeds the available context size"},
+		{"tgi overloaded", 429, `{"error":"Model is overloaded","error_type":"overloaded"}`, models.ErrRateLimited, "overloaded", "Model is overloaded"},
+		{"ollama unavailable", 503, `{"error":"server busy, please try again"}`, models.ErrServerOverloaded, "", "server busy, please try again"},
+		{"cohere invalid request", 400, `{"message":"invalid request: model not found"}`, nil, "", "invalid request: model not found"},
+		{"plain text", 502, "Bad Gateway\n", nil, "", "Bad Gateway"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{"X-Request-Id": {"req_123"}}
+			err := sidekick.NewProviderError(test.statusCode, http.StatusText(test.statusCode), header, []byte(test.body))
+			if err.Kind != test.kind || (test.kind != nil && !errors.Is(err, test.kind)) {
+				t.Errorf("expected kind %v, got %v", test.kind, err.Kind)
+			}
+			if err.Code != test.code || err.Message != test.message || err.RequestID != "req_123" || err.StatusCode != test.statusCode {
+				t.Errorf("unexpected error %+v", err)
+			}
+
+			var providerErr *models.ProviderError
+			if !errors.As(error(err), &providerErr) {
+				t.Error("expected a *models.ProviderError")
+			}
+		})
+	}
+}
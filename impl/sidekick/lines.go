@@ -0,0 +1,56 @@
+package sidekick
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultMaxLineSize bounds the lines of streamed responses, unless HttpConfiguration.MaxLineSize is set.
+const DefaultMaxLineSize = 16 << 20
+
+// ErrLineTooLong is returned when a line of a stream exceeds the maximum line size.
+var ErrLineTooLong = errors.New("line exceeds the maximum line size")
+
+// LineReader reads the lines of newline delimited streams, such as the JSON lines of Ollama. Unlike
+// bufio.Scanner, whose default limit of 64 KB is exceeded by large tool call arguments or non-streamed
+// bodies, lines may grow up to the maximum line size.
+type LineReader struct {
+	reader  *bufio.Reader
+	maxSize int
+}
+
+// NewLineReader returns a reader of the lines of r. A maxLineSize of 0 or less uses DefaultMaxLineSize.
+func NewLineReader(r io.Reader, maxLineSize int) *LineReader {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	return &LineReader{reader: bufio.NewReader(r), maxSize: maxLineSize}
+}
+
+// ReadLine returns the next line without its line ending, which may be LF or CRLF. A last line that is
+// not terminated is still returned; io.EOF follows it. Lines longer than the maximum line size fail with
+// ErrLineTooLong.
+func (lineReader *LineReader) ReadLine() ([]byte, error) {
+	var line []byte
+	for {
+		fragment, err := lineReader.reader.ReadSlice('\n')
+		// fragment is only valid until the next read, append copies it
+		line = append(line, fragment...)
+		if len(bytes.TrimRight(line, "\r\n")) > lineReader.maxSize {
+			return nil, ErrLineTooLong
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == nil:
+			return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+		case errors.Is(err, io.EOF) && len(line) > 0:
+			return bytes.TrimSuffix(line, []byte("\r")), nil
+		default:
+			return nil, err
+		}
+	}
+}
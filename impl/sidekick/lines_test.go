@@ -0,0 +1,43 @@
+package sidekick_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+)
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 100*1024)
+	reader := sidekick.NewLineReader(strings.NewReader("first\r\n"+long+"\n\nlast"), 0)
+
+	var lines []string
+	for {
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines = append(lines, string(line))
+	}
+	if len(lines) != 4 || lines[0] != "first" || lines[1] != long || lines[2] != "" || lines[3] != "last" {
+		t.Errorf("unexpected lines %q", lines)
+	}
+
+	reader = sidekick.NewLineReader(strings.NewReader("short\n"+long+"\n"), 1024)
+	if line, err := reader.ReadLine(); err != nil || string(line) != "short" {
+		t.Errorf("expected the short line, got %q: %v", line, err)
+	}
+	if _, err := reader.ReadLine(); !errors.Is(err, sidekick.ErrLineTooLong) {
+		t.Errorf("expected sidekick.ErrLineTooLong, got %v", err)
+	}
+
+	decoder := sidekick.NewSSEDecoderSize(strings.NewReader("data: "+long+"\n\n"), 1024)
+	if _, err := decoder.Next(); !errors.Is(err, sidekick.ErrLineTooLong) {
+		t.Errorf("expected sidekick.ErrLineTooLong from the decoder, got %v", err)
+	}
+}
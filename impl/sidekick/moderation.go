@@ -0,0 +1,67 @@
+package sidekick
+
+import (
+	"sort"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ViolatedCategories returns the categories of a moderation response that exceed their thresholds.
+// Categories without own threshold use DefaultThreshold; if that is zero, the flags of the provider decide.
+func (utility *SideKick) ViolatedCategories(response models.ModerationResponse, config models.ModerationConfig) []string {
+	names := make(map[string]struct{})
+	for category := range response.Categories {
+		names[category] = struct{}{}
+	}
+	for category := range response.CategoryScores {
+		names[category] = struct{}{}
+	}
+
+	var violated []string
+	for category := range names {
+		threshold, exists := config.Thresholds[category]
+		if !exists {
+			threshold = config.DefaultThreshold
+		}
+
+		if threshold > 0 {
+			if response.CategoryScores[category] >= threshold {
+				violated = append(violated, category)
+			}
+		} else if response.Categories[category] {
+			violated = append(violated, category)
+		}
+	}
+
+	sort.Strings(violated)
+	return violated
+}
+
+// ApplyModeration applies the configured moderation action to a message based on a moderation response.
+// Blocked messages return a *models.ModerationError; redacted and annotated messages carry the verdict.
+func (utility *SideKick) ApplyModeration(message models.Message, response models.ModerationResponse, config models.ModerationConfig) (models.Message, error) {
+	action := config.Action
+	if action == "" {
+		action = models.ModerationBlock
+	}
+
+	violated := utility.ViolatedCategories(response, config)
+	message.Moderation = &models.Moderation{Flagged: len(violated) > 0, Action: action, Categories: violated}
+	if len(violated) == 0 {
+		return message, nil
+	}
+
+	switch action {
+	case models.ModerationRedact:
+		message.Content = config.RedactionText
+		if message.Content == "" {
+			message.Content = models.DefaultRedactionText
+		}
+		message.Images = nil
+	case models.ModerationAnnotate:
+	default:
+		return message, &models.ModerationError{Categories: violated, Response: response}
+	}
+
+	return message, nil
+}
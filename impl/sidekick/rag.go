@@ -0,0 +1,143 @@
+package sidekick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// DefaultRAGLimit is the number of documents retrieved for a RAG request if the query options set no limit.
+const DefaultRAGLimit = 5
+
+// ErrNoVectorDb is returned for RAG requests of companions without a vector database.
+var ErrNoVectorDb = errors.New("no vector database configured")
+
+// EmbedFunc sends an embedding request, usually the SendEmbeddingRequest method of a companion.
+type EmbedFunc func(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error)
+
+// PrepareRAGRequest embeds the content of a message, retrieves the most similar documents of the given
+// schema and returns a request whose message carries their text as context. The query options default to
+// config.RAGQueryOptions. If the query can't be embedded or the vector search finds nothing, for example
+// because the documents have no embeddings, documents are searched by keywords instead. The request retains
+// the original message, so the conversation does not grow by the retrieved context. Without matching
+// documents, the message is sent as is.
+func (utility *SideKick) PrepareRAGRequest(ctx context.Context, vectorDb vectordb.VectorDb, embed EmbedFunc, config models.Configuration, message models.Message, options models.RAGOptions) (models.MessageRequest, error) {
+	if vectorDb == nil {
+		return models.MessageRequest{}, ErrNoVectorDb
+	}
+	if options.ClassName == "" {
+		return models.MessageRequest{}, errors.New("rag request requires a classname")
+	}
+
+	if options.PersonaScoped {
+		options.ClassName = config.ActivePersona.NamespacedClassName(options.ClassName)
+	}
+
+	queryOptions := config.RAGQueryOptions
+	if options.QueryOptions != nil {
+		queryOptions = *options.QueryOptions
+	}
+	if queryOptions.Limit <= 0 {
+		queryOptions.Limit = DefaultRAGLimit
+	}
+
+	documents, err := utility.retrieve(ctx, vectorDb, embed, config.AiModels.EmbeddingModel, options.ClassName, message.Content, queryOptions)
+	if err != nil {
+		return models.MessageRequest{}, err
+	}
+
+	var texts []string
+	for _, document := range documents {
+		if text := vdbutil.DocumentText(document, options.TextKey); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return models.MessageRequest{Message: message}, nil
+	}
+
+	return models.MessageRequest{
+		OriginalMessage:       message,
+		Message:               utility.EnrichMessage(message, config.ActivePersona.Prompt.EnrichmentPrompt, texts),
+		RetainOriginalMessage: true,
+	}, nil
+}
+
+// retrieve searches the documents similar to a query and falls back to keyword search if the query can't
+// be embedded or no documents with embeddings are found.
+func (utility *SideKick) retrieve(ctx context.Context, vectorDb vectordb.VectorDb, embed EmbedFunc, model models.Model, classname, query string, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	response, embedErr := embed(ctx, utility.CreateEmbeddingRequest(model, []string{query}))
+	if embedErr == nil && len(response.Embeddings) != 1 {
+		embedErr = fmt.Errorf("got %d embeddings for the query", len(response.Embeddings))
+	}
+
+	if embedErr == nil {
+		documents, err := vectorDb.QueryDocuments(ctx, classname, response.Embeddings[0], queryOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", classname, err)
+		}
+
+		// documents without embeddings can't be similar, their score is meaningless
+		similar := documents[:0]
+		for _, document := range documents {
+			if len(document.Embeddings) > 0 {
+				similar = append(similar, document)
+			}
+		}
+		if len(similar) > 0 {
+			return similar, nil
+		}
+	}
+
+	documents, err := vdbutil.KeywordSearch(ctx, vectorDb, classname, query, queryOptions)
+	if embedErr != nil && err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to embed query: %w", embedErr), err)
+	}
+	if err != nil {
+		// the vector search succeeded without results
+		return nil, nil
+	}
+	return documents, nil
+}
+
+// EnrichMessage returns a copy of a message whose content is the enrichment prompt, followed by the
+// context texts and the original content as query.
+func (utility *SideKick) EnrichMessage(message models.Message, prompt string, context []string) models.Message {
+	var builder strings.Builder
+	if prompt != "" {
+		builder.WriteString(prompt)
+		builder.WriteString("\n\n")
+	}
+	builder.WriteString("Context:\n")
+	builder.WriteString(strings.Join(context, "\n\n"))
+	builder.WriteString("\n\nQuery:\n")
+	builder.WriteString(message.Content)
+
+	message.Content = builder.String()
+	return message
+}
+
+// PrepareKnowledgeRequest enriches a chat request with the knowledge of the active persona if the persona
+// uses knowledge. Requests that already retain an original message, such as RAG requests, are returned
+// unchanged, as are requests of personas whose knowledge has not been synchronized yet.
+func (utility *SideKick) PrepareKnowledgeRequest(ctx context.Context, vectorDb vectordb.VectorDb, embed EmbedFunc, config models.Configuration, request models.MessageRequest) (models.MessageRequest, error) {
+	if !config.ActivePersona.UseKnowledge || vectorDb == nil || request.RetainOriginalMessage {
+		return request, nil
+	}
+
+	enriched, err := utility.PrepareRAGRequest(ctx, vectorDb, embed, config, request.Message, models.RAGOptions{ClassName: config.ActivePersona.KnowledgeClassName()})
+	if errors.Is(err, vectordb.ErrSchemaNotExists) {
+		return request, nil
+	}
+	if err != nil {
+		return request, err
+	}
+
+	enriched.Tools = request.Tools
+	return enriched, nil
+}
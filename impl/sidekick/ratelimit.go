@@ -0,0 +1,58 @@
+package sidekick
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ParseRateLimit reads the x-ratelimit-* and retry-after headers of a response.
+// It returns nil if the response carries no rate limit headers.
+func (utility *SideKick) ParseRateLimit(header http.Header) *models.RateLimit {
+	var rateLimit models.RateLimit
+	found := false
+
+	integer := func(name string, target *int) {
+		if value, err := strconv.Atoi(strings.TrimSpace(header.Get(name))); err == nil {
+			*target = value
+			found = true
+		}
+	}
+	duration := func(name string, target *time.Duration) {
+		if value, ok := parseResetDuration(header.Get(name)); ok {
+			*target = value
+			found = true
+		}
+	}
+
+	integer("x-ratelimit-limit-requests", &rateLimit.LimitRequests)
+	integer("x-ratelimit-limit-tokens", &rateLimit.LimitTokens)
+	integer("x-ratelimit-remaining-requests", &rateLimit.RemainingRequests)
+	integer("x-ratelimit-remaining-tokens", &rateLimit.RemainingTokens)
+	duration("x-ratelimit-reset-requests", &rateLimit.ResetRequests)
+	duration("x-ratelimit-reset-tokens", &rateLimit.ResetTokens)
+	duration("retry-after", &rateLimit.RetryAfter)
+
+	if !found {
+		return nil
+	}
+	return &rateLimit
+}
+
+// parseResetDuration parses durations like "2m59.56s", "6ms" or plain seconds like "7".
+func parseResetDuration(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration, true
+	}
+	return 0, false
+}
@@ -0,0 +1,94 @@
+package sidekick
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces credentials in audit trails and dumps.
+const redacted = "[redacted]"
+
+// redactedHeaders are the headers carrying credentials.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Api-Key", "Cookie", "Set-Cookie"}
+
+// redactedParameters are the query parameters carrying credentials.
+var redactedParameters = []string{"key", "api_key", "apikey", "access_token", "token"}
+
+// secrets are values replaced wherever they appear, e.g. the API key.
+type secrets []string
+
+// redact replaces the secrets in text.
+func (secrets secrets) redact(text string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	return text
+}
+
+// url returns u with the credentials in its query and user info replaced.
+func (secrets secrets) url(u *url.URL) string {
+	clean := *u
+	if clean.User != nil {
+		clean.User = url.User(redacted)
+	}
+	if clean.RawQuery != "" {
+		query := clean.Query()
+		for name := range query {
+			for _, parameter := range redactedParameters {
+				if strings.EqualFold(name, parameter) {
+					query.Set(name, redacted)
+				}
+			}
+		}
+		clean.RawQuery = query.Encode()
+	}
+	return secrets.redact(clean.String())
+}
+
+// header returns a copy of header with the credentials replaced.
+func (secrets secrets) header(header http.Header) http.Header {
+	clean := make(http.Header, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			clean[name] = append(clean[name], secrets.redact(value))
+		}
+	}
+	for _, name := range redactedHeaders {
+		if _, ok := clean[name]; ok {
+			clean[name] = []string{redacted}
+		}
+	}
+	return clean
+}
+
+// readBody returns the body of a request and the request to send in its place. A body that can only be
+// read once is read and the request is replaced by a copy with the body that was read.
+func readBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer reader.Close()
+		body, err := io.ReadAll(reader)
+		return body, req, err
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	sent := req.Clone(req.Context())
+	sent.Body = io.NopCloser(bytes.NewReader(body))
+	sent.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, sent, nil
+}
@@ -0,0 +1,129 @@
+package sidekick
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// RetryTransport retries the requests of a provider that fail transiently, as configured by
+// models.RetryConfiguration. Responses that are retried are drained and closed; the last response or
+// error is returned. Requests whose body cannot be read again, because http.Request.GetBody is not set,
+// are sent once.
+type RetryTransport struct {
+	Base     http.RoundTripper // Transport sending the attempts, defaults to http.DefaultTransport
+	Config   models.RetryConfiguration
+	Terminal models.Terminal // Retries are logged in debug mode
+}
+
+// NewRetryClient returns a client with the timeout of config whose requests are retried as configured.
+// Without retries, it returns a plain client.
+func NewRetryClient(config models.HttpConfiguration, terminal models.Terminal) *http.Client {
+	client := &http.Client{Timeout: time.Second * time.Duration(config.HTTPClientTimeout)}
+	if config.Retry.MaxAttempts > 1 {
+		client.Transport = &RetryTransport{Config: config.Retry, Terminal: terminal}
+	}
+	return client
+}
+
+// RoundTrip implements http.RoundTripper.
+func (transport *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	attempts := transport.Config.MaxAttempts
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		attempts = 1
+	}
+
+	utility := &SideKick{}
+	for attempt := 1; ; attempt++ {
+		// the request must not be modified, further attempts send a copy with a fresh body
+		send := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			send = req.Clone(req.Context())
+			send.Body = body
+		}
+
+		resp, err := base.RoundTrip(send)
+		if attempt >= attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+		wait, retry := transport.wait(attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+
+		reason := fmt.Sprint(err)
+		if err == nil {
+			reason = resp.Status
+			// the connection can be reused once the body is read
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		utility.Debug(fmt.Sprintf("RetryTransport: retrying %s in %s after: %s", req.URL.Path, wait, reason), transport.Terminal)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// wait reports whether the outcome of an attempt is retried and how long to wait before.
+func (transport *RetryTransport) wait(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return transport.jitter(attempt), true
+		}
+		return 0, false
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+	default:
+		return 0, false
+	}
+
+	if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+		// waiting longer than configured would stall the turn, the caller gets the response instead
+		if after > transport.Config.Limit() {
+			return 0, false
+		}
+		return after, true
+	}
+	return transport.jitter(attempt), true
+}
+
+// jitter returns a random wait between half and the full delay of the retry following attempt.
+func (transport *RetryTransport) jitter(attempt int) time.Duration {
+	delay := transport.Config.Delay(attempt)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if duration, ok := parseResetDuration(value); ok {
+		return max(duration, 0), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
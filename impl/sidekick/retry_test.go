@@ -0,0 +1,76 @@
+package sidekick_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var attempts int
+	var bodies []string
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		status := statuses[attempts]
+		attempts++
+		switch status {
+		case http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", "0")
+		case http.StatusServiceUnavailable:
+			w.Header().Set("Retry-After", "120")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := models.HttpConfiguration{HTTPClientTimeout: 10, Retry: models.RetryConfiguration{MaxAttempts: 3, Backoff: 1, MaxBackoff: 10}}
+	client := sidekick.NewRetryClient(config, models.Terminal{})
+	post := func() *http.Response {
+		resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"model":"llama"}`))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("Test transient failures", func(t *testing.T) {
+		attempts, bodies, statuses = 0, nil, []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}
+		if resp := post(); resp.StatusCode != http.StatusOK || attempts != 3 {
+			t.Errorf("expected success after 3 attempts, got %d after %d", resp.StatusCode, attempts)
+		}
+		for _, body := range bodies {
+			if body != `{"model":"llama"}` {
+				t.Errorf("expected the body with every attempt, got %q", body)
+			}
+		}
+	})
+
+	t.Run("Test exhausted attempts", func(t *testing.T) {
+		attempts, statuses = 0, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}
+		if resp := post(); resp.StatusCode != http.StatusInternalServerError || attempts != 3 {
+			t.Errorf("expected the last failure after 3 attempts, got %d after %d", resp.StatusCode, attempts)
+		}
+	})
+
+	t.Run("Test permanent failures", func(t *testing.T) {
+		attempts, statuses = 0, []int{http.StatusBadRequest, http.StatusOK}
+		if resp := post(); resp.StatusCode != http.StatusBadRequest || attempts != 1 {
+			t.Errorf("expected no retry of status 400, got %d after %d attempts", resp.StatusCode, attempts)
+		}
+	})
+
+	t.Run("Test Retry-After beyond the maximum backoff", func(t *testing.T) {
+		attempts, statuses = 0, []int{http.StatusServiceUnavailable, http.StatusOK}
+		if resp := post(); resp.StatusCode != http.StatusServiceUnavailable || attempts != 1 {
+			t.Errorf("expected no retry, got %d after %d attempts", resp.StatusCode, attempts)
+		}
+	})
+}
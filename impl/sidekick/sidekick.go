@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
@@ -14,11 +16,12 @@ import (
 	"net/http"
 	"os"
 
-	_ "image/gif" // Support for GIF decoding
-
 	"github.com/ghmer/aicompanion/models"
 	"github.com/ghmer/aicompanion/terminal"
 	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+
+	_ "golang.org/x/image/webp" // Support for WebP decoding
 )
 
 // Resolution represents different image resolutions.
@@ -35,7 +38,10 @@ const (
 	Res240p   Resolution = 320
 	Res144p   Resolution = 256
 	Pixel1024 Resolution = 1024
+	Pixel768  Resolution = 768
 	Pixel512  Resolution = 512
+	Pixel336  Resolution = 336
+	Pixel224  Resolution = 224
 )
 
 type SideKick struct {
@@ -77,6 +83,10 @@ func (utility *SideKick) ResizeImage(imageBytes []byte, maxSize int) ([]byte, er
 
 // DecodeImage decodes image bytes into an image.Image and detects the format.
 func (utility *SideKick) DecodeImage(imageBytes []byte) (image.Image, string, error) {
+	if models.DetectMimeType(imageBytes) == "image/avif" {
+		return nil, "", errors.New("failed to decode image: unsupported image format: avif")
+	}
+
 	img, format, err := image.Decode(bytes.NewReader(imageBytes))
 	if err != nil {
 		return nil, "", errors.New("failed to decode image: " + err.Error())
@@ -109,7 +119,77 @@ func (utility *SideKick) Resize(img image.Image, newWidth, newHeight int) image.
 	return dst
 }
 
-// EncodeImage encodes an image into a specific format (JPEG, PNG, etc.).
+// CenterCropImage scales an image so that it covers the target dimensions and crops the overflow
+// around the center. The result is encoded back to the original format.
+func (utility *SideKick) CenterCropImage(imageBytes []byte, width, height int) ([]byte, error) {
+	if len(imageBytes) == 0 {
+		return nil, errors.New("input image data is empty")
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("width and height must be greater than zero")
+	}
+
+	img, format, err := utility.DecodeImage(imageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return utility.EncodeImage(utility.CenterCrop(img, width, height), format)
+}
+
+// PadImage scales an image to fit into the target dimensions and letterboxes the remaining space
+// with the given background color. The result is encoded back to the original format.
+func (utility *SideKick) PadImage(imageBytes []byte, width, height int, background color.Color) ([]byte, error) {
+	if len(imageBytes) == 0 {
+		return nil, errors.New("input image data is empty")
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("width and height must be greater than zero")
+	}
+
+	img, format, err := utility.DecodeImage(imageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return utility.EncodeImage(utility.Letterbox(img, width, height, background), format)
+}
+
+// CenterCrop scales an image to cover width x height and crops it around the center.
+func (utility *SideKick) CenterCrop(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	scale := max(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+
+	// the source region that maps onto the target after scaling
+	srcWidth := int(float64(width) / scale)
+	srcHeight := int(float64(height) / scale)
+	offsetX := bounds.Min.X + (bounds.Dx()-srcWidth)/2
+	offsetY := bounds.Min.Y + (bounds.Dy()-srcHeight)/2
+	src := image.Rect(offsetX, offsetY, offsetX+srcWidth, offsetY+srcHeight)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Rect, img, src, draw.Over, nil)
+	return dst
+}
+
+// Letterbox scales an image to fit into width x height and centers it on a background of the given color.
+func (utility *SideKick) Letterbox(img image.Image, width, height int, background color.Color) image.Image {
+	bounds := img.Bounds()
+	scale := min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+
+	newWidth := max(int(float64(bounds.Dx())*scale), 1)
+	newHeight := max(int(float64(bounds.Dy())*scale), 1)
+	offsetX := (width - newWidth) / 2
+	offsetY := (height - newHeight) / 2
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, image.Rect(offsetX, offsetY, offsetX+newWidth, offsetY+newHeight), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// EncodeImage encodes an image into a specific format (JPEG, PNG, GIF, TIFF).
+// WebP images are encoded as PNG, as there is no WebP encoder available.
 func (utility *SideKick) EncodeImage(img image.Image, format string) ([]byte, error) {
 	var buf bytes.Buffer
 	var err error
@@ -117,8 +197,12 @@ func (utility *SideKick) EncodeImage(img image.Image, format string) ([]byte, er
 	switch format {
 	case "jpeg":
 		err = jpeg.Encode(&buf, img, nil)
-	case "png":
+	case "png", "webp":
 		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case "tiff":
+		err = tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate})
 	default:
 		err = errors.New("unsupported image format: " + format)
 	}
@@ -184,6 +268,11 @@ func (utility *SideKick) CreateModerationRequest(input string) models.Moderation
 }
 
 func (utility *SideKick) RunFunction(httpClient *http.Client, tool models.Tool, payload models.FunctionPayload, debug, trace bool) (models.FunctionResponse, error) {
+	return utility.runFunction(context.Background(), httpClient, tool, payload, debug, trace)
+}
+
+// runFunction sends the payload to the endpoint of the tool within ctx.
+func (utility *SideKick) runFunction(ctx context.Context, httpClient *http.Client, tool models.Tool, payload models.FunctionPayload, debug, trace bool) (models.FunctionResponse, error) {
 	result := models.FunctionResponse{}
 
 	payloadBytes, err := json.Marshal(payload.Arguments)
@@ -193,7 +282,7 @@ func (utility *SideKick) RunFunction(httpClient *http.Client, tool models.Tool,
 	}
 
 	// Create and configure the HTTP request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", tool.Endpoint, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", tool.Endpoint, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		log.Println(err)
 		return result, err
@@ -205,12 +294,15 @@ func (utility *SideKick) RunFunction(httpClient *http.Client, tool models.Tool,
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		log.Println(err)
-		return result, err
+		return result, fmt.Errorf("%w: %w", ErrToolUnavailable, err)
 	}
 	defer resp.Body.Close()
 	if debug {
 		log.Printf("RunFunction: StatusCode %d, Status %s\n", resp.StatusCode, resp.Status)
 	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return result, fmt.Errorf("%w: endpoint answered with status %s", ErrToolUnavailable, resp.Status)
+	}
 	if trace {
 		log.Printf("RunFunction: payload %s\n", string(payloadBytes))
 	}
@@ -270,10 +362,18 @@ func (utility *SideKick) Trace(payload string, termconfig models.Terminal) {
 	}
 }
 
-// PrepareArray prepares an array of messages based on the includeStrategy.
+// PrepareArray prepares an array of messages based on the includeStrategy. Pinned messages are always
+// included; they count towards maxMessages, but are never dropped for it.
 func (utility *SideKick) PrepareArray(messages []models.Message, includeStrategy models.IncludeStrategy, maxMessages int) []models.Message {
 	var newarray []models.Message
+	var pinned int
 	for _, msg := range messages {
+		if msg.Pinned {
+			newarray = append(newarray, msg)
+			pinned++
+			continue
+		}
+
 		switch includeStrategy {
 		case models.IncludeAssistant:
 			{
@@ -299,15 +399,72 @@ func (utility *SideKick) PrepareArray(messages []models.Message, includeStrategy
 	}
 
 	if len(newarray) > maxMessages {
-		newarray = newarray[len(newarray)-maxMessages:]
+		if pinned == 0 {
+			return newarray[len(newarray)-maxMessages:]
+		}
+		kept := pinned
+		newarray = keepPinned(newarray, func(models.Message) bool {
+			kept++
+			return kept <= maxMessages
+		})
 	}
 
 	return newarray
 }
 
+// keepPinned keeps the pinned messages and, walking from the most recent message backwards, the other
+// messages until keep rejects one. The order of the messages is preserved.
+func keepPinned(messages []models.Message, keep func(msg models.Message) bool) []models.Message {
+	kept := make([]bool, len(messages))
+	var count int
+	keeping := true
+	for i := len(messages) - 1; i >= 0; i-- {
+		if !messages[i].Pinned {
+			keeping = keeping && keep(messages[i])
+			if !keeping {
+				continue
+			}
+		}
+		kept[i] = true
+		count++
+	}
+
+	result := make([]models.Message, 0, count)
+	for i, msg := range messages {
+		if kept[i] {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// PinMessage pins or unpins the message at index of the conversation. Pinned messages are always sent
+// along with requests, regardless of the maximum number of messages and token budgets.
+func (utility *SideKick) PinMessage(conversation []models.Message, index int, pinned bool) error {
+	if index < 0 || index >= len(conversation) {
+		return fmt.Errorf("message index %d out of range [0, %d)", index, len(conversation))
+	}
+	conversation[index].Pinned = pinned
+	return nil
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (utility *SideKick) PinMessageByID(conversation []models.Message, id string, pinned bool) error {
+	for i := range conversation {
+		if id != "" && conversation[i].ID == id {
+			conversation[i].Pinned = pinned
+			return nil
+		}
+	}
+	return fmt.Errorf("no message with ID %q", id)
+}
+
+// VerifyStatus returns a *models.ProviderError, classified by NewProviderError, if the status code of the
+// response signals a failure. The body of failed responses is read.
 func (utility *SideKick) VerifyStatus(resp *http.Response) error {
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return NewProviderError(resp.StatusCode, resp.Status, resp.Header, body)
 	}
 
 	return nil
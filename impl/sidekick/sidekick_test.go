@@ -2,13 +2,20 @@ package sidekick_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/ghmer/aicompanion/impl/sidekick"
 	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+	"golang.org/x/image/tiff"
 )
 
 // createTestImage generates a simple test image with specified dimensions and color.
@@ -172,3 +179,161 @@ func TestResizeImage_PredefinedResolutions(t *testing.T) {
 		}
 	}
 }
+
+// TestResizeImage_TIFF tests that TIFF images can be decoded, resized and re-encoded.
+func TestResizeImage_TIFF(t *testing.T) {
+	util := sidekick_interface.NewSideKick()
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	resizedImage, err := util.ResizeImage(buf.Bytes(), 320)
+	if err != nil {
+		t.Fatalf("failed to resize image: %v", err)
+	}
+
+	_, format, err := util.DecodeImage(resizedImage)
+	if err != nil {
+		t.Fatalf("failed to decode resized image: %v", err)
+	}
+
+	if format != "tiff" {
+		t.Errorf("expected format tiff, got %s", format)
+	}
+}
+
+// TestCenterCropAndPadImage tests that both square preprocessing helpers produce the requested dimensions.
+func TestCenterCropAndPadImage(t *testing.T) {
+	util := sidekick_interface.NewSideKick()
+	testImage, err := createTestImage(1280, 720, color.RGBA{0, 0, 255, 255})
+	if err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	cropped, err := util.CenterCropImage(testImage, int(sidekick.Pixel512), int(sidekick.Pixel512))
+	if err != nil {
+		t.Fatalf("failed to crop image: %v", err)
+	}
+
+	padded, err := util.PadImage(testImage, int(sidekick.Pixel768), int(sidekick.Pixel768), color.Black)
+	if err != nil {
+		t.Fatalf("failed to pad image: %v", err)
+	}
+
+	for expected, imageBytes := range map[int][]byte{512: cropped, 768: padded} {
+		img, _, err := image.Decode(bytes.NewReader(imageBytes))
+		if err != nil {
+			t.Fatalf("failed to decode image: %v", err)
+		}
+
+		if img.Bounds().Dx() != expected || img.Bounds().Dy() != expected {
+			t.Errorf("expected %dx%d, got %dx%d", expected, expected, img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	}
+}
+
+// TestTranscribeChunks tests that overlapping chunk transcripts are stitched without duplicated words.
+func TestTranscribeChunks(t *testing.T) {
+	util := sidekick_interface.NewSideKick()
+	texts := []string{"the quick brown fox jumps", "Fox jumps over the lazy", "the lazy dog."}
+	chunks := []models.AudioChunk{
+		{Index: 0, Start: 0, Duration: 10 * time.Second},
+		{Index: 1, Start: 8 * time.Second, Duration: 10 * time.Second},
+		{Index: 2, Start: 16 * time.Second, Duration: 4 * time.Second},
+	}
+
+	transcript, err := util.TranscribeChunks(context.Background(), chunks, sidekick.AudioChunkOptions{Concurrency: 2}, func(ctx context.Context, chunk models.AudioChunk) (models.Transcript, error) {
+		return models.Transcript{Text: texts[chunk.Index]}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to transcribe chunks: %v", err)
+	}
+
+	expected := "the quick brown fox jumps over the lazy dog."
+	if transcript.Text != expected {
+		t.Errorf("expected transcript %q, got %q", expected, transcript.Text)
+	}
+
+	if len(transcript.Segments) != 3 || transcript.Segments[2].End != 20*time.Second {
+		t.Errorf("unexpected segments: %v", transcript.Segments)
+	}
+
+	t.Run("Test segments", func(t *testing.T) {
+		segments := [][]models.TranscriptSegment{
+			{{Start: 0, End: 4 * time.Second, Text: "the quick brown"}, {Start: 4 * time.Second, End: 9 * time.Second, Text: "fox jumps"}},
+			{{Start: 8 * time.Second, End: 12 * time.Second, Text: "Fox jumps over"}, {Start: 12 * time.Second, End: 17 * time.Second, Text: "the lazy"}},
+			{{Start: 16 * time.Second, End: 17 * time.Second, Text: "the lazy"}, {Start: 17 * time.Second, End: 19 * time.Second, Text: "dog."}},
+		}
+		transcript, err := util.TranscribeChunks(context.Background(), chunks, sidekick.AudioChunkOptions{}, func(ctx context.Context, chunk models.AudioChunk) (models.Transcript, error) {
+			return models.Transcript{Segments: segments[chunk.Index]}, nil
+		})
+		if err != nil {
+			t.Fatalf("failed to transcribe chunks: %v", err)
+		}
+		if transcript.Text != expected {
+			t.Errorf("expected transcript %q, got %q", expected, transcript.Text)
+		}
+
+		var texts []string
+		for _, segment := range transcript.Segments {
+			texts = append(texts, fmt.Sprintf("%s-%s %s", segment.Start, segment.End, segment.Text))
+		}
+		if want := []string{"0s-4s the quick brown", "4s-9s fox jumps", "9s-12s over", "12s-17s the lazy", "17s-19s dog."}; !slices.Equal(texts, want) {
+			t.Errorf("expected segments %q, got %q", want, texts)
+		}
+	})
+
+	t.Run("Test cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := util.TranscribeChunks(ctx, chunks, sidekick.AudioChunkOptions{}, func(ctx context.Context, chunk models.AudioChunk) (models.Transcript, error) {
+			return models.Transcript{}, nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the cancellation, got %v", err)
+		}
+	})
+}
+
+func TestApplyModeration(t *testing.T) {
+	sk := &sidekick.SideKick{}
+	response := models.ModerationResponse{
+		Flagged:        true,
+		Categories:     map[string]bool{models.ModerationHate: true, models.ModerationViolence: false},
+		CategoryScores: map[string]float64{models.ModerationHate: 0.6, models.ModerationViolence: 0.4},
+	}
+	message := models.Message{Role: models.User, Content: "some input"}
+
+	t.Run("Test block uses provider flags", func(t *testing.T) {
+		_, err := sk.ApplyModeration(message, response, models.ModerationConfig{Enabled: true})
+		moderationErr, ok := err.(*models.ModerationError)
+		if !ok || len(moderationErr.Categories) != 1 || moderationErr.Categories[0] != models.ModerationHate {
+			t.Errorf("expected moderation error for hate, got %v", err)
+		}
+	})
+
+	t.Run("Test thresholds", func(t *testing.T) {
+		config := models.ModerationConfig{Thresholds: map[string]float64{models.ModerationHate: 0.9}, DefaultThreshold: 0.3}
+		violated := sk.ViolatedCategories(response, config)
+		if len(violated) != 1 || violated[0] != models.ModerationViolence {
+			t.Errorf("expected only violence to be violated, got %v", violated)
+		}
+	})
+
+	t.Run("Test redact", func(t *testing.T) {
+		result, err := sk.ApplyModeration(message, response, models.ModerationConfig{Action: models.ModerationRedact})
+		if err != nil || result.Content != models.DefaultRedactionText || !result.Moderation.Flagged {
+			t.Errorf("expected redacted message, got %v (%v)", result, err)
+		}
+	})
+
+	t.Run("Test annotate", func(t *testing.T) {
+		result, err := sk.ApplyModeration(message, response, models.ModerationConfig{Action: models.ModerationAnnotate})
+		if err != nil || result.Content != message.Content || result.Moderation == nil || !result.Moderation.Flagged {
+			t.Errorf("expected annotated message, got %v (%v)", result, err)
+		}
+	})
+}
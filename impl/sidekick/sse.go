@@ -0,0 +1,150 @@
+package sidekick
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SSEDone is the data of the last event of OpenAI compatible streams.
+const SSEDone = "[DONE]"
+
+// SSEEvent is an event of a server-sent events stream.
+type SSEEvent struct {
+	Event string // Type of the event, "message" unless set by the stream
+	Data  string // Data lines of the event, joined by newlines
+	ID    string // Last event ID of the stream
+	Retry int    // Reconnection time in milliseconds, 0 if not sent
+}
+
+// SSEDecoder reads the events of a server-sent events stream, as specified by the HTML standard: fields
+// of an event may span several lines, data lines are joined, comments (lines starting with a colon) are
+// ignored and a blank line ends an event.
+type SSEDecoder struct {
+	reader  *bufio.Reader
+	maxSize int
+	id      string
+	first   bool
+}
+
+// NewSSEDecoder returns a decoder reading events from r, with lines of up to DefaultMaxLineSize.
+func NewSSEDecoder(r io.Reader) *SSEDecoder {
+	return NewSSEDecoderSize(r, DefaultMaxLineSize)
+}
+
+// NewSSEDecoderSize returns a decoder reading events from r, whose lines fail with ErrLineTooLong if they
+// exceed maxLineSize. A maxLineSize of 0 or less uses DefaultMaxLineSize.
+func NewSSEDecoderSize(r io.Reader, maxLineSize int) *SSEDecoder {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	return &SSEDecoder{reader: bufio.NewReader(r), maxSize: maxLineSize, first: true}
+}
+
+// Next returns the next event carrying data. Events without data, such as keep-alive comments, are
+// skipped. It returns io.EOF at the end of the stream and at an event whose data is SSEDone. An event not
+// terminated by a blank line at the end of the stream is still returned.
+func (decoder *SSEDecoder) Next() (SSEEvent, error) {
+	var event SSEEvent
+	var data []string
+
+	for {
+		line, err := decoder.readLine()
+		if err != nil && line == "" {
+			if errors.Is(err, io.EOF) && data != nil {
+				return decoder.dispatch(event, data)
+			}
+			return SSEEvent{}, err
+		}
+
+		switch {
+		case line == "":
+			if data != nil {
+				return decoder.dispatch(event, data)
+			}
+			// events without data are not dispatched
+			event = SSEEvent{}
+		case strings.HasPrefix(line, ":"):
+			// comment, e.g. sent as keep-alive
+		default:
+			decoder.field(&event, &data, line)
+		}
+
+		// the last line of the stream was not terminated
+		if err != nil {
+			if errors.Is(err, io.EOF) && data != nil {
+				return decoder.dispatch(event, data)
+			}
+			return SSEEvent{}, err
+		}
+	}
+}
+
+// field applies a field line to the event.
+func (decoder *SSEDecoder) field(event *SSEEvent, data *[]string, line string) {
+	name, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+	switch name {
+	case "event":
+		event.Event = value
+	case "data":
+		*data = append(*data, value)
+	case "id":
+		// ids containing NUL are ignored
+		if !strings.ContainsRune(value, 0) {
+			decoder.id = value
+		}
+	case "retry":
+		if retry, err := strconv.Atoi(value); err == nil {
+			event.Retry = retry
+		}
+	}
+}
+
+// dispatch completes an event.
+func (decoder *SSEDecoder) dispatch(event SSEEvent, data []string) (SSEEvent, error) {
+	event.Data = strings.Join(data, "\n")
+	if event.Data == SSEDone {
+		return SSEEvent{}, io.EOF
+	}
+	event.ID = decoder.id
+	if event.Event == "" {
+		event.Event = "message"
+	}
+	return event, nil
+}
+
+// readLine returns the next line without its line ending, which may be CRLF, LF or CR.
+func (decoder *SSEDecoder) readLine() (string, error) {
+	var builder strings.Builder
+	for {
+		b, err := decoder.reader.ReadByte()
+		if err != nil {
+			return decoder.trimBOM(builder.String()), err
+		}
+		switch b {
+		case '\n':
+			return decoder.trimBOM(builder.String()), nil
+		case '\r':
+			if next, err := decoder.reader.Peek(1); err == nil && next[0] == '\n' {
+				decoder.reader.ReadByte()
+			}
+			return decoder.trimBOM(builder.String()), nil
+		}
+		if builder.Len() >= decoder.maxSize {
+			return "", ErrLineTooLong
+		}
+		builder.WriteByte(b)
+	}
+}
+
+// trimBOM removes the byte order mark the stream may start with.
+func (decoder *SSEDecoder) trimBOM(line string) string {
+	if decoder.first {
+		decoder.first = false
+		return strings.TrimPrefix(line, "\uFEFF")
+	}
+	return line
+}
@@ -0,0 +1,58 @@
+package sidekick_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+)
+
+func TestSSEDecoder(t *testing.T) {
+	stream := "\uFEFF: keep-alive\r\n" +
+		"data: {\"a\":\r\n" +
+		"data: 1}\r\n" +
+		"\r\n" +
+		"event: ping\n" +
+		"\n" +
+		"event: error\n" +
+		"id: 7\n" +
+		"retry: 3000\n" +
+		"data:no space\n" +
+		"\n" +
+		"data: next\rdata:  indented\r\r" +
+		"data: [DONE]\n\n" +
+		"data: after done\n\n"
+
+	decoder := sidekick.NewSSEDecoder(strings.NewReader(stream))
+	var events []sidekick.SSEEvent
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	expected := []sidekick.SSEEvent{
+		{Event: "message", Data: "{\"a\":\n1}"},
+		{Event: "error", Data: "no space", ID: "7", Retry: 3000},
+		{Event: "message", Data: "next\n indented", ID: "7"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %+v, got %+v", expected, events)
+	}
+
+	// a last event without blank line is still returned
+	decoder = sidekick.NewSSEDecoder(strings.NewReader("data: last"))
+	if event, err := decoder.Next(); err != nil || event.Data != "last" {
+		t.Errorf("expected the unterminated event, got %+v: %v", event, err)
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
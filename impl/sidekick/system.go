@@ -0,0 +1,32 @@
+package sidekick
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrUnknownPersona is returned when a request names a persona the configuration does not define.
+var ErrUnknownPersona = errors.New("unknown persona")
+
+// SystemRole returns the system message of a request: its system prompt if set, else the system prompt of
+// its persona, else fallback, usually the system role of the companion. Neither the configuration nor the
+// companion are changed, so the override applies to this request only.
+func SystemRole(config models.Configuration, request models.MessageRequest, fallback models.Message) (models.Message, error) {
+	if request.SystemPrompt != "" {
+		return models.Message{Role: models.System, Content: request.SystemPrompt}, nil
+	}
+	if request.Persona == "" {
+		return fallback, nil
+	}
+	if request.Persona == config.ActivePersona.Name {
+		return models.Message{Role: models.System, Content: config.ActivePersona.Prompt.SystemPrompt}, nil
+	}
+	for _, persona := range config.Personas {
+		if persona.Name == request.Persona {
+			return models.Message{Role: models.System, Content: persona.Prompt.SystemPrompt}, nil
+		}
+	}
+	return fallback, fmt.Errorf("%w: %s", ErrUnknownPersona, request.Persona)
+}
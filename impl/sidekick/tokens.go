@@ -0,0 +1,79 @@
+package sidekick
+
+import (
+	"encoding/json"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// MessageTokenOverhead is the number of tokens counted per message for its role and delimiters.
+const MessageTokenOverhead = 4
+
+// Tokenizer counts the tokens of text for token budgets such as Configuration.MaxContextTokens. It
+// defaults to EstimateTokens; set it to the tokenizer of the model where exact counts matter.
+var Tokenizer func(text string) int = EstimateTokens
+
+// tokenPattern matches words and single punctuation characters.
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}_]+|[^\p{L}\p{N}_\s]`)
+
+// EstimateTokens approximates the number of tokens of text as counted by common subword tokenizers:
+// every punctuation character is a token, words count one token per four characters.
+func EstimateTokens(text string) int {
+	var tokens int
+	for _, match := range tokenPattern.FindAllString(text, -1) {
+		tokens += (utf8.RuneCountInString(match) + 3) / 4
+	}
+	return tokens
+}
+
+// CountTokens counts the tokens of messages with Tokenizer: their content, tool calls and the per
+// message overhead. Images are not counted.
+func (utility *SideKick) CountTokens(messages ...models.Message) int {
+	var tokens int
+	for _, message := range messages {
+		tokens += MessageTokenOverhead + Tokenizer(message.Content)
+		if len(message.ToolCalls) > 0 {
+			if calls, err := json.Marshal(message.ToolCalls); err == nil {
+				tokens += Tokenizer(string(calls))
+			}
+		}
+	}
+	return tokens
+}
+
+// TrimTokens drops the oldest messages until the messages and the reserved messages, such as the system
+// role and the new message of a request, fit into maxTokens. Pinned messages are never dropped; they are
+// counted like reserved messages. If maxTokens is not positive, messages are returned unchanged.
+func (utility *SideKick) TrimTokens(messages []models.Message, maxTokens int, reserved ...models.Message) []models.Message {
+	if maxTokens <= 0 {
+		return messages
+	}
+
+	budget := maxTokens - utility.CountTokens(reserved...)
+	var pinned bool
+	for _, message := range messages {
+		if message.Pinned {
+			budget -= utility.CountTokens(message)
+			pinned = true
+		}
+	}
+	fits := func(message models.Message) bool {
+		tokens := utility.CountTokens(message)
+		if tokens > budget {
+			return false
+		}
+		budget -= tokens
+		return true
+	}
+	if pinned {
+		return keepPinned(messages, fits)
+	}
+
+	start := len(messages)
+	for start > 0 && fits(messages[start-1]) {
+		start--
+	}
+	return messages[start:]
+}
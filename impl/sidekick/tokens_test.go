@@ -0,0 +1,80 @@
+package sidekick_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	if tokens := sidekick.EstimateTokens("Hello, tokenization!"); tokens != 7 {
+		t.Errorf("expected 7 tokens, got %d", tokens)
+	}
+}
+
+func TestTrimTokens(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	long := models.Message{Role: models.User, Content: strings.Repeat("word ", 100)}
+	short := models.Message{Role: models.Assistant, Content: "ok"}
+	history := []models.Message{long, short, short}
+	system := models.Message{Role: models.System, Content: "be brief"}
+
+	if trimmed := utility.TrimTokens(history, 0, system); len(trimmed) != 3 {
+		t.Errorf("expected no trimming without budget, got %d messages", len(trimmed))
+	}
+
+	// the reserved system role and both short messages fit, the long message does not
+	budget := utility.CountTokens(system, short, short) + 10
+	trimmed := utility.TrimTokens(history, budget, system)
+	if len(trimmed) != 2 || trimmed[0].Content != "ok" {
+		t.Errorf("expected the two recent messages, got %+v", trimmed)
+	}
+
+	if trimmed := utility.TrimTokens(history, utility.CountTokens(system), system); len(trimmed) != 0 {
+		t.Errorf("expected all messages to be dropped, got %+v", trimmed)
+	}
+}
+
+func TestPinnedMessages(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	history := testHistory(6)
+	if err := utility.PinMessageByID(history, "0", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := utility.PinMessage(history, 6, true); err == nil {
+		t.Error("expected an error for an index out of range")
+	}
+	if err := utility.PinMessageByID(history, "missing", true); err == nil {
+		t.Error("expected an error for an unknown ID")
+	}
+
+	// the pinned message takes one of the three slots and survives the filter of the include strategy
+	prepared := utility.PrepareArray(history, models.IncludeAssistant, 3)
+	if len(prepared) != 3 || prepared[0].ID != "0" || prepared[1].ID != "3" || prepared[2].ID != "5" {
+		t.Errorf("unexpected messages %+v", prepared)
+	}
+	if prepared := utility.PrepareArray(history, models.IncludeBoth, 0); len(prepared) != 1 || prepared[0].ID != "0" {
+		t.Errorf("expected only the pinned message, got %+v", prepared)
+	}
+
+	// the pinned message is kept even though it does not fit the budget
+	trimmed := utility.TrimTokens(history, utility.CountTokens(history[5]))
+	if len(trimmed) != 1 || trimmed[0].ID != "0" {
+		t.Errorf("expected only the pinned message, got %+v", trimmed)
+	}
+	trimmed = utility.TrimTokens(history, utility.CountTokens(history[0], history[4], history[5]))
+	if len(trimmed) != 3 || trimmed[0].ID != "0" || trimmed[1].ID != "4" {
+		t.Errorf("unexpected messages %+v", trimmed)
+	}
+
+	selected := sidekick.ImportanceWeighted{}.SelectContext(sidekick.ContextRequest{Conversation: history, IncludeStrategy: models.IncludeBoth, MaxMessages: 2})
+	if len(selected) != 2 || selected[0].ID != "0" || selected[1].ID != "4" {
+		t.Errorf("unexpected selection %+v", selected)
+	}
+
+	if err := utility.PinMessage(history, 0, false); err != nil || history[0].Pinned {
+		t.Errorf("expected the message to be unpinned: %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+package sidekick
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+// MaxToolRounds limits the requests of a tool-calling loop, so a model that keeps calling tools cannot
+// keep the loop running forever.
+const MaxToolRounds = 10
+
+// ErrToolRoundsExceeded is returned if the model still calls tools after MaxToolRounds requests.
+var ErrToolRoundsExceeded = errors.New("model did not answer within the maximum number of tool rounds")
+
+// ErrToolDenied is returned for tool calls denied by the OnToolCall hook.
+var ErrToolDenied = errors.New("tool call denied")
+
+// ErrToolUnavailable marks failed tool calls that may succeed when retried: the call timed out, failed on
+// the network or the endpoint answered with status 429 or 5xx.
+var ErrToolUnavailable = errors.New("tool unavailable")
+
+// ToolRunner runs the tool calls of a response and returns their results as ToolRole messages, in the
+// order of the calls. It returns false if the calls cannot be run, e.g. because a tool is unknown.
+type ToolRunner func(calls []models.ToolCall) ([]models.Message, bool)
+
+// ToolDefinitions returns the function definitions offered to the model: those of the request followed
+// by those of the tools. Functions are offered once by name.
+func (utility *SideKick) ToolDefinitions(functions []models.Function, tools []models.Tool) []models.Function {
+	var definitions []models.Function
+	seen := make(map[string]bool)
+	add := func(function models.Function) {
+		if seen[function.Function.FunctionName] {
+			return
+		}
+		seen[function.Function.FunctionName] = true
+		if function.Type == "" {
+			function.Type = models.TypeFunction
+		}
+		definitions = append(definitions, function)
+	}
+
+	for _, function := range functions {
+		add(function)
+	}
+	for _, tool := range tools {
+		add(tool.Function)
+	}
+	return definitions
+}
+
+// FindTool returns the tool implementing the named function.
+func (utility *SideKick) FindTool(tools []models.Tool, name string) (models.Tool, bool) {
+	for _, tool := range tools {
+		if tool.Function.Function.FunctionName == name {
+			return tool, true
+		}
+	}
+	return models.Tool{}, false
+}
+
+// ToolRuntime is what tool calls are run with.
+type ToolRuntime struct {
+	HttpClient *http.Client
+	Registry   *tools.Registry // Tools implemented by Go functions, run before those of Tools
+	Tools      []models.Tool   // Tools run by sending the call to their endpoint
+	Config     models.ToolConfiguration
+	Breakers   *CircuitBreakers    // Circuit breakers of the functions, none if nil
+	OnToolCall models.ToolCallHook // Asked before a tool call is run, if set
+	Terminal   models.Terminal
+}
+
+// has reports whether the named function is registered or implemented by one of the tools.
+func (runtime ToolRuntime) has(function string) bool {
+	if runtime.Registry.Has(function) {
+		return true
+	}
+	_, exists := (&SideKick{}).FindTool(runtime.Tools, function)
+	return exists
+}
+
+// CallTool runs a tool call, dispatching to the handler registered for the function in registry, if any,
+// and otherwise sending it to the endpoint of tool with RunFunction. The call is cancelled with ctx.
+func (utility *SideKick) CallTool(ctx context.Context, httpClient *http.Client, registry *tools.Registry, tool models.Tool, payload models.FunctionPayload, termconfig models.Terminal) (models.FunctionResponse, error) {
+	if !registry.Has(payload.FunctionName) {
+		return utility.runFunction(ctx, httpClient, tool, payload, termconfig.Debug, termconfig.Trace)
+	}
+
+	utility.Debug(fmt.Sprintf("CallTool: running registered handler of %s", payload.FunctionName), termconfig)
+	type outcome struct {
+		response models.FunctionResponse
+		err      error
+	}
+	// handlers that ignore ctx are abandoned once it is done
+	done := make(chan outcome, 1)
+	go func() {
+		response, err := registry.Call(ctx, payload)
+		done <- outcome{response, err}
+	}()
+	select {
+	case result := <-done:
+		return result.response, result.err
+	case <-ctx.Done():
+		return models.FunctionResponse{}, ctx.Err()
+	}
+}
+
+// RunToolCalls runs tool calls with RunTool and returns their results as ToolRole messages whose content
+// is the FunctionResponse as JSON, in the order of the calls. Up to Config.MaxConcurrency calls run at
+// the same time, each within its timeout. A failing call, including one that timed out, is reported to
+// the model as a response with FunctionResponseStatusError. If a call names a function that is neither
+// registered nor implemented by one of the tools, no call is run and false is returned, leaving the calls
+// to the caller.
+func (utility *SideKick) RunToolCalls(ctx context.Context, runtime ToolRuntime, calls []models.ToolCall) ([]models.Message, bool) {
+	for _, call := range calls {
+		if !runtime.has(call.Payload.FunctionName) {
+			utility.Debug(fmt.Sprintf("RunToolCalls: no tool for function %s", call.Payload.FunctionName), runtime.Terminal)
+			return nil, false
+		}
+	}
+
+	// ask the hook about one call at a time, e.g. so the user confirms them one after another
+	if hook := runtime.OnToolCall; hook != nil {
+		var asking sync.Mutex
+		runtime.OnToolCall = func(call models.ToolCall) models.ToolApproval {
+			asking.Lock()
+			defer asking.Unlock()
+			return hook(call)
+		}
+	}
+
+	concurrency := runtime.Config.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = models.DefaultToolConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	results := make([]models.Message, len(calls))
+	var wait sync.WaitGroup
+	for i, call := range calls {
+		wait.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wait.Done()
+			defer func() { <-slots }()
+			results[i] = utility.runToolCall(ctx, runtime, call)
+		}()
+	}
+	wait.Wait()
+	return results, true
+}
+
+// runToolCall validates and runs a tool call and returns its result as ToolRole message.
+func (utility *SideKick) runToolCall(ctx context.Context, runtime ToolRuntime, call models.ToolCall) models.Message {
+	tool, _ := utility.FindTool(runtime.Tools, call.Payload.FunctionName)
+	if err := utility.ValidateToolCall(runtime.Registry, tool, call.Payload); err != nil {
+		utility.Debug(fmt.Sprintf("runToolCall: %s", err), runtime.Terminal)
+		return utility.CreateToolMessage(call, models.FunctionResponse{
+			Status:  models.FunctionResponseStatusError,
+			Message: fmt.Sprintf("%s. Correct the arguments and call the tool again.", err),
+		})
+	}
+	response, err := utility.RunTool(ctx, runtime, tool, call)
+	if err != nil {
+		response = models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}
+	}
+	return utility.CreateToolMessage(call, response)
+}
+
+// RunTool runs a tool call with CallTool, giving each attempt the timeout of the function. Attempts
+// failing with ErrToolUnavailable are retried up to Config.Retries times with exponential backoff, and the
+// outcome is recorded by the circuit breaker of the function; while it is open, the call fails with
+// ErrCircuitOpen without calling the tool. If set, OnToolCall is asked first: calls it denies fail with
+// ErrToolDenied, and arguments it returns replace those of the call once they pass ValidateToolCall. The
+// call is cancelled with ctx.
+func (utility *SideKick) RunTool(ctx context.Context, runtime ToolRuntime, tool models.Tool, call models.ToolCall) (models.FunctionResponse, error) {
+	function := call.Payload.FunctionName
+	if err := runtime.Breakers.Allow(function); err != nil {
+		utility.Debug(fmt.Sprintf("RunTool: %s", err), runtime.Terminal)
+		return models.FunctionResponse{}, err
+	}
+
+	payload := call.Payload
+	if runtime.OnToolCall != nil {
+		approval := runtime.OnToolCall(call)
+		if !approval.Approved {
+			runtime.Breakers.Release(function)
+			utility.Debug(fmt.Sprintf("RunTool: call of %s denied: %s", function, approval.Reason), runtime.Terminal)
+			if approval.Reason != "" {
+				return models.FunctionResponse{}, fmt.Errorf("%w: %s", ErrToolDenied, approval.Reason)
+			}
+			return models.FunctionResponse{}, fmt.Errorf("%w by the user", ErrToolDenied)
+		}
+		if approval.Arguments != nil {
+			payload.Arguments = approval.Arguments
+			if err := utility.ValidateToolCall(runtime.Registry, tool, payload); err != nil {
+				runtime.Breakers.Release(function)
+				utility.Debug(fmt.Sprintf("RunTool: arguments of the approved call of %s: %s", function, err), runtime.Terminal)
+				return models.FunctionResponse{}, fmt.Errorf("invalid arguments of the approved call: %w", err)
+			}
+		}
+	}
+
+	var response models.FunctionResponse
+	var err error
+	for attempt := 0; attempt <= runtime.Config.Retries; attempt++ {
+		if attempt > 0 {
+			backoff := runtime.Config.Backoff(attempt)
+			utility.Debug(fmt.Sprintf("RunTool: retrying %s in %s after: %s", function, backoff, err), runtime.Terminal)
+			select {
+			case <-ctx.Done():
+				runtime.Breakers.Release(function)
+				return response, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+		response, err = utility.attemptTool(ctx, runtime, tool, payload)
+		if !errors.Is(err, ErrToolUnavailable) {
+			break
+		}
+	}
+	runtime.Breakers.Record(function, errors.Is(err, ErrToolUnavailable), runtime.Config)
+	if errors.Is(err, ErrToolUnavailable) && runtime.Config.Retries > 0 {
+		err = fmt.Errorf("%w (gave up after %d attempts)", err, runtime.Config.Retries+1)
+	}
+	return response, err
+}
+
+// attemptTool runs a tool call once, within the timeout of the function. Calls cancelled with ctx fail
+// with its error rather than ErrToolUnavailable.
+func (utility *SideKick) attemptTool(ctx context.Context, runtime ToolRuntime, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	callCtx := ctx
+	timeout := runtime.Config.CallTimeout(payload.FunctionName)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	response, err := utility.CallTool(callCtx, runtime.HttpClient, runtime.Registry, tool, payload, runtime.Terminal)
+	if ctx.Err() != nil {
+		return response, ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: tool %s timed out after %s", ErrToolUnavailable, payload.FunctionName, timeout)
+	}
+	return response, err
+}
+
+// ValidateToolCall validates the arguments of a tool call against the parameters of its function, as
+// registered in registry or, if not registered, as defined by tool. It returns a *tools.ValidationError
+// describing every problem found.
+func (utility *SideKick) ValidateToolCall(registry *tools.Registry, tool models.Tool, payload models.FunctionPayload) error {
+	definition, exists := registry.Definition(payload.FunctionName)
+	if !exists {
+		definition = tool.Function.Function
+	}
+	return tools.Validate(definition, payload.Arguments)
+}
+
+// CreateToolMessage creates the ToolRole message answering a tool call with the response of the tool.
+func (utility *SideKick) CreateToolMessage(call models.ToolCall, response models.FunctionResponse) models.Message {
+	content, err := json.Marshal(response)
+	if err != nil {
+		content = []byte(response.Message)
+	}
+	return models.Message{Role: models.ToolRole, Content: string(content), ToolCallID: call.ID, Name: call.Payload.FunctionName}
+}
+
+// RunToolLoop sends messages and answers the tool calls of each response with the results of run, until
+// the model answers without calling tools or run cannot run the calls. It returns the messages of the
+// exchange: every response and the tool results that followed it. The last message is the final response,
+// which still carries its tool calls if they could not be run.
+func (utility *SideKick) RunToolLoop(messages []models.Message, send func(messages []models.Message) (models.Message, error), run ToolRunner) ([]models.Message, error) {
+	var exchange []models.Message
+	for round := 0; round < MaxToolRounds; round++ {
+		response, err := send(messages)
+		if err != nil {
+			return exchange, err
+		}
+		exchange = append(exchange, response)
+		if len(response.ToolCalls) == 0 {
+			return exchange, nil
+		}
+
+		results, ok := run(response.ToolCalls)
+		if !ok {
+			return exchange, nil
+		}
+		exchange = append(exchange, results...)
+		messages = append(append(messages, response), results...)
+	}
+	return exchange, ErrToolRoundsExceeded
+}
@@ -0,0 +1,281 @@
+package sidekick_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+func TestToolDefinitions(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	lookup := models.Function{Function: models.FunctionDefinition{FunctionName: "lookup"}}
+	tools := []models.Tool{{Function: lookup}, {Function: models.Function{Function: models.FunctionDefinition{FunctionName: "weather"}}}}
+
+	definitions := utility.ToolDefinitions([]models.Function{lookup}, tools)
+	if len(definitions) != 2 || definitions[1].Function.FunctionName != "weather" || definitions[0].Type != models.TypeFunction {
+		t.Errorf("unexpected definitions %+v", definitions)
+	}
+}
+
+func TestRunToolLoop(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	call := models.ToolCall{ID: "call_1", Payload: models.FunctionPayload{FunctionName: "lookup"}}
+	run := func(calls []models.ToolCall) ([]models.Message, bool) {
+		return []models.Message{utility.CreateToolMessage(calls[0], models.FunctionResponse{Status: models.FunctionResponseStatusSuccess, Message: "found"})}, true
+	}
+
+	var rounds int
+	exchange, err := utility.RunToolLoop(nil, func(messages []models.Message) (models.Message, error) {
+		rounds++
+		if rounds == 1 {
+			return models.Message{Role: models.Assistant, ToolCalls: []models.ToolCall{call}}, nil
+		}
+		if len(messages) != 2 || messages[1].Role != models.ToolRole || messages[1].ToolCallID != "call_1" {
+			t.Errorf("unexpected messages %+v", messages)
+		}
+		return models.Message{Role: models.Assistant, Content: "done"}, nil
+	}, run)
+	if err != nil || len(exchange) != 3 || exchange[2].Content != "done" {
+		t.Errorf("unexpected exchange %+v: %v", exchange, err)
+	}
+
+	// a model that keeps calling tools is stopped
+	_, err = utility.RunToolLoop(nil, func([]models.Message) (models.Message, error) {
+		return models.Message{Role: models.Assistant, ToolCalls: []models.ToolCall{call}}, nil
+	}, run)
+	if !errors.Is(err, sidekick.ErrToolRoundsExceeded) {
+		t.Errorf("expected ErrToolRoundsExceeded, got %v", err)
+	}
+}
+
+func TestRunToolCallsConcurrently(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	var running, peak int32
+	registry := tools.NewRegistry()
+	registry.Register("work", models.FunctionDefinition{}, func(ctx context.Context, args map[string]any) (any, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return args["n"], nil
+	})
+	// ignores ctx, so it is abandoned once its timeout expires
+	release := make(chan struct{})
+	defer close(release)
+	registry.Register("hang", models.FunctionDefinition{}, func(ctx context.Context, args map[string]any) (any, error) {
+		<-release
+		return "too late", nil
+	})
+
+	var calls []models.ToolCall
+	for i := 0; i < 4; i++ {
+		calls = append(calls, models.ToolCall{ID: fmt.Sprint(i), Payload: models.FunctionPayload{FunctionName: "work", Arguments: map[string]any{"n": fmt.Sprint(i)}}})
+	}
+	calls = append(calls, models.ToolCall{ID: "4", Payload: models.FunctionPayload{FunctionName: "hang"}})
+
+	runtime := sidekick.ToolRuntime{Registry: registry, Config: models.ToolConfiguration{MaxConcurrency: 2, Timeouts: map[string]int{"hang": 1}}}
+	start := time.Now()
+	results, ok := utility.RunToolCalls(context.Background(), runtime, calls[:4])
+	if !ok || len(results) != 4 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for i, result := range results {
+		if result.ToolCallID != fmt.Sprint(i) || !strings.Contains(result.Content, fmt.Sprintf(`"message":"%d"`, i)) {
+			t.Errorf("result %d out of order: %+v", i, result)
+		}
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 calls to run at the same time, got %d", peak)
+	}
+	if elapsed := time.Since(start); elapsed >= 80*time.Millisecond {
+		t.Errorf("calls did not run concurrently, took %s", elapsed)
+	}
+
+	results, _ = utility.RunToolCalls(context.Background(), runtime, calls[4:])
+	if !strings.Contains(results[0].Content, "timed out") || !strings.Contains(results[0].Content, `"status":"error"`) {
+		t.Errorf("expected a timeout, got %+v", results[0])
+	}
+}
+
+func TestRunToolCallsValidatesArguments(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	var called bool
+	registry := tools.NewRegistry()
+	registry.Register("weather", models.FunctionDefinition{Parameters: models.FunctionParameter{
+		Properties: map[string]models.Parameter{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}}, func(ctx context.Context, args map[string]any) (any, error) {
+		called = true
+		return "sunny", nil
+	})
+
+	call := models.ToolCall{ID: "call_1", Payload: models.FunctionPayload{FunctionName: "weather", Arguments: map[string]any{"city": 42.0}}}
+	results, ok := utility.RunToolCalls(context.Background(), sidekick.ToolRuntime{Registry: registry}, []models.ToolCall{call})
+	if !ok || called {
+		t.Fatalf("invalid arguments must not reach the tool")
+	}
+	if !strings.Contains(results[0].Content, "city must be of type string") || !strings.Contains(results[0].Content, `"status":"error"`) {
+		t.Errorf("expected a corrective error, got %+v", results[0])
+	}
+}
+
+func TestRunToolRetriesAndBreaker(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	var requests, failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"OK","message":"sunny"}`)
+	}))
+	defer server.Close()
+
+	tool := models.Tool{Endpoint: server.URL, Function: models.Function{Function: models.FunctionDefinition{FunctionName: "weather"}}}
+	payload := models.FunctionPayload{FunctionName: "weather"}
+	runtime := sidekick.ToolRuntime{
+		HttpClient: server.Client(),
+		Tools:      []models.Tool{tool},
+		Config:     models.ToolConfiguration{Retries: 2, RetryBackoff: 1, BreakerThreshold: 2, BreakerCooldown: 60},
+		Breakers:   &sidekick.CircuitBreakers{},
+	}
+
+	// fails twice, succeeds on the last retry
+	failures = 2
+	response, err := utility.RunTool(context.Background(), runtime, tool, models.ToolCall{Payload: payload})
+	if err != nil || response.Message != "sunny" || requests != 3 {
+		t.Fatalf("unexpected response %+v after %d requests: %v", response, requests, err)
+	}
+
+	// unavailable calls open the breaker after the threshold
+	failures, requests = 100, 0
+	for i := 0; i < 2; i++ {
+		if _, err := utility.RunTool(context.Background(), runtime, tool, models.ToolCall{Payload: payload}); !errors.Is(err, sidekick.ErrToolUnavailable) {
+			t.Errorf("expected ErrToolUnavailable, got %v", err)
+		}
+	}
+	if _, err := utility.RunTool(context.Background(), runtime, tool, models.ToolCall{Payload: payload}); !errors.Is(err, sidekick.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if requests != 6 {
+		t.Errorf("expected no request while the breaker is open, got %d requests", requests)
+	}
+
+	// the failure is reported to the model
+	results, _ := utility.RunToolCalls(context.Background(), runtime, []models.ToolCall{{ID: "call_1", Payload: payload}})
+	if !strings.Contains(results[0].Content, `"status":"error"`) || !strings.Contains(results[0].Content, "circuit breaker open") {
+		t.Errorf("expected a structured failure, got %+v", results[0])
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	breakers := &sidekick.CircuitBreakers{}
+	config := models.ToolConfiguration{BreakerThreshold: 1, BreakerCooldown: 1}
+	if err := breakers.Allow("weather"); err != nil {
+		t.Fatalf("expected a closed breaker, got %v", err)
+	}
+	breakers.Record("weather", true, config)
+	if err := breakers.Allow("weather"); !errors.Is(err, sidekick.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// after the cooldown a single trial call is let through
+	time.Sleep(1100 * time.Millisecond)
+	if err := breakers.Allow("weather"); err != nil {
+		t.Fatalf("expected a trial call, got %v", err)
+	}
+	if err := breakers.Allow("weather"); !errors.Is(err, sidekick.ErrCircuitOpen) {
+		t.Fatalf("expected concurrent calls to wait for the trial, got %v", err)
+	}
+
+	// a released trial lets the next call try, a successful trial closes the breaker
+	breakers.Release("weather")
+	if err := breakers.Allow("weather"); err != nil {
+		t.Fatalf("expected a new trial call, got %v", err)
+	}
+	breakers.Record("weather", false, config)
+	for range 2 {
+		if err := breakers.Allow("weather"); err != nil {
+			t.Errorf("expected a closed breaker, got %v", err)
+		}
+	}
+}
+
+func TestRunToolApproval(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	registry := tools.NewRegistry()
+	registry.Register("delete", models.FunctionDefinition{}, func(ctx context.Context, args map[string]any) (any, error) {
+		return fmt.Sprintf("deleted %v", args["path"]), nil
+	})
+
+	var asked []string
+	runtime := sidekick.ToolRuntime{Registry: registry, OnToolCall: func(call models.ToolCall) models.ToolApproval {
+		asked = append(asked, call.ID)
+		switch call.Payload.Arguments["path"] {
+		case "/":
+			return models.ToolApproval{Reason: "refusing to delete everything"}
+		case "tmp":
+			return models.ToolApproval{Approved: true, Arguments: map[string]any{"path": "tmp/cache"}}
+		}
+		return models.ToolApproval{Approved: true}
+	}}
+
+	calls := []models.ToolCall{
+		{ID: "call_1", Payload: models.FunctionPayload{FunctionName: "delete", Arguments: map[string]any{"path": "/"}}},
+		{ID: "call_2", Payload: models.FunctionPayload{FunctionName: "delete", Arguments: map[string]any{"path": "tmp"}}},
+		{ID: "call_3", Payload: models.FunctionPayload{FunctionName: "delete", Arguments: map[string]any{"path": "old"}}},
+	}
+	results, _ := utility.RunToolCalls(context.Background(), runtime, calls)
+	sort.Strings(asked)
+	if strings.Join(asked, ",") != "call_1,call_2,call_3" {
+		t.Errorf("unexpected approvals %v", asked)
+	}
+	if !strings.Contains(results[0].Content, "tool call denied: refusing to delete everything") || !strings.Contains(results[0].Content, `"status":"error"`) {
+		t.Errorf("expected a denial, got %+v", results[0])
+	}
+	if !strings.Contains(results[1].Content, "deleted tmp/cache") || !strings.Contains(results[2].Content, "deleted old") {
+		t.Errorf("unexpected results %+v", results[1:])
+	}
+}
+
+func TestRunToolApprovalValidatesArguments(t *testing.T) {
+	utility := &sidekick.SideKick{}
+	var called bool
+	registry := tools.NewRegistry()
+	registry.Register("weather", models.FunctionDefinition{Parameters: models.FunctionParameter{
+		Properties: map[string]models.Parameter{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}}, func(ctx context.Context, args map[string]any) (any, error) {
+		called = true
+		return "sunny", nil
+	})
+	runtime := sidekick.ToolRuntime{Registry: registry, OnToolCall: func(call models.ToolCall) models.ToolApproval {
+		return models.ToolApproval{Approved: true, Arguments: map[string]any{"city": 42.0}}
+	}}
+
+	call := models.ToolCall{ID: "call_1", Payload: models.FunctionPayload{FunctionName: "weather", Arguments: map[string]any{"city": "Berlin"}}}
+	results, _ := utility.RunToolCalls(context.Background(), runtime, []models.ToolCall{call})
+	if called {
+		t.Fatalf("invalid arguments of the hook must not reach the tool")
+	}
+	if !strings.Contains(results[0].Content, "invalid arguments of the approved call") || !strings.Contains(results[0].Content, "city must be of type string") {
+		t.Errorf("expected a validation error, got %+v", results[0])
+	}
+}
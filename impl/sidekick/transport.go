@@ -0,0 +1,80 @@
+package sidekick
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// NewTransport returns a transport with the proxy, TLS and connection settings of config, based on
+// http.DefaultTransport. It returns nil if config changes none of them.
+func NewTransport(config models.HttpConfiguration) (*http.Transport, error) {
+	if config.ProxyURL == "" && config.CACertFile == "" && config.ClientCertFile == "" && !config.DisableKeepAlives &&
+		config.MaxIdleConns == 0 && config.IdleConnTimeout == 0 {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ProxyURL != "" {
+		proxy, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if config.CACertFile != "" || config.ClientCertFile != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if config.CACertFile != "" {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			pem, err := os.ReadFile(config.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no CA certificates found in %s", config.CACertFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if config.ClientCertFile != "" {
+			certificate, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	transport.DisableKeepAlives = config.DisableKeepAlives
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConns
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = time.Duration(config.IdleConnTimeout) * time.Second
+	}
+	return transport, nil
+}
+
+// failedTransport fails all requests with the error of a transport that could not be created, so that a
+// misconfigured proxy or certificate is never bypassed.
+type failedTransport struct {
+	err error
+}
+
+// RoundTrip implements http.RoundTripper.
+func (transport failedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, transport.err
+}
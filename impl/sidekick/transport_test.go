@@ -0,0 +1,63 @@
+package sidekick_test
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestNewHttpClientTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var config models.Configuration
+	config.HttpConfig.HTTPClientTimeout = 5
+	if _, err := sidekick.NewHttpClient(config).Get(server.URL); err == nil {
+		t.Error("expected the certificate of the server not to be trusted")
+	}
+	config.HttpConfig.CACertFile = caFile
+	config.HttpConfig.DisableKeepAlives = true
+	if resp, err := sidekick.NewHttpClient(config).Get(server.URL); err != nil {
+		t.Errorf("expected the CA bundle to be trusted, got %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// a broken setup fails the requests instead of being bypassed
+	config.HttpConfig.CACertFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := sidekick.NewHttpClient(config).Get(server.URL); err == nil || !strings.Contains(err.Error(), "failed to read CA certificates") {
+		t.Errorf("expected the error of the CA bundle, got %v", err)
+	}
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, "proxied")
+	}))
+	defer proxy.Close()
+	config.HttpConfig = models.HttpConfiguration{HTTPClientTimeout: 5, ProxyURL: proxy.URL}
+	resp, err := sidekick.NewHttpClient(config).Get("http://provider.invalid/v1/models")
+	if err != nil {
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if proxied != "http://provider.invalid/v1/models" {
+		t.Errorf("expected the request to go through the proxy, got %q", proxied)
+	}
+}
@@ -0,0 +1,69 @@
+package sidekick
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// UsageCounter sums the usage and estimated costs of the responses of a companion, in total, per session
+// and per model. The zero value is ready to use. It is safe for concurrent use.
+type UsageCounter struct {
+	mutex  sync.Mutex
+	report models.UsageReport
+}
+
+// Record adds the usage and cost of a response of model in session. Responses without usage are ignored,
+// cost is nil for models without price.
+func (counter *UsageCounter) Record(session, model string, usage *models.Usage, cost *models.Cost) {
+	if usage == nil {
+		return
+	}
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	if cost != nil {
+		costs := counter.report.Costs
+		if costs == nil {
+			costs = &models.CostReport{Sessions: make(map[string]models.Cost), Models: make(map[string]models.Cost)}
+			counter.report.Costs = costs
+		}
+		costs.Total = costs.Total.Add(*cost)
+		costs.Responses++
+		costs.Sessions[session] = costs.Sessions[session].Add(*cost)
+		costs.Models[model] = costs.Models[model].Add(*cost)
+	}
+
+	if counter.report.Sessions == nil {
+		counter.report.Sessions = make(map[string]models.Usage)
+		counter.report.Models = make(map[string]models.Usage)
+	}
+	counter.report.Total = counter.report.Total.Add(*usage)
+	counter.report.Responses++
+	counter.report.Sessions[session] = counter.report.Sessions[session].Add(*usage)
+	counter.report.Models[model] = counter.report.Models[model].Add(*usage)
+}
+
+// Report returns a copy of the sums.
+func (counter *UsageCounter) Report() models.UsageReport {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	report := counter.report
+	report.Sessions = maps.Clone(counter.report.Sessions)
+	report.Models = maps.Clone(counter.report.Models)
+	if counter.report.Costs != nil {
+		costs := *counter.report.Costs
+		costs.Sessions = maps.Clone(costs.Sessions)
+		costs.Models = maps.Clone(costs.Models)
+		report.Costs = &costs
+	}
+	return report
+}
+
+// Reset sets the sums back to zero.
+func (counter *UsageCounter) Reset() {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.report = models.UsageReport{}
+}
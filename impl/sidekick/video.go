@@ -0,0 +1,155 @@
+package sidekick
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// FFmpegBinary and FFprobeBinary are the executables used for video processing.
+// They are resolved via PATH unless set to an absolute path.
+var (
+	FFmpegBinary  = "ffmpeg"
+	FFprobeBinary = "ffprobe"
+)
+
+// ExtractVideoFrames extracts count evenly spaced frames from a video file and returns them as
+// Base64Images whose larger dimension is resized to maxSize. A maxSize of zero keeps the original size.
+// The extraction relies on ffmpeg and ffprobe being installed.
+func (utility *SideKick) ExtractVideoFrames(filepath string, count int, maxSize int) ([]models.Base64Image, error) {
+	if count <= 0 {
+		return nil, errors.New("frame count must be greater than zero")
+	}
+
+	duration, err := utility.probeMediaDuration(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	// sample in the middle of each of the count equally sized segments
+	frames := make([]models.Base64Image, 0, count)
+	segment := duration / float64(count)
+	for i := 0; i < count; i++ {
+		timestamp := segment*float64(i) + segment/2
+
+		frame, err := utility.extractFrame(filepath, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		if maxSize > 0 {
+			frame, err = utility.ResizeImage(frame, maxSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var image models.Base64Image
+		image.SetData(frame)
+		frames = append(frames, image)
+	}
+
+	return frames, nil
+}
+
+// ExtractVideoKeyframes extracts up to count keyframes from a video file and returns them as
+// Base64Images whose larger dimension is resized to maxSize.
+func (utility *SideKick) ExtractVideoKeyframes(filepath string, count int, maxSize int) ([]models.Base64Image, error) {
+	if count <= 0 {
+		return nil, errors.New("frame count must be greater than zero")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(FFmpegBinary, "-v", "error", "-skip_frame", "nokey", "-i", filepath,
+		"-vsync", "vfr", "-frames:v", strconv.Itoa(count), "-f", "image2pipe", "-vcodec", "png", "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to extract keyframes: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var frames []models.Base64Image
+	for _, frame := range splitPNGStream(stdout.Bytes()) {
+		var err error
+		if maxSize > 0 {
+			frame, err = utility.ResizeImage(frame, maxSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var image models.Base64Image
+		image.SetData(frame)
+		frames = append(frames, image)
+	}
+
+	return frames, nil
+}
+
+// probeMediaDuration returns the duration of a video or audio file in seconds.
+func (utility *SideKick) probeMediaDuration(filepath string) (float64, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(FFprobeBinary, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", filepath)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("failed to probe media: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(stdout.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse media duration: %w", err)
+	}
+	if duration <= 0 {
+		return 0, errors.New("media has no duration")
+	}
+
+	return duration, nil
+}
+
+// extractFrame extracts a single frame at the given timestamp as PNG.
+func (utility *SideKick) extractFrame(filepath string, timestamp float64) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(FFmpegBinary, "-v", "error", "-ss", strconv.FormatFloat(timestamp, 'f', 3, 64),
+		"-i", filepath, "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to extract frame at %.3fs: %w: %s", timestamp, err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("no frame found at %.3fs", timestamp)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// splitPNGStream splits a stream of concatenated PNG images into the individual images.
+func splitPNGStream(stream []byte) [][]byte {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	trailer := []byte("IEND\xaeB`\x82")
+
+	var images [][]byte
+	for len(stream) > 0 {
+		if !bytes.HasPrefix(stream, signature) {
+			break
+		}
+
+		end := bytes.Index(stream, trailer)
+		if end < 0 {
+			break
+		}
+		end += len(trailer)
+
+		images = append(images, stream[:end])
+		stream = stream[end:]
+	}
+
+	return images
+}
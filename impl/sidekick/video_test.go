@@ -0,0 +1,125 @@
+package sidekick_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+)
+
+// createPNG generates a PNG image with the given dimensions.
+func createPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		img.Set(x, 0, color.RGBA{0, 0, 255, 255})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// fakeMediaTools replaces ffmpeg and ffprobe with shell scripts. ffprobe reports duration, ffmpeg
+// writes stream to stdout and appends the value of its -ss argument, if any, to the returned log file.
+func fakeMediaTools(t *testing.T, duration string, stream []byte) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake media tools require a posix shell")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "timestamps.log")
+	streamFile := filepath.Join(dir, "stream")
+	if err := os.WriteFile(streamFile, stream, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ffprobe := filepath.Join(dir, "ffprobe")
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	scripts := map[string]string{
+		ffprobe: fmt.Sprintf("#!/bin/sh\necho %s\n", duration),
+		ffmpeg:  fmt.Sprintf("#!/bin/sh\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = -ss ]; then echo \"$2\" >> %q; fi\n  shift\ndone\ncat %q\n", log, streamFile),
+	}
+	for path, script := range scripts {
+		if err := os.WriteFile(path, []byte(script), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousFFmpeg, previousFFprobe := sidekick.FFmpegBinary, sidekick.FFprobeBinary
+	sidekick.FFmpegBinary, sidekick.FFprobeBinary = ffmpeg, ffprobe
+	t.Cleanup(func() { sidekick.FFmpegBinary, sidekick.FFprobeBinary = previousFFmpeg, previousFFprobe })
+	return log
+}
+
+func TestExtractVideoFrames(t *testing.T) {
+	util := sidekick_interface.NewSideKick()
+	log := fakeMediaTools(t, "10.0", createPNG(t, 40, 20))
+
+	frames, err := util.ExtractVideoFrames("video.mp4", 4, 10)
+	if err != nil {
+		t.Fatalf("failed to extract frames: %v", err)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("expected 4 frames, got %d", len(frames))
+	}
+
+	// frames are taken from the middle of four 2.5s segments
+	timestamps, _ := os.ReadFile(log)
+	if expected := []string{"1.250", "3.750", "6.250", "8.750"}; !slices.Equal(strings.Fields(string(timestamps)), expected) {
+		t.Errorf("expected timestamps %v, got %v", expected, strings.Fields(string(timestamps)))
+	}
+
+	data, _ := frames[0].GetData()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Dx() != 10 || img.Bounds().Dy() != 5 {
+		t.Errorf("expected a frame resized to 10x5, got %v (%v)", img.Bounds(), err)
+	}
+
+	if _, err := util.ExtractVideoFrames("video.mp4", 0, 10); err == nil {
+		t.Error("expected an error for a frame count of zero")
+	}
+}
+
+func TestExtractVideoFramesInvalidDuration(t *testing.T) {
+	util := sidekick_interface.NewSideKick()
+	fakeMediaTools(t, "N/A", nil)
+
+	if _, err := util.ExtractVideoFrames("video.mp4", 2, 0); err == nil || !strings.Contains(err.Error(), "duration") {
+		t.Errorf("expected an error for an unknown duration, got %v", err)
+	}
+}
+
+func TestExtractVideoKeyframes(t *testing.T) {
+	util := sidekick_interface.NewSideKick()
+	first, second, third := createPNG(t, 8, 8), createPNG(t, 16, 8), createPNG(t, 8, 16)
+	// the stream ends with a truncated image, which is dropped
+	stream := slices.Concat(first, second, third, first[:len(first)/2])
+	fakeMediaTools(t, "10.0", stream)
+
+	frames, err := util.ExtractVideoKeyframes("video.mp4", 5, 0)
+	if err != nil {
+		t.Fatalf("failed to extract keyframes: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(frames))
+	}
+	for i, expected := range [][]byte{first, second, third} {
+		if data, _ := frames[i].GetData(); !bytes.Equal(data, expected) {
+			t.Errorf("frame %d does not match the image in the stream", i)
+		}
+	}
+}
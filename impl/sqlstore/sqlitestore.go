@@ -0,0 +1,229 @@
+// Package sqlstore provides a conversation store backed by SQLite whose messages are searchable with
+// an FTS5 full-text index.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var _ conversationstore.Store = (*SQLiteStore)(nil)
+var _ conversationstore.Searcher = (*SQLiteStore)(nil)
+
+// schema creates the tables of the store. Messages are stored as JSON in the format of exported
+// conversations; their content is indexed in messages_fts.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS sessions (
+		name TEXT PRIMARY KEY,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS messages (
+		session TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		message TEXT NOT NULL,
+		PRIMARY KEY (session, position)
+	)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(session UNINDEXED, position UNINDEXED, content)`,
+}
+
+// SQLiteStore is a conversationstore.Store keeping conversations in a SQLite database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the SQLite database at dbPath and creates the tables of the store if needed.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; sharing one connection also keeps in-memory databases alive
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create conversation store: %w", err)
+		}
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database.
+func (store *SQLiteStore) Close() error {
+	return store.db.Close()
+}
+
+// Load implements conversationstore.Store.
+func (store *SQLiteStore) Load(key string) ([]models.Message, error) {
+	rows, err := store.db.Query(`SELECT message FROM messages WHERE session = ? ORDER BY position`, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+	defer rows.Close()
+
+	var conversation []models.Message
+	for rows.Next() {
+		var messageJSON []byte
+		if err := rows.Scan(&messageJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		message, err := decodeMessage(messageJSON)
+		if err != nil {
+			return nil, err
+		}
+		conversation = append(conversation, message)
+	}
+	return conversation, rows.Err()
+}
+
+// Save implements conversationstore.Store. The stored conversation is replaced.
+func (store *SQLiteStore) Save(key string, conversation []models.Message) error {
+	ctx := context.Background()
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteSession(ctx, tx, key); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO sessions (name, updated_at) VALUES (?, ?)`, key, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	insertMessage, err := tx.PrepareContext(ctx, `INSERT INTO messages (session, position, message) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer insertMessage.Close()
+	indexMessage, err := tx.PrepareContext(ctx, `INSERT INTO messages_fts (session, position, content) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer indexMessage.Close()
+
+	for position, message := range conversation {
+		messageJSON, err := json.Marshal(models.NewExportedMessage(message))
+		if err != nil {
+			return fmt.Errorf("failed to serialize message %d: %w", position, err)
+		}
+		if _, err := insertMessage.ExecContext(ctx, key, position, messageJSON); err != nil {
+			return fmt.Errorf("failed to save message %d: %w", position, err)
+		}
+		if _, err := indexMessage.ExecContext(ctx, key, position, message.Content); err != nil {
+			return fmt.Errorf("failed to index message %d: %w", position, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete implements conversationstore.Store.
+func (store *SQLiteStore) Delete(key string) error {
+	ctx := context.Background()
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteSession(ctx, tx, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteSession removes a session, its messages and their index entries.
+func deleteSession(ctx context.Context, tx *sql.Tx, key string) error {
+	for _, table := range []string{"messages_fts", "messages"} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE session = ?`, table), key); err != nil {
+			return fmt.Errorf("failed to delete messages: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE name = ?`, key); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// Keys implements conversationstore.Store. The keys are sorted.
+func (store *SQLiteStore) Keys() ([]string, error) {
+	rows, err := store.db.Query(`SELECT name FROM sessions ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Search implements conversationstore.Searcher with the FTS5 index. Messages are ranked by BM25; the
+// score of a result is its negated FTS5 rank.
+func (store *SQLiteStore) Search(query string, limit int) ([]conversationstore.SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := store.db.Query(`SELECT f.session, f.position, m.message, -bm25(messages_fts)
+		FROM messages_fts f JOIN messages m ON m.session = f.session AND m.position = f.position
+		WHERE messages_fts MATCH ? ORDER BY bm25(messages_fts) LIMIT ?`, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var results []conversationstore.SearchResult
+	for rows.Next() {
+		var result conversationstore.SearchResult
+		var messageJSON []byte
+		if err := rows.Scan(&result.Session, &result.Position, &messageJSON, &result.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if result.Message, err = decodeMessage(messageJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// decodeMessage decodes a message stored as JSON.
+func decodeMessage(data []byte) (models.Message, error) {
+	var exported models.ExportedMessage
+	if err := json.Unmarshal(data, &exported); err != nil {
+		return models.Message{}, fmt.Errorf("failed to deserialize message: %w", err)
+	}
+	return exported.Message(), nil
+}
+
+// ftsQuery turns text into an FTS5 query matching messages that contain all of its words.
+func ftsQuery(text string) string {
+	tokens := vdbutil.Tokenize(text)
+	for i, token := range tokens {
+		tokens[i] = `"` + token + `"`
+	}
+	return strings.Join(tokens, " ")
+}
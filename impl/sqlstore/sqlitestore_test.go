@@ -0,0 +1,94 @@
+package sqlstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/sqlstore"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	store, err := sqlstore.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversation := []models.Message{
+		{ID: "1", Role: models.User, Content: "hello"},
+		{ID: "2", Role: models.Assistant, Content: "hi there", Model: "test", Usage: &models.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}},
+	}
+	if err := store.Save("work", conversation); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// conversations survive reopening the database
+	store, err = sqlstore.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	loaded, err := store.Load("work")
+	if err != nil || !reflect.DeepEqual(loaded, conversation) {
+		t.Errorf("expected %+v, got %+v: %v", conversation, loaded, err)
+	}
+	if keys, _ := store.Keys(); !reflect.DeepEqual(keys, []string{"empty", "work"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	if err := store.Delete("work"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := store.Load("work"); len(loaded) != 0 {
+		t.Errorf("expected deleted conversation, got %+v", loaded)
+	}
+	if results, _ := store.Search("hello", 0); len(results) != 0 {
+		t.Errorf("expected deleted messages to be unindexed, got %+v", results)
+	}
+}
+
+func TestSearchSessions(t *testing.T) {
+	store, err := sqlstore.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	companion := aicompaniontest.NewFakeCompanion("The meeting moved to Thursday at ten.", "Pasta needs salted water.")
+	companion.SetConversationStore(store)
+
+	ask := func(content string) {
+		request := models.MessageRequest{Message: models.Message{Role: models.User, Content: content}}
+		if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ask("When is the meeting?")
+	if err := companion.SwitchSession("cooking"); err != nil {
+		t.Fatal(err)
+	}
+	ask("How do I cook pasta?")
+
+	// the current session is saved before searching
+	results, err := companion.SearchSessions("meeting thursday", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Session != "default" || results[0].Position != 1 || results[0].Message.Role != models.Assistant {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	results, _ = companion.SearchSessions("pasta", 10)
+	if len(results) != 2 || results[0].Session != "cooking" {
+		t.Errorf("expected both pasta messages, got %+v", results)
+	}
+}
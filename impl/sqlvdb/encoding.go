@@ -0,0 +1,43 @@
+package sqlvdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// vectorFormatFloat32 marks embeddings stored as packed little-endian float32 values. Older databases
+// store embeddings as JSON arrays, which never start with this byte.
+const vectorFormatFloat32 byte = 1
+
+// encodeVector packs a vector into a version byte followed by its little-endian float32 values.
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 1+4*len(vector))
+	data[0] = vectorFormatFloat32
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[1+4*i:], math.Float32bits(value))
+	}
+	return data
+}
+
+// decodeVector reads a vector written by encodeVector, or a JSON array of older databases.
+func decodeVector(data []byte) ([]float32, error) {
+	if len(data) == 0 || data[0] != vectorFormatFloat32 {
+		var vector []float32
+		if err := json.Unmarshal(data, &vector); err != nil {
+			return nil, err
+		}
+		return vector, nil
+	}
+
+	data = data[1:]
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector length %d", len(data))
+	}
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector, nil
+}
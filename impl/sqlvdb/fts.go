@@ -0,0 +1,208 @@
+package sqlvdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var _ vectordb.KeywordSearcher = (*SQLiteVectorDb)(nil)
+
+// schemaTablesQuery selects the tables holding schemas. The full-text indexes are virtual tables backed by
+// shadow tables, so neither shows up as a schema.
+const schemaTablesQuery = `SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'`
+
+// ftsTable returns the name of the FTS5 table indexing the text of a schema.
+func ftsTable(classname string) string {
+	return classname + "__fts"
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// createFTS creates the full-text index of a schema.
+func createFTS(ctx context.Context, db execer, classname string) error {
+	query := fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(id UNINDEXED, text)`, ftsTable(classname))
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create full-text index of %s: %w", classname, err)
+	}
+	return nil
+}
+
+// migrateFTS creates and fills the full-text index of schemas created before documents were indexed.
+func (s *SQLiteVectorDb) migrateFTS(ctx context.Context, classname string) error {
+	var count int
+	query := `SELECT count(*) FROM pragma_table_list WHERE schema = 'main' AND name = ?`
+	if err := s.db.QueryRowContext(ctx, query, ftsTable(classname)).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := createFTS(ctx, tx, classname); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT id, metadata, content FROM %s`, classname))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", classname, err)
+	}
+	var documents []models.Document
+	for rows.Next() {
+		var document models.Document
+		var metadataJSON []byte
+		if err := rows.Scan(&document.ID, &metadataJSON, &document.Content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := json.Unmarshal(metadataJSON, &document.Metadata); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+		documents = append(documents, document)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := indexDocuments(ctx, tx, classname, documents); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// indexDocuments replaces the full-text index entries of documents.
+func indexDocuments(ctx context.Context, tx *sql.Tx, classname string, documents []models.Document) error {
+	if err := unindexDocuments(ctx, tx, classname, documentIDs(documents)); err != nil {
+		return err
+	}
+
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, text) VALUES (?, ?)`, ftsTable(classname)))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer statement.Close()
+
+	for _, document := range documents {
+		if _, err := statement.ExecContext(ctx, document.ID, vdbutil.KeywordText(document)); err != nil {
+			return fmt.Errorf("failed to index document %s: %w", document.ID, err)
+		}
+	}
+	return nil
+}
+
+// unindexDocuments removes documents from the full-text index.
+func unindexDocuments(ctx context.Context, tx *sql.Tx, classname string, ids []string) error {
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, ftsTable(classname)))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer statement.Close()
+
+	for _, id := range ids {
+		if _, err := statement.ExecContext(ctx, id); err != nil {
+			return fmt.Errorf("failed to unindex document %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// documentIDs returns the IDs of documents.
+func documentIDs(documents []models.Document) []string {
+	ids := make([]string, len(documents))
+	for i, document := range documents {
+		ids[i] = document.ID
+	}
+	return ids
+}
+
+// ftsQuery turns text into an FTS5 query matching any of its words.
+func ftsQuery(text string) string {
+	tokens := vdbutil.Tokenize(text)
+	for i, token := range tokens {
+		tokens[i] = `"` + token + `"`
+	}
+	return strings.Join(tokens, " OR ")
+}
+
+// SearchDocuments implements vectordb.KeywordSearcher with the FTS5 index of the schema. Documents are
+// ranked by BM25; the score of a result is its negated FTS5 rank, higher is better.
+func (s *SQLiteVectorDb) SearchDocuments(ctx context.Context, classname, query string, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.schemas[classname]; !exists {
+		return nil, vectordb.ErrSchemaNotExists
+	}
+
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	fts := ftsTable(classname)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT d.id, d.metadata, d.embeddings, d.content, -bm25(%[1]s)
+		FROM %[1]s JOIN %[2]s d ON d.id = %[1]s.id
+		WHERE %[1]s MATCH ? ORDER BY bm25(%[1]s)`, fts, classname), match)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []models.Document
+	for rows.Next() {
+		var id, content string
+		var score float64
+		var metadataJSON, embeddingBytes []byte
+		if err := rows.Scan(&id, &metadataJSON, &embeddingBytes, &content, &score); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		var metadata map[string]any
+		if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+		if !vdbutil.MatchesFilter(metadata, queryOptions.Filter) {
+			continue
+		}
+
+		embeddings, err := decodeVector(embeddingBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize embeddings: %w", err)
+		}
+
+		documents = append(documents, models.Document{
+			ID:         id,
+			ClassName:  classname,
+			Embeddings: embeddings,
+			Metadata:   metadata,
+			Content:    content,
+			Score:      score,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	documents = vdbutil.Skip(documents, queryOptions.Offset)
+	if queryOptions.Limit > 0 && len(documents) > queryOptions.Limit {
+		documents = documents[:queryOptions.Limit]
+	}
+	return documents, nil
+}
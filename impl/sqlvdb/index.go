@@ -0,0 +1,127 @@
+package sqlvdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion/impl/hnsw"
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// filterOversampling is the factor by which the candidates of a filtered indexed query are increased, as
+// the filter is applied after the nearest neighbor search.
+const filterOversampling = 10
+
+// EnableIndex builds an in-memory HNSW index for every schema and keeps it up to date on changes. Queries
+// with a limit are then answered from the index instead of scoring every row. Results are approximate;
+// queries without a limit still scan the whole table.
+func (s *SQLiteVectorDb) EnableIndex(ctx context.Context, config hnsw.Config) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	indexes := make(map[string]*hnsw.Index, len(s.schemas))
+	for classname := range s.schemas {
+		index, err := s.buildIndex(ctx, classname, config)
+		if err != nil {
+			return err
+		}
+		indexes[classname] = index
+	}
+
+	s.indexConfig = &config
+	s.indexes = indexes
+	return nil
+}
+
+// buildIndex creates the index of a schema from its stored embeddings.
+func (s *SQLiteVectorDb) buildIndex(ctx context.Context, classname string, config hnsw.Config) (*hnsw.Index, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, embeddings FROM %s`, classname))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build index for %s: %w", classname, err)
+	}
+	defer rows.Close()
+
+	index := hnsw.New(config)
+	for rows.Next() {
+		var id string
+		var embeddingBytes []byte
+		if err := rows.Scan(&id, &embeddingBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		embeddings, err := decodeVector(embeddingBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize embeddings: %w", err)
+		}
+		index.Add(id, embeddings)
+	}
+	return index, rows.Err()
+}
+
+// queryIndex answers a query from the index and loads the matching rows.
+func (s *SQLiteVectorDb) queryIndex(ctx context.Context, index *hnsw.Index, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	k := queryOptions.Offset + queryOptions.Limit
+	if len(queryOptions.Filter) > 0 {
+		k *= filterOversampling
+	}
+
+	queryVector := s.NormalizeVector(vector)
+	candidates := index.Search(queryVector, k)
+	if len(candidates) == 0 {
+		return []models.Document{}, nil
+	}
+
+	placeholders := make([]string, len(candidates))
+	arguments := make([]any, len(candidates))
+	for i, candidate := range candidates {
+		placeholders[i] = "?"
+		arguments[i] = candidate.ID
+	}
+
+	query := fmt.Sprintf(`SELECT id, metadata, embeddings, content FROM %s WHERE id IN (%s)`, classname, strings.Join(placeholders, ","))
+	rows, err := s.db.QueryContext(ctx, query, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []models.Document
+	for rows.Next() {
+		var id, content string
+		var metadataJSON, embeddingBytes []byte
+		if err := rows.Scan(&id, &metadataJSON, &embeddingBytes, &content); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		embeddings, err := decodeVector(embeddingBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize embeddings: %w", err)
+		}
+
+		var metadata map[string]any
+		if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+
+		if !vdbutil.MatchesFilter(metadata, queryOptions.Filter) {
+			continue
+		}
+
+		documents = append(documents, models.Document{
+			ID:         id,
+			ClassName:  classname,
+			Embeddings: embeddings,
+			Metadata:   metadata,
+			Content:    content,
+			Score:      vdbutil.CosineSimilarity(queryVector, embeddings),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vdbutil.Rank(documents, queryOptions), nil
+}
@@ -0,0 +1,119 @@
+package sqlvdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// row is a document as read from the database, before decoding.
+type row struct {
+	id           string
+	content      string
+	metadataJSON []byte
+	vectorBytes  []byte
+}
+
+// scoreRows decodes, filters and scores the rows of a full table scan. Rows are streamed from the cursor
+// to GOMAXPROCS workers, so decoding and scoring of large schemas use all cores. The documents are
+// returned unsorted.
+func scoreRows(ctx context.Context, rows *sql.Rows, classname string, queryVector []float32, filter map[string]any) ([]models.Document, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := runtime.GOMAXPROCS(0)
+	jobs := make(chan row, 4*workers)
+	results := make([][]models.Document, workers)
+
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for job := range jobs {
+				document, matches, err := scoreRow(job, classname, queryVector, filter)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				if matches {
+					results[worker] = append(results[worker], document)
+				}
+			}
+		}(worker)
+	}
+
+	for rows.Next() {
+		var job row
+		if err := rows.Scan(&job.id, &job.metadataJSON, &job.vectorBytes, &job.content); err != nil {
+			fail(fmt.Errorf("failed to scan row: %w", err))
+			break
+		}
+
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := rows.Err(); err != nil {
+		fail(err)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var documents []models.Document
+	for _, result := range results {
+		documents = append(documents, result...)
+	}
+	return documents, nil
+}
+
+// scoreRow decodes a row and scores it if its metadata matches the filter.
+func scoreRow(job row, classname string, queryVector []float32, filter map[string]any) (models.Document, bool, error) {
+	var metadata map[string]any
+	if err := json.Unmarshal(job.metadataJSON, &metadata); err != nil {
+		return models.Document{}, false, fmt.Errorf("failed to deserialize metadata: %w", err)
+	}
+	if !vdbutil.MatchesFilter(metadata, filter) {
+		return models.Document{}, false, nil
+	}
+
+	embeddings, err := decodeVector(job.vectorBytes)
+	if err != nil {
+		return models.Document{}, false, fmt.Errorf("failed to deserialize embeddings: %w", err)
+	}
+
+	return models.Document{
+		ID:         job.id,
+		ClassName:  classname,
+		Embeddings: embeddings,
+		Metadata:   metadata,
+		Content:    job.content,
+		Score:      vdbutil.CosineSimilarity(queryVector, embeddings),
+	}, true, nil
+}
@@ -6,22 +6,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
-	"sort"
 	"sync"
 
 	_ "modernc.org/sqlite"
 
+	"github.com/ghmer/aicompanion/impl/hnsw"
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
 	"github.com/ghmer/aicompanion/models"
 )
 
+var _ vectordb.VectorDb = (*SQLiteVectorDb)(nil)
+var _ vectordb.Scanner = (*SQLiteVectorDb)(nil)
+
 // SQLiteVectorDb represents a vector database using SQLite.
 type SQLiteVectorDb struct {
 	db              *sql.DB
 	mutex           sync.RWMutex
 	schemas         map[string]bool
+	dimensions      map[string]int // Dimensions of the embeddings per schema, 0 while unknown
 	dbPath          string
 	normalizeVector bool
+	indexConfig     *hnsw.Config
+	indexes         map[string]*hnsw.Index
 }
 
 // NewSQLiteVectorDb creates a new SQLite vector database instance.
@@ -33,6 +40,7 @@ func NewSQLiteVectorDb(dbPath string, normalize bool) (*SQLiteVectorDb, error) {
 	s := &SQLiteVectorDb{
 		db:              db,
 		schemas:         make(map[string]bool),
+		dimensions:      make(map[string]int),
 		dbPath:          dbPath,
 		normalizeVector: normalize,
 	}
@@ -47,8 +55,7 @@ func NewSQLiteVectorDb(dbPath string, normalize bool) (*SQLiteVectorDb, error) {
 
 // loadSchemas loads all existing schemas from the database.
 func (s *SQLiteVectorDb) loadSchemas(ctx context.Context) error {
-	query := `SELECT name FROM sqlite_master WHERE type='table'`
-	rows, err := s.db.QueryContext(ctx, query)
+	rows, err := s.db.QueryContext(ctx, schemaTablesQuery)
 	if err != nil {
 		return err
 	}
@@ -61,12 +68,64 @@ func (s *SQLiteVectorDb) loadSchemas(ctx context.Context) error {
 		}
 		s.schemas[name] = true
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for name := range s.schemas {
+		if err := s.migrateContent(ctx, name); err != nil {
+			return err
+		}
+		if err := s.migrateFTS(ctx, name); err != nil {
+			return err
+		}
+		if err := s.loadDimensions(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDimensions reads the number of dimensions of a schema from its first document.
+func (s *SQLiteVectorDb) loadDimensions(ctx context.Context, classname string) error {
+	var embeddingBytes []byte
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT embeddings FROM %s LIMIT 1`, classname)).Scan(&embeddingBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	embeddings, err := decodeVector(embeddingBytes)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize embeddings: %w", err)
+	}
+	s.dimensions[classname] = len(embeddings)
+	return nil
+}
+
+// migrateContent adds the content column to schemas created before documents carried content.
+func (s *SQLiteVectorDb) migrateContent(ctx context.Context, classname string) error {
+	var count int
+	query := `SELECT count(*) FROM pragma_table_info(?) WHERE name = 'content'`
+	if err := s.db.QueryRowContext(ctx, query, classname).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN content TEXT NOT NULL DEFAULT ''`, classname)); err != nil {
+		return fmt.Errorf("failed to migrate schema %s: %w", classname, err)
+	}
 	return nil
 }
 
 // schemaExists checks if a schema with the given class name exists in the database.
 func (s *SQLiteVectorDb) schemaExists(ctx context.Context, classname string) (bool, error) {
-	query := `SELECT name FROM sqlite_master WHERE type='table' AND name=?`
+	query := `SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name = ?`
 	var name string
 	err := s.db.QueryRowContext(ctx, query, classname).Scan(&name)
 	if err == sql.ErrNoRows {
@@ -79,16 +138,16 @@ func (s *SQLiteVectorDb) schemaExists(ctx context.Context, classname string) (bo
 }
 
 // GetSchema retrieves the schema for storing documents with the given class name.
-func (s *SQLiteVectorDb) GetSchema(ctx context.Context, classname string) (any, error) {
+func (s *SQLiteVectorDb) GetSchema(ctx context.Context, classname string) (models.Schema, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	if exists, err := s.schemaExists(ctx, classname); err != nil {
-		return nil, err
+		return models.Schema{}, err
 	} else if !exists {
-		return nil, errors.New("schema does not exist")
+		return models.Schema{}, vectordb.ErrSchemaNotExists
 	}
-	return classname, nil
+	return models.Schema{ClassName: classname, Vector: models.VectorConfig{Dimensions: s.dimensions[classname]}}, nil
 }
 
 // GetSchemaClassNames retrieves the class names of all schemas in the database.
@@ -98,8 +157,7 @@ func (s *SQLiteVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
 
 	var result []string
 
-	query := `SELECT name FROM sqlite_master WHERE type='table'`
-	rows, err := s.db.QueryContext(ctx, query)
+	rows, err := s.db.QueryContext(ctx, schemaTablesQuery)
 	if err != nil {
 		return result, err
 	}
@@ -116,27 +174,39 @@ func (s *SQLiteVectorDb) GetSchemas(ctx context.Context) ([]string, error) {
 }
 
 // CreateSchema creates a new schema for storing documents with the given class name.
-func (s *SQLiteVectorDb) CreateSchema(ctx context.Context, classname any) error {
+func (s *SQLiteVectorDb) CreateSchema(ctx context.Context, schema models.Schema) error {
+	if err := vdbutil.ValidateSchema(schema); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	classnameStr := classname.(string)
+	classnameStr := schema.ClassName
 	if exists, err := s.schemaExists(ctx, classnameStr); err != nil {
 		return err
 	} else if exists {
-		return errors.New("schema already exists")
+		return vectordb.ErrSchemaExists
 	}
 
 	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 		id TEXT PRIMARY KEY,
 		metadata BLOB,
-		embeddings BLOB
+		embeddings BLOB,
+		content TEXT NOT NULL DEFAULT ''
 	)`, classnameStr)
 	if _, err := s.db.ExecContext(ctx, query); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
+	if err := createFTS(ctx, s.db, classnameStr); err != nil {
+		return err
+	}
 
 	s.schemas[classnameStr] = true
+	s.dimensions[classnameStr] = schema.Vector.Dimensions
+	if s.indexConfig != nil {
+		s.indexes[classnameStr] = hnsw.New(*s.indexConfig)
+	}
 	return nil
 }
 
@@ -146,15 +216,18 @@ func (s *SQLiteVectorDb) DeleteSchema(ctx context.Context, classname string) err
 	defer s.mutex.Unlock()
 
 	if _, exists := s.schemas[classname]; !exists {
-		return errors.New("schema does not exist")
+		return vectordb.ErrSchemaNotExists
 	}
 
-	query := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, classname)
-	if _, err := s.db.ExecContext(ctx, query); err != nil {
-		return fmt.Errorf("failed to delete schema: %w", err)
+	for _, table := range []string{classname, ftsTable(classname)} {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table)); err != nil {
+			return fmt.Errorf("failed to delete schema: %w", err)
+		}
 	}
 
 	delete(s.schemas, classname)
+	delete(s.dimensions, classname)
+	delete(s.indexes, classname)
 	return nil
 }
 
@@ -169,37 +242,62 @@ func (s *SQLiteVectorDb) DeleteSchemas(ctx context.Context, classname []string)
 
 // AddDocument adds a document with the given class name and ID to the database.
 func (s *SQLiteVectorDb) AddDocument(ctx context.Context, classname, id string, document models.Document) error {
+	document.ID = id
+	return s.AddDocuments(ctx, classname, []models.Document{document})
+}
+
+// AddDocuments adds multiple documents to the database. All documents are inserted in a single
+// transaction with a prepared statement; if one fails, none are added.
+func (s *SQLiteVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	if _, exists := s.schemas[classname]; !exists {
-		return errors.New("schema does not exist")
+		return vectordb.ErrSchemaNotExists
 	}
 
-	normalizedVector := s.NormalizeVector(document.Embeddings)
-	vectorBytes, err := json.Marshal(normalizedVector)
+	dimensions, err := vdbutil.CheckDimensions(s.dimensions[classname], documents)
 	if err != nil {
-		return fmt.Errorf("failed to serialize vector: %w", err)
+		return err
 	}
 
-	metadataBytes, err := json.Marshal(document.Metadata)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to serialize metadata: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	query := fmt.Sprintf(`INSERT OR REPLACE INTO %s (id, metadata, embeddings) VALUES (?, ?, ?)`, classname)
-	if _, err := s.db.ExecContext(ctx, query, id, metadataBytes, vectorBytes); err != nil {
-		return fmt.Errorf("failed to add document: %w", err)
+	query := fmt.Sprintf(`INSERT OR REPLACE INTO %s (id, metadata, embeddings, content) VALUES (?, ?, ?, ?)`, classname)
+	statement, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
+	defer statement.Close()
 
-	return nil
-}
+	for _, document := range documents {
+		vectorBytes := encodeVector(s.NormalizeVector(document.Embeddings))
 
-// AddDocuments adds multiple documents to the database.
-func (s *SQLiteVectorDb) AddDocuments(ctx context.Context, classname string, documents []models.Document) error {
-	for _, doc := range documents {
-		if err := s.AddDocument(ctx, classname, doc.ID, doc); err != nil {
-			return err
+		metadataBytes, err := json.Marshal(document.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metadata: %w", err)
+		}
+
+		if _, err := statement.ExecContext(ctx, document.ID, metadataBytes, vectorBytes, document.Content); err != nil {
+			return fmt.Errorf("failed to add document %s: %w", document.ID, err)
+		}
+	}
+	if err := indexDocuments(ctx, tx, classname, documents); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit documents: %w", err)
+	}
+	s.dimensions[classname] = dimensions
+
+	if index, exists := s.indexes[classname]; exists {
+		for _, document := range documents {
+			index.Add(document.ID, document.Embeddings)
 		}
 	}
 	return nil
@@ -210,15 +308,9 @@ func (s *SQLiteVectorDb) UpdateDocument(ctx context.Context, classname, id strin
 	return s.AddDocument(ctx, classname, id, document)
 }
 
-// UpdateDocuments updates a document with the given class name and ID in the database.
+// UpdateDocuments updates multiple documents in the database in a single transaction.
 func (s *SQLiteVectorDb) UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error {
-	for _, document := range documents {
-		err := s.AddDocument(ctx, classname, document.ID, document)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return s.AddDocuments(ctx, classname, documents)
 }
 
 // QueryDocuments queries documents based on a vector and QueryOptions
@@ -227,160 +319,170 @@ func (s *SQLiteVectorDb) QueryDocuments(ctx context.Context, classname string, v
 	defer s.mutex.RUnlock()
 
 	if _, exists := s.schemas[classname]; !exists {
-		return nil, errors.New("schema does not exist")
+		return nil, vectordb.ErrSchemaNotExists
+	}
+	if err := vdbutil.CheckVector(s.dimensions[classname], vector); err != nil {
+		return nil, err
+	}
+
+	// hybrid queries need every document for keyword scoring
+	if index, exists := s.indexes[classname]; exists && queryOptions.Limit > 0 && queryOptions.Hybrid == nil {
+		return s.queryIndex(ctx, index, classname, vector, queryOptions)
 	}
 
-	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, metadata, embeddings FROM %s`, classname))
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, metadata, embeddings, content FROM %s`, classname))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query documents: %w", err)
 	}
 	defer rows.Close()
 
-	results := []struct {
-		ID    string
-		Score float64
-		Data  models.Document
-	}{}
+	documents, err := scoreRows(ctx, rows, classname, s.NormalizeVector(append([]float32(nil), vector...)), queryOptions.Filter)
+	if err != nil {
+		return nil, err
+	}
+	return vdbutil.Rank(documents, queryOptions), nil
+}
+
+// GetDocument retrieves a document by its ID.
+func (s *SQLiteVectorDb) GetDocument(ctx context.Context, classname, id string) (models.Document, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	queryVector := s.NormalizeVector(vector)
+	if _, exists := s.schemas[classname]; !exists {
+		return models.Document{}, vectordb.ErrSchemaNotExists
+	}
 
-	for rows.Next() {
-		var id string
-		var metadataJSON []byte
-		var embeddingBytes []byte
-		if err := rows.Scan(&id, &metadataJSON, &embeddingBytes); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
+	var content string
+	var metadataJSON, embeddingBytes []byte
+	query := fmt.Sprintf(`SELECT metadata, embeddings, content FROM %s WHERE id = ?`, classname)
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&metadataJSON, &embeddingBytes, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Document{}, vectordb.ErrDocumentNotExists
+	}
+	if err != nil {
+		return models.Document{}, fmt.Errorf("failed to get document: %w", err)
+	}
 
-		var embeddings []float32
-		if err := json.Unmarshal(embeddingBytes, &embeddings); err != nil {
-			return nil, fmt.Errorf("failed to deserialize embeddings: %w", err)
-		}
+	embeddings, err := decodeVector(embeddingBytes)
+	if err != nil {
+		return models.Document{}, fmt.Errorf("failed to deserialize embeddings: %w", err)
+	}
 
-		var metadata map[string]any
-		if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
-			return nil, fmt.Errorf("failed to deserialize metadata: %w", err)
-		}
+	var metadata map[string]any
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		return models.Document{}, fmt.Errorf("failed to deserialize metadata: %w", err)
+	}
 
-		if queryOptions.Filter == nil || matchesFilter(metadata, queryOptions.Filter) {
-			score := cosineSimilarity(queryVector, embeddings)
-			results = append(results, struct {
-				ID    string
-				Score float64
-				Data  models.Document
-			}{ID: id, Score: score, Data: models.Document{
-				ID:         id,
-				ClassName:  classname,
-				Embeddings: embeddings,
-				Metadata:   metadata,
-				Score:      score,
-			}})
-		}
+	return models.Document{
+		ID:         id,
+		ClassName:  classname,
+		Embeddings: embeddings,
+		Metadata:   metadata,
+		Content:    content,
+	}, nil
+}
+
+// ListDocuments lists the documents of a schema in ascending ID order.
+func (s *SQLiteVectorDb) ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	return vdbutil.List(ctx, s, classname, listOptions)
+}
+
+// ScanDocuments implements vectordb.Scanner.
+func (s *SQLiteVectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.schemas[classname]; !exists {
+		return vectordb.ErrSchemaNotExists
 	}
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, metadata, embeddings, content FROM %s WHERE id > ? ORDER BY id`, classname), after)
+	if err != nil {
+		return fmt.Errorf("failed to scan documents: %w", err)
+	}
+	defer rows.Close()
 
-	fmt.Println("size of sort", len(results))
-	fmt.Println("queryOptions", queryOptions)
+	for rows.Next() {
+		var id, content string
+		var metadataJSON, embeddingBytes []byte
+		if err := rows.Scan(&id, &metadataJSON, &embeddingBytes, &content); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
 
-	output := []models.Document{}
-	for _, doc := range results {
-		fmt.Println("score", doc.Score)
-		if queryOptions.SimilarityThreshold > 0 {
-			if doc.Score >= queryOptions.SimilarityThreshold {
-				output = append(output, doc.Data)
-			}
-		} else {
-			output = append(output, doc.Data)
+		embeddings, err := decodeVector(embeddingBytes)
+		if err != nil {
+			return fmt.Errorf("failed to deserialize embeddings: %w", err)
 		}
-	}
 
-	if queryOptions.Limit > 0 {
-		if len(output) > queryOptions.Limit {
-			output = output[:queryOptions.Limit]
+		var metadata map[string]any
+		if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+			return fmt.Errorf("failed to deserialize metadata: %w", err)
 		}
-	}
 
-	return output, nil
+		if err := fn(models.Document{
+			ID:         id,
+			ClassName:  classname,
+			Embeddings: embeddings,
+			Metadata:   metadata,
+			Content:    content,
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 // DeleteDocument deletes a document from the database.
 func (s *SQLiteVectorDb) DeleteDocument(ctx context.Context, classname, id string) error {
+	return s.DeleteDocuments(ctx, classname, []string{id})
+}
+
+// DeleteDocuments deletes multiple documents from the database in a single transaction.
+func (s *SQLiteVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	if _, exists := s.schemas[classname]; !exists {
-		return errors.New("schema does not exist")
+		return vectordb.ErrSchemaNotExists
 	}
 
-	query := fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, classname)
-	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
-		return fmt.Errorf("failed to delete document: %w", err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
-}
-
-// DeleteDocuments deletes multiple documents from the database.
-func (s *SQLiteVectorDb) DeleteDocuments(ctx context.Context, classname string, ids []string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if _, exists := s.schemas[classname]; !exists {
-		return errors.New("schema does not exist")
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, classname))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
+	defer statement.Close()
 
-	query := fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, classname)
 	for _, id := range ids {
-		if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		if _, err := statement.ExecContext(ctx, id); err != nil {
 			return fmt.Errorf("failed to delete document %s: %w", id, err)
 		}
 	}
-	return nil
-}
-
-// NormalizeVector normalizes a vector if required.
-func (s *SQLiteVectorDb) NormalizeVector(vector []float32) []float32 {
-	if !s.normalizeVector {
-		return vector
+	if err := unindexDocuments(ctx, tx, classname, ids); err != nil {
+		return err
 	}
 
-	var magnitude float64
-	for _, v := range vector {
-		magnitude += float64(v * v)
-	}
-	if magnitude == 0 {
-		return vector
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit deletion: %w", err)
 	}
-	magnitude = math.Sqrt(magnitude)
-	for i := range vector {
-		vector[i] /= float32(magnitude)
-	}
-	return vector
-}
 
-// matchesFilter checks if the metadata matches the filter.
-func matchesFilter(metadata, filter map[string]any) bool {
-	for k, v := range filter {
-		if metadata[k] != v {
-			return false
+	if index, exists := s.indexes[classname]; exists {
+		for _, id := range ids {
+			index.Delete(id)
 		}
 	}
-	return true
+	return nil
 }
 
-// cosineSimilarity calculates the cosine similarity between two vectors.
-func cosineSimilarity(v1, v2 []float32) float64 {
-	var dotProduct, mag1, mag2 float64
-	for i := range v1 {
-		dotProduct += float64(v1[i] * v2[i])
-		mag1 += float64(v1[i] * v1[i])
-		mag2 += float64(v2[i] * v2[i])
-	}
-	if mag1 == 0 || mag2 == 0 {
-		return 0
+// NormalizeVector normalizes a vector if required.
+func (s *SQLiteVectorDb) NormalizeVector(vector []float32) []float32 {
+	if !s.normalizeVector {
+		return vector
 	}
-	return dotProduct / (math.Sqrt(mag1) * math.Sqrt(mag2))
+	return vdbutil.Normalize(vector)
 }
@@ -0,0 +1,316 @@
+package sqlvdb_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/hnsw"
+	"github.com/ghmer/aicompanion/impl/sqlvdb"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func newDb(t *testing.T) *sqlvdb.SQLiteVectorDb {
+	t.Helper()
+	db, err := sqlvdb.NewSQLiteVectorDb(filepath.Join(t.TempDir(), "vectors.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateSchema(context.Background(), models.Schema{ClassName: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAddDocumentsBatch(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+
+	documents := make([]models.Document, 2000)
+	for i := range documents {
+		documents[i] = models.Document{
+			ID:         fmt.Sprintf("doc-%d", i),
+			Embeddings: []float32{float32(i), 1},
+			Metadata:   map[string]any{"index": float64(i)},
+		}
+	}
+	if err := db.AddDocuments(ctx, "docs", documents); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", []float32{0, 1}, models.VectorDBQueryOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "doc-0" {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	ids := make([]string, 0, len(documents)-1)
+	for _, document := range documents[1:] {
+		ids = append(ids, document.ID)
+	}
+	if err := db.DeleteDocuments(ctx, "docs", ids); err != nil {
+		t.Fatal(err)
+	}
+	results, _ = db.QueryDocuments(ctx, "docs", []float32{0, 1}, models.VectorDBQueryOptions{})
+	if len(results) != 1 {
+		t.Errorf("expected 1 remaining document, got %d", len(results))
+	}
+}
+
+func TestAddDocumentsMissingSchema(t *testing.T) {
+	db := newDb(t)
+	if err := db.AddDocuments(context.Background(), "missing", []models.Document{{ID: "a"}}); err == nil {
+		t.Error("expected error for missing schema")
+	}
+}
+
+func TestIndexedQuery(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+
+	documents := make([]models.Document, 500)
+	for i := range documents {
+		documents[i] = models.Document{
+			ID:         fmt.Sprintf("doc-%d", i),
+			Embeddings: []float32{float32(i % 50), float32(i / 50), 1},
+			Metadata:   map[string]any{"even": i%2 == 0},
+		}
+	}
+	if err := db.AddDocuments(ctx, "docs", documents[:250]); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableIndex(ctx, hnsw.Config{Seed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddDocuments(ctx, "docs", documents[250:]); err != nil {
+		t.Fatal(err)
+	}
+
+	query := []float32{3, 7, 1}
+	exact, err := db.QueryDocuments(ctx, "docs", query, models.VectorDBQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexed, err := db.QueryDocuments(ctx, "docs", query, models.VectorDBQueryOptions{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 5 || indexed[0].ID != exact[0].ID {
+		t.Errorf("indexed query returned %+v, expected %s first", indexed, exact[0].ID)
+	}
+
+	if err := db.DeleteDocument(ctx, "docs", exact[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := db.QueryDocuments(ctx, "docs", query, models.VectorDBQueryOptions{Limit: 3, Filter: map[string]any{"even": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, document := range filtered {
+		if document.ID == exact[0].ID || document.Metadata["even"] != true {
+			t.Errorf("unexpected document %+v", document)
+		}
+	}
+}
+
+func TestDocumentContent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vectors.db")
+
+	// a schema created before documents carried content
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`CREATE TABLE docs (id TEXT PRIMARY KEY, metadata BLOB, embeddings BLOB)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`INSERT INTO docs VALUES ('old', '{}', '[1,0]')`); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	db, err := sqlvdb.NewSQLiteVectorDb(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddDocument(ctx, "docs", "new", models.Document{Embeddings: []float32{0, 1}, Content: "hello world"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", []float32{0, 1}, models.VectorDBQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Content != "hello world" || results[1].Content != "" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestCreateSchemaDistance(t *testing.T) {
+	db := newDb(t)
+	schema := models.Schema{ClassName: "dot", Vector: models.VectorConfig{Distance: models.DistanceDotProduct}}
+	if err := db.CreateSchema(context.Background(), schema); err == nil {
+		t.Error("expected an error for an unsupported distance")
+	}
+
+	schema.Vector.Distance = models.DistanceCosine
+	if err := db.CreateSchema(context.Background(), schema); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.GetSchema(context.Background(), "dot"); err != nil || got.ClassName != "dot" {
+		t.Errorf("unexpected schema %+v, %v", got, err)
+	}
+}
+
+func TestDimensionsAfterReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	db, _ := sqlvdb.NewSQLiteVectorDb(path, false)
+	db.CreateSchema(ctx, models.Schema{ClassName: "docs"})
+	if err := db.AddDocument(ctx, "docs", "a", models.Document{Embeddings: []float32{1, 0, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := sqlvdb.NewSQLiteVectorDb(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reopened.AddDocument(ctx, "docs", "b", models.Document{Embeddings: []float32{1, 0}})
+	if !errors.Is(err, vectordb.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+	if _, err := reopened.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{}); !errors.Is(err, vectordb.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+}
+
+func TestBinaryEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	db, _ := sqlvdb.NewSQLiteVectorDb(path, false)
+	db.CreateSchema(ctx, models.Schema{ClassName: "docs"})
+	vector := []float32{0.25, -1.5, 3}
+	if err := db.AddDocument(ctx, "docs", "a", models.Document{Embeddings: vector}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	var size int
+	if err := raw.QueryRow(`SELECT length(embeddings) FROM docs`).Scan(&size); err != nil {
+		t.Fatal(err)
+	}
+	if size != 1+4*len(vector) {
+		t.Errorf("expected %d bytes, got %d", 1+4*len(vector), size)
+	}
+
+	document, err := db.GetDocument(ctx, "docs", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range vector {
+		if document.Embeddings[i] != vector[i] {
+			t.Fatalf("expected %v, got %v", vector, document.Embeddings)
+		}
+	}
+}
+
+func TestParallelScoring(t *testing.T) {
+	ctx := context.Background()
+	db := newDb(t)
+
+	documents := make([]models.Document, 1000)
+	for i := range documents {
+		documents[i] = models.Document{
+			ID:         fmt.Sprintf("doc-%d", i),
+			Embeddings: []float32{1, float32(i) / 1000},
+			Metadata:   map[string]any{"even": i%2 == 0},
+		}
+	}
+	if err := db.AddDocuments(ctx, "docs", documents); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Filter: map[string]any{"even": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 500 || results[0].ID != "doc-0" {
+		t.Fatalf("unexpected results: %d, first %+v", len(results), results[0])
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Fatalf("results not sorted at %d", i)
+		}
+	}
+}
+
+func TestSearchDocuments(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vectors.db")
+
+	// a schema created before documents were indexed
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`CREATE TABLE docs (id TEXT PRIMARY KEY, metadata BLOB, embeddings BLOB, content TEXT NOT NULL DEFAULT '')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`INSERT INTO docs VALUES ('old', '{"topic":"gardening"}', '[1,0]', 'roses need sun')`); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	db, err := sqlvdb.NewSQLiteVectorDb(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schemas, _ := db.GetSchemas(ctx); len(schemas) != 1 || schemas[0] != "docs" {
+		t.Errorf("expected the index to be hidden, got schemas %v", schemas)
+	}
+
+	documents := []models.Document{
+		{ID: "a", Embeddings: []float32{0, 1}, Content: "the sun rises in the east", Metadata: map[string]any{"lang": "en"}},
+		{ID: "b", Embeddings: []float32{0, 1}, Content: "the moon and the sun", Metadata: map[string]any{"lang": "de"}},
+	}
+	if err := db.AddDocuments(ctx, "docs", documents); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.SearchDocuments(ctx, "docs", "Sun?", models.VectorDBQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	results, _ = db.SearchDocuments(ctx, "docs", "gardening", models.VectorDBQueryOptions{})
+	if len(results) != 1 || results[0].ID != "old" {
+		t.Errorf("expected a match on metadata, got %+v", results)
+	}
+
+	results, _ = db.SearchDocuments(ctx, "docs", "sun", models.VectorDBQueryOptions{Filter: map[string]any{"lang": "de"}})
+	if len(results) != 1 || results[0].ID != "b" {
+		t.Errorf("expected the filtered document, got %+v", results)
+	}
+
+	db.DeleteDocument(ctx, "docs", "a")
+	documents[1].Content = "stars at night"
+	db.UpdateDocument(ctx, "docs", "b", documents[1])
+	if results, _ := db.SearchDocuments(ctx, "docs", "sun", models.VectorDBQueryOptions{}); len(results) != 1 || results[0].ID != "old" {
+		t.Errorf("expected deleted and updated documents to leave the index, got %+v", results)
+	}
+}
@@ -0,0 +1,668 @@
+package tgi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/terminal"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// DefaultMaxNewTokens limits the length of generated responses if no limit is set.
+const DefaultMaxNewTokens = 1024
+
+// ChatTemplate renders a list of messages into a single prompt for the /generate endpoint.
+type ChatTemplate func(messages []models.Message) string
+
+// ChatML renders messages in the ChatML format understood by most instruction tuned models. Tool calls
+// and their results are wrapped in <tool_call> and <tool_response> tags, as expected by models trained
+// on tool use in ChatML.
+func ChatML(messages []models.Message) string {
+	var prompt strings.Builder
+	for _, message := range messages {
+		if message.Role == models.System && message.Content == "" {
+			continue
+		}
+		content := message.Content
+		for _, toolCall := range message.ToolCalls {
+			call, _ := json.Marshal(map[string]any{"name": toolCall.Payload.FunctionName, "arguments": toolCall.Payload.Arguments})
+			content += fmt.Sprintf("\n<tool_call>\n%s\n</tool_call>", call)
+		}
+		if message.Role == models.ToolRole {
+			content = fmt.Sprintf("<tool_response>\n%s\n</tool_response>", content)
+		}
+		fmt.Fprintf(&prompt, "<|im_start|>%s\n%s<|im_end|>\n", message.Role, strings.TrimPrefix(content, "\n"))
+	}
+	prompt.WriteString("<|im_start|>assistant\n")
+	return prompt.String()
+}
+
+// Companion represents the AI companion with its configuration, conversation history, and HTTP client.
+type Companion struct {
+	Config       models.Configuration
+	SystemRole   models.Message
+	Conversation []models.Message
+	HttpClient   *http.Client
+	VectorDb     vectordb.VectorDb          // Source of the context of RAG requests
+	Sessions     conversationstore.Sessions // Named conversations, see SwitchSession
+	ToolRegistry *tools.Registry            // Tools implemented by Go functions, run before Tool endpoints
+	ToolBreakers sidekick.CircuitBreakers   // Circuit breakers of the tools, see models.ToolConfiguration
+	Usage        sidekick.UsageCounter      // Tokens of the responses, see GetUsage
+	OnToolCall   models.ToolCallHook        // Asked before a tool is run, if set
+	// Template renders the conversation into a prompt, defaults to ChatML.
+	Template ChatTemplate
+	// Stop sequences end the generation, defaults to the ChatML end token.
+	Stop []string
+	// MaxNewTokens limits the length of a response, defaults to DefaultMaxNewTokens.
+	MaxNewTokens int
+}
+
+// SetEnrichmentPrompt sets a new enrichment prompt for the companion.
+func (companion *Companion) SetEnrichmentPrompt(enrichmentprompt string) {
+	companion.Config.ActivePersona.Prompt.EnrichmentPrompt = enrichmentprompt
+}
+
+// GetEnrichmentPrompt returns the current enrichment prompt of the companion.
+func (companion *Companion) GetEnrichmentPrompt() string {
+	return companion.Config.ActivePersona.Prompt.EnrichmentPrompt
+}
+
+// SetSummarizationPrompt sets a new summarization prompt for the companion.
+func (companion *Companion) SetSummarizationPrompt(summarizationprompt string) {
+	companion.Config.ActivePersona.Prompt.SummarizationPrompt = summarizationprompt
+}
+
+// GetSummarizationPrompt returns the current summarization prompt of the companion.
+func (companion *Companion) GetSummarizationPrompt() string {
+	return companion.Config.ActivePersona.Prompt.SummarizationPrompt
+}
+
+// GetConfig returns the current configuration of the companion.
+func (companion *Companion) GetConfig() models.Configuration {
+	return companion.Config
+}
+
+// SetConfig sets a new configuration for the companion.
+func (companion *Companion) SetConfig(config models.Configuration) {
+	companion.Config = config
+	companion.SetSystemRole(config.ActivePersona.Prompt.SystemPrompt)
+}
+
+// GetSystemRole returns the current system role of the companion.
+func (companion *Companion) GetSystemRole() models.Message {
+	return companion.SystemRole
+}
+
+// SetSystemRole sets a new system role for the companion.
+func (companion *Companion) SetSystemRole(prompt string) {
+	companion.SystemRole = models.Message{
+		Role:    models.System,
+		Content: prompt,
+	}
+}
+
+// GetConversation returns the current conversation history of the companion.
+func (companion *Companion) GetConversation() []models.Message {
+	return companion.Conversation
+}
+
+// SetConversation sets a new conversation history for the companion.
+func (companion *Companion) SetConversation(conversation []models.Message) {
+	companion.Conversation = conversation
+}
+
+// PinMessage pins or unpins the message of the conversation at index. Pinned messages are always sent
+// along with requests, regardless of Config.MaxMessages and Config.MaxContextTokens.
+func (companion *Companion) PinMessage(index int, pinned bool) error {
+	return sideKick.PinMessage(companion.Conversation, index, pinned)
+}
+
+// PinMessageByID pins or unpins the message of the conversation with the given ID.
+func (companion *Companion) PinMessageByID(id string, pinned bool) error {
+	return sideKick.PinMessageByID(companion.Conversation, id, pinned)
+}
+
+// RemoveLastExchange removes the last user message and all messages following it, such as the reply and
+// tool results, and returns them. It rolls back a turn that was aborted or failed, e.g. by a stream that
+// errored mid-way. A conversation without user messages is left unchanged.
+func (companion *Companion) RemoveLastExchange() []models.Message {
+	var removed []models.Message
+	companion.Conversation, removed = sideKick.RemoveLastExchange(companion.Conversation)
+	return removed
+}
+
+// TruncateAfter removes the messages following index from the conversation. An index of -1 removes all
+// messages.
+func (companion *Companion) TruncateAfter(index int) error {
+	conversation, err := sideKick.TruncateAfter(companion.Conversation, index)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ExportConversation writes the conversation as transcript in the given format. Images of Markdown
+// transcripts are written to Config.ImageDir. The transcript is encrypted if Config.EncryptionKey is set.
+func (companion *Companion) ExportConversation(w io.Writer, format models.ConversationFormat) error {
+	return sideKick.ExportConversation(w, companion.Conversation, format, companion.Config.ImageDir, companion.Config.EncryptionKey)
+}
+
+// ImportConversation replaces the conversation with a JSON or Markdown transcript, which is decrypted
+// with Config.EncryptionKey if it is encrypted.
+func (companion *Companion) ImportConversation(r io.Reader) error {
+	conversation, err := sideKick.ImportConversation(r, companion.Config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// SetConversationStore sets the store keeping the conversations of the sessions that are not current.
+func (companion *Companion) SetConversationStore(store conversationstore.Store) {
+	companion.Sessions.Store = store
+}
+
+// CurrentSession returns the name of the current session.
+func (companion *Companion) CurrentSession() string {
+	return companion.Sessions.Current()
+}
+
+// SwitchSession saves the conversation under the current session and continues the named session.
+func (companion *Companion) SwitchSession(name string) error {
+	conversation, err := companion.Sessions.Switch(name, companion.Conversation)
+	if err != nil {
+		return err
+	}
+	companion.Conversation = conversation
+	return nil
+}
+
+// ListSessions returns the names of all sessions.
+func (companion *Companion) ListSessions() ([]string, error) {
+	return companion.Sessions.List()
+}
+
+// SearchSessions saves the conversation under the current session and searches the messages of all
+// sessions. The conversation store has to implement conversationstore.Searcher.
+func (companion *Companion) SearchSessions(query string, limit int) ([]conversationstore.SearchResult, error) {
+	return companion.Sessions.Search(companion.Conversation, query, limit)
+}
+
+// DeleteSession deletes the named session. Deleting the current session clears the conversation.
+func (companion *Companion) DeleteSession(name string) error {
+	current, err := companion.Sessions.Delete(name)
+	if err != nil {
+		return err
+	}
+	if current {
+		companion.Conversation = make([]models.Message, 0)
+	}
+	return nil
+}
+
+// GetUsage returns the tokens of the responses of the companion, in total, per session and per model.
+func (companion *Companion) GetUsage() models.UsageReport {
+	return companion.Usage.Report()
+}
+
+// recordUsage adds the usage of a response to the current session and sets its estimated cost.
+func (companion *Companion) recordUsage(response *models.Message) {
+	model := response.Model
+	if model == "" {
+		model = companion.Config.AiModels.ChatModel.Model
+	}
+	response.Cost = sidekick.CostEstimator{Pricing: companion.Config.Pricing}.Estimate(model, response.Usage)
+	companion.Usage.Record(companion.Sessions.Current(), model, response.Usage, response.Cost)
+}
+
+// GetHttpClient returns the HTTP client used by the companion.
+func (companion *Companion) GetHttpClient() *http.Client {
+	return companion.HttpClient
+}
+
+// SetHttpClient sets a new HTTP client for the companion.
+func (companion *Companion) SetHttpClient(client *http.Client) {
+	companion.HttpClient = client
+}
+
+// SetVectorDB sets the vector database used by SendRAGRequest.
+func (companion *Companion) SetVectorDB(vectorDb vectordb.VectorDb) {
+	companion.VectorDb = vectorDb
+}
+
+// GetVectorDB returns the vector database used by SendRAGRequest.
+func (companion *Companion) GetVectorDB() vectordb.VectorDb {
+	return companion.VectorDb
+}
+
+// PrepareConversation prepares the conversation by appending system role and current conversation messages.
+func (companion *Companion) PrepareConversation(message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	return companion.prepareConversation(context.Background(), message, includeStrategy)
+}
+
+// prepareConversation is PrepareConversation for a request, which cancels summarizing the history with ctx.
+func (companion *Companion) prepareConversation(ctx context.Context, message models.Message, includeStrategy models.IncludeStrategy) []models.Message {
+	systemRole := companion.SystemRole
+	history := sideKick.SelectContext(companion.Config.ContextStrategy, sidekick.ContextRequest{
+		Context:         ctx,
+		Conversation:    companion.Conversation,
+		IncludeStrategy: includeStrategy,
+		MaxMessages:     companion.Config.MaxMessages,
+		MaxTokens:       companion.Config.MaxContextTokens,
+		Reserved:        []models.Message{systemRole, message},
+		Summarize:       sideKick.NewSummarizer(companion.SendGenerateRequest),
+	})
+
+	messages := append([]models.Message{systemRole}, history...)
+	messages = append(messages, message)
+
+	return messages
+}
+
+// AddMessage adds the given message to the conversation history.
+func (companion *Companion) AddMessage(message models.Message) {
+	companion.Conversation = append(companion.Conversation, sideKick.StampMessage(message))
+}
+
+// SendModerationRequest is not supported by TGI.
+func (companion *Companion) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+	return models.ModerationResponse{}, errors.New("unsupported")
+}
+
+// SendEmbeddingRequest is not supported by TGI.
+func (companion *Companion) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+	return models.EmbeddingResponse{}, errors.New("unsupported")
+}
+
+// SendToolRequest is not supported by TGI.
+func (companion *Companion) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	return models.Message{}, errors.New("unsupported")
+}
+
+// SendGenerateRequest sends a single message without conversation history, using the alternate prompt
+// as system prompt if set, and else the system prompt or persona of the request.
+func (companion *Companion) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	system, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	if len(message.Message.AlternatePrompt) > 0 {
+		system = sideKick.CreateMessage(models.System, message.Message.AlternatePrompt)
+	}
+
+	return companion.generate(ctx, []models.Message{system, message.Message}, streaming, models.Generate, callback)
+}
+
+// SendRAGRequest retrieves documents matching the message from the vector database, adds them as context
+// using the enrichment prompt and sends the result as chat request. The conversation keeps the original message.
+func (companion *Companion) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request, err := sideKick.PrepareRAGRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message, options)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	return companion.SendChatRequest(ctx, request, streaming, callback)
+}
+
+// SendChatRequest sends the message along with the conversation history and adds the exchange to the conversation.
+func (companion *Companion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	if companion.Config.Moderation.Enabled {
+		err := errors.New("moderation is not supported by tgi")
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	if companion.Config.ActivePersona.UseKnowledge {
+		enriched, err := sideKick.PrepareKnowledgeRequest(ctx, companion.VectorDb, companion.SendEmbeddingRequest, companion.Config, message)
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		message = enriched
+	}
+
+	// the system prompt or persona of the request replaces the system role for this request only
+	systemRole, err := sidekick.SystemRole(companion.Config, message, companion.GetSystemRole())
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	messages := companion.prepareConversation(ctx, message.Message, companion.Config.IncludeStrategy)
+	messages[0] = systemRole
+	result, err := companion.generate(ctx, messages, streaming, models.Chat, callback)
+	if err != nil {
+		return result, err
+	}
+
+	switch message.RetainOriginalMessage {
+	case true:
+		companion.AddMessage(message.OriginalMessage)
+	case false:
+		companion.AddMessage(message.Message)
+	}
+	companion.AddMessage(result)
+
+	return result, nil
+}
+
+// generate renders the messages into a prompt and sends it to /generate, or /generate_stream when streaming.
+func (companion *Companion) generate(ctx context.Context, messages []models.Message, streaming bool, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+	template := companion.Template
+	stop := companion.Stop
+	if template == nil {
+		template = ChatML
+		if stop == nil {
+			stop = []string{"<|im_end|>"}
+		}
+	}
+	maxNewTokens := companion.MaxNewTokens
+	if maxNewTokens <= 0 {
+		maxNewTokens = DefaultMaxNewTokens
+	}
+
+	url := companion.Config.ApiEndpoints.ApiChatURL
+	if streamType == models.Generate {
+		url = companion.Config.ApiEndpoints.ApiGenerateURL
+	}
+	if streaming {
+		url = StreamURL(url)
+	}
+
+	payload := GenerateRequest{
+		Inputs: template(messages),
+		Parameters: Parameters{
+			MaxNewTokens: maxNewTokens,
+			Stop:         stop,
+			Details:      true,
+		},
+		Stream: streaming,
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	sideKick.Trace(fmt.Sprintf("generate: payloadBytes: %s", string(payloadBytes)), companion.Config.Terminal)
+
+	var spinnerCtx context.Context
+	var cancel context.CancelFunc
+	if companion.Config.Terminal.Output && !streaming {
+		spinnerCtx, cancel = context.WithCancel(ctx)
+		cs := terminal.NewSpinningCharacter('?', 100, 10)
+		cs.StartSpinning(spinnerCtx)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if companion.Config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	}
+
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	sideKick.Debug(fmt.Sprintf("generate: StatusCode %d, Status %s", resp.StatusCode, resp.Status), companion.Config.Terminal)
+
+	if streaming {
+		result, err := companion.HandleStreamResponse(ctx, resp, streamType, callback)
+		if err == nil {
+			companion.recordUsage(&result)
+		}
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if companion.Config.Terminal.Output {
+		cancel()
+		sideKick.ClearLine(companion.Config.Terminal)
+	}
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+	sideKick.Trace(fmt.Sprintf("generate: responseBytes: %s", string(responseBytes)), companion.Config.Terminal)
+
+	var response GenerateResponse
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	result := sideKick.CreateAssistantMessage(trimStop(response.GeneratedText, stop))
+	result.Usage = response.Details.usage()
+	result.FinishReason = response.Details.finishReason()
+	companion.recordUsage(&result)
+	sideKick.Println(result.Content, companion.Config.Terminal)
+	return result, nil
+}
+
+// HandleStreamResponse maps the token events of /generate_stream to the callback. Special tokens, such as
+// the end of sequence token, are not passed on; the last chunk carries the usage and finish reason. If the stream is cancelled, by ctx or an error of callback,
+// the message received until then is returned with Cancelled set.
+func (companion *Companion) HandleStreamResponse(ctx context.Context, resp *http.Response, streamType models.StreamType, callback func(m models.Message) error) (models.Message, error) {
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return models.Message{}, err
+	}
+
+	var message strings.Builder
+	var details *Details
+	var pending *models.Message // last token, passed on with the details of the generation
+
+	// partial returns the message received until the stream was cancelled
+	partial := func() models.Message {
+		cancelled := sideKick.CreateAssistantMessage(message.String())
+		cancelled.Cancelled = true
+		return cancelled
+	}
+
+	sideKick.Print("> ", companion.Config.Terminal)
+
+	decoder := sidekick.NewSSEDecoderSize(resp.Body, companion.Config.HttpConfig.MaxLineSize)
+	for {
+		// stop reading once the request is cancelled
+		if err := ctx.Err(); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+		frame, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && ctx.Err() != nil {
+			sideKick.Error(ctx.Err())
+			return partial(), ctx.Err()
+		}
+		if err != nil {
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+		sideKick.Trace(fmt.Sprintf("HandleStreamResponse: event %s: %s", frame.Event, frame.Data), companion.Config.Terminal)
+		data := []byte(frame.Data)
+
+		var errorResponse ErrorResponse
+		if json.Unmarshal(data, &errorResponse) == nil && errorResponse.Error != "" {
+			err := sidekick.ClassifyProviderError(&models.ProviderError{Code: errorResponse.ErrorType, Message: errorResponse.Error})
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+
+		var event StreamResponse
+		if err := json.Unmarshal(data, &event); err != nil {
+			err = fmt.Errorf("failed to unmarshal event: %s, error: %w", frame.Data, err)
+			sideKick.Error(err)
+			return models.Message{}, err
+		}
+
+		if !event.Token.Special {
+			message.WriteString(event.Token.Text)
+			sideKick.Print(event.Token.Text, companion.Config.Terminal)
+			if callback != nil && pending != nil {
+				if err := callback(*pending); err != nil {
+					sideKick.Error(err)
+					return partial(), err
+				}
+			}
+			chunk := sideKick.CreateAssistantMessage(event.Token.Text)
+			pending = &chunk
+		}
+
+		if event.Details != nil || event.GeneratedText != nil {
+			details = event.Details
+			break
+		}
+	}
+
+	sideKick.Println("", companion.Config.Terminal)
+
+	stop := companion.Stop
+	if companion.Template == nil && stop == nil {
+		stop = []string{"<|im_end|>"}
+	}
+	result := sideKick.CreateAssistantMessage(trimStop(message.String(), stop))
+	result.Usage = details.usage()
+	result.FinishReason = details.finishReason()
+
+	// the last chunk carries the usage and finish reason of the generation
+	if callback != nil {
+		if pending == nil {
+			final := sideKick.CreateAssistantMessage("")
+			pending = &final
+		}
+		pending.Usage = result.Usage
+		pending.FinishReason = result.FinishReason
+		if err := callback(*pending); err != nil {
+			sideKick.Error(err)
+			return partial(), err
+		}
+	}
+	return result, nil
+}
+
+// GetModels returns the model served by the TGI instance, as reported by the /info endpoint.
+func (companion *Companion) GetModels(ctx context.Context) ([]models.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, companion.Config.ApiEndpoints.ApiModelsURL, nil)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	if companion.Config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+companion.Config.ApiKey)
+	}
+
+	resp, err := companion.HttpClient.Do(req)
+	if err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := sideKick.VerifyStatus(resp); err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+
+	var info InfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		sideKick.Error(err)
+		return nil, err
+	}
+
+	return []models.Model{{Model: info.ModelID, Name: info.ModelID}}, nil
+}
+
+// SetOnToolCall sets the hook asked before a tool is run, nil to run tools without asking.
+func (companion *Companion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.OnToolCall = hook
+}
+
+// SetToolRegistry sets the registry of tools implemented by Go functions.
+func (companion *Companion) SetToolRegistry(registry *tools.Registry) {
+	companion.ToolRegistry = registry
+}
+
+// RunFunction runs a function with the handler registered in the tool registry or, if there is none, by
+// sending the payload to the endpoint of the tool, with the timeout, retries and circuit breaker of
+// Config.ToolConfig.
+func (companion *Companion) RunFunction(ctx context.Context, tool models.Tool, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	return sideKick.RunTool(ctx, sidekick.ToolRuntime{
+		HttpClient: companion.HttpClient,
+		Registry:   companion.ToolRegistry,
+		Config:     companion.Config.ToolConfig,
+		Breakers:   &companion.ToolBreakers,
+		OnToolCall: companion.OnToolCall,
+		Terminal:   companion.Config.Terminal,
+	}, tool, models.ToolCall{Payload: payload})
+}
+
+// StreamURL returns the streaming counterpart of a /generate url. Other urls are returned unchanged.
+func StreamURL(url string) string {
+	if strings.HasSuffix(url, "/generate") {
+		return url + "_stream"
+	}
+	return url
+}
+
+// trimStop removes a trailing stop sequence, which TGI includes in the generated text.
+func trimStop(text string, stop []string) string {
+	for _, sequence := range stop {
+		text = strings.TrimSuffix(text, sequence)
+	}
+	return strings.TrimSpace(text)
+}
+
+// usage returns the generated tokens as usage of a message. TGI does not report the prompt tokens.
+func (details *Details) usage() *models.Usage {
+	if details == nil {
+		return nil
+	}
+	return &models.Usage{CompletionTokens: details.GeneratedTokens, TotalTokens: details.GeneratedTokens}
+}
+
+// finishReason maps the finish reason of TGI to the one of models.Message.
+func (details *Details) finishReason() models.FinishReason {
+	if details == nil {
+		return ""
+	}
+	switch details.FinishReason {
+	case "eos_token", "stop_sequence":
+		return models.FinishStop
+	case "length":
+		return models.FinishLength
+	}
+	return models.FinishReason(details.FinishReason)
+}
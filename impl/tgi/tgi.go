@@ -0,0 +1,68 @@
+// Request and response structs for the HuggingFace Text Generation Inference API endpoints
+
+package tgi
+
+// GenerateRequest represents the request payload for the /generate and /generate_stream endpoints.
+type GenerateRequest struct {
+	Inputs     string     `json:"inputs"`
+	Parameters Parameters `json:"parameters"`
+	Stream     bool       `json:"stream,omitempty"`
+}
+
+// Parameters represents the generation parameters of a request.
+type Parameters struct {
+	MaxNewTokens      int      `json:"max_new_tokens,omitempty"`
+	Temperature       float32  `json:"temperature,omitempty"`
+	TopP              float32  `json:"top_p,omitempty"`
+	TopK              int      `json:"top_k,omitempty"`
+	RepetitionPenalty float32  `json:"repetition_penalty,omitempty"`
+	Stop              []string `json:"stop,omitempty"`
+	ReturnFullText    bool     `json:"return_full_text"`
+	Details           bool     `json:"details"`
+}
+
+// GenerateResponse represents the response of the /generate endpoint.
+type GenerateResponse struct {
+	GeneratedText string   `json:"generated_text"`
+	Details       *Details `json:"details,omitempty"`
+}
+
+// Details holds information about a finished generation.
+type Details struct {
+	FinishReason    string `json:"finish_reason"`
+	GeneratedTokens int    `json:"generated_tokens"`
+	Seed            *int64 `json:"seed,omitempty"`
+}
+
+// Token represents a single generated token.
+type Token struct {
+	ID      int     `json:"id"`
+	Text    string  `json:"text"`
+	LogProb float64 `json:"logprob"`
+	Special bool    `json:"special"`
+}
+
+// StreamResponse represents a single server-sent event of the /generate_stream endpoint. GeneratedText
+// and Details are only set on the last event.
+type StreamResponse struct {
+	Index         int      `json:"index"`
+	Token         Token    `json:"token"`
+	GeneratedText *string  `json:"generated_text"`
+	Details       *Details `json:"details"`
+}
+
+// ErrorResponse represents an error returned by the server, also sent as event during streaming.
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	ErrorType string `json:"error_type"`
+}
+
+// InfoResponse represents the response of the /info endpoint.
+type InfoResponse struct {
+	ModelID          string `json:"model_id"`
+	ModelSha         string `json:"model_sha"`
+	MaxInputTokens   int    `json:"max_input_tokens"`
+	MaxTotalTokens   int    `json:"max_total_tokens"`
+	Version          string `json:"version"`
+	ModelPipelineTag string `json:"model_pipeline_tag"`
+}
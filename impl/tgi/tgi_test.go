@@ -0,0 +1,88 @@
+package tgi_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/tgi"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestTGIStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/generate_stream" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var request tgi.GenerateRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(request.Inputs, "<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n") {
+			t.Errorf("unexpected prompt %q", request.Inputs)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data:{"index":1,"token":{"id":1,"text":"Hello","special":false},"generated_text":null,"details":null}`+"\n\n")
+		fmt.Fprint(w, `data:{"index":2,"token":{"id":2,"text":" there","special":false},"generated_text":null,"details":null}`+"\n\n")
+		fmt.Fprint(w, `data:{"index":3,"token":{"id":3,"text":"</s>","special":true},"generated_text":"Hello there","details":{"finish_reason":"eos_token","generated_tokens":3}}`+"\n\n")
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.TGI, "", "", "", "")
+	config.ApiEndpoints.ApiChatURL = server.URL + "/generate"
+	companion := aicompanion.NewCompanion(*config)
+
+	var chunks []string
+	result, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}, true, func(m models.Message) error {
+		chunks = append(chunks, m.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if result.Content != "Hello there" || len(chunks) != 2 {
+		t.Errorf("unexpected result %q, chunks %q", result.Content, chunks)
+	}
+}
+
+func TestTGIGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"generated_text":"Paris<|im_end|>","details":{"finish_reason":"stop_sequence","generated_tokens":2}}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.TGI, "", "", "", "")
+	config.ApiEndpoints.ApiGenerateURL = server.URL + "/generate"
+	companion := aicompanion.NewCompanion(*config)
+
+	result, err := companion.SendGenerateRequest(context.Background(), models.MessageRequest{Message: models.Message{Role: models.User, Content: "Capital of France?"}}, false, nil)
+	if err != nil {
+		t.Fatalf("generate request failed: %v", err)
+	}
+	if result.Content != "Paris" {
+		t.Errorf("expected Paris, got %q", result.Content)
+	}
+	if len(companion.GetConversation()) != 0 {
+		t.Error("generate requests must not modify the conversation")
+	}
+}
+
+func TestChatMLTools(t *testing.T) {
+	prompt := tgi.ChatML([]models.Message{
+		{Role: models.User, Content: "Weather in Berlin?"},
+		{Role: models.Assistant, ToolCalls: []models.ToolCall{{ID: "call_1", Payload: models.FunctionPayload{FunctionName: "weather", Arguments: map[string]any{"city": "Berlin"}}}}},
+		{Role: models.ToolRole, Content: "sunny", ToolCallID: "call_1", Name: "weather"},
+	})
+	expected := "<|im_start|>user\nWeather in Berlin?<|im_end|>\n" +
+		"<|im_start|>assistant\n<tool_call>\n{\"arguments\":{\"city\":\"Berlin\"},\"name\":\"weather\"}\n</tool_call><|im_end|>\n" +
+		"<|im_start|>tool\n<tool_response>\nsunny\n</tool_response><|im_end|>\n" +
+		"<|im_start|>assistant\n"
+	if prompt != expected {
+		t.Errorf("unexpected prompt %q", prompt)
+	}
+}
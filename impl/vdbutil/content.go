@@ -0,0 +1,45 @@
+package vdbutil
+
+import (
+	"fmt"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// metadata keys set by ContentDocuments
+const (
+	MetadataSource = "source"
+	MetadataChunk  = "chunk"
+)
+
+// ContentDocuments creates a document per chunk, with IDs derived from sourceID and the chunk index.
+// Every document gets a copy of metadata, extended by the source ID and chunk index. embeddings must
+// hold one vector per chunk.
+func ContentDocuments(sourceID string, chunks []string, embeddings [][]float32, metadata map[string]any) ([]models.Document, error) {
+	if len(chunks) != len(embeddings) {
+		return nil, fmt.Errorf("got %d embeddings for %d chunks", len(embeddings), len(chunks))
+	}
+
+	documents := make([]models.Document, len(chunks))
+	for i, chunk := range chunks {
+		documents[i] = ChunkDocument(sourceID, i, chunk, embeddings[i], metadata)
+	}
+	return documents, nil
+}
+
+// ChunkDocument creates the document of the chunk with the given index, like ContentDocuments.
+func ChunkDocument(sourceID string, index int, chunk string, embeddings []float32, metadata map[string]any) models.Document {
+	documentMetadata := make(map[string]any, len(metadata)+2)
+	for key, value := range metadata {
+		documentMetadata[key] = value
+	}
+	documentMetadata[MetadataSource] = sourceID
+	documentMetadata[MetadataChunk] = index
+
+	return models.Document{
+		ID:         fmt.Sprintf("%s-%d", sourceID, index),
+		Embeddings: embeddings,
+		Metadata:   documentMetadata,
+		Content:    chunk,
+	}
+}
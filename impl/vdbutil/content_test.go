@@ -0,0 +1,21 @@
+package vdbutil_test
+
+import (
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+)
+
+func TestContentDocuments(t *testing.T) {
+	documents, err := vdbutil.ContentDocuments("manual", []string{"a", "b"}, [][]float32{{1}, {2}}, map[string]any{"lang": "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if documents[1].ID != "manual-1" || documents[1].Content != "b" || documents[1].Metadata["chunk"] != 1 || documents[1].Metadata["lang"] != "en" {
+		t.Errorf("unexpected document %+v", documents[1])
+	}
+
+	if _, err := vdbutil.ContentDocuments("manual", []string{"a"}, nil, nil); err == nil {
+		t.Error("expected an error for missing embeddings")
+	}
+}
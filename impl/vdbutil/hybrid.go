@@ -0,0 +1,160 @@
+package vdbutil
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// defaults of hybrid retrieval
+const (
+	DefaultTextKey = "text"
+	DefaultRRFK    = 60
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// DocumentText returns the content of a document, or the metadata value at textKey for documents
+// stored without content. An empty textKey uses DefaultTextKey.
+func DocumentText(document models.Document, textKey string) string {
+	if document.Content != "" {
+		return document.Content
+	}
+	if textKey == "" {
+		textKey = DefaultTextKey
+	}
+	if text, exists := document.Metadata[textKey]; exists {
+		return fmt.Sprint(text)
+	}
+	return ""
+}
+
+// Tokenize splits a text into lower case words.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// BM25 scores every text against the query. Texts without any query term score 0.
+func BM25(query string, texts []string) []float64 {
+	terms := Tokenize(query)
+	scores := make([]float64, len(texts))
+	if len(terms) == 0 || len(texts) == 0 {
+		return scores
+	}
+
+	frequencies := make([]map[string]int, len(texts))
+	lengths := make([]int, len(texts))
+	documentFrequency := make(map[string]int)
+	var totalLength int
+	for i, text := range texts {
+		tokens := Tokenize(text)
+		lengths[i] = len(tokens)
+		totalLength += len(tokens)
+
+		frequencies[i] = make(map[string]int)
+		for _, token := range tokens {
+			frequencies[i][token]++
+		}
+		for term := range frequencies[i] {
+			documentFrequency[term]++
+		}
+	}
+
+	averageLength := float64(totalLength) / float64(len(texts))
+	if averageLength == 0 {
+		return scores
+	}
+
+	count := float64(len(texts))
+	for i := range texts {
+		for _, term := range terms {
+			frequency := float64(frequencies[i][term])
+			if frequency == 0 {
+				continue
+			}
+			n := float64(documentFrequency[term])
+			idf := math.Log(1 + (count-n+0.5)/(n+0.5))
+			scores[i] += idf * frequency * (bm25K1 + 1) / (frequency + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/averageLength))
+		}
+	}
+	return scores
+}
+
+// FuseRRF combines rankings with reciprocal rank fusion. Every ranking lists indices, best first; the
+// result holds the fused score of every index that appears in a ranking.
+func FuseRRF(k int, rankings ...[]int) map[int]float64 {
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+	fused := make(map[int]float64)
+	for _, ranking := range rankings {
+		for rank, index := range ranking {
+			fused[index] += 1 / float64(k+rank+1)
+		}
+	}
+	return fused
+}
+
+// hybridRank replaces the cosine scores of documents by the fused score of their vector and keyword ranks.
+// The similarity threshold applies to the cosine similarity; documents below it take part in neither ranking.
+func hybridRank(documents []models.Document, queryOptions models.VectorDBQueryOptions) []models.Document {
+	hybrid := queryOptions.Hybrid
+	textKey := hybrid.TextKey
+	if textKey == "" {
+		textKey = DefaultTextKey
+	}
+
+	candidates := make([]models.Document, 0, len(documents))
+	for _, document := range documents {
+		if queryOptions.SimilarityThreshold > 0 && document.Score < queryOptions.SimilarityThreshold {
+			continue
+		}
+		candidates = append(candidates, document)
+	}
+
+	texts := make([]string, len(candidates))
+	for i, document := range candidates {
+		texts[i] = DocumentText(document, textKey)
+	}
+	keywordScores := BM25(hybrid.Query, texts)
+
+	vectorRanking := make([]int, len(candidates))
+	var keywordRanking []int
+	for i := range candidates {
+		vectorRanking[i] = i
+		if keywordScores[i] > 0 {
+			keywordRanking = append(keywordRanking, i)
+		}
+	}
+	sort.SliceStable(vectorRanking, func(i, j int) bool {
+		return candidates[vectorRanking[i]].Score > candidates[vectorRanking[j]].Score
+	})
+	sort.SliceStable(keywordRanking, func(i, j int) bool {
+		return keywordScores[keywordRanking[i]] > keywordScores[keywordRanking[j]]
+	})
+
+	fused := FuseRRF(hybrid.RRFK, vectorRanking, keywordRanking)
+	for i := range candidates {
+		candidates[i].Score = fused[i]
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	output := Skip(candidates, queryOptions.Offset)
+	if queryOptions.Limit > 0 && len(output) > queryOptions.Limit {
+		output = output[:queryOptions.Limit]
+	}
+	return output
+}
@@ -0,0 +1,44 @@
+package vdbutil_test
+
+import (
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestBM25(t *testing.T) {
+	scores := vdbutil.BM25("golang channels", []string{
+		"Channels connect concurrent goroutines in Golang.",
+		"A recipe for apple pie.",
+		"Golang is a programming language.",
+	})
+	if scores[1] != 0 {
+		t.Errorf("unrelated text scored %f", scores[1])
+	}
+	if scores[0] <= scores[2] || scores[2] <= 0 {
+		t.Errorf("unexpected scores %v", scores)
+	}
+}
+
+func TestRankHybrid(t *testing.T) {
+	documents := []models.Document{
+		{ID: "vector", Score: 0.9, Metadata: map[string]any{"text": "something else entirely"}},
+		{ID: "both", Score: 0.8, Metadata: map[string]any{"text": "invoice 4711"}},
+		{ID: "keyword", Score: 0.1, Metadata: map[string]any{"text": "reminder: invoice 4711 is overdue"}},
+		{ID: "below", Score: 0.05, Metadata: map[string]any{"text": "invoice 4711"}},
+	}
+
+	ranked := vdbutil.Rank(documents, models.VectorDBQueryOptions{
+		SimilarityThreshold: 0.1,
+		Limit:               2,
+		Hybrid:              &models.HybridOptions{Query: "invoice 4711"},
+	})
+
+	if len(ranked) != 2 || ranked[0].ID != "both" {
+		t.Fatalf("unexpected ranking %+v", ranked)
+	}
+	if ranked[0].Score <= ranked[1].Score {
+		t.Errorf("scores not descending: %f, %f", ranked[0].Score, ranked[1].Score)
+	}
+}
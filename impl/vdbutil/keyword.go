@@ -0,0 +1,72 @@
+package vdbutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// KeywordSearch searches the documents of a schema by keywords. Backends implementing
+// vectordb.KeywordSearcher use their own index; for other backends that implement vectordb.Scanner, all
+// documents are scanned and ranked by the BM25 relevance of their text and string metadata values.
+// Documents without any query term are not returned.
+func KeywordSearch(ctx context.Context, db vectordb.VectorDb, classname, query string, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	if searcher, ok := db.(vectordb.KeywordSearcher); ok {
+		return searcher.SearchDocuments(ctx, classname, query, queryOptions)
+	}
+
+	scanner, ok := db.(vectordb.Scanner)
+	if !ok {
+		return nil, vectordb.ErrScanUnsupported
+	}
+
+	var documents []models.Document
+	var texts []string
+	err := scanner.ScanDocuments(ctx, classname, "", func(document models.Document) error {
+		if !MatchesFilter(document.Metadata, queryOptions.Filter) {
+			return nil
+		}
+		documents = append(documents, document)
+		texts = append(texts, KeywordText(document))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", classname, err)
+	}
+
+	scores := BM25(query, texts)
+	var results []models.Document
+	for i, document := range documents {
+		if scores[i] > 0 {
+			document.Score = scores[i]
+			results = append(results, document)
+		}
+	}
+
+	// keyword scores are not similarities
+	queryOptions.SimilarityThreshold = 0
+	queryOptions.Hybrid = nil
+	return Rank(results, queryOptions), nil
+}
+
+// KeywordText returns the searchable text of a document: its content followed by its string metadata
+// values in key order.
+func KeywordText(document models.Document) string {
+	keys := make([]string, 0, len(document.Metadata))
+	for key, value := range document.Metadata {
+		if _, ok := value.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	parts := []string{document.Content}
+	for _, key := range keys {
+		parts = append(parts, document.Metadata[key].(string))
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,154 @@
+// Package vdbutil implements the scoring, filtering and ranking shared by the vector database backends,
+// so every backend applies the query options the same way.
+package vdbutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Normalize scales a vector to unit length in place and returns it. Zero vectors are returned unchanged.
+func Normalize(vector []float32) []float32 {
+	var magnitude float64
+	for _, v := range vector {
+		magnitude += float64(v * v)
+	}
+	if magnitude == 0 {
+		return vector
+	}
+	magnitude = math.Sqrt(magnitude)
+	for i := range vector {
+		vector[i] /= float32(magnitude)
+	}
+	return vector
+}
+
+// List implements ListDocuments on top of a backend's ScanDocuments.
+func List(ctx context.Context, scanner vectordb.Scanner, classname string, listOptions models.DocumentListOptions) ([]models.Document, error) {
+	output := []models.Document{}
+	err := scanner.ScanDocuments(ctx, classname, listOptions.After, func(document models.Document) error {
+		if !MatchesFilter(document.Metadata, listOptions.Filter) {
+			return nil
+		}
+		output = append(output, document)
+		if listOptions.Limit > 0 && len(output) == listOptions.Limit {
+			return errListComplete
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errListComplete) {
+		return nil, err
+	}
+	return output, nil
+}
+
+// errListComplete stops the scan of List once the limit is reached.
+var errListComplete = errors.New("list complete")
+
+// ValidateSchema checks a schema for backends that only support cosine similarity.
+func ValidateSchema(schema models.Schema) error {
+	if schema.ClassName == "" {
+		return errors.New("schema requires a class name")
+	}
+	if schema.Vector.Distance != "" && schema.Vector.Distance != models.DistanceCosine {
+		return fmt.Errorf("unsupported distance %q, only cosine similarity is supported", schema.Vector.Distance)
+	}
+	return nil
+}
+
+// CheckDimensions verifies that all documents have embeddings with the given number of dimensions and
+// returns the number of dimensions of the schema. If dimensions is 0, the first document with embeddings
+// defines it.
+func CheckDimensions(dimensions int, documents []models.Document) (int, error) {
+	for _, document := range documents {
+		if dimensions == 0 {
+			dimensions = len(document.Embeddings)
+			continue
+		}
+		if len(document.Embeddings) != dimensions {
+			return 0, fmt.Errorf("%w: document %s has %d dimensions, expected %d", vectordb.ErrDimensionMismatch, document.ID, len(document.Embeddings), dimensions)
+		}
+	}
+	return dimensions, nil
+}
+
+// CheckVector verifies that a query vector has the given number of dimensions. A dimensions of 0, an
+// empty schema, accepts every vector.
+func CheckVector(dimensions int, vector []float32) error {
+	if dimensions > 0 && len(vector) != dimensions {
+		return fmt.Errorf("%w: query vector has %d dimensions, expected %d", vectordb.ErrDimensionMismatch, len(vector), dimensions)
+	}
+	return nil
+}
+
+// CosineSimilarity calculates the cosine similarity between two vectors. Vectors of different length are
+// compared on their common dimensions.
+func CosineSimilarity(v1, v2 []float32) float64 {
+	var dotProduct, mag1, mag2 float64
+	for i := range v1 {
+		if i >= len(v2) {
+			break
+		}
+		dotProduct += float64(v1[i] * v2[i])
+		mag1 += float64(v1[i] * v1[i])
+		mag2 += float64(v2[i] * v2[i])
+	}
+	if mag1 == 0 || mag2 == 0 {
+		return 0
+	}
+	return dotProduct / (math.Sqrt(mag1) * math.Sqrt(mag2))
+}
+
+// MatchesFilter checks if the metadata matches the filter. Every key of the filter must match exactly.
+func MatchesFilter(metadata, filter map[string]any) bool {
+	for k, v := range filter {
+		if metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Rank drops scored documents below the similarity threshold, sorts the rest by descending score and
+// applies the offset and limit. For hybrid queries, documents are ranked by the fusion of their keyword
+// and vector ranks.
+func Rank(documents []models.Document, queryOptions models.VectorDBQueryOptions) []models.Document {
+	if queryOptions.Hybrid != nil {
+		return hybridRank(documents, queryOptions)
+	}
+
+	output := make([]models.Document, 0, len(documents))
+	for _, document := range documents {
+		if queryOptions.SimilarityThreshold > 0 && document.Score < queryOptions.SimilarityThreshold {
+			continue
+		}
+		output = append(output, document)
+	}
+
+	sort.SliceStable(output, func(i, j int) bool {
+		return output[i].Score > output[j].Score
+	})
+
+	output = Skip(output, queryOptions.Offset)
+	if queryOptions.Limit > 0 && len(output) > queryOptions.Limit {
+		output = output[:queryOptions.Limit]
+	}
+	return output
+}
+
+// Skip drops the first offset documents.
+func Skip(documents []models.Document, offset int) []models.Document {
+	if offset <= 0 {
+		return documents
+	}
+	if offset >= len(documents) {
+		return documents[:0]
+	}
+	return documents[offset:]
+}
@@ -0,0 +1,114 @@
+package aicompanion
+
+import (
+	"context"
+	"time"
+
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/metrics"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// instrumented records the requests of a companion with a metrics.Collector.
+type instrumented struct {
+	AICompanion
+	collector metrics.Collector
+}
+
+// Instrument returns companion recording its requests with collector: chat, generate, RAG, tool,
+// embedding and moderation requests by provider, model and status, their duration and the throughput
+// of streamed answers. To record vector database queries, set a database wrapped by
+// metrics.InstrumentVectorDb.
+func Instrument(companion AICompanion, collector metrics.Collector) AICompanion {
+	return &instrumented{AICompanion: companion, collector: collector}
+}
+
+// SendChatRequest implements AICompanion.
+func (companion *instrumented) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	model := companion.GetConfig().AiModels.ChatModel.Model
+	return companion.stream("chat", model, streaming, callback, func(callback func(m models.Message) error) (models.Message, error) {
+		return companion.AICompanion.SendChatRequest(ctx, message, streaming, callback)
+	})
+}
+
+// SendGenerateRequest implements AICompanion.
+func (companion *instrumented) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	model := companion.GetConfig().AiModels.GenerateModel.Model
+	return companion.stream("generate", model, streaming, callback, func(callback func(m models.Message) error) (models.Message, error) {
+		return companion.AICompanion.SendGenerateRequest(ctx, message, streaming, callback)
+	})
+}
+
+// SendRAGRequest implements AICompanion.
+func (companion *instrumented) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	model := companion.GetConfig().AiModels.ChatModel.Model
+	return companion.stream("rag", model, streaming, callback, func(callback func(m models.Message) error) (models.Message, error) {
+		return companion.AICompanion.SendRAGRequest(ctx, message, options, streaming, callback)
+	})
+}
+
+// SendToolRequest implements AICompanion.
+func (companion *instrumented) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	start := time.Now()
+	result, err := companion.AICompanion.SendToolRequest(ctx, message)
+	companion.observe("tool", companion.GetConfig().AiModels.ChatModel.Model, result.Model, err, start)
+	return result, err
+}
+
+// SendEmbeddingRequest implements AICompanion.
+func (companion *instrumented) SendEmbeddingRequest(ctx context.Context, embedding models.EmbeddingRequest) (models.EmbeddingResponse, error) {
+	start := time.Now()
+	response, err := companion.AICompanion.SendEmbeddingRequest(ctx, embedding)
+	companion.observe("embedding", embedding.Model, response.Model, err, start)
+	return response, err
+}
+
+// SendModerationRequest implements AICompanion.
+func (companion *instrumented) SendModerationRequest(ctx context.Context, moderationRequest models.ModerationRequest) (models.ModerationResponse, error) {
+	start := time.Now()
+	response, err := companion.AICompanion.SendModerationRequest(ctx, moderationRequest)
+	companion.observe("moderation", companion.GetConfig().AiModels.ModerationModel.Model, response.Model.Model, err, start)
+	return response, err
+}
+
+// stream sends a request, recording it and, if it streams, the throughput of its answer from the first
+// chunk on.
+func (companion *instrumented) stream(operation, model string, streaming bool, callback func(m models.Message) error, send func(callback func(m models.Message) error) (models.Message, error)) (models.Message, error) {
+	start := time.Now()
+	var first time.Time
+	observed := callback
+	if streaming && callback != nil {
+		observed = func(m models.Message) error {
+			if first.IsZero() {
+				first = time.Now()
+			}
+			return callback(m)
+		}
+	}
+
+	result, err := send(observed)
+	companion.observe(operation, model, result.Model, err, start)
+	if err == nil && !first.IsZero() {
+		tokens := sidekick_interface.NewSideKick().CountTokens(result)
+		if result.Usage != nil && result.Usage.CompletionTokens > 0 {
+			tokens = result.Usage.CompletionTokens
+		}
+		companion.collector.ObserveStream(string(companion.GetConfig().ApiProvider), labelModel(model, result.Model), tokens, time.Since(first))
+	}
+	return result, err
+}
+
+// observe records a request.
+func (companion *instrumented) observe(operation, model, reported string, err error, start time.Time) {
+	provider := string(companion.GetConfig().ApiProvider)
+	companion.collector.ObserveRequest(provider, labelModel(model, reported), operation, metrics.Status(err), time.Since(start))
+}
+
+// labelModel returns the configured model, which keeps the label values few, or the model reported by
+// the provider if none is configured.
+func labelModel(configured, reported string) string {
+	if configured != "" {
+		return configured
+	}
+	return reported
+}
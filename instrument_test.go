@@ -0,0 +1,45 @@
+package aicompanion_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/metrics"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestInstrument(t *testing.T) {
+	fake := aicompaniontest.NewFakeCompanion("instrumented answer")
+	config := fake.GetConfig()
+	config.ApiProvider = models.OpenAI
+	config.AiModels.ChatModel.Model = "gpt-4o"
+	fake.SetConfig(config)
+
+	collector := metrics.NewPrometheus()
+	companion := aicompanion.Instrument(fake, collector)
+	message := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}
+
+	if _, err := companion.SendChatRequest(context.Background(), message, true, func(m models.Message) error { return nil }); err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	fake.Err = errors.New("unavailable")
+	if _, err := companion.SendChatRequest(context.Background(), message, false, nil); err == nil {
+		t.Fatal("expected the error of the companion")
+	}
+
+	var body strings.Builder
+	collector.WriteTo(&body)
+	for _, line := range []string{
+		`aicompanion_requests_total{provider="openai",model="gpt-4o",operation="chat",status="ok"} 1`,
+		`aicompanion_requests_total{provider="openai",model="gpt-4o",operation="chat",status="error"} 1`,
+		`aicompanion_stream_tokens_per_second_count{provider="openai",model="gpt-4o"} 1`,
+	} {
+		if !strings.Contains(body.String(), line) {
+			t.Errorf("expected line %q in:\n%s", line, body.String())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package conversationstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrDecryption is returned for data that cannot be decrypted with the given key, because the key is
+// wrong or the data was modified.
+var ErrDecryption = errors.New("failed to decrypt data: wrong key or corrupted data")
+
+var _ Store = (*EncryptedStore)(nil)
+
+// ParseKey decodes a base64 encoded AES key of 16, 24 or 32 bytes, such as Configuration.EncryptionKey.
+func ParseKey(key string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	switch len(decoded) {
+	case 16, 24, 32:
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("invalid encryption key: expected 16, 24 or 32 bytes, got %d", len(decoded))
+	}
+}
+
+// newAEAD creates the AES-GCM cipher for a base64 encoded key.
+func newAEAD(key string) (cipher.AEAD, error) {
+	decoded, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts data sealed by seal.
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// Encrypt encrypts data with AES-GCM using a base64 encoded key as accepted by ParseKey.
+func Encrypt(key string, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, data)
+}
+
+// Decrypt decrypts data encrypted by Encrypt with the same key.
+func Decrypt(key string, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, data)
+}
+
+// EncryptedStore encrypts the conversations of another Store at rest with AES-GCM. Every message is
+// encrypted as a whole, including its role, images and tool calls; the wrapped store only sees messages
+// whose content is the base64 encoded ciphertext. Session names are not encrypted. Since the wrapped
+// store cannot index the messages, EncryptedStore does not implement Searcher.
+type EncryptedStore struct {
+	store Store
+	aead  cipher.AEAD
+}
+
+// NewEncryptedStore wraps store, encrypting its messages with a base64 encoded key as accepted by
+// ParseKey, usually Configuration.EncryptionKey.
+func NewEncryptedStore(store Store, key string) (*EncryptedStore, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStore{store: store, aead: aead}, nil
+}
+
+// Load implements Store.
+func (store *EncryptedStore) Load(key string) ([]models.Message, error) {
+	sealed, err := store.store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation := make([]models.Message, len(sealed))
+	for i, message := range sealed {
+		data, err := base64.StdEncoding.DecodeString(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode message %d: %w", i, err)
+		}
+		plaintext, err := open(store.aead, data)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		var exported models.ExportedMessage
+		if err := json.Unmarshal(plaintext, &exported); err != nil {
+			return nil, fmt.Errorf("failed to deserialize message %d: %w", i, err)
+		}
+		conversation[i] = exported.Message()
+	}
+	return conversation, nil
+}
+
+// Save implements Store.
+func (store *EncryptedStore) Save(key string, conversation []models.Message) error {
+	sealed := make([]models.Message, len(conversation))
+	for i, message := range conversation {
+		plaintext, err := json.Marshal(models.NewExportedMessage(message))
+		if err != nil {
+			return fmt.Errorf("failed to serialize message %d: %w", i, err)
+		}
+		data, err := seal(store.aead, plaintext)
+		if err != nil {
+			return err
+		}
+		sealed[i] = models.Message{Content: base64.StdEncoding.EncodeToString(data)}
+	}
+	return store.store.Save(key, sealed)
+}
+
+// Delete implements Store.
+func (store *EncryptedStore) Delete(key string) error {
+	return store.store.Delete(key)
+}
+
+// Keys implements Store.
+func (store *EncryptedStore) Keys() ([]string, error) {
+	return store.store.Keys()
+}
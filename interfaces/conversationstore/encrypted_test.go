@@ -0,0 +1,59 @@
+package conversationstore_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	backing := conversationstore.NewMemoryStore()
+	store, err := conversationstore.NewEncryptedStore(backing, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversation := []models.Message{
+		{ID: "a", Role: models.User, Content: "my secret", CreatedAt: time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)},
+		{ID: "b", Role: models.Assistant, Content: "is safe", Model: "test"},
+	}
+	if err := store.Save("work", conversation); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, _ := backing.Load("work")
+	for _, message := range sealed {
+		if strings.Contains(message.Content, "secret") || message.Role != "" || message.ID != "" {
+			t.Errorf("message is stored unencrypted: %+v", message)
+		}
+	}
+
+	loaded, err := store.Load("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, conversation) {
+		t.Errorf("expected %+v, got %+v", conversation, loaded)
+	}
+
+	other, _ := conversationstore.NewEncryptedStore(backing, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+	if _, err := other.Load("work"); !errors.Is(err, conversationstore.ErrDecryption) {
+		t.Errorf("expected a decryption error, got %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := conversationstore.ParseKey(key); err == nil {
+			t.Errorf("expected an error for key %q", key)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package conversationstore
+
+import (
+	"errors"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrSearchUnsupported is returned when searching sessions of a store that does not implement Searcher.
+var ErrSearchUnsupported = errors.New("conversation store does not support search")
+
+// SearchResult is a stored message matching a search.
+type SearchResult struct {
+	Session  string         `json:"session"`  // Key of the conversation holding the message
+	Position int            `json:"position"` // Index of the message in its conversation
+	Message  models.Message `json:"message"`
+	Score    float64        `json:"score"` // Relevance of the message, higher is better
+}
+
+// Searcher is implemented by stores that search the messages of all stored conversations.
+type Searcher interface {
+	// Search returns up to limit messages matching all words of the query, best matches first. A limit
+	// of 0 returns all matches.
+	Search(query string, limit int) ([]SearchResult, error)
+}
+
+// Search saves the conversation of the current session and searches all sessions. The store has to
+// implement Searcher.
+func (sessions *Sessions) Search(conversation []models.Message, query string, limit int) ([]SearchResult, error) {
+	searcher, ok := sessions.store().(Searcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	if err := sessions.Save(conversation); err != nil {
+		return nil, err
+	}
+	return searcher.Search(query, limit)
+}
@@ -0,0 +1,88 @@
+package conversationstore
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Sessions manages the named conversations of a companion. The companion holds the conversation of the
+// current session; the conversations of the other sessions are kept in the store. The zero value uses
+// an in-memory store and starts in DefaultSession.
+type Sessions struct {
+	Store   Store
+	current string
+}
+
+// store returns the store, creating an in-memory store on first use.
+func (sessions *Sessions) store() Store {
+	if sessions.Store == nil {
+		sessions.Store = NewMemoryStore()
+	}
+	return sessions.Store
+}
+
+// Current returns the name of the current session.
+func (sessions *Sessions) Current() string {
+	if sessions.current == "" {
+		return DefaultSession
+	}
+	return sessions.current
+}
+
+// Switch saves the conversation of the current session and returns the stored conversation of the named
+// session, which becomes the current one. Unknown sessions start with an empty conversation.
+func (sessions *Sessions) Switch(name string, conversation []models.Message) ([]models.Message, error) {
+	if name == "" {
+		return nil, ErrInvalidSessionName
+	}
+	if err := sessions.Save(conversation); err != nil {
+		return nil, err
+	}
+
+	loaded, err := sessions.store().Load(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session %s: %w", name, err)
+	}
+	sessions.current = name
+	return loaded, nil
+}
+
+// Save stores the conversation of the current session.
+func (sessions *Sessions) Save(conversation []models.Message) error {
+	if err := sessions.store().Save(sessions.Current(), conversation); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", sessions.Current(), err)
+	}
+	return nil
+}
+
+// List returns the sorted names of all sessions, including the current one.
+func (sessions *Sessions) List() ([]string, error) {
+	names, err := sessions.store().Keys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	current := sessions.Current()
+	for _, name := range names {
+		if name == current {
+			return names, nil
+		}
+	}
+	names = append(names, current)
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes a session from the store. It returns true if the current session was deleted, whose
+// conversation the companion has to clear.
+func (sessions *Sessions) Delete(name string) (bool, error) {
+	if name == "" {
+		return false, ErrInvalidSessionName
+	}
+	if err := sessions.store().Delete(name); err != nil {
+		return false, fmt.Errorf("failed to delete session %s: %w", name, err)
+	}
+	return name == sessions.Current(), nil
+}
@@ -0,0 +1,49 @@
+package conversationstore_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestSessions(t *testing.T) {
+	var sessions conversationstore.Sessions
+	if sessions.Current() != conversationstore.DefaultSession {
+		t.Errorf("expected the default session, got %s", sessions.Current())
+	}
+
+	first := []models.Message{{Role: models.User, Content: "hello"}}
+	conversation, err := sessions.Switch("work", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversation) != 0 || sessions.Current() != "work" {
+		t.Errorf("expected an empty work session, got %+v in %s", conversation, sessions.Current())
+	}
+
+	names, err := sessions.List()
+	if err != nil || !reflect.DeepEqual(names, []string{"default", "work"}) {
+		t.Errorf("unexpected sessions %v: %v", names, err)
+	}
+
+	conversation, err = sessions.Switch(conversationstore.DefaultSession, []models.Message{{Role: models.User, Content: "report"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conversation, first) {
+		t.Errorf("expected the default conversation, got %+v", conversation)
+	}
+
+	current, err := sessions.Delete("work")
+	if err != nil || current {
+		t.Errorf("expected to delete another session, got %v: %v", current, err)
+	}
+	if current, _ := sessions.Delete(conversationstore.DefaultSession); !current {
+		t.Error("expected to delete the current session")
+	}
+	if _, err := sessions.Switch("", nil); err != conversationstore.ErrInvalidSessionName {
+		t.Errorf("expected ErrInvalidSessionName, got %v", err)
+	}
+}
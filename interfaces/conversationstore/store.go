@@ -0,0 +1,72 @@
+// Package conversationstore keeps conversations by key, such as the channel of a chat platform or the
+// name of a session, and manages the named sessions of a companion.
+package conversationstore
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// DefaultSession is the name of the session a companion starts with.
+const DefaultSession = "default"
+
+// ErrInvalidSessionName is returned for empty session names.
+var ErrInvalidSessionName = errors.New("session name must not be empty")
+
+// Store keeps conversations by key. Loading an unknown key returns an empty conversation.
+type Store interface {
+	Load(key string) ([]models.Message, error)
+	Save(key string, conversation []models.Message) error
+	Delete(key string) error
+	Keys() ([]string, error)
+}
+
+// MemoryStore is an in-memory Store.
+type MemoryStore struct {
+	mutex         sync.Mutex
+	conversations map[string][]models.Message
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{conversations: make(map[string][]models.Message)}
+}
+
+// Load implements Store.
+func (store *MemoryStore) Load(key string) ([]models.Message, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append([]models.Message(nil), store.conversations[key]...), nil
+}
+
+// Save implements Store.
+func (store *MemoryStore) Save(key string, conversation []models.Message) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.conversations[key] = append([]models.Message(nil), conversation...)
+	return nil
+}
+
+// Delete implements Store.
+func (store *MemoryStore) Delete(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.conversations, key)
+	return nil
+}
+
+// Keys implements Store. The keys are sorted.
+func (store *MemoryStore) Keys() ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	keys := make([]string, 0, len(store.conversations))
+	for key := range store.conversations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
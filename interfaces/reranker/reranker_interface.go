@@ -0,0 +1,14 @@
+package reranker
+
+import (
+	"context"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Reranker orders documents by their relevance to a query.
+type Reranker interface {
+	// Rerank returns the topN most relevant documents, ordered by descending relevance.
+	// A topN of zero returns all documents.
+	Rerank(ctx context.Context, query string, documents []string, topN int) ([]models.RerankResult, error)
+}
@@ -1,11 +1,16 @@
 package sidekick_interface
 
 import (
+	"context"
 	"image"
+	"image/color"
+	"io"
 	"net/http"
 
 	"github.com/ghmer/aicompanion/impl/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
 	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
 )
 
 type SideKickInterface interface {
@@ -39,15 +44,66 @@ type SideKickInterface interface {
 	// CalculateNewDimensions calculates the new width and height while maintaining the aspect ratio.
 	CalculateNewDimensions(bounds image.Rectangle, maxSize int) (int, int)
 
-	// EncodeImage encodes an image into a specific format (JPEG, PNG, etc.).
+	// CenterCropImage scales an image to cover the target dimensions and crops it around the center.
+	CenterCropImage(imageBytes []byte, width, height int) ([]byte, error)
+
+	// PadImage scales an image to fit into the target dimensions and letterboxes the remaining space.
+	PadImage(imageBytes []byte, width, height int, background color.Color) ([]byte, error)
+
+	// CenterCrop scales an image to cover width x height and crops it around the center.
+	CenterCrop(img image.Image, width, height int) image.Image
+
+	// Letterbox scales an image to fit into width x height and centers it on a background color.
+	Letterbox(img image.Image, width, height int, background color.Color) image.Image
+
+	// EncodeImage encodes an image into a specific format (JPEG, PNG, GIF, TIFF).
 	EncodeImage(img image.Image, format string) ([]byte, error)
 
+	// ExtractVideoFrames extracts count evenly spaced frames from a video file, resized to maxSize.
+	ExtractVideoFrames(filepath string, count int, maxSize int) ([]models.Base64Image, error)
+
+	// ExtractVideoKeyframes extracts up to count keyframes from a video file, resized to maxSize.
+	ExtractVideoKeyframes(filepath string, count int, maxSize int) ([]models.Base64Image, error)
+
+	// ChunkAudio splits an audio file into overlapping chunks below the configured size limit.
+	ChunkAudio(filepath string, options sidekick.AudioChunkOptions) ([]models.AudioChunk, error)
+
+	// TranscribeAudio chunks an audio file, transcribes the chunks concurrently and stitches the results.
+	TranscribeAudio(ctx context.Context, filepath string, options sidekick.AudioChunkOptions, transcriber sidekick.Transcriber) (models.Transcript, error)
+
+	// TranscribeChunks transcribes the given chunks concurrently and stitches the results.
+	TranscribeChunks(ctx context.Context, chunks []models.AudioChunk, options sidekick.AudioChunkOptions, transcriber sidekick.Transcriber) (models.Transcript, error)
+
 	// ReadFile reads a file and returns its base64 encoded content.
 	ReadFile(filepath string) ([]byte, error)
 
 	// RunFunction runs a function and returns the response
 	RunFunction(httpClient *http.Client, tool models.Tool, payload models.FunctionPayload, debug, trace bool) (models.FunctionResponse, error)
 
+	// ToolDefinitions returns the function definitions of the request and the tools, once by name.
+	ToolDefinitions(functions []models.Function, tools []models.Tool) []models.Function
+
+	// FindTool returns the tool implementing the named function.
+	FindTool(tools []models.Tool, name string) (models.Tool, bool)
+
+	// CallTool runs a tool call with the handler registered in registry or the endpoint of the tool.
+	CallTool(ctx context.Context, httpClient *http.Client, registry *tools.Registry, tool models.Tool, payload models.FunctionPayload, termconfig models.Terminal) (models.FunctionResponse, error)
+
+	// RunToolCalls runs tool calls concurrently and returns their results as tool messages, or false if a tool is unknown.
+	RunToolCalls(ctx context.Context, runtime sidekick.ToolRuntime, calls []models.ToolCall) ([]models.Message, bool)
+
+	// RunTool runs a tool call once approved, with the timeout, retries and circuit breaker of the runtime.
+	RunTool(ctx context.Context, runtime sidekick.ToolRuntime, tool models.Tool, call models.ToolCall) (models.FunctionResponse, error)
+
+	// ValidateToolCall validates the arguments of a tool call against the parameters of its function.
+	ValidateToolCall(registry *tools.Registry, tool models.Tool, payload models.FunctionPayload) error
+
+	// CreateToolMessage creates the tool message answering a tool call with the response of the tool.
+	CreateToolMessage(call models.ToolCall, response models.FunctionResponse) models.Message
+
+	// RunToolLoop sends messages and answers tool calls until the model answers without calling tools.
+	RunToolLoop(messages []models.Message, send func(messages []models.Message) (models.Message, error), run sidekick.ToolRunner) ([]models.Message, error)
+
 	// Debug logs a debug message.
 	Debug(payload string, termconfig models.Terminal)
 
@@ -69,8 +125,59 @@ type SideKickInterface interface {
 	// PrepareArray filters and limits messages based on the includeStrategy.
 	PrepareArray(messages []models.Message, includeStrategy models.IncludeStrategy, maxMessages int) []models.Message
 
-	// VerifyStatus verifies if the HTTP response status code is within the expected range.
+	// PinMessage pins or unpins the message at index of the conversation.
+	PinMessage(conversation []models.Message, index int, pinned bool) error
+
+	// PinMessageByID pins or unpins the message of the conversation with the given ID.
+	PinMessageByID(conversation []models.Message, id string, pinned bool) error
+
+	// CountTokens counts the tokens of messages with sidekick.Tokenizer.
+	CountTokens(messages ...models.Message) int
+
+	// TrimTokens drops the oldest messages until they fit into maxTokens along with the reserved messages.
+	TrimTokens(messages []models.Message, maxTokens int, reserved ...models.Message) []models.Message
+
+	// SelectContext selects the history of a request with the context strategy registered under name.
+	SelectContext(name string, request sidekick.ContextRequest) []models.Message
+
+	// NewSummarizer returns a Summarizer asking the model through the given generate function.
+	NewSummarizer(generate func(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error)) sidekick.Summarizer
+
+	// VerifyStatus returns a *models.ProviderError if the HTTP response status code signals a failure.
 	VerifyStatus(resp *http.Response) error
+
+	// ViolatedCategories returns the categories of a moderation response that exceed their thresholds.
+	ViolatedCategories(response models.ModerationResponse, config models.ModerationConfig) []string
+
+	// ApplyModeration applies the configured moderation action to a message based on a moderation response.
+	ApplyModeration(message models.Message, response models.ModerationResponse, config models.ModerationConfig) (models.Message, error)
+
+	// PrepareRAGRequest retrieves documents matching a message and returns a request carrying them as context.
+	PrepareRAGRequest(ctx context.Context, vectorDb vectordb.VectorDb, embed sidekick.EmbedFunc, config models.Configuration, message models.Message, options models.RAGOptions) (models.MessageRequest, error)
+
+	// PrepareKnowledgeRequest enriches a chat request with the knowledge of the active persona, if it uses knowledge.
+	PrepareKnowledgeRequest(ctx context.Context, vectorDb vectordb.VectorDb, embed sidekick.EmbedFunc, config models.Configuration, request models.MessageRequest) (models.MessageRequest, error)
+
+	// EnrichMessage adds the enrichment prompt and context texts to the content of a message.
+	EnrichMessage(message models.Message, prompt string, context []string) models.Message
+
+	// StampMessage assigns an ID and the creation time to a message that the provider has not set.
+	StampMessage(message models.Message) models.Message
+
+	// RemoveLastExchange splits a conversation into the messages before its last user message and the removed exchange.
+	RemoveLastExchange(conversation []models.Message) ([]models.Message, []models.Message)
+
+	// TruncateAfter returns the messages of a conversation up to and including index.
+	TruncateAfter(conversation []models.Message, index int) ([]models.Message, error)
+
+	// ExportConversation writes a conversation as transcript in the given format, encrypted if key is set.
+	ExportConversation(w io.Writer, conversation []models.Message, format models.ConversationFormat, imageDir string, key string) error
+
+	// ImportConversation reads a JSON or Markdown transcript written by ExportConversation, decrypting it with key.
+	ImportConversation(r io.Reader, key string) ([]models.Message, error)
+
+	// ParseRateLimit reads the x-ratelimit-* and retry-after headers of a response.
+	ParseRateLimit(header http.Header) *models.RateLimit
 }
 
 func NewSideKick() SideKickInterface {
@@ -39,7 +39,7 @@ type SideKickInterface interface {
 	// CalculateNewDimensions calculates the new width and height while maintaining the aspect ratio.
 	CalculateNewDimensions(bounds image.Rectangle, maxSize int) (int, int)
 
-	// EncodeImage encodes an image into a specific format (JPEG, PNG, etc.).
+	// EncodeImage encodes an image into a specific format (JPEG, PNG, GIF, TIFF).
 	EncodeImage(img image.Image, format string) ([]byte, error)
 
 	// ReadFile reads a file and returns its base64 encoded content.
@@ -0,0 +1,88 @@
+package vectordb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrScanUnsupported is returned by ExportCollection for backends that can't enumerate documents.
+var ErrScanUnsupported = errors.New("backend does not support scanning documents")
+
+// importBatchSize is the number of documents ImportCollection adds at once.
+const importBatchSize = 500
+
+// Scanner is implemented by backends that can enumerate the documents of a schema.
+type Scanner interface {
+	// ScanDocuments calls fn for every document of a schema whose ID sorts after the given one, in
+	// ascending ID order. An empty after starts at the first document. Scanning stops at the first error
+	// returned by fn. fn must not modify the database being scanned.
+	ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error
+}
+
+// ExportCollection writes all documents of a schema to w as JSON lines, one document per line.
+// The backend must implement Scanner.
+func ExportCollection(ctx context.Context, db VectorDb, classname string, w io.Writer) error {
+	scanner, ok := db.(Scanner)
+	if !ok {
+		return ErrScanUnsupported
+	}
+
+	encoder := json.NewEncoder(w)
+	return scanner.ScanDocuments(ctx, classname, "", func(document models.Document) error {
+		document.ClassName = ""
+		document.Score = 0
+		if err := encoder.Encode(document); err != nil {
+			return fmt.Errorf("failed to export document %s: %w", document.ID, err)
+		}
+		return nil
+	})
+}
+
+// ImportCollection adds the documents written by ExportCollection to a schema, in batches. The schema
+// must exist; documents with existing IDs are replaced. It returns the number of imported documents.
+func ImportCollection(ctx context.Context, db VectorDb, classname string, r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	batch := make([]models.Document, 0, importBatchSize)
+	var imported int
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := db.AddDocuments(ctx, classname, batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		var document models.Document
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("failed to read document %d: %w", imported+len(batch)+1, err)
+		}
+		if document.ID == "" {
+			return imported, fmt.Errorf("document %d has no id", imported+len(batch)+1)
+		}
+
+		document.ClassName = classname
+		batch = append(batch, document)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+
+	return imported, flush()
+}
@@ -0,0 +1,65 @@
+package vectordb_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/impl/sqlvdb"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestExportImportCollection(t *testing.T) {
+	ctx := context.Background()
+	source, _ := memvdb.NewMemoryVectorDb("", false)
+	source.CreateSchema(ctx, models.Schema{ClassName: "docs"})
+	for i := 0; i < 3; i++ {
+		source.AddDocument(ctx, "docs", fmt.Sprint(i), models.Document{
+			Embeddings: []float32{1, float32(i)},
+			Metadata:   map[string]any{"page": float64(i)},
+			Content:    fmt.Sprintf("page %d", i),
+		})
+	}
+
+	var buffer bytes.Buffer
+	if err := vectordb.ExportCollection(ctx, source, "docs", &buffer); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buffer.String(), "\n"); lines != 3 {
+		t.Fatalf("expected 3 lines, got %d", lines)
+	}
+
+	target, err := sqlvdb.NewSQLiteVectorDb(t.TempDir()+"/vectors.db", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.CreateSchema(ctx, models.Schema{ClassName: "imported"})
+	imported, err := vectordb.ImportCollection(ctx, target, "imported", &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 3 {
+		t.Errorf("expected 3 imported documents, got %d", imported)
+	}
+
+	var documents []models.Document
+	target.ScanDocuments(ctx, "imported", "0", func(document models.Document) error {
+		documents = append(documents, document)
+		return nil
+	})
+	if len(documents) != 2 || documents[0].ID != "1" || documents[0].Content != "page 1" || documents[0].Metadata["page"] != float64(1) {
+		t.Errorf("unexpected documents %+v", documents)
+	}
+}
+
+func TestImportCollectionInvalid(t *testing.T) {
+	db, _ := memvdb.NewMemoryVectorDb("", false)
+	db.CreateSchema(context.Background(), models.Schema{ClassName: "docs"})
+	if _, err := vectordb.ImportCollection(context.Background(), db, "docs", strings.NewReader(`{"embeddings":[1]}`)); err == nil {
+		t.Error("expected an error for a document without id")
+	}
+}
@@ -0,0 +1,15 @@
+package vectordb
+
+import (
+	"context"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// KeywordSearcher is implemented by backends with a keyword index, such as a full-text index.
+type KeywordSearcher interface {
+	// SearchDocuments returns the documents of a schema whose content or metadata values contain words of
+	// the query, most relevant first. The score of a result is its keyword relevance. Filter, Limit and
+	// Offset of the query options apply; the similarity threshold does not.
+	SearchDocuments(ctx context.Context, classname, query string, queryOptions models.VectorDBQueryOptions) ([]models.Document, error)
+}
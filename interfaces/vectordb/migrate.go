@@ -0,0 +1,109 @@
+package vectordb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// DefaultMigrationBatchSize is the number of documents Migrate writes at once if no batch size is set.
+const DefaultMigrationBatchSize = 500
+
+// MigrationOptions configure Migrate.
+type MigrationOptions struct {
+	Classnames    []string                // Schemas to migrate, all schemas of the source if empty
+	BatchSize     int                     // Documents written per batch, defaults to DefaultMigrationBatchSize
+	CreateSchemas bool                    // Create missing schemas in the target from the definitions of the source
+	Resume        map[string]string       // Last migrated document ID per schema of an interrupted migration
+	Progress      func(MigrationProgress) // Called after every written batch
+	Transform     func(*models.Document)  // Optional change applied to every document before it is written
+}
+
+// MigrationProgress reports the state of a migration. Persisting LastID per schema and passing it as
+// Resume continues an interrupted migration.
+type MigrationProgress struct {
+	Classname string // Schema being migrated
+	LastID    string // ID of the last written document of the schema
+	Migrated  int    // Documents written for the schema in this run
+	Total     int    // Documents written for all schemas in this run
+}
+
+// Migrate streams documents from one backend to another, preserving their IDs, metadata, content and
+// vectors. Documents are read in ascending ID order, so the source must implement Scanner. Documents
+// with existing IDs in the target are replaced, which makes repeating a batch harmless. It returns the
+// number of migrated documents.
+func Migrate(ctx context.Context, source, target VectorDb, options MigrationOptions) (int, error) {
+	scanner, ok := source.(Scanner)
+	if !ok {
+		return 0, ErrScanUnsupported
+	}
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultMigrationBatchSize
+	}
+
+	classnames := options.Classnames
+	if len(classnames) == 0 {
+		var err error
+		if classnames, err = source.GetSchemas(ctx); err != nil {
+			return 0, fmt.Errorf("failed to list schemas: %w", err)
+		}
+	}
+
+	var total int
+	for _, classname := range classnames {
+		if options.CreateSchemas {
+			schema, err := source.GetSchema(ctx, classname)
+			if err != nil {
+				return total, fmt.Errorf("failed to read schema %s: %w", classname, err)
+			}
+			if err := target.CreateSchema(ctx, schema); err != nil && !errors.Is(err, ErrSchemaExists) {
+				return total, fmt.Errorf("failed to create schema %s: %w", classname, err)
+			}
+		}
+
+		progress := MigrationProgress{Classname: classname, LastID: options.Resume[classname]}
+		batch := make([]models.Document, 0, batchSize)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := target.AddDocuments(ctx, classname, batch); err != nil {
+				return fmt.Errorf("failed to write documents after %s: %w", progress.LastID, err)
+			}
+
+			progress.LastID = batch[len(batch)-1].ID
+			progress.Migrated += len(batch)
+			total += len(batch)
+			progress.Total = total
+			if options.Progress != nil {
+				options.Progress(progress)
+			}
+			batch = batch[:0]
+			return nil
+		}
+
+		err := scanner.ScanDocuments(ctx, classname, progress.LastID, func(document models.Document) error {
+			document.ClassName = classname
+			if options.Transform != nil {
+				options.Transform(&document)
+			}
+			batch = append(batch, document)
+			if len(batch) == batchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return total, fmt.Errorf("failed to migrate %s: %w", classname, err)
+		}
+	}
+
+	return total, nil
+}
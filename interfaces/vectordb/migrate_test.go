@@ -0,0 +1,57 @@
+package vectordb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	source, _ := memvdb.NewMemoryVectorDb("", false)
+	for _, classname := range []string{"a", "b"} {
+		source.CreateSchema(ctx, models.Schema{ClassName: classname})
+		for i := 0; i < 5; i++ {
+			source.AddDocument(ctx, classname, fmt.Sprint(i), models.Document{Embeddings: []float32{1, float32(i)}, Content: classname})
+		}
+	}
+
+	// the first run fails after the first batch
+	target := aicompaniontest.NewFakeVectorDb()
+	failing := errors.New("connection lost")
+	var checkpoint map[string]string
+	_, err := vectordb.Migrate(ctx, source, target, vectordb.MigrationOptions{
+		BatchSize: 2,
+		Progress: func(progress vectordb.MigrationProgress) {
+			checkpoint = map[string]string{progress.Classname: progress.LastID}
+			target.Err = failing
+		},
+	})
+	if !errors.Is(err, failing) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if checkpoint["a"] != "1" {
+		t.Fatalf("unexpected checkpoint %v", checkpoint)
+	}
+
+	target.Err = nil
+	migrated, err := vectordb.Migrate(ctx, source, target, vectordb.MigrationOptions{BatchSize: 2, Resume: checkpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 8 {
+		t.Errorf("expected 8 migrated documents, got %d", migrated)
+	}
+	for _, classname := range []string{"a", "b"} {
+		documents := target.Documents(classname)
+		if len(documents) != 5 || documents[4].Content != classname {
+			t.Errorf("unexpected documents in %s: %+v", classname, documents)
+		}
+	}
+}
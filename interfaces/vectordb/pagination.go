@@ -0,0 +1,70 @@
+package vectordb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrInvalidCursor is returned for malformed continuation tokens.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the content of a continuation token.
+type cursor struct {
+	Offset int `json:"o"`
+}
+
+// EncodeCursor creates the continuation token for the page starting at offset.
+func EncodeCursor(offset int) string {
+	data, _ := json.Marshal(cursor{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor returns the offset of a continuation token.
+func DecodeCursor(token string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	var decoded cursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return decoded.Offset, nil
+}
+
+// QueryPage queries a page of documents from any backend. The limit of the query options is the page size,
+// and the page starts at the cursor or, without one, at the offset. The returned page carries the cursor of
+// the next page, if there is one. A limit of 0 returns all remaining documents.
+func QueryPage(ctx context.Context, db VectorDb, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) (models.DocumentPage, error) {
+	if queryOptions.Cursor != "" {
+		offset, err := DecodeCursor(queryOptions.Cursor)
+		if err != nil {
+			return models.DocumentPage{}, err
+		}
+		queryOptions.Offset = offset
+		queryOptions.Cursor = ""
+	}
+
+	pageSize := queryOptions.Limit
+	if pageSize > 0 {
+		// fetch one more document to learn whether another page follows
+		queryOptions.Limit++
+	}
+
+	documents, err := db.QueryDocuments(ctx, classname, vector, queryOptions)
+	if err != nil {
+		return models.DocumentPage{}, err
+	}
+
+	page := models.DocumentPage{Documents: documents}
+	if pageSize > 0 && len(documents) > pageSize {
+		page.Documents = documents[:pageSize]
+		page.NextCursor = EncodeCursor(queryOptions.Offset + pageSize)
+	}
+	return page, nil
+}
@@ -0,0 +1,47 @@
+package vectordb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestQueryPage(t *testing.T) {
+	ctx := context.Background()
+	db, _ := memvdb.NewMemoryVectorDb("", false)
+	db.CreateSchema(ctx, models.Schema{ClassName: "docs"})
+	for i := 0; i < 5; i++ {
+		db.AddDocument(ctx, "docs", fmt.Sprint(i), models.Document{Embeddings: []float32{1, float32(i)}})
+	}
+
+	var ids []string
+	options := models.VectorDBQueryOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		page, err := vectordb.QueryPage(ctx, db, "docs", []float32{1, 0}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, document := range page.Documents {
+			ids = append(ids, document.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+
+	if fmt.Sprint(ids) != "[0 1 2 3 4]" {
+		t.Errorf("unexpected documents %v", ids)
+	}
+
+	if _, err := vectordb.QueryPage(ctx, db, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Cursor: "%%"}); err != vectordb.ErrInvalidCursor {
+		t.Errorf("expected invalid cursor error, got %v", err)
+	}
+}
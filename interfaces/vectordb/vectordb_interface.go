@@ -2,21 +2,38 @@ package vectordb
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ghmer/aicompanion/models"
 )
 
-// AICompanion defines the interface for interacting with AI models.
+// errors shared by all backends
+var (
+	ErrSchemaNotExists   = errors.New("schema does not exist")
+	ErrSchemaExists      = errors.New("schema already exists")
+	ErrDocumentNotExists = errors.New("document does not exist")
+	// ErrDimensionMismatch is returned for documents or query vectors whose number of dimensions
+	// differs from the embeddings of the schema.
+	ErrDimensionMismatch = errors.New("vector dimensions do not match the schema")
+)
+
+// VectorDb defines the interface all vector database backends implement. Backends share the semantics
+// of QueryDocuments: the score of a document is the cosine similarity to the query vector, filters match
+// metadata values exactly, documents below the similarity threshold are dropped, results are sorted by
+// descending score and a limit of 0 returns all matches. The helpers in impl/vdbutil implement these
+// semantics for backends that score documents themselves.
 type VectorDb interface {
 	AddDocument(ctx context.Context, classname, id string, document models.Document) error
 	AddDocuments(ctx context.Context, classname string, documents []models.Document) error
 	UpdateDocument(ctx context.Context, classname, id string, document models.Document) error
 	UpdateDocuments(ctx context.Context, classname string, documents []models.Document) error
 	QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error)
+	GetDocument(ctx context.Context, classname, id string) (models.Document, error)
+	ListDocuments(ctx context.Context, classname string, listOptions models.DocumentListOptions) ([]models.Document, error)
 	DeleteDocument(ctx context.Context, classname, id string) error
 	DeleteDocuments(ctx context.Context, classname string, ids []string) error
-	CreateSchema(ctx context.Context, classname any) error
-	GetSchema(ctx context.Context, classname string) (any, error)
+	CreateSchema(ctx context.Context, schema models.Schema) error
+	GetSchema(ctx context.Context, classname string) (models.Schema, error)
 	GetSchemas(ctx context.Context) ([]string, error)
 	DeleteSchema(ctx context.Context, classname string) error
 	DeleteSchemas(ctx context.Context, classnames []string) error
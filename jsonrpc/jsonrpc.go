@@ -0,0 +1,390 @@
+// Package jsonrpc exposes a companion over a JSON-RPC 2.0 connection, typically stdin and stdout,
+// so editors and agent hosts can embed it as a subprocess without HTTP.
+//
+// Messages are newline delimited JSON objects. Streamed answers are reported as "stream.delta"
+// notifications before the final response of the request.
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ghmer/aicompanion"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// Version is the JSON-RPC protocol version.
+const Version = "2.0"
+
+// maxMessageSize is the maximum size of a single incoming message, large enough for inline images.
+const maxMessageSize = 64 * 1024 * 1024
+
+// standard and implementation defined error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeCancelled      = -32800
+)
+
+// Request is an incoming call or notification. Notifications have no id.
+type Request struct {
+	JsonRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the answer to a call.
+type Response struct {
+	JsonRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Notification is a message without id sent to the client.
+type Notification struct {
+	JsonRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// ChatParams are the parameters of the chat, stream and generate methods.
+type ChatParams struct {
+	Content string               `json:"content"`
+	Images  []models.Base64Image `json:"images,omitempty"`  // raw base64 or data uris
+	System  string               `json:"system,omitempty"`  // optional prompt replacing the system role for this request
+	Persona string               `json:"persona,omitempty"` // optional persona whose system prompt replaces the system role for this request
+	Tools   bool                 `json:"tools,omitempty"`   // offer the registered tools to the model
+}
+
+// ToolCallParams are the parameters of the tools/call method.
+type ToolCallParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// CancelParams are the parameters of the cancel method.
+type CancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// Delta is the payload of a stream.delta notification.
+type Delta struct {
+	ID      json.RawMessage `json:"id"`
+	Content string          `json:"content"`
+}
+
+// Server handles JSON-RPC requests for a companion. Calls run concurrently, but requests
+// that use the companion are serialized, since it holds a single conversation.
+type Server struct {
+	Companion aicompanion.AICompanion
+	Tools     []models.Tool
+
+	companionMutex sync.Mutex
+	writeMutex     sync.Mutex
+	writer         io.Writer
+
+	requestMutex sync.Mutex
+	inflight     map[string]context.CancelFunc
+	shutdown     context.CancelFunc
+}
+
+// NewServer creates a new Server for the given companion and tools.
+func NewServer(companion aicompanion.AICompanion, tools ...models.Tool) *Server {
+	return &Server{Companion: companion, Tools: tools, inflight: make(map[string]context.CancelFunc)}
+}
+
+// Serve reads requests from r and writes responses and notifications to w until r is exhausted,
+// ctx is cancelled or the client calls shutdown. In-flight calls are awaited before returning.
+func (server *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	server.writer = w
+	server.shutdown = cancel
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+
+			var request Request
+			if err := json.Unmarshal(line, &request); err != nil {
+				server.respond(Response{ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}})
+				continue
+			}
+			if request.JsonRPC != Version || request.Method == "" {
+				server.respond(Response{ID: nullID(request.ID), Error: &Error{Code: CodeInvalidRequest, Message: "invalid request"}})
+				continue
+			}
+
+			// cancellation must not wait behind the call it cancels
+			if request.Method == "cancel" {
+				server.handle(ctx, request)
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				server.handle(ctx, request)
+			}()
+		}
+	}
+}
+
+// handle dispatches a request and writes its response.
+func (server *Server) handle(ctx context.Context, request Request) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	key := string(request.ID)
+	if request.ID != nil {
+		server.requestMutex.Lock()
+		server.inflight[key] = cancel
+		server.requestMutex.Unlock()
+
+		defer func() {
+			server.requestMutex.Lock()
+			delete(server.inflight, key)
+			server.requestMutex.Unlock()
+		}()
+	}
+
+	result, err := server.dispatch(ctx, request)
+
+	// notifications never receive a response
+	if request.ID == nil {
+		if err != nil {
+			sideKick.Error(err)
+		}
+		return
+	}
+
+	response := Response{ID: request.ID, Result: result}
+	if err != nil {
+		var rpcErr *Error
+		switch {
+		case errors.As(err, &rpcErr):
+			response.Error = rpcErr
+		case ctx.Err() != nil:
+			response.Error = &Error{Code: CodeCancelled, Message: "request cancelled"}
+		default:
+			response.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		response.Result = nil
+	} else if result == nil {
+		response.Result = struct{}{}
+	}
+	server.respond(response)
+}
+
+// dispatch executes a method.
+func (server *Server) dispatch(ctx context.Context, request Request) (any, error) {
+	switch request.Method {
+	case "initialize":
+		return map[string]any{
+			"name":    "aicompanion",
+			"methods": []string{"chat", "stream", "generate", "reset", "conversation/get", "tools/list", "tools/call", "cancel", "shutdown"},
+		}, nil
+	case "chat", "stream", "generate":
+		var params ChatParams
+		if err := decodeParams(request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.chat(ctx, request, params)
+	case "reset":
+		server.companionMutex.Lock()
+		defer server.companionMutex.Unlock()
+		server.Companion.SetConversation(nil)
+		return nil, nil
+	case "conversation/get":
+		server.companionMutex.Lock()
+		defer server.companionMutex.Unlock()
+		conversation := server.Companion.GetConversation()
+		if conversation == nil {
+			conversation = []models.Message{}
+		}
+		return conversation, nil
+	case "tools/list":
+		functions := make([]models.Function, 0, len(server.Tools))
+		for _, tool := range server.Tools {
+			functions = append(functions, tool.Function)
+		}
+		return functions, nil
+	case "tools/call":
+		var params ToolCallParams
+		if err := decodeParams(request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.callTool(ctx, params)
+	case "cancel":
+		var params CancelParams
+		if err := decodeParams(request.Params, &params); err != nil {
+			return nil, err
+		}
+		server.requestMutex.Lock()
+		cancel, exists := server.inflight[string(params.ID)]
+		server.requestMutex.Unlock()
+		if exists {
+			cancel()
+		}
+		return map[string]bool{"cancelled": exists}, nil
+	case "shutdown":
+		server.shutdown()
+		return nil, nil
+	}
+
+	return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + request.Method}
+}
+
+// chat sends a chat or generate request to the companion, streaming deltas for the stream method.
+func (server *Server) chat(ctx context.Context, request Request, params ChatParams) (any, error) {
+	if params.Content == "" && len(params.Images) == 0 {
+		return nil, &Error{Code: CodeInvalidParams, Message: "content must not be empty"}
+	}
+
+	var images *[]models.Base64Image
+	if len(params.Images) > 0 {
+		images = &params.Images
+	}
+
+	message := sideKick.CreateUserMessage(params.Content, images)
+	messageRequest := models.MessageRequest{Message: message, SystemPrompt: params.System, Persona: params.Persona}
+	if params.Tools {
+		for _, tool := range server.Tools {
+			messageRequest.Tools = append(messageRequest.Tools, tool.Function)
+		}
+	}
+
+	streaming := request.Method == "stream"
+	callback := func(m models.Message) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		server.notify("stream.delta", Delta{ID: request.ID, Content: m.Content})
+		return nil
+	}
+
+	server.companionMutex.Lock()
+	defer server.companionMutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if request.Method == "generate" {
+		return server.Companion.SendGenerateRequest(ctx, messageRequest, streaming, nil)
+	}
+	if !streaming {
+		callback = nil
+	}
+	return server.Companion.SendChatRequest(ctx, messageRequest, streaming, callback)
+}
+
+// callTool runs one of the registered tools.
+func (server *Server) callTool(ctx context.Context, params ToolCallParams) (any, error) {
+	for _, tool := range server.Tools {
+		if tool.Function.Function.FunctionName != params.Name {
+			continue
+		}
+
+		payload := models.FunctionPayload{FunctionName: params.Name, Arguments: params.Arguments}
+		return server.Companion.RunFunction(ctx, tool, payload)
+	}
+
+	return nil, &Error{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+}
+
+// respond writes a response.
+func (server *Server) respond(response Response) {
+	response.JsonRPC = Version
+	server.write(response)
+}
+
+// notify writes a notification.
+func (server *Server) notify(method string, params any) {
+	server.write(Notification{JsonRPC: Version, Method: method, Params: params})
+}
+
+// write encodes a message as a single line.
+func (server *Server) write(message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		sideKick.Error(err)
+		return
+	}
+
+	server.writeMutex.Lock()
+	defer server.writeMutex.Unlock()
+	if _, err := server.writer.Write(append(data, '\n')); err != nil {
+		sideKick.Error(err)
+	}
+}
+
+// decodeParams decodes the params of a request.
+func decodeParams(raw json.RawMessage, target any) error {
+	if len(raw) == 0 {
+		return &Error{Code: CodeInvalidParams, Message: "missing params"}
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// nullID returns the id of a request or null if it has none.
+func nullID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
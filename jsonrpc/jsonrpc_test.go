@@ -0,0 +1,66 @@
+package jsonrpc_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/jsonrpc"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestServer(t *testing.T) {
+	tool := models.Tool{Function: models.Function{
+		Type:     models.TypeFunction,
+		Function: models.FunctionDefinition{FunctionName: "get_weather"},
+	}}
+	server := jsonrpc.NewServer(nil, tool)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":3,"method":"chat","params":{"content":""}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"cancel","params":{"id":99}}`,
+	}, "\n")
+
+	var output strings.Builder
+	if err := server.Serve(context.Background(), strings.NewReader(input), &output); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+
+	responses := make(map[string]jsonrpc.Response)
+	scanner := bufio.NewScanner(strings.NewReader(output.String()))
+	for scanner.Scan() {
+		var response jsonrpc.Response
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			t.Fatalf("invalid response %q: %v", scanner.Text(), err)
+		}
+		responses[string(response.ID)] = response
+	}
+
+	if len(responses) != 5 {
+		t.Fatalf("expected 5 responses, got %d: %s", len(responses), output.String())
+	}
+
+	if functions, ok := responses["1"].Result.([]any); !ok || len(functions) != 1 {
+		t.Errorf("expected one tool, got %v", responses["1"].Result)
+	}
+
+	expectedCodes := map[string]int{
+		"2":    jsonrpc.CodeMethodNotFound,
+		"null": jsonrpc.CodeParseError,
+		"3":    jsonrpc.CodeInvalidParams,
+	}
+	for id, code := range expectedCodes {
+		if responses[id].Error == nil || responses[id].Error.Code != code {
+			t.Errorf("expected error code %d for id %s, got %v", code, id, responses[id].Error)
+		}
+	}
+
+	if result, ok := responses["4"].Result.(map[string]any); !ok || result["cancelled"] != false {
+		t.Errorf("expected cancelled false for unknown request, got %v", responses["4"].Result)
+	}
+}
@@ -0,0 +1,109 @@
+package aicompanion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// MetadataPersona is the metadata key holding the persona name of knowledge documents.
+const MetadataPersona = "persona"
+
+// SyncKnowledge embeds the knowledge entries of the active persona into its knowledge class
+// (Persona.KnowledgeClassName) of the vector database of the companion. The class is created if it does
+// not exist. Entries that are already stored are not embedded again, and documents of entries that were
+// removed from the persona are deleted. It returns the number of newly embedded entries.
+//
+// Chat requests of personas with UseKnowledge retrieve the synchronized entries as context.
+func SyncKnowledge(ctx context.Context, companion AICompanion) (int, error) {
+	vectorDb := companion.GetVectorDB()
+	if vectorDb == nil {
+		return 0, errors.New("no vector database configured")
+	}
+
+	config := companion.GetConfig()
+	persona := config.ActivePersona
+	classname := persona.KnowledgeClassName()
+
+	if _, err := vectorDb.GetSchema(ctx, classname); errors.Is(err, vectordb.ErrSchemaNotExists) {
+		if err := vectorDb.CreateSchema(ctx, models.Schema{ClassName: classname}); err != nil {
+			return 0, fmt.Errorf("failed to create %s: %w", classname, err)
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", classname, err)
+	}
+
+	stored, err := vectorDb.ListDocuments(ctx, classname, models.DocumentListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", classname, err)
+	}
+	existing := make(map[string]bool, len(stored))
+	for _, document := range stored {
+		existing[document.ID] = true
+	}
+
+	// entries are identified by their content, so changed entries are stored as new documents
+	wanted := make(map[string]bool, len(persona.Knowledge))
+	var ids, entries []string
+	for _, entry := range persona.Knowledge {
+		id := knowledgeID(entry)
+		if wanted[id] {
+			continue
+		}
+		wanted[id] = true
+		if !existing[id] {
+			ids = append(ids, id)
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) > 0 {
+		sidekick := sidekick_interface.NewSideKick()
+		response, err := companion.SendEmbeddingRequest(ctx, sidekick.CreateEmbeddingRequest(config.AiModels.EmbeddingModel, entries))
+		if err != nil {
+			return 0, fmt.Errorf("failed to embed knowledge: %w", err)
+		}
+		if len(response.Embeddings) != len(entries) {
+			return 0, fmt.Errorf("got %d embeddings for %d knowledge entries", len(response.Embeddings), len(entries))
+		}
+
+		documents := make([]models.Document, len(entries))
+		for i, entry := range entries {
+			documents[i] = models.Document{
+				ID:         ids[i],
+				Embeddings: response.Embeddings[i],
+				Content:    entry,
+				Metadata:   map[string]any{MetadataPersona: persona.Name},
+			}
+		}
+		if err := vectorDb.AddDocuments(ctx, classname, documents); err != nil {
+			return 0, fmt.Errorf("failed to store knowledge: %w", err)
+		}
+	}
+
+	var stale []string
+	for id := range existing {
+		if !wanted[id] {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		if err := vectorDb.DeleteDocuments(ctx, classname, stale); err != nil {
+			return len(entries), fmt.Errorf("failed to delete removed knowledge: %w", err)
+		}
+	}
+
+	return len(entries), nil
+}
+
+// knowledgeID derives the document ID of a knowledge entry from its content.
+func knowledgeID(entry string) string {
+	sum := sha256.Sum256([]byte(entry))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,61 @@
+package aicompanion_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestSyncKnowledge(t *testing.T) {
+	ctx := context.Background()
+	db, _ := memvdb.NewMemoryVectorDb("", false)
+	companion := aicompaniontest.NewFakeCompanion()
+	companion.SetVectorDB(db)
+
+	config := companion.GetConfig()
+	config.ActivePersona.Knowledge = []string{"the office opens at nine", "parking is free on weekends"}
+	config.ActivePersona.UseKnowledge = true
+	companion.SetConfig(config)
+
+	// without synchronized knowledge, chat requests are sent unchanged
+	question := models.Message{Role: models.User, Content: "when does the office open"}
+	if _, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: question}, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if request, _ := companion.LastRequest(); request.Message.Content != question.Content {
+		t.Errorf("unexpected message %q", request.Message.Content)
+	}
+
+	embedded, err := aicompanion.SyncKnowledge(ctx, companion)
+	if err != nil || embedded != 2 {
+		t.Fatalf("expected 2 embedded entries, got %d: %v", embedded, err)
+	}
+
+	if _, err := companion.SendChatRequest(context.Background(), models.MessageRequest{Message: question}, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if request, _ := companion.LastRequest(); !strings.Contains(request.Message.Content, "the office opens at nine") {
+		t.Errorf("expected knowledge in the message, got %q", request.Message.Content)
+	}
+
+	// unchanged entries are kept, removed entries are deleted
+	config.ActivePersona.Knowledge = []string{"the office opens at nine", "the office closes at five"}
+	companion.SetConfig(config)
+	if embedded, err := aicompanion.SyncKnowledge(ctx, companion); err != nil || embedded != 1 {
+		t.Fatalf("expected 1 embedded entry, got %d: %v", embedded, err)
+	}
+	documents, _ := db.ListDocuments(ctx, config.ActivePersona.KnowledgeClassName(), models.DocumentListOptions{})
+	if len(documents) != 2 {
+		t.Errorf("expected 2 documents, got %+v", documents)
+	}
+	for _, document := range documents {
+		if strings.Contains(document.Content, "parking") {
+			t.Errorf("removed entry was not deleted")
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package metrics records what companions and vector databases do: requests by provider, model and
+// status, their latency, the throughput of streamed answers, the time of vector database queries and the
+// hits of caches. Metrics are recorded by a Collector; Prometheus exposes them for scraping.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Collector records metrics. Implementations must be safe for concurrent use.
+type Collector interface {
+	// ObserveRequest records a request to a provider. Operation is the kind of request, e.g. "chat" or
+	// "embedding", and status the outcome as returned by Status.
+	ObserveRequest(provider, model, operation, status string, duration time.Duration)
+
+	// ObserveStream records the tokens of a streamed answer and the time they took from the first chunk.
+	ObserveStream(provider, model string, tokens int, duration time.Duration)
+
+	// ObserveVectorQuery records a query of a vector database, e.g. "query" or "keyword_search".
+	ObserveVectorQuery(operation, status string, duration time.Duration)
+
+	// ObserveCache records a lookup of the named cache.
+	ObserveCache(cache string, hit bool)
+}
+
+// Nop is a Collector discarding all metrics.
+type Nop struct{}
+
+// ObserveRequest implements Collector.
+func (Nop) ObserveRequest(provider, model, operation, status string, duration time.Duration) {}
+
+// ObserveStream implements Collector.
+func (Nop) ObserveStream(provider, model string, tokens int, duration time.Duration) {}
+
+// ObserveVectorQuery implements Collector.
+func (Nop) ObserveVectorQuery(operation, status string, duration time.Duration) {}
+
+// ObserveCache implements Collector.
+func (Nop) ObserveCache(cache string, hit bool) {}
+
+// Status returns the status label of an outcome: "ok", "cancelled", "timeout", the HTTP status code of a
+// *models.ProviderError, or "error".
+func Status(err error) string {
+	var providerErr *models.ProviderError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &providerErr) && providerErr.StatusCode > 0:
+		return strconv.Itoa(providerErr.StatusCode)
+	}
+	return "error"
+}
@@ -0,0 +1,88 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/metrics"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestPrometheus(t *testing.T) {
+	collector := metrics.NewPrometheus()
+	collector.ObserveRequest("openai", "gpt-4o", "chat", "ok", 2*time.Second)
+	collector.ObserveRequest("openai", "gpt-4o", "chat", "429", 100*time.Millisecond)
+	collector.ObserveStream("openai", "gpt-4o", 100, 2*time.Second)
+	collector.ObserveVectorQuery("query", "ok", 20*time.Millisecond)
+	collector.ObserveCache("context_summary", true)
+	collector.ObserveCache("context_summary", false)
+	collector.ObserveCache("context_summary", true)
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE aicompanion_requests_total counter",
+		`aicompanion_requests_total{provider="openai",model="gpt-4o",operation="chat",status="ok"} 1`,
+		`aicompanion_requests_total{provider="openai",model="gpt-4o",operation="chat",status="429"} 1`,
+		"# TYPE aicompanion_request_duration_seconds histogram",
+		`aicompanion_request_duration_seconds_bucket{provider="openai",model="gpt-4o",operation="chat",le="0.1"} 1`,
+		`aicompanion_request_duration_seconds_bucket{provider="openai",model="gpt-4o",operation="chat",le="2.5"} 2`,
+		`aicompanion_request_duration_seconds_bucket{provider="openai",model="gpt-4o",operation="chat",le="+Inf"} 2`,
+		`aicompanion_request_duration_seconds_sum{provider="openai",model="gpt-4o",operation="chat"} 2.1`,
+		`aicompanion_request_duration_seconds_count{provider="openai",model="gpt-4o",operation="chat"} 2`,
+		`aicompanion_streamed_tokens_total{provider="openai",model="gpt-4o"} 100`,
+		`aicompanion_stream_tokens_per_second_bucket{provider="openai",model="gpt-4o",le="50"} 1`,
+		`aicompanion_vectordb_queries_total{operation="query",status="ok"} 1`,
+		`aicompanion_cache_lookups_total{cache="context_summary",result="hit"} 2`,
+		`aicompanion_cache_lookups_total{cache="context_summary",result="miss"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := map[string]error{
+		"ok":        nil,
+		"cancelled": context.Canceled,
+		"timeout":   context.DeadlineExceeded,
+		"429":       &models.ProviderError{StatusCode: 429, Kind: models.ErrRateLimited},
+		"error":     errors.New("failed"),
+	}
+	for expected, err := range tests {
+		if status := metrics.Status(err); status != expected {
+			t.Errorf("expected status %q for %v, got %q", expected, err, status)
+		}
+	}
+}
+
+func TestInstrumentVectorDb(t *testing.T) {
+	collector := metrics.NewPrometheus()
+	db := metrics.InstrumentVectorDb(aicompaniontest.NewFakeVectorDb(), collector)
+
+	ctx := context.Background()
+	if err := db.CreateSchema(ctx, models.Schema{ClassName: "docs"}); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	db.QueryDocuments(ctx, "docs", []float32{1, 0}, models.VectorDBQueryOptions{Limit: 1})
+	db.SearchDocuments(ctx, "docs", "query", models.VectorDBQueryOptions{Limit: 1})
+
+	var body strings.Builder
+	collector.WriteTo(&body)
+	if !strings.Contains(body.String(), `aicompanion_vectordb_query_duration_seconds_count{operation="query"} 1`) ||
+		!strings.Contains(body.String(), `aicompanion_vectordb_query_duration_seconds_count{operation="keyword_search"} 1`) {
+		t.Errorf("expected both queries to be recorded:\n%s", body.String())
+	}
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets of the histograms of Prometheus.
+var (
+	DurationBuckets   = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}      // Seconds of requests
+	QueryBuckets      = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 5} // Seconds of vector database queries
+	ThroughputBuckets = []float64{1, 5, 10, 20, 50, 100, 200, 500}                       // Tokens per second of streams
+)
+
+// Prometheus is a Collector keeping the metrics in memory and serving them in the Prometheus text format,
+// so it can be mounted as scrape endpoint, e.g. at /metrics. The metrics are:
+//
+//	aicompanion_requests_total{provider,model,operation,status}             counter
+//	aicompanion_request_duration_seconds{provider,model,operation}          histogram
+//	aicompanion_streamed_tokens_total{provider,model}                       counter
+//	aicompanion_stream_tokens_per_second{provider,model}                    histogram
+//	aicompanion_vectordb_queries_total{operation,status}                    counter
+//	aicompanion_vectordb_query_duration_seconds{operation}                  histogram
+//	aicompanion_cache_lookups_total{cache,result}                           counter, result is hit or miss
+//
+// The hit rate of a cache is the rate of its hits divided by the rate of all its lookups.
+type Prometheus struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help    string
+	kind    string // counter or histogram
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64  // of counters
+	counts []uint64 // of histograms, per bucket
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheus creates a collector without any recorded metrics.
+func NewPrometheus() *Prometheus {
+	return &Prometheus{families: map[string]*family{
+		"aicompanion_requests_total":                  {help: "Requests to providers.", kind: "counter", labels: []string{"provider", "model", "operation", "status"}},
+		"aicompanion_request_duration_seconds":        {help: "Duration of requests to providers.", kind: "histogram", labels: []string{"provider", "model", "operation"}, buckets: DurationBuckets},
+		"aicompanion_streamed_tokens_total":           {help: "Tokens of streamed answers.", kind: "counter", labels: []string{"provider", "model"}},
+		"aicompanion_stream_tokens_per_second":        {help: "Throughput of streamed answers from their first chunk.", kind: "histogram", labels: []string{"provider", "model"}, buckets: ThroughputBuckets},
+		"aicompanion_vectordb_queries_total":          {help: "Queries of vector databases.", kind: "counter", labels: []string{"operation", "status"}},
+		"aicompanion_vectordb_query_duration_seconds": {help: "Duration of queries of vector databases.", kind: "histogram", labels: []string{"operation"}, buckets: QueryBuckets},
+		"aicompanion_cache_lookups_total":             {help: "Lookups of caches.", kind: "counter", labels: []string{"cache", "result"}},
+	}}
+}
+
+// ObserveRequest implements Collector.
+func (collector *Prometheus) ObserveRequest(provider, model, operation, status string, duration time.Duration) {
+	collector.add("aicompanion_requests_total", 1, provider, model, operation, status)
+	collector.observe("aicompanion_request_duration_seconds", duration.Seconds(), provider, model, operation)
+}
+
+// ObserveStream implements Collector.
+func (collector *Prometheus) ObserveStream(provider, model string, tokens int, duration time.Duration) {
+	collector.add("aicompanion_streamed_tokens_total", float64(tokens), provider, model)
+	if duration > 0 {
+		collector.observe("aicompanion_stream_tokens_per_second", float64(tokens)/duration.Seconds(), provider, model)
+	}
+}
+
+// ObserveVectorQuery implements Collector.
+func (collector *Prometheus) ObserveVectorQuery(operation, status string, duration time.Duration) {
+	collector.add("aicompanion_vectordb_queries_total", 1, operation, status)
+	collector.observe("aicompanion_vectordb_query_duration_seconds", duration.Seconds(), operation)
+}
+
+// ObserveCache implements Collector.
+func (collector *Prometheus) ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	collector.add("aicompanion_cache_lookups_total", 1, cache, result)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (collector *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	collector.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w.
+func (collector *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	var builder strings.Builder
+	names := make([]string, 0, len(collector.families))
+	for name := range collector.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := collector.families[name]
+		fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := family.series[key]
+			labels := formatLabels(family.labels, series.values)
+			if family.kind == "counter" {
+				fmt.Fprintf(&builder, "%s%s %s\n", name, labels, formatValue(series.value))
+				continue
+			}
+			bucketLabels := slices.Concat(family.labels, []string{"le"})
+			for i, bound := range family.buckets {
+				bucket := formatLabels(bucketLabels, slices.Concat(series.values, []string{formatValue(bound)}))
+				fmt.Fprintf(&builder, "%s_bucket%s %d\n", name, bucket, series.counts[i])
+			}
+			bucket := formatLabels(bucketLabels, slices.Concat(series.values, []string{"+Inf"}))
+			fmt.Fprintf(&builder, "%s_bucket%s %d\n", name, bucket, series.count)
+			fmt.Fprintf(&builder, "%s_sum%s %s\n", name, labels, formatValue(series.sum))
+			fmt.Fprintf(&builder, "%s_count%s %d\n", name, labels, series.count)
+		}
+	}
+
+	written, err := io.WriteString(w, builder.String())
+	return int64(written), err
+}
+
+// add adds value to a counter.
+func (collector *Prometheus) add(name string, value float64, labels ...string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.series(name, labels).value += value
+}
+
+// observe adds a sample to a histogram.
+func (collector *Prometheus) observe(name string, value float64, labels ...string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	family := collector.families[name]
+	series := collector.series(name, labels)
+	for i, bound := range family.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// series returns the series of a family with the given label values, creating it if needed.
+func (collector *Prometheus) series(name string, values []string) *series {
+	family := collector.families[name]
+	if family.series == nil {
+		family.series = make(map[string]*series)
+	}
+	key := strings.Join(values, "\xff")
+	current, exists := family.series[key]
+	if !exists {
+		current = &series{values: values, counts: make([]uint64, len(family.buckets))}
+		family.series[key] = current
+	}
+	return current
+}
+
+// formatLabels formats label pairs as {name="value",...}, escaping the values.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, replacer.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatValue formats a sample value.
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
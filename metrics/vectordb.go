@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// VectorDb records the queries of a vector database with a Collector. Vector queries are recorded as
+// "query", keyword searches as "keyword_search"; all other methods are passed through.
+type VectorDb struct {
+	vectordb.VectorDb
+	collector Collector
+}
+
+var (
+	_ vectordb.KeywordSearcher = (*VectorDb)(nil)
+	_ vectordb.Scanner         = (*VectorDb)(nil)
+)
+
+// InstrumentVectorDb returns db recording its queries with collector.
+func InstrumentVectorDb(db vectordb.VectorDb, collector Collector) *VectorDb {
+	return &VectorDb{VectorDb: db, collector: collector}
+}
+
+// QueryDocuments implements vectordb.VectorDb.
+func (db *VectorDb) QueryDocuments(ctx context.Context, classname string, vector []float32, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	start := time.Now()
+	documents, err := db.VectorDb.QueryDocuments(ctx, classname, vector, queryOptions)
+	db.collector.ObserveVectorQuery("query", Status(err), time.Since(start))
+	return documents, err
+}
+
+// SearchDocuments implements vectordb.KeywordSearcher with vdbutil.KeywordSearch, so backends without own
+// keyword index are searched by scanning them.
+func (db *VectorDb) SearchDocuments(ctx context.Context, classname, query string, queryOptions models.VectorDBQueryOptions) ([]models.Document, error) {
+	start := time.Now()
+	documents, err := vdbutil.KeywordSearch(ctx, db.VectorDb, classname, query, queryOptions)
+	db.collector.ObserveVectorQuery("keyword_search", Status(err), time.Since(start))
+	return documents, err
+}
+
+// ScanDocuments implements vectordb.Scanner if the database does, and fails with
+// vectordb.ErrScanUnsupported otherwise.
+func (db *VectorDb) ScanDocuments(ctx context.Context, classname, after string, fn func(models.Document) error) error {
+	scanner, ok := db.VectorDb.(vectordb.Scanner)
+	if !ok {
+		return vectordb.ErrScanUnsupported
+	}
+	return scanner.ScanDocuments(ctx, classname, after, fn)
+}
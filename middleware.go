@@ -0,0 +1,162 @@
+package aicompanion
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// MiddlewareRequest is a message request passing through the middleware of a Chain. BeforeRequest hooks
+// may change it before it is sent.
+type MiddlewareRequest struct {
+	Operation  string                // chat, generate, rag or tool
+	Message    models.MessageRequest // The message; RAG requests only use Message.Message
+	RAGOptions models.RAGOptions     // Options of a RAG request
+	Streaming  bool
+	// Response answers the request without sending it, if a BeforeRequest hook sets it, e.g. from a cache.
+	Response *models.Message
+}
+
+// Middleware hooks into the message requests of a companion, to layer concerns such as redaction,
+// caching or prompt injection detection over any provider. Hooks that are nil are skipped.
+type Middleware struct {
+	// BeforeRequest is called before a request is sent. It may change the request or answer it by setting
+	// its Response; an error fails the request.
+	BeforeRequest func(ctx context.Context, request *MiddlewareRequest) error
+	// AfterResponse is called with the response of a successful request, which it may change; an error
+	// fails the request.
+	AfterResponse func(ctx context.Context, request *MiddlewareRequest, response *models.Message) error
+	// OnStreamChunk is called with each chunk of a streamed response before the callback, which it may
+	// change; an error cancels the stream.
+	OnStreamChunk func(ctx context.Context, request *MiddlewareRequest, chunk *models.Message) error
+	// OnError is called with the error of a failed request and returns the error passed on, e.g. wrapped.
+	// Returning nil keeps the error.
+	OnError func(ctx context.Context, request *MiddlewareRequest, err error) error
+}
+
+// Chain is a companion whose chat, generate, RAG and tool requests pass through middleware. Embedding
+// and moderation requests are sent unchanged. BeforeRequest hooks run in the order the middleware was
+// added, the other hooks in reverse order, so the first middleware wraps all others.
+type Chain struct {
+	AICompanion
+
+	mutex      sync.RWMutex
+	middleware []Middleware
+}
+
+// NewChain returns companion with its requests passing through middleware.
+func NewChain(companion AICompanion, middleware ...Middleware) *Chain {
+	return &Chain{AICompanion: companion, middleware: middleware}
+}
+
+// Use adds middleware to the chain. Requests already being sent are not affected.
+func (chain *Chain) Use(middleware ...Middleware) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.middleware = append(slices.Clip(chain.middleware), middleware...)
+}
+
+// SendChatRequest implements AICompanion.
+func (chain *Chain) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request := &MiddlewareRequest{Operation: "chat", Message: message, Streaming: streaming}
+	return chain.run(ctx, request, callback, func(callback func(m models.Message) error) (models.Message, error) {
+		return chain.AICompanion.SendChatRequest(ctx, request.Message, request.Streaming, callback)
+	})
+}
+
+// SendGenerateRequest implements AICompanion.
+func (chain *Chain) SendGenerateRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request := &MiddlewareRequest{Operation: "generate", Message: message, Streaming: streaming}
+	return chain.run(ctx, request, callback, func(callback func(m models.Message) error) (models.Message, error) {
+		return chain.AICompanion.SendGenerateRequest(ctx, request.Message, request.Streaming, callback)
+	})
+}
+
+// SendRAGRequest implements AICompanion.
+func (chain *Chain) SendRAGRequest(ctx context.Context, message models.Message, options models.RAGOptions, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	request := &MiddlewareRequest{Operation: "rag", Message: models.MessageRequest{Message: message}, RAGOptions: options, Streaming: streaming}
+	return chain.run(ctx, request, callback, func(callback func(m models.Message) error) (models.Message, error) {
+		return chain.AICompanion.SendRAGRequest(ctx, request.Message.Message, request.RAGOptions, request.Streaming, callback)
+	})
+}
+
+// SendToolRequest implements AICompanion.
+func (chain *Chain) SendToolRequest(ctx context.Context, message models.MessageRequest) (models.Message, error) {
+	request := &MiddlewareRequest{Operation: "tool", Message: message}
+	return chain.run(ctx, request, nil, func(func(m models.Message) error) (models.Message, error) {
+		return chain.AICompanion.SendToolRequest(ctx, request.Message)
+	})
+}
+
+// run passes a request through the middleware. A response set by a BeforeRequest hook is returned
+// without sending the request and, if it streams, passed to the callback as single chunk; only the
+// middleware added before that hook sees it.
+func (chain *Chain) run(ctx context.Context, request *MiddlewareRequest, callback func(m models.Message) error, send func(callback func(m models.Message) error) (models.Message, error)) (models.Message, error) {
+	chain.mutex.RLock()
+	middleware := chain.middleware
+	chain.mutex.RUnlock()
+
+	for i, layer := range middleware {
+		if layer.BeforeRequest == nil {
+			continue
+		}
+		if err := layer.BeforeRequest(ctx, request); err != nil {
+			return models.Message{}, fail(ctx, middleware[:i], request, err)
+		}
+		if request.Response != nil {
+			middleware = middleware[:i]
+			break
+		}
+	}
+
+	chunks := callback
+	if callback != nil {
+		chunks = func(chunk models.Message) error {
+			for i := len(middleware) - 1; i >= 0; i-- {
+				if hook := middleware[i].OnStreamChunk; hook != nil {
+					if err := hook(ctx, request, &chunk); err != nil {
+						return err
+					}
+				}
+			}
+			return callback(chunk)
+		}
+	}
+
+	var result models.Message
+	var err error
+	if request.Response != nil {
+		result = *request.Response
+		if request.Streaming && chunks != nil {
+			err = chunks(result)
+		}
+	} else {
+		result, err = send(chunks)
+	}
+	if err != nil {
+		return result, fail(ctx, middleware, request, err)
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if hook := middleware[i].AfterResponse; hook != nil {
+			if err := hook(ctx, request, &result); err != nil {
+				return result, fail(ctx, middleware[:i], request, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// fail passes the error of a request to the OnError hooks of middleware, last first.
+func fail(ctx context.Context, middleware []Middleware, request *MiddlewareRequest, err error) error {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if hook := middleware[i].OnError; hook != nil {
+			if replaced := hook(ctx, request, err); replaced != nil {
+				err = replaced
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package aicompanion_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestMiddleware(t *testing.T) {
+	fake := aicompaniontest.NewFakeCompanion("the secret is out", "second answer")
+	var calls []string
+	trace := func(name string) aicompanion.Middleware {
+		return aicompanion.Middleware{
+			BeforeRequest: func(ctx context.Context, request *aicompanion.MiddlewareRequest) error {
+				calls = append(calls, name+" before "+request.Operation)
+				return nil
+			},
+			AfterResponse: func(ctx context.Context, request *aicompanion.MiddlewareRequest, response *models.Message) error {
+				calls = append(calls, name+" after")
+				return nil
+			},
+		}
+	}
+	redact := aicompanion.Middleware{
+		BeforeRequest: func(ctx context.Context, request *aicompanion.MiddlewareRequest) error {
+			request.Message.Message.Content = strings.ReplaceAll(request.Message.Message.Content, "4111", "****")
+			return nil
+		},
+		OnStreamChunk: func(ctx context.Context, request *aicompanion.MiddlewareRequest, chunk *models.Message) error {
+			chunk.Content = strings.ReplaceAll(chunk.Content, "secret", "******")
+			return nil
+		},
+	}
+
+	companion := aicompanion.NewChain(fake, trace("outer"))
+	companion.Use(trace("inner"), redact)
+
+	var streamed strings.Builder
+	message := models.MessageRequest{Message: models.Message{Role: models.User, Content: "card 4111"}}
+	if _, err := companion.SendChatRequest(context.Background(), message, true, func(m models.Message) error {
+		streamed.WriteString(m.Content)
+		return nil
+	}); err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	if got := fake.Requests()[0].Message.Content; got != "card ****" {
+		t.Errorf("expected the redacted request, got %q", got)
+	}
+	if streamed.String() != "the ****** is out" {
+		t.Errorf("expected the redacted chunks, got %q", streamed.String())
+	}
+	if got := strings.Join(calls, ", "); got != "outer before chat, inner before chat, inner after, outer after" {
+		t.Errorf("unexpected order of the hooks: %s", got)
+	}
+
+	// a cached response is returned without sending the request
+	calls = nil
+	companion.Use(aicompanion.Middleware{
+		BeforeRequest: func(ctx context.Context, request *aicompanion.MiddlewareRequest) error {
+			request.Response = &models.Message{Role: models.Assistant, Content: "cached"}
+			return nil
+		},
+	})
+	result, err := companion.SendGenerateRequest(context.Background(), message, false, nil)
+	if err != nil || result.Content != "cached" || len(fake.Requests()) != 1 {
+		t.Errorf("expected the cached response, got %q (%v) after %d requests", result.Content, err, len(fake.Requests()))
+	}
+	if got := strings.Join(calls, ", "); got != "outer before generate, inner before generate, inner after, outer after" {
+		t.Errorf("unexpected hooks for a cached response: %s", got)
+	}
+
+	// errors pass the OnError hooks
+	failing := aicompaniontest.NewFakeCompanion()
+	failing.Err = errors.New("unavailable")
+	chain := aicompanion.NewChain(failing, aicompanion.Middleware{
+		OnError: func(ctx context.Context, request *aicompanion.MiddlewareRequest, err error) error {
+			return fmt.Errorf("%s request: %w", request.Operation, err)
+		},
+	})
+	if _, err := chain.SendToolRequest(context.Background(), message); err == nil || err.Error() != "tool request: unavailable" || !errors.Is(err, failing.Err) {
+		t.Errorf("expected the wrapped error, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// EnvironmentPrefix is the prefix of the environment variables read by ApplyEnvironment.
+const EnvironmentPrefix = "AICOMPANION_"
+
+// environment maps the environment variables, without prefix, to the configuration values they set.
+var environment = []struct {
+	name string
+	set  func(config *Configuration, value string) error
+}{
+	{"PROVIDER", setString(func(config *Configuration) *string { return (*string)(&config.ApiProvider) })},
+	{"API_KEY", setString(func(config *Configuration) *string { return &config.ApiKey })},
+	{"CHAT_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiChatURL })},
+	{"GENERATE_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiGenerateURL })},
+	{"EMBED_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiEmbedURL })},
+	{"MODERATION_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiModerationURL })},
+	{"MODELS_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiModelsURL })},
+	{"TRANSCRIPTION_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiTranscriptionURL })},
+	{"RERANK_URL", setString(func(config *Configuration) *string { return &config.ApiEndpoints.ApiRerankURL })},
+	{"CHAT_MODEL", setModel(func(config *Configuration) *Model { return &config.AiModels.ChatModel })},
+	{"GENERATE_MODEL", setModel(func(config *Configuration) *Model { return &config.AiModels.GenerateModel })},
+	{"EMBEDDING_MODEL", setModel(func(config *Configuration) *Model { return &config.AiModels.EmbeddingModel })},
+	{"TRANSCRIPTION_MODEL", setModel(func(config *Configuration) *Model { return &config.AiModels.TranscriptionModel })},
+	{"MODERATION_MODEL", setModel(func(config *Configuration) *Model { return &config.AiModels.ModerationModel })},
+	{"RERANK_MODEL", setModel(func(config *Configuration) *Model { return &config.AiModels.RerankModel })},
+	{"HTTP_TIMEOUT", setInt(func(config *Configuration) *int { return &config.HttpConfig.HTTPClientTimeout })},
+	{"MAX_MESSAGES", setInt(func(config *Configuration) *int { return &config.MaxMessages })},
+	{"MAX_CONTEXT_TOKENS", setInt(func(config *Configuration) *int { return &config.MaxContextTokens })},
+	{"KEEP_ALIVE", setString(func(config *Configuration) *string { return &config.Generation.KeepAlive })},
+	{"ENCRYPTION_KEY", setString(func(config *Configuration) *string { return &config.EncryptionKey })},
+	{"DEBUG", setBool(func(config *Configuration) *bool { return &config.Terminal.Debug })},
+	{"TRACE", setBool(func(config *Configuration) *bool { return &config.Terminal.Trace })},
+}
+
+// ApplyEnvironment overrides the configuration with the environment variables that are set and not empty:
+// AICOMPANION_PROVIDER, AICOMPANION_API_KEY, the endpoint URLs AICOMPANION_CHAT_URL, _GENERATE_URL,
+// _EMBED_URL, _MODERATION_URL, _MODELS_URL, _TRANSCRIPTION_URL and _RERANK_URL, the models
+// AICOMPANION_CHAT_MODEL, _GENERATE_MODEL, _EMBEDDING_MODEL, _TRANSCRIPTION_MODEL, _MODERATION_MODEL and
+// _RERANK_MODEL, AICOMPANION_HTTP_TIMEOUT, _MAX_MESSAGES, _MAX_CONTEXT_TOKENS, _KEEP_ALIVE, _ENCRYPTION_KEY,
+// _DEBUG and _TRACE. Variables are looked up with lookup, which defaults to os.LookupEnv.
+func (config *Configuration) ApplyEnvironment(lookup func(key string) (string, bool)) error {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	for _, variable := range environment {
+		value, ok := lookup(EnvironmentPrefix + variable.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := variable.set(config, value); err != nil {
+			return fmt.Errorf("invalid configuration: %s%s: %w", EnvironmentPrefix, variable.name, err)
+		}
+	}
+	return nil
+}
+
+func setString(field func(config *Configuration) *string) func(config *Configuration, value string) error {
+	return func(config *Configuration, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+// setModel sets the model and its display name, unless the name was chosen apart from the model.
+func setModel(field func(config *Configuration) *Model) func(config *Configuration, value string) error {
+	return func(config *Configuration, value string) error {
+		model := field(config)
+		if model.Name == "" || model.Name == model.Model {
+			model.Name = value
+		}
+		model.Model = value
+		return nil
+	}
+}
+
+func setInt(field func(config *Configuration) *int) func(config *Configuration, value string) error {
+	return func(config *Configuration, value string) error {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = number
+		return nil
+	}
+}
+
+func setBool(field func(config *Configuration) *bool) func(config *Configuration, value string) error {
+	return func(config *Configuration, value string) error {
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = flag
+		return nil
+	}
+}
@@ -1,12 +1,18 @@
 package models
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ghmer/aicompanion/terminal"
 )
@@ -15,6 +21,41 @@ type VectorDBQueryOptions struct {
 	Limit               int            `json:"limit,omitempty"`
 	Filter              map[string]any `json:"filter,omitempty"`
 	SimilarityThreshold float64        `json:"similarity_threshold,omitempty"`
+	Offset              int            `json:"offset,omitempty"` // Number of ranked documents to skip
+	Cursor              string         `json:"cursor,omitempty"` // Continuation token of a previous page, takes precedence over Offset
+	Hybrid              *HybridOptions `json:"hybrid,omitempty"` // Combine keyword and vector ranking
+}
+
+// DocumentListOptions select the documents returned by ListDocuments. Documents are listed in ascending
+// ID order.
+type DocumentListOptions struct {
+	Filter map[string]any `json:"filter,omitempty"` // Metadata values documents must match exactly
+	After  string         `json:"after,omitempty"`  // Only list documents whose ID sorts after this one
+	Limit  int            `json:"limit,omitempty"`  // Maximum number of documents, 0 lists all
+}
+
+// HybridOptions enable hybrid retrieval: documents are ranked by BM25 keyword relevance and by vector
+// similarity, and both rankings are combined with reciprocal rank fusion. The score of a result is then
+// its fused score instead of the cosine similarity.
+type HybridOptions struct {
+	Query   string `json:"query"`              // Text the keywords are taken from
+	TextKey string `json:"text_key,omitempty"` // Metadata key holding the text of documents without content, defaults to "text"
+	RRFK    int    `json:"rrf_k,omitempty"`    // Rank constant of the fusion, defaults to 60
+}
+
+// RAGOptions configure a retrieval-augmented chat request.
+type RAGOptions struct {
+	ClassName    string                `json:"classname"`               // Schema the context is retrieved from
+	QueryOptions *VectorDBQueryOptions `json:"query_options,omitempty"` // Overrides Configuration.RAGQueryOptions, if set
+	TextKey      string                `json:"text_key,omitempty"`      // Metadata key holding the text of documents without content, defaults to "text"
+	// PersonaScoped resolves ClassName in the namespace of the active persona, see Persona.NamespacedClassName.
+	PersonaScoped bool `json:"persona_scoped,omitempty"`
+}
+
+// DocumentPage is a page of query results.
+type DocumentPage struct {
+	Documents  []Document `json:"documents"`
+	NextCursor string     `json:"next_cursor,omitempty"` // Token for the next page, empty on the last page
 }
 
 // Model represents an AI model with its name and identifier.
@@ -30,21 +71,132 @@ type Document struct {
 	Score      float64        `json:"score"`
 	Embeddings []float32      `json:"embeddings"`
 	Metadata   map[string]any `json:"metadata"`
+	Content    string         `json:"content,omitempty"` // Text the embeddings were computed from
 }
 
+// Schema is the provider neutral definition of a vector database schema. Backends translate it into
+// their own representation.
+type Schema struct {
+	ClassName  string           `json:"classname"`
+	Properties []SchemaProperty `json:"properties,omitempty"` // Metadata fields known in advance
+	Vector     VectorConfig     `json:"vector"`
+}
+
+// SchemaProperty describes a metadata field of the documents of a schema.
+type SchemaProperty struct {
+	Name       string `json:"name"`
+	DataType   string `json:"data_type,omitempty"`  // e.g. "text", "number" or "bool"
+	Filterable bool   `json:"filterable,omitempty"` // Whether queries filter on the field
+}
+
+// VectorConfig describes the embeddings of a schema.
+type VectorConfig struct {
+	Dimensions int      `json:"dimensions,omitempty"` // Number of dimensions, 0 if not known in advance
+	Distance   Distance `json:"distance,omitempty"`   // Similarity function, defaults to DistanceCosine
+}
+
+// Distance is the similarity function used to compare vectors.
+type Distance string
+
+const (
+	DistanceCosine     Distance = "cosine"
+	DistanceDotProduct Distance = "dot_product"
+	DistanceEuclidean  Distance = "euclidean"
+)
+
 // Configuration represents the configuration for the application.
 type Configuration struct {
-	ApiProvider     ApiProvider          `json:"api_provider"` // API provider used
-	ApiKey          string               `json:"api_key"`      // API key for authentication
-	ApiEndpoints    ApiEndpointUrls      `json:"api_endpoints"`
-	AiModels        AiModels             `json:"ai_models"` // Specific AI model to use
-	HttpConfig      HttpConfiguration    `json:"http_config"`
-	MaxMessages     int                  `json:"max_messages"` // Maximum number of messages in a conversation
-	IncludeStrategy IncludeStrategy      `json:"include_strategy"`
-	Terminal        Terminal             `json:"terminal"`
-	ActivePersona   Persona              `json:"active_persona"`
-	Personas        []Persona            `json:"personas"`
-	RAGQueryOptions VectorDBQueryOptions `json:"rag_query_options"`
+	ApiProvider      ApiProvider           `json:"api_provider"` // API provider used
+	ApiKey           string                `json:"api_key"`      // API key for authentication
+	ApiEndpoints     ApiEndpointUrls       `json:"api_endpoints"`
+	AiModels         AiModels              `json:"ai_models"` // Specific AI model to use
+	HttpConfig       HttpConfiguration     `json:"http_config"`
+	MaxMessages      int                   `json:"max_messages"`                 // Maximum number of messages in a conversation
+	MaxContextTokens int                   `json:"max_context_tokens,omitempty"` // Token budget of the messages of a chat request, 0 disables token trimming
+	IncludeStrategy  IncludeStrategy       `json:"include_strategy"`
+	ContextStrategy  string                `json:"context_strategy,omitempty"` // Name of the strategy selecting the history of a request, defaults to "sliding_window"
+	Terminal         Terminal              `json:"terminal"`
+	ActivePersona    Persona               `json:"active_persona"`
+	Personas         []Persona             `json:"personas"`
+	RAGQueryOptions  VectorDBQueryOptions  `json:"rag_query_options"`
+	Moderation       ModerationConfig      `json:"moderation,omitempty"` // Pre-flight moderation of chat requests
+	ImageDir         string                `json:"image_dir,omitempty"`  // Directory images of Markdown transcripts are written to, defaults to the working directory
+	Tools            []Tool                `json:"tools,omitempty"`      // Tools the model may call with SendToolRequest
+	ToolConfig       ToolConfiguration     `json:"tool_config,omitempty"`
+	EncryptionKey    string                `json:"encryption_key,omitempty"` // Base64 encoded AES key encrypting exported transcripts and, with conversationstore.NewEncryptedStore, stored conversations
+	Pricing          Pricing               `json:"pricing,omitempty"`        // Prices per model, used to estimate the costs of responses
+	Profiles         []Profile             `json:"profiles,omitempty"`       // Provider profiles a companion can switch between
+	ActiveProfile    string                `json:"active_profile,omitempty"` // Profile applied when the companion is created, see aicompanion.NewProfileCompanion
+	Failover         FailoverConfiguration `json:"failover,omitempty"`       // Fallback backends, see aicompanion.NewFailoverCompanion
+	Generation       GenerationOptions     `json:"generation,omitempty"`     // Sampling options of all requests, overridden per request by MessageRequest.Options
+}
+
+// Defaults of the health tracking of failover backends.
+const (
+	DefaultFailoverThreshold = 3
+	DefaultFailoverCooldown  = 30
+)
+
+// FailoverConfiguration routes requests to fallback backends, given as profiles, while the backends before
+// them fail. A backend failing Threshold times in a row is skipped for Cooldown seconds; the next request
+// after the cooldown tries it again.
+type FailoverConfiguration struct {
+	Profiles  []string `json:"profiles,omitempty"`  // Fallback profiles in order, tried after the configured backend
+	Threshold int      `json:"threshold,omitempty"` // Consecutive failures after which a backend is skipped, defaults to DefaultFailoverThreshold
+	Cooldown  int      `json:"cooldown,omitempty"`  // Seconds a failing backend is skipped, defaults to DefaultFailoverCooldown
+}
+
+// Breaker returns the circuit breaker settings of the backends.
+func (config FailoverConfiguration) Breaker() ToolConfiguration {
+	breaker := ToolConfiguration{BreakerThreshold: DefaultFailoverThreshold, BreakerCooldown: DefaultFailoverCooldown}
+	if config.Threshold > 0 {
+		breaker.BreakerThreshold = config.Threshold
+	}
+	if config.Cooldown > 0 {
+		breaker.BreakerCooldown = config.Cooldown
+	}
+	return breaker
+}
+
+// Profile is a named provider backend, e.g. "local-ollama" or "openai-prod". The values it sets replace
+// those of the configuration when it is applied.
+type Profile struct {
+	Name         string          `json:"name"`
+	ApiProvider  ApiProvider     `json:"api_provider,omitempty"`
+	ApiKey       string          `json:"api_key,omitempty"`
+	ApiEndpoints ApiEndpointUrls `json:"api_endpoints,omitempty"` // Replaces all endpoints if any is set; defaults to those of the provider
+	AiModels     AiModels        `json:"ai_models,omitempty"`     // Models that are set replace the configured ones
+}
+
+// GetProfile returns the named profile.
+func (config *Configuration) GetProfile(name string) (Profile, bool) {
+	for _, profile := range config.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ModerationAction defines how a chat request is handled if its message violates the moderation thresholds.
+type ModerationAction string
+
+const (
+	ModerationBlock    ModerationAction = "block"    // Reject the request with a *ModerationError
+	ModerationRedact   ModerationAction = "redact"   // Replace the content of the message with the redaction text
+	ModerationAnnotate ModerationAction = "annotate" // Send the message unchanged, but record the verdict on it
+)
+
+// DefaultRedactionText replaces the content of redacted messages.
+const DefaultRedactionText = "[content removed by moderation]"
+
+// ModerationConfig configures the opt-in moderation of user messages before chat requests.
+type ModerationConfig struct {
+	Enabled          bool               `json:"enabled"`
+	Action           ModerationAction   `json:"action,omitempty"`            // Defaults to ModerationBlock
+	Thresholds       map[string]float64 `json:"thresholds,omitempty"`        // Minimum score per category that counts as violation
+	DefaultThreshold float64            `json:"default_threshold,omitempty"` // Threshold for categories without own threshold; zero uses the flags of the provider
+	RedactionText    string             `json:"redaction_text,omitempty"`    // Defaults to DefaultRedactionText
 }
 
 func (config *Configuration) GetPersona(persona string) Persona {
@@ -86,6 +238,29 @@ type Persona struct {
 	UseFunctions  bool     `json:"use_functions"`
 }
 
+// NamespacePrefix returns the prefix of the vector database classes in the namespace of the persona.
+// Characters of the name other than letters and digits become underscores; runs of them are collapsed,
+// so the prefix of one persona never starts another one's.
+func (persona *Persona) NamespacePrefix() string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return ' '
+	}, strings.ToLower(persona.Name))
+	return "persona_" + strings.Join(strings.Fields(name), "_") + "__"
+}
+
+// NamespacedClassName returns the class with the given name in the namespace of the persona.
+func (persona *Persona) NamespacedClassName(classname string) string {
+	return persona.NamespacePrefix() + classname
+}
+
+// KnowledgeClassName returns the vector database class holding the embedded knowledge of the persona.
+func (persona *Persona) KnowledgeClassName() string {
+	return persona.NamespacedClassName("knowledge")
+}
+
 func (persona *Persona) AddKnowledge(knowledge string) {
 	persona.Knowledge = append(persona.Knowledge, knowledge)
 }
@@ -120,24 +295,152 @@ type Prompt struct {
 
 // AiModels represents the AI models used by the application.
 type AiModels struct {
-	ChatModel      Model `json:"chat_model"`
-	GenerateModel  Model `json:"generate_model"`
-	EmbeddingModel Model `json:"embedding_model"`
+	ChatModel          Model `json:"chat_model"`
+	GenerateModel      Model `json:"generate_model"`
+	EmbeddingModel     Model `json:"embedding_model"`
+	TranscriptionModel Model `json:"transcription_model,omitempty"` // Speech to text model, where supported
+	ModerationModel    Model `json:"moderation_model,omitempty"`    // Guard model judging moderation requests, where no moderation api exists
+	RerankModel        Model `json:"rerank_model,omitempty"`        // Reranking model, where supported
 }
 
 type ApiEndpointUrls struct {
-	ApiChatURL       string `json:"api_chat_url"`       // URL for chat API
-	ApiGenerateURL   string `json:"api_generate_url"`   // URL for generate API
-	ApiEmbedURL      string `json:"api_embed_url"`      // URL for embedding API
-	ApiModerationURL string `json:"api_moderation_url"` // URL for moderation API
-	ApiModelsURL     string `json:"api_models_url"`     // URL for model API
+	ApiChatURL          string `json:"api_chat_url"`                    // URL for chat API
+	ApiGenerateURL      string `json:"api_generate_url"`                // URL for generate API
+	ApiEmbedURL         string `json:"api_embed_url"`                   // URL for embedding API
+	ApiModerationURL    string `json:"api_moderation_url"`              // URL for moderation API
+	ApiModelsURL        string `json:"api_models_url"`                  // URL for model API
+	ApiTranscriptionURL string `json:"api_transcription_url,omitempty"` // URL for transcription API, where supported
+	ApiRerankURL        string `json:"api_rerank_url,omitempty"`        // URL for rerank API, where supported
+}
+
+// DefaultToolConcurrency is the number of tool calls run at the same time if
+// ToolConfiguration.MaxConcurrency is not set.
+const DefaultToolConcurrency = 4
+
+// Defaults of the retries and circuit breaker of tool calls.
+const (
+	DefaultToolRetryBackoff    = 500 * time.Millisecond
+	DefaultToolBreakerCooldown = 30 * time.Second
+)
+
+// ToolConfiguration configures how the tool calls of a response are run. Calls failing because the tool
+// is unavailable - they time out, fail on the network or are answered with status 429 or 5xx - are
+// retried and count towards the circuit breaker of the function.
+type ToolConfiguration struct {
+	MaxConcurrency   int            `json:"max_concurrency,omitempty"`   // Tool calls run at the same time, defaults to DefaultToolConcurrency; 1 runs them one after another
+	Timeout          int            `json:"timeout,omitempty"`           // Seconds an attempt of a tool call may take, 0 for no limit besides the HTTP client timeout
+	Timeouts         map[string]int `json:"timeouts,omitempty"`          // Timeout in seconds per function name, overriding Timeout
+	Retries          int            `json:"retries,omitempty"`           // Retries of calls failing because the tool is unavailable
+	RetryBackoff     int            `json:"retry_backoff_ms,omitempty"`  // Milliseconds before the first retry, doubled for each further one; defaults to DefaultToolRetryBackoff
+	BreakerThreshold int            `json:"breaker_threshold,omitempty"` // Consecutive failed calls after which a function is not called for BreakerCooldown, 0 to never stop calling it
+	BreakerCooldown  int            `json:"breaker_cooldown,omitempty"`  // Seconds a function is not called once its breaker opened, defaults to DefaultToolBreakerCooldown
+}
+
+// Backoff returns the time to wait before the given retry, starting at 1.
+func (config ToolConfiguration) Backoff(retry int) time.Duration {
+	backoff := DefaultToolRetryBackoff
+	if config.RetryBackoff > 0 {
+		backoff = time.Duration(config.RetryBackoff) * time.Millisecond
+	}
+	return backoff << (retry - 1)
+}
+
+// Cooldown returns how long a function is not called once its circuit breaker opened.
+func (config ToolConfiguration) Cooldown() time.Duration {
+	if config.BreakerCooldown > 0 {
+		return time.Duration(config.BreakerCooldown) * time.Second
+	}
+	return DefaultToolBreakerCooldown
+}
+
+// CallTimeout returns the timeout of calls of the named function, 0 for none.
+func (config ToolConfiguration) CallTimeout(function string) time.Duration {
+	if timeout, exists := config.Timeouts[function]; exists {
+		return time.Duration(timeout) * time.Second
+	}
+	return time.Duration(config.Timeout) * time.Second
 }
 
 type HttpConfiguration struct {
-	HTTPClientTimeout int `json:"http_client_timeout"` // HTTP client timeout duration
+	HTTPClientTimeout int                `json:"http_client_timeout"`     // HTTP client timeout duration
+	MaxLineSize       int                `json:"max_line_size,omitempty"` // Maximum size of a line of a streamed response in bytes, defaults to 16 MB
+	Retry             RetryConfiguration `json:"retry,omitempty"`
+	Audit             AuditConfiguration `json:"audit,omitempty"`
+	DumpDir           string             `json:"dump_dir,omitempty"`            // Directory each request and its response are dumped to in HTTP wire format, for debugging; empty disables the dumps
+	ProxyURL          string             `json:"proxy_url,omitempty"`           // Proxy of all requests, e.g. http://proxy:3128 or socks5://proxy:1080; defaults to the HTTP_PROXY and HTTPS_PROXY environment variables
+	CACertFile        string             `json:"ca_cert_file,omitempty"`        // PEM file of CA certificates trusted in addition to those of the system
+	ClientCertFile    string             `json:"client_cert_file,omitempty"`    // PEM file of the client certificate for mutual TLS, requires ClientKeyFile
+	ClientKeyFile     string             `json:"client_key_file,omitempty"`     // PEM file of the key of the client certificate
+	DisableKeepAlives bool               `json:"disable_keep_alives,omitempty"` // Open a new connection for each request
+	MaxIdleConns      int                `json:"max_idle_conns,omitempty"`      // Idle connections kept per host, defaults to 2
+	IdleConnTimeout   int                `json:"idle_conn_timeout,omitempty"`   // Seconds an idle connection is kept, defaults to 90
+}
+
+// DefaultAuditMaxBodySize is the size up to which bodies are written to the audit trail.
+const DefaultAuditMaxBodySize = 64 * 1024
+
+// AuditConfiguration configures the audit trail of the requests sent to the provider and their
+// responses. Credentials are redacted before they are written.
+type AuditConfiguration struct {
+	File        string `json:"file,omitempty"`          // JSONL file the exchanges are appended to, empty disables the audit trail
+	MaxBodySize int    `json:"max_body_size,omitempty"` // Bytes of a body that are written, defaults to DefaultAuditMaxBodySize; -1 writes no bodies
+}
+
+// AuditRecord is an entry of the audit trail: a request sent to the provider and its response.
+type AuditRecord struct {
+	Time              time.Time         `json:"time"`
+	Method            string            `json:"method"`
+	URL               string            `json:"url"`
+	RequestHeaders    map[string]string `json:"request_headers,omitempty"`
+	RequestBody       string            `json:"request_body,omitempty"`
+	RequestTruncated  bool              `json:"request_truncated,omitempty"` // The request body exceeded the size limit
+	Status            int               `json:"status,omitempty"`
+	ResponseHeaders   map[string]string `json:"response_headers,omitempty"`
+	ResponseBody      string            `json:"response_body,omitempty"` // Streamed responses as received until the body was closed
+	ResponseTruncated bool              `json:"response_truncated,omitempty"`
+	Duration          float64           `json:"duration"` // Seconds until the response body was closed
+	Error             string            `json:"error,omitempty"`
+}
+
+// Defaults of the retries of provider requests.
+const (
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultRetryMaxBackoff = 30 * time.Second
+)
+
+// RetryConfiguration configures the retries of provider requests failing transiently: with a network
+// timeout or with status 408, 429 or 5xx. The wait before a retry doubles with each attempt and is
+// jittered; a Retry-After header of the response takes precedence. Requests are not retried once the
+// client timeout elapsed or the context of the request is done.
+type RetryConfiguration struct {
+	MaxAttempts int `json:"max_attempts,omitempty"`   // Attempts of a request including the first, 0 or 1 disables retries
+	Backoff     int `json:"backoff_ms,omitempty"`     // Milliseconds before the first retry, doubled for each further one; defaults to DefaultRetryBackoff
+	MaxBackoff  int `json:"max_backoff_ms,omitempty"` // Longest wait before a retry in milliseconds, defaults to DefaultRetryMaxBackoff; responses asking to retry later are not retried
+}
+
+// Delay returns the wait before the given retry, starting at 1, before jitter is applied.
+func (config RetryConfiguration) Delay(retry int) time.Duration {
+	backoff := DefaultRetryBackoff
+	if config.Backoff > 0 {
+		backoff = time.Duration(config.Backoff) * time.Millisecond
+	}
+	limit := config.Limit()
+	for i := 1; i < retry && backoff < limit; i++ {
+		backoff *= 2
+	}
+	return min(backoff, limit)
+}
+
+// Limit returns the longest wait before a retry.
+func (config RetryConfiguration) Limit() time.Duration {
+	if config.MaxBackoff > 0 {
+		return time.Duration(config.MaxBackoff) * time.Millisecond
+	}
+	return DefaultRetryMaxBackoff
 }
 
-// NewConfigFromFile creates a new Configuration instance from a JSON file.
+// NewConfigFromFile creates a new Configuration instance from a JSON file. Environment variables override
+// the values of the file, see ApplyEnvironment; indirect secrets are resolved, see ResolveSecrets.
 func NewConfigFromFile(filePath string) (*Configuration, error) {
 	// Read the file content
 	data, err := os.ReadFile(filePath)
@@ -151,16 +454,25 @@ func NewConfigFromFile(filePath string) (*Configuration, error) {
 		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
 	}
 
-	// Perform sanitization
-	if config.AiModels.ChatModel.Model == "" {
-		return nil, errors.New("invalid configuration: ChatModel is required")
+	// Environment variables take precedence over the file
+	if err := config.ApplyEnvironment(nil); err != nil {
+		return nil, err
 	}
+	return newConfig(config)
+}
 
-	// Perform sanitization
-	if config.AiModels.EmbeddingModel.Model == "" {
-		return nil, errors.New("invalid configuration: EmbeddingModel is required")
+// NewConfigFromEnvironment creates a new Configuration instance from environment variables only, see
+// ApplyEnvironment.
+func NewConfigFromEnvironment() (*Configuration, error) {
+	var config Configuration
+	if err := config.ApplyEnvironment(nil); err != nil {
+		return nil, err
 	}
+	return newConfig(config)
+}
 
+// newConfig sets the defaults of a configuration read from a file or the environment and validates it.
+func newConfig(config Configuration) (*Configuration, error) {
 	if config.Terminal.UserColor == "" {
 		config.Terminal.Color = terminal.Green
 	} else {
@@ -173,7 +485,7 @@ func NewConfigFromFile(filePath string) (*Configuration, error) {
 	}
 
 	if config.ApiProvider == "" {
-		config.ApiProvider = "Ollama" // Default api provider
+		config.ApiProvider = Ollama // Default api provider
 	}
 
 	// set default urls if no custom ones were provided
@@ -187,12 +499,6 @@ func NewConfigFromFile(filePath string) (*Configuration, error) {
 		}
 	}
 
-	// Ensure URL starts with http:// or https://
-	if !strings.HasPrefix(config.ApiEndpoints.ApiChatURL, "http://") && !strings.HasPrefix(config.ApiEndpoints.ApiChatURL, "https://") {
-		return nil, errors.New("invalid configuration: ApiChatURL must start with http:// or https://")
-	}
-
-	// If AIType is Generate, validate and set default URLs if not provided
 	if config.ApiEndpoints.ApiGenerateURL == "" {
 		fmt.Print("using default url for generate api: ")
 		if config.ApiProvider == Ollama {
@@ -203,11 +509,6 @@ func NewConfigFromFile(filePath string) (*Configuration, error) {
 		}
 	}
 
-	// Ensure URL starts with http:// or https://
-	if !strings.HasPrefix(config.ApiEndpoints.ApiGenerateURL, "http://") && !strings.HasPrefix(config.ApiEndpoints.ApiGenerateURL, "https://") {
-		return nil, errors.New("invalid configuration: ApiGenerateURL must start with http:// or https://")
-	}
-
 	if config.ApiEndpoints.ApiEmbedURL == "" {
 		fmt.Print("using default url for embed api: ")
 		if config.ApiProvider == Ollama {
@@ -218,11 +519,6 @@ func NewConfigFromFile(filePath string) (*Configuration, error) {
 		}
 	}
 
-	// Ensure URL starts with http:// or https://
-	if !strings.HasPrefix(config.ApiEndpoints.ApiEmbedURL, "http://") && !strings.HasPrefix(config.ApiEndpoints.ApiEmbedURL, "https://") {
-		return nil, errors.New("invalid configuration: ApiEmbedURL must start with http:// or https://")
-	}
-
 	if config.ApiEndpoints.ApiModerationURL == "" {
 		fmt.Print("using default url for moderation api: ")
 		if config.ApiProvider == Ollama {
@@ -233,27 +529,137 @@ func NewConfigFromFile(filePath string) (*Configuration, error) {
 		}
 	}
 
-	// Ensure URL starts with http:// or https://
-	if !strings.HasPrefix(config.ApiEndpoints.ApiModerationURL, "http://") && !strings.HasPrefix(config.ApiEndpoints.ApiModerationURL, "https://") {
-		return nil, errors.New("invalid configuration: ApiModerationURL must start with http:// or https://")
-	}
-
 	if config.HttpConfig.HTTPClientTimeout <= 0 {
 		config.HttpConfig.HTTPClientTimeout = 10 // Default to 10 seconds
 	}
 
-	if config.ApiKey == "" {
-		return nil, errors.New("invalid configuration: api_key is required")
+	// keys are resolved at load time, so they need not be written into the file
+	if err := config.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	// all problems are reported at once
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
 }
 
 type MessageRequest struct {
-	OriginalMessage       Message    `json:"original_message,omitempty"`
-	Message               Message    `json:"message"`
-	RetainOriginalMessage bool       `json:"retain_original"`
-	Tools                 []Function `json:"tools,omitempty"`
+	OriginalMessage       Message            `json:"original_message,omitempty"`
+	Message               Message            `json:"message"`
+	RetainOriginalMessage bool               `json:"retain_original"`
+	Tools                 []Function         `json:"tools,omitempty"`
+	ResponseFormat        *ResponseFormat    `json:"response_format,omitempty"` // Format the response must have, where the provider supports it
+	Options               *GenerationOptions `json:"options,omitempty"`         // Sampling options of this request, overriding those of the configuration
+	SystemPrompt          string             `json:"system_prompt,omitempty"`   // Replaces the system prompt for this request only
+	Persona               string             `json:"persona,omitempty"`         // Name of a persona whose system prompt replaces the active one for this request only
+	SelectChoice          ChoiceSelector     `json:"-"`                         // Selects the answer among the candidates of GenerationOptions.N, defaults to the first
+}
+
+// ChoiceSelector selects one of the candidate answers to message and returns its index. The selected
+// answer is returned and added to the conversation.
+type ChoiceSelector func(ctx context.Context, message Message, choices []Message) (int, error)
+
+// GenerationOptions control how the model samples a response and, on Ollama, how long it stays loaded.
+// Unset options keep the defaults of the model. OpenAI compatible providers support the temperature,
+// top_p, max_tokens, stop, log probabilities and n; the other options are sent to Ollama only.
+type GenerationOptions struct {
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	TopP          *float32 `json:"top_p,omitempty"`
+	RepeatPenalty *float32 `json:"repeat_penalty,omitempty"`
+	MaxTokens     int      `json:"max_tokens,omitempty"`   // Maximum number of tokens to generate, num_predict of Ollama
+	ContextSize   int      `json:"context_size,omitempty"` // Size of the context window, num_ctx of Ollama
+	Stop          []string `json:"stop,omitempty"`         // Sequences that end the response
+	KeepAlive     string   `json:"keep_alive,omitempty"`   // How long Ollama keeps the model loaded after the request, as seconds or duration like "10m"; "0" unloads it at once, negative values keep it loaded
+	LogProbs      bool     `json:"logprobs,omitempty"`     // Return the log probabilities of the tokens of the response, see Message.LogProbs
+	TopLogProbs   int      `json:"top_logprobs,omitempty"` // Number of most likely alternatives returned per token, up to 20; implies LogProbs
+	N             int      `json:"n,omitempty"`            // Number of candidate answers of requests without streaming, see Message.Choices
+}
+
+// ParseKeepAlive parses a keep alive of GenerationOptions, given as seconds or duration.
+func ParseKeepAlive(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("must be seconds or a duration like 10m, got %q", value)
+	}
+	return duration, nil
+}
+
+// Merge returns the options with those set in override replacing them.
+func (options GenerationOptions) Merge(override *GenerationOptions) GenerationOptions {
+	if override == nil {
+		return options
+	}
+	if override.Temperature != nil {
+		options.Temperature = override.Temperature
+	}
+	if override.TopK != nil {
+		options.TopK = override.TopK
+	}
+	if override.TopP != nil {
+		options.TopP = override.TopP
+	}
+	if override.RepeatPenalty != nil {
+		options.RepeatPenalty = override.RepeatPenalty
+	}
+	if override.MaxTokens != 0 {
+		options.MaxTokens = override.MaxTokens
+	}
+	if override.ContextSize != 0 {
+		options.ContextSize = override.ContextSize
+	}
+	if override.Stop != nil {
+		options.Stop = override.Stop
+	}
+	if override.KeepAlive != "" {
+		options.KeepAlive = override.KeepAlive
+	}
+	if override.LogProbs {
+		options.LogProbs = true
+	}
+	if override.TopLogProbs != 0 {
+		options.TopLogProbs = override.TopLogProbs
+	}
+	if override.N != 0 {
+		options.N = override.N
+	}
+	return options
+}
+
+// TokenLogProb is the log probability of a token of a response.
+type TokenLogProb struct {
+	Token       string         `json:"token"`
+	LogProb     float64        `json:"logprob"`
+	Bytes       []int          `json:"bytes,omitempty"`        // UTF-8 bytes of the token, which may be part of a character
+	TopLogProbs []TokenLogProb `json:"top_logprobs,omitempty"` // Most likely tokens at the position, if requested
+}
+
+// Probability returns the probability of the token, between 0 and 1.
+func (logProb TokenLogProb) Probability() float64 {
+	return math.Exp(logProb.LogProb)
+}
+
+// ResponseFormatType is the kind of output a response format demands.
+type ResponseFormatType string
+
+const (
+	JSONObject ResponseFormatType = "json_object" // Any valid JSON object
+	JSONSchema ResponseFormatType = "json_schema" // A JSON object matching the schema
+)
+
+// ResponseFormat demands structured output from the model. OpenAI compatible providers receive it as
+// response_format, Ollama as format; other providers ignore it.
+type ResponseFormat struct {
+	Type   ResponseFormatType `json:"type"`
+	Name   string             `json:"name,omitempty"`   // Name of the schema, required by OpenAI
+	Schema *Parameter         `json:"schema,omitempty"` // Schema of JSONSchema responses
+	Strict bool               `json:"strict,omitempty"` // Asks OpenAI to follow the schema exactly, which requires all properties to be required
 }
 
 // Message represents an individual message in the chat.
@@ -263,16 +669,275 @@ type Message struct {
 	Images          *[]Base64Image `json:"images,omitempty"` // Images associated with the message
 	AlternatePrompt string         `json:"alternate_prompt,omitempty"`
 	ToolCalls       []ToolCall     `json:"tool_calls,omitempty"`
+	ToolCallID      string         `json:"tool_call_id,omitempty"` // ID of the tool call a ToolRole message answers
+	Name            string         `json:"name,omitempty"`         // Name of the function a ToolRole message answers
+	Reasoning       string         `json:"-"`                      // Reasoning of a reasoning model, kept apart from the answer and never sent back
+	Moderation      *Moderation    `json:"-"`                      // Verdict of the pre-flight moderation, never sent to the provider
+	Info            *ResponseInfo  `json:"-"`                      // Provider metadata of a response, never sent to the provider
+	ID              string         `json:"-"`                      // ID assigned by the provider or, when added to the conversation, locally
+	CreatedAt       time.Time      `json:"-"`                      // Time the provider created the message or it was added to the conversation
+	Model           string         `json:"-"`                      // Model that produced the message
+	Usage           *Usage         `json:"-"`                      // Tokens the provider counted for the response, where reported
+	Pinned          bool           `json:"-"`                      // Always sent along with requests, regardless of MaxMessages and token budgets
+	Cancelled       bool           `json:"-"`                      // The stream of the response was cancelled; the message holds what was received until then
+	FinishReason    FinishReason   `json:"-"`                      // Why the model stopped, set on responses and on the last chunk of a stream
+	LogProbs        []TokenLogProb `json:"-"`                      // Log probabilities of the tokens, if requested with GenerationOptions.LogProbs
+	Choices         []Message      `json:"-"`                      // All candidate answers of a response to a request with GenerationOptions.N above 1
+	Cost            *Cost          `json:"-"`                      // Estimated cost of the response, if its model is priced in Configuration.Pricing
+}
+
+// Usage reports the tokens a provider counted for a response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add returns the sum of both usages.
+func (usage Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens + other.PromptTokens,
+		CompletionTokens: usage.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      usage.TotalTokens + other.TotalTokens,
+	}
+}
+
+// UsageReport sums the usage of the responses of a companion.
+type UsageReport struct {
+	Total     Usage            `json:"total"`
+	Responses int              `json:"responses"`          // Responses that reported their usage
+	Sessions  map[string]Usage `json:"sessions,omitempty"` // Usage per conversation session
+	Models    map[string]Usage `json:"models,omitempty"`   // Usage per model, as reported by the provider
+	Costs     *CostReport      `json:"costs,omitempty"`    // Estimated costs of the responses of priced models, nil without any
+}
+
+// Price is the price of a model per 1K tokens.
+type Price struct {
+	Input  float64 `json:"input"`  // Price per 1K prompt tokens
+	Output float64 `json:"output"` // Price per 1K completion tokens
+}
+
+// Pricing is the price table used to estimate the costs of responses.
+type Pricing struct {
+	Currency string           `json:"currency,omitempty"` // Currency of the prices, e.g. USD
+	Models   map[string]Price `json:"models,omitempty"`   // Prices by model name; a name also prices the models it is a prefix of, e.g. dated versions
+}
+
+// Price returns the price of model: the price of its exact name or else of the longest name it starts with.
+func (pricing Pricing) Price(model string) (Price, bool) {
+	if price, ok := pricing.Models[model]; ok {
+		return price, true
+	}
+	var match string
+	for name := range pricing.Models {
+		if len(name) > len(match) && strings.HasPrefix(model, name) {
+			match = name
+		}
+	}
+	if match == "" {
+		return Price{}, false
+	}
+	return pricing.Models[match], true
+}
+
+// Cost is the estimated cost of one or more responses.
+type Cost struct {
+	Input    float64 `json:"input"`
+	Output   float64 `json:"output"`
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+// Add returns the sum of both costs.
+func (cost Cost) Add(other Cost) Cost {
+	currency := cost.Currency
+	if currency == "" {
+		currency = other.Currency
+	}
+	return Cost{
+		Input:    cost.Input + other.Input,
+		Output:   cost.Output + other.Output,
+		Total:    cost.Total + other.Total,
+		Currency: currency,
+	}
+}
+
+// CostReport sums the estimated costs of the responses of a companion.
+type CostReport struct {
+	Total     Cost            `json:"total"`
+	Responses int             `json:"responses"`          // Responses of priced models
+	Sessions  map[string]Cost `json:"sessions,omitempty"` // Costs per conversation session
+	Models    map[string]Cost `json:"models,omitempty"`   // Costs per model
+}
+
+// ConversationFormat is the file format of an exported conversation.
+type ConversationFormat string
+
+const (
+	ConversationJSON     ConversationFormat = "json"     // Lossless
+	ConversationMarkdown ConversationFormat = "markdown" // Readable; keeps roles, times, content and images, but no tool calls
+)
+
+// ConversationExportVersion is the version of the JSON export format.
+const ConversationExportVersion = 1
+
+// ConversationExport is a conversation exported in JSON format.
+type ConversationExport struct {
+	Version  int               `json:"version"`
+	Exported time.Time         `json:"exported"`
+	Messages []ExportedMessage `json:"messages"`
+}
+
+// ExportedMessage is a message of an exported conversation.
+type ExportedMessage struct {
+	ID         string        `json:"id,omitempty"`
+	Role       Role          `json:"role"`
+	Content    string        `json:"content"`
+	CreatedAt  time.Time     `json:"created_at"`
+	Model      string        `json:"model,omitempty"`
+	Usage      *Usage        `json:"usage,omitempty"`
+	Images     []Base64Image `json:"images,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+	Name       string        `json:"name,omitempty"`
+	Pinned     bool          `json:"pinned,omitempty"`
+}
+
+// NewExportedMessage converts a message for export, dropping the fields that only matter at runtime.
+func NewExportedMessage(message Message) ExportedMessage {
+	exported := ExportedMessage{
+		ID:         message.ID,
+		Role:       message.Role,
+		Content:    message.Content,
+		CreatedAt:  message.CreatedAt,
+		Model:      message.Model,
+		Usage:      message.Usage,
+		ToolCalls:  message.ToolCalls,
+		ToolCallID: message.ToolCallID,
+		Name:       message.Name,
+		Pinned:     message.Pinned,
+	}
+	if message.Images != nil {
+		exported.Images = *message.Images
+	}
+	return exported
+}
+
+// Message converts an exported message back into a message.
+func (exported ExportedMessage) Message() Message {
+	message := Message{
+		ID:         exported.ID,
+		Role:       exported.Role,
+		Content:    exported.Content,
+		CreatedAt:  exported.CreatedAt,
+		Model:      exported.Model,
+		Usage:      exported.Usage,
+		ToolCalls:  exported.ToolCalls,
+		ToolCallID: exported.ToolCallID,
+		Name:       exported.Name,
+		Pinned:     exported.Pinned,
+	}
+	if len(exported.Images) > 0 {
+		images := exported.Images
+		message.Images = &images
+	}
+	return message
+}
+
+// ResponseInfo carries metadata a provider reported along with a response.
+type ResponseInfo struct {
+	Provider  string             `json:"provider,omitempty"`   // Upstream provider that served the request, where reported
+	Model     string             `json:"model,omitempty"`      // Model that produced the response
+	RateLimit *RateLimit         `json:"rate_limit,omitempty"` // Rate limit state after the request
+	Timing    map[string]float64 `json:"timing,omitempty"`     // Provider reported timings in seconds, e.g. queue_time
+	Headers   map[string]string  `json:"headers,omitempty"`    // Selected provider specific response headers
+	Backend   string             `json:"backend,omitempty"`    // Failover backend that answered: "primary" or the name of a fallback profile
+}
+
+// RateLimit represents the x-ratelimit-* headers returned by OpenAI compatible providers.
+type RateLimit struct {
+	LimitRequests     int           `json:"limit_requests,omitempty"`
+	LimitTokens       int           `json:"limit_tokens,omitempty"`
+	RemainingRequests int           `json:"remaining_requests,omitempty"`
+	RemainingTokens   int           `json:"remaining_tokens,omitempty"`
+	ResetRequests     time.Duration `json:"reset_requests,omitempty"`
+	ResetTokens       time.Duration `json:"reset_tokens,omitempty"`
+	RetryAfter        time.Duration `json:"retry_after,omitempty"`
+}
+
+// Moderation records the moderation verdict of a message.
+type Moderation struct {
+	Flagged    bool             `json:"flagged"`
+	Action     ModerationAction `json:"action"`
+	Categories []string         `json:"categories,omitempty"` // Categories exceeding their threshold
+}
+
+// ModerationError is returned if a message is blocked by the pre-flight moderation.
+type ModerationError struct {
+	Categories []string
+	Response   ModerationResponse
+}
+
+// Error implements the error interface.
+func (err *ModerationError) Error() string {
+	return fmt.Sprintf("message blocked by moderation: %s", strings.Join(err.Categories, ", "))
+}
+
+// Kinds of provider failures. A *ProviderError of a known kind matches it with errors.Is.
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrContentFiltered       = errors.New("content filtered")
+	ErrServerOverloaded      = errors.New("server overloaded")
+)
+
+// ProviderError is returned if a provider rejects a request or fails while streaming the answer.
+type ProviderError struct {
+	Kind       error  // One of the kinds of provider failures above, nil if the failure is not classified
+	StatusCode int    // HTTP status code of the response, 0 for errors sent within a stream
+	Status     string // HTTP status of the response
+	Code       string // Error code or type reported by the provider
+	Message    string // Error message reported by the provider, or the body of the response
+	RequestID  string // ID of the request reported by the provider, for support requests
+}
+
+// Error implements the error interface.
+func (err *ProviderError) Error() string {
+	var builder strings.Builder
+	if err.StatusCode > 0 {
+		fmt.Fprintf(&builder, "unexpected status code: %d, status: %s", err.StatusCode, err.Status)
+	} else {
+		builder.WriteString("stream failed")
+	}
+	if err.Code != "" {
+		fmt.Fprintf(&builder, ": %s", err.Code)
+	}
+	if err.Message != "" {
+		fmt.Fprintf(&builder, ": %s", err.Message)
+	}
+	if err.RequestID != "" {
+		fmt.Fprintf(&builder, " (request %s)", err.RequestID)
+	}
+	return builder.String()
+}
+
+// Unwrap returns the kind of the failure.
+func (err *ProviderError) Unwrap() error {
+	return err.Kind
 }
 
 // Base64Image represents an image encoded in base64.
 type Base64Image struct {
-	Data string // The base64-encoded data of the image
+	Data     string // The base64-encoded data of the image
+	MimeType string // The content type of the image, e.g. image/png
 }
 
 // SetData encodes the provided byte slice into a base64 string and assigns it to Data.
+// The MIME type is detected from the given bytes.
 func (image *Base64Image) SetData(data []byte) {
 	image.Data = base64.StdEncoding.EncodeToString(data)
+	image.MimeType = DetectMimeType(data)
 }
 
 // GetData decodes the base64-encoded data in Data back into a byte slice.
@@ -280,17 +945,107 @@ func (image *Base64Image) GetData() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(image.Data)
 }
 
+// GetMimeType returns the MIME type of the image, detecting it from the data if it is not set.
+func (image *Base64Image) GetMimeType() string {
+	if image.MimeType != "" {
+		return image.MimeType
+	}
+
+	data, err := image.GetData()
+	if err != nil {
+		return DefaultMimeType
+	}
+
+	return DetectMimeType(data)
+}
+
+// DataURI returns the image as a data URI (data:<mime>;base64,<data>) for providers that expect URLs.
+func (image *Base64Image) DataURI() string {
+	return fmt.Sprintf("data:%s;base64,%s", image.GetMimeType(), image.Data)
+}
+
 // MarshalJSON custom marshals Base64Image as a single string.
 func (b Base64Image) MarshalJSON() ([]byte, error) {
 	return json.Marshal(b.Data)
 }
 
+// UnmarshalJSON unmarshals a Base64Image from a single string. Both raw base64 data and
+// data URIs are accepted; the MIME type is taken from the URI or detected from the data.
+func (b *Base64Image) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("failed to unmarshal image: %w", err)
+	}
+
+	image, err := NewBase64ImageFromString(value)
+	if err != nil {
+		return err
+	}
+
+	*b = image
+	return nil
+}
+
+// DefaultMimeType is used when the content type of an image cannot be detected.
+const DefaultMimeType = "application/octet-stream"
+
+// NewBase64ImageFromString creates a Base64Image from raw base64 data or a data URI.
+func NewBase64ImageFromString(value string) (Base64Image, error) {
+	var image Base64Image
+	if !strings.HasPrefix(value, "data:") {
+		image.Data = value
+		if data, err := image.GetData(); err == nil {
+			image.MimeType = DetectMimeType(data)
+		}
+		return image, nil
+	}
+
+	header, payload, found := strings.Cut(strings.TrimPrefix(value, "data:"), ",")
+	if !found {
+		return image, errors.New("invalid data uri: missing data separator")
+	}
+
+	mimeType, encoding, _ := strings.Cut(header, ";")
+	if encoding != "base64" {
+		return image, fmt.Errorf("invalid data uri: unsupported encoding %q", encoding)
+	}
+
+	image.Data = payload
+	image.MimeType = mimeType
+	if image.MimeType == "" {
+		image.MimeType = image.GetMimeType()
+	}
+
+	return image, nil
+}
+
+// DetectMimeType detects the MIME type of the given image bytes.
+func DetectMimeType(data []byte) string {
+	switch {
+	case len(data) == 0:
+		return DefaultMimeType
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && (string(data[8:12]) == "avif" || string(data[8:12]) == "avis"):
+		return "image/avif"
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "image/tiff"
+	}
+
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return mimeType
+}
+
 // ApiProvider indicates the type of response expected.
 type ApiProvider string
 
 const (
-	OpenAI = "openai" // OpenAI model type
-	Ollama = "ollama" // Ollama model type
+	OpenAI     = "openai"     // OpenAI model type
+	Ollama     = "ollama"     // Ollama model type
+	Groq       = "groq"       // Groq, OpenAI compatible
+	Cohere     = "cohere"     // Cohere model type
+	TGI        = "tgi"        // HuggingFace Text Generation Inference
+	OpenRouter = "openrouter" // OpenRouter, OpenAI compatible
+	LlamaCpp   = "llamacpp"   // llama.cpp server
+	DeepSeek   = "deepseek"   // DeepSeek, OpenAI compatible
 )
 
 // Role represents a role in a conversation, such as user, assistant, or system.
@@ -301,6 +1056,18 @@ const (
 	Developer Role = "developer" // Developer role
 	Assistant Role = "assistant" // Assistant role
 	User      Role = "user"      // User role
+	ToolRole  Role = "tool"      // Result of a tool call
+)
+
+// FinishReason tells why the model stopped generating. Providers' reasons are mapped to the constants
+// below where they match; other reasons are passed on as reported.
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"           // Natural end of the answer or a stop sequence
+	FinishLength        FinishReason = "length"         // Token limit reached
+	FinishToolCalls     FinishReason = "tool_calls"     // The model called tools
+	FinishContentFilter FinishReason = "content_filter" // Cut by the content filter of the provider
 )
 
 // EmbeddingsRequest represents the input payload for generating embeddings.
@@ -325,6 +1092,12 @@ type EmbeddingResponse struct {
 	OriginalResponse any         `json:"original-response"` // the original response of the API call.
 }
 
+// RerankResult is the relevance of a single document to a query.
+type RerankResult struct {
+	Index          int     `json:"index"`           // Position of the document in the reranked input
+	RelevanceScore float64 `json:"relevance_score"` // Relevance between 0 and 1
+}
+
 // ModerationRequest represents a request to check if a given text contains any content that is considered inappropriate or harmful by OpenAI's standards.
 type ModerationRequest struct {
 	Input string `json:"input"`
@@ -332,11 +1105,31 @@ type ModerationRequest struct {
 
 // ModerationResponse represents the root structure of the moderation response.
 type ModerationResponse struct {
-	ID               string `json:"id"`
-	Model            Model  `json:"model"`
-	OriginalResponse any    `json:"results"`
+	ID               string             `json:"id"`
+	Model            Model              `json:"model"`
+	Flagged          bool               `json:"flagged"`                   // Whether any category was flagged
+	Categories       map[string]bool    `json:"categories,omitempty"`      // Flagged state per category
+	CategoryScores   map[string]float64 `json:"category_scores,omitempty"` // Score between 0 and 1 per category
+	OriginalResponse any                `json:"results"`
 }
 
+// moderation categories, named after the categories of the OpenAI moderation api
+const (
+	ModerationSexual                = "sexual"
+	ModerationSexualMinors          = "sexual/minors"
+	ModerationHate                  = "hate"
+	ModerationHateThreatening       = "hate/threatening"
+	ModerationHarassment            = "harassment"
+	ModerationHarassmentThreatening = "harassment/threatening"
+	ModerationSelfHarm              = "self-harm"
+	ModerationSelfHarmIntent        = "self-harm/intent"
+	ModerationSelfHarmInstructions  = "self-harm/instructions"
+	ModerationViolence              = "violence"
+	ModerationViolenceGraphic       = "violence/graphic"
+	ModerationIllicit               = "illicit"
+	ModerationIllicitViolent        = "illicit/violent"
+)
+
 // the type of streaming endpoint (chat/generate)
 type StreamType int
 
@@ -383,12 +1176,16 @@ type FunctionParameter struct {
 
 // Parameter represents the details of a single parameter.
 type Parameter struct {
-	Type        string   `json:"type"` // Type of the parameter.
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"` // Optional list of valid values for the parameter.
+	Type        string               `json:"type"` // Type of the parameter.
+	Description string               `json:"description"`
+	Enum        []string             `json:"enum,omitempty"`       // Optional list of valid values for the parameter.
+	Items       *Parameter           `json:"items,omitempty"`      // Type of the elements of array parameters
+	Properties  map[string]Parameter `json:"properties,omitempty"` // Properties of object parameters
+	Required    []string             `json:"required,omitempty"`   // Required properties of object parameters
 }
 
 type ToolCall struct {
+	ID      string          `json:"id,omitempty"` // ID of the call, referenced by the ToolCallID of its result
 	Payload FunctionPayload `json:"function"`
 }
 
@@ -397,6 +1194,17 @@ type FunctionPayload struct {
 	Arguments    map[string]any `json:"arguments"` // List of parameters the function takes.
 }
 
+// ToolApproval is the decision of a ToolCallHook about a tool call.
+type ToolApproval struct {
+	Approved  bool
+	Arguments map[string]any // Arguments to run the tool with instead of those of the model, if not nil
+	Reason    string         // Why the call was denied, told to the model
+}
+
+// ToolCallHook is asked before a tool call is run, e.g. to let the user confirm sensitive operations. It
+// may approve the call, approve it with modified arguments or deny it.
+type ToolCallHook func(call ToolCall) ToolApproval
+
 type FunctionResponse struct {
 	Status  FunctionResponseStatus `json:"status"`
 	Message string                 `json:"message"`
@@ -408,3 +1216,25 @@ const (
 	FunctionResponseStatusSuccess FunctionResponseStatus = "success"
 	FunctionResponseStatusError   FunctionResponseStatus = "error"
 )
+
+// AudioChunk represents a segment of an audio file prepared for transcription.
+type AudioChunk struct {
+	Index    int           `json:"index"`    // Position of the chunk within the audio file
+	Start    time.Duration `json:"start"`    // Offset of the chunk from the start of the audio file
+	Duration time.Duration `json:"duration"` // Length of the chunk
+	Data     []byte        `json:"data"`     // Encoded audio data of the chunk
+	Format   string        `json:"format"`   // Encoding format of the chunk, e.g. mp3
+}
+
+// TranscriptSegment represents the transcribed text of an audio chunk.
+type TranscriptSegment struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+}
+
+// Transcript represents the stitched transcription of an audio file.
+type Transcript struct {
+	Text     string              `json:"text"`
+	Segments []TranscriptSegment `json:"segments"`
+}
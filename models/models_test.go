@@ -0,0 +1,193 @@
+package models_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// pngHeader is the minimal signature needed for MIME detection.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+func TestBase64Image(t *testing.T) {
+	t.Run("Test SetData detects MIME type", func(t *testing.T) {
+		var image models.Base64Image
+		image.SetData(pngHeader)
+		if image.MimeType != "image/png" {
+			t.Errorf("expected MIME type image/png, got %s", image.MimeType)
+		}
+	})
+
+	t.Run("Test JSON round trip", func(t *testing.T) {
+		var image models.Base64Image
+		image.SetData(pngHeader)
+
+		payload, err := json.Marshal(image)
+		if err != nil {
+			t.Fatalf("failed to marshal image: %v", err)
+		}
+
+		var decoded models.Base64Image
+		if err := json.Unmarshal(payload, &decoded); err != nil {
+			t.Fatalf("failed to unmarshal image: %v", err)
+		}
+
+		if decoded != image {
+			t.Errorf("round trip mismatch, expected %v, got %v", image, decoded)
+		}
+	})
+
+	t.Run("Test data URI", func(t *testing.T) {
+		var image models.Base64Image
+		image.SetData(pngHeader)
+
+		uri := image.DataURI()
+		decoded, err := models.NewBase64ImageFromString(uri)
+		if err != nil {
+			t.Fatalf("failed to parse data uri: %v", err)
+		}
+
+		if decoded.Data != image.Data || decoded.MimeType != "image/png" {
+			t.Errorf("data uri mismatch, expected %v, got %v", image, decoded)
+		}
+	})
+}
+
+func TestConfigEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	file := `{
+		"api_provider": "openai",
+		"api_endpoints": {
+			"api_chat_url": "https://api.openai.com/v1/chat/completions",
+			"api_generate_url": "https://api.openai.com/v1/completions",
+			"api_embed_url": "https://api.openai.com/v1/embeddings",
+			"api_moderation_url": "https://api.openai.com/v1/moderations"
+		},
+		"ai_models": {
+			"chat_model": {"model": "gpt-4o", "name": "Assistant"},
+			"embedding_model": {"model": "text-embedding-3-small", "name": "text-embedding-3-small"}
+		},
+		"max_messages": 10
+	}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AICOMPANION_API_KEY", "sk-from-env")
+	t.Setenv("AICOMPANION_CHAT_URL", "http://proxy:8080/v1/chat/completions")
+	t.Setenv("AICOMPANION_CHAT_MODEL", "gpt-4o-mini")
+	t.Setenv("AICOMPANION_EMBEDDING_MODEL", "text-embedding-3-large")
+	t.Setenv("AICOMPANION_MAX_MESSAGES", "")
+	t.Setenv("AICOMPANION_DEBUG", "true")
+
+	config, err := models.NewConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if config.ApiKey != "sk-from-env" || config.ApiEndpoints.ApiChatURL != "http://proxy:8080/v1/chat/completions" || !config.Terminal.Debug {
+		t.Errorf("expected the environment to override the file, got %+v", config)
+	}
+	if config.AiModels.ChatModel != (models.Model{Model: "gpt-4o-mini", Name: "Assistant"}) {
+		t.Errorf("expected the chat model to keep its name, got %+v", config.AiModels.ChatModel)
+	}
+	if config.AiModels.EmbeddingModel.Name != "text-embedding-3-large" {
+		t.Errorf("expected the embedding model to be renamed, got %+v", config.AiModels.EmbeddingModel)
+	}
+	if config.MaxMessages != 10 || config.ApiEndpoints.ApiEmbedURL != "https://api.openai.com/v1/embeddings" {
+		t.Errorf("expected empty and unset variables to keep the file, got %+v", config)
+	}
+
+	t.Setenv("AICOMPANION_HTTP_TIMEOUT", "soon")
+	if _, err := models.NewConfigFromFile(path); err == nil {
+		t.Error("expected an error for an invalid number")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	file := `{
+		"api_provider": "openai",
+		"api_endpoints": {"api_chat_url": "localhost:8080/chat", "api_models_url": "ftp://models"},
+		"ai_models": {"chat_model": {"model": "gpt-4o"}},
+		"max_messages": -1,
+		"personas": [{"name": "default"}, {"name": ""}, {"name": "default"}],
+		"rag_query_options": {"similarity_threshold": 1.5},
+		"moderation": {"action": "ignore", "thresholds": {"hate": 2}},
+		"encryption_key": "c2hvcnQ="
+	}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := models.NewConfigFromFile(path)
+	var configErr *models.ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a *ConfigError, got %v", err)
+	}
+	var paths []string
+	for _, problem := range configErr.Problems {
+		paths = append(paths, problem.Path)
+	}
+	expected := []string{
+		"api_key",
+		"api_endpoints.api_chat_url",
+		"api_endpoints.api_models_url",
+		"ai_models.embedding_model.model",
+		"max_messages",
+		"personas[1].name",
+		"personas[2].name",
+		"rag_query_options.similarity_threshold",
+		"moderation.action",
+		"moderation.thresholds.hate",
+		"encryption_key",
+	}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected problems:\n%v\nexpected:\n%v", paths, expected)
+	}
+	if !strings.Contains(err.Error(), "personas[2].name: duplicates the name of personas[0]") {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	config := models.Configuration{
+		ApiProvider:  models.Ollama,
+		ApiKey:       "key",
+		ApiEndpoints: models.ApiEndpointUrls{ApiChatURL: "http://localhost:11434/api/chat", ApiGenerateURL: "http://localhost:11434/api/generate", ApiEmbedURL: "http://localhost:11434/api/embed", ApiModerationURL: "http://localhost:11434/api/generate"},
+		AiModels:     models.AiModels{ChatModel: models.Model{Model: "llama3"}, EmbeddingModel: models.Model{Model: "nomic-embed-text"}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected a valid configuration, got %v", err)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("sk-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_OPENAI_KEY", "sk-env")
+
+	config := models.Configuration{
+		ApiKey:   "env:TEST_OPENAI_KEY",
+		Profiles: []models.Profile{{Name: "file", ApiKey: "file:" + keyFile}, {Name: "cmd", ApiKey: "cmd:echo sk-cmd"}, {Name: "plain", ApiKey: "sk-plain"}},
+	}
+	if err := config.ResolveSecrets(); err != nil {
+		t.Fatalf("failed to resolve secrets: %v", err)
+	}
+	keys := []string{config.ApiKey, config.Profiles[0].ApiKey, config.Profiles[1].ApiKey, config.Profiles[2].ApiKey}
+	if strings.Join(keys, ",") != "sk-env,sk-file,sk-cmd,sk-plain" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	config = models.Configuration{ApiKey: "env:TEST_MISSING_KEY", EncryptionKey: "file:" + filepath.Join(dir, "missing")}
+	err := config.ResolveSecrets()
+	var configErr *models.ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 || configErr.Problems[0].Path != "api_key" || configErr.Problems[1].Path != "encryption_key" {
+		t.Errorf("expected both secrets to fail, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ResolveSecret returns the value of an indirect secret: "env:NAME" reads the environment variable NAME,
+// "file:PATH" the file at PATH and "cmd:COMMAND ARGS" the output of a command, which is run without shell,
+// e.g. "cmd:pass show openai". Surrounding white space of files and output is removed. Other values are
+// returned as they are.
+func ResolveSecret(value string) (string, error) {
+	kind, reference, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	switch kind {
+	case "env":
+		secret, ok := os.LookupEnv(reference)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", reference)
+		}
+		return secret, nil
+	case "file":
+		data, err := os.ReadFile(reference)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case "cmd":
+		args := strings.Fields(reference)
+		if len(args) == 0 {
+			return "", errors.New("no command given")
+		}
+		output, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+				return "", fmt.Errorf("%s failed: %w: %s", args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+	return value, nil
+}
+
+// ResolveSecrets replaces the indirect secrets of the API keys, including those of the profiles, and of
+// the encryption key by their values, see ResolveSecret. It returns a *ConfigError listing the secrets
+// that cannot be resolved.
+func (config *Configuration) ResolveSecrets() error {
+	var validator configValidator
+	resolve := func(path string, value *string) {
+		secret, err := ResolveSecret(*value)
+		if err != nil {
+			validator.add(path, "cannot resolve secret: %v", err)
+			return
+		}
+		*value = secret
+	}
+
+	resolve("api_key", &config.ApiKey)
+	resolve("encryption_key", &config.EncryptionKey)
+	for i := range config.Profiles {
+		resolve(fmt.Sprintf("profiles[%d].api_key", i), &config.Profiles[i].ApiKey)
+	}
+
+	if len(validator.problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Problems: validator.problems}
+}
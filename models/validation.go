@@ -0,0 +1,265 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ConfigProblem is an invalid value of a configuration.
+type ConfigProblem struct {
+	Path    string `json:"path"` // JSON path of the value, e.g. personas[1].name
+	Message string `json:"message"`
+}
+
+// String returns the path and message of the problem.
+func (problem ConfigProblem) String() string {
+	return problem.Path + ": " + problem.Message
+}
+
+// ConfigError lists all problems of a configuration.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+// Error implements error.
+func (err *ConfigError) Error() string {
+	problems := make([]string, len(err.Problems))
+	for i, problem := range err.Problems {
+		problems[i] = problem.String()
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+// configValidator collects the problems of a configuration.
+type configValidator struct {
+	problems []ConfigProblem
+}
+
+func (validator *configValidator) add(path, format string, args ...any) {
+	validator.problems = append(validator.problems, ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (validator *configValidator) required(path, value string) {
+	if value == "" {
+		validator.add(path, "is required")
+	}
+}
+
+func (validator *configValidator) nonNegative(path string, value int) {
+	if value < 0 {
+		validator.add(path, "must not be negative, got %d", value)
+	}
+}
+
+func (validator *configValidator) between(path string, value, low, high float64) {
+	if value < low || value > high {
+		validator.add(path, "must be between %g and %g, got %g", low, high, value)
+	}
+}
+
+// url checks that value is an absolute http or https URL; empty values are only reported if required.
+func (validator *configValidator) url(path, value string, required bool) {
+	if value == "" {
+		if required {
+			validator.add(path, "is required")
+		}
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		validator.add(path, "must be an http:// or https:// URL, got %q", value)
+	}
+}
+
+// Validate checks the configuration and returns a *ConfigError listing all problems with their JSON paths,
+// or nil if it is valid.
+func (config *Configuration) Validate() error {
+	var validator configValidator
+
+	switch config.ApiProvider {
+	case OpenAI, Ollama, Groq, Cohere, TGI, OpenRouter, LlamaCpp, DeepSeek:
+	default:
+		validator.add("api_provider", "unknown provider %q", config.ApiProvider)
+	}
+	validator.required("api_key", config.ApiKey)
+
+	endpoints := config.ApiEndpoints
+	validator.url("api_endpoints.api_chat_url", endpoints.ApiChatURL, true)
+	// several providers offer no generate, embedding or moderation endpoint
+	validator.url("api_endpoints.api_generate_url", endpoints.ApiGenerateURL, false)
+	validator.url("api_endpoints.api_embed_url", endpoints.ApiEmbedURL, false)
+	validator.url("api_endpoints.api_moderation_url", endpoints.ApiModerationURL, false)
+	validator.url("api_endpoints.api_models_url", endpoints.ApiModelsURL, false)
+	validator.url("api_endpoints.api_transcription_url", endpoints.ApiTranscriptionURL, false)
+	validator.url("api_endpoints.api_rerank_url", endpoints.ApiRerankURL, false)
+
+	validator.required("ai_models.chat_model.model", config.AiModels.ChatModel.Model)
+	if endpoints.ApiEmbedURL != "" {
+		validator.required("ai_models.embedding_model.model", config.AiModels.EmbeddingModel.Model)
+	}
+
+	http := config.HttpConfig
+	validator.nonNegative("http_config.http_client_timeout", http.HTTPClientTimeout)
+	validator.nonNegative("http_config.max_line_size", http.MaxLineSize)
+	validator.nonNegative("http_config.retry.max_attempts", http.Retry.MaxAttempts)
+	validator.nonNegative("http_config.retry.backoff_ms", http.Retry.Backoff)
+	validator.nonNegative("http_config.retry.max_backoff_ms", http.Retry.MaxBackoff)
+	validator.nonNegative("http_config.max_idle_conns", http.MaxIdleConns)
+	validator.nonNegative("http_config.idle_conn_timeout", http.IdleConnTimeout)
+	if http.ProxyURL != "" {
+		proxy, err := url.Parse(http.ProxyURL)
+		if err != nil || proxy.Host == "" || !slices.Contains([]string{"http", "https", "socks5", "socks5h"}, proxy.Scheme) {
+			validator.add("http_config.proxy_url", "must be an http, https or socks5 URL, got %q", http.ProxyURL)
+		}
+	}
+	if (http.ClientCertFile == "") != (http.ClientKeyFile == "") {
+		validator.add("http_config.client_key_file", "client_cert_file and client_key_file must be set together")
+	}
+	if http.Audit.MaxBodySize < -1 {
+		validator.add("http_config.audit.max_body_size", "must be -1 or more, got %d", http.Audit.MaxBodySize)
+	}
+
+	generation := config.Generation
+	if generation.Temperature != nil {
+		validator.between("generation.temperature", float64(*generation.Temperature), 0, 2)
+	}
+	if generation.TopK != nil {
+		validator.nonNegative("generation.top_k", *generation.TopK)
+	}
+	if generation.TopP != nil {
+		validator.between("generation.top_p", float64(*generation.TopP), 0, 1)
+	}
+	if generation.RepeatPenalty != nil && *generation.RepeatPenalty < 0 {
+		validator.add("generation.repeat_penalty", "must not be negative, got %g", *generation.RepeatPenalty)
+	}
+	validator.nonNegative("generation.context_size", generation.ContextSize)
+	validator.between("generation.top_logprobs", float64(generation.TopLogProbs), 0, 20)
+	validator.nonNegative("generation.n", generation.N)
+	if generation.KeepAlive != "" {
+		if _, err := ParseKeepAlive(generation.KeepAlive); err != nil {
+			validator.add("generation.keep_alive", "%v", err)
+		}
+	}
+
+	validator.nonNegative("max_messages", config.MaxMessages)
+	validator.nonNegative("max_context_tokens", config.MaxContextTokens)
+	switch config.IncludeStrategy {
+	case "", IncludeBoth, IncludeAssistant, IncludeUser:
+	default:
+		validator.add("include_strategy", "unknown strategy %q", config.IncludeStrategy)
+	}
+
+	names := make(map[string]int, len(config.Personas))
+	for i, persona := range config.Personas {
+		path := fmt.Sprintf("personas[%d].name", i)
+		if persona.Name == "" {
+			validator.add(path, "is required")
+			continue
+		}
+		if first, ok := names[persona.Name]; ok {
+			validator.add(path, "duplicates the name of personas[%d]", first)
+			continue
+		}
+		names[persona.Name] = i
+	}
+
+	profiles := make(map[string]int, len(config.Profiles))
+	for i, profile := range config.Profiles {
+		path := fmt.Sprintf("profiles[%d]", i)
+		switch profile.ApiProvider {
+		case "", OpenAI, Ollama, Groq, Cohere, TGI, OpenRouter, LlamaCpp, DeepSeek:
+		default:
+			validator.add(path+".api_provider", "unknown provider %q", profile.ApiProvider)
+		}
+		validator.url(path+".api_endpoints.api_chat_url", profile.ApiEndpoints.ApiChatURL, false)
+		validator.url(path+".api_endpoints.api_generate_url", profile.ApiEndpoints.ApiGenerateURL, false)
+		validator.url(path+".api_endpoints.api_embed_url", profile.ApiEndpoints.ApiEmbedURL, false)
+		validator.url(path+".api_endpoints.api_moderation_url", profile.ApiEndpoints.ApiModerationURL, false)
+		validator.url(path+".api_endpoints.api_models_url", profile.ApiEndpoints.ApiModelsURL, false)
+		if profile.Name == "" {
+			validator.add(path+".name", "is required")
+			continue
+		}
+		if first, ok := profiles[profile.Name]; ok {
+			validator.add(path+".name", "duplicates the name of profiles[%d]", first)
+			continue
+		}
+		profiles[profile.Name] = i
+	}
+	if _, ok := profiles[config.ActiveProfile]; config.ActiveProfile != "" && !ok {
+		validator.add("active_profile", "unknown profile %q", config.ActiveProfile)
+	}
+
+	for i, name := range config.Failover.Profiles {
+		if _, ok := profiles[name]; !ok {
+			validator.add(fmt.Sprintf("failover.profiles[%d]", i), "unknown profile %q", name)
+		}
+	}
+	validator.nonNegative("failover.threshold", config.Failover.Threshold)
+	validator.nonNegative("failover.cooldown", config.Failover.Cooldown)
+
+	rag := config.RAGQueryOptions
+	validator.nonNegative("rag_query_options.limit", rag.Limit)
+	validator.nonNegative("rag_query_options.offset", rag.Offset)
+	validator.between("rag_query_options.similarity_threshold", rag.SimilarityThreshold, -1, 1)
+	if rag.Hybrid != nil {
+		validator.nonNegative("rag_query_options.hybrid.rrf_k", rag.Hybrid.RRFK)
+	}
+
+	moderation := config.Moderation
+	switch moderation.Action {
+	case "", ModerationBlock, ModerationRedact, ModerationAnnotate:
+	default:
+		validator.add("moderation.action", "unknown action %q", moderation.Action)
+	}
+	validator.between("moderation.default_threshold", moderation.DefaultThreshold, 0, 1)
+	for _, category := range sortedKeys(moderation.Thresholds) {
+		validator.between("moderation.thresholds."+category, moderation.Thresholds[category], 0, 1)
+	}
+
+	tools := config.ToolConfig
+	validator.nonNegative("tool_config.max_concurrency", tools.MaxConcurrency)
+	validator.nonNegative("tool_config.timeout", tools.Timeout)
+	for _, function := range sortedKeys(tools.Timeouts) {
+		validator.nonNegative("tool_config.timeouts."+function, tools.Timeouts[function])
+	}
+	validator.nonNegative("tool_config.retries", tools.Retries)
+	validator.nonNegative("tool_config.retry_backoff_ms", tools.RetryBackoff)
+	validator.nonNegative("tool_config.breaker_threshold", tools.BreakerThreshold)
+	validator.nonNegative("tool_config.breaker_cooldown", tools.BreakerCooldown)
+
+	if config.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(config.EncryptionKey))
+		switch {
+		case err != nil:
+			validator.add("encryption_key", "must be base64 encoded")
+		case len(key) != 16 && len(key) != 24 && len(key) != 32:
+			validator.add("encryption_key", "must be 16, 24 or 32 bytes, got %d", len(key))
+		}
+	}
+
+	for _, model := range sortedKeys(config.Pricing.Models) {
+		price := config.Pricing.Models[model]
+		if price.Input < 0 || price.Output < 0 {
+			validator.add("pricing.models."+model, "prices must not be negative")
+		}
+	}
+
+	if len(validator.problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Problems: validator.problems}
+}
+
+// sortedKeys returns the keys of a map in order, so that problems are reported in the same order.
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package aicompanion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// CreatePersonaNamespace creates the given classes in the namespace of a persona
+// (Persona.NamespacedClassName). Classes that already exist are kept. RAG requests with
+// RAGOptions.PersonaScoped read from the class of the active persona, so switching the persona switches
+// the knowledge base.
+func CreatePersonaNamespace(ctx context.Context, vectorDb vectordb.VectorDb, persona models.Persona, classnames ...string) error {
+	if vectorDb == nil {
+		return errors.New("no vector database configured")
+	}
+
+	for _, classname := range classnames {
+		namespaced := persona.NamespacedClassName(classname)
+		err := vectorDb.CreateSchema(ctx, models.Schema{ClassName: namespaced})
+		if err != nil && !errors.Is(err, vectordb.ErrSchemaExists) {
+			return fmt.Errorf("failed to create %s: %w", namespaced, err)
+		}
+	}
+	return nil
+}
+
+// PersonaNamespace returns the classes in the namespace of a persona, including its knowledge class.
+func PersonaNamespace(ctx context.Context, vectorDb vectordb.VectorDb, persona models.Persona) ([]string, error) {
+	if vectorDb == nil {
+		return nil, errors.New("no vector database configured")
+	}
+
+	schemas, err := vectorDb.GetSchemas(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schemas: %w", err)
+	}
+
+	prefix := persona.NamespacePrefix()
+	var classnames []string
+	for _, schema := range schemas {
+		if strings.HasPrefix(schema, prefix) {
+			classnames = append(classnames, schema)
+		}
+	}
+	return classnames, nil
+}
+
+// DeletePersonaNamespace deletes all classes in the namespace of a persona, including its knowledge class.
+func DeletePersonaNamespace(ctx context.Context, vectorDb vectordb.VectorDb, persona models.Persona) error {
+	classnames, err := PersonaNamespace(ctx, vectorDb, persona)
+	if err != nil {
+		return err
+	}
+	if len(classnames) == 0 {
+		return nil
+	}
+	if err := vectorDb.DeleteSchemas(ctx, classnames); err != nil {
+		return fmt.Errorf("failed to delete namespace of %s: %w", persona.Name, err)
+	}
+	return nil
+}
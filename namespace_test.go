@@ -0,0 +1,58 @@
+package aicompanion_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestPersonaNamespace(t *testing.T) {
+	ctx := context.Background()
+	db, _ := memvdb.NewMemoryVectorDb("", false)
+	companion := aicompaniontest.NewFakeCompanion()
+	companion.SetVectorDB(db)
+
+	chef := models.Persona{Name: "Chef"}
+	pilot := models.Persona{Name: "Chef Pilot"}
+	for persona, text := range map[*models.Persona]string{&chef: "simmer the sauce slowly", &pilot: "check the flaps before takeoff"} {
+		if err := aicompanion.CreatePersonaNamespace(ctx, db, *persona, "docs"); err != nil {
+			t.Fatal(err)
+		}
+		document := models.Document{ID: "1", Content: text, Embeddings: aicompaniontest.Embed(text, aicompaniontest.DefaultDimensions)}
+		if err := db.AddDocuments(ctx, persona.NamespacedClassName("docs"), []models.Document{document}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// switching the persona switches the knowledge base
+	options := models.RAGOptions{ClassName: "docs", PersonaScoped: true}
+	for persona, expected := range map[*models.Persona]string{&chef: "sauce", &pilot: "flaps"} {
+		config := companion.GetConfig()
+		config.ActivePersona = *persona
+		companion.SetConfig(config)
+
+		message := models.Message{Role: models.User, Content: "what should I do"}
+		if _, err := companion.SendRAGRequest(context.Background(), message, options, false, nil); err != nil {
+			t.Fatal(err)
+		}
+		if request, _ := companion.LastRequest(); !strings.Contains(request.Message.Content, expected) {
+			t.Errorf("expected %q in the context of %s, got %q", expected, persona.Name, request.Message.Content)
+		}
+	}
+
+	// the namespace of a persona does not include those of personas whose name it prefixes
+	if err := aicompanion.DeletePersonaNamespace(ctx, db, chef); err != nil {
+		t.Fatal(err)
+	}
+	if classnames, _ := aicompanion.PersonaNamespace(ctx, db, chef); len(classnames) != 0 {
+		t.Errorf("expected an empty namespace, got %v", classnames)
+	}
+	if classnames, _ := aicompanion.PersonaNamespace(ctx, db, pilot); len(classnames) != 1 || classnames[0] != "persona_chef_pilot__docs" {
+		t.Errorf("unexpected namespace %v", classnames)
+	}
+}
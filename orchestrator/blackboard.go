@@ -0,0 +1,304 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// names of the functions exposing the blackboard to agents
+const (
+	FunctionBlackboardRead   = "blackboard_read"
+	FunctionBlackboardWrite  = "blackboard_write"
+	FunctionBlackboardNote   = "blackboard_add_note"
+	FunctionBlackboardNotes  = "blackboard_list_notes"
+	FunctionBlackboardSearch = "blackboard_search_notes"
+)
+
+// Note is an entry appended to the blackboard.
+type Note struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Blackboard is a concurrency-safe memory shared by all agents of a Scene. It holds key/value entries
+// and appended notes, which are optionally indexed in a vector database for semantic search.
+type Blackboard struct {
+	mutex   sync.RWMutex
+	entries map[string]string
+	notes   []Note
+
+	// optional vector index for notes
+	vectorDb  vectordb.VectorDb
+	embedder  aicompanion.AICompanion
+	classname string
+}
+
+// NewBlackboard creates an empty blackboard.
+func NewBlackboard() *Blackboard {
+	return &Blackboard{entries: make(map[string]string)}
+}
+
+// WithVectorIndex enables semantic search over notes, embedding them with the embedder's embedding model.
+// The schema for classname must exist.
+func (blackboard *Blackboard) WithVectorIndex(vectorDb vectordb.VectorDb, embedder aicompanion.AICompanion, classname string) *Blackboard {
+	blackboard.mutex.Lock()
+	defer blackboard.mutex.Unlock()
+
+	blackboard.vectorDb = vectorDb
+	blackboard.embedder = embedder
+	blackboard.classname = classname
+	return blackboard
+}
+
+// Get returns the value stored under key.
+func (blackboard *Blackboard) Get(key string) (string, bool) {
+	blackboard.mutex.RLock()
+	defer blackboard.mutex.RUnlock()
+
+	value, exists := blackboard.entries[key]
+	return value, exists
+}
+
+// Set stores value under key.
+func (blackboard *Blackboard) Set(key, value string) {
+	blackboard.mutex.Lock()
+	defer blackboard.mutex.Unlock()
+
+	blackboard.entries[key] = value
+}
+
+// Delete removes key from the blackboard.
+func (blackboard *Blackboard) Delete(key string) {
+	blackboard.mutex.Lock()
+	defer blackboard.mutex.Unlock()
+
+	delete(blackboard.entries, key)
+}
+
+// Keys returns all keys in sorted order.
+func (blackboard *Blackboard) Keys() []string {
+	blackboard.mutex.RLock()
+	defer blackboard.mutex.RUnlock()
+
+	keys := make([]string, 0, len(blackboard.entries))
+	for key := range blackboard.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AddNote appends a note and indexes it, if a vector index is configured.
+func (blackboard *Blackboard) AddNote(ctx context.Context, author, content string) (Note, error) {
+	blackboard.mutex.Lock()
+	note := Note{ID: len(blackboard.notes) + 1, Author: author, Content: content, CreatedAt: time.Now()}
+	blackboard.notes = append(blackboard.notes, note)
+	vectorDb, embedder, classname := blackboard.vectorDb, blackboard.embedder, blackboard.classname
+	blackboard.mutex.Unlock()
+
+	if vectorDb == nil || embedder == nil {
+		return note, nil
+	}
+
+	vector, err := embed(ctx, embedder, content)
+	if err != nil {
+		return note, fmt.Errorf("failed to index note: %w", err)
+	}
+
+	document := models.Document{
+		ID:         fmt.Sprintf("note-%d", note.ID),
+		ClassName:  classname,
+		Embeddings: vector,
+		Metadata:   map[string]any{"author": author, "content": content, "note_id": note.ID},
+	}
+	if err := vectorDb.AddDocument(ctx, classname, document.ID, document); err != nil {
+		return note, fmt.Errorf("failed to index note: %w", err)
+	}
+
+	return note, nil
+}
+
+// Notes returns a copy of all notes.
+func (blackboard *Blackboard) Notes() []Note {
+	blackboard.mutex.RLock()
+	defer blackboard.mutex.RUnlock()
+
+	return append([]Note(nil), blackboard.notes...)
+}
+
+// SearchNotes returns the notes most similar to the query. Without a vector index, notes containing
+// the query are returned instead.
+func (blackboard *Blackboard) SearchNotes(ctx context.Context, query string, limit int) ([]Note, error) {
+	blackboard.mutex.RLock()
+	vectorDb, embedder, classname := blackboard.vectorDb, blackboard.embedder, blackboard.classname
+	notes := append([]Note(nil), blackboard.notes...)
+	blackboard.mutex.RUnlock()
+
+	if vectorDb == nil || embedder == nil {
+		var result []Note
+		for _, note := range notes {
+			if strings.Contains(strings.ToLower(note.Content), strings.ToLower(query)) {
+				result = append(result, note)
+			}
+		}
+		if limit > 0 && len(result) > limit {
+			result = result[:limit]
+		}
+		return result, nil
+	}
+
+	vector, err := embed(ctx, embedder, query)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := vectorDb.QueryDocuments(ctx, classname, vector, models.VectorDBQueryOptions{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Note
+	for _, document := range documents {
+		var id int
+		fmt.Sscanf(document.ID, "note-%d", &id)
+		if id > 0 && id <= len(notes) {
+			result = append(result, notes[id-1])
+		}
+	}
+	return result, nil
+}
+
+// Summary renders the entries and notes of the blackboard as text.
+func (blackboard *Blackboard) Summary() string {
+	blackboard.mutex.RLock()
+	defer blackboard.mutex.RUnlock()
+
+	var summary strings.Builder
+	keys := make([]string, 0, len(blackboard.entries))
+	for key := range blackboard.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&summary, "%s = %s\n", key, blackboard.entries[key])
+	}
+	for _, note := range blackboard.notes {
+		fmt.Fprintf(&summary, "note %d by %s: %s\n", note.ID, note.Author, note.Content)
+	}
+	return summary.String()
+}
+
+// Functions returns the function definitions through which agents access the blackboard.
+func (blackboard *Blackboard) Functions() []models.Function {
+	stringParameter := func(description string) models.Parameter {
+		return models.Parameter{Type: "string", Description: description}
+	}
+	function := func(name, description string, properties map[string]models.Parameter, required ...string) models.Function {
+		return models.Function{
+			Type: models.TypeFunction,
+			Function: models.FunctionDefinition{
+				FunctionName: name,
+				Description:  description,
+				Parameters:   models.FunctionParameter{Type: models.ObjectType, Properties: properties, Required: required},
+			},
+		}
+	}
+
+	return []models.Function{
+		function(FunctionBlackboardRead, "Read a value from the shared blackboard. Without a key, all keys are listed.",
+			map[string]models.Parameter{"key": stringParameter("The key to read")}),
+		function(FunctionBlackboardWrite, "Write a value to the shared blackboard, visible to all agents.",
+			map[string]models.Parameter{"key": stringParameter("The key to write"), "value": stringParameter("The value to store")}, "key", "value"),
+		function(FunctionBlackboardNote, "Append a note to the shared blackboard.",
+			map[string]models.Parameter{"content": stringParameter("The content of the note")}, "content"),
+		function(FunctionBlackboardNotes, "List all notes on the shared blackboard.", map[string]models.Parameter{}),
+		function(FunctionBlackboardSearch, "Search the notes on the shared blackboard.",
+			map[string]models.Parameter{"query": stringParameter("What to search for")}, "query"),
+	}
+}
+
+// HandlesFunction reports whether the function name belongs to the blackboard.
+func (blackboard *Blackboard) HandlesFunction(name string) bool {
+	switch name {
+	case FunctionBlackboardRead, FunctionBlackboardWrite, FunctionBlackboardNote, FunctionBlackboardNotes, FunctionBlackboardSearch:
+		return true
+	}
+	return false
+}
+
+// HandleFunction executes a blackboard function call on behalf of author.
+func (blackboard *Blackboard) HandleFunction(ctx context.Context, author string, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	argument := func(name string) string {
+		value, _ := payload.Arguments[name].(string)
+		return value
+	}
+
+	var result any
+	switch payload.FunctionName {
+	case FunctionBlackboardRead:
+		key := argument("key")
+		if key == "" {
+			result = blackboard.Keys()
+			break
+		}
+		value, exists := blackboard.Get(key)
+		if !exists {
+			return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: "key does not exist: " + key}, nil
+		}
+		result = value
+	case FunctionBlackboardWrite:
+		key := argument("key")
+		if key == "" {
+			return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: "key must not be empty"}, nil
+		}
+		blackboard.Set(key, argument("value"))
+		result = "stored"
+	case FunctionBlackboardNote:
+		note, err := blackboard.AddNote(ctx, author, argument("content"))
+		if err != nil {
+			return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}, nil
+		}
+		result = note
+	case FunctionBlackboardNotes:
+		result = blackboard.Notes()
+	case FunctionBlackboardSearch:
+		notes, err := blackboard.SearchNotes(ctx, argument("query"), 5)
+		if err != nil {
+			return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}, nil
+		}
+		result = notes
+	default:
+		return models.FunctionResponse{}, fmt.Errorf("unknown blackboard function: %s", payload.FunctionName)
+	}
+
+	message, err := json.Marshal(result)
+	if err != nil {
+		return models.FunctionResponse{}, err
+	}
+	return models.FunctionResponse{Status: models.FunctionResponseStatusSuccess, Message: string(message)}, nil
+}
+
+// embed returns the embedding of a single text.
+func embed(ctx context.Context, embedder aicompanion.AICompanion, text string) ([]float32, error) {
+	model := embedder.GetConfig().AiModels.EmbeddingModel
+	response, err := embedder.SendEmbeddingRequest(ctx, sideKick.CreateEmbeddingRequest(model, []string{text}))
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) == 0 {
+		return nil, errors.New("no embeddings returned")
+	}
+	return response.Embeddings[0], nil
+}
@@ -0,0 +1,173 @@
+package orchestrator_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/orchestrator"
+)
+
+// call executes a blackboard function on behalf of alice.
+func call(t *testing.T, blackboard *orchestrator.Blackboard, name string, arguments map[string]any) models.FunctionResponse {
+	t.Helper()
+	response, err := blackboard.HandleFunction(context.Background(), "alice", models.FunctionPayload{FunctionName: name, Arguments: arguments})
+	if err != nil {
+		t.Fatalf("%s failed: %v", name, err)
+	}
+	return response
+}
+
+func TestBlackboardConcurrency(t *testing.T) {
+	blackboard := orchestrator.NewBlackboard()
+
+	var wait sync.WaitGroup
+	for i := range 20 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			key := fmt.Sprintf("key-%02d", i)
+			blackboard.Set(key, "value")
+			blackboard.Get(key)
+			blackboard.Keys()
+			blackboard.AddNote(context.Background(), "alice", fmt.Sprintf("note %d", i))
+			blackboard.Notes()
+			blackboard.SearchNotes(context.Background(), "note", 3)
+			blackboard.Summary()
+			if i%2 == 0 {
+				blackboard.Delete(key)
+			}
+		}()
+	}
+	wait.Wait()
+
+	if keys := blackboard.Keys(); len(keys) != 10 || !slices.IsSorted(keys) {
+		t.Errorf("expected 10 sorted keys, got %v", keys)
+	}
+	notes := blackboard.Notes()
+	if len(notes) != 20 {
+		t.Fatalf("expected 20 notes, got %d", len(notes))
+	}
+	for i, note := range notes {
+		if note.ID != i+1 {
+			t.Errorf("expected note %d to have id %d, got %d", i, i+1, note.ID)
+		}
+	}
+}
+
+func TestHandleFunction(t *testing.T) {
+	blackboard := orchestrator.NewBlackboard()
+	for _, function := range blackboard.Functions() {
+		if !blackboard.HandlesFunction(function.Function.FunctionName) {
+			t.Errorf("expected %s to be handled", function.Function.FunctionName)
+		}
+	}
+	if blackboard.HandlesFunction("get_weather") {
+		t.Error("expected other functions not to be handled")
+	}
+
+	if response := call(t, blackboard, orchestrator.FunctionBlackboardWrite, map[string]any{"key": "destination", "value": "Lisbon"}); response.Status != models.FunctionResponseStatusSuccess {
+		t.Errorf("write failed: %+v", response)
+	}
+	if response := call(t, blackboard, orchestrator.FunctionBlackboardWrite, map[string]any{"value": "nowhere"}); response.Status != models.FunctionResponseStatusError {
+		t.Errorf("expected an empty key to be rejected, got %+v", response)
+	}
+	if response := call(t, blackboard, orchestrator.FunctionBlackboardRead, map[string]any{"key": "destination"}); response.Message != `"Lisbon"` {
+		t.Errorf("unexpected value %s", response.Message)
+	}
+	if response := call(t, blackboard, orchestrator.FunctionBlackboardRead, nil); response.Message != `["destination"]` {
+		t.Errorf("expected the keys to be listed, got %s", response.Message)
+	}
+	if response := call(t, blackboard, orchestrator.FunctionBlackboardRead, map[string]any{"key": "budget"}); response.Status != models.FunctionResponseStatusError {
+		t.Errorf("expected an error for a missing key, got %+v", response)
+	}
+
+	call(t, blackboard, orchestrator.FunctionBlackboardNote, map[string]any{"content": "Flights are cheaper in May"})
+	call(t, blackboard, orchestrator.FunctionBlackboardNote, map[string]any{"content": "Bob prefers trains"})
+
+	var notes []orchestrator.Note
+	json.Unmarshal([]byte(call(t, blackboard, orchestrator.FunctionBlackboardNotes, nil).Message), &notes)
+	if len(notes) != 2 || notes[0].Author != "alice" || notes[1].Content != "Bob prefers trains" {
+		t.Errorf("unexpected notes %+v", notes)
+	}
+
+	notes = nil
+	json.Unmarshal([]byte(call(t, blackboard, orchestrator.FunctionBlackboardSearch, map[string]any{"query": "TRAINS"}).Message), &notes)
+	if len(notes) != 1 || notes[0].ID != 2 {
+		t.Errorf("expected the note about trains, got %+v", notes)
+	}
+
+	if _, err := blackboard.HandleFunction(context.Background(), "alice", models.FunctionPayload{FunctionName: "get_weather"}); err == nil {
+		t.Error("expected an error for an unknown function")
+	}
+}
+
+func TestBlackboardVectorIndex(t *testing.T) {
+	vectorDb := aicompaniontest.NewFakeVectorDb()
+	blackboard := orchestrator.NewBlackboard().WithVectorIndex(vectorDb, aicompaniontest.NewFakeCompanion(), "notes")
+
+	for _, content := range []string{"flights are cheaper in may", "bob prefers trains over planes"} {
+		if _, err := blackboard.AddNote(context.Background(), "alice", content); err != nil {
+			t.Fatalf("failed to add note: %v", err)
+		}
+	}
+	if documents := vectorDb.Documents("notes"); len(documents) != 2 {
+		t.Fatalf("expected the notes to be indexed, got %d documents", len(documents))
+	}
+
+	notes, err := blackboard.SearchNotes(context.Background(), "bob prefers trains", 1)
+	if err != nil || len(notes) != 1 || notes[0].ID != 2 {
+		t.Errorf("expected the most similar note, got %+v (%v)", notes, err)
+	}
+}
+
+// toolCallingCompanion calls the blackboard functions with its first answer and answers like its fake
+// afterwards.
+type toolCallingCompanion struct {
+	*aicompaniontest.FakeCompanion
+	calls []models.ToolCall
+}
+
+func (companion *toolCallingCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	if len(companion.calls) == 0 {
+		return companion.FakeCompanion.SendChatRequest(ctx, message, streaming, callback)
+	}
+	companion.AddMessage(message.Message)
+	response := models.Message{Role: models.Assistant, ToolCalls: companion.calls}
+	companion.AddMessage(response)
+	companion.calls = nil
+	return response, nil
+}
+
+func TestSceneBlackboard(t *testing.T) {
+	alice := &toolCallingCompanion{FakeCompanion: aicompaniontest.NewFakeCompanion("Lisbon it is"), calls: []models.ToolCall{
+		{ID: "call-1", Payload: models.FunctionPayload{FunctionName: orchestrator.FunctionBlackboardWrite, Arguments: map[string]any{"key": "destination", "value": "Lisbon"}}},
+		{ID: "call-2", Payload: models.FunctionPayload{FunctionName: orchestrator.FunctionBlackboardRead, Arguments: map[string]any{"key": "destination"}}},
+	}}
+	bob, _ := newParticipant("bob")
+
+	scene := orchestrator.NewScene("Where to?", orchestrator.Participant{Name: "alice", Companion: alice}, bob)
+	scene.Blackboard = orchestrator.NewBlackboard()
+	turns, err := scene.Run(context.Background(), 1)
+	if err != nil || len(turns) != 1 || turns[0].Message.Content != "Lisbon it is" {
+		t.Fatalf("unexpected turns %+v (%v)", turns, err)
+	}
+
+	// the calls are answered by one tool message each, in the order of the calls
+	conversation := alice.GetConversation()
+	var results []models.Message
+	for _, message := range conversation {
+		if message.Role == models.ToolRole {
+			results = append(results, message)
+		}
+	}
+	if len(results) != 2 || results[0].ToolCallID != "call-1" || results[1].ToolCallID != "call-2" || !strings.Contains(results[1].Content, "Lisbon") {
+		t.Errorf("expected a tool message per call, got %+v", conversation)
+	}
+}
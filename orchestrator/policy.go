@@ -0,0 +1,111 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+const (
+	// DefaultMaxTurns limits scenes that don't configure a maximum, so agent chats can't loop forever.
+	DefaultMaxTurns = 20
+
+	// ModeratorPrompt is the default system prompt of the moderator deciding who speaks next.
+	ModeratorPrompt = "You moderate a conversation between several participants. Given the transcript and the list of participants, decide who should speak next. Reply with the participant name only, or with DONE if the conversation has reached its goal."
+
+	// moderatorDone is the answer with which a moderator ends the scene.
+	moderatorDone = "DONE"
+)
+
+// ErrSceneFinished is returned by a TurnPolicy to end the scene.
+var ErrSceneFinished = errors.New("scene finished")
+
+// ErrTurnTimeout is returned when a participant does not answer within the turn timeout.
+var ErrTurnTimeout = errors.New("turn timed out")
+
+// TurnPolicy decides which participant speaks next.
+type TurnPolicy interface {
+	// NextSpeaker returns the index of the next speaker, or ErrSceneFinished to end the scene.
+	NextSpeaker(ctx context.Context, scene *Scene) (int, error)
+}
+
+// RoundRobin lets the participants speak in order.
+type RoundRobin struct{}
+
+// NextSpeaker returns the participant following the last speaker.
+func (RoundRobin) NextSpeaker(ctx context.Context, scene *Scene) (int, error) {
+	return len(scene.turns) % len(scene.Participants), nil
+}
+
+// Moderator asks a model to decide who speaks next based on the transcript.
+type Moderator struct {
+	Companion aicompanion.AICompanion
+	Prompt    string
+}
+
+// NextSpeaker asks the moderator model for the next speaker. The first turn always goes to the
+// first participant. Answers not matching any participant fall back to round-robin.
+func (moderator Moderator) NextSpeaker(ctx context.Context, scene *Scene) (int, error) {
+	if len(scene.turns) == 0 {
+		return 0, nil
+	}
+
+	var names []string
+	for _, participant := range scene.Participants {
+		names = append(names, participant.Name)
+	}
+
+	var transcript strings.Builder
+	fmt.Fprintf(&transcript, "Opening: %s\n", scene.OpeningMessage)
+	for _, turn := range scene.turns {
+		if turn.Err != nil {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", turn.Speaker, turn.Message.Content)
+	}
+	fmt.Fprintf(&transcript, "\nParticipants: %s\nWho speaks next?", strings.Join(names, ", "))
+
+	prompt := moderator.Prompt
+	if prompt == "" {
+		prompt = ModeratorPrompt
+	}
+
+	message := sideKick.CreateUserMessage(transcript.String(), nil)
+	message.AlternatePrompt = prompt
+	response, err := moderator.Companion.SendGenerateRequest(ctx, models.MessageRequest{Message: message}, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("moderator failed: %w", err)
+	}
+
+	answer := strings.Trim(strings.TrimSpace(response.Content), ".\"'")
+	if strings.EqualFold(answer, moderatorDone) {
+		return 0, ErrSceneFinished
+	}
+	for i, name := range names {
+		if strings.EqualFold(answer, name) {
+			return i, nil
+		}
+	}
+
+	return RoundRobin{}.NextSpeaker(ctx, scene)
+}
+
+// StopCondition ends the scene after a turn if it returns true.
+type StopCondition func(turn Turn) bool
+
+// StopOnPhrases ends the scene when a turn contains any of the given phrases, ignoring case.
+func StopOnPhrases(phrases ...string) StopCondition {
+	return func(turn Turn) bool {
+		content := strings.ToLower(turn.Message.Content)
+		for _, phrase := range phrases {
+			if strings.Contains(content, strings.ToLower(phrase)) {
+				return true
+			}
+		}
+		return false
+	}
+}
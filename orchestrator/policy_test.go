@@ -0,0 +1,146 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/orchestrator"
+)
+
+// slowCompanion adds the message to its conversation and waits until the request is cancelled.
+type slowCompanion struct {
+	*aicompaniontest.FakeCompanion
+}
+
+func (companion slowCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	companion.AddMessage(message.Message)
+	<-ctx.Done()
+	return models.Message{}, ctx.Err()
+}
+
+// speakers returns the speakers of the turns.
+func speakers(turns []orchestrator.Turn) []string {
+	var names []string
+	for _, turn := range turns {
+		names = append(names, turn.Speaker)
+	}
+	return names
+}
+
+func TestMaxTurns(t *testing.T) {
+	alice, _ := newParticipant("alice")
+	bob, _ := newParticipant("bob")
+
+	scene := orchestrator.NewScene("Hi", alice, bob)
+	scene.MaxTurns = 3
+	if turns, _ := scene.Run(context.Background(), 0); len(turns) != 3 {
+		t.Errorf("expected 3 turns, got %d", len(turns))
+	}
+	if turns, _ := scene.Run(context.Background(), 5); len(turns) != 5 {
+		t.Errorf("expected rounds to override MaxTurns, got %d turns", len(turns))
+	}
+
+	scene.MaxTurns = 0
+	if turns, _ := scene.Run(context.Background(), 0); len(turns) != orchestrator.DefaultMaxTurns {
+		t.Errorf("expected %d turns by default, got %d", orchestrator.DefaultMaxTurns, len(turns))
+	}
+}
+
+func TestStopOnPhrases(t *testing.T) {
+	alice, _ := newParticipant("alice", "What do you think?")
+	bob, _ := newParticipant("bob", "I AGREE, we are done.")
+
+	scene := orchestrator.NewScene("Hi", alice, bob)
+	scene.StopConditions = []orchestrator.StopCondition{orchestrator.StopOnPhrases("disagree", "we are done")}
+	turns, err := scene.Run(context.Background(), 10)
+	if err != nil || len(turns) != 2 || turns[1].Speaker != "bob" {
+		t.Errorf("expected the scene to stop after the turn of bob, got %v (%v)", speakers(turns), err)
+	}
+
+	condition := orchestrator.StopOnPhrases("done")
+	if condition(orchestrator.Turn{Message: models.Message{Content: "not yet"}}) {
+		t.Error("expected no match")
+	}
+}
+
+func TestModerator(t *testing.T) {
+	alice, _ := newParticipant("alice")
+	bob, _ := newParticipant("bob")
+	carol, _ := newParticipant("carol")
+	moderator := aicompaniontest.NewFakeCompanion("Carol.", "bob", "DONE")
+
+	scene := orchestrator.NewScene("Hi", alice, bob, carol)
+	scene.Policy = orchestrator.Moderator{Companion: moderator}
+	turns, err := scene.Run(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("scene failed: %v", err)
+	}
+	if names := speakers(turns); !slices.Equal(names, []string{"alice", "carol", "bob"}) {
+		t.Errorf("expected the speakers chosen by the moderator, got %v", names)
+	}
+
+	request, _ := moderator.LastRequest()
+	if request.Message.AlternatePrompt != orchestrator.ModeratorPrompt || len(moderator.Requests()) != 3 {
+		t.Errorf("expected the moderator to be asked with its prompt after every turn, got %d requests", len(moderator.Requests()))
+	}
+
+	scene.Policy = orchestrator.Moderator{Companion: aicompaniontest.NewFakeCompanion("nobody")}
+	turns, _ = scene.Run(context.Background(), 3)
+	if names := speakers(turns); !slices.Equal(names, []string{"alice", "bob", "carol"}) {
+		t.Errorf("expected unknown answers to fall back to round-robin, got %v", names)
+	}
+
+	failing := aicompaniontest.NewFakeCompanion()
+	failing.Err = errors.New("unavailable")
+	scene.Policy = orchestrator.Moderator{Companion: failing}
+	if turns, err := scene.Run(context.Background(), 3); err == nil || len(turns) != 1 {
+		t.Errorf("expected the scene to fail with the moderator, got %d turns (%v)", len(turns), err)
+	}
+}
+
+func TestTurnTimeout(t *testing.T) {
+	alice, _ := newParticipant("alice", "Anyone there?")
+	slow := slowCompanion{aicompaniontest.NewFakeCompanion()}
+	carol, carolCompanion := newParticipant("carol", "I am")
+
+	scene := orchestrator.NewScene("Hi", alice, orchestrator.Participant{Name: "bob", Companion: slow}, carol)
+	scene.TurnTimeout = 50 * time.Millisecond
+	var reported []orchestrator.Turn
+	scene.OnTurn = func(turn orchestrator.Turn) error {
+		reported = append(reported, turn)
+		return nil
+	}
+
+	turns, err := scene.Run(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("expected the scene to go on after a timeout, got %v", err)
+	}
+	if names := speakers(turns); !slices.Equal(names, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("unexpected speakers %v", names)
+	}
+	if !errors.Is(turns[1].Err, orchestrator.ErrTurnTimeout) || turns[1].Message.Content != "" || turns[0].Err != nil || turns[2].Err != nil {
+		t.Errorf("expected only the turn of bob to time out, got %+v", turns)
+	}
+	if len(reported) != 3 || reported[1].Err == nil {
+		t.Errorf("expected the missed turn to be reported, got %d turns", len(reported))
+	}
+	if len(slow.GetConversation()) != 0 {
+		t.Errorf("expected the exchange to be removed from the conversation of bob, got %+v", slow.GetConversation())
+	}
+	if messages := received(carolCompanion); !slices.Equal(messages, []string{"alice: Anyone there?"}) {
+		t.Errorf("expected the missed turn to be left out, got %q", messages)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	scene.TurnTimeout = time.Second
+	scene.Participants[0].Companion = slow
+	if _, err := scene.Run(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a cancelled scene to fail, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+// Package orchestrator drives conversations between multiple companions.
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// maxBlackboardCalls limits the rounds of blackboard function calls within a single turn.
+const maxBlackboardCalls = 5
+
+// Participant is a companion taking part in a Scene.
+type Participant struct {
+	Name      string
+	Companion aicompanion.AICompanion
+	// Persona overrides the active persona of the companion for the scene, if set.
+	Persona *models.Persona
+}
+
+// Turn represents a single message spoken in a Scene.
+type Turn struct {
+	Index   int
+	Speaker string
+	Message models.Message
+	// Err is ErrTurnTimeout if the speaker missed the turn by exceeding the turn timeout.
+	Err error
+}
+
+// Scene drives a turn based conversation between participants. Every participant sees the messages
+// of the others as user messages and its own messages as assistant messages.
+type Scene struct {
+	Participants   []Participant
+	OpeningMessage string
+	Streaming      bool
+
+	// MaxTurns ends the scene after the given number of turns, defaults to DefaultMaxTurns.
+	MaxTurns int
+	// TurnTimeout limits how long a single participant may take to answer, if set. Participants
+	// exceeding it miss their turn.
+	TurnTimeout time.Duration
+	// Policy decides who speaks next, defaults to RoundRobin.
+	Policy TurnPolicy
+	// StopConditions end the scene once any of them matches a turn.
+	StopConditions []StopCondition
+
+	// Blackboard is shared by all participants, which access it through function calls, if set.
+	Blackboard *Blackboard
+
+	// OnChunk receives streamed parts of a turn, if streaming is enabled.
+	OnChunk func(speaker string, chunk models.Message) error
+	// OnTurn receives every completed turn.
+	OnTurn func(turn Turn) error
+
+	turns []Turn
+}
+
+// NewScene creates a new Scene with the given opening message and participants.
+func NewScene(openingMessage string, participants ...Participant) *Scene {
+	return &Scene{
+		Participants:   participants,
+		OpeningMessage: openingMessage,
+	}
+}
+
+// Turns returns the turns of the scene so far.
+func (scene *Scene) Turns() []Turn {
+	return scene.turns
+}
+
+// Prepare applies the personas of all participants and resets their conversations.
+func (scene *Scene) Prepare() error {
+	if len(scene.Participants) < 2 {
+		return errors.New("a scene requires at least two participants")
+	}
+
+	for i, participant := range scene.Participants {
+		if participant.Companion == nil {
+			return fmt.Errorf("participant %d has no companion", i)
+		}
+		if participant.Name == "" {
+			scene.Participants[i].Name = fmt.Sprintf("participant-%d", i+1)
+		}
+
+		if participant.Persona != nil {
+			config := participant.Companion.GetConfig()
+			config.ActivePersona = *participant.Persona
+			participant.Companion.SetConfig(config)
+		}
+		participant.Companion.SetConversation(make([]models.Message, 0))
+	}
+
+	scene.turns = nil
+	return nil
+}
+
+// Run prepares the scene and exchanges turns until a stop condition matches, the policy finishes
+// the scene or the maximum number of turns is reached. A positive rounds value overrides MaxTurns.
+// The opening message is addressed to the first speaker; every later speaker receives the turns it
+// missed, see Missed. The scene is cancelled with ctx.
+func (scene *Scene) Run(ctx context.Context, rounds int) ([]Turn, error) {
+	if err := scene.Prepare(); err != nil {
+		return nil, err
+	}
+
+	maxTurns := scene.MaxTurns
+	if rounds > 0 {
+		maxTurns = rounds
+	}
+	if maxTurns <= 0 {
+		maxTurns = DefaultMaxTurns
+	}
+
+	policy := scene.Policy
+	if policy == nil {
+		policy = RoundRobin{}
+	}
+
+	for len(scene.turns) < maxTurns {
+		speaker, err := policy.NextSpeaker(ctx, scene)
+		if errors.Is(err, ErrSceneFinished) {
+			break
+		}
+		if err != nil {
+			return scene.turns, err
+		}
+		if speaker < 0 || speaker >= len(scene.Participants) {
+			return scene.turns, fmt.Errorf("policy selected unknown participant %d", speaker)
+		}
+
+		turn, err := scene.Step(ctx, speaker, scene.Missed(speaker))
+		if err != nil {
+			return scene.turns, err
+		}
+
+		if scene.shouldStop(turn) {
+			break
+		}
+	}
+
+	return scene.turns, nil
+}
+
+// Missed returns what the participant at index speaker has missed since it last spoke: the turns of
+// the others, or all turns if it has not spoken yet. Turns that timed out are left out, and a participant
+// that has not spoken and missed nothing receives the opening message. In scenes of more than two
+// participants, every turn is prefixed with the name of its speaker.
+func (scene *Scene) Missed(speaker int) string {
+	start := 0
+	for i := len(scene.turns) - 1; i >= 0; i-- {
+		if scene.turns[i].Speaker == scene.Participants[speaker].Name {
+			start = i + 1
+			break
+		}
+	}
+
+	var missed []string
+	for _, turn := range scene.turns[start:] {
+		if turn.Err != nil {
+			continue
+		}
+		if len(scene.Participants) > 2 {
+			missed = append(missed, turn.Speaker+": "+turn.Message.Content)
+		} else {
+			missed = append(missed, turn.Message.Content)
+		}
+	}
+	if len(missed) == 0 && start == 0 {
+		return scene.OpeningMessage
+	}
+	return strings.Join(missed, "\n\n")
+}
+
+// shouldStop reports whether any stop condition matches the turn.
+func (scene *Scene) shouldStop(turn Turn) bool {
+	for _, condition := range scene.StopConditions {
+		if condition(turn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Step lets the participant at the given index answer the message and records the turn. A participant
+// exceeding the turn timeout misses its turn: the request is cancelled, the exchange is removed from its
+// conversation and the turn is recorded with ErrTurnTimeout, so the scene goes on.
+func (scene *Scene) Step(ctx context.Context, speaker int, message string) (Turn, error) {
+	participant := scene.Participants[speaker]
+
+	turnCtx := ctx
+	if scene.TurnTimeout > 0 {
+		var cancel context.CancelFunc
+		turnCtx, cancel = context.WithTimeout(ctx, scene.TurnTimeout)
+		defer cancel()
+	}
+
+	conversation := participant.Companion.GetConversation()
+	response, err := scene.answer(turnCtx, participant, message)
+	turn := Turn{Index: len(scene.turns), Speaker: participant.Name, Message: response}
+	if err != nil && ctx.Err() == nil && errors.Is(turnCtx.Err(), context.DeadlineExceeded) {
+		participant.Companion.SetConversation(conversation)
+		turn.Message, turn.Err = models.Message{}, ErrTurnTimeout
+	} else if err != nil {
+		return Turn{}, fmt.Errorf("turn %d of %s failed: %w", len(scene.turns), participant.Name, err)
+	}
+	scene.turns = append(scene.turns, turn)
+
+	if scene.OnTurn != nil {
+		if err := scene.OnTurn(turn); err != nil {
+			return turn, err
+		}
+	}
+
+	return turn, nil
+}
+
+// answer sends the message to the participant and lets it use the blackboard until it answers without
+// function calls.
+func (scene *Scene) answer(ctx context.Context, participant Participant, message string) (models.Message, error) {
+	var callback func(m models.Message) error
+	if scene.Streaming {
+		callback = func(m models.Message) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if scene.OnChunk != nil {
+				return scene.OnChunk(participant.Name, m)
+			}
+			return nil
+		}
+	}
+
+	request := models.MessageRequest{Message: sideKick.CreateUserMessage(message, nil)}
+	if scene.Blackboard != nil {
+		request.Tools = scene.Blackboard.Functions()
+	}
+
+	response, err := participant.Companion.SendChatRequest(ctx, request, scene.Streaming, callback)
+	for i := 0; err == nil && i < maxBlackboardCalls && scene.Blackboard != nil && len(response.ToolCalls) > 0; i++ {
+		// every call is answered by a tool message; the last one is sent, the others precede it
+		results := scene.runBlackboardCalls(ctx, participant.Name, response.ToolCalls)
+		for _, result := range results[:len(results)-1] {
+			participant.Companion.AddMessage(result)
+		}
+		request.Message = results[len(results)-1]
+		response, err = participant.Companion.SendChatRequest(ctx, request, scene.Streaming, callback)
+	}
+	return response, err
+}
+
+// runBlackboardCalls executes the blackboard function calls of a participant and returns a tool message
+// answering each call.
+func (scene *Scene) runBlackboardCalls(ctx context.Context, author string, toolCalls []models.ToolCall) []models.Message {
+	results := make([]models.Message, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		response, err := scene.Blackboard.HandleFunction(ctx, author, toolCall.Payload)
+		if err != nil {
+			response = models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}
+		}
+		results = append(results, sideKick.CreateToolMessage(toolCall, response))
+	}
+	return results
+}
@@ -0,0 +1,102 @@
+package orchestrator_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/orchestrator"
+)
+
+// newParticipant creates a participant whose fake companion answers with the given responses.
+func newParticipant(name string, responses ...string) (orchestrator.Participant, *aicompaniontest.FakeCompanion) {
+	companion := aicompaniontest.NewFakeCompanion(responses...)
+	return orchestrator.Participant{Name: name, Companion: companion}, companion
+}
+
+// received returns the messages a fake companion was sent.
+func received(companion *aicompaniontest.FakeCompanion) []string {
+	var messages []string
+	for _, request := range companion.Requests() {
+		messages = append(messages, request.Message.Content)
+	}
+	return messages
+}
+
+func TestSceneRun(t *testing.T) {
+	alice, aliceCompanion := newParticipant("alice", "a1", "a2")
+	bob, bobCompanion := newParticipant("bob", "b1", "b2")
+	persona := models.Persona{Name: "critic"}
+	bob.Persona = &persona
+	bobCompanion.Conversation = []models.Message{{Role: models.User, Content: "old"}}
+
+	scene := orchestrator.NewScene("Let's plan a trip", alice, bob)
+	turns, err := scene.Run(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("scene failed: %v", err)
+	}
+
+	var spoken []string
+	for i, turn := range turns {
+		if turn.Index != i {
+			t.Errorf("expected turn %d to have index %d", i, turn.Index)
+		}
+		spoken = append(spoken, turn.Speaker+":"+turn.Message.Content)
+	}
+	if expected := []string{"alice:a1", "bob:b1", "alice:a2", "bob:b2"}; !slices.Equal(spoken, expected) {
+		t.Errorf("expected turns %v, got %v", expected, spoken)
+	}
+
+	if messages := received(aliceCompanion); !slices.Equal(messages, []string{"Let's plan a trip", "b1"}) {
+		t.Errorf("unexpected messages of alice %v", messages)
+	}
+	if messages := received(bobCompanion); !slices.Equal(messages, []string{"a1", "a2"}) {
+		t.Errorf("unexpected messages of bob %v", messages)
+	}
+	if bobCompanion.Config.ActivePersona.Name != "critic" {
+		t.Errorf("expected the persona to be applied, got %q", bobCompanion.Config.ActivePersona.Name)
+	}
+	if len(bobCompanion.Conversation) != 4 || bobCompanion.Conversation[0].Content != "a1" {
+		t.Errorf("expected a fresh conversation of bob, got %+v", bobCompanion.Conversation)
+	}
+}
+
+func TestSceneMissedTurns(t *testing.T) {
+	alice, aliceCompanion := newParticipant("alice", "a1", "a2")
+	bob, bobCompanion := newParticipant("bob", "b1")
+	carol, carolCompanion := newParticipant("carol", "c1")
+
+	scene := orchestrator.NewScene("Opening", alice, bob, carol)
+	if _, err := scene.Run(context.Background(), 4); err != nil {
+		t.Fatalf("scene failed: %v", err)
+	}
+
+	if messages := received(aliceCompanion); !slices.Equal(messages, []string{"Opening", "bob: b1\n\ncarol: c1"}) {
+		t.Errorf("expected alice to receive the turns of bob and carol, got %q", messages)
+	}
+	if messages := received(bobCompanion); !slices.Equal(messages, []string{"alice: a1"}) {
+		t.Errorf("unexpected messages of bob %q", messages)
+	}
+	if messages := received(carolCompanion); !slices.Equal(messages, []string{"alice: a1\n\nbob: b1"}) {
+		t.Errorf("expected carol to receive all turns before her first one, got %q", messages)
+	}
+}
+
+func TestScenePrepare(t *testing.T) {
+	alice, _ := newParticipant("", "a")
+	if _, err := orchestrator.NewScene("Hi", alice).Run(context.Background(), 1); err == nil {
+		t.Error("expected an error for a single participant")
+	}
+	if _, err := orchestrator.NewScene("Hi", alice, orchestrator.Participant{Name: "nobody"}).Run(context.Background(), 1); err == nil {
+		t.Error("expected an error for a participant without companion")
+	}
+
+	bob, _ := newParticipant("", "b")
+	scene := orchestrator.NewScene("Hi", alice, bob)
+	turns, err := scene.Run(context.Background(), 2)
+	if err != nil || turns[0].Speaker != "participant-1" || turns[1].Speaker != "participant-2" {
+		t.Errorf("expected generated participant names, got %+v (%v)", turns, err)
+	}
+}
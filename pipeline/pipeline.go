@@ -0,0 +1,307 @@
+// Package pipeline composes multi-step workflows (prompt templates, tool calls, retrieval and branching)
+// that are executed with a shared state, so chains like summarize, extract, classify need no glue code.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/ghmer/aicompanion"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// State is the shared context of a pipeline run. Steps read their inputs from and write their outputs to Vars.
+type State struct {
+	mutex sync.RWMutex
+	Vars  map[string]any
+	// Trace records the names of the executed steps in order.
+	Trace []string
+}
+
+// NewState creates a new State with the given input variables.
+func NewState(inputs map[string]any) *State {
+	vars := make(map[string]any, len(inputs))
+	for key, value := range inputs {
+		vars[key] = value
+	}
+	return &State{Vars: vars}
+}
+
+// Get returns the variable with the given name.
+func (state *State) Get(name string) any {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.Vars[name]
+}
+
+// GetString returns the variable with the given name formatted as string.
+func (state *State) GetString(name string) string {
+	value := state.Get(name)
+	if value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// Set stores a variable.
+func (state *State) Set(name string, value any) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.Vars[name] = value
+}
+
+// Render executes a text/template against the variables of the state.
+func (state *State) Render(text string) (string, error) {
+	tmpl, err := template.New("step").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, state.Vars); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return result.String(), nil
+}
+
+// Step is a single unit of work in a pipeline.
+type Step interface {
+	// Name identifies the step in errors and traces.
+	Name() string
+	// Run executes the step against the shared state.
+	Run(ctx context.Context, state *State) error
+}
+
+// Pipeline executes its steps in order.
+type Pipeline struct {
+	Steps []Step
+}
+
+// New creates a new Pipeline from the given steps.
+func New(steps ...Step) *Pipeline {
+	return &Pipeline{Steps: steps}
+}
+
+// Then appends a step and returns the pipeline for chaining.
+func (pipeline *Pipeline) Then(step Step) *Pipeline {
+	pipeline.Steps = append(pipeline.Steps, step)
+	return pipeline
+}
+
+// Execute runs the pipeline with the given inputs and returns the final state.
+func (pipeline *Pipeline) Execute(ctx context.Context, inputs map[string]any) (*State, error) {
+	state := NewState(inputs)
+	return state, pipeline.Run(ctx, state)
+}
+
+// Run executes all steps against an existing state. It allows pipelines to be nested as steps.
+func (pipeline *Pipeline) Run(ctx context.Context, state *State) error {
+	for _, step := range pipeline.Steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		state.mutex.Lock()
+		state.Trace = append(state.Trace, step.Name())
+		state.mutex.Unlock()
+
+		if err := step.Run(ctx, state); err != nil {
+			return fmt.Errorf("step %s failed: %w", step.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Name implements Step, so pipelines can be nested.
+func (pipeline *Pipeline) Name() string {
+	return "pipeline"
+}
+
+// PromptStep renders a prompt template, sends it to the companion and stores the answer in Output.
+// Prompts are sent as generate requests, so the conversation of the companion is not modified.
+type PromptStep struct {
+	StepName     string
+	Companion    aicompanion.AICompanion
+	Template     string
+	SystemPrompt string // optional system prompt for this step
+	Output       string
+}
+
+// Name implements Step.
+func (step PromptStep) Name() string { return step.StepName }
+
+// Run implements Step.
+func (step PromptStep) Run(ctx context.Context, state *State) error {
+	prompt, err := state.Render(step.Template)
+	if err != nil {
+		return err
+	}
+
+	message := sideKick.CreateUserMessage(prompt, nil)
+	message.AlternatePrompt = step.SystemPrompt
+	response, err := step.Companion.SendGenerateRequest(ctx, models.MessageRequest{Message: message}, false, nil)
+	if err != nil {
+		return err
+	}
+
+	state.Set(step.Output, strings.TrimSpace(response.Content))
+	return nil
+}
+
+// ToolStep calls a tool with arguments rendered from templates and stores the response message in Output.
+type ToolStep struct {
+	StepName  string
+	Companion aicompanion.AICompanion
+	Tool      models.Tool
+	Arguments map[string]string // argument templates
+	Output    string
+}
+
+// Name implements Step.
+func (step ToolStep) Name() string { return step.StepName }
+
+// Run implements Step.
+func (step ToolStep) Run(ctx context.Context, state *State) error {
+	arguments := make(map[string]any, len(step.Arguments))
+	for name, argumentTemplate := range step.Arguments {
+		value, err := state.Render(argumentTemplate)
+		if err != nil {
+			return err
+		}
+		arguments[name] = value
+	}
+
+	payload := models.FunctionPayload{FunctionName: step.Tool.Function.Function.FunctionName, Arguments: arguments}
+	response, err := step.Companion.RunFunction(ctx, step.Tool, payload)
+	if err != nil {
+		return err
+	}
+	if response.Status == models.FunctionResponseStatusError {
+		return errors.New(response.Message)
+	}
+
+	state.Set(step.Output, response.Message)
+	return nil
+}
+
+// RetrievalStep embeds a rendered query, retrieves similar documents and stores them in Output.
+// The text of the documents is read from the metadata key TextKey, or from their Content if the key is
+// missing, and joined into OutputText, if set.
+type RetrievalStep struct {
+	StepName   string
+	Companion  aicompanion.AICompanion
+	VectorDb   vectordb.VectorDb
+	ClassName  string
+	Query      string
+	Options    models.VectorDBQueryOptions
+	TextKey    string
+	Output     string
+	OutputText string
+}
+
+// Name implements Step.
+func (step RetrievalStep) Name() string { return step.StepName }
+
+// Run implements Step.
+func (step RetrievalStep) Run(ctx context.Context, state *State) error {
+	query, err := state.Render(step.Query)
+	if err != nil {
+		return err
+	}
+
+	model := step.Companion.GetConfig().AiModels.EmbeddingModel
+	embeddings, err := step.Companion.SendEmbeddingRequest(ctx, sideKick.CreateEmbeddingRequest(model, []string{query}))
+	if err != nil {
+		return err
+	}
+	if len(embeddings.Embeddings) == 0 {
+		return errors.New("no embeddings returned")
+	}
+
+	documents, err := step.VectorDb.QueryDocuments(ctx, step.ClassName, embeddings.Embeddings[0], step.Options)
+	if err != nil {
+		return err
+	}
+
+	if step.Output != "" {
+		state.Set(step.Output, documents)
+	}
+	if step.OutputText != "" {
+		var texts []string
+		for _, document := range documents {
+			if text, ok := document.Metadata[step.TextKey].(string); ok && step.TextKey != "" {
+				texts = append(texts, text)
+			} else if document.Content != "" {
+				texts = append(texts, document.Content)
+			}
+		}
+		state.Set(step.OutputText, strings.Join(texts, "\n\n"))
+	}
+	return nil
+}
+
+// BranchStep selects the next step based on the state. Select returns a key into Branches;
+// if no branch matches, Default is run, if set.
+type BranchStep struct {
+	StepName string
+	Select   func(state *State) string
+	Branches map[string]Step
+	Default  Step
+}
+
+// Name implements Step.
+func (step BranchStep) Name() string { return step.StepName }
+
+// Run implements Step.
+func (step BranchStep) Run(ctx context.Context, state *State) error {
+	key := step.Select(state)
+	branch, exists := step.Branches[key]
+	if !exists {
+		branch = step.Default
+	}
+	if branch == nil {
+		return fmt.Errorf("no branch for %q", key)
+	}
+
+	state.mutex.Lock()
+	state.Trace = append(state.Trace, branch.Name())
+	state.mutex.Unlock()
+
+	return branch.Run(ctx, state)
+}
+
+// BranchOn returns a selector for BranchStep that normalizes the text of a variable,
+// e.g. a classification produced by a previous prompt step.
+func BranchOn(variable string) func(state *State) string {
+	return func(state *State) string {
+		return strings.ToLower(strings.Trim(strings.TrimSpace(state.GetString(variable)), ".\"'"))
+	}
+}
+
+// FuncStep runs an arbitrary Go function as a step.
+type FuncStep struct {
+	StepName string
+	Func     func(ctx context.Context, state *State) error
+}
+
+// Name implements Step.
+func (step FuncStep) Name() string { return step.StepName }
+
+// Run implements Step.
+func (step FuncStep) Run(ctx context.Context, state *State) error {
+	return step.Func(ctx, state)
+}
@@ -0,0 +1,87 @@
+package pipeline_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/pipeline"
+)
+
+func TestPipeline(t *testing.T) {
+	t.Run("Test branching on shared state", func(t *testing.T) {
+		p := pipeline.New(
+			pipeline.FuncStep{StepName: "classify", Func: func(ctx context.Context, state *pipeline.State) error {
+				state.Set("label", " Positive. ")
+				return nil
+			}},
+			pipeline.BranchStep{
+				StepName: "route",
+				Select:   pipeline.BranchOn("label"),
+				Branches: map[string]pipeline.Step{
+					"positive": pipeline.FuncStep{StepName: "thank", Func: func(ctx context.Context, state *pipeline.State) error {
+						text, err := state.Render("Thanks, {{.name}}!")
+						state.Set("reply", text)
+						return err
+					}},
+				},
+			},
+		)
+
+		state, err := p.Execute(context.Background(), map[string]any{"name": "Ada"})
+		if err != nil {
+			t.Fatalf("pipeline failed: %v", err)
+		}
+
+		if state.GetString("reply") != "Thanks, Ada!" {
+			t.Errorf("expected reply 'Thanks, Ada!', got %q", state.GetString("reply"))
+		}
+
+		if strings.Join(state.Trace, ",") != "classify,route,thank" {
+			t.Errorf("unexpected trace %v", state.Trace)
+		}
+	})
+
+	t.Run("Test missing branch", func(t *testing.T) {
+		p := pipeline.New(pipeline.BranchStep{
+			StepName: "route",
+			Select:   func(state *pipeline.State) string { return "unknown" },
+		})
+
+		if _, err := p.Execute(context.Background(), nil); err == nil {
+			t.Error("expected error for missing branch, got nil")
+		}
+	})
+	t.Run("Test retrieval text", func(t *testing.T) {
+		companion := aicompaniontest.NewFakeCompanion()
+		vectorDb := aicompaniontest.NewFakeVectorDb()
+		vector := aicompaniontest.Embed("tea", aicompaniontest.DefaultDimensions)
+		vectorDb.AddDocument(context.Background(), "notes", "ingested", models.Document{ID: "ingested", Content: "Green tea is a drink", Embeddings: vector})
+		vectorDb.AddDocument(context.Background(), "notes", "annotated", models.Document{ID: "annotated", Content: "ignored", Metadata: map[string]any{"text": "Black tea is a drink"}, Embeddings: vector})
+
+		p := pipeline.New(pipeline.RetrievalStep{
+			StepName:   "retrieve",
+			Companion:  companion,
+			VectorDb:   vectorDb,
+			ClassName:  "notes",
+			Query:      "{{.topic}}",
+			TextKey:    "text",
+			Output:     "documents",
+			OutputText: "context",
+		})
+
+		state, err := p.Execute(context.Background(), map[string]any{"topic": "tea"})
+		if err != nil {
+			t.Fatalf("pipeline failed: %v", err)
+		}
+
+		texts := strings.Split(state.GetString("context"), "\n\n")
+		sort.Strings(texts)
+		if strings.Join(texts, "|") != "Black tea is a drink|Green tea is a drink" {
+			t.Errorf("expected the metadata text and the content of the documents, got %q", texts)
+		}
+	})
+}
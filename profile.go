@@ -0,0 +1,157 @@
+package aicompanion
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+// ErrUnknownProfile is returned when switching to a profile the configuration does not define.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// ApplyProfile returns config with the values of the named profile. If the profile changes the provider
+// without setting endpoints, the default endpoints of the provider are used.
+func ApplyProfile(config models.Configuration, name string) (models.Configuration, error) {
+	profile, ok := config.GetProfile(name)
+	if !ok {
+		return config, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	switchesProvider := profile.ApiProvider != "" && profile.ApiProvider != config.ApiProvider
+	if profile.ApiProvider != "" {
+		config.ApiProvider = profile.ApiProvider
+	}
+	if profile.ApiKey != "" {
+		config.ApiKey = profile.ApiKey
+	}
+	if profile.ApiEndpoints != (models.ApiEndpointUrls{}) {
+		config.ApiEndpoints = profile.ApiEndpoints
+	} else if switchesProvider {
+		config.ApiEndpoints = DefaultEndpoints(config.ApiProvider)
+	}
+
+	for _, model := range []struct{ profile, config *models.Model }{
+		{&profile.AiModels.ChatModel, &config.AiModels.ChatModel},
+		{&profile.AiModels.GenerateModel, &config.AiModels.GenerateModel},
+		{&profile.AiModels.EmbeddingModel, &config.AiModels.EmbeddingModel},
+		{&profile.AiModels.TranscriptionModel, &config.AiModels.TranscriptionModel},
+		{&profile.AiModels.ModerationModel, &config.AiModels.ModerationModel},
+		{&profile.AiModels.RerankModel, &config.AiModels.RerankModel},
+	} {
+		if model.profile.Model != "" {
+			*model.config = *model.profile
+		}
+	}
+
+	config.ActiveProfile = name
+	return config, nil
+}
+
+// ProfileCompanion is a companion that can switch between the provider profiles of its configuration at
+// runtime. Switching creates a companion for the profile, which continues the conversation and session
+// and keeps the prompts, vector database, conversation store, tool registry and tool call hook. The
+// usage counters and the HTTP client are those of the profile. Profiles must not be switched while
+// requests are sent.
+type ProfileCompanion struct {
+	AICompanion
+
+	store    conversationstore.Store
+	registry *tools.Registry
+	hook     models.ToolCallHook
+}
+
+// NewProfileCompanion creates a companion for config, applying its ActiveProfile if set.
+func NewProfileCompanion(config models.Configuration) (*ProfileCompanion, error) {
+	if config.ActiveProfile != "" {
+		var err error
+		if config, err = ApplyProfile(config, config.ActiveProfile); err != nil {
+			return nil, err
+		}
+	}
+	companion := &ProfileCompanion{AICompanion: NewCompanion(config)}
+	if companion.AICompanion == nil {
+		return nil, fmt.Errorf("unsupported provider: %s", config.ApiProvider)
+	}
+	// the sessions are kept in a store shared by the companions of all profiles
+	companion.SetConversationStore(conversationstore.NewMemoryStore())
+	return companion, nil
+}
+
+// CurrentProfile returns the name of the active profile, or "" if none was applied.
+func (companion *ProfileCompanion) CurrentProfile() string {
+	return companion.GetConfig().ActiveProfile
+}
+
+// SwitchProfile continues with the backend of the named profile.
+func (companion *ProfileCompanion) SwitchProfile(name string) error {
+	previous := companion.AICompanion
+	config, err := ApplyProfile(previous.GetConfig(), name)
+	if err != nil {
+		return err
+	}
+	next := NewCompanion(config)
+	if next == nil {
+		return fmt.Errorf("unsupported provider: %s", config.ApiProvider)
+	}
+
+	// the conversation of the current session is saved to the store, where the next companion finds it
+	session := previous.CurrentSession()
+	if err := previous.SwitchSession(session); err != nil {
+		return err
+	}
+	next.SetConversationStore(companion.store)
+	if session != conversationstore.DefaultSession {
+		// switching saves the conversation of the default session, which must not be replaced by an empty one
+		conversation, err := companion.store.Load(conversationstore.DefaultSession)
+		if err != nil {
+			return err
+		}
+		next.SetConversation(conversation)
+		if err := next.SwitchSession(session); err != nil {
+			return err
+		}
+	}
+	next.SetConversation(previous.GetConversation())
+
+	copyPrompts(previous, next)
+	if companion.registry != nil {
+		next.SetToolRegistry(companion.registry)
+	}
+	if companion.hook != nil {
+		next.SetOnToolCall(companion.hook)
+	}
+
+	companion.AICompanion = next
+	return nil
+}
+
+// SetConversationStore implements AICompanion.
+func (companion *ProfileCompanion) SetConversationStore(store conversationstore.Store) {
+	companion.store = store
+	companion.AICompanion.SetConversationStore(store)
+}
+
+// SetToolRegistry implements AICompanion.
+func (companion *ProfileCompanion) SetToolRegistry(registry *tools.Registry) {
+	companion.registry = registry
+	companion.AICompanion.SetToolRegistry(registry)
+}
+
+// SetOnToolCall implements AICompanion.
+func (companion *ProfileCompanion) SetOnToolCall(hook models.ToolCallHook) {
+	companion.hook = hook
+	companion.AICompanion.SetOnToolCall(hook)
+}
+
+// copyPrompts hands the prompts and the vector database of a companion to another one.
+func copyPrompts(from, to AICompanion) {
+	to.SetSystemRole(from.GetSystemRole().Content)
+	to.SetEnrichmentPrompt(from.GetEnrichmentPrompt())
+	to.SetSummarizationPrompt(from.GetSummarizationPrompt())
+	if vectorDb := from.GetVectorDB(); vectorDb != nil {
+		to.SetVectorDB(vectorDb)
+	}
+}
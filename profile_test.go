@@ -0,0 +1,89 @@
+package aicompanion_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/openai"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// newProfileServer answers chat requests with its name and reports the number of messages it received.
+func newProfileServer(t *testing.T, name string, received *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload openai.ChatRequest
+		json.NewDecoder(r.Body).Decode(&payload)
+		*received = len(payload.Messages)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, payload.Model, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProfileCompanion(t *testing.T) {
+	var local, remote int
+	localServer := newProfileServer(t, "local", &local)
+	remoteServer := newProfileServer(t, "remote", &remote)
+
+	config := aicompanion.NewDefaultConfig(models.Ollama, "", "llama3", "llama3", "nomic-embed-text")
+	config.Profiles = []models.Profile{
+		{Name: "local", ApiProvider: models.OpenAI, ApiEndpoints: models.ApiEndpointUrls{ApiChatURL: localServer.URL}},
+		{Name: "remote", ApiKey: "sk-remote", ApiEndpoints: models.ApiEndpointUrls{ApiChatURL: remoteServer.URL}, AiModels: models.AiModels{ChatModel: models.Model{Model: "gpt-4o", Name: "gpt-4o"}}},
+	}
+	config.ActiveProfile = "local"
+
+	companion, err := aicompanion.NewProfileCompanion(*config)
+	if err != nil {
+		t.Fatalf("failed to create companion: %v", err)
+	}
+	companion.SetSystemRole("You are terse")
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}}
+	send := func() string {
+		result, err := companion.SendChatRequest(context.Background(), request, false, nil)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return result.Content
+	}
+
+	if answer := send(); answer != "local" || companion.CurrentProfile() != "local" {
+		t.Fatalf("expected the local profile to answer, got %q", answer)
+	}
+	if err := companion.SwitchSession("work"); err != nil {
+		t.Fatal(err)
+	}
+	send()
+
+	if err := companion.SwitchProfile("missing"); !errors.Is(err, aicompanion.ErrUnknownProfile) {
+		t.Errorf("expected ErrUnknownProfile, got %v", err)
+	}
+	if err := companion.SwitchProfile("remote"); err != nil {
+		t.Fatalf("failed to switch profile: %v", err)
+	}
+	config2 := companion.GetConfig()
+	if config2.ApiProvider != models.OpenAI || config2.ApiKey != "sk-remote" || config2.AiModels.ChatModel.Model != "gpt-4o" || config2.AiModels.EmbeddingModel.Model != "nomic-embed-text" {
+		t.Errorf("unexpected configuration of the profile %+v", config2)
+	}
+	if companion.CurrentSession() != "work" || len(companion.GetConversation()) != 2 || companion.GetSystemRole().Content != "You are terse" {
+		t.Errorf("expected the session to continue, got %s with %d messages", companion.CurrentSession(), len(companion.GetConversation()))
+	}
+	if answer := send(); answer != "remote" || remote != 4 {
+		t.Errorf("expected the remote profile to answer with the conversation, got %q after %d messages", answer, remote)
+	}
+
+	if err := companion.SwitchSession("default"); err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := companion.ListSessions()
+	if len(companion.GetConversation()) != 2 || !slices.Equal(sessions, []string{"default", "work"}) {
+		t.Errorf("expected the default session to be kept, got %d messages in %v", len(companion.GetConversation()), sessions)
+	}
+}
@@ -0,0 +1,136 @@
+// Package rag provides the building blocks of retrieval-augmented generation that are shared by the
+// ingestion pipeline and its users, such as splitting text into chunks.
+package rag
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ghmer/aicompanion/impl/sidekick"
+)
+
+const (
+	// DefaultChunkSize is the maximum length of a chunk if Chunker.Size is not set.
+	DefaultChunkSize = 1000
+	// DefaultChunkOverlap is the length consecutive chunks share if Chunker.Overlap is not set.
+	DefaultChunkOverlap = 100
+)
+
+// DefaultSeparators are tried in order: paragraphs, lines, sentences, words and finally single characters.
+var DefaultSeparators = []string{"\n\n", "\n", ". ", " ", ""}
+
+// CharacterLength measures text in characters (runes).
+func CharacterLength(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// TokenLength approximates the number of tokens of text as counted by common subword tokenizers: every
+// punctuation character is a token, words count one token per four characters. Use a Chunker with the
+// tokenizer of a model as Length where exact counts matter.
+func TokenLength(text string) int {
+	return sidekick.EstimateTokens(text)
+}
+
+// Chunker splits text into chunks of at most Size, measured by Length. Text is split at the first of
+// the Separators that occurs in it; parts that are still too long are split at the following ones.
+// Consecutive chunks share trailing parts of up to Overlap. The zero value splits into chunks of
+// DefaultChunkSize characters with DefaultChunkOverlap characters of overlap.
+type Chunker struct {
+	Size       int              // Maximum length of a chunk, defaults to DefaultChunkSize
+	Overlap    int              // Maximum length shared by consecutive chunks, defaults to DefaultChunkOverlap. Negative disables overlap.
+	Separators []string         // Separators in order of preference, defaults to DefaultSeparators
+	Length     func(string) int // Measures text, defaults to CharacterLength
+}
+
+// NewTokenChunker creates a chunker that measures size and overlap in approximated tokens.
+func NewTokenChunker(size, overlap int) Chunker {
+	return Chunker{Size: size, Overlap: overlap, Length: TokenLength}
+}
+
+// Chunk splits text into chunks. Leading and trailing whitespace of chunks is removed and empty chunks
+// are dropped.
+func (chunker Chunker) Chunk(text string) []string {
+	if chunker.Size <= 0 {
+		chunker.Size = DefaultChunkSize
+	}
+	if chunker.Overlap == 0 {
+		chunker.Overlap = DefaultChunkOverlap
+	}
+	if chunker.Overlap < 0 || chunker.Overlap >= chunker.Size {
+		chunker.Overlap = 0
+	}
+	if chunker.Length == nil {
+		chunker.Length = CharacterLength
+	}
+	separators := chunker.Separators
+	if len(separators) == 0 {
+		separators = DefaultSeparators
+	}
+	return chunker.split(strings.TrimSpace(text), separators)
+}
+
+// split splits text at the first separator that occurs in it and merges the parts into chunks.
+func (chunker Chunker) split(text string, separators []string) []string {
+	if text == "" {
+		return nil
+	}
+	if chunker.Length(text) <= chunker.Size {
+		return []string{text}
+	}
+
+	// splitting at the empty separator yields single characters and always succeeds
+	separator, remaining := "", []string(nil)
+	for i, candidate := range separators {
+		if candidate == "" || strings.Contains(text, candidate) {
+			separator, remaining = candidate, separators[i+1:]
+			break
+		}
+	}
+
+	var chunks []string
+	var current []string
+	var lengths []int
+	var total int
+	separatorLength := chunker.Length(separator)
+	emit := func() {
+		if chunk := strings.TrimSpace(strings.Join(current, separator)); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	for _, part := range strings.Split(text, separator) {
+		if part == "" {
+			continue
+		}
+
+		length := chunker.Length(part)
+		if length > chunker.Size {
+			emit()
+			current, lengths, total = nil, nil, 0
+			chunks = append(chunks, chunker.split(strings.TrimSpace(part), remaining)...)
+			continue
+		}
+
+		if len(current) > 0 && total+separatorLength+length > chunker.Size {
+			emit()
+			// keep trailing parts as overlap as long as they and the next part fit
+			for len(current) > 0 && (total > chunker.Overlap || total+separatorLength+length > chunker.Size) {
+				total -= lengths[0]
+				if len(current) > 1 {
+					total -= separatorLength
+				}
+				current, lengths = current[1:], lengths[1:]
+			}
+		}
+
+		if len(current) > 0 {
+			total += separatorLength
+		}
+		current = append(current, part)
+		lengths = append(lengths, length)
+		total += length
+	}
+
+	emit()
+	return chunks
+}
@@ -0,0 +1,59 @@
+package rag_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/rag"
+)
+
+func TestChunkerSeparators(t *testing.T) {
+	text := "First paragraph.\n\nSecond paragraph is longer. It has two sentences.\n\nThird."
+
+	chunks := rag.Chunker{Size: 30, Overlap: -1}.Chunk(text)
+	expected := []string{"First paragraph.", "Second paragraph is longer", "It has two sentences.", "Third."}
+	if fmt.Sprintf("%q", chunks) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, chunks)
+	}
+
+	if chunks := (rag.Chunker{}).Chunk(text); len(chunks) != 1 || chunks[0] != text {
+		t.Errorf("expected a single chunk, got %q", chunks)
+	}
+	if chunks := (rag.Chunker{}).Chunk(" \n "); chunks != nil {
+		t.Errorf("expected no chunks, got %q", chunks)
+	}
+}
+
+func TestChunkerOverlap(t *testing.T) {
+	text := "one two three four five six seven eight"
+
+	chunks := rag.Chunker{Size: 15, Overlap: 5, Separators: []string{" "}}.Chunk(text)
+	expected := []string{"one two three", "three four five", "five six seven", "seven eight"}
+	if fmt.Sprintf("%q", chunks) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, chunks)
+	}
+
+	// words longer than the size fall back to characters
+	chunks = rag.Chunker{Size: 4, Overlap: -1}.Chunk("abcdefghij")
+	if strings.Join(chunks, "|") != "abcd|efgh|ij" {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+}
+
+func TestTokenChunker(t *testing.T) {
+	if length := rag.TokenLength("Hello, tokenization!"); length != 7 {
+		t.Errorf("expected 7 tokens, got %d", length)
+	}
+
+	text := strings.Repeat("word ", 100)
+	chunks := rag.NewTokenChunker(10, 2).Chunk(text)
+	for _, chunk := range chunks {
+		if length := rag.TokenLength(chunk); length > 10 {
+			t.Errorf("chunk of %d tokens exceeds the size: %q", length, chunk)
+		}
+	}
+	if len(chunks) != 13 {
+		t.Errorf("expected 13 chunks, got %d", len(chunks))
+	}
+}
@@ -0,0 +1,155 @@
+// Package imageindex makes image collections searchable by captioning images with a vision model,
+// embedding the captions and storing them in a vector database.
+package imageindex
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghmer/aicompanion"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+const (
+	// CaptionPrompt is the default prompt used to caption images.
+	CaptionPrompt = "Describe the image in two to four sentences. Mention the main subjects, any visible text and the setting. Only return the description."
+
+	// DefaultMaxImageSize is the default maximum dimension images are resized to before captioning.
+	DefaultMaxImageSize = 1024
+
+	// metadata keys stored alongside the caption embeddings
+	MetadataImagePath = "image_path"
+	MetadataCaption   = "caption"
+	MetadataMimeType  = "mime_type"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// Indexer captions images and stores the caption embeddings in a vector database.
+type Indexer struct {
+	Companion    aicompanion.AICompanion
+	VectorDb     vectordb.VectorDb
+	ClassName    string
+	Prompt       string
+	MaxImageSize int
+	// Progress is called after each image has been indexed, if set.
+	Progress func(done, total int, path string)
+}
+
+// NewIndexer creates a new Indexer using the default caption prompt and image size.
+func NewIndexer(companion aicompanion.AICompanion, vectorDb vectordb.VectorDb, classname string) *Indexer {
+	return &Indexer{
+		Companion:    companion,
+		VectorDb:     vectorDb,
+		ClassName:    classname,
+		Prompt:       CaptionPrompt,
+		MaxImageSize: DefaultMaxImageSize,
+	}
+}
+
+// IndexFiles captions and indexes all image files at the given paths.
+func (indexer *Indexer) IndexFiles(ctx context.Context, paths []string) ([]models.Document, error) {
+	var documents []models.Document
+	for i, path := range paths {
+		content, err := sideKick.ReadFile(path)
+		if err != nil {
+			return documents, fmt.Errorf("failed to read image %s: %w", path, err)
+		}
+
+		document, err := indexer.IndexImage(ctx, path, content)
+		if err != nil {
+			return documents, err
+		}
+		documents = append(documents, document)
+
+		if indexer.Progress != nil {
+			indexer.Progress(i+1, len(paths), path)
+		}
+	}
+
+	return documents, nil
+}
+
+// IndexImage captions a single image, embeds the caption and stores it with a reference to the image.
+// The reference is stored in the document metadata and is usually the path or URL of the image.
+func (indexer *Indexer) IndexImage(ctx context.Context, reference string, content []byte) (models.Document, error) {
+	if indexer.Companion == nil || indexer.VectorDb == nil {
+		return models.Document{}, errors.New("indexer requires a companion and a vector database")
+	}
+
+	caption, err := indexer.Caption(ctx, content)
+	if err != nil {
+		return models.Document{}, fmt.Errorf("failed to caption image %s: %w", reference, err)
+	}
+
+	config := indexer.Companion.GetConfig()
+	embeddingRequest := sideKick.CreateEmbeddingRequest(config.AiModels.EmbeddingModel, []string{caption})
+	embeddingResponse, err := indexer.Companion.SendEmbeddingRequest(ctx, embeddingRequest)
+	if err != nil {
+		return models.Document{}, fmt.Errorf("failed to embed caption of %s: %w", reference, err)
+	}
+	if len(embeddingResponse.Embeddings) == 0 {
+		return models.Document{}, fmt.Errorf("no embeddings returned for caption of %s", reference)
+	}
+
+	hash := sha256.Sum256(content)
+	document := models.Document{
+		ID:         hex.EncodeToString(hash[:]),
+		ClassName:  indexer.ClassName,
+		Embeddings: embeddingResponse.Embeddings[0],
+		Content:    caption,
+		Metadata: map[string]any{
+			MetadataImagePath: reference,
+			MetadataCaption:   caption,
+			MetadataMimeType:  models.DetectMimeType(content),
+			"filename":        filepath.Base(reference),
+		},
+	}
+
+	if err := indexer.VectorDb.AddDocument(ctx, indexer.ClassName, document.ID, document); err != nil {
+		return models.Document{}, fmt.Errorf("failed to store caption of %s: %w", reference, err)
+	}
+
+	return document, nil
+}
+
+// Caption runs an image through the vision generate path and returns the caption.
+func (indexer *Indexer) Caption(ctx context.Context, content []byte) (string, error) {
+	if indexer.MaxImageSize > 0 {
+		resized, err := sideKick.ResizeImage(content, indexer.MaxImageSize)
+		if err != nil {
+			return "", err
+		}
+		content = resized
+	}
+
+	var image models.Base64Image
+	image.SetData(content)
+
+	prompt := indexer.Prompt
+	if prompt == "" {
+		prompt = CaptionPrompt
+	}
+
+	message := sideKick.CreateUserMessage(prompt, &[]models.Base64Image{image})
+	message.AlternatePrompt = prompt
+
+	response, err := indexer.Companion.SendGenerateRequest(ctx, models.MessageRequest{Message: message}, false, nil)
+	if err != nil {
+		return "", err
+	}
+
+	caption := strings.TrimSpace(response.Content)
+	if caption == "" {
+		return "", errors.New("model returned an empty caption")
+	}
+
+	return caption, nil
+}
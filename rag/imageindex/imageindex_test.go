@@ -0,0 +1,151 @@
+package imageindex_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/rag/imageindex"
+)
+
+// createPNG generates a single-colored PNG image with the given dimensions.
+func createPNG(t *testing.T, width, height int, fill color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, fill)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newVectorDb creates an in-memory vector database with a schema for images.
+func newVectorDb(t *testing.T) *memvdb.MemoryVectorDb {
+	t.Helper()
+	db, err := memvdb.NewMemoryVectorDb("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateSchema(context.Background(), models.Schema{ClassName: "images"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestIndexImage(t *testing.T) {
+	ctx := context.Background()
+	companion := aicompaniontest.NewFakeCompanion(" A red square on a plain background. ", "A blue sky above the sea.")
+	db := newVectorDb(t)
+	indexer := imageindex.NewIndexer(companion, db, "images")
+	indexer.MaxImageSize = 16
+
+	red := createPNG(t, 64, 32, color.RGBA{255, 0, 0, 255})
+	document, err := indexer.IndexImage(ctx, "photos/red.png", red)
+	if err != nil {
+		t.Fatalf("failed to index image: %v", err)
+	}
+	if document.Content != "A red square on a plain background." || document.Metadata[imageindex.MetadataImagePath] != "photos/red.png" ||
+		document.Metadata[imageindex.MetadataMimeType] != "image/png" || document.Metadata["filename"] != "red.png" {
+		t.Errorf("unexpected document %+v", document)
+	}
+
+	request, _ := companion.LastRequest()
+	if request.Message.AlternatePrompt != imageindex.CaptionPrompt || request.Message.Images == nil || len(*request.Message.Images) != 1 {
+		t.Fatalf("expected the image to be captioned with the caption prompt, got %+v", request.Message)
+	}
+	data, _ := (*request.Message.Images)[0].GetData()
+	if img, err := png.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+		t.Errorf("expected the image to be resized to 16x8 before captioning, got %v (%v)", img.Bounds(), err)
+	}
+
+	if _, err := indexer.IndexImage(ctx, "photos/blue.png", createPNG(t, 8, 8, color.RGBA{0, 0, 255, 255})); err != nil {
+		t.Fatalf("failed to index image: %v", err)
+	}
+
+	// searching embeds the query with the same model as the captions
+	query := aicompaniontest.Embed("a red square", aicompaniontest.DefaultDimensions)
+	results, err := db.QueryDocuments(ctx, "images", query, models.VectorDBQueryOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Metadata[imageindex.MetadataImagePath] != "photos/red.png" {
+		t.Errorf("expected the red image to be found, got %+v", results)
+	}
+
+	// indexing the same image again replaces its document
+	companion.Script.Responses = append(companion.Script.Responses, "A red square.")
+	if again, err := indexer.IndexImage(ctx, "copies/red.png", red); err != nil || again.ID != document.ID {
+		t.Errorf("expected the document id to be derived from the content, got %q (%v)", again.ID, err)
+	}
+}
+
+func TestIndexImageErrors(t *testing.T) {
+	ctx := context.Background()
+	content := createPNG(t, 8, 8, color.White)
+
+	if _, err := imageindex.NewIndexer(nil, newVectorDb(t), "images").IndexImage(ctx, "a.png", content); err == nil {
+		t.Error("expected an error without companion")
+	}
+
+	indexer := imageindex.NewIndexer(aicompaniontest.NewFakeCompanion("   "), newVectorDb(t), "images")
+	if _, err := indexer.IndexImage(ctx, "a.png", content); err == nil {
+		t.Error("expected an error for an empty caption")
+	}
+
+	failing := aicompaniontest.NewFakeCompanion()
+	failing.Err = errors.New("unavailable")
+	indexer = imageindex.NewIndexer(failing, newVectorDb(t), "images")
+	if _, err := indexer.IndexImage(ctx, "a.png", content); !errors.Is(err, failing.Err) {
+		t.Errorf("expected the error of the companion, got %v", err)
+	}
+
+	indexer = imageindex.NewIndexer(aicompaniontest.NewFakeCompanion("caption"), newVectorDb(t), "images")
+	if _, err := indexer.IndexImage(ctx, "a.png", []byte("not an image")); err == nil {
+		t.Error("expected an error for invalid image data")
+	}
+}
+
+func TestIndexFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"one.png", "two.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, createPNG(t, 8, 8, color.Black), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	db := newVectorDb(t)
+	indexer := imageindex.NewIndexer(aicompaniontest.NewFakeCompanion("first", "second"), db, "images")
+	var progress []int
+	indexer.Progress = func(done, total int, path string) { progress = append(progress, done) }
+
+	documents, err := indexer.IndexFiles(context.Background(), paths)
+	if err != nil {
+		t.Fatalf("failed to index files: %v", err)
+	}
+	if len(documents) != 2 || documents[1].Content != "second" || len(progress) != 2 || progress[1] != 2 {
+		t.Errorf("unexpected documents %+v, progress %v", documents, progress)
+	}
+
+	documents, err = indexer.IndexFiles(context.Background(), []string{filepath.Join(dir, "missing.png")})
+	if err == nil || len(documents) != 0 {
+		t.Errorf("expected an error for a missing file, got %v", err)
+	}
+}
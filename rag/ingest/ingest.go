@@ -0,0 +1,325 @@
+// Package ingest turns files and readers into searchable knowledge: content is converted to text,
+// chunked, embedded in batches and stored as documents in a vector database.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/rag"
+	"github.com/ghmer/aicompanion/rag/ocr"
+)
+
+const (
+	// DefaultChunkSize is the maximum number of characters of a chunk of the default chunker.
+	DefaultChunkSize = 1000
+	// DefaultChunkOverlap is the number of characters consecutive chunks of the default chunker share.
+	DefaultChunkOverlap = 100
+	// DefaultBatchSize is the number of chunks embedded with a single request.
+	DefaultBatchSize = 32
+
+	// metadata keys set by FileMetadata
+	MetadataFilename = "filename"
+	MetadataMimeType = "mime_type"
+)
+
+// ErrUnsupportedContent is returned for binary content that can't be converted to text.
+var ErrUnsupportedContent = errors.New("unsupported content")
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// Chunker splits text into chunks that are embedded separately.
+type Chunker interface {
+	Chunk(text string) []string
+}
+
+// ChunkerFunc adapts a function to the Chunker interface.
+type ChunkerFunc func(text string) []string
+
+// Chunk calls the function.
+func (chunker ChunkerFunc) Chunk(text string) []string {
+	return chunker(text)
+}
+
+// Chunk is a piece of text with metadata that only applies to it, such as the section it belongs to.
+type Chunk struct {
+	Text     string
+	Metadata map[string]any
+}
+
+// StructuredChunker is implemented by chunkers that attach metadata to their chunks. The pipeline
+// prefers ChunkStructured over Chunk and stores the metadata with each chunk.
+type StructuredChunker interface {
+	ChunkStructured(text string) []Chunk
+}
+
+// ContextChunker is implemented by chunkers that can fail, such as chunkers that embed the text. The
+// pipeline prefers ChunkContext over Chunk and aborts the ingestion of a source on errors.
+type ContextChunker interface {
+	ChunkContext(ctx context.Context, text string) ([]string, error)
+}
+
+// chunkText splits text with a chunker, using its metadata if it provides any.
+func chunkText(ctx context.Context, chunker Chunker, text string) ([]Chunk, error) {
+	if structured, ok := chunker.(StructuredChunker); ok {
+		return structured.ChunkStructured(text), nil
+	}
+
+	var texts []string
+	if contextChunker, ok := chunker.(ContextChunker); ok {
+		var err error
+		if texts, err = contextChunker.ChunkContext(ctx, text); err != nil {
+			return nil, err
+		}
+	} else {
+		texts = chunker.Chunk(text)
+	}
+
+	chunks := make([]Chunk, len(texts))
+	for i, chunk := range texts {
+		chunks[i] = Chunk{Text: chunk}
+	}
+	return chunks, nil
+}
+
+// DefaultChunker splits text into chunks of up to DefaultChunkSize characters, preferring paragraph,
+// line and sentence boundaries.
+var DefaultChunker Chunker = rag.Chunker{Size: DefaultChunkSize, Overlap: DefaultChunkOverlap}
+
+// Source is a piece of content to ingest.
+type Source struct {
+	ID       string         // Stable identifier, chunk IDs are derived from it. Defaults to the path.
+	Path     string         // File path or URL the content was read from, if any
+	MimeType string         // MIME type of the content, detected if empty
+	Content  []byte         // Raw content
+	Metadata map[string]any // Metadata stored with every chunk
+}
+
+// MetadataExtractor derives metadata from a source and its text. The returned values are stored with
+// every chunk of the source.
+type MetadataExtractor func(source Source, text string) map[string]any
+
+// FileMetadata records the file name and MIME type of a source.
+func FileMetadata(source Source, text string) map[string]any {
+	metadata := map[string]any{MetadataMimeType: source.MimeType}
+	if source.Path != "" {
+		metadata[MetadataFilename] = filepath.Base(source.Path)
+	}
+	return metadata
+}
+
+// Progress reports the state of an ingestion.
+type Progress struct {
+	Source  string // ID of the source being ingested
+	Chunks  int    // Number of chunks of the source
+	Stored  int    // Chunks of the source stored so far
+	Sources int    // Sources completed, including the current one once all its chunks are stored
+	Total   int    // Number of sources of the ingestion
+}
+
+// Pipeline ingests sources into a schema of a vector database.
+type Pipeline struct {
+	Companion  aicompanion.AICompanion
+	VectorDb   vectordb.VectorDb
+	ClassName  string
+	Chunker    Chunker
+	BatchSize  int                 // Chunks per embedding request, defaults to DefaultBatchSize
+	Extractors []MetadataExtractor // Applied in order, later extractors override earlier ones
+	// OCR converts images and PDFs to text. Without an engine, such sources are rejected.
+	OCR ocr.Engine
+	// Progress is called after each stored batch, if set.
+	Progress func(Progress)
+}
+
+// NewPipeline creates a pipeline with the default chunker and the FileMetadata extractor.
+func NewPipeline(companion aicompanion.AICompanion, vectorDb vectordb.VectorDb, classname string) *Pipeline {
+	return &Pipeline{
+		Companion:  companion,
+		VectorDb:   vectorDb,
+		ClassName:  classname,
+		Chunker:    DefaultChunker,
+		BatchSize:  DefaultBatchSize,
+		Extractors: []MetadataExtractor{FileMetadata},
+	}
+}
+
+// IngestFiles reads and ingests the files at the given paths and returns the number of stored chunks.
+func (pipeline *Pipeline) IngestFiles(ctx context.Context, paths []string) (int, error) {
+	sources := make([]Source, 0, len(paths))
+	for _, path := range paths {
+		content, err := sideKick.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		sources = append(sources, Source{Path: path, Content: content})
+	}
+	return pipeline.IngestSources(ctx, sources)
+}
+
+// IngestReader reads and ingests content from r under the given source ID.
+func (pipeline *Pipeline) IngestReader(ctx context.Context, id string, r io.Reader, metadata map[string]any) (int, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", id, err)
+	}
+	return pipeline.IngestSources(ctx, []Source{{ID: id, Content: content, Metadata: metadata}})
+}
+
+// IngestSources ingests sources one after another and returns the number of stored chunks. It stops
+// at the first failing source.
+func (pipeline *Pipeline) IngestSources(ctx context.Context, sources []Source) (int, error) {
+	var stored int
+	for i, source := range sources {
+		count, err := pipeline.ingest(ctx, source, i, len(sources))
+		stored += count
+		if err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
+
+// ingest converts, chunks, embeds and stores a single source. Chunks of an earlier ingestion of the
+// source that no longer exist are deleted.
+func (pipeline *Pipeline) ingest(ctx context.Context, source Source, index, total int) (int, error) {
+	if pipeline.Companion == nil || pipeline.VectorDb == nil {
+		return 0, errors.New("pipeline requires a companion and a vector database")
+	}
+	if source.ID == "" {
+		source.ID = source.Path
+	}
+	if source.ID == "" {
+		return 0, errors.New("source requires an id or a path")
+	}
+	if source.MimeType == "" {
+		source.MimeType = models.DetectMimeType(source.Content)
+	}
+
+	text, err := pipeline.text(ctx, source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert %s: %w", source.ID, err)
+	}
+
+	metadata := make(map[string]any)
+	for _, extractor := range pipeline.Extractors {
+		for key, value := range extractor(source, text) {
+			metadata[key] = value
+		}
+	}
+	for key, value := range source.Metadata {
+		metadata[key] = value
+	}
+
+	chunker := pipeline.Chunker
+	if chunker == nil {
+		chunker = DefaultChunker
+	}
+	chunks, err := chunkText(ctx, chunker, text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to chunk %s: %w", source.ID, err)
+	}
+
+	batchSize := pipeline.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	model := pipeline.Companion.GetConfig().AiModels.EmbeddingModel
+	progress := Progress{Source: source.ID, Chunks: len(chunks), Sources: index, Total: total}
+	stored := make(map[string]bool, len(chunks))
+	for start := 0; start < len(chunks); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return progress.Stored, err
+		}
+
+		batch := chunks[start:min(start+batchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			texts[i] = chunk.Text
+		}
+		response, err := pipeline.Companion.SendEmbeddingRequest(ctx, sideKick.CreateEmbeddingRequest(model, texts))
+		if err != nil {
+			return progress.Stored, fmt.Errorf("failed to embed %s: %w", source.ID, err)
+		}
+
+		if len(response.Embeddings) != len(batch) {
+			return progress.Stored, fmt.Errorf("got %d embeddings for %d chunks of %s", len(response.Embeddings), len(batch), source.ID)
+		}
+
+		documents := make([]models.Document, len(batch))
+		for i, chunk := range batch {
+			documents[i] = vdbutil.ChunkDocument(source.ID, start+i, chunk.Text, response.Embeddings[i], metadata)
+			for key, value := range chunk.Metadata {
+				documents[i].Metadata[key] = value
+			}
+			stored[documents[i].ID] = true
+		}
+
+		if err := pipeline.VectorDb.AddDocuments(ctx, pipeline.ClassName, documents); err != nil {
+			return progress.Stored, fmt.Errorf("failed to store %s: %w", source.ID, err)
+		}
+
+		progress.Stored += len(documents)
+		if progress.Stored == len(chunks) {
+			progress.Sources++
+		}
+		if pipeline.Progress != nil {
+			pipeline.Progress(progress)
+		}
+	}
+
+	if err := pipeline.deleteStale(ctx, source.ID, stored); err != nil {
+		return progress.Stored, err
+	}
+	return progress.Stored, nil
+}
+
+// deleteStale deletes chunks of a source that were not stored by the current ingestion.
+func (pipeline *Pipeline) deleteStale(ctx context.Context, sourceID string, stored map[string]bool) error {
+	documents, err := pipeline.VectorDb.ListDocuments(ctx, pipeline.ClassName, models.DocumentListOptions{
+		Filter: map[string]any{vdbutil.MetadataSource: sourceID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list chunks of %s: %w", sourceID, err)
+	}
+
+	var stale []string
+	for _, document := range documents {
+		if !stored[document.ID] {
+			stale = append(stale, document.ID)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	if err := pipeline.VectorDb.DeleteDocuments(ctx, pipeline.ClassName, stale); err != nil {
+		return fmt.Errorf("failed to delete stale chunks of %s: %w", sourceID, err)
+	}
+	return nil
+}
+
+// text converts the content of a source to text. Images and PDFs are recognized with the OCR engine,
+// other content must be valid UTF-8.
+func (pipeline *Pipeline) text(ctx context.Context, source Source) (string, error) {
+	if source.MimeType == "application/pdf" || strings.HasPrefix(source.MimeType, "image/") {
+		if pipeline.OCR == nil {
+			return "", fmt.Errorf("%w: %s requires an ocr engine", ErrUnsupportedContent, source.MimeType)
+		}
+		return pipeline.OCR.Extract(ctx, source.Content, source.MimeType)
+	}
+
+	if !utf8.Valid(source.Content) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedContent, source.MimeType)
+	}
+	return string(source.Content), nil
+}
@@ -0,0 +1,78 @@
+package ingest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/rag/ingest"
+)
+
+// fakeOCR returns a fixed text for every image.
+type fakeOCR struct{}
+
+func (fakeOCR) Extract(ctx context.Context, content []byte, mimeType string) (string, error) {
+	return "recognized text", nil
+}
+
+func TestIngestReader(t *testing.T) {
+	ctx := context.Background()
+	db := aicompaniontest.NewFakeVectorDb()
+	pipeline := ingest.NewPipeline(aicompaniontest.NewFakeCompanion(), db, "docs")
+	pipeline.Chunker = ingest.ChunkerFunc(strings.Fields)
+	pipeline.BatchSize = 2
+
+	var batches int
+	pipeline.Progress = func(progress ingest.Progress) {
+		batches++
+		if progress.Source != "notes" || progress.Chunks != 5 {
+			t.Errorf("unexpected progress %+v", progress)
+		}
+	}
+
+	stored, err := pipeline.IngestReader(ctx, "notes", strings.NewReader("one two three four five"), map[string]any{"topic": "numbers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 5 || batches != 3 {
+		t.Errorf("expected 5 chunks in 3 batches, got %d in %d", stored, batches)
+	}
+
+	documents := db.Documents("docs")
+	if len(documents) != 5 || documents[0].ID != "notes-0" || documents[0].Content != "one" || documents[0].Metadata["topic"] != "numbers" {
+		t.Fatalf("unexpected documents %+v", documents)
+	}
+
+	// re-ingesting a shorter text removes the chunks that no longer exist
+	pipeline.Progress = nil
+	if _, err := pipeline.IngestReader(ctx, "notes", strings.NewReader("six seven"), nil); err != nil {
+		t.Fatal(err)
+	}
+	documents = db.Documents("docs")
+	if len(documents) != 2 || documents[1].Content != "seven" {
+		t.Errorf("unexpected documents after re-ingestion %+v", documents)
+	}
+}
+
+func TestIngestImage(t *testing.T) {
+	ctx := context.Background()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	db := aicompaniontest.NewFakeVectorDb()
+	pipeline := ingest.NewPipeline(aicompaniontest.NewFakeCompanion(), db, "docs")
+
+	_, err := pipeline.IngestSources(ctx, []ingest.Source{{Path: "scan.png", Content: png}})
+	if !errors.Is(err, ingest.ErrUnsupportedContent) {
+		t.Fatalf("expected ErrUnsupportedContent, got %v", err)
+	}
+
+	pipeline.OCR = fakeOCR{}
+	if _, err := pipeline.IngestSources(ctx, []ingest.Source{{Path: "scan.png", Content: png}}); err != nil {
+		t.Fatal(err)
+	}
+	documents := db.Documents("docs")
+	if len(documents) != 1 || documents[0].Content != "recognized text" || documents[0].Metadata[ingest.MetadataFilename] != "scan.png" {
+		t.Errorf("unexpected documents %+v", documents)
+	}
+}
@@ -0,0 +1,225 @@
+package ingest
+
+import (
+	"strings"
+
+	"github.com/ghmer/aicompanion/rag"
+)
+
+// metadata keys set by MarkdownChunker
+const (
+	MetadataSection = "section" // Path of the headings of a chunk, e.g. "Setup > Linux"
+	MetadataHeading = "heading" // Innermost heading of a chunk
+)
+
+// MarkdownChunker splits Markdown into its sections, so chunks follow the structure of the document.
+// Every ATX heading ("#" to "######") starts a new section; headings inside code fences are ignored.
+// Sections longer than MaxSize are split between paragraphs, keeping code blocks intact where possible.
+// The heading path of a section is stored in the metadata of its chunks.
+type MarkdownChunker struct {
+	MaxSize int // Maximum number of characters of a chunk, defaults to DefaultChunkSize
+	Overlap int // Characters shared by the parts of an oversized paragraph, defaults to DefaultChunkOverlap
+}
+
+// markdownSection is the text below a heading.
+type markdownSection struct {
+	path   []string
+	blocks []string
+}
+
+// Chunk implements Chunker.
+func (chunker MarkdownChunker) Chunk(text string) []string {
+	chunks := chunker.ChunkStructured(text)
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+// ChunkStructured implements StructuredChunker.
+func (chunker MarkdownChunker) ChunkStructured(text string) []Chunk {
+	maxSize := chunker.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultChunkSize
+	}
+	overlap := chunker.Overlap
+	if overlap <= 0 {
+		overlap = DefaultChunkOverlap
+	}
+
+	var chunks []Chunk
+	for _, section := range parseMarkdown(text) {
+		var metadata map[string]any
+		if len(section.path) > 0 {
+			metadata = map[string]any{
+				MetadataSection: strings.Join(section.path, " > "),
+				MetadataHeading: section.path[len(section.path)-1],
+			}
+		}
+
+		for _, part := range packBlocks(section.blocks, maxSize, overlap) {
+			chunks = append(chunks, Chunk{Text: part, Metadata: metadata})
+		}
+	}
+	return chunks
+}
+
+// parseMarkdown splits Markdown into sections of blocks. A block is a paragraph, a heading or a complete
+// code fence.
+func parseMarkdown(text string) []markdownSection {
+	var sections []markdownSection
+	var headings []string
+	current := markdownSection{}
+
+	var block []string
+	var fence string
+	flush := func() {
+		if content := strings.TrimSpace(strings.Join(block, "\n")); content != "" {
+			current.blocks = append(current.blocks, content)
+		}
+		block = nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			block = append(block, line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				flush()
+			}
+			continue
+		}
+
+		if marker := fenceMarker(trimmed); marker != "" {
+			flush()
+			fence = marker
+			block = append(block, line)
+			continue
+		}
+
+		if level, title := parseHeading(trimmed); level > 0 {
+			flush()
+			if len(current.blocks) > 0 {
+				sections = append(sections, current)
+			}
+
+			if level <= len(headings) {
+				headings = headings[:level-1]
+			}
+			for len(headings) < level-1 {
+				headings = append(headings, "")
+			}
+			headings = append(headings, title)
+
+			current = markdownSection{path: compactPath(headings)}
+			block = []string{line}
+			flush()
+			continue
+		}
+
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		block = append(block, line)
+	}
+
+	flush()
+	if len(current.blocks) > 0 {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// fenceMarker returns the opening marker of a code fence line, or an empty string.
+func fenceMarker(line string) string {
+	for _, character := range []string{"`", "~"} {
+		if strings.HasPrefix(line, strings.Repeat(character, 3)) {
+			return strings.Repeat(character, len(line)-len(strings.TrimLeft(line, character)))
+		}
+	}
+	return ""
+}
+
+// parseHeading returns the level and title of an ATX heading line, or 0 for other lines.
+func parseHeading(line string) (int, string) {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 || (len(line) > level && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	return level, title
+}
+
+// compactPath copies a heading path without the placeholders of skipped levels.
+func compactPath(headings []string) []string {
+	path := make([]string, 0, len(headings))
+	for _, heading := range headings {
+		if heading != "" {
+			path = append(path, heading)
+		}
+	}
+	return path
+}
+
+// packBlocks joins consecutive blocks into chunks of at most maxSize characters. Blocks larger than
+// maxSize are split on their own: code line by line, prose at sentence and word boundaries.
+func packBlocks(blocks []string, maxSize, overlap int) []string {
+	var chunks []string
+	var current []string
+	var size int
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n\n"))
+		}
+		current, size = nil, 0
+	}
+
+	for _, block := range blocks {
+		length := len([]rune(block))
+		if length > maxSize {
+			flush()
+			if fenceMarker(strings.TrimSpace(block)) != "" {
+				chunks = append(chunks, splitLines(block, maxSize)...)
+			} else {
+				chunks = append(chunks, rag.Chunker{Size: maxSize, Overlap: overlap}.Chunk(block)...)
+			}
+			continue
+		}
+
+		if size > 0 && size+2+length > maxSize {
+			flush()
+		}
+		current = append(current, block)
+		if size > 0 {
+			size += 2
+		}
+		size += length
+	}
+	flush()
+	return chunks
+}
+
+// splitLines splits text between lines into parts of at most maxSize characters. Lines longer than
+// maxSize become parts of their own.
+func splitLines(text string, maxSize int) []string {
+	var parts []string
+	var current strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if current.Len() > 0 && len([]rune(current.String()))+1+len([]rune(line)) > maxSize {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
@@ -0,0 +1,65 @@
+package ingest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/rag/ingest"
+)
+
+func TestMarkdownChunker(t *testing.T) {
+	text := strings.Join([]string{
+		"Introduction text.",
+		"",
+		"# Setup",
+		"",
+		"Install the tool.",
+		"",
+		"## Linux",
+		"",
+		"```sh",
+		"# not a heading",
+		"",
+		"make install",
+		"```",
+		"",
+		"# Usage",
+		"",
+		"Run it.",
+	}, "\n")
+
+	chunks := ingest.MarkdownChunker{}.ChunkStructured(text)
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d: %+v", len(chunks), chunks)
+	}
+
+	if chunks[0].Text != "Introduction text." || chunks[0].Metadata != nil {
+		t.Errorf("unexpected preamble %+v", chunks[0])
+	}
+	if chunks[2].Metadata[ingest.MetadataSection] != "Setup > Linux" || chunks[2].Metadata[ingest.MetadataHeading] != "Linux" {
+		t.Errorf("unexpected metadata %+v", chunks[2].Metadata)
+	}
+	if !strings.Contains(chunks[2].Text, "# not a heading\n\nmake install") {
+		t.Errorf("code fence was split: %q", chunks[2].Text)
+	}
+	if chunks[3].Metadata[ingest.MetadataSection] != "Usage" {
+		t.Errorf("unexpected metadata %+v", chunks[3].Metadata)
+	}
+}
+
+func TestMarkdownChunkerMaxSize(t *testing.T) {
+	text := "# Title\n\n" + strings.Repeat("word ", 30) + "\n\n```\n" + strings.Repeat("line\n", 10) + "```"
+
+	chunks := ingest.MarkdownChunker{MaxSize: 40, Overlap: 5}.ChunkStructured(text)
+	if len(chunks) < 4 {
+		t.Fatalf("expected the section to be split, got %+v", chunks)
+	}
+	for _, chunk := range chunks {
+		if len([]rune(chunk.Text)) > 40 {
+			t.Errorf("chunk exceeds the maximum size: %q", chunk.Text)
+		}
+		if chunk.Metadata[ingest.MetadataHeading] != "Title" {
+			t.Errorf("unexpected metadata %+v", chunk.Metadata)
+		}
+	}
+}
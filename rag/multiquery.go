@@ -0,0 +1,179 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+const (
+	// DefaultQueryVariations is the number of query variations generated by a MultiQueryRetriever.
+	DefaultQueryVariations = 3
+	// DefaultRetrievalLimit is the number of documents retrieved per query and returned in total.
+	DefaultRetrievalLimit = 5
+)
+
+// MultiQueryPrompt asks for query variations. It is formatted with the number of variations and the query.
+const MultiQueryPrompt = "Generate %d different versions of the following search query to retrieve relevant documents " +
+	"from a vector database. Vary the wording and perspective. Return one query per line without numbering or " +
+	"any other text.\n\nQuery: %s"
+
+// listMarker matches bullets and numbers at the start of generated lines.
+var listMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s+`)
+
+// MultiQueryRetriever retrieves documents for several phrasings of a query. The model generates variations
+// of the query, all phrasings are searched concurrently and the rankings are merged with reciprocal rank
+// fusion, so documents found by several phrasings rank first. The score of a result is its fused score.
+type MultiQueryRetriever struct {
+	Companion    aicompanion.AICompanion
+	VectorDb     vectordb.VectorDb
+	ClassName    string
+	Variations   int                         // Generated variations in addition to the query, defaults to DefaultQueryVariations
+	Prompt       string                      // Formatted like MultiQueryPrompt, defaults to it
+	QueryOptions models.VectorDBQueryOptions // Applied to every search; the limit also caps the merged results
+	RRFK         int                         // Rank constant of the fusion, defaults to 60
+}
+
+// NewMultiQueryRetriever creates a retriever searching the given class with the default settings.
+func NewMultiQueryRetriever(companion aicompanion.AICompanion, vectorDb vectordb.VectorDb, classname string) *MultiQueryRetriever {
+	return &MultiQueryRetriever{
+		Companion:    companion,
+		VectorDb:     vectorDb,
+		ClassName:    classname,
+		Variations:   DefaultQueryVariations,
+		Prompt:       MultiQueryPrompt,
+		QueryOptions: models.VectorDBQueryOptions{Limit: DefaultRetrievalLimit},
+	}
+}
+
+// GenerateQueries asks the model for variations of a query. The result starts with the query itself and
+// holds no duplicates.
+func (retriever *MultiQueryRetriever) GenerateQueries(ctx context.Context, query string) ([]string, error) {
+	variations := retriever.Variations
+	if variations <= 0 {
+		variations = DefaultQueryVariations
+	}
+	prompt := retriever.Prompt
+	if prompt == "" {
+		prompt = MultiQueryPrompt
+	}
+
+	message := sideKick.CreateUserMessage(fmt.Sprintf(prompt, variations, query), nil)
+	response, err := retriever.Companion.SendGenerateRequest(ctx, models.MessageRequest{Message: message}, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query variations: %w", err)
+	}
+
+	queries := []string{query}
+	seen := map[string]bool{strings.ToLower(query): true}
+	for _, line := range strings.Split(response.Content, "\n") {
+		line = strings.TrimSpace(listMarker.ReplaceAllString(line, ""))
+		if line == "" || seen[strings.ToLower(line)] {
+			continue
+		}
+		seen[strings.ToLower(line)] = true
+		queries = append(queries, line)
+		if len(queries) > variations {
+			break
+		}
+	}
+	return queries, nil
+}
+
+// Retrieve generates variations of the query, searches them concurrently and returns the fused results.
+func (retriever *MultiQueryRetriever) Retrieve(ctx context.Context, query string) ([]models.Document, error) {
+	queries, err := retriever.GenerateQueries(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return retriever.RetrieveQueries(ctx, queries)
+}
+
+// RetrieveQueries searches the given queries concurrently and merges the results with reciprocal rank
+// fusion. Documents found by several queries are returned once.
+func (retriever *MultiQueryRetriever) RetrieveQueries(ctx context.Context, queries []string) ([]models.Document, error) {
+	if retriever.Companion == nil || retriever.VectorDb == nil {
+		return nil, errors.New("retriever requires a companion and a vector database")
+	}
+	if len(queries) == 0 {
+		return nil, nil
+	}
+
+	model := retriever.Companion.GetConfig().AiModels.EmbeddingModel
+	response, err := retriever.Companion.SendEmbeddingRequest(ctx, sideKick.CreateEmbeddingRequest(model, queries))
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed queries: %w", err)
+	}
+	if len(response.Embeddings) != len(queries) {
+		return nil, fmt.Errorf("got %d embeddings for %d queries", len(response.Embeddings), len(queries))
+	}
+
+	queryOptions := retriever.QueryOptions
+	if queryOptions.Limit <= 0 {
+		queryOptions.Limit = DefaultRetrievalLimit
+	}
+
+	results := make([][]models.Document, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			options := queryOptions
+			if options.Hybrid != nil {
+				hybrid := *options.Hybrid
+				hybrid.Query = queries[i]
+				options.Hybrid = &hybrid
+			}
+			results[i], errs[i] = retriever.VectorDb.QueryDocuments(ctx, retriever.ClassName, response.Embeddings[i], options)
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", retriever.ClassName, err)
+	}
+
+	return fuseDocuments(retriever.RRFK, queryOptions.Limit, results), nil
+}
+
+// fuseDocuments merges rankings of documents by ID with reciprocal rank fusion and returns the best limit
+// documents, scored by their fused score.
+func fuseDocuments(k, limit int, results [][]models.Document) []models.Document {
+	var documents []models.Document
+	index := make(map[string]int)
+	rankings := make([][]int, len(results))
+	for i, ranking := range results {
+		for _, document := range ranking {
+			position, exists := index[document.ID]
+			if !exists {
+				position = len(documents)
+				index[document.ID] = position
+				documents = append(documents, document)
+			}
+			rankings[i] = append(rankings[i], position)
+		}
+	}
+
+	scores := vdbutil.FuseRRF(k, rankings...)
+	for position := range documents {
+		documents[position].Score = scores[position]
+	}
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].Score > documents[j].Score
+	})
+
+	if limit > 0 && len(documents) > limit {
+		documents = documents[:limit]
+	}
+	return documents
+}
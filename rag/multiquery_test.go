@@ -0,0 +1,51 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/rag"
+)
+
+func TestMultiQueryRetriever(t *testing.T) {
+	ctx := context.Background()
+	db := aicompaniontest.NewFakeVectorDb()
+	texts := map[string]string{
+		"cat":    "the cat sleeps on the mat",
+		"feline": "a feline rests in the sun",
+		"stock":  "stock markets fell today",
+	}
+	for id, text := range texts {
+		document := models.Document{Embeddings: aicompaniontest.Embed(text, aicompaniontest.DefaultDimensions), Content: text}
+		if err := db.AddDocument(ctx, "docs", id, document); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	companion := aicompaniontest.NewFakeCompanion("1. where does the feline rest\n- Where does the cat sleep\n\n2) cat mat")
+	retriever := rag.NewMultiQueryRetriever(companion, db, "docs")
+	retriever.QueryOptions = models.VectorDBQueryOptions{Limit: 2, SimilarityThreshold: 0.1}
+
+	queries, err := retriever.GenerateQueries(context.Background(), "where does the cat sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"where does the cat sleep", "where does the feline rest", "cat mat"}
+	if fmt.Sprintf("%q", queries) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, queries)
+	}
+
+	documents, err := retriever.RetrieveQueries(ctx, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 || documents[0].ID != "cat" || documents[1].ID != "feline" {
+		t.Fatalf("unexpected documents %+v", documents)
+	}
+	if documents[0].Score <= documents[1].Score {
+		t.Errorf("expected fused scores in descending order, got %v and %v", documents[0].Score, documents[1].Score)
+	}
+}
@@ -0,0 +1,157 @@
+// Package ocr extracts text from scanned documents and images so they can contribute to a knowledge base.
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// Engine extracts text from image or PDF content.
+type Engine interface {
+	// Extract returns the text recognized in content. The mimeType is used to decide how the content is processed.
+	Extract(ctx context.Context, content []byte, mimeType string) (string, error)
+}
+
+// ErrUnsupportedMimeType is returned when an engine cannot process the given content type.
+var ErrUnsupportedMimeType = errors.New("unsupported mime type for ocr")
+
+// CommandRunner runs a prepared command and waits for it to complete.
+type CommandRunner func(cmd *exec.Cmd) error
+
+// TesseractEngine is an Engine backed by the tesseract command line tool.
+// Scanned PDFs are rasterized with pdftoppm (poppler-utils) before recognition.
+type TesseractEngine struct {
+	Binary         string        // Path of the tesseract executable, defaults to "tesseract"
+	PdfToPpmBinary string        // Path of the pdftoppm executable, defaults to "pdftoppm"
+	Languages      []string      // Tesseract language codes, e.g. "eng", "deu"
+	DPI            int           // Resolution used to rasterize PDF pages, defaults to 300
+	Runner         CommandRunner // Runs the external tools, defaults to cmd.Run
+}
+
+// NewTesseractEngine creates a TesseractEngine with the given languages.
+func NewTesseractEngine(languages ...string) *TesseractEngine {
+	return &TesseractEngine{
+		Binary:         "tesseract",
+		PdfToPpmBinary: "pdftoppm",
+		Languages:      languages,
+		DPI:            300,
+	}
+}
+
+// Extract recognizes the text in an image or a PDF.
+func (engine *TesseractEngine) Extract(ctx context.Context, content []byte, mimeType string) (string, error) {
+	if mimeType == "" {
+		mimeType = models.DetectMimeType(content)
+	}
+
+	switch {
+	case mimeType == "application/pdf":
+		return engine.extractPdf(ctx, content)
+	case strings.HasPrefix(mimeType, "image/"):
+		return engine.extractImage(ctx, content)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedMimeType, mimeType)
+	}
+}
+
+// run executes cmd with the Runner of the engine, if set.
+func (engine *TesseractEngine) run(cmd *exec.Cmd) error {
+	if engine.Runner != nil {
+		return engine.Runner(cmd)
+	}
+	return cmd.Run()
+}
+
+// extractImage runs tesseract on a single image.
+func (engine *TesseractEngine) extractImage(ctx context.Context, content []byte) (string, error) {
+	binary := engine.Binary
+	if binary == "" {
+		binary = "tesseract"
+	}
+
+	args := []string{"stdin", "stdout"}
+	if len(engine.Languages) > 0 {
+		args = append(args, "-l", strings.Join(engine.Languages, "+"))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := engine.run(cmd); err != nil {
+		return "", fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// extractPdf rasterizes all pages of a PDF and recognizes them one after another.
+func (engine *TesseractEngine) extractPdf(ctx context.Context, content []byte) (string, error) {
+	binary := engine.PdfToPpmBinary
+	if binary == "" {
+		binary = "pdftoppm"
+	}
+	dpi := engine.DPI
+	if dpi <= 0 {
+		dpi = 300
+	}
+
+	directory, err := os.MkdirTemp("", "aicompanion-ocr-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(directory)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, "-png", "-r", fmt.Sprint(dpi), "-", filepath.Join(directory, "page"))
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stderr = &stderr
+	if err := engine.run(cmd); err != nil {
+		return "", fmt.Errorf("pdftoppm failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	pages, err := filepath.Glob(filepath.Join(directory, "page-*.png"))
+	if err != nil {
+		return "", err
+	}
+	// pdftoppm pads page numbers to equal width, so lexical order is page order
+	sort.Strings(pages)
+
+	var texts []string
+	for _, page := range pages {
+		image, err := os.ReadFile(page)
+		if err != nil {
+			return "", err
+		}
+
+		text, err := engine.extractImage(ctx, image)
+		if err != nil {
+			return "", fmt.Errorf("failed to recognize %s: %w", filepath.Base(page), err)
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// ExtractFile reads a file and recognizes its text with the given engine.
+func ExtractFile(ctx context.Context, engine Engine, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return engine.Extract(ctx, content, models.DetectMimeType(content))
+}
@@ -0,0 +1,143 @@
+package ocr_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/rag/ocr"
+)
+
+// fakeRunner emulates tesseract and pdftoppm and records the command lines it was asked to run.
+// tesseract answers with the text of the image, pdftoppm writes the given pages as images.
+type fakeRunner struct {
+	commands [][]string
+	pages    []string
+	err      error
+}
+
+func (runner *fakeRunner) run(cmd *exec.Cmd) error {
+	runner.commands = append(runner.commands, cmd.Args)
+	if runner.err != nil {
+		return runner.err
+	}
+
+	input, err := io.ReadAll(cmd.Stdin)
+	if err != nil {
+		return err
+	}
+	switch cmd.Args[0] {
+	case "tesseract":
+		// the fake images hold their text after the signature
+		fmt.Fprintf(cmd.Stdout, "  %s\n", strings.TrimPrefix(string(input), "\x89PNG\r\n\x1a\n"))
+	case "pdftoppm":
+		prefix := cmd.Args[len(cmd.Args)-1]
+		for i, page := range runner.pages {
+			if err := os.WriteFile(fmt.Sprintf("%s-%02d.png", prefix, i+1), []byte("\x89PNG\r\n\x1a\n"+page), 0o600); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestTesseractImage(t *testing.T) {
+	runner := &fakeRunner{}
+	engine := ocr.NewTesseractEngine("eng", "deu")
+	engine.Runner = runner.run
+
+	text, err := engine.Extract(context.Background(), []byte("\x89PNG\r\n\x1a\nInvoice 42"), "")
+	if err != nil || text != "Invoice 42" {
+		t.Fatalf("unexpected text %q (%v)", text, err)
+	}
+	if expected := []string{"tesseract", "stdin", "stdout", "-l", "eng+deu"}; len(runner.commands) != 1 || !slices.Equal(runner.commands[0], expected) {
+		t.Errorf("expected command %q, got %q", expected, runner.commands)
+	}
+
+	engine.Languages = nil
+	engine.Binary = "/opt/tesseract/bin/tesseract"
+	runner.commands = nil
+	engine.Extract(context.Background(), []byte("\x89PNG\r\n\x1a\n"), "image/png")
+	if expected := []string{"/opt/tesseract/bin/tesseract", "stdin", "stdout"}; len(runner.commands) != 1 || !slices.Equal(runner.commands[0], expected) {
+		t.Errorf("expected command %q, got %q", expected, runner.commands)
+	}
+}
+
+func TestTesseractPdf(t *testing.T) {
+	runner := &fakeRunner{pages: []string{"First page", "", "Third page"}}
+	engine := ocr.NewTesseractEngine("eng")
+	engine.DPI = 150
+	engine.Runner = runner.run
+
+	text, err := engine.Extract(context.Background(), []byte("%PDF-1.7\n"), "")
+	if err != nil {
+		t.Fatalf("extraction failed: %v", err)
+	}
+	if text != "First page\n\nThird page" {
+		t.Errorf("expected the text of the pages in order without empty pages, got %q", text)
+	}
+
+	if len(runner.commands) != 4 {
+		t.Fatalf("expected pdftoppm and tesseract for every page, got %q", runner.commands)
+	}
+	rasterize := runner.commands[0]
+	if !slices.Equal(rasterize[:5], []string{"pdftoppm", "-png", "-r", "150", "-"}) || filepath.Base(rasterize[5]) != "page" {
+		t.Errorf("unexpected pdftoppm command %q", rasterize)
+	}
+	if _, err := os.Stat(filepath.Dir(rasterize[5])); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary directory to be removed, got %v", err)
+	}
+}
+
+func TestTesseractErrors(t *testing.T) {
+	runner := &fakeRunner{err: errors.New("exit status 1")}
+	engine := ocr.NewTesseractEngine()
+	engine.Runner = runner.run
+
+	if _, err := engine.Extract(context.Background(), []byte("plain text"), "text/plain"); !errors.Is(err, ocr.ErrUnsupportedMimeType) {
+		t.Errorf("expected ErrUnsupportedMimeType, got %v", err)
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("expected no command for unsupported content, got %q", runner.commands)
+	}
+	if _, err := engine.Extract(context.Background(), []byte("\x89PNG\r\n\x1a\n"), ""); err == nil || !strings.Contains(err.Error(), "tesseract failed") {
+		t.Errorf("expected the failure of tesseract, got %v", err)
+	}
+	if _, err := engine.Extract(context.Background(), []byte("%PDF-1.7\n"), ""); err == nil || !strings.Contains(err.Error(), "pdftoppm failed") {
+		t.Errorf("expected the failure of pdftoppm, got %v", err)
+	}
+}
+
+// fakeEngine recognizes content as its own text.
+type fakeEngine struct {
+	mimeType string
+}
+
+func (engine *fakeEngine) Extract(ctx context.Context, content []byte, mimeType string) (string, error) {
+	engine.mimeType = mimeType
+	return string(content), nil
+}
+
+func TestExtractFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &fakeEngine{}
+	text, err := ocr.ExtractFile(context.Background(), engine, path)
+	if err != nil || text != "%PDF-1.7\n" || engine.mimeType != "application/pdf" {
+		t.Errorf("expected the content to be passed with its mime type, got %q %q (%v)", text, engine.mimeType, err)
+	}
+
+	if _, err := ocr.ExtractFile(context.Background(), engine, filepath.Join(t.TempDir(), "missing.pdf")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
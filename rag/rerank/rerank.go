@@ -0,0 +1,53 @@
+// Package rerank reorders retrieved documents with a reranking model, which usually ranks
+// candidates more precisely than the embedding similarity they were retrieved by.
+package rerank
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ghmer/aicompanion/interfaces/reranker"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// DefaultTextKey is the metadata key holding the text of a document.
+const DefaultTextKey = "text"
+
+// Documents reranks documents by their relevance to query and returns at most topN of them, most relevant
+// first. The text is the content of a document, or, for documents without content, the metadata key
+// textKey. The score of each document is replaced by the
+// relevance score of the reranker. A topN of 0 keeps all documents.
+func Documents(ctx context.Context, rr reranker.Reranker, query string, documents []models.Document, textKey string, topN int) ([]models.Document, error) {
+	if len(documents) == 0 {
+		return documents, nil
+	}
+	if textKey == "" {
+		textKey = DefaultTextKey
+	}
+
+	texts := make([]string, len(documents))
+	for i, document := range documents {
+		if document.Content != "" {
+			texts[i] = document.Content
+		} else {
+			texts[i] = fmt.Sprint(document.Metadata[textKey])
+		}
+	}
+
+	results, err := rr.Rerank(ctx, query, texts, topN)
+	if err != nil {
+		return nil, err
+	}
+
+	reranked := make([]models.Document, 0, len(results))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("reranker returned invalid index %d", result.Index)
+		}
+		document := documents[result.Index]
+		document.Score = result.RelevanceScore
+		reranked = append(reranked, document)
+	}
+
+	return reranked, nil
+}
@@ -0,0 +1,183 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/impl/vdbutil"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+)
+
+// DefaultEmbeddingBatchSize is the number of sentences embedded with a single request.
+const DefaultEmbeddingBatchSize = 32
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// SemanticChunker splits text into sentences and groups consecutive sentences while they are about the
+// same topic. A new chunk starts where the embeddings of two neighbouring sentences are less similar
+// than Threshold, or where the chunk would exceed MaxSize characters.
+type SemanticChunker struct {
+	Companion aicompanion.AICompanion
+	// Threshold is the cosine similarity below which a new chunk starts. If it is 0, the threshold
+	// adapts to the text: one standard deviation below the mean similarity of neighbouring sentences.
+	Threshold float64
+	MaxSize   int // Maximum number of characters of a chunk, defaults to DefaultChunkSize
+	BatchSize int // Sentences per embedding request, defaults to DefaultEmbeddingBatchSize
+}
+
+// NewSemanticChunker creates a chunker with an adaptive threshold that embeds with the given companion.
+func NewSemanticChunker(companion aicompanion.AICompanion) *SemanticChunker {
+	return &SemanticChunker{Companion: companion, MaxSize: DefaultChunkSize, BatchSize: DefaultEmbeddingBatchSize}
+}
+
+// Chunk splits text into topical chunks. If the sentences can't be embedded, sentences are grouped by
+// size only; use ChunkContext to handle such errors.
+func (chunker *SemanticChunker) Chunk(text string) []string {
+	chunks, err := chunker.ChunkContext(context.Background(), text)
+	if err != nil {
+		return chunker.group(SplitSentences(text), nil, 0)
+	}
+	return chunks
+}
+
+// ChunkContext splits text into topical chunks and returns errors of the embedding requests.
+func (chunker *SemanticChunker) ChunkContext(ctx context.Context, text string) ([]string, error) {
+	if chunker.Companion == nil {
+		return nil, errors.New("semantic chunker requires a companion")
+	}
+
+	sentences := SplitSentences(text)
+	if len(sentences) < 2 {
+		return sentences, nil
+	}
+
+	embeddings, err := chunker.embed(ctx, sentences)
+	if err != nil {
+		return nil, err
+	}
+
+	similarities := make([]float64, len(sentences)-1)
+	for i := range similarities {
+		similarities[i] = vdbutil.CosineSimilarity(embeddings[i], embeddings[i+1])
+	}
+
+	threshold := chunker.Threshold
+	if threshold == 0 {
+		threshold = adaptiveThreshold(similarities)
+	}
+	return chunker.group(sentences, similarities, threshold), nil
+}
+
+// embed embeds sentences in batches.
+func (chunker *SemanticChunker) embed(ctx context.Context, sentences []string) ([][]float32, error) {
+	batchSize := chunker.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultEmbeddingBatchSize
+	}
+
+	model := chunker.Companion.GetConfig().AiModels.EmbeddingModel
+	embeddings := make([][]float32, 0, len(sentences))
+	for start := 0; start < len(sentences); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		batch := sentences[start:min(start+batchSize, len(sentences))]
+		response, err := chunker.Companion.SendEmbeddingRequest(ctx, sideKick.CreateEmbeddingRequest(model, batch))
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed sentences: %w", err)
+		}
+		if len(response.Embeddings) != len(batch) {
+			return nil, fmt.Errorf("got %d embeddings for %d sentences", len(response.Embeddings), len(batch))
+		}
+		embeddings = append(embeddings, response.Embeddings...)
+	}
+	return embeddings, nil
+}
+
+// group joins consecutive sentences into chunks. similarities[i] is the similarity of sentence i and
+// i+1; without similarities, sentences are only grouped by size.
+func (chunker *SemanticChunker) group(sentences []string, similarities []float64, threshold float64) []string {
+	maxSize := chunker.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultChunkSize
+	}
+
+	var chunks []string
+	var current []string
+	var size int
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, " "))
+		}
+		current, size = nil, 0
+	}
+
+	for i, sentence := range sentences {
+		length := CharacterLength(sentence)
+		if length > maxSize {
+			flush()
+			chunks = append(chunks, Chunker{Size: maxSize, Overlap: -1}.Chunk(sentence)...)
+			continue
+		}
+
+		topicShift := i > 0 && similarities != nil && similarities[i-1] < threshold
+		if len(current) > 0 && (topicShift || size+1+length > maxSize) {
+			flush()
+		}
+		if len(current) > 0 {
+			size++
+		}
+		current = append(current, sentence)
+		size += length
+	}
+	flush()
+	return chunks
+}
+
+// adaptiveThreshold returns one standard deviation below the mean of the similarities.
+func adaptiveThreshold(similarities []float64) float64 {
+	var mean float64
+	for _, similarity := range similarities {
+		mean += similarity
+	}
+	mean /= float64(len(similarities))
+
+	var variance float64
+	for _, similarity := range similarities {
+		variance += (similarity - mean) * (similarity - mean)
+	}
+	variance /= float64(len(similarities))
+	return mean - math.Sqrt(variance)
+}
+
+// SplitSentences splits text at sentence ends (".", "!" or "?" followed by whitespace) and at blank
+// lines. Sentences are trimmed and line breaks within a sentence are replaced by spaces.
+func SplitSentences(text string) []string {
+	var sentences []string
+	add := func(sentence string) {
+		if sentence = strings.Join(strings.Fields(sentence), " "); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case strings.ContainsRune(".!?", runes[i]) && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])):
+			add(string(runes[start : i+1]))
+			start = i + 1
+		case runes[i] == '\n' && i+1 < len(runes) && runes[i+1] == '\n':
+			add(string(runes[start:i]))
+			start = i + 1
+		}
+	}
+	add(string(runes[start:]))
+	return sentences
+}
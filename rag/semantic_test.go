@@ -0,0 +1,48 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/rag"
+)
+
+func TestSplitSentences(t *testing.T) {
+	sentences := rag.SplitSentences("First one. Second\none! Version 1.5 is out?\n\nHeading\n\nLast")
+	expected := []string{"First one.", "Second one!", "Version 1.5 is out?", "Heading", "Last"}
+	if fmt.Sprintf("%q", sentences) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, sentences)
+	}
+}
+
+func TestSemanticChunker(t *testing.T) {
+	text := "The cat sat on the mat. The cat chased the mouse. " +
+		"Stock markets fell today. Stock markets may recover tomorrow."
+
+	companion := aicompaniontest.NewFakeCompanion()
+	chunker := rag.NewSemanticChunker(companion)
+	chunker.Threshold = 0.2
+
+	chunks, err := chunker.ChunkContext(context.Background(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"The cat sat on the mat. The cat chased the mouse.", "Stock markets fell today. Stock markets may recover tomorrow."}
+	if fmt.Sprintf("%q", chunks) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, chunks)
+	}
+
+	// chunks never exceed the maximum size, even within a topic
+	chunker.MaxSize = 40
+	if chunks := chunker.Chunk(text); len(chunks) != 4 {
+		t.Errorf("expected a chunk per sentence, got %q", chunks)
+	}
+
+	companion.Err = errors.New("unavailable")
+	if _, err := chunker.ChunkContext(context.Background(), text); err == nil {
+		t.Error("expected the embedding error")
+	}
+}
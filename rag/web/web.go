@@ -0,0 +1,320 @@
+// Package web loads web pages into a knowledge base. Pages are fetched, reduced to their main text and
+// fed into an ingestion pipeline, optionally following links within the same domain.
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/ghmer/aicompanion/rag/ingest"
+)
+
+const (
+	// DefaultMaxPages limits the number of pages fetched by a single Load.
+	DefaultMaxPages = 100
+	// DefaultMaxPageSize is the maximum number of bytes read from a response.
+	DefaultMaxPageSize = 10 << 20
+
+	// metadata keys stored with every chunk of a page
+	MetadataURL   = "url"
+	MetadataTitle = "title"
+)
+
+// skipped are elements whose content is boilerplate or not text.
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Iframe: true, atom.Svg: true, atom.Button: true,
+}
+
+// blocks are elements that start a new line of text.
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Li: true, atom.Ul: true, atom.Ol: true, atom.Tr: true, atom.Table: true, atom.Br: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Dd: true, atom.Dt: true, atom.Figcaption: true,
+}
+
+// Page is the text content of a web page.
+type Page struct {
+	Title string
+	Text  string
+	Links []string // Absolute http(s) links of the page, without fragments
+}
+
+// Loader fetches web pages and ingests their text.
+type Loader struct {
+	Pipeline    *ingest.Pipeline
+	HttpClient  *http.Client
+	Depth       int    // Levels of same-domain links followed from the given URLs, 0 loads only the URLs
+	MaxPages    int    // Maximum number of pages fetched, defaults to DefaultMaxPages
+	MaxPageSize int64  // Maximum number of bytes read per page, defaults to DefaultMaxPageSize
+	UserAgent   string // User-Agent header of requests, if set
+}
+
+// NewLoader creates a loader that feeds the given pipeline and only loads the given URLs.
+func NewLoader(pipeline *ingest.Pipeline) *Loader {
+	return &Loader{
+		Pipeline:    pipeline,
+		HttpClient:  http.DefaultClient,
+		MaxPages:    DefaultMaxPages,
+		MaxPageSize: DefaultMaxPageSize,
+	}
+}
+
+// Load fetches and ingests the pages at the given URLs and, up to Depth, the pages they link to on the
+// same host. The URL of a page is its source ID, so loading a page again replaces its chunks. It returns
+// the number of stored chunks.
+func (loader *Loader) Load(ctx context.Context, urls ...string) (int, error) {
+	if loader.Pipeline == nil {
+		return 0, errors.New("loader requires an ingestion pipeline")
+	}
+	maxPages := loader.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	type target struct {
+		url   *url.URL
+		depth int
+	}
+
+	var queue []target
+	visited := make(map[string]bool)
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return 0, fmt.Errorf("invalid url %q", rawURL)
+		}
+		parsed.Fragment = ""
+		if !visited[parsed.String()] {
+			visited[parsed.String()] = true
+			queue = append(queue, target{url: parsed})
+		}
+	}
+
+	var stored, fetched int
+	for len(queue) > 0 && fetched < maxPages {
+		current := queue[0]
+		queue = queue[1:]
+		fetched++
+
+		source, page, err := loader.fetch(ctx, current.url)
+		if err != nil {
+			return stored, err
+		}
+
+		count, err := loader.Pipeline.IngestSources(ctx, []ingest.Source{source})
+		stored += count
+		if err != nil {
+			return stored, err
+		}
+
+		if current.depth >= loader.Depth {
+			continue
+		}
+		for _, link := range page.Links {
+			parsed, err := url.Parse(link)
+			if err != nil || parsed.Host != current.url.Host || visited[link] {
+				continue
+			}
+			visited[link] = true
+			queue = append(queue, target{url: parsed, depth: current.depth + 1})
+		}
+	}
+
+	return stored, nil
+}
+
+// fetch downloads a page and converts it to an ingestion source. HTML is reduced to its text; other
+// content is passed on with its MIME type.
+func (loader *Loader) fetch(ctx context.Context, pageURL *url.URL) (ingest.Source, Page, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return ingest.Source{}, Page{}, err
+	}
+	if loader.UserAgent != "" {
+		request.Header.Set("User-Agent", loader.UserAgent)
+	}
+
+	client := loader.HttpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return ingest.Source{}, Page{}, fmt.Errorf("failed to fetch %s: %w", pageURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return ingest.Source{}, Page{}, fmt.Errorf("failed to fetch %s: %s", pageURL, response.Status)
+	}
+
+	maxPageSize := loader.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = DefaultMaxPageSize
+	}
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxPageSize))
+	if err != nil {
+		return ingest.Source{}, Page{}, fmt.Errorf("failed to read %s: %w", pageURL, err)
+	}
+
+	source := ingest.Source{
+		ID:       pageURL.String(),
+		Path:     pageURL.String(),
+		Content:  content,
+		Metadata: map[string]any{MetadataURL: pageURL.String()},
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mimeType != "text/html" && mimeType != "application/xhtml+xml" {
+		source.MimeType = mimeType
+		return source, Page{}, nil
+	}
+
+	// the final URL after redirects is the base of relative links
+	page, err := ParseHTML(bytes.NewReader(content), response.Request.URL)
+	if err != nil {
+		return ingest.Source{}, Page{}, fmt.Errorf("failed to parse %s: %w", pageURL, err)
+	}
+	source.Content = []byte(page.Text)
+	source.MimeType = "text/plain"
+	if page.Title != "" {
+		source.Metadata[MetadataTitle] = page.Title
+	}
+	return source, page, nil
+}
+
+// ParseHTML extracts the title, the main text and the links of an HTML document. Navigation, headers,
+// footers, scripts and similar boilerplate are dropped; if the document has a main or article element,
+// only its text is used. Relative links are resolved against base.
+func ParseHTML(r io.Reader, base *url.URL) (Page, error) {
+	document, err := html.Parse(r)
+	if err != nil {
+		return Page{}, err
+	}
+
+	var page Page
+	var title, main, body *html.Node
+	seen := make(map[string]bool)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.DataAtom {
+			case atom.Title:
+				if title == nil {
+					title = node
+				}
+			case atom.Main, atom.Article:
+				if main == nil {
+					main = node
+				}
+			case atom.Body:
+				body = node
+			case atom.A:
+				if link := resolveLink(node, base); link != "" && !seen[link] {
+					seen[link] = true
+					page.Links = append(page.Links, link)
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(document)
+
+	if title != nil {
+		page.Title = strings.TrimSpace(textOf(title))
+	}
+
+	root := main
+	if root == nil {
+		root = body
+	}
+	if root == nil {
+		root = document
+	}
+
+	var builder strings.Builder
+	writeText(&builder, root)
+	page.Text = normalizeText(builder.String())
+	return page, nil
+}
+
+// resolveLink returns the absolute http(s) URL of a link element, or an empty string.
+func resolveLink(node *html.Node, base *url.URL) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key != "href" {
+			continue
+		}
+		link, err := url.Parse(strings.TrimSpace(attribute.Val))
+		if err != nil {
+			return ""
+		}
+		if base != nil {
+			link = base.ResolveReference(link)
+		}
+		if link.Scheme != "http" && link.Scheme != "https" {
+			return ""
+		}
+		link.Fragment = ""
+		return link.String()
+	}
+	return ""
+}
+
+// textOf returns the concatenated text of a node.
+func textOf(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(textOf(child))
+	}
+	return builder.String()
+}
+
+// writeText writes the visible text of a node, with line breaks around block elements.
+func writeText(builder *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		builder.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		if skipped[node.DataAtom] {
+			return
+		}
+		if blocks[node.DataAtom] {
+			builder.WriteString("\n")
+			defer builder.WriteString("\n")
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeText(builder, child)
+	}
+}
+
+// normalizeText collapses whitespace within lines and drops empty lines.
+func normalizeText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,61 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/rag/ingest"
+	"github.com/ghmer/aicompanion/rag/web"
+)
+
+const index = `<html><head><title>Home</title><script>var x = 1;</script></head><body>
+<nav><a href="/about">About</a> <a href="https://elsewhere.example/">Elsewhere</a></nav>
+<main><h1>Welcome</h1><p>This is   the <b>home</b> page.</p></main>
+<footer>Copyright</footer>
+</body></html>`
+
+const about = `<html><head><title>About</title></head><body><p>About us.</p><a href="/deeper">Deeper</a></body></html>`
+
+func TestLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(index))
+		case "/about":
+			w.Write([]byte(about))
+		default:
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := aicompaniontest.NewFakeVectorDb()
+	loader := web.NewLoader(ingest.NewPipeline(aicompaniontest.NewFakeCompanion(), db, "web"))
+	loader.Depth = 1
+
+	if _, err := loader.Load(context.Background(), server.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	documents := db.Documents("web")
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %+v", documents)
+	}
+
+	home := documents[0]
+	if home.Content != "Welcome\nThis is the home page." {
+		t.Errorf("unexpected text %q", home.Content)
+	}
+	if home.Metadata[web.MetadataURL] != server.URL+"/" || home.Metadata[web.MetadataTitle] != "Home" {
+		t.Errorf("unexpected metadata %+v", home.Metadata)
+	}
+	if !strings.Contains(documents[1].Content, "About us.") {
+		t.Errorf("unexpected text %q", documents[1].Content)
+	}
+}
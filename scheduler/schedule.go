@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes the next activation time after a given time.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// Every returns a Schedule that fires at a fixed interval.
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule(interval)
+}
+
+type intervalSchedule time.Duration
+
+// Next implements Schedule.
+func (schedule intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(schedule))
+}
+
+// CronSchedule is a parsed five field cron expression (minute, hour, day of month, month, day of week).
+type CronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// restricted day fields are combined with OR, like in classic cron
+	daysRestricted     bool
+	weekdaysRestricted bool
+	Location           *time.Location
+}
+
+// descriptors supported in place of a five field expression
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression such as "0 8 * * 1-5" or a descriptor such as "@daily".
+// Fields support lists, ranges and steps. Times are evaluated in the local time zone.
+func ParseCron(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if descriptor, exists := cronDescriptors[expression]; exists {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expression, len(fields))
+	}
+
+	schedule := &CronSchedule{Location: time.Local}
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day of week field: %w", err)
+	}
+	// 7 is an alias for sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.daysRestricted = fields[2] != "*"
+	schedule.weekdaysRestricted = fields[4] != "*"
+
+	return schedule, nil
+}
+
+// MustParseCron is like ParseCron but panics on invalid expressions.
+func MustParseCron(expression string) *CronSchedule {
+	schedule, err := ParseCron(expression)
+	if err != nil {
+		panic(err)
+	}
+	return schedule
+}
+
+// Next implements Schedule. It returns the zero time if no activation is found within five years.
+func (schedule *CronSchedule) Next(after time.Time) time.Time {
+	location := schedule.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	current := after.In(location).Truncate(time.Minute).Add(time.Minute)
+	limit := current.AddDate(5, 0, 0)
+	for current.Before(limit) {
+		if schedule.months&(1<<uint(current.Month())) == 0 {
+			current = time.Date(current.Year(), current.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !schedule.matchesDay(current) {
+			current = time.Date(current.Year(), current.Month(), current.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if schedule.hours&(1<<uint(current.Hour())) == 0 {
+			current = time.Date(current.Year(), current.Month(), current.Day(), current.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+		if schedule.minutes&(1<<uint(current.Minute())) == 0 {
+			current = current.Add(time.Minute)
+			continue
+		}
+		return current
+	}
+
+	return time.Time{}
+}
+
+// matchesDay checks the day of month and day of week fields.
+func (schedule *CronSchedule) matchesDay(t time.Time) bool {
+	day := schedule.days&(1<<uint(t.Day())) != 0
+	weekday := schedule.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if schedule.daysRestricted && schedule.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// parseCronField parses a single cron field into a bit set.
+func parseCronField(field string, minimum, maximum int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return 0, errors.New("empty list element")
+		}
+
+		step := 1
+		if base, stepText, found := strings.Cut(part, "/"); found {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			part = base
+		}
+
+		start, end := minimum, maximum
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			low, high, _ := strings.Cut(part, "-")
+			var err error
+			if start, err = strconv.Atoi(low); err != nil {
+				return 0, fmt.Errorf("invalid value %q", low)
+			}
+			if end, err = strconv.Atoi(high); err != nil {
+				return 0, fmt.Errorf("invalid value %q", high)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			start = value
+			if step == 1 {
+				end = value
+			}
+		}
+
+		if start < minimum || end > maximum || start > end {
+			return 0, fmt.Errorf("range %d-%d out of bounds %d-%d", start, end, minimum, maximum)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,45 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/scheduler"
+)
+
+func TestCronSchedule(t *testing.T) {
+	base := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC) // friday
+
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, time.March, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2024, time.March, 18, 8, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"30 10 1 * *", time.Date(2024, time.April, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, time.March, 17, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			schedule, err := scheduler.ParseCron(test.expression)
+			if err != nil {
+				t.Fatalf("failed to parse expression: %v", err)
+			}
+			schedule.Location = time.UTC
+
+			if next := schedule.Next(base); !next.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected, next)
+			}
+		})
+	}
+
+	t.Run("Test invalid expressions", func(t *testing.T) {
+		for _, expression := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+			if _, err := scheduler.ParseCron(expression); err == nil {
+				t.Errorf("expected error for %q, got nil", expression)
+			}
+		}
+	})
+}
@@ -0,0 +1,316 @@
+// Package scheduler runs prompts, pipelines and other jobs on recurring schedules and delivers
+// their results via callbacks, webhooks or a companion conversation.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/pipeline"
+	"github.com/ghmer/aicompanion/webhook"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// JobFunc is the work executed on every activation of a job.
+type JobFunc func(ctx context.Context) (any, error)
+
+// Result is handed to the delivery of a job after each run.
+type Result struct {
+	Job      string
+	Started  time.Time
+	Duration time.Duration
+	Output   any
+	Err      error
+}
+
+// Delivery receives the result of a job run.
+type Delivery func(ctx context.Context, result Result) error
+
+// Job is a named unit of work with a schedule.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      JobFunc
+	Delivery Delivery      // optional, results are discarded if nil
+	Timeout  time.Duration // optional limit for a single run
+
+	next    time.Time
+	running bool
+}
+
+// Scheduler runs jobs according to their schedules. Runs of the same job never overlap;
+// an activation is skipped if the previous run is still in progress.
+type Scheduler struct {
+	mutex   sync.Mutex
+	jobs    map[string]*Job
+	wake    chan struct{}
+	wg      sync.WaitGroup
+	now     func() time.Time
+	OnError func(job string, err error) // called if a run or its delivery fails
+}
+
+// New creates a new, empty Scheduler.
+func New() *Scheduler {
+	return &Scheduler{
+		jobs: make(map[string]*Job),
+		wake: make(chan struct{}, 1),
+		now:  time.Now,
+	}
+}
+
+// Add registers a job. Jobs can be added while the scheduler is running.
+func (scheduler *Scheduler) Add(job Job) error {
+	if job.Name == "" {
+		return errors.New("job name must not be empty")
+	}
+	if job.Schedule == nil || job.Run == nil {
+		return fmt.Errorf("job %s requires a schedule and a run function", job.Name)
+	}
+
+	scheduler.mutex.Lock()
+	if _, exists := scheduler.jobs[job.Name]; exists {
+		scheduler.mutex.Unlock()
+		return fmt.Errorf("job %s already exists", job.Name)
+	}
+	job.next = job.Schedule.Next(scheduler.now())
+	scheduler.jobs[job.Name] = &job
+	scheduler.mutex.Unlock()
+
+	scheduler.notify()
+	return nil
+}
+
+// AddCron parses a cron expression and registers a job with it.
+func (scheduler *Scheduler) AddCron(name, expression string, run JobFunc, delivery Delivery) error {
+	schedule, err := ParseCron(expression)
+	if err != nil {
+		return err
+	}
+	return scheduler.Add(Job{Name: name, Schedule: schedule, Run: run, Delivery: delivery})
+}
+
+// Remove unregisters a job. A run in progress is not interrupted.
+func (scheduler *Scheduler) Remove(name string) {
+	scheduler.mutex.Lock()
+	delete(scheduler.jobs, name)
+	scheduler.mutex.Unlock()
+
+	scheduler.notify()
+}
+
+// Jobs returns the names of the registered jobs with their next activation time.
+func (scheduler *Scheduler) Jobs() map[string]time.Time {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	jobs := make(map[string]time.Time, len(scheduler.jobs))
+	for name, job := range scheduler.jobs {
+		jobs[name] = job.next
+	}
+	return jobs
+}
+
+// RunNow runs a job immediately, independent of its schedule, and waits for the result.
+// It fails if the job is already running.
+func (scheduler *Scheduler) RunNow(ctx context.Context, name string) (Result, error) {
+	scheduler.mutex.Lock()
+	job, exists := scheduler.jobs[name]
+	if !exists {
+		scheduler.mutex.Unlock()
+		return Result{}, fmt.Errorf("job %s not found", name)
+	}
+	if job.running {
+		scheduler.mutex.Unlock()
+		return Result{}, fmt.Errorf("job %s is already running", name)
+	}
+	job.running = true
+	scheduler.mutex.Unlock()
+	defer scheduler.finish(job)
+
+	result := scheduler.execute(ctx, job)
+	return result, result.Err
+}
+
+// Start runs the scheduler until ctx is cancelled, then waits for running jobs to finish.
+func (scheduler *Scheduler) Start(ctx context.Context) {
+	for {
+		due, wait := scheduler.due()
+		for _, job := range due {
+			scheduler.wg.Add(1)
+			go func(job *Job) {
+				defer scheduler.wg.Done()
+				defer scheduler.finish(job)
+				scheduler.execute(ctx, job)
+			}(job)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			scheduler.wg.Wait()
+			return
+		case <-scheduler.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// due returns the jobs that have to run now, advances their schedules and
+// computes how long to wait until the next activation.
+func (scheduler *Scheduler) due() ([]*Job, time.Duration) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	now := scheduler.now()
+	wait := time.Hour
+
+	names := make([]string, 0, len(scheduler.jobs))
+	for name := range scheduler.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var due []*Job
+	for _, name := range names {
+		job := scheduler.jobs[name]
+		if job.next.IsZero() {
+			continue
+		}
+		if !job.next.After(now) {
+			if !job.running {
+				job.running = true
+				due = append(due, job)
+			}
+			job.next = job.Schedule.Next(now)
+			if job.next.IsZero() {
+				continue
+			}
+		}
+		wait = min(wait, job.next.Sub(now))
+	}
+
+	return due, max(wait, 0)
+}
+
+// execute runs a job once and hands the result to its delivery.
+func (scheduler *Scheduler) execute(ctx context.Context, job *Job) Result {
+	runCtx := ctx
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+
+	result := Result{Job: job.Name, Started: scheduler.now()}
+	result.Output, result.Err = job.Run(runCtx)
+	result.Duration = time.Since(result.Started)
+	if result.Err != nil {
+		sideKick.Error(fmt.Errorf("job %s failed: %w", job.Name, result.Err))
+		scheduler.reportError(job.Name, result.Err)
+	}
+
+	if job.Delivery != nil {
+		// deliver even if the run was cancelled, so the receiver learns about it
+		if err := job.Delivery(context.WithoutCancel(ctx), result); err != nil {
+			sideKick.Error(fmt.Errorf("delivery of job %s failed: %w", job.Name, err))
+			scheduler.reportError(job.Name, err)
+		}
+	}
+
+	return result
+}
+
+// finish marks a job as no longer running.
+func (scheduler *Scheduler) finish(job *Job) {
+	scheduler.mutex.Lock()
+	job.running = false
+	scheduler.mutex.Unlock()
+}
+
+// reportError forwards an error to the OnError callback, if set.
+func (scheduler *Scheduler) reportError(job string, err error) {
+	if scheduler.OnError != nil {
+		scheduler.OnError(job, err)
+	}
+}
+
+// notify wakes up the scheduler loop to recompute the next activation.
+func (scheduler *Scheduler) notify() {
+	select {
+	case scheduler.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PromptJob returns a JobFunc that sends a prompt as a generate request and returns the answer text.
+// The conversation of the companion is not modified.
+func PromptJob(companion aicompanion.AICompanion, prompt string) JobFunc {
+	return func(ctx context.Context) (any, error) {
+		message := sideKick.CreateUserMessage(prompt, nil)
+		response, err := companion.SendGenerateRequest(ctx, models.MessageRequest{Message: message}, false, nil)
+		if err != nil {
+			return nil, err
+		}
+		return response.Content, nil
+	}
+}
+
+// PipelineJob returns a JobFunc that executes a pipeline with the given inputs and returns the
+// variable named output from the final state.
+func PipelineJob(p *pipeline.Pipeline, inputs map[string]any, output string) JobFunc {
+	return func(ctx context.Context) (any, error) {
+		state, err := p.Execute(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+		return state.Get(output), nil
+	}
+}
+
+// CallbackDelivery returns a Delivery that hands every result to callback.
+func CallbackDelivery(callback func(result Result)) Delivery {
+	return func(ctx context.Context, result Result) error {
+		callback(result)
+		return nil
+	}
+}
+
+// WebhookDelivery returns a Delivery that sends every result as a job.completed event.
+func WebhookDelivery(notifier *webhook.Notifier) Delivery {
+	return func(ctx context.Context, result Result) error {
+		event := webhook.Event{
+			Type:      webhook.EventJobCompleted,
+			Status:    webhook.StatusSuccess,
+			Timestamp: result.Started,
+			Duration:  result.Duration.Seconds(),
+			Data:      map[string]any{"job": result.Job, "output": result.Output},
+		}
+		if result.Err != nil {
+			event.Status = webhook.StatusError
+			event.Error = result.Err.Error()
+		}
+		return notifier.Notify(ctx, event)
+	}
+}
+
+// ConversationDelivery returns a Delivery that appends successful results to the conversation
+// of a companion as assistant messages, e.g. to surface a daily digest in a chat session.
+func ConversationDelivery(companion aicompanion.AICompanion) Delivery {
+	return func(ctx context.Context, result Result) error {
+		if result.Err != nil {
+			return nil
+		}
+		companion.AddMessage(models.Message{Role: models.Assistant, Content: fmt.Sprint(result.Output)})
+		return nil
+	}
+}
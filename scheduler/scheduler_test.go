@@ -0,0 +1,138 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/scheduler"
+)
+
+func TestStart(t *testing.T) {
+	release := make(chan struct{})
+	results := make(chan scheduler.Result, 10)
+	var runs, active atomic.Int32
+
+	s := scheduler.New()
+	err := s.Add(scheduler.Job{
+		Name:     "digest",
+		Schedule: scheduler.Every(10 * time.Millisecond),
+		Run: func(ctx context.Context) (any, error) {
+			if active.Add(1) > 1 {
+				t.Error("expected runs of the same job not to overlap")
+			}
+			defer active.Add(-1)
+			if runs.Add(1) == 1 {
+				<-release
+			}
+			return "done", nil
+		},
+		Delivery: scheduler.CallbackDelivery(func(result scheduler.Result) { results <- result }),
+	})
+	if err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Start(ctx)
+		close(stopped)
+	}()
+
+	// wait for the first activation, which blocks until released
+	deadline := time.After(5 * time.Second)
+	for runs.Load() == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("expected the job to be started by the scheduler")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if _, err := s.RunNow(context.Background(), "digest"); err == nil {
+		t.Error("expected RunNow to fail while the job is running")
+	}
+	time.Sleep(30 * time.Millisecond)
+	close(release)
+
+	for range 2 {
+		select {
+		case result := <-results:
+			if result.Job != "digest" || result.Output != "done" || result.Err != nil {
+				t.Errorf("unexpected result %+v", result)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the results to be delivered")
+		}
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Start to return once the context is cancelled")
+	}
+}
+
+func TestRunNow(t *testing.T) {
+	var reported []string
+	var delivered scheduler.Result
+
+	s := scheduler.New()
+	s.OnError = func(job string, err error) { reported = append(reported, job+": "+err.Error()) }
+	s.Add(scheduler.Job{
+		Name:     "failing",
+		Schedule: scheduler.Every(time.Hour),
+		Run: func(ctx context.Context) (any, error) {
+			return nil, errors.New("unavailable")
+		},
+		Delivery: func(ctx context.Context, result scheduler.Result) error {
+			delivered = result
+			return errors.New("undeliverable")
+		},
+	})
+
+	if _, err := s.RunNow(context.Background(), "unknown"); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+	if _, err := s.RunNow(context.Background(), "failing"); err == nil || err.Error() != "unavailable" {
+		t.Errorf("expected the error of the run, got %v", err)
+	}
+	if delivered.Job != "failing" || delivered.Err == nil {
+		t.Errorf("expected the failed result to be delivered, got %+v", delivered)
+	}
+	if len(reported) != 2 || reported[0] != "failing: unavailable" || reported[1] != "failing: undeliverable" {
+		t.Errorf("expected the run and the delivery to be reported, got %q", reported)
+	}
+
+	// a finished run does not block the next one
+	if _, err := s.RunNow(context.Background(), "failing"); err == nil || err.Error() != "unavailable" {
+		t.Errorf("expected the job to run again, got %v", err)
+	}
+}
+
+func TestCompanionJobs(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("Today is sunny")
+
+	s := scheduler.New()
+	s.Add(scheduler.Job{
+		Name:     "weather",
+		Schedule: scheduler.Every(time.Hour),
+		Run:      scheduler.PromptJob(companion, "How is the weather?"),
+		Delivery: scheduler.ConversationDelivery(companion),
+	})
+
+	result, err := s.RunNow(context.Background(), "weather")
+	if err != nil || result.Output != "Today is sunny" {
+		t.Fatalf("unexpected result %+v (%v)", result, err)
+	}
+	if request, _ := companion.LastRequest(); request.Message.Content != "How is the weather?" {
+		t.Errorf("expected the prompt to be sent, got %q", request.Message.Content)
+	}
+	if conversation := companion.GetConversation(); len(conversation) != 1 || conversation[0].Content != "Today is sunny" {
+		t.Errorf("expected only the result to be added to the conversation, got %+v", conversation)
+	}
+}
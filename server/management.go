@@ -0,0 +1,632 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/interfaces/vectordb"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ManagementAPI is an http.Handler exposing CRUD endpoints for sessions, messages, personas and
+// vector documents, plus a chat endpoint with server-sent event streaming.
+type ManagementAPI struct {
+	companion aicompanion.AICompanion
+	vectorDb  vectordb.VectorDb
+	mux       *http.ServeMux
+	// mutex serializes access to the companion
+	mutex sync.Mutex
+
+	// Store keeps the conversations of the sessions, one per key. Defaults to an in-memory store.
+	Store conversationstore.Store
+
+	// lockMutex guards locks, which serialize the changes of each session
+	lockMutex sync.Mutex
+	locks     map[string]*sync.Mutex
+}
+
+// SessionRequest represents the payload used to create a session.
+type SessionRequest struct {
+	Name string `json:"name"`
+}
+
+// SchemaRequest represents the payload used to create a schema.
+type SchemaRequest struct {
+	ClassName  string                  `json:"class_name"`
+	Properties []models.SchemaProperty `json:"properties,omitempty"`
+	Vector     models.VectorConfig     `json:"vector"`
+}
+
+// ChatRequest represents the payload of the chat endpoint.
+type ChatRequest struct {
+	Content string                `json:"content"`
+	Images  *[]models.Base64Image `json:"images,omitempty"`
+	Stream  bool                  `json:"stream,omitempty"`
+}
+
+// DocumentRequest represents the payload used to add a document. If no embeddings are given,
+// the text is embedded with the configured embedding model.
+type DocumentRequest struct {
+	ID         string         `json:"id"`
+	Text       string         `json:"text"`
+	Embeddings []float32      `json:"embeddings,omitempty"`
+	Metadata   map[string]any `json:"metadata,omitempty"`
+}
+
+// QueryRequest represents the payload used to query documents.
+type QueryRequest struct {
+	Text    string                      `json:"text"`
+	Options models.VectorDBQueryOptions `json:"options"`
+}
+
+// NewManagementAPI creates a new ManagementAPI. The vector database is optional; without it
+// the document endpoints respond with 501 Not Implemented.
+func NewManagementAPI(companion aicompanion.AICompanion, vectorDb vectordb.VectorDb) *ManagementAPI {
+	api := &ManagementAPI{
+		companion: companion,
+		vectorDb:  vectorDb,
+		mux:       http.NewServeMux(),
+		Store:     conversationstore.NewMemoryStore(),
+		locks:     make(map[string]*sync.Mutex),
+	}
+
+	api.mux.HandleFunc("GET /api/sessions", api.listSessions)
+	api.mux.HandleFunc("POST /api/sessions", api.createSession)
+	api.mux.HandleFunc("GET /api/sessions/{session}", api.getSession)
+	api.mux.HandleFunc("DELETE /api/sessions/{session}", api.deleteSession)
+	api.mux.HandleFunc("GET /api/sessions/{session}/messages", api.getSession)
+	api.mux.HandleFunc("POST /api/sessions/{session}/messages", api.addMessage)
+	api.mux.HandleFunc("DELETE /api/sessions/{session}/messages", api.clearMessages)
+	api.mux.HandleFunc("POST /api/sessions/{session}/chat", api.chat)
+
+	api.mux.HandleFunc("GET /api/personas", api.listPersonas)
+	api.mux.HandleFunc("POST /api/personas", api.savePersona)
+	api.mux.HandleFunc("GET /api/personas/{persona}", api.getPersona)
+	api.mux.HandleFunc("PUT /api/personas/{persona}", api.savePersona)
+	api.mux.HandleFunc("DELETE /api/personas/{persona}", api.deletePersona)
+	api.mux.HandleFunc("POST /api/personas/{persona}/activate", api.activatePersona)
+
+	api.mux.HandleFunc("GET /api/schemas", api.listSchemas)
+	api.mux.HandleFunc("POST /api/schemas", api.createSchema)
+	api.mux.HandleFunc("DELETE /api/schemas/{schema}", api.deleteSchema)
+	api.mux.HandleFunc("GET /api/schemas/{schema}/documents", api.listDocuments)
+	api.mux.HandleFunc("POST /api/schemas/{schema}/documents", api.addDocument)
+	api.mux.HandleFunc("GET /api/schemas/{schema}/documents/{id}", api.getDocument)
+	api.mux.HandleFunc("DELETE /api/schemas/{schema}/documents/{id}", api.deleteDocument)
+	api.mux.HandleFunc("POST /api/schemas/{schema}/query", api.queryDocuments)
+
+	return api
+}
+
+// ServeHTTP implements http.Handler.
+func (api *ManagementAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mux.ServeHTTP(w, r)
+}
+
+// lockSession locks a session against concurrent changes and returns the function unlocking it.
+func (api *ManagementAPI) lockSession(name string) func() {
+	api.lockMutex.Lock()
+	lock, exists := api.locks[name]
+	if !exists {
+		lock = &sync.Mutex{}
+		api.locks[name] = lock
+	}
+	api.lockMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// loadSession returns the conversation of a session, writing an error response if the session does
+// not exist or cannot be loaded.
+func (api *ManagementAPI) loadSession(w http.ResponseWriter, name string) ([]models.Message, bool) {
+	names, err := api.Store.Keys()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !slices.Contains(names, name) {
+		writeError(w, http.StatusNotFound, errors.New("session does not exist"))
+		return nil, false
+	}
+
+	messages, err := api.Store.Load(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+	return messages, true
+}
+
+// listSessions returns the names of all sessions.
+func (api *ManagementAPI) listSessions(w http.ResponseWriter, r *http.Request) {
+	names, err := api.Store.Keys()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// createSession creates a new, empty session.
+func (api *ManagementAPI) createSession(w http.ResponseWriter, r *http.Request) {
+	var request SessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("a session name is required"))
+		return
+	}
+
+	unlock := api.lockSession(request.Name)
+	defer unlock()
+
+	names, err := api.Store.Keys()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if slices.Contains(names, request.Name) {
+		writeError(w, http.StatusConflict, fmt.Errorf("session %s already exists", request.Name))
+		return
+	}
+
+	if err := api.Store.Save(request.Name, []models.Message{}); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, request)
+}
+
+// getSession returns the messages of a session.
+func (api *ManagementAPI) getSession(w http.ResponseWriter, r *http.Request) {
+	messages, ok := api.loadSession(w, r.PathValue("session"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
+
+// deleteSession deletes a session.
+func (api *ManagementAPI) deleteSession(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("session")
+	unlock := api.lockSession(name)
+	defer unlock()
+
+	if _, ok := api.loadSession(w, name); !ok {
+		return
+	}
+	if err := api.Store.Delete(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addMessage appends a message to a session without sending it to the model.
+func (api *ManagementAPI) addMessage(w http.ResponseWriter, r *http.Request) {
+	var message models.Message
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	name := r.PathValue("session")
+	unlock := api.lockSession(name)
+	defer unlock()
+
+	messages, ok := api.loadSession(w, name)
+	if !ok {
+		return
+	}
+	if err := api.Store.Save(name, append(messages, message)); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, message)
+}
+
+// clearMessages removes all messages from a session.
+func (api *ManagementAPI) clearMessages(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("session")
+	unlock := api.lockSession(name)
+	defer unlock()
+
+	if _, ok := api.loadSession(w, name); !ok {
+		return
+	}
+	if err := api.Store.Save(name, []models.Message{}); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// chat sends a user message in the context of a session, optionally streaming the answer as server-sent events.
+func (api *ManagementAPI) chat(w http.ResponseWriter, r *http.Request) {
+	var request ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	name := r.PathValue("session")
+	unlock := api.lockSession(name)
+	defer unlock()
+
+	messages, ok := api.loadSession(w, name)
+	if !ok {
+		return
+	}
+
+	// run the request against the session history and store the updated history afterwards
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	previous := api.companion.GetConversation()
+	api.companion.SetConversation(messages)
+	defer func() {
+		if err := api.Store.Save(name, api.companion.GetConversation()); err != nil {
+			sideKick.Error(err)
+		}
+		api.companion.SetConversation(previous)
+	}()
+
+	messageRequest := models.MessageRequest{Message: sideKick.CreateUserMessage(request.Content, request.Images)}
+	if !request.Stream {
+		result, err := api.companion.SendChatRequest(r.Context(), messageRequest, false, nil)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	result, err := api.companion.SendChatRequest(r.Context(), messageRequest, true, func(m models.Message) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "event: delta\ndata: %s\n\n", mustMarshal(m))
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", mustMarshal(ErrorDetail{Message: err.Error(), Type: "server_error"}))
+		flusher.Flush()
+		return
+	}
+
+	fmt.Fprintf(w, "event: done\ndata: %s\n\n", mustMarshal(result))
+	flusher.Flush()
+}
+
+// listPersonas returns all configured personas.
+func (api *ManagementAPI) listPersonas(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	personas := api.companion.GetConfig().Personas
+	api.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, personas)
+}
+
+// getPersona returns a single persona.
+func (api *ManagementAPI) getPersona(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	config := api.companion.GetConfig()
+	api.mutex.Unlock()
+
+	index := findPersona(config.Personas, r.PathValue("persona"))
+	if index < 0 {
+		writeError(w, http.StatusNotFound, errors.New("persona does not exist"))
+		return
+	}
+	writeJSON(w, http.StatusOK, config.Personas[index])
+}
+
+// savePersona creates or replaces a persona.
+func (api *ManagementAPI) savePersona(w http.ResponseWriter, r *http.Request) {
+	var persona models.Persona
+	if err := json.NewDecoder(r.Body).Decode(&persona); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if name := r.PathValue("persona"); name != "" {
+		persona.Name = name
+	}
+	if persona.Name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("a persona name is required"))
+		return
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	config := api.companion.GetConfig()
+	status := http.StatusCreated
+	if index := findPersona(config.Personas, persona.Name); index >= 0 {
+		config.Personas[index] = persona
+		status = http.StatusOK
+	} else {
+		config.Personas = append(config.Personas, persona)
+	}
+	if config.ActivePersona.Name == persona.Name {
+		config.ActivePersona = persona
+	}
+
+	api.companion.SetConfig(config)
+	writeJSON(w, status, persona)
+}
+
+// deletePersona deletes a persona. The active persona cannot be deleted.
+func (api *ManagementAPI) deletePersona(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	config := api.companion.GetConfig()
+	name := r.PathValue("persona")
+	index := findPersona(config.Personas, name)
+	if index < 0 {
+		writeError(w, http.StatusNotFound, errors.New("persona does not exist"))
+		return
+	}
+	if config.ActivePersona.Name == name {
+		writeError(w, http.StatusConflict, errors.New("the active persona cannot be deleted"))
+		return
+	}
+
+	config.Personas = append(config.Personas[:index], config.Personas[index+1:]...)
+	api.companion.SetConfig(config)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// activatePersona makes a persona the active persona of the companion.
+func (api *ManagementAPI) activatePersona(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	config := api.companion.GetConfig()
+	index := findPersona(config.Personas, r.PathValue("persona"))
+	if index < 0 {
+		writeError(w, http.StatusNotFound, errors.New("persona does not exist"))
+		return
+	}
+
+	config.ActivePersona = config.Personas[index]
+	api.companion.SetConfig(config)
+	writeJSON(w, http.StatusOK, config.ActivePersona)
+}
+
+// listSchemas returns the names of all schemas in the vector database.
+func (api *ManagementAPI) listSchemas(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	schemas, err := api.vectorDb.GetSchemas(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schemas)
+}
+
+// createSchema creates a new schema in the vector database.
+func (api *ManagementAPI) createSchema(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	var request SchemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ClassName == "" {
+		writeError(w, http.StatusBadRequest, errors.New("a schema class_name is required"))
+		return
+	}
+
+	schema := models.Schema{ClassName: request.ClassName, Properties: request.Properties, Vector: request.Vector}
+	if err := api.vectorDb.CreateSchema(r.Context(), schema); errors.Is(err, vectordb.ErrSchemaExists) {
+		writeError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, schema)
+}
+
+// deleteSchema deletes a schema from the vector database.
+func (api *ManagementAPI) deleteSchema(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	if err := api.vectorDb.DeleteSchema(r.Context(), r.PathValue("schema")); errors.Is(err, vectordb.ErrSchemaNotExists) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addDocument adds a document to a schema, embedding its text if no embeddings are given.
+func (api *ManagementAPI) addDocument(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	var request DocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if request.ID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("a document id is required"))
+		return
+	}
+
+	embeddings := request.Embeddings
+	if len(embeddings) == 0 {
+		var err error
+		embeddings, err = api.embed(r.Context(), request.Text)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+	}
+
+	classname := r.PathValue("schema")
+	document := models.Document{ID: request.ID, ClassName: classname, Content: request.Text, Embeddings: embeddings, Metadata: request.Metadata}
+	if err := api.vectorDb.AddDocument(r.Context(), classname, request.ID, document); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, document)
+}
+
+// listDocuments lists the documents of a schema in ascending ID order. The query parameters after and
+// limit page through the documents.
+func (api *ManagementAPI) listDocuments(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	listOptions := models.DocumentListOptions{After: r.URL.Query().Get("after")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", limit))
+			return
+		}
+		listOptions.Limit = value
+	}
+
+	documents, err := api.vectorDb.ListDocuments(r.Context(), r.PathValue("schema"), listOptions)
+	if err != nil {
+		writeError(w, vectorDbStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, documents)
+}
+
+// getDocument returns a single document of a schema.
+func (api *ManagementAPI) getDocument(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	document, err := api.vectorDb.GetDocument(r.Context(), r.PathValue("schema"), r.PathValue("id"))
+	if err != nil {
+		writeError(w, vectorDbStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, document)
+}
+
+// vectorDbStatus maps vector database errors to HTTP status codes.
+func vectorDbStatus(err error) int {
+	if errors.Is(err, vectordb.ErrSchemaNotExists) || errors.Is(err, vectordb.ErrDocumentNotExists) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// deleteDocument deletes a document from a schema.
+func (api *ManagementAPI) deleteDocument(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	if err := api.vectorDb.DeleteDocument(r.Context(), r.PathValue("schema"), r.PathValue("id")); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queryDocuments embeds the query text and returns the most similar documents of a schema.
+func (api *ManagementAPI) queryDocuments(w http.ResponseWriter, r *http.Request) {
+	if !api.requireVectorDb(w) {
+		return
+	}
+
+	var request QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	vector, err := api.embed(r.Context(), request.Text)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	documents, err := api.vectorDb.QueryDocuments(r.Context(), r.PathValue("schema"), vector, request.Options)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, documents)
+}
+
+// embed returns the embedding of a single text.
+func (api *ManagementAPI) embed(ctx context.Context, text string) ([]float32, error) {
+	if text == "" {
+		return nil, errors.New("text must not be empty")
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	model := api.companion.GetConfig().AiModels.EmbeddingModel
+	response, err := api.companion.SendEmbeddingRequest(ctx, sideKick.CreateEmbeddingRequest(model, []string{text}))
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) == 0 {
+		return nil, errors.New("no embeddings returned")
+	}
+	return response.Embeddings[0], nil
+}
+
+// requireVectorDb writes an error response if no vector database is configured.
+func (api *ManagementAPI) requireVectorDb(w http.ResponseWriter) bool {
+	if api.vectorDb == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("no vector database configured"))
+		return false
+	}
+	return true
+}
+
+// findPersona returns the index of the persona with the given name, or -1.
+func findPersona(personas []models.Persona, name string) int {
+	for i, persona := range personas {
+		if persona.Name == name {
+			return i
+		}
+	}
+	return -1
+}
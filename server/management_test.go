@@ -0,0 +1,250 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/impl/memvdb"
+	"github.com/ghmer/aicompanion/interfaces/conversationstore"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/server"
+)
+
+// call sends a request with an optional JSON payload and decodes the JSON response into result.
+func call(t *testing.T, handler http.Handler, method, path, payload string, result any) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(payload)))
+	if result != nil && recorder.Code < 300 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+			t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestManagementSessions(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("Nice to meet you")
+	companion.Conversation = []models.Message{{Role: models.User, Content: "unrelated"}}
+	store := conversationstore.NewMemoryStore()
+	store.Save("existing", []models.Message{{Role: models.User, Content: "stored"}})
+	api := server.NewManagementAPI(companion, nil)
+	api.Store = store
+
+	if status := call(t, api, http.MethodPost, "/api/sessions", `{"name": "work"}`, nil); status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	if status := call(t, api, http.MethodPost, "/api/sessions", `{"name": "work"}`, nil); status != http.StatusConflict {
+		t.Errorf("expected status 409 for an existing session, got %d", status)
+	}
+	if status := call(t, api, http.MethodPost, "/api/sessions", `{}`, nil); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 without name, got %d", status)
+	}
+
+	var names []string
+	call(t, api, http.MethodGet, "/api/sessions", "", &names)
+	if strings.Join(names, ",") != "existing,work" {
+		t.Errorf("expected the sessions of the store, got %v", names)
+	}
+
+	if status := call(t, api, http.MethodPost, "/api/sessions/work/messages", `{"role": "user", "content": "My name is Ada."}`, nil); status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+
+	var answer models.Message
+	if status := call(t, api, http.MethodPost, "/api/sessions/work/chat", `{"content": "Hello"}`, &answer); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if answer.Content != "Nice to meet you" {
+		t.Errorf("unexpected answer %q", answer.Content)
+	}
+	if request, _ := companion.LastRequest(); request.Message.Content != "Hello" {
+		t.Errorf("expected the chat message to be sent, got %q", request.Message.Content)
+	}
+
+	stored, _ := store.Load("work")
+	if len(stored) != 3 || stored[0].Content != "My name is Ada." || stored[2].Content != "Nice to meet you" {
+		t.Errorf("expected the exchange to be saved in the store, got %+v", stored)
+	}
+	if len(companion.Conversation) != 1 || companion.Conversation[0].Content != "unrelated" {
+		t.Errorf("expected the conversation of the companion to be restored, got %+v", companion.Conversation)
+	}
+
+	var messages []models.Message
+	call(t, api, http.MethodGet, "/api/sessions/existing/messages", "", &messages)
+	if len(messages) != 1 || messages[0].Content != "stored" {
+		t.Errorf("expected the stored messages, got %+v", messages)
+	}
+
+	if status := call(t, api, http.MethodDelete, "/api/sessions/work/messages", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	messages = nil
+	call(t, api, http.MethodGet, "/api/sessions/work", "", &messages)
+	if messages == nil || len(messages) != 0 {
+		t.Errorf("expected an empty session, got %+v", messages)
+	}
+
+	if status := call(t, api, http.MethodDelete, "/api/sessions/work", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	for _, path := range []string{"/api/sessions/work", "/api/sessions/work/messages"} {
+		if status := call(t, api, http.MethodGet, path, "", nil); status != http.StatusNotFound {
+			t.Errorf("expected status 404 for %s, got %d", path, status)
+		}
+	}
+	if status := call(t, api, http.MethodPost, "/api/sessions/work/chat", `{"content": "Hello"}`, nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for the chat of a deleted session, got %d", status)
+	}
+}
+
+func TestManagementChatStreaming(t *testing.T) {
+	api := server.NewManagementAPI(aicompaniontest.NewFakeCompanion("streamed answer"), nil)
+	call(t, api, http.MethodPost, "/api/sessions", `{"name": "live"}`, nil)
+
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/sessions/live/chat", strings.NewReader(`{"content": "Hi", "stream": true}`)))
+	body := recorder.Body.String()
+	if recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", recorder.Header().Get("Content-Type"))
+	}
+	if strings.Count(body, "event: delta\n") != 2 || !strings.Contains(body, "event: done\n") || !strings.Contains(body, `"content":"streamed answer"`) {
+		t.Errorf("expected two deltas and the answer as done event, got %q", body)
+	}
+
+	stored, _ := api.Store.Load("live")
+	if len(stored) != 2 {
+		t.Errorf("expected the streamed exchange to be saved, got %d messages", len(stored))
+	}
+}
+
+func TestManagementPersonas(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion()
+	api := server.NewManagementAPI(companion, nil)
+	active := companion.Config.ActivePersona.Name
+
+	if status := call(t, api, http.MethodPost, "/api/personas", `{"name": "pirate"}`, nil); status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	if status := call(t, api, http.MethodPut, "/api/personas/pirate", `{"prompt": {"system_prompt": "Talk like a pirate."}}`, nil); status != http.StatusOK {
+		t.Fatalf("expected status 200 for a replaced persona, got %d", status)
+	}
+
+	var persona models.Persona
+	call(t, api, http.MethodGet, "/api/personas/pirate", "", &persona)
+	if persona.Name != "pirate" || persona.Prompt.SystemPrompt != "Talk like a pirate." {
+		t.Errorf("unexpected persona %+v", persona)
+	}
+
+	if status := call(t, api, http.MethodPost, "/api/personas/pirate/activate", "", nil); status != http.StatusOK || companion.Config.ActivePersona.Name != "pirate" {
+		t.Fatalf("expected the persona to be activated, got status %d and %q", status, companion.Config.ActivePersona.Name)
+	}
+	if status := call(t, api, http.MethodDelete, "/api/personas/pirate", "", nil); status != http.StatusConflict {
+		t.Errorf("expected status 409 deleting the active persona, got %d", status)
+	}
+
+	call(t, api, http.MethodPost, "/api/personas/"+active+"/activate", "", nil)
+	if status := call(t, api, http.MethodDelete, "/api/personas/pirate", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	if status := call(t, api, http.MethodGet, "/api/personas/pirate", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", status)
+	}
+}
+
+func TestManagementDocuments(t *testing.T) {
+	vectorDb := aicompaniontest.NewFakeVectorDb()
+	api := server.NewManagementAPI(aicompaniontest.NewFakeCompanion(), vectorDb)
+
+	if status := call(t, api, http.MethodPost, "/api/schemas", `{"class_name": "notes", "vector": {"dimensions": 64}}`, nil); status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	for id, text := range map[string]string{"go": "Go is a programming language", "tea": "Green tea is a drink"} {
+		if status := call(t, api, http.MethodPost, "/api/schemas/notes/documents", `{"id": "`+id+`", "text": "`+text+`"}`, nil); status != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", status)
+		}
+	}
+	if status := call(t, api, http.MethodPost, "/api/schemas/notes/documents", `{"text": "no id"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 without id, got %d", status)
+	}
+
+	documents := vectorDb.Documents("notes")
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(documents))
+	}
+	for _, document := range documents {
+		if document.Content == "" || document.Metadata["text"] != nil || len(document.Embeddings) != aicompaniontest.DefaultDimensions {
+			t.Errorf("expected the embedded text as content, got %+v", document)
+		}
+	}
+
+	var document models.Document
+	call(t, api, http.MethodGet, "/api/schemas/notes/documents/go", "", &document)
+	if document.Content != "Go is a programming language" {
+		t.Errorf("unexpected document %+v", document)
+	}
+
+	var results []models.Document
+	call(t, api, http.MethodPost, "/api/schemas/notes/query", `{"text": "Go is a programming language", "options": {"limit": 1}}`, &results)
+	if len(results) == 0 || results[0].ID != "go" {
+		t.Errorf("expected the matching document first, got %+v", results)
+	}
+
+	if status := call(t, api, http.MethodDelete, "/api/schemas/notes/documents/go", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	if status := call(t, api, http.MethodGet, "/api/schemas/notes/documents/go", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", status)
+	}
+
+	if status := call(t, api, http.MethodPost, "/api/schemas", `{"name": "notes"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 without class_name, got %d", status)
+	}
+	if status := call(t, api, http.MethodDelete, "/api/schemas/notes", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	vectorDb.Err = errors.New("unavailable")
+	if status := call(t, api, http.MethodDelete, "/api/schemas/notes", "", nil); status != http.StatusInternalServerError {
+		t.Errorf("expected status 500 if the vector database fails, got %d", status)
+	}
+
+	if status := call(t, server.NewManagementAPI(aicompaniontest.NewFakeCompanion(), nil), http.MethodGet, "/api/schemas", "", nil); status != http.StatusNotImplemented {
+		t.Errorf("expected status 501 without vector database, got %d", status)
+	}
+}
+
+func TestManagementSchemas(t *testing.T) {
+	vectorDb, err := memvdb.NewMemoryVectorDb("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := server.NewManagementAPI(aicompaniontest.NewFakeCompanion(), vectorDb)
+
+	payload := `{"class_name": "notes", "properties": [{"name": "lang", "filterable": true}], "vector": {"dimensions": 3, "distance": "cosine"}}`
+	var schema models.Schema
+	if status := call(t, api, http.MethodPost, "/api/schemas", payload, &schema); status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	if schema.ClassName != "notes" || len(schema.Properties) != 1 || schema.Vector.Dimensions != 3 {
+		t.Errorf("expected the schema with its properties and vector configuration, got %+v", schema)
+	}
+	if stored, err := vectorDb.GetSchema(context.Background(), "notes"); err != nil || stored.Vector.Dimensions != 3 {
+		t.Errorf("expected the vector configuration to be stored, got %+v (%v)", stored, err)
+	}
+	if status := call(t, api, http.MethodPost, "/api/schemas", payload, nil); status != http.StatusConflict {
+		t.Errorf("expected status 409 for an existing schema, got %d", status)
+	}
+
+	if status := call(t, api, http.MethodDelete, "/api/schemas/notes", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	if status := call(t, api, http.MethodDelete, "/api/schemas/notes", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing schema, got %d", status)
+	}
+}
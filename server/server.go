@@ -0,0 +1,338 @@
+// Package server exposes a companion through an OpenAI compatible HTTP API, so that tools speaking the
+// OpenAI protocol (editors, chat UIs) can use any configured companion transparently.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghmer/aicompanion"
+	sidekick_interface "github.com/ghmer/aicompanion/interfaces/sidekick"
+	"github.com/ghmer/aicompanion/models"
+)
+
+var sideKick sidekick_interface.SideKickInterface = sidekick_interface.NewSideKick()
+
+// Server is an http.Handler serving /v1/chat/completions, /v1/embeddings and /v1/models.
+// Requests are routed to a companion by their model; a request without model goes to the companion
+// passed to NewServer.
+type Server struct {
+	fallback *servedCompanion
+	mux      *http.ServeMux
+	// mutex guards companions
+	mutex      sync.RWMutex
+	companions []*servedCompanion
+
+	// PrepareRequest turns the last incoming message into the request sent to the companion.
+	// It can be used to enrich messages, e.g. with retrieved knowledge. Defaults to passing the message through.
+	PrepareRequest func(message models.Message) (models.MessageRequest, error)
+}
+
+// servedCompanion is a companion served by a Server.
+type servedCompanion struct {
+	companion aicompanion.AICompanion
+	// mutex serializes the requests of the companion, as it keeps conversation state
+	mutex sync.Mutex
+}
+
+// NewServer creates a new Server backed by the given companion.
+func NewServer(companion aicompanion.AICompanion) *Server {
+	server := &Server{
+		fallback: &servedCompanion{companion: companion},
+		mux:      http.NewServeMux(),
+	}
+	server.companions = []*servedCompanion{server.fallback}
+
+	server.mux.HandleFunc("POST /v1/chat/completions", server.handleChatCompletions)
+	server.mux.HandleFunc("POST /v1/embeddings", server.handleEmbeddings)
+	server.mux.HandleFunc("GET /v1/models", server.handleModels)
+
+	return server
+}
+
+// AddCompanion serves another companion for requests naming its chat or embedding model. Requests of
+// different companions are answered concurrently.
+func (server *Server) AddCompanion(companion aicompanion.AICompanion) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.companions = append(server.companions, &servedCompanion{companion: companion})
+}
+
+// route returns the companion serving the model selected by selectModel, the default companion for
+// an empty model, or an error if no companion serves the model.
+func (server *Server) route(model string, selectModel func(config models.Configuration) string) (*servedCompanion, error) {
+	if model == "" {
+		return server.fallback, nil
+	}
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	for _, served := range server.companions {
+		if selectModel(served.companion.GetConfig()) == model {
+			return served, nil
+		}
+	}
+	return nil, fmt.Errorf("the model %s does not exist", model)
+}
+
+// chatModel selects the chat model of a configuration.
+func chatModel(config models.Configuration) string {
+	return config.AiModels.ChatModel.Model
+}
+
+// embeddingModel selects the embedding model of a configuration.
+func embeddingModel(config models.Configuration) string {
+	return config.AiModels.EmbeddingModel.Model
+}
+
+// ServeHTTP implements http.Handler.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe starts serving on the given address.
+func (server *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, server)
+}
+
+// handleChatCompletions answers chat completion requests, streaming them as server-sent events if requested.
+func (server *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if len(request.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("messages must not be empty"))
+		return
+	}
+
+	// the client sends the whole history; split it into system prompt, history and the new message
+	var systemPrompt string
+	var history []models.Message
+	for _, message := range request.Messages[:len(request.Messages)-1] {
+		if message.Role == models.System || message.Role == models.Developer {
+			systemPrompt = message.Content
+			continue
+		}
+		history = append(history, message)
+	}
+	last := request.Messages[len(request.Messages)-1]
+
+	served, err := server.route(request.Model, chatModel)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	companion := served.companion
+
+	messageRequest := models.MessageRequest{Message: last}
+	if server.PrepareRequest != nil {
+		messageRequest, err = server.PrepareRequest(last)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// options set by PrepareRequest take precedence over those of the client
+	options := request.options().Merge(messageRequest.Options)
+	messageRequest.Options = &options
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	model := companion.GetConfig().AiModels.ChatModel.Model
+
+	served.mutex.Lock()
+	defer served.mutex.Unlock()
+	restore := swapState(companion, systemPrompt, history)
+	defer restore()
+
+	if !request.Stream {
+		result, err := companion.SendChatRequest(r.Context(), messageRequest, false, nil)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, ChatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion",
+			Created: created,
+			Model:   model,
+			Choices: []ChatCompletionChoice{{
+				Index:        0,
+				Message:      &ChatCompletionMessage{Role: models.Assistant, Content: result.Content},
+				FinishReason: finishReason(result.FinishReason),
+			}},
+		})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	chunk := func(delta ChatCompletionMessage, finishReason string) ChatCompletionResponse {
+		return ChatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []ChatCompletionChoice{{Index: 0, Delta: &delta, FinishReason: finishReason}},
+		}
+	}
+
+	writeEvent(w, chunk(ChatCompletionMessage{Role: models.Assistant}, ""))
+	flusher.Flush()
+
+	result, err := companion.SendChatRequest(r.Context(), messageRequest, true, func(m models.Message) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		if m.Content == "" {
+			return nil
+		}
+		writeEvent(w, chunk(ChatCompletionMessage{Content: m.Content}, ""))
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		sideKick.Error(err)
+		fmt.Fprintf(w, "data: %s\n\n", mustMarshal(ErrorResponse{Error: ErrorDetail{Message: err.Error(), Type: "server_error"}}))
+		flusher.Flush()
+		return
+	}
+
+	writeEvent(w, chunk(ChatCompletionMessage{}, finishReason(result.FinishReason)))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// finishReason returns the finish reason reported to clients, "stop" if the provider reported none.
+func finishReason(reason models.FinishReason) string {
+	if reason == "" {
+		return string(models.FinishStop)
+	}
+	return string(reason)
+}
+
+// swapState replaces the conversation and system role of the companion for a single request
+// and returns a function restoring the previous state.
+func swapState(companion aicompanion.AICompanion, systemPrompt string, history []models.Message) func() {
+	conversation := companion.GetConversation()
+	systemRole := companion.GetSystemRole()
+
+	companion.SetConversation(history)
+	if systemPrompt != "" {
+		companion.SetSystemRole(systemPrompt)
+	}
+
+	return func() {
+		companion.SetConversation(conversation)
+		companion.SetSystemRole(systemRole.Content)
+	}
+}
+
+// handleEmbeddings answers embedding requests.
+func (server *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var request EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	input, err := request.Inputs()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	served, err := server.route(request.Model, embeddingModel)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	served.mutex.Lock()
+	model := served.companion.GetConfig().AiModels.EmbeddingModel
+	response, err := served.companion.SendEmbeddingRequest(r.Context(), sideKick.CreateEmbeddingRequest(model, input))
+	served.mutex.Unlock()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	result := EmbeddingResponse{Object: "list", Model: response.Model}
+	for i, embedding := range response.Embeddings {
+		result.Data = append(result.Data, EmbeddingData{Object: "embedding", Embedding: embedding, Index: i})
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleModels lists the chat and embedding models served, which requests may name as model.
+func (server *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	result := ModelList{Object: "list", Data: []ModelData{}}
+	listed := make(map[string]bool)
+	for _, served := range server.companions {
+		config := served.companion.GetConfig()
+		for _, model := range []string{chatModel(config), embeddingModel(config)} {
+			if model == "" || listed[model] {
+				continue
+			}
+			listed[model] = true
+			result.Data = append(result.Data, ModelData{ID: model, Object: "model", OwnedBy: "aicompanion"})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeJSON writes payload as JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		sideKick.Error(err)
+	}
+}
+
+// writeError writes an OpenAI style error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	errorType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errorType = "server_error"
+	}
+	writeJSON(w, status, ErrorResponse{Error: ErrorDetail{Message: err.Error(), Type: errorType}})
+}
+
+// writeEvent writes payload as a server-sent event.
+func writeEvent(w http.ResponseWriter, payload any) {
+	fmt.Fprintf(w, "data: %s\n\n", mustMarshal(payload))
+}
+
+// mustMarshal marshals payload, falling back to an empty object on error.
+func mustMarshal(payload any) string {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		sideKick.Error(err)
+		return "{}"
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,254 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/server"
+)
+
+// post sends payload as JSON to path and decodes the JSON response into result.
+func post(t *testing.T, handler http.Handler, path string, payload string, result any) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload)))
+	if result != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+			t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestChatCompletions(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("Hello there")
+	companion.SetSystemRole("original prompt")
+	handler := server.NewServer(companion)
+
+	var response server.ChatCompletionResponse
+	status := post(t, handler, "/v1/chat/completions", `{
+		"model": "fake-chat",
+		"temperature": 0.2,
+		"max_tokens": 64,
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Hi"},
+			{"role": "assistant", "content": "Hi!"},
+			{"role": "user", "content": "How are you?"}
+		]
+	}`, &response)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if response.Object != "chat.completion" || response.Model != "fake-chat" || len(response.Choices) != 1 || response.Choices[0].Message.Content != "Hello there" {
+		t.Fatalf("unexpected response %+v", response)
+	}
+
+	request, _ := companion.LastRequest()
+	if request.Message.Content != "How are you?" {
+		t.Errorf("expected the last message to be sent, got %q", request.Message.Content)
+	}
+	if request.Options == nil || request.Options.Temperature == nil || *request.Options.Temperature != 0.2 || request.Options.MaxTokens != 64 {
+		t.Errorf("expected temperature and max_tokens as options, got %+v", request.Options)
+	}
+	if len(companion.GetConversation()) != 0 || companion.GetSystemRole().Content != "original prompt" {
+		t.Errorf("expected the state of the companion to be restored, got %d messages and %q", len(companion.GetConversation()), companion.GetSystemRole().Content)
+	}
+}
+
+func TestChatCompletionsInvalid(t *testing.T) {
+	handler := server.NewServer(aicompaniontest.NewFakeCompanion())
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"invalid body", `{`},
+		{"no messages", `{"messages": []}`},
+		{"unknown model", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var response server.ErrorResponse
+			if status := post(t, handler, "/v1/chat/completions", test.payload, &response); status != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", status)
+			}
+			if response.Error.Type != "invalid_request_error" || response.Error.Message == "" {
+				t.Errorf("unexpected error %+v", response.Error)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStreaming(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion("Hello there, friend")
+	httpServer := httptest.NewServer(server.NewServer(companion))
+	defer httpServer.Close()
+
+	resp, err := http.Post(httpServer.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"stream": true, "messages": [{"role": "user", "content": "Hi"}]}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	var chunks []server.ChatCompletionResponse
+	var done bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk server.ChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if !done || len(chunks) < 3 {
+		t.Fatalf("expected a role, content and stop chunk followed by [DONE], got %d chunks", len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Role != models.Assistant {
+		t.Errorf("expected the first chunk to carry the role, got %+v", chunks[0].Choices[0].Delta)
+	}
+	var content strings.Builder
+	for _, chunk := range chunks[1 : len(chunks)-1] {
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("unexpected object %q", chunk.Object)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if content.String() != "Hello there, friend" {
+		t.Errorf("expected the streamed answer, got %q", content.String())
+	}
+	if chunks[len(chunks)-1].Choices[0].FinishReason != "stop" {
+		t.Errorf("expected the last chunk to finish with stop, got %+v", chunks[len(chunks)-1].Choices[0])
+	}
+}
+
+// truncatedCompanion answers like its fake, but reports that the answer hit the token limit.
+type truncatedCompanion struct {
+	*aicompaniontest.FakeCompanion
+}
+
+func (companion truncatedCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	result, err := companion.FakeCompanion.SendChatRequest(ctx, message, streaming, callback)
+	result.FinishReason = models.FinishLength
+	return result, err
+}
+
+func TestChatCompletionsFinishReason(t *testing.T) {
+	handler := server.NewServer(truncatedCompanion{aicompaniontest.NewFakeCompanion("Once upon a")})
+
+	var response server.ChatCompletionResponse
+	if status := post(t, handler, "/v1/chat/completions", `{"messages": [{"role": "user", "content": "Tell a story"}]}`, &response); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if response.Choices[0].FinishReason != "length" {
+		t.Errorf("expected the finish reason of the companion, got %q", response.Choices[0].FinishReason)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"stream": true, "messages": [{"role": "user", "content": "Tell a story"}]}`)))
+	if !strings.Contains(recorder.Body.String(), `"finish_reason":"length"`) {
+		t.Errorf("expected the last chunk to finish with length, got %q", recorder.Body.String())
+	}
+}
+
+func TestChatCompletionsRouting(t *testing.T) {
+	primary := aicompaniontest.NewFakeCompanion("primary")
+	secondary := aicompaniontest.NewFakeCompanion("secondary")
+	secondary.Config.AiModels.ChatModel.Model = "other-chat"
+	secondary.Config.AiModels.EmbeddingModel.Model = "other-embed"
+	handler := server.NewServer(primary)
+	handler.AddCompanion(secondary)
+
+	for model, expected := range map[string]string{"": "primary", "fake-chat": "primary", "other-chat": "secondary"} {
+		var response server.ChatCompletionResponse
+		post(t, handler, "/v1/chat/completions", `{"model": "`+model+`", "messages": [{"role": "user", "content": "Hi"}]}`, &response)
+		if len(response.Choices) != 1 || response.Choices[0].Message.Content != expected {
+			t.Errorf("expected model %q to be answered by %s, got %+v", model, expected, response)
+		}
+	}
+
+	var list server.ModelList
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	var ids []string
+	for _, model := range list.Data {
+		ids = append(ids, model.ID)
+	}
+	if list.Object != "list" || strings.Join(ids, ",") != "fake-chat,fake-embed,other-chat,other-embed" {
+		t.Errorf("expected the served models, got %v", ids)
+	}
+}
+
+func TestChatCompletionsConcurrent(t *testing.T) {
+	companion := aicompaniontest.NewFakeCompanion()
+	companion.Respond = func(message models.Message) (string, error) {
+		return "echo: " + message.Content, nil
+	}
+	handler := server.NewServer(companion)
+
+	var wait sync.WaitGroup
+	for i := range 10 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			content := strings.Repeat("x", i+1)
+			var response server.ChatCompletionResponse
+			post(t, handler, "/v1/chat/completions", `{"messages": [{"role": "user", "content": "`+content+`"}]}`, &response)
+			if len(response.Choices) != 1 || response.Choices[0].Message.Content != "echo: "+content {
+				t.Errorf("unexpected response %+v", response)
+			}
+		}()
+	}
+	wait.Wait()
+
+	if len(companion.GetConversation()) != 0 {
+		t.Errorf("expected the conversation to be restored, got %d messages", len(companion.GetConversation()))
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	handler := server.NewServer(aicompaniontest.NewFakeCompanion())
+
+	var response server.EmbeddingResponse
+	if status := post(t, handler, "/v1/embeddings", `{"model": "fake-embed", "input": ["first", "second"]}`, &response); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if response.Object != "list" || len(response.Data) != 2 || response.Data[1].Index != 1 || len(response.Data[0].Embedding) != aicompaniontest.DefaultDimensions {
+		t.Fatalf("unexpected response %+v", response)
+	}
+
+	response = server.EmbeddingResponse{}
+	post(t, handler, "/v1/embeddings", `{"input": "single"}`, &response)
+	if len(response.Data) != 1 {
+		t.Errorf("expected a single embedding, got %d", len(response.Data))
+	}
+
+	for _, payload := range []string{`{"input": 42}`, `{"model": "text-embedding-3-small", "input": "x"}`} {
+		if status := post(t, handler, "/v1/embeddings", payload, nil); status != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", payload, status)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Request and response structs of the OpenAI compatible endpoints
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ChatCompletionRequest represents the request payload of /v1/chat/completions.
+type ChatCompletionRequest struct {
+	Model       string           `json:"model"`
+	Messages    []models.Message `json:"messages"`
+	Stream      bool             `json:"stream,omitempty"`
+	Temperature *float32         `json:"temperature,omitempty"`
+	MaxTokens   int              `json:"max_tokens,omitempty"`
+}
+
+// options returns the generation options set by the request, which override those of the companion.
+func (request ChatCompletionRequest) options() models.GenerationOptions {
+	return models.GenerationOptions{Temperature: request.Temperature, MaxTokens: request.MaxTokens}
+}
+
+// ChatCompletionMessage represents a message or a streamed delta in a chat completion response.
+type ChatCompletionMessage struct {
+	Role    models.Role `json:"role,omitempty"`
+	Content string      `json:"content"`
+}
+
+// ChatCompletionChoice represents a single choice of a chat completion response.
+type ChatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *ChatCompletionMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionMessage `json:"delta,omitempty"`
+	FinishReason string                 `json:"finish_reason,omitempty"`
+}
+
+// ChatCompletionResponse represents a chat completion response or a streamed chunk.
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+}
+
+// EmbeddingRequest represents the request payload of /v1/embeddings.
+type EmbeddingRequest struct {
+	Model string          `json:"model"`
+	Input json.RawMessage `json:"input"`
+}
+
+// Inputs returns the input of the request, which may be a single string or a list of strings.
+func (request EmbeddingRequest) Inputs() ([]string, error) {
+	var single string
+	if err := json.Unmarshal(request.Input, &single); err == nil {
+		return []string{single}, nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(request.Input, &multiple); err != nil {
+		return nil, errors.New("input must be a string or a list of strings")
+	}
+	return multiple, nil
+}
+
+// EmbeddingData represents a single embedding in an embedding response.
+type EmbeddingData struct {
+	Object    string    `json:"object"`
+	Embedding []float32 `json:"embedding"`
+	Index     int       `json:"index"`
+}
+
+// EmbeddingResponse represents the response of /v1/embeddings.
+type EmbeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+}
+
+// ModelData represents a single model in the model list.
+type ModelData struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelList represents the response of /v1/models.
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelData `json:"data"`
+}
+
+// ErrorResponse represents an OpenAI style error.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail holds the details of an error.
+type ErrorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
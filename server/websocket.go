@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/coder/websocket"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+// FrameType identifies the kind of a websocket frame.
+type FrameType string
+
+const (
+	// frames sent by the client
+	FrameMessage   FrameType = "message"   // a user message to answer
+	FrameInterrupt FrameType = "interrupt" // cancels the answer currently streamed
+	FrameReset     FrameType = "reset"     // clears the conversation of the connection
+
+	// frames sent by the server
+	FrameTyping   FrameType = "typing"    // the assistant started working on an answer
+	FrameDelta    FrameType = "delta"     // a streamed part of the answer
+	FrameToolCall FrameType = "tool_call" // the model requested tool calls
+	FrameDone     FrameType = "done"      // the answer is complete
+	FrameError    FrameType = "error"     // the request failed
+)
+
+// DefaultQueueSize is the number of frames a connection queues while an answer is streamed, unless
+// WebSocketHandler.QueueSize is set.
+const DefaultQueueSize = 8
+
+// Frame is the JSON payload exchanged over the websocket in both directions.
+type Frame struct {
+	Type      FrameType             `json:"type"`
+	Content   string                `json:"content,omitempty"`
+	Images    *[]models.Base64Image `json:"images,omitempty"`
+	ToolCalls []models.ToolCall     `json:"tool_calls,omitempty"`
+	Message   *models.Message       `json:"message,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+// WebSocketHandler streams chat answers over a websocket. Each connection has its own companion, which
+// keeps the conversation of the connection, so connections are answered concurrently.
+type WebSocketHandler struct {
+	newCompanion func() (aicompanion.AICompanion, error)
+
+	// AcceptOptions are passed to the websocket handshake, e.g. to configure allowed origins.
+	AcceptOptions *websocket.AcceptOptions
+	// QueueSize bounds the message and reset frames queued while an answer is streamed, defaults to
+	// DefaultQueueSize. Frames exceeding it are rejected with an error frame.
+	QueueSize int
+}
+
+// NewWebSocketHandler creates a new WebSocketHandler creating the companion of each connection with
+// newCompanion, e.g. by calling aicompanion.NewCompanion with a shared configuration.
+func NewWebSocketHandler(newCompanion func() (aicompanion.AICompanion, error)) *WebSocketHandler {
+	return &WebSocketHandler{newCompanion: newCompanion}
+}
+
+// ServeHTTP upgrades the connection and processes frames until the client disconnects.
+func (handler *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, handler.AcceptOptions)
+	if err != nil {
+		sideKick.Error(err)
+		return
+	}
+	defer conn.CloseNow()
+
+	companion, err := handler.newCompanion()
+	if err != nil {
+		sideKick.Error(err)
+		conn.Close(websocket.StatusInternalError, "failed to create companion")
+		return
+	}
+
+	queueSize := handler.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	session := &webSocketSession{companion: companion, conn: conn, messages: make(chan Frame, queueSize)}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go session.read(ctx, cancel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+		case frame := <-session.messages:
+			session.answer(ctx, frame)
+		}
+	}
+}
+
+// webSocketSession holds the state of a single connection. Its frames are answered one at a time.
+type webSocketSession struct {
+	companion aicompanion.AICompanion
+	conn      *websocket.Conn
+	messages  chan Frame
+
+	// mutex guards interrupt, which cancels the answer currently being streamed
+	mutex     sync.Mutex
+	interrupt context.CancelFunc
+	// writeMutex serializes writes to the connection
+	writeMutex sync.Mutex
+}
+
+// read processes incoming frames. Interrupts are handled immediately, messages are queued for answering,
+// so that reading goes on while an answer is streamed.
+func (session *webSocketSession) read(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+
+	for {
+		_, data, err := session.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		var frame Frame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			session.write(ctx, Frame{Type: FrameError, Error: "invalid frame: " + err.Error()})
+			continue
+		}
+
+		switch frame.Type {
+		case FrameInterrupt:
+			session.mutex.Lock()
+			if session.interrupt != nil {
+				session.interrupt()
+			}
+			session.mutex.Unlock()
+		case FrameMessage, FrameReset:
+			select {
+			case session.messages <- frame:
+			default:
+				session.write(ctx, Frame{Type: FrameError, Error: "too many queued messages"})
+			}
+		default:
+			session.write(ctx, Frame{Type: FrameError, Error: "unsupported frame type: " + string(frame.Type)})
+		}
+	}
+}
+
+// answer streams the answer to a message frame back to the client.
+func (session *webSocketSession) answer(ctx context.Context, frame Frame) {
+	if frame.Type == FrameReset {
+		session.companion.SetConversation(nil)
+		return
+	}
+
+	turnCtx, cancel := context.WithCancel(ctx)
+	session.mutex.Lock()
+	session.interrupt = cancel
+	session.mutex.Unlock()
+	defer func() {
+		session.mutex.Lock()
+		session.interrupt = nil
+		session.mutex.Unlock()
+		cancel()
+	}()
+
+	session.write(ctx, Frame{Type: FrameTyping})
+
+	request := models.MessageRequest{Message: sideKick.CreateUserMessage(frame.Content, frame.Images)}
+	result, err := session.companion.SendChatRequest(turnCtx, request, true, func(m models.Message) error {
+		if err := turnCtx.Err(); err != nil {
+			return err
+		}
+		if len(m.ToolCalls) > 0 {
+			session.write(ctx, Frame{Type: FrameToolCall, ToolCalls: m.ToolCalls})
+		}
+		if m.Content != "" {
+			return session.write(ctx, Frame{Type: FrameDelta, Content: m.Content})
+		}
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			session.write(ctx, Frame{Type: FrameError, Error: "interrupted"})
+			return
+		}
+		session.write(ctx, Frame{Type: FrameError, Error: err.Error()})
+		return
+	}
+
+	if len(result.ToolCalls) > 0 {
+		session.write(ctx, Frame{Type: FrameToolCall, ToolCalls: result.ToolCalls})
+	}
+	session.write(ctx, Frame{Type: FrameDone, Message: &result})
+}
+
+// write sends a frame to the client.
+func (session *webSocketSession) write(ctx context.Context, frame Frame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	session.writeMutex.Lock()
+	defer session.writeMutex.Unlock()
+	return session.conn.Write(ctx, websocket.MessageText, data)
+}
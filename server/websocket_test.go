@@ -0,0 +1,175 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/server"
+)
+
+// blockingCompanion streams a tool call and a first chunk, then waits until the request is cancelled.
+type blockingCompanion struct {
+	*aicompaniontest.FakeCompanion
+}
+
+func (companion blockingCompanion) SendChatRequest(ctx context.Context, message models.MessageRequest, streaming bool, callback func(m models.Message) error) (models.Message, error) {
+	callback(models.Message{Role: models.Assistant, ToolCalls: []models.ToolCall{{ID: "call-1", Payload: models.FunctionPayload{FunctionName: "lookup"}}}})
+	callback(models.Message{Role: models.Assistant, Content: "Let me check"})
+	<-ctx.Done()
+	return models.Message{}, ctx.Err()
+}
+
+// dial connects to the websocket handler served by server.
+func dial(t *testing.T, ctx context.Context, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return conn
+}
+
+// receive reads frames until a frame of one of the given types arrives and returns the frames read.
+func receive(t *testing.T, ctx context.Context, conn *websocket.Conn, until ...server.FrameType) []server.Frame {
+	t.Helper()
+	var frames []server.Frame
+	for {
+		var frame server.Frame
+		if err := wsjson.Read(ctx, conn, &frame); err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		frames = append(frames, frame)
+		for _, frameType := range until {
+			if frame.Type == frameType {
+				return frames
+			}
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the answers count the messages of the conversation of the connection
+	httpServer := httptest.NewServer(server.NewWebSocketHandler(func() (aicompanion.AICompanion, error) {
+		companion := aicompaniontest.NewFakeCompanion()
+		companion.Respond = func(message models.Message) (string, error) {
+			return fmt.Sprintf("%d messages before %s", len(companion.Conversation), message.Content), nil
+		}
+		return companion, nil
+	}))
+	defer httpServer.Close()
+	conn := dial(t, ctx, httpServer)
+
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameMessage, Content: "one"})
+	frames := receive(t, ctx, conn, server.FrameDone, server.FrameError)
+	if frames[0].Type != server.FrameTyping {
+		t.Errorf("expected a typing frame first, got %s", frames[0].Type)
+	}
+	var streamed strings.Builder
+	for _, frame := range frames[1 : len(frames)-1] {
+		if frame.Type != server.FrameDelta {
+			t.Fatalf("expected delta frames, got %s", frame.Type)
+		}
+		streamed.WriteString(frame.Content)
+	}
+	done := frames[len(frames)-1]
+	if done.Type != server.FrameDone || done.Message == nil || done.Message.Content != "0 messages before one" || streamed.String() != done.Message.Content {
+		t.Fatalf("expected the streamed answer in the done frame, got %+v after %q", done, streamed.String())
+	}
+
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameMessage, Content: "two"})
+	if done := receive(t, ctx, conn, server.FrameDone); done[len(done)-1].Message.Content != "2 messages before two" {
+		t.Errorf("expected the conversation to be kept, got %q", done[len(done)-1].Message.Content)
+	}
+
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameReset})
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameMessage, Content: "three"})
+	if done := receive(t, ctx, conn, server.FrameDone); done[len(done)-1].Message.Content != "0 messages before three" {
+		t.Errorf("expected the conversation to be reset, got %q", done[len(done)-1].Message.Content)
+	}
+
+	wsjson.Write(ctx, conn, server.Frame{Type: "unknown"})
+	if frames := receive(t, ctx, conn, server.FrameError); !strings.Contains(frames[len(frames)-1].Error, "unsupported frame type") {
+		t.Errorf("unexpected error %q", frames[len(frames)-1].Error)
+	}
+}
+
+func TestWebSocketInterrupt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the first connection blocks until interrupted, the others answer at once
+	connections := make(chan int, 2)
+	connections <- 0
+	connections <- 1
+	httpServer := httptest.NewServer(server.NewWebSocketHandler(func() (aicompanion.AICompanion, error) {
+		if <-connections == 0 {
+			return blockingCompanion{aicompaniontest.NewFakeCompanion()}, nil
+		}
+		return aicompaniontest.NewFakeCompanion("fast answer"), nil
+	}))
+	defer httpServer.Close()
+
+	slow := dial(t, ctx, httpServer)
+	wsjson.Write(ctx, slow, server.Frame{Type: server.FrameMessage, Content: "look it up"})
+	frames := receive(t, ctx, slow, server.FrameDelta)
+	if len(frames) != 3 || frames[1].Type != server.FrameToolCall || len(frames[1].ToolCalls) != 1 || frames[1].ToolCalls[0].Payload.FunctionName != "lookup" {
+		t.Fatalf("expected typing, tool_call and delta frames, got %+v", frames)
+	}
+
+	// another connection is answered while the first one is still streaming
+	fast := dial(t, ctx, httpServer)
+	wsjson.Write(ctx, fast, server.Frame{Type: server.FrameMessage, Content: "hello"})
+	if frames := receive(t, ctx, fast, server.FrameDone, server.FrameError); frames[len(frames)-1].Type != server.FrameDone {
+		t.Fatalf("expected the other connection to be answered, got %+v", frames[len(frames)-1])
+	}
+
+	wsjson.Write(ctx, slow, server.Frame{Type: server.FrameInterrupt})
+	frames = receive(t, ctx, slow, server.FrameDone, server.FrameError)
+	if last := frames[len(frames)-1]; last.Type != server.FrameError || last.Error != "interrupted" {
+		t.Errorf("expected the answer to be interrupted, got %+v", last)
+	}
+}
+
+func TestWebSocketQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	handler := server.NewWebSocketHandler(func() (aicompanion.AICompanion, error) {
+		return blockingCompanion{aicompaniontest.NewFakeCompanion()}, nil
+	})
+	handler.QueueSize = 1
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	conn := dial(t, ctx, httpServer)
+
+	// the interrupt is read while the first answer streams and the second message waits in the queue
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameMessage, Content: "one"})
+	receive(t, ctx, conn, server.FrameDelta)
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameMessage, Content: "two"})
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameMessage, Content: "three"})
+	if frames := receive(t, ctx, conn, server.FrameError); frames[len(frames)-1].Error != "too many queued messages" {
+		t.Errorf("expected the message exceeding the queue to be rejected, got %+v", frames[len(frames)-1])
+	}
+	wsjson.Write(ctx, conn, server.Frame{Type: server.FrameInterrupt})
+	if frames := receive(t, ctx, conn, server.FrameError); frames[len(frames)-1].Error != "interrupted" {
+		t.Errorf("expected the first answer to be interrupted, got %+v", frames[len(frames)-1])
+	}
+
+	if frames := receive(t, ctx, conn, server.FrameDelta); frames[0].Type != server.FrameTyping {
+		t.Errorf("expected the queued message to be answered next, got %+v", frames)
+	}
+}
@@ -0,0 +1,84 @@
+package aicompanion
+
+import (
+	"context"
+	"io"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// StreamFunc sends a streaming request, passing each chunk of the response to callback.
+type StreamFunc func(ctx context.Context, callback func(m models.Message) error) (models.Message, error)
+
+// StreamReader exposes the content streamed by a request as io.Reader, so it can be copied into renderers,
+// files or HTTP response writers. The request runs in the background and only proceeds as the content is
+// read. Reading returns io.EOF once the response is complete, or the error of the request if it failed.
+type StreamReader struct {
+	reader *io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	result models.Message
+	err    error
+}
+
+// NewStreamReader starts send and returns a reader of the content it streams. The request is cancelled
+// with ctx or by closing the reader.
+func NewStreamReader(ctx context.Context, send StreamFunc) *StreamReader {
+	ctx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	stream := &StreamReader{reader: reader, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(stream.done)
+		defer cancel()
+		result, err := send(ctx, func(m models.Message) error {
+			if m.Content == "" {
+				return nil
+			}
+			_, err := io.WriteString(writer, m.Content)
+			return err
+		})
+		stream.result, stream.err = result, err
+		// a nil error lets the reader return io.EOF
+		writer.CloseWithError(err)
+	}()
+
+	return stream
+}
+
+// StreamChat sends message as streaming chat request and returns a reader of the answer. Like any chat
+// request, the exchange is added to the conversation of the companion.
+func StreamChat(ctx context.Context, companion AICompanion, message models.MessageRequest) *StreamReader {
+	return NewStreamReader(ctx, func(ctx context.Context, callback func(m models.Message) error) (models.Message, error) {
+		return companion.SendChatRequest(ctx, message, true, callback)
+	})
+}
+
+// StreamGenerate sends message as streaming generate request and returns a reader of the answer.
+func StreamGenerate(ctx context.Context, companion AICompanion, message models.MessageRequest) *StreamReader {
+	return NewStreamReader(ctx, func(ctx context.Context, callback func(m models.Message) error) (models.Message, error) {
+		return companion.SendGenerateRequest(ctx, message, true, callback)
+	})
+}
+
+// Read implements io.Reader.
+func (stream *StreamReader) Read(p []byte) (int, error) {
+	return stream.reader.Read(p)
+}
+
+// Close cancels the request, unless it is complete, and waits for it to return.
+func (stream *StreamReader) Close() error {
+	stream.cancel()
+	stream.reader.Close()
+	<-stream.done
+	return nil
+}
+
+// Result waits for the request and returns the complete response message and the error of the request.
+// The request only completes once the content is read to the end or the reader is closed; if it was
+// cancelled, the message holds the answer received until then and has Cancelled set.
+func (stream *StreamReader) Result() (models.Message, error) {
+	<-stream.done
+	return stream.result, stream.err
+}
@@ -0,0 +1,66 @@
+package aicompanion_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/aicompaniontest"
+	"github.com/ghmer/aicompanion/models"
+)
+
+func TestStreamReader(t *testing.T) {
+	t.Run("Test reading the answer", func(t *testing.T) {
+		companion := aicompaniontest.NewFakeCompanion("streamed into a reader")
+		stream := aicompanion.StreamChat(context.Background(), companion, models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}})
+		defer stream.Close()
+
+		var builder strings.Builder
+		if _, err := io.Copy(&builder, stream); err != nil {
+			t.Fatalf("copy failed: %v", err)
+		}
+		if builder.String() != "streamed into a reader" {
+			t.Errorf("unexpected content %q", builder.String())
+		}
+
+		result, err := stream.Result()
+		if err != nil || result.Content != builder.String() {
+			t.Errorf("unexpected result %q: %v", result.Content, err)
+		}
+		if len(companion.GetConversation()) != 2 {
+			t.Errorf("expected the exchange in the conversation, got %d messages", len(companion.GetConversation()))
+		}
+	})
+
+	t.Run("Test request errors", func(t *testing.T) {
+		companion := aicompaniontest.NewFakeCompanion()
+		companion.Err = errors.New("unavailable")
+		stream := aicompanion.StreamGenerate(context.Background(), companion, models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}})
+		defer stream.Close()
+
+		if _, err := io.ReadAll(stream); err == nil || err.Error() != "unavailable" {
+			t.Errorf("expected the error of the request, got %v", err)
+		}
+	})
+
+	t.Run("Test closing early", func(t *testing.T) {
+		companion := aicompaniontest.NewFakeCompanion("one two three four")
+		stream := aicompanion.StreamChat(context.Background(), companion, models.MessageRequest{Message: models.Message{Role: models.User, Content: "Hi"}})
+
+		buffer := make([]byte, 3)
+		if _, err := io.ReadFull(stream, buffer); err != nil || string(buffer) != "one" {
+			t.Fatalf("unexpected first read %q: %v", buffer, err)
+		}
+		stream.Close()
+
+		if result, err := stream.Result(); err == nil || !result.Cancelled || !strings.HasPrefix(result.Content, "one") {
+			t.Errorf("expected the closed request to fail with the partial answer, got %+v: %v", result, err)
+		}
+		if _, err := stream.Read(buffer); !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("expected io.ErrClosedPipe after closing, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package aicompanion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+// RepairPrompt asks the model to correct an answer that is no valid JSON of the schema. It is filled
+// with the problem, the schema and the invalid answer.
+const RepairPrompt = "Your previous answer was invalid: %s. Answer again with only a JSON object matching this schema: %s\n\nYour previous answer was:\n%s"
+
+// ErrInvalidOutput is returned when the model fails to answer with valid structured output.
+var ErrInvalidOutput = errors.New("invalid structured output")
+
+// SendStructuredRequest sends message as chat request that demands a JSON answer matching the schema of
+// the struct T, see tools.Schema, and decodes the answer into T. The answer is validated against the
+// schema; an invalid answer is removed from the conversation and the request is repeated up to retries
+// times with a repair prompt, which quotes the problem and the invalid answer. If the message sets a
+// response format, it is sent instead of the schema of T, for example to request strict schemas.
+func SendStructuredRequest[T any](ctx context.Context, companion AICompanion, message models.MessageRequest, retries int) (T, error) {
+	var result T
+	schema, err := tools.Schema[T]()
+	if err != nil {
+		return result, err
+	}
+	definition := models.FunctionDefinition{FunctionName: schemaName[T](), Parameters: schema}
+	if message.ResponseFormat == nil {
+		message.ResponseFormat = &models.ResponseFormat{
+			Type:   models.JSONSchema,
+			Name:   definition.FunctionName,
+			Schema: &models.Parameter{Type: string(schema.Type), Properties: schema.Properties, Required: schema.Required},
+		}
+	}
+
+	request := message
+	for attempt := 0; ; attempt++ {
+		response, err := companion.SendChatRequest(ctx, request, false, nil)
+		if err != nil {
+			return result, err
+		}
+
+		content := unfence(response.Content)
+		err = decodeStructured(content, definition, &result)
+		if err == nil {
+			return result, nil
+		}
+		companion.RemoveLastExchange()
+		if attempt >= retries {
+			return result, fmt.Errorf("%w after %d attempts: %w", ErrInvalidOutput, attempt+1, err)
+		}
+
+		schemaBytes, _ := json.Marshal(schema)
+		request = message
+		if !request.RetainOriginalMessage {
+			request.OriginalMessage = message.Message
+			request.RetainOriginalMessage = true
+		}
+		request.Message.Content = message.Message.Content + "\n\n" + fmt.Sprintf(RepairPrompt, err, schemaBytes, content)
+	}
+}
+
+// decodeStructured validates the JSON content against the schema of definition and decodes it into v.
+func decodeStructured(content string, definition models.FunctionDefinition, v any) error {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(content), &object); err != nil {
+		return fmt.Errorf("no JSON object: %w", err)
+	}
+	var invalid *tools.ValidationError
+	if err := tools.Validate(definition, object); errors.As(err, &invalid) {
+		return fmt.Errorf("does not match the schema: %s", strings.Join(invalid.Problems, "; "))
+	}
+	if err := json.Unmarshal([]byte(content), v); err != nil {
+		return fmt.Errorf("does not match the schema: %w", err)
+	}
+	return nil
+}
+
+// unfence returns the content of a Markdown code block, which models like to wrap JSON in, and content
+// unchanged otherwise.
+func unfence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") || !strings.HasSuffix(content, "```") || len(content) < 6 {
+		return content
+	}
+	content = strings.TrimSuffix(content, "```")
+	if _, code, found := strings.Cut(content, "\n"); found {
+		return strings.TrimSpace(code)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(content, "```"))
+}
+
+// schemaName names the schema of T by its type, keeping only the characters OpenAI accepts in names.
+func schemaName[T any]() string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, reflect.TypeFor[T]().Name())
+	if name == "" {
+		return "response"
+	}
+	return name
+}
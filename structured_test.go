@@ -0,0 +1,106 @@
+package aicompanion_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion"
+	"github.com/ghmer/aicompanion/models"
+)
+
+type person struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestSendStructuredRequest(t *testing.T) {
+	answers := []string{"Sure! The person is Ada.", "```json\n{\"name\":\"Ada\",\"age\":36}\n```"}
+	var payloads []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+		answer := answers[min(len(payloads), len(answers))-1]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, answer)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.OpenAI, "sk-test", "gpt-4o", "gpt-4o", "")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Who wrote the first program?"}}
+
+	result, err := aicompanion.SendStructuredRequest[person](context.Background(), companion, request, 1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if result != (person{Name: "Ada", Age: 36}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("expected a repaired request, got %d requests", len(payloads))
+	}
+
+	format, _ := json.Marshal(payloads[0]["response_format"])
+	if !strings.Contains(string(format), `"type":"json_schema"`) || !strings.Contains(string(format), `"name":"person"`) || !strings.Contains(string(format), `"required":["name","age"]`) {
+		t.Fatalf("unexpected response format %s", format)
+	}
+	repair, _ := json.Marshal(payloads[1]["messages"])
+	if !strings.Contains(string(repair), "Sure! The person is Ada.") || !strings.Contains(string(repair), "no JSON object") {
+		t.Fatalf("expected the repair prompt to quote the invalid answer, got %s", repair)
+	}
+
+	conversation := companion.GetConversation()
+	if len(conversation) != 2 || conversation[0].Content != request.Message.Content {
+		t.Fatalf("expected only the question and the valid answer in the conversation, got %+v", conversation)
+	}
+
+	answers = []string{`{"name":"Ada"}`}
+	payloads = nil
+	_, err = aicompanion.SendStructuredRequest[person](context.Background(), companion, request, 1)
+	if !errors.Is(err, aicompanion.ErrInvalidOutput) || !strings.Contains(err.Error(), "age") || len(payloads) != 2 {
+		t.Fatalf("expected invalid output after 2 attempts, got %v after %d", err, len(payloads))
+	}
+	if len(companion.GetConversation()) != 2 {
+		t.Fatalf("expected invalid answers to be removed from the conversation")
+	}
+}
+
+func TestOllamaFormat(t *testing.T) {
+	var format any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		format = payload["format"]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"llama3","done":true,"message":{"role":"assistant","content":"{\"name\":\"Ada\",\"age\":36}"}}`)
+	}))
+	defer server.Close()
+
+	config := aicompanion.NewDefaultConfig(models.Ollama, "", "llama3", "llama3", "nomic-embed-text")
+	config.ApiEndpoints.ApiChatURL = server.URL
+	companion := aicompanion.NewCompanion(*config)
+
+	request := models.MessageRequest{Message: models.Message{Role: models.User, Content: "Who?"}, ResponseFormat: &models.ResponseFormat{Type: models.JSONObject}}
+	if _, err := companion.SendChatRequest(context.Background(), request, false, nil); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if format != "json" {
+		t.Fatalf("expected json format, got %v", format)
+	}
+
+	request.ResponseFormat = nil
+	if _, err := aicompanion.SendStructuredRequest[person](context.Background(), companion, request, 0); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if schema, ok := format.(map[string]any); !ok || schema["type"] != "object" {
+		t.Fatalf("expected the schema as format, got %v", format)
+	}
+}
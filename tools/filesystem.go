@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Names of the filesystem tools.
+const (
+	ListFilesTool = "list_files"
+	ReadFileTool  = "read_file"
+)
+
+// Limits of the filesystem tools, keeping their results within the context of a model.
+const (
+	MaxFileSize    = 256 * 1024 // bytes of a file returned by read_file; longer files are truncated
+	MaxListEntries = 1000       // entries returned by list_files
+)
+
+// ErrOutsideRoot is returned for paths that lead outside the root of the filesystem tools.
+var ErrOutsideRoot = errors.New("path is outside of the allowed root")
+
+// ListFilesArgs are the arguments of list_files.
+type ListFilesArgs struct {
+	Path      string `json:"path,omitempty" description:"Directory relative to the root, the root itself if empty"`
+	Recursive bool   `json:"recursive,omitempty" description:"Whether to list the contents of subdirectories as well"`
+}
+
+// ReadFileArgs are the arguments of read_file.
+type ReadFileArgs struct {
+	Path string `json:"path" description:"File relative to the root"`
+}
+
+// FileEntry is an entry returned by list_files.
+type FileEntry struct {
+	Path string `json:"path"` // Relative to the root, separated by slashes
+	Dir  bool   `json:"dir,omitempty"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// sandbox resolves paths of the model within root.
+type sandbox struct {
+	root string // absolute, with symlinks resolved
+}
+
+// RegisterFilesystem registers the tools list_files and read_file, which give the model read access to
+// the text files under root, e.g. a directory of notes. Paths are relative to root; paths leading outside
+// of it, also by symlinks, are refused with ErrOutsideRoot.
+func RegisterFilesystem(registry *Registry, root string) error {
+	absolute, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(absolute)
+	if err != nil {
+		return fmt.Errorf("invalid filesystem root: %w", err)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return fmt.Errorf("filesystem root %s is not a directory", root)
+	}
+	box := sandbox{root: resolved}
+
+	if err := RegisterFunc(registry, ListFilesTool, "Lists the files and directories available to read", box.listFiles); err != nil {
+		return err
+	}
+	return RegisterFunc(registry, ReadFileTool, "Reads a text file", box.readFile)
+}
+
+// resolve returns the absolute path of name, refusing paths outside of the root.
+func (box sandbox) resolve(name string) (string, error) {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s is not relative to the root", ErrOutsideRoot, name)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(box.root, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s does not exist", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot access %s", name)
+	}
+	if _, inside := box.relative(resolved); !inside {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, name)
+	}
+	return resolved, nil
+}
+
+// relative returns path relative to the root, separated by slashes, and whether path is within the root.
+func (box sandbox) relative(path string) (string, bool) {
+	relative, err := filepath.Rel(box.root, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(relative), true
+}
+
+// listFiles implements list_files.
+func (box sandbox) listFiles(ctx context.Context, args ListFilesArgs) (any, error) {
+	directory, err := box.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []FileEntry{}
+	err = filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == directory {
+				return fmt.Errorf("cannot list %s", args.Path)
+			}
+			return nil // skip unreadable entries
+		}
+		if path == directory {
+			if !entry.IsDir() {
+				return fmt.Errorf("%s is not a directory", args.Path)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(entries) == MaxListEntries {
+			return fs.SkipAll
+		}
+
+		relative, _ := box.relative(path)
+		fileEntry := FileEntry{Path: relative, Dir: entry.IsDir()}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			fileEntry.Size = info.Size()
+		}
+		entries = append(entries, fileEntry)
+
+		if entry.IsDir() && !args.Recursive {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// readFile implements read_file.
+func (box sandbox) readFile(ctx context.Context, args ReadFileArgs) (any, error) {
+	path, err := box.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s", args.Path)
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", args.Path)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s", args.Path)
+	}
+	truncated := len(content) > MaxFileSize
+	if truncated {
+		content = content[:MaxFileSize]
+		// do not cut a character in half
+		for !utf8.Valid(content) && len(content) > MaxFileSize-utf8.UTFMax {
+			content = content[:len(content)-1]
+		}
+	}
+	if !utf8.Valid(content) {
+		return nil, fmt.Errorf("%s is not a text file", args.Path)
+	}
+
+	text := string(content)
+	if truncated {
+		text += fmt.Sprintf("\n[truncated after %d bytes]", len(content))
+	}
+	return text, nil
+}
@@ -0,0 +1,58 @@
+package tools_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+func TestFilesystem(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "notes")
+	os.MkdirAll(filepath.Join(root, "work"), 0o755)
+	os.WriteFile(filepath.Join(root, "todo.md"), []byte("- buy milk"), 0o644)
+	os.WriteFile(filepath.Join(root, "work", "meeting.md"), []byte("agenda"), 0o644)
+	os.WriteFile(filepath.Join(root, "image.bin"), []byte{0xff, 0xfe, 0x00}, 0o644)
+	os.WriteFile(filepath.Join(base, "secret.txt"), []byte("secret"), 0o644)
+	os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root, "link.txt"))
+
+	registry := tools.NewRegistry()
+	if err := tools.RegisterFilesystem(registry, root); err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string, args map[string]any) (models.FunctionResponse, error) {
+		return registry.Call(context.Background(), models.FunctionPayload{FunctionName: name, Arguments: args})
+	}
+
+	response, err := call(tools.ReadFileTool, map[string]any{"path": "work/meeting.md"})
+	if err != nil || response.Message != "agenda" {
+		t.Errorf("unexpected response %+v: %v", response, err)
+	}
+
+	response, err = call(tools.ListFilesTool, map[string]any{})
+	if err != nil || !strings.Contains(response.Message, `"path":"todo.md"`) || !strings.Contains(response.Message, `"path":"work","dir":true`) || strings.Contains(response.Message, "meeting.md") {
+		t.Errorf("unexpected listing %+v: %v", response, err)
+	}
+	response, err = call(tools.ListFilesTool, map[string]any{"path": "work", "recursive": true})
+	if err != nil || response.Message != `[{"path":"work/meeting.md","size":6}]` {
+		t.Errorf("unexpected listing %+v: %v", response, err)
+	}
+
+	for _, path := range []string{"../secret.txt", "link.txt", filepath.Join(base, "secret.txt")} {
+		if _, err := call(tools.ReadFileTool, map[string]any{"path": path}); !errors.Is(err, tools.ErrOutsideRoot) {
+			t.Errorf("expected ErrOutsideRoot reading %s, got %v", path, err)
+		}
+	}
+	if _, err := call(tools.ReadFileTool, map[string]any{"path": "image.bin"}); err == nil || !strings.Contains(err.Error(), "not a text file") {
+		t.Errorf("expected binary files to be refused, got %v", err)
+	}
+	if _, err := call(tools.ReadFileTool, map[string]any{"path": "missing.md"}); err == nil || strings.Contains(err.Error(), base) {
+		t.Errorf("expected an error not revealing the root, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+// Package tools provides a registry of tools implemented by Go functions, which companions call in
+// process instead of sending the tool call to the HTTP endpoint of a models.Tool.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ErrUnknownTool is returned when calling a function that is not registered.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// Handler implements a tool. It receives the arguments of the tool call and returns the result sent back
+// to the model: strings as they are, a models.FunctionResponse unchanged and any other value as JSON.
+type Handler func(ctx context.Context, args map[string]any) (any, error)
+
+type registeredTool struct {
+	definition models.Function
+	handler    Handler
+}
+
+// Registry keeps tools implemented by Go functions. It is safe for concurrent use; a nil Registry has no
+// tools.
+type Registry struct {
+	mutex sync.RWMutex
+	tools map[string]registeredTool
+}
+
+// NewRegistry creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]registeredTool)}
+}
+
+// Register registers handler as the tool name, described to the model by schema. The name of the schema
+// is set to name. Registering a name again replaces the tool.
+func (registry *Registry) Register(name string, schema models.FunctionDefinition, handler Handler) error {
+	if name == "" {
+		return errors.New("tool name must not be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("tool %s has no handler", name)
+	}
+
+	schema.FunctionName = name
+	if schema.Parameters.Type == "" {
+		schema.Parameters.Type = models.ObjectType
+	}
+	if schema.Parameters.Properties == nil {
+		schema.Parameters.Properties = make(map[string]models.Parameter)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if registry.tools == nil {
+		registry.tools = make(map[string]registeredTool)
+	}
+	registry.tools[name] = registeredTool{
+		definition: models.Function{Type: models.TypeFunction, Function: schema},
+		handler:    handler,
+	}
+	return nil
+}
+
+// Unregister removes the tool name.
+func (registry *Registry) Unregister(name string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	delete(registry.tools, name)
+}
+
+// Has reports whether the tool name is registered.
+func (registry *Registry) Has(name string) bool {
+	if registry == nil {
+		return false
+	}
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	_, exists := registry.tools[name]
+	return exists
+}
+
+// Definition returns the definition of the tool name.
+func (registry *Registry) Definition(name string) (models.FunctionDefinition, bool) {
+	if registry == nil {
+		return models.FunctionDefinition{}, false
+	}
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	tool, exists := registry.tools[name]
+	return tool.definition.Function, exists
+}
+
+// Definitions returns the definitions of the registered tools, sorted by name.
+func (registry *Registry) Definitions() []models.Function {
+	if registry == nil {
+		return nil
+	}
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	definitions := make([]models.Function, 0, len(registry.tools))
+	for _, tool := range registry.tools {
+		definitions = append(definitions, tool.definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Function.FunctionName < definitions[j].Function.FunctionName
+	})
+	return definitions
+}
+
+// Call runs the tool named by payload. Errors of the handler are returned along with a response with
+// FunctionResponseStatusError, which can be sent back to the model.
+func (registry *Registry) Call(ctx context.Context, payload models.FunctionPayload) (models.FunctionResponse, error) {
+	var tool registeredTool
+	var exists bool
+	if registry != nil {
+		registry.mutex.RLock()
+		tool, exists = registry.tools[payload.FunctionName]
+		registry.mutex.RUnlock()
+	}
+	if !exists {
+		err := fmt.Errorf("%w: %s", ErrUnknownTool, payload.FunctionName)
+		return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}, err
+	}
+
+	arguments := payload.Arguments
+	if arguments == nil {
+		arguments = make(map[string]any)
+	}
+	result, err := tool.handler(ctx, arguments)
+	if err != nil {
+		return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}, err
+	}
+	return newResponse(result)
+}
+
+// newResponse converts the result of a handler into a response.
+func newResponse(result any) (models.FunctionResponse, error) {
+	switch value := result.(type) {
+	case models.FunctionResponse:
+		return value, nil
+	case string:
+		return models.FunctionResponse{Status: models.FunctionResponseStatusSuccess, Message: value}, nil
+	case nil:
+		return models.FunctionResponse{Status: models.FunctionResponseStatusSuccess}, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize tool result: %w", err)
+		return models.FunctionResponse{Status: models.FunctionResponseStatusError, Message: err.Error()}, err
+	}
+	return models.FunctionResponse{Status: models.FunctionResponseStatusSuccess, Message: string(data)}, nil
+}
@@ -0,0 +1,58 @@
+package tools_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := tools.NewRegistry()
+	schema := models.FunctionDefinition{
+		Description: "Adds two numbers",
+		Parameters: models.FunctionParameter{
+			Properties: map[string]models.Parameter{"a": {Type: "number"}, "b": {Type: "number"}},
+			Required:   []string{"a", "b"},
+		},
+	}
+	err := registry.Register("add", schema, func(ctx context.Context, args map[string]any) (any, error) {
+		return map[string]float64{"sum": args["a"].(float64) + args["b"].(float64)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register("fail", models.FunctionDefinition{}, func(context.Context, map[string]any) (any, error) {
+		return nil, errors.New("broken")
+	})
+	if err := registry.Register("", schema, nil); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+
+	definitions := registry.Definitions()
+	if len(definitions) != 2 || definitions[0].Function.FunctionName != "add" || definitions[0].Type != models.TypeFunction || definitions[1].Function.Parameters.Type != models.ObjectType {
+		t.Errorf("unexpected definitions %+v", definitions)
+	}
+
+	response, err := registry.Call(context.Background(), models.FunctionPayload{FunctionName: "add", Arguments: map[string]any{"a": 1.0, "b": 2.0}})
+	if err != nil || response.Status != models.FunctionResponseStatusSuccess || response.Message != `{"sum":3}` {
+		t.Errorf("unexpected response %+v: %v", response, err)
+	}
+
+	response, err = registry.Call(context.Background(), models.FunctionPayload{FunctionName: "fail"})
+	if err == nil || response.Status != models.FunctionResponseStatusError || response.Message != "broken" {
+		t.Errorf("unexpected response %+v: %v", response, err)
+	}
+
+	if _, err := registry.Call(context.Background(), models.FunctionPayload{FunctionName: "missing"}); !errors.Is(err, tools.ErrUnknownTool) {
+		t.Errorf("expected ErrUnknownTool, got %v", err)
+	}
+
+	registry.Unregister("fail")
+	var empty *tools.Registry
+	if registry.Has("fail") || empty.Has("add") || empty.Definitions() != nil {
+		t.Error("expected the tools to be gone")
+	}
+}
@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema generates the parameters of a tool from the argument struct T. Properties are named by their
+// json tags, and fields without json tag by their name; fields tagged json:"-" and unexported fields are
+// skipped. Fields are required unless their json tag has the omitempty option. The tags description and
+// enum (a comma separated list) describe a field:
+//
+//	type WeatherArgs struct {
+//		City string `json:"city" description:"Name of the city"`
+//		Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+//	}
+//
+// Strings map to string, integers to integer, floats to number and booleans to boolean; slices and arrays
+// map to array, and structs and maps to object. Nested structs are described with their properties,
+// time.Time as string, and the fields of embedded structs are promoted like by encoding/json. Other
+// types, such as interfaces, channels and functions, and recursive structs return an error.
+func Schema[T any]() (models.FunctionParameter, error) {
+	var zero T
+	parameter, err := schemaOf(reflect.TypeOf(zero), make(map[reflect.Type]bool))
+	if err != nil {
+		return models.FunctionParameter{}, err
+	}
+	if parameter.Type != string(models.ObjectType) || parameter.Properties == nil {
+		return models.FunctionParameter{}, fmt.Errorf("arguments of a tool must be a struct, got %T", zero)
+	}
+	return models.FunctionParameter{Type: models.ObjectType, Properties: parameter.Properties, Required: parameter.Required}, nil
+}
+
+// Definition generates the definition of the tool name with the parameters of the argument struct T, see
+// Schema.
+func Definition[T any](name, description string) (models.FunctionDefinition, error) {
+	parameters, err := Schema[T]()
+	if err != nil {
+		return models.FunctionDefinition{}, err
+	}
+	return models.FunctionDefinition{FunctionName: name, Description: description, Parameters: parameters}, nil
+}
+
+// Decode decodes the arguments of a tool call into v, usually a pointer to the argument struct.
+func Decode(args map[string]any, v any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// RegisterFunc registers handler as the tool name with the parameters generated from its argument struct
+// T, see Schema. The arguments of calls are decoded into T before handler is called.
+func RegisterFunc[T any](registry *Registry, name, description string, handler func(ctx context.Context, args T) (any, error)) error {
+	definition, err := Definition[T](name, description)
+	if err != nil {
+		return err
+	}
+	return registry.Register(name, definition, func(ctx context.Context, args map[string]any) (any, error) {
+		var decoded T
+		if err := Decode(args, &decoded); err != nil {
+			return nil, err
+		}
+		return handler(ctx, decoded)
+	})
+}
+
+// schemaOf describes a type as parameter. visiting holds the structs being described, whose recursive
+// use cannot be described.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) (models.Parameter, error) {
+	if t == nil {
+		return models.Parameter{}, fmt.Errorf("cannot describe nil type")
+	}
+	t = indirect(t)
+	if t == timeType {
+		return models.Parameter{Type: "string", Description: "RFC 3339 date and time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return models.Parameter{Type: "string"}, nil
+	case reflect.Bool:
+		return models.Parameter{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return models.Parameter{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return models.Parameter{Type: "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return models.Parameter{}, err
+		}
+		return models.Parameter{Type: "array", Items: &items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return models.Parameter{}, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		return models.Parameter{Type: "object"}, nil
+	case reflect.Struct:
+		return structSchema(t, visiting)
+	default:
+		return models.Parameter{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// structSchema describes a struct as object parameter with its fields as properties.
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool) (models.Parameter, error) {
+	if visiting[t] {
+		return models.Parameter{}, fmt.Errorf("recursive type %s", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	parameter := models.Parameter{Type: "object", Properties: make(map[string]models.Parameter)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" && field.Anonymous && indirect(field.Type).Kind() == reflect.Struct {
+			embedded, err := structSchema(indirect(field.Type), visiting)
+			if err != nil {
+				return models.Parameter{}, err
+			}
+			for name, property := range embedded.Properties {
+				parameter.Properties[name] = property
+			}
+			parameter.Required = append(parameter.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := schemaOf(field.Type, visiting)
+		if err != nil {
+			return models.Parameter{}, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if description, exists := field.Tag.Lookup("description"); exists {
+			property.Description = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			for _, value := range strings.Split(enum, ",") {
+				property.Enum = append(property.Enum, strings.TrimSpace(value))
+			}
+		}
+
+		parameter.Properties[name] = property
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			parameter.Required = append(parameter.Required, name)
+		}
+	}
+	return parameter, nil
+}
+
+// indirect returns the type pointers point to.
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
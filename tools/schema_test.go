@@ -0,0 +1,88 @@
+package tools_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/models"
+	"github.com/ghmer/aicompanion/tools"
+)
+
+type Location struct {
+	City    string `json:"city" description:"Name of the city"`
+	Country string `json:"country,omitempty"`
+}
+
+type ForecastArgs struct {
+	Location
+	Unit   string     `json:"unit,omitempty" enum:"celsius, fahrenheit"`
+	Days   int        `json:"days" description:"Number of days"`
+	Hourly *bool      `json:"hourly,omitempty"`
+	Stops  []Location `json:"stops,omitempty"`
+	Since  time.Time  `json:"since,omitempty"`
+	Secret string     `json:"-"`
+	ignore int
+}
+
+type Node struct {
+	Children []Node `json:"children"`
+}
+
+func TestSchema(t *testing.T) {
+	definition, err := tools.Definition[ForecastArgs]("forecast", "Forecasts the weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := definition.Parameters
+	if definition.FunctionName != "forecast" || parameters.Type != models.ObjectType {
+		t.Errorf("unexpected definition %+v", definition)
+	}
+	if !reflect.DeepEqual(parameters.Required, []string{"city", "days"}) {
+		t.Errorf("unexpected required fields %v", parameters.Required)
+	}
+
+	properties := parameters.Properties
+	if len(properties) != 7 || properties["city"].Description != "Name of the city" || properties["days"].Type != "integer" || properties["hourly"].Type != "boolean" {
+		t.Errorf("unexpected properties %+v", properties)
+	}
+	if !reflect.DeepEqual(properties["unit"].Enum, []string{"celsius", "fahrenheit"}) {
+		t.Errorf("unexpected enum %v", properties["unit"].Enum)
+	}
+	stops := properties["stops"]
+	if stops.Type != "array" || stops.Items == nil || stops.Items.Type != "object" || stops.Items.Properties["country"].Type != "string" {
+		t.Errorf("unexpected array %+v", stops)
+	}
+	if properties["since"].Type != "string" {
+		t.Errorf("expected times to be strings, got %+v", properties["since"])
+	}
+
+	if _, err := tools.Schema[struct{ Callback func() }](); err == nil {
+		t.Error("expected an error for a function field")
+	}
+	if _, err := tools.Schema[Node](); err == nil {
+		t.Error("expected an error for a recursive type")
+	}
+	if _, err := tools.Schema[string](); err == nil {
+		t.Error("expected an error for arguments that are no struct")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	registry := tools.NewRegistry()
+	err := tools.RegisterFunc(registry, "forecast", "Forecasts the weather", func(ctx context.Context, args ForecastArgs) (any, error) {
+		return args.City + " in " + args.Unit, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := registry.Call(context.Background(), models.FunctionPayload{FunctionName: "forecast", Arguments: map[string]any{"city": "Oslo", "unit": "celsius", "days": 2}})
+	if err != nil || response.Message != "Oslo in celsius" {
+		t.Errorf("unexpected response %+v: %v", response, err)
+	}
+	if _, err := registry.Call(context.Background(), models.FunctionPayload{FunctionName: "forecast", Arguments: map[string]any{"days": "two"}}); err == nil {
+		t.Error("expected an error for invalid arguments")
+	}
+}
@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ghmer/aicompanion/models"
+)
+
+// ValidationError lists the problems of the arguments of a tool call.
+type ValidationError struct {
+	Function string
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("invalid arguments for %s: %s", err.Function, strings.Join(err.Problems, "; "))
+}
+
+// Validate checks the arguments of a tool call against the parameters of its function: required
+// properties must be present, values must match the type of their property and, where it has one, its
+// enum. Properties the function does not describe are accepted. All problems are reported in a single
+// *ValidationError.
+func Validate(function models.FunctionDefinition, args map[string]any) error {
+	var problems []string
+	validateObject("", function.Parameters.Properties, function.Parameters.Required, args, &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Function: function.FunctionName, Problems: problems}
+	}
+	return nil
+}
+
+// validateObject checks the properties of an object.
+func validateObject(path string, properties map[string]models.Parameter, required []string, object map[string]any, problems *[]string) {
+	for _, name := range required {
+		if value, exists := object[name]; !exists || value == nil {
+			*problems = append(*problems, fmt.Sprintf("missing required property %s", join(path, name)))
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value, exists := object[name]; exists && value != nil {
+			validateValue(join(path, name), properties[name], value, problems)
+		}
+	}
+}
+
+// validateValue checks a value against its parameter.
+func validateValue(path string, parameter models.Parameter, value any, problems *[]string) {
+	if !matchesType(parameter.Type, value) {
+		*problems = append(*problems, fmt.Sprintf("%s must be of type %s, got %s", path, parameter.Type, typeName(value)))
+		return
+	}
+
+	if len(parameter.Enum) > 0 && !slices.Contains(parameter.Enum, fmt.Sprint(value)) {
+		*problems = append(*problems, fmt.Sprintf("%s must be one of %s, got %v", path, strings.Join(parameter.Enum, ", "), value))
+	}
+
+	switch value := value.(type) {
+	case []any:
+		if parameter.Items != nil {
+			for i, item := range value {
+				validateValue(fmt.Sprintf("%s[%d]", path, i), *parameter.Items, item, problems)
+			}
+		}
+	case map[string]any:
+		validateObject(path, parameter.Properties, parameter.Required, value, problems)
+	}
+}
+
+// matchesType reports whether a decoded JSON value has the JSON schema type. Unknown and empty types
+// match any value.
+func matchesType(schemaType string, value any) bool {
+	switch schemaType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := number(value)
+		return ok
+	case "integer":
+		n, ok := number(value)
+		return ok && n == math.Trunc(n)
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+// number returns the value of numbers as decoded from JSON or set by Go code.
+func number(value any) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case json.Number:
+		n, err := value.Float64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// typeName names the JSON type of a decoded value.
+func typeName(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	if _, ok := number(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// join joins the path of a property.
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
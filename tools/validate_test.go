@@ -0,0 +1,38 @@
+package tools_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ghmer/aicompanion/tools"
+)
+
+func TestValidate(t *testing.T) {
+	definition, err := tools.Definition[ForecastArgs]("forecast", "Forecasts the weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := map[string]any{"city": "Berlin", "days": float64(3), "unit": "celsius", "stops": []any{map[string]any{"city": "Hamburg"}}}
+	if err := tools.Validate(definition, valid); err != nil {
+		t.Errorf("unexpected error for valid arguments: %v", err)
+	}
+
+	invalid := map[string]any{"days": 1.5, "unit": "kelvin", "hourly": "yes", "stops": []any{map[string]any{"country": "DE"}}}
+	err = tools.Validate(definition, invalid)
+	var validation *tools.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		"missing required property city",
+		"days must be of type integer, got number",
+		"hourly must be of type boolean, got string",
+		"missing required property stops[0].city",
+		"unit must be one of celsius, fahrenheit, got kelvin",
+	}
+	if validation.Function != "forecast" || !reflect.DeepEqual(validation.Problems, expected) {
+		t.Errorf("unexpected problems %+v", validation)
+	}
+}
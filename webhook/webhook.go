@@ -0,0 +1,224 @@
+// Package webhook delivers signed notifications about completed long-running jobs, such as ingestion
+// runs, batch embeddings or agent tasks, so asynchronous callers don't need to poll.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EventType identifies the kind of job an event reports on.
+type EventType string
+
+const (
+	EventIngestionCompleted EventType = "ingestion.completed"
+	EventEmbeddingCompleted EventType = "embedding.completed"
+	EventAgentCompleted     EventType = "agent.completed"
+	EventJobCompleted       EventType = "job.completed"
+)
+
+// EventStatus reports whether a job succeeded.
+type EventStatus string
+
+const (
+	StatusSuccess EventStatus = "success"
+	StatusError   EventStatus = "error"
+)
+
+// headers set on every delivery
+const (
+	HeaderSignature = "X-AICompanion-Signature"
+	HeaderEvent     = "X-AICompanion-Event"
+	HeaderDelivery  = "X-AICompanion-Delivery"
+	HeaderTimestamp = "X-AICompanion-Timestamp"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Event is the payload delivered to the webhook endpoint.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      EventType   `json:"type"`
+	Status    EventStatus `json:"status"`
+	Timestamp time.Time   `json:"timestamp"`
+	Duration  float64     `json:"duration_seconds,omitempty"`
+	Data      any         `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Notifier delivers events to a webhook endpoint. Payloads are signed with HMAC-SHA256 if a secret is
+// set, and failed deliveries (network errors, 429 and 5xx responses) are retried with exponential backoff.
+type Notifier struct {
+	URL         string
+	Secret      string
+	MaxAttempts int
+	Backoff     time.Duration
+	HttpClient  *http.Client
+}
+
+// NewNotifier creates a new Notifier with default retry settings.
+func NewNotifier(url, secret string) *Notifier {
+	return &Notifier{
+		URL:         url,
+		Secret:      secret,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		HttpClient:  &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Notify delivers an event, retrying until it is accepted or the attempts are exhausted.
+func (notifier *Notifier) Notify(ctx context.Context, event Event) error {
+	if event.ID == "" {
+		event.ID = newDeliveryID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	attempts := notifier.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	backoff := notifier.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff << (attempt - 1)):
+			}
+		}
+
+		retry, err := notifier.deliver(ctx, event, payload)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return fmt.Errorf("failed to deliver webhook %s: %w", event.ID, lastErr)
+}
+
+// NotifyAsync delivers an event in the background and reports the result to done, if set.
+func (notifier *Notifier) NotifyAsync(ctx context.Context, event Event, done func(error)) {
+	go func() {
+		err := notifier.Notify(ctx, event)
+		if done != nil {
+			done(err)
+		}
+	}()
+}
+
+// deliver performs a single delivery attempt and reports whether a failure is worth retrying.
+func (notifier *Notifier) deliver(ctx context.Context, event Event, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(event.Timestamp.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(event.Type))
+	req.Header.Set(HeaderDelivery, event.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if notifier.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(notifier.Secret, timestamp, payload))
+	}
+
+	client := notifier.HttpClient
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+}
+
+// Sign computes the signature header value for a payload: sha256=<hex hmac of "timestamp.payload">.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received webhook. Receivers should additionally reject stale timestamps.
+func Verify(secret, timestamp string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
+
+// RunJob runs job in the background and delivers an event of the given type once it has finished.
+// The returned channel receives the delivery result.
+func RunJob(ctx context.Context, notifier *Notifier, eventType EventType, job func(ctx context.Context) (any, error)) <-chan error {
+	result := make(chan error, 1)
+
+	go func() {
+		start := time.Now()
+		data, err := job(ctx)
+
+		event := Event{
+			Type:     eventType,
+			Status:   StatusSuccess,
+			Duration: time.Since(start).Seconds(),
+			Data:     data,
+		}
+		if err != nil {
+			event.Status = StatusError
+			event.Error = err.Error()
+		}
+
+		// deliver even if the job was cancelled, so the caller learns about it
+		result <- notifier.Notify(context.WithoutCancel(ctx), event)
+	}()
+
+	return result
+}
+
+// newDeliveryID returns a random identifier for a delivery.
+func newDeliveryID() string {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buffer)
+}
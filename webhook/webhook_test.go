@@ -0,0 +1,64 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghmer/aicompanion/webhook"
+)
+
+func TestNotifier(t *testing.T) {
+	t.Run("Test signed delivery with retries", func(t *testing.T) {
+		var attempts atomic.Int32
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if !webhook.Verify("secret", r.Header.Get(webhook.HeaderTimestamp), body, r.Header.Get(webhook.HeaderSignature)) {
+				t.Errorf("invalid signature %s", r.Header.Get(webhook.HeaderSignature))
+			}
+
+			if attempts.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer mockServer.Close()
+
+		notifier := webhook.NewNotifier(mockServer.URL, "secret")
+		notifier.Backoff = time.Millisecond
+
+		err := notifier.Notify(context.Background(), webhook.Event{Type: webhook.EventJobCompleted, Status: webhook.StatusSuccess})
+		if err != nil {
+			t.Fatalf("expected delivery to succeed, got %v", err)
+		}
+
+		if attempts.Load() != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("Test no retry on client error", func(t *testing.T) {
+		var attempts atomic.Int32
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer mockServer.Close()
+
+		notifier := webhook.NewNotifier(mockServer.URL, "")
+		notifier.Backoff = time.Millisecond
+
+		if err := notifier.Notify(context.Background(), webhook.Event{Type: webhook.EventJobCompleted}); err == nil {
+			t.Error("expected delivery to fail, got nil")
+		}
+
+		if attempts.Load() != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts.Load())
+		}
+	})
+}